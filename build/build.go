@@ -47,7 +47,9 @@ func main() {
 		}
 
 		cmd := exec.Command("go", "build", "-ldflags="+ldflags, "-o", outputName, ".")
-		cmd.Env = append(os.Environ(), "GOOS="+t.OS, "GOARCH="+t.Arch)
+		// Without cgo, as cross-compiling needs: every dependency, the
+		// SQLite driver included, is pure Go.
+		cmd.Env = append(os.Environ(), "GOOS="+t.OS, "GOARCH="+t.Arch, "CGO_ENABLED=0")
 		output, err := cmd.CombinedOutput()
 		if err != nil {
 			log.Fatalf("failed to build for %s/%s: %v\n%s", t.OS, t.Arch, err, output)
@@ -0,0 +1,35 @@
+#!/bin/sh
+# Regenerates the client stubs from pkg/rpc/pb/dreamfs.proto, the same
+# definition the Go server is generated from. Run after changing the proto.
+#
+#   clients/generate.sh [python|typescript]   (default: both)
+#
+# Needs: python -m pip install grpcio-tools (Python), and npm install in
+# clients/typescript (TypeScript).
+set -eu
+
+only=${1:-}
+
+clients=$(cd "$(dirname "$0")" && pwd)
+proto_dir="$clients/../pkg/rpc/pb"
+
+# Python: mapping the proto into the package keeps the generated imports
+# package-relative (from dreamfs._pb import dreamfs_pb2).
+if [ "$only" != typescript ]; then
+	mkdir -p "$clients/python/dreamfs/_pb"
+	touch "$clients/python/dreamfs/_pb/__init__.py"
+	(cd "$clients/python" && python -m grpc_tools.protoc \
+		-I"dreamfs/_pb=$proto_dir" \
+		--python_out=. --pyi_out=. --grpc_python_out=. \
+		dreamfs/_pb/dreamfs.proto)
+fi
+
+# TypeScript: the proto is loaded at runtime by @grpc/proto-loader; the
+# generated files are only its types.
+if [ "$only" != python ]; then
+	mkdir -p "$clients/typescript/proto"
+	cp "$proto_dir/dreamfs.proto" "$clients/typescript/proto/"
+	(cd "$clients/typescript" && npx proto-loader-gen-types \
+		--grpcLib=@grpc/grpc-js --longs=Number --defaults --oneofs \
+		--outDir=src/generated proto/dreamfs.proto)
+fi
@@ -0,0 +1,10 @@
+"""Client for the gRPC API of a DreamFS indexer node ('indexer serve --grpc-addr').
+
+    >>> from dreamfs import Client
+    >>> with Client("nas:9090") as c:
+    ...     df = c.dataframe('size > 1GB AND path ~ "*.iso"')
+"""
+
+from .client import Client
+
+__all__ = ["Client"]
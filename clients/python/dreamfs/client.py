@@ -0,0 +1,125 @@
+"""A thin wrapper over the generated Store stubs that speaks plain dicts.
+
+Records come back as dicts with the JSON field names of the HTTP API
+(_id, filePath, hostID, size, modTime, blake3, plus every extra field such
+as tags), so code can move between the two without renaming columns.
+"""
+
+from typing import Any, Dict, Iterable, Iterator, List, Mapping, Optional
+
+import grpc
+from google.protobuf import json_format
+
+try:
+    from ._pb import dreamfs_pb2, dreamfs_pb2_grpc
+except ImportError as e:
+    raise ImportError(
+        "dreamfs stubs are missing; run clients/generate.sh or install the package"
+    ) from e
+
+
+def _to_dict(msg: "dreamfs_pb2.FileMetadata") -> Dict[str, Any]:
+    doc = json_format.MessageToDict(msg.extra) if msg.HasField("extra") else {}
+    doc.update(
+        {
+            "_id": msg.id,
+            "idString": msg.id_string,
+            "hostID": msg.host_id,
+            "filePath": msg.file_path,
+            "size": msg.size,
+            "modTime": msg.mod_time,
+            "blake3": msg.blake3,
+        }
+    )
+    return doc
+
+
+_FIELDS = {"_id", "idString", "hostID", "filePath", "size", "modTime", "blake3"}
+
+
+def _from_dict(doc: Mapping[str, Any]) -> "dreamfs_pb2.FileMetadata":
+    msg = dreamfs_pb2.FileMetadata(
+        id=doc.get("_id", ""),
+        id_string=doc.get("idString", ""),
+        host_id=doc.get("hostID", ""),
+        file_path=doc.get("filePath", ""),
+        size=int(doc.get("size", 0)),
+        mod_time=doc.get("modTime", ""),
+        blake3=doc.get("blake3", ""),
+    )
+    extra = {k: v for k, v in doc.items() if k not in _FIELDS}
+    if extra:
+        msg.extra.update(extra)
+    return msg
+
+
+class Client:
+    """Connects to an indexer's gRPC API.
+
+    target is host:port. Pass credentials (e.g. grpc.ssl_channel_credentials())
+    for a TLS channel; the default is plaintext.
+    """
+
+    def __init__(self, target: str = "localhost:9090",
+                 credentials: Optional[grpc.ChannelCredentials] = None):
+        if credentials is None:
+            self._channel = grpc.insecure_channel(target)
+        else:
+            self._channel = grpc.secure_channel(target, credentials)
+        self._stub = dreamfs_pb2_grpc.StoreStub(self._channel)
+
+    def close(self) -> None:
+        self._channel.close()
+
+    def __enter__(self) -> "Client":
+        return self
+
+    def __exit__(self, *exc: Any) -> None:
+        self.close()
+
+    def query(self, query: str = "", selector: Optional[Mapping[str, str]] = None,
+              limit: int = 0) -> Iterator[Dict[str, Any]]:
+        """Yields the records matching a query in the language of
+        'indexer query' and equality selectors (both optional)."""
+        req = dreamfs_pb2.QueryRequest(query=query, selector=dict(selector or {}), limit=limit)
+        for msg in self._stub.Query(req):
+            yield _to_dict(msg)
+
+    def dataframe(self, query: str = "", selector: Optional[Mapping[str, str]] = None,
+                  limit: int = 0):
+        """Returns the matches of query() as a pandas DataFrame, with modTime
+        parsed as a timestamp. Needs pandas."""
+        import pandas as pd
+
+        df = pd.DataFrame(self.query(query, selector, limit))
+        if "modTime" in df:
+            df["modTime"] = pd.to_datetime(df["modTime"], utc=True, errors="coerce")
+        return df
+
+    def put(self, docs: Iterable[Mapping[str, Any]]) -> List[Dict[str, Any]]:
+        """Stores records; returns one {"id", "ok", "error"} per record."""
+        resp = self._stub.Put(dreamfs_pb2.PutRequest(docs=[_from_dict(d) for d in docs]))
+        return [{"id": r.id, "ok": r.ok, "error": r.error} for r in resp.results]
+
+    def delete(self, id: str, purge: bool = False) -> Optional[Dict[str, Any]]:
+        """Writes a tombstone for the record's file (or, with purge, removes
+        the record from this node only). Returns the tombstone, or None if
+        the record was not found or was purged."""
+        resp = self._stub.Delete(dreamfs_pb2.DeleteRequest(id=id, purge=purge))
+        if not resp.found or not resp.HasField("tombstone"):
+            return None
+        return _to_dict(resp.tombstone)
+
+    def subscribe(self, since: int = 0, include_docs: bool = False) -> Iterator[Dict[str, Any]]:
+        """Yields the changes after sequence since, then each new change
+        until the iteration is abandoned."""
+        req = dreamfs_pb2.SubscribeRequest(since=since, include_docs=include_docs)
+        for c in self._stub.Subscribe(req):
+            change = {"seq": c.seq, "id": c.id, "rev": c.rev, "deleted": c.deleted}
+            if c.HasField("doc"):
+                change["doc"] = _to_dict(c.doc)
+            yield change
+
+    def peers(self) -> List[str]:
+        """Returns the swarm peers the node knows."""
+        return list(self._stub.PeerList(dreamfs_pb2.PeerListRequest()).peers)
@@ -0,0 +1,228 @@
+// A thin wrapper over the Store service (pkg/rpc/pb/dreamfs.proto) that
+// speaks plain objects. Records use the JSON field names of the HTTP API
+// (_id, filePath, hostID, size, modTime, blake3, plus every extra field such
+// as tags), so code can move between the two without renaming columns.
+
+import * as path from "path";
+import * as grpc from "@grpc/grpc-js";
+import * as protoLoader from "@grpc/proto-loader";
+
+import type { ProtoGrpcType } from "./generated/dreamfs";
+import type { StoreClient } from "./generated/dreamfs/v1/Store";
+import type { FileMetadata, FileMetadata__Output } from "./generated/dreamfs/v1/FileMetadata";
+import type { Struct, Struct__Output } from "./generated/google/protobuf/Struct";
+import type { Value, Value__Output } from "./generated/google/protobuf/Value";
+
+/** A stored record. */
+export interface FileRecord {
+  _id: string;
+  idString: string;
+  hostID: string;
+  filePath: string;
+  size: number;
+  modTime: string; // RFC 3339
+  blake3: string;
+  [field: string]: unknown; // Extra fields (tags, deleted, hashMode...)
+}
+
+/** A change from the node's change feed. */
+export interface Change {
+  seq: number;
+  id: string;
+  rev: string;
+  deleted: boolean;
+  doc?: FileRecord; // With includeDocs, for writes
+}
+
+export interface PutResult {
+  id: string;
+  ok: boolean;
+  error: string; // Why the record was not stored
+}
+
+// The options must match the flags generate.sh passes proto-loader-gen-types.
+const loaderOptions: protoLoader.Options = {
+  keepCase: false,
+  longs: Number,
+  defaults: true,
+  oneofs: true,
+};
+
+let storeConstructor: typeof StoreClient | undefined;
+
+function loadStore(): typeof StoreClient {
+  if (!storeConstructor) {
+    const def = protoLoader.loadSync(path.join(__dirname, "..", "proto", "dreamfs.proto"), loaderOptions);
+    const proto = grpc.loadPackageDefinition(def) as unknown as ProtoGrpcType;
+    storeConstructor = proto.dreamfs.v1.Store as unknown as typeof StoreClient;
+  }
+  return storeConstructor;
+}
+
+function fromValue(v: Value__Output): unknown {
+  switch (v.kind) {
+    case "numberValue":
+      return v.numberValue;
+    case "stringValue":
+      return v.stringValue;
+    case "boolValue":
+      return v.boolValue;
+    case "structValue":
+      return v.structValue ? fromStruct(v.structValue) : {};
+    case "listValue":
+      return (v.listValue?.values ?? []).map(fromValue);
+    default:
+      return null;
+  }
+}
+
+function fromStruct(s: Struct__Output): Record<string, unknown> {
+  const out: Record<string, unknown> = {};
+  for (const [k, v] of Object.entries(s.fields ?? {})) {
+    out[k] = fromValue(v);
+  }
+  return out;
+}
+
+function toValue(v: unknown): Value {
+  if (v === null || v === undefined) return { nullValue: "NULL_VALUE" };
+  if (typeof v === "number") return { numberValue: v };
+  if (typeof v === "string") return { stringValue: v };
+  if (typeof v === "boolean") return { boolValue: v };
+  if (Array.isArray(v)) return { listValue: { values: v.map(toValue) } };
+  return { structValue: toStruct(v as Record<string, unknown>) };
+}
+
+function toStruct(obj: Record<string, unknown>): Struct {
+  const fields: Record<string, Value> = {};
+  for (const [k, v] of Object.entries(obj)) {
+    fields[k] = toValue(v);
+  }
+  return { fields };
+}
+
+const recordFields = new Set(["_id", "idString", "hostID", "filePath", "size", "modTime", "blake3"]);
+
+function toRecord(msg: FileMetadata__Output): FileRecord {
+  return {
+    ...(msg.extra ? fromStruct(msg.extra) : {}),
+    _id: msg.id,
+    idString: msg.idString,
+    hostID: msg.hostId,
+    filePath: msg.filePath,
+    size: msg.size,
+    modTime: msg.modTime,
+    blake3: msg.blake3,
+  };
+}
+
+function fromRecord(doc: Partial<FileRecord>): FileMetadata {
+  const extra: Record<string, unknown> = {};
+  for (const [k, v] of Object.entries(doc)) {
+    if (!recordFields.has(k)) extra[k] = v;
+  }
+  return {
+    id: doc._id ?? "",
+    idString: doc.idString ?? "",
+    hostId: doc.hostID ?? "",
+    filePath: doc.filePath ?? "",
+    size: doc.size ?? 0,
+    modTime: doc.modTime ?? "",
+    blake3: doc.blake3 ?? "",
+    extra: Object.keys(extra).length > 0 ? toStruct(extra) : undefined,
+  };
+}
+
+/**
+ * Connects to an indexer's gRPC API ('indexer serve --grpc-addr').
+ *
+ * target is host:port. Pass credentials (e.g. grpc.credentials.createSsl())
+ * for a TLS channel; the default is plaintext.
+ */
+export class Client {
+  private readonly stub: StoreClient;
+
+  constructor(target = "localhost:9090", credentials: grpc.ChannelCredentials = grpc.credentials.createInsecure()) {
+    const Store = loadStore();
+    this.stub = new Store(target, credentials);
+  }
+
+  close(): void {
+    this.stub.close();
+  }
+
+  /**
+   * Yields the records matching a query in the language of 'indexer query'
+   * and equality selectors (both optional).
+   */
+  async *query(query = "", selector: Record<string, string> = {}, limit = 0): AsyncGenerator<FileRecord> {
+    const call = this.stub.query({ query, selector, limit });
+    try {
+      for await (const msg of call) {
+        yield toRecord(msg as FileMetadata__Output);
+      }
+    } finally {
+      call.cancel();
+    }
+  }
+
+  /** Collects the matches of query() into an array. */
+  async all(query = "", selector: Record<string, string> = {}, limit = 0): Promise<FileRecord[]> {
+    const docs: FileRecord[] = [];
+    for await (const doc of this.query(query, selector, limit)) {
+      docs.push(doc);
+    }
+    return docs;
+  }
+
+  /** Stores records; resolves to one result per record. */
+  put(docs: Partial<FileRecord>[]): Promise<PutResult[]> {
+    return new Promise((resolve, reject) => {
+      this.stub.put({ docs: docs.map(fromRecord) }, (err, resp) => {
+        if (err || !resp) return reject(err);
+        resolve(resp.results.map((r) => ({ id: r.id, ok: r.ok, error: r.error })));
+      });
+    });
+  }
+
+  /**
+   * Writes a tombstone for the record's file (or, with purge, removes the
+   * record from this node only). Resolves to the tombstone, or undefined if
+   * the record was not found or was purged.
+   */
+  delete(id: string, purge = false): Promise<FileRecord | undefined> {
+    return new Promise((resolve, reject) => {
+      this.stub.delete({ id, purge }, (err, resp) => {
+        if (err || !resp) return reject(err);
+        resolve(resp.found && resp.tombstone ? toRecord(resp.tombstone) : undefined);
+      });
+    });
+  }
+
+  /**
+   * Yields the changes after sequence since, then each new change until
+   * the iteration is abandoned.
+   */
+  async *subscribe(since = 0, includeDocs = false): AsyncGenerator<Change> {
+    const call = this.stub.subscribe({ since, includeDocs });
+    try {
+      for await (const c of call) {
+        const change: Change = { seq: c.seq, id: c.id, rev: c.rev, deleted: c.deleted };
+        if (c.doc) change.doc = toRecord(c.doc);
+        yield change;
+      }
+    } finally {
+      call.cancel();
+    }
+  }
+
+  /** Resolves to the swarm peers the node knows. */
+  peers(): Promise<string[]> {
+    return new Promise((resolve, reject) => {
+      this.stub.peerList({}, (err, resp) => {
+        if (err || !resp) return reject(err);
+        resolve(resp.peers);
+      });
+    });
+  }
+}
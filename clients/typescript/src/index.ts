@@ -0,0 +1,2 @@
+export { Client } from "./client";
+export type { Change, FileRecord, PutResult } from "./client";
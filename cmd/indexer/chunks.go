@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+func init() {
+	chunksCmd := &cobra.Command{
+		Use:   "chunks",
+		Short: "Inspect content-defined chunk lists",
+		Long: `Files indexed with --chunks are also split into content-defined chunks
+(FastCDC, about --chunk-size bytes each), whose boundaries move with the
+content, so files that differ by an insertion still share most chunks. The
+chunk lists are kept locally and are not replicated.`,
+	}
+
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show sub-file duplication across the newest revision of each chunked file",
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			host, _ := cmd.Flags().GetString("host")
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			st, err := ps.CollectChunkStats(host)
+			if err != nil {
+				color.Red("failed to collect chunk stats: %v", err)
+				os.Exit(1)
+			}
+			switch format {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(st); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+			case "text":
+				color.Cyan("Chunked files: %d", st.Files)
+				fmt.Printf("Chunks:        %d (%d distinct)\n", st.Chunks, st.UniqueChunks)
+				fmt.Printf("Content:       %s (%s distinct)\n", utils.FormatBytes(st.Bytes), utils.FormatBytes(st.UniqueBytes))
+				if st.Bytes > 0 {
+					fmt.Printf("Duplicated:    %s (%.1f%%)\n", utils.FormatBytes(st.Bytes-st.UniqueBytes),
+						100*float64(st.Bytes-st.UniqueBytes)/float64(st.Bytes))
+				}
+			default:
+				color.Red("unknown stats format: %s", format)
+				os.Exit(1)
+			}
+		},
+	}
+	statsCmd.Flags().String("format", "text", "Output format: text or json")
+	statsCmd.Flags().String("host", "", "Only count this host's files")
+
+	showCmd := &cobra.Command{
+		Use:   "show <path>",
+		Short: "List the chunks of a file's newest revision on this host",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			path, err := filepath.Abs(args[0])
+			if err != nil {
+				color.Red("failed to resolve %s: %v", args[0], err)
+				os.Exit(1)
+			}
+			if canonical, err := fileprocessor.CanonicalizePath(path); err == nil {
+				path = canonical
+			}
+			meta, found, err := ps.LatestFor(utils.HostID, path)
+			if err != nil {
+				color.Red("failed to read metadata: %v", err)
+				os.Exit(1)
+			}
+			if !found || meta.Deleted() {
+				color.Yellow("%s is not indexed on this host", path)
+				return
+			}
+			list, found, err := ps.Chunks(meta.ID)
+			if err != nil {
+				color.Red("failed to read chunk list: %v", err)
+				os.Exit(1)
+			}
+			if !found {
+				color.Yellow("%s was not chunked; index it with --chunks", path)
+				return
+			}
+			color.Cyan("%s: %d chunks", path, len(list.Chunks))
+			fmt.Printf("%-14s  %-10s  %-12s  %s\n", "OFFSET", "LENGTH", "BLAKE3", "OTHER RECORDS")
+			for _, ch := range list.Chunks {
+				holders, err := ps.ChunkHolders(ch.Hash)
+				if err != nil {
+					color.Red("failed to read chunk references: %v", err)
+					os.Exit(1)
+				}
+				fmt.Printf("%-14d  %-10d  %-12s  %d\n", ch.Offset, ch.Length, shortID(ch.Hash), len(holders)-1)
+			}
+		},
+	}
+
+	chunksCmd.AddCommand(statsCmd, showCmd)
+	rootCmd.AddCommand(chunksCmd)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+func init() {
+	conflictsCmd := &cobra.Command{
+		Use:   "conflicts",
+		Short: "Inspect records written concurrently on two hosts",
+		Long: `Each record carries a version counting every host's writes of it. When a
+peer sends a copy written without seeing the one stored here (e.g. both
+hosts edited its tags), the write with the later clock time is kept on every
+replica and the other is recorded as a conflict. Conflicts are recorded on
+each node that detects them and are not replicated.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recorded conflicts, oldest first",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			if format != "text" && format != "json" {
+				color.Red("unknown conflicts format: %s", format)
+				os.Exit(1)
+			}
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			conflicts, err := ps.Conflicts()
+			if err != nil {
+				color.Red("failed to read conflicts: %v", err)
+				os.Exit(1)
+			}
+			if format == "json" {
+				if conflicts == nil {
+					conflicts = []storage.Conflict{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(conflicts); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			if len(conflicts) == 0 {
+				color.Green("No conflicts")
+				return
+			}
+			for _, c := range conflicts {
+				printConflict(c)
+			}
+		},
+	}
+	listCmd.Flags().String("format", "text", "Output format: text or json")
+
+	clearCmd := &cobra.Command{
+		Use:   "clear [id...]",
+		Short: "Forget the conflicts of the given record IDs (or ID prefixes), or all",
+		Run: func(cmd *cobra.Command, args []string) {
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			n, err := ps.ClearConflicts(args...)
+			if err != nil {
+				color.Red("failed to clear conflicts: %v", err)
+				os.Exit(1)
+			}
+			color.Green("Cleared %d conflicts", n)
+		},
+	}
+
+	conflictsCmd.AddCommand(listCmd, clearCmd)
+	rootCmd.AddCommand(conflictsCmd)
+}
+
+func printConflict(c storage.Conflict) {
+	fmt.Printf("%s  %s  %s\n", c.Detected.Local().Format(time.DateTime), shortID(c.Kept.ID), c.Kept.FilePath)
+	for _, side := range []struct {
+		label string
+		meta  metadata.FileMetadata
+	}{{"kept", c.Kept}, {"discarded", c.Discarded}} {
+		_, clock := side.meta.Version()
+		written := "unknown"
+		if at, hostID, ok := metadata.ClockTime(clock); ok {
+			written = fmt.Sprintf("%s on %s", at.Local().Format(time.DateTime), shortHost(hostID))
+		}
+		fmt.Printf("  %-9s  written %s\n", side.label, written)
+	}
+	for _, field := range conflictFields(c.Kept, c.Discarded) {
+		kept, _ := c.Kept.Field(field)
+		discarded, _ := c.Discarded.Field(field)
+		fmt.Printf("  %-9s  %v -> %v\n", field, discarded, kept)
+	}
+}
+
+// conflictFields returns the fields whose values differ between two copies
+// of a record, other than their versions.
+func conflictFields(a, b metadata.FileMetadata) []string {
+	var fields []string
+	for _, field := range []string{"filePath", "size", "modTime", "blake3"} {
+		av, _ := a.Field(field)
+		bv, _ := b.Field(field)
+		if !reflect.DeepEqual(av, bv) {
+			fields = append(fields, field)
+		}
+	}
+	var extra []string
+	seen := map[string]bool{metadata.VersionVectorField: true, metadata.VersionClockField: true}
+	for _, m := range []map[string]interface{}{a.Extra, b.Extra} {
+		for field := range m {
+			if seen[field] {
+				continue
+			}
+			seen[field] = true
+			if !reflect.DeepEqual(a.Extra[field], b.Extra[field]) {
+				extra = append(extra, field)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return append(fields, extra...)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/dedupe"
+	"gnomatix/dreamfs/v2/pkg/query"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+func init() {
+	dedupeCmd := &cobra.Command{
+		Use:   "dedupe",
+		Short: "Find files with identical content across hosts",
+		Long: `Groups the latest revision of every indexed file by BLAKE3 fingerprint and
+lists the contents held by more than one file, largest reclaimable space
+first. The grouping is done in a fingerprint index stored next to the
+database (see --index-path), rebuilt on each run.
+
+Reclaimable space assumes one copy is kept per host. With --script, a shell
+script is written that hardlinks or deletes the extra copies on this host;
+each action is guarded by cmp, since fingerprints are sampled unless files
+were indexed with --hash-mode=full or chunked. Deleted copies are moved into
+quarantine, from where 'indexer quarantine restore' can put them back until
+they expire.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			local, _ := cmd.Flags().GetBool("local")
+			minSizeFlag, _ := cmd.Flags().GetString("min-size")
+			top, _ := cmd.Flags().GetInt("top")
+			scriptMode, _ := cmd.Flags().GetString("script")
+			output, _ := cmd.Flags().GetString("output")
+			indexPath, _ := cmd.Flags().GetString("index-path")
+
+			if format != "text" && format != "json" {
+				color.Red("unknown dedupe format: %s", format)
+				os.Exit(1)
+			}
+			if scriptMode != "" && scriptMode != dedupe.ModeHardlink && scriptMode != dedupe.ModeDelete {
+				color.Red("unknown script mode: %s (expected hardlink or delete)", scriptMode)
+				os.Exit(1)
+			}
+			minSize, err := query.ParseSize(minSizeFlag)
+			if err != nil {
+				color.Red("invalid --min-size %q: %v", minSizeFlag, err)
+				os.Exit(1)
+			}
+
+			dbPath := viper.GetString("dbpath")
+			if indexPath == "" {
+				indexPath = dedupe.DefaultIndexPath(dbPath)
+			}
+			ps, err := openStore(dbPath)
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			ix, err := dedupe.Build(ps, indexPath)
+			if err != nil {
+				color.Red("failed to build dedupe index: %v", err)
+				os.Exit(1)
+			}
+			defer ix.Close()
+
+			reclaimHost := ""
+			if local {
+				reclaimHost = utils.HostID
+			}
+			var groups []dedupe.Group
+			err = ix.Groups(func(g dedupe.Group) error {
+				if g.Size >= minSize && g.Reclaimable(reclaimHost) > 0 {
+					groups = append(groups, g)
+				}
+				return nil
+			})
+			if err != nil {
+				color.Red("failed to read dedupe index: %v", err)
+				os.Exit(1)
+			}
+			sort.SliceStable(groups, func(i, j int) bool {
+				return groups[i].Reclaimable(reclaimHost) > groups[j].Reclaimable(reclaimHost)
+			})
+
+			if scriptMode != "" {
+				var w io.Writer = os.Stdout
+				if output != "" {
+					f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+					if err != nil {
+						color.Red("failed to create script: %v", err)
+						os.Exit(1)
+					}
+					defer f.Close()
+					w = f
+				}
+				indexer, err := quarantineCommand(dbPath)
+				if err != nil {
+					color.Red("failed to locate the indexer executable: %v", err)
+					os.Exit(1)
+				}
+				if err := dedupe.WriteScript(w, groups, utils.HostID, scriptMode, indexer); err != nil {
+					color.Red("failed to write script: %v", err)
+					os.Exit(1)
+				}
+				if output != "" {
+					color.Green("Wrote %s script for this host to %s", scriptMode, output)
+				}
+				return
+			}
+
+			if top > 0 && len(groups) > top {
+				groups = groups[:top]
+			}
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(groups); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			printDedupeGroups(groups, reclaimHost)
+		},
+	}
+	dedupeCmd.Flags().String("format", "text", "Output format: text or json")
+	dedupeCmd.Flags().Bool("local", false, "Only count duplicates among this host's files")
+	dedupeCmd.Flags().String("min-size", "1", "Ignore contents smaller than this (e.g. 1MB)")
+	dedupeCmd.Flags().Int("top", 0, "Only show the N groups with the most reclaimable space (0 shows all)")
+	dedupeCmd.Flags().String("script", "", "Write a shell script that resolves this host's duplicates: hardlink or delete")
+	dedupeCmd.Flags().String("output", "", "Write the --script to this file instead of stdout")
+	dedupeCmd.Flags().String("index-path", "", "Path of the fingerprint index (default: <dbpath>.dedupe)")
+	rootCmd.AddCommand(dedupeCmd)
+}
+
+func printDedupeGroups(groups []dedupe.Group, reclaimHost string) {
+	var files int
+	var clusterBytes, hostBytes int64
+	for _, g := range groups {
+		color.Cyan("%s  %s x %d, reclaimable %s", g.BLAKE3[:min(16, len(g.BLAKE3))], utils.FormatBytes(g.Size), len(g.Copies), utils.FormatBytes(g.Reclaimable(reclaimHost)))
+		for _, c := range g.Copies {
+			if reclaimHost != "" && c.HostID != reclaimHost {
+				continue
+			}
+			fmt.Printf("  %s  %s\n", shortHost(c.HostID), c.Path)
+		}
+		files += len(g.Copies)
+		clusterBytes += g.Reclaimable("")
+		hostBytes += g.Reclaimable(utils.HostID)
+	}
+	fmt.Println()
+	color.Cyan("%d duplicate groups, %d files", len(groups), files)
+	if reclaimHost == "" {
+		fmt.Printf("Reclaimable across all hosts: %s\n", utils.FormatBytes(clusterBytes))
+	}
+	fmt.Printf("Reclaimable on this host:     %s\n", utils.FormatBytes(hostBytes))
+}
+
+// quarantineCommand returns the command line with which a generated script
+// runs this indexer against the same store and quarantine directory.
+func quarantineCommand(dbPath string) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if dbPath, err = filepath.Abs(dbPath); err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(quarantineDir())
+	if err != nil {
+		return nil, err
+	}
+	return []string{exe, "--dbpath", dbPath, "--quarantine-dir", dir}, nil
+}
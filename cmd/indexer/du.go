@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+func init() {
+	duCmd := &cobra.Command{
+		Use:   "du <path>",
+		Short: "Show the indexed size and file count of a directory tree",
+		Long: `Rolls up the size and number of the current files under a directory from
+the stored metadata, without walking the filesystem: the total, and that of
+each directory below it down to --depth levels (like 'du -d'). The figures
+are as of the last index run or watch update of those files.
+
+With --host the path is one of that host's, as recorded in the store, so
+disk usage on other machines of the swarm can be looked up too.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			host, _ := cmd.Flags().GetString("host")
+			depth, _ := cmd.Flags().GetInt("depth")
+			sortBy, _ := cmd.Flags().GetString("sort")
+			format, _ := cmd.Flags().GetString("format")
+			if format != "text" && format != "json" {
+				color.Red("unknown du format: %s", format)
+				os.Exit(1)
+			}
+			if sortBy != "path" && sortBy != "size" {
+				color.Red("unknown du sort order: %s", sortBy)
+				os.Exit(1)
+			}
+
+			root := args[0]
+			if host == "" {
+				host = utils.HostID
+				abs, err := filepath.Abs(root)
+				if err != nil {
+					color.Red("failed to resolve %s: %v", root, err)
+					os.Exit(1)
+				}
+				if canonical, err := fileprocessor.CanonicalizePath(abs); err == nil {
+					abs = canonical
+				}
+				root = abs
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			total, dirs, err := ps.DiskUsage(host, root, depth)
+			if err != nil {
+				color.Red("failed to read metadata: %v", err)
+				os.Exit(1)
+			}
+			if total.Files == 0 {
+				color.Red("no indexed files under %s on host %s", total.Path, host)
+				os.Exit(1)
+			}
+			sort.Slice(dirs, func(i, j int) bool {
+				if sortBy == "size" && dirs[i].Bytes != dirs[j].Bytes {
+					return dirs[i].Bytes > dirs[j].Bytes
+				}
+				return dirs[i].Path < dirs[j].Path
+			})
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				err := enc.Encode(struct {
+					storage.DirUsage
+					Host string             `json:"host"`
+					Dirs []storage.DirUsage `json:"dirs"`
+				}{total, host, dirs})
+				if err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			fmt.Printf("%12s  %10s  %s\n", "SIZE", "FILES", "PATH")
+			for _, u := range dirs {
+				fmt.Printf("%12s  %10d  %s\n", utils.FormatBytes(u.Bytes), u.Files, u.Path)
+			}
+			color.Cyan("%12s  %10d  %s", utils.FormatBytes(total.Bytes), total.Files, total.Path)
+		},
+	}
+	duCmd.Flags().String("host", "", "Host ID whose files to roll up, the path being as stored (default: this host)")
+	duCmd.Flags().IntP("depth", "d", 1, "Show directories down to this many levels below the path (0: the total only)")
+	duCmd.Flags().String("sort", "path", "Order directories by: path or size (largest first)")
+	duCmd.Flags().String("format", "text", "Output format: text or json")
+	rootCmd.AddCommand(duCmd)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/events"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// eventsReplayPage is how many changes 'events replay' reads, and delivers
+// before reporting progress, at once.
+const eventsReplayPage = 1000
+
+func init() {
+	eventsCmd := &cobra.Command{
+		Use:   "events",
+		Short: "Send the store's change events to webhooks and NATS",
+	}
+
+	replayCmd := &cobra.Command{
+		Use:   "replay --to <sink>",
+		Short: "Replay past changes to a webhook or NATS subject",
+		Long: `Sends the changes of the store's change log after --since, oldest first, to
+a sink, so that a consumer added later can backfill:
+
+  http://... or https://...               each change is POSTed as JSON
+  nats://[user:pass@]host[:port]/subject  each change is published to the
+                                          subject (core NATS, no TLS)
+
+An event carries the change's sequence, record ID, revision and deletion
+flag, and with --docs the current record (sealed with the realm, as the
+changes feed serves it). Webhook requests also carry the sequence in an
+X-Dreamfs-Seq header.
+
+The change log keeps one entry per record, at the sequence of its latest
+write or deletion, so a replay sends the current state of what changed
+after --since rather than every intermediate revision. If a delivery fails
+the replay stops and prints the --since to resume from; delivery is at least
+once, so a resumed replay may send some events again.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			since, _ := cmd.Flags().GetUint64("since")
+			until, _ := cmd.Flags().GetUint64("until")
+			target, _ := cmd.Flags().GetString("to")
+			includeDocs, _ := cmd.Flags().GetBool("docs")
+			headerArgs, _ := cmd.Flags().GetStringArray("header")
+			if target == "" {
+				color.Red("--to is required")
+				os.Exit(1)
+			}
+			headers := http.Header{}
+			for _, h := range headerArgs {
+				name, value, ok := strings.Cut(h, ":")
+				if !ok || strings.TrimSpace(name) == "" {
+					color.Red("invalid --header %q (want \"Name: value\")", h)
+					os.Exit(1)
+				}
+				headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			sink, err := events.Open(target, headers)
+			if err != nil {
+				color.Red("failed to open sink: %v", err)
+				os.Exit(1)
+			}
+			defer sink.Close()
+
+			delivered, sent := since, 0
+			fail := func(format string, args ...interface{}) {
+				color.Red(format, args...)
+				color.Yellow("Delivered %d events; resume with --since %d", sent, delivered)
+				os.Exit(1)
+			}
+			for done := false; !done; {
+				changes, _, pending, err := ps.Changes(delivered, eventsReplayPage, includeDocs)
+				if err != nil {
+					fail("failed to read changes: %v", err)
+				}
+				done = pending == 0
+				n := 0
+				for _, ch := range changes {
+					if until > 0 && ch.Seq > until {
+						done = true
+						break
+					}
+					e := events.Event{Seq: ch.Seq, ID: ch.ID, Rev: ch.Rev, Deleted: ch.Deleted, HostID: utils.HostID}
+					if ch.Doc != nil {
+						sealed, err := ps.Realm().Seal(*ch.Doc)
+						if err != nil {
+							fail("failed to seal %s: %v", ch.ID, err)
+						}
+						e.Doc = &sealed
+					}
+					if err := sink.Publish(e); err != nil {
+						fail("failed to publish change %d: %v", ch.Seq, err)
+					}
+					n++
+				}
+				if n == 0 {
+					break
+				}
+				if err := sink.Flush(); err != nil {
+					fail("failed to deliver changes %d-%d: %v", delivered+1, changes[n-1].Seq, err)
+				}
+				delivered, sent = changes[n-1].Seq, sent+n
+				if !viper.GetBool("quiet") && !done {
+					fmt.Printf("Delivered %d events (through sequence %d)\n", sent, delivered)
+				}
+			}
+			if sent == 0 {
+				color.Cyan("No changes after sequence %d", since)
+				return
+			}
+			color.Green("Replayed %d events (through sequence %d)", sent, delivered)
+		},
+	}
+	replayCmd.Flags().Uint64("since", 0, "Replay the changes after this sequence (0 for all)")
+	replayCmd.Flags().Uint64("until", 0, "Stop after this sequence (0 for the latest)")
+	replayCmd.Flags().String("to", "", "Sink: an http(s):// webhook URL or nats://host[:port]/subject")
+	replayCmd.Flags().Bool("docs", true, "Include each change's current record")
+	replayCmd.Flags().StringArray("header", nil, "Header for webhook requests, as \"Name: value\" (repeatable)")
+
+	eventsCmd.AddCommand(replayCmd)
+	rootCmd.AddCommand(eventsCmd)
+}
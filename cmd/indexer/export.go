@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+func init() {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export one host's records from the replicated store",
+		Long: `Writes the inventory of a single host, as replicated into this store: the
+current revision of each of its files (without deleted files), or with
+--history every stored revision including tombstones. Nothing belonging to
+other hosts is included, so a machine's inventory can be handed to its owner
+without sharing the whole cluster index. Fields the realm encrypts are
+written decrypted when this node holds the key.
+
+This host's files on a volume that is not mounted now, such as a detached
+external drive, are exported all the same, flagged with "offline": true
+and the volume's label (or ID) in "offlineVolume" (see 'indexer volumes
+list'). --offline exports only those: the catalog of the drives that are
+not plugged in.
+
+--canonical writes an export that is byte for byte the same whenever the
+records are: ordered by record ID, each record on its own line with its keys
+sorted and its timestamps in UTC, and without the offline flags, which
+depend on which drives happen to be mounted (--offline still selects).
+Exports of the same state taken on different runs, or different machines,
+can then be diffed and checksummed; with --output the SHA-256 of the file
+is printed.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			host, _ := cmd.Flags().GetString("host")
+			history, _ := cmd.Flags().GetBool("history")
+			format, _ := cmd.Flags().GetString("format")
+			output, _ := cmd.Flags().GetString("output")
+			onlyOffline, _ := cmd.Flags().GetBool("offline")
+			canonical, _ := cmd.Flags().GetBool("canonical")
+			if format != "json" && format != "jsonl" && format != "tsv" {
+				color.Red("unknown export format: %s", format)
+				os.Exit(1)
+			}
+			if host == "" {
+				host = utils.HostID
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			var metas []metadata.FileMetadata
+			if history {
+				err = ps.ForEach(func(meta metadata.FileMetadata) error {
+					if meta.HostID == host {
+						metas = append(metas, meta)
+					}
+					return nil
+				})
+			} else {
+				metas, err = hostFiles(ps, host)
+			}
+			if err != nil {
+				color.Red("failed to read records: %v", err)
+				os.Exit(1)
+			}
+			vols, err := fileprocessor.OfflineVolumes(ps)
+			if err != nil {
+				color.Red("failed to read volumes: %v", err)
+				os.Exit(1)
+			}
+			offline := offlineFilter{vols: vols, only: onlyOffline, unmarked: canonical}
+			kept := metas[:0]
+			for _, meta := range metas {
+				if offline.keep(&meta) {
+					kept = append(kept, meta)
+				}
+			}
+			if metas = kept; len(metas) == 0 && onlyOffline {
+				color.Red("no records of host %s on offline volumes", host)
+				os.Exit(1)
+			}
+			if len(metas) == 0 {
+				color.Red("no records for host %s", host)
+				if hosts, err := knownHosts(ps); err == nil && len(hosts) > 0 {
+					color.Yellow("Hosts in this store:")
+					for _, h := range hosts {
+						color.Yellow("  %s", h)
+					}
+				}
+				os.Exit(1)
+			}
+			sort.Slice(metas, func(i, j int) bool {
+				if canonical {
+					return metas[i].ID < metas[j].ID
+				}
+				if metas[i].FilePath != metas[j].FilePath {
+					return metas[i].FilePath < metas[j].FilePath
+				}
+				return metas[i].ModTime < metas[j].ModTime
+			})
+
+			var w io.Writer = os.Stdout
+			sum := sha256.New()
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					color.Red("failed to create %s: %v", output, err)
+					os.Exit(1)
+				}
+				defer f.Close()
+				w = io.MultiWriter(f, sum)
+			}
+			write := writeExport
+			if canonical {
+				write = writeCanonicalExport
+			}
+			if err := write(w, metas, format); err != nil {
+				color.Red("failed to write export: %v", err)
+				os.Exit(1)
+			}
+			if output != "" {
+				color.Green("Exported %d records of host %s to %s", len(metas), host, output)
+				if canonical {
+					color.Green("SHA-256 %x", sum.Sum(nil))
+				}
+			}
+		},
+	}
+	exportCmd.Flags().String("host", "", "Host ID whose records to export (default: this host)")
+	exportCmd.Flags().Bool("history", false, "Export every stored revision, including tombstones, not just current files")
+	exportCmd.Flags().String("format", "json", "Output format: json, jsonl or tsv")
+	exportCmd.Flags().Bool("offline", false, "Only export files on volumes that are not mounted now")
+	exportCmd.Flags().Bool("canonical", false, "Write a stable export, ordered by ID with sorted keys and UTC timestamps, for diffing and checksums")
+	exportCmd.Flags().StringP("output", "o", "", "Write to this file instead of standard output")
+	rootCmd.AddCommand(exportCmd)
+}
+
+// hostFiles returns the current files of a host, page by page through the
+// path index.
+func hostFiles(ps *storage.PersistentStore, host string) ([]metadata.FileMetadata, error) {
+	var metas []metadata.FileMetadata
+	cursor := ""
+	for {
+		page, next, err := ps.ListFiles(storage.FileFilter{HostID: host}, cursor, 1000)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, page...)
+		if next == "" {
+			return metas, nil
+		}
+		cursor = next
+	}
+}
+
+// knownHosts lists the distinct host IDs in the store.
+func knownHosts(ps *storage.PersistentStore) ([]string, error) {
+	seen := map[string]bool{}
+	err := ps.ForEach(func(meta metadata.FileMetadata) error {
+		seen[meta.HostID] = true
+		return nil
+	})
+	hosts := make([]string, 0, len(seen))
+	for h := range seen {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts, err
+}
+
+func writeExport(w io.Writer, metas []metadata.FileMetadata, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(metas)
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, meta := range metas {
+			if err := enc.Encode(meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		cw := csv.NewWriter(w)
+		cw.Comma = '\t'
+		cw.Write([]string{"_id", "filePath", "size", "modTime", "blake3", "deleted", "offline"})
+		for _, meta := range metas {
+			offline, _ := meta.Extra[metadata.OfflineVolumeField].(string)
+			cw.Write([]string{meta.ID, meta.FilePath, strconv.FormatInt(meta.Size, 10), meta.ModTime, meta.BLAKE3,
+				strconv.FormatBool(meta.Deleted()), offline})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+// writeCanonicalExport writes records in their canonical form (see
+// metadata.CanonicalJSON), one per line also in the json format, so that
+// the same records always make the same bytes.
+func writeCanonicalExport(w io.Writer, metas []metadata.FileMetadata, format string) error {
+	if format == "tsv" {
+		canon := make([]metadata.FileMetadata, len(metas))
+		for i, meta := range metas {
+			canon[i] = meta.Canonical()
+		}
+		return writeExport(w, canon, format)
+	}
+	bw := bufio.NewWriter(w)
+	if format == "json" {
+		bw.WriteString("[\n")
+	}
+	for i, meta := range metas {
+		data, err := metadata.CanonicalJSON(meta)
+		if err != nil {
+			return err
+		}
+		bw.Write(data)
+		if format == "json" && i < len(metas)-1 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n")
+	}
+	if format == "json" {
+		bw.WriteString("]\n")
+	}
+	return bw.Flush()
+}
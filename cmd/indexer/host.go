@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// retireBroadcastTimeout bounds how long 'host retire --swarm' waits for
+// the archived records to be gossiped before exiting.
+const retireBroadcastTimeout = 30 * time.Second
+
+func init() {
+	hostCmd := &cobra.Command{
+		Use:   "host",
+		Short: "Manage the hosts known to the store",
+	}
+
+	retireCmd := &cobra.Command{
+		Use:   "retire <hostID>",
+		Short: "Archive the records of a decommissioned host",
+		Long: `Marks every record of a host as archived, for machines that are being
+decommissioned. Archived records are kept for history ('indexer timeline',
+'indexer export --history') but no longer count as current files: they are
+left out of duplicates, reports, pin compliance, 'indexer du' and the file
+listing API.
+
+The archived records replicate like any other change; with --swarm they are
+also broadcast to the swarm right away. Archiving is one way: peers keep the
+archived revision over an unarchived copy of it, and a later scan on the
+host leaves unchanged files archived. Only files it indexes new or modified
+afterwards are current again.
+
+With --purge-after the records are deleted once that much time has passed,
+by the swarm leader's maintenance (see 'indexer serve').`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			hostID := args[0]
+			purgeAfter, _ := cmd.Flags().GetDuration("purge-after")
+			if purgeAfter < 0 {
+				color.Red("--purge-after must not be negative")
+				os.Exit(1)
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			now := time.Now()
+			var purgeAt time.Time
+			if purgeAfter > 0 {
+				purgeAt = now.Add(purgeAfter)
+			}
+			archived, err := ps.RetireHost(hostID, now, purgeAt)
+			if err != nil {
+				color.Red("failed to retire host %s: %v", hostID, err)
+				os.Exit(1)
+			}
+			if len(archived) == 0 {
+				color.Red("no records to archive for host %s", hostID)
+				if hosts, err := knownHosts(ps); err == nil && len(hosts) > 0 {
+					color.Yellow("Hosts in this store:")
+					for _, h := range hosts {
+						color.Yellow("  %s", h)
+					}
+				}
+				os.Exit(1)
+			}
+			color.Green("Archived %d records of host %s", len(archived), hostID)
+			if !purgeAt.IsZero() {
+				fmt.Printf("They will be purged after %s\n", purgeAt.Local().Format(time.DateTime))
+			}
+			if hostID == utils.HostID {
+				color.Yellow("This is the local host; only files it indexes new or modified from now on are current again")
+			}
+
+			if !viper.GetBool("swarm") {
+				return
+			}
+			ml, d, err := network.StartSwarm(ps)
+			if err != nil {
+				color.Red("failed to start swarm: %v", err)
+				os.Exit(1)
+			}
+			defer ml.Shutdown()
+			for _, meta := range archived {
+				if err := d.QueueMetadata(meta); err != nil {
+					color.Red("failed to broadcast %s: %v", meta.FilePath, err)
+				}
+			}
+			d.FlushBroadcasts()
+			deadline := time.Now().Add(retireBroadcastTimeout)
+			for d.Broadcasts.NumQueued() > 0 && time.Now().Before(deadline) {
+				time.Sleep(100 * time.Millisecond)
+			}
+			if n := d.Broadcasts.NumQueued(); n > 0 {
+				color.Yellow("%d records were not broadcast in time; peers will receive them through replication", n)
+			} else {
+				fmt.Println("Broadcast the archived records to the swarm")
+			}
+		},
+	}
+	retireCmd.Flags().Duration("purge-after", 0, "Delete the archived records this long after retirement (e.g. 2160h); 0 keeps them")
+	hostCmd.AddCommand(retireCmd)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the hosts in the store and whether they are retired",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			if format != "text" && format != "json" {
+				color.Red("unknown host list format: %s", format)
+				os.Exit(1)
+			}
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			hosts, err := ps.Hosts()
+			if err != nil {
+				color.Red("failed to read records: %v", err)
+				os.Exit(1)
+			}
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(hosts); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			printHosts(hosts)
+		},
+	}
+	listCmd.Flags().String("format", "text", "Output format: text or json")
+	hostCmd.AddCommand(listCmd)
+
+	rootCmd.AddCommand(hostCmd)
+}
+
+func printHosts(hosts []storage.HostSummary) {
+	fmt.Printf("%-16s  %-8s  %-20s  %s\n", "HOST", "RECORDS", "LAST SEEN", "STATUS")
+	for _, h := range hosts {
+		status := color.GreenString("active")
+		switch {
+		case h.Retired() && !h.PurgeAfter.IsZero():
+			status = color.YellowString("retired %s, purged after %s", h.RetiredAt.Local().Format(time.DateOnly), h.PurgeAfter.Local().Format(time.DateOnly))
+		case h.Retired():
+			status = color.YellowString("retired %s", h.RetiredAt.Local().Format(time.DateOnly))
+		case h.Archived > 0:
+			status = color.CyanString("active again (%d archived records)", h.Archived)
+		}
+		fmt.Printf("%-16s  %-8d  %-20s  %s\n", shortHost(h.HostID), h.Records, h.LastSeen, status)
+	}
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/hashicorp/memberlist"
@@ -15,14 +21,21 @@ import (
 
 	"gnomatix/dreamfs/v2/pkg/storage"
 	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/rpc"
 	"gnomatix/dreamfs/v2/pkg/fileprocessor"
 	"gnomatix/dreamfs/v2/pkg/utils"
 	"gnomatix/dreamfs/v2/pkg/config"
+	"gnomatix/dreamfs/v2/pkg/extract"
+	"gnomatix/dreamfs/v2/pkg/metrics"
 )
 
 // Global swarm delegate.
 var swarmDelegate *network.SwarmDelegate
 
+// indexBroadcastTimeout bounds how long 'index --swarm' waits for its last
+// records and scan claims to be gossiped before exiting.
+const indexBroadcastTimeout = 10 * time.Second
+
 var cfgFile string // Declare cfgFile at package level
 
 var rootCmd = &cobra.Command{
@@ -59,17 +72,18 @@ func init() { // Use init function for Cobra setup
 
 	// Global flags.
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default: indexer.json in XDG config directory)")
-	rootCmd.PersistentFlags().String("dbpath", utils.DefaultBoltDBPath(), "Path to the BoltDB file (default: XDG data directory)")
+	rootCmd.PersistentFlags().String("dbpath", utils.DefaultBoltDBPath(), "Path to the database file (default: XDG data directory)")
 	rootCmd.PersistentFlags().String("addr", ":8080", "Address to serve the replication endpoint")
 	// Default workers is 1 unless --all-procs is set.
 	rootCmd.PersistentFlags().Int("workers", config.DefaultWorkers, "Number of concurrent workers for indexing (default: 1, use --all-procs to use all available CPUs)")
 	rootCmd.PersistentFlags().Bool("all-procs", false, "Use all available processors (overrides --workers)")
 	rootCmd.PersistentFlags().Bool("quiet", config.DefaultQuiet, "Suppress spinner and progress messages")
 	rootCmd.PersistentFlags().Bool("swarm", false, "Enable swarm mode for p2p replication")
-	rootCmd.PersistentFlags().StringSlice("peers", []string{}, "Comma-separated list of peer addresses to join")
+	rootCmd.PersistentFlags().StringSlice("peers", []string{}, "Comma-separated list of peer addresses to join (retried with backoff, along with the peers recorded from earlier runs, while the node is alone)")
 	rootCmd.PersistentFlags().Int("swarmPort", config.DefaultSwarmPort, "Port for swarm memberlist")
 	rootCmd.PersistentFlags().Bool("stealth", config.DefaultStealth, "Enable stealth mode which disables mDNS auto-discovery (requires manual peer list)")
 	rootCmd.PersistentFlags().String("peerListURL", config.DefaultPeerListURL, "HTTP/HTTPS URL that returns a JSON array of peer addresses")
+	rootCmd.PersistentFlags().StringSlice("indexedFields", []string{}, "Extra metadata fields to maintain secondary indexes for (e.g. contentType,tags)")
 	viper.BindPFlag("dbpath", rootCmd.PersistentFlags().Lookup("dbpath"))
 	viper.BindPFlag("addr", rootCmd.PersistentFlags().Lookup("addr"))
 	viper.BindPFlag("workers", rootCmd.PersistentFlags().Lookup("workers"))
@@ -80,6 +94,79 @@ func init() { // Use init function for Cobra setup
 	viper.BindPFlag("swarmPort", rootCmd.PersistentFlags().Lookup("swarmPort"))
 	viper.BindPFlag("stealth", rootCmd.PersistentFlags().Lookup("stealth"))
 	viper.BindPFlag("peerListURL", rootCmd.PersistentFlags().Lookup("peerListURL"))
+	rootCmd.PersistentFlags().String("discovery", "", "Swarm peer discovery backend: "+strings.Join(network.DiscoveryModes, ", ")+" (default: http with --peerListURL, none with --stealth, else mdns)")
+	rootCmd.PersistentFlags().String("discovery-dns", "", "SRV name listing the swarm's nodes, for --discovery=dns (e.g. _dreamfs._udp.example.com)")
+	rootCmd.PersistentFlags().String("peers-file", "", "File of peer addresses, one per line, reread when it changes, for --discovery=file")
+	rootCmd.PersistentFlags().String("discovery-k8s-service", "", "Kubernetes headless service whose pods are the swarm, as name, name.namespace or a full DNS name, for --discovery=k8s")
+	rootCmd.PersistentFlags().Duration("discovery-interval", network.DefaultDiscoveryInterval, "How often the mdns, dns, k8s and http backends look for new peers (mdns also re-advertises the node if its address changed)")
+	viper.BindPFlag("discovery", rootCmd.PersistentFlags().Lookup("discovery"))
+	viper.BindPFlag("discoveryDNS", rootCmd.PersistentFlags().Lookup("discovery-dns"))
+	viper.BindPFlag("peersFile", rootCmd.PersistentFlags().Lookup("peers-file"))
+	viper.BindPFlag("discoveryK8sService", rootCmd.PersistentFlags().Lookup("discovery-k8s-service"))
+	viper.BindPFlag("discoveryInterval", rootCmd.PersistentFlags().Lookup("discovery-interval"))
+	viper.BindPFlag("indexedFields", rootCmd.PersistentFlags().Lookup("indexedFields"))
+	rootCmd.PersistentFlags().String("seed", "", "Seed server to register with and discover peers from (e.g. http://seed:8080; see 'indexer seed-server')")
+	rootCmd.PersistentFlags().String("seed-token", "", "Token for the seed server")
+	rootCmd.PersistentFlags().Duration("seed-ttl", time.Minute, "How long a seed registration lasts unless renewed")
+	viper.BindPFlag("seedURL", rootCmd.PersistentFlags().Lookup("seed"))
+	viper.BindPFlag("seedToken", rootCmd.PersistentFlags().Lookup("seed-token"))
+	viper.BindPFlag("seedTTL", rootCmd.PersistentFlags().Lookup("seed-ttl"))
+	rootCmd.PersistentFlags().Int64("mmap-threshold", 0, "Hash files of at least this many bytes through mmap where supported (0 disables)")
+	viper.BindPFlag("mmapThreshold", rootCmd.PersistentFlags().Lookup("mmap-threshold"))
+	rootCmd.PersistentFlags().String("realm", "", "Realm whose key encrypts sensitive fields at rest and in replication (see 'indexer realm')")
+	rootCmd.PersistentFlags().String("realm-key", "", "File holding the realm key")
+	rootCmd.PersistentFlags().StringSlice("encrypted-fields", []string{"filePath", "notes"}, "Fields the realm encrypts")
+	viper.BindPFlag("realm", rootCmd.PersistentFlags().Lookup("realm"))
+	viper.BindPFlag("realmKeyFile", rootCmd.PersistentFlags().Lookup("realm-key"))
+	viper.BindPFlag("encryptedFields", rootCmd.PersistentFlags().Lookup("encrypted-fields"))
+	rootCmd.PersistentFlags().String("signing-key", "", "File holding the Ed25519 key that signs scan manifests (created on first use; default: XDG data directory)")
+	viper.BindPFlag("signingKey", rootCmd.PersistentFlags().Lookup("signing-key"))
+	rootCmd.PersistentFlags().String("quarantine-dir", "", "Directory that soft-deleted files are moved into (default: XDG data directory; see 'indexer quarantine')")
+	viper.BindPFlag("quarantineDir", rootCmd.PersistentFlags().Lookup("quarantine-dir"))
+	rootCmd.PersistentFlags().Duration("lag-alert", 0, "Alert when a peer's records have not been merged for this long (0 disables; see /cluster and /metrics)")
+	viper.BindPFlag("lagAlert", rootCmd.PersistentFlags().Lookup("lag-alert"))
+	rootCmd.PersistentFlags().String("db-driver", storage.DriverBolt, "Database driver: bolt, or sqlite to keep the index in a SQLite file that can be queried with SQL (pure Go, so in cross-compiled builds too)")
+	viper.BindPFlag("dbDriver", rootCmd.PersistentFlags().Lookup("db-driver"))
+	rootCmd.PersistentFlags().Bool("full-state-sync", false, "Send the whole index on every swarm push/pull rather than a digest or sync URL (for peers that predate them)")
+	viper.BindPFlag("fullStateSync", rootCmd.PersistentFlags().Lookup("full-state-sync"))
+	rootCmd.PersistentFlags().Int("broadcast-batch", network.DefaultBroadcastBatch, "Broadcast up to this many records to the swarm as one compressed message (1 sends each on its own, for peers that predate batches)")
+	rootCmd.PersistentFlags().Duration("broadcast-batch-wait", network.DefaultBroadcastBatchWait, "How long a record waits for others to fill its broadcast batch")
+	viper.BindPFlag("broadcastBatch", rootCmd.PersistentFlags().Lookup("broadcast-batch"))
+	viper.BindPFlag("broadcastBatchWait", rootCmd.PersistentFlags().Lookup("broadcast-batch-wait"))
+	rootCmd.PersistentFlags().Bool("privacy", false, "Hash hostnames and truncate paths in what this node shares about itself and the cluster (swarm node name, metrics broadcasts, /cluster, /metrics, /stats); the store and local commands keep full values")
+	rootCmd.PersistentFlags().String("privacy-salt", "", "Salt for --privacy hashes, so they cannot be matched against guessed hostnames (nodes sharing it hash names alike)")
+	rootCmd.PersistentFlags().Int("privacy-path-depth", network.DefaultPrivacyPathDepth, "Leading directories of a path that --privacy keeps")
+	viper.BindPFlag("privacy", rootCmd.PersistentFlags().Lookup("privacy"))
+	viper.BindPFlag("privacySalt", rootCmd.PersistentFlags().Lookup("privacy-salt"))
+	viper.BindPFlag("privacyPathDepth", rootCmd.PersistentFlags().Lookup("privacy-path-depth"))
+	rootCmd.PersistentFlags().Int("compress-threshold", storage.DefaultCompressThreshold, "Store records of at least this many bytes compressed, with the bolt driver (0 disables)")
+	viper.BindPFlag("compressThreshold", rootCmd.PersistentFlags().Lookup("compress-threshold"))
+	rootCmd.PersistentFlags().String("control-addr", "127.0.0.1:8090", "Address of the watch daemon's control endpoint (see 'indexer touch-priority'; empty disables it)")
+	viper.BindPFlag("controlAddr", rootCmd.PersistentFlags().Lookup("control-addr"))
+	rootCmd.PersistentFlags().String("tls-cert", "", "Certificate (PEM) to serve the HTTP endpoints over TLS with, also presented to peers")
+	rootCmd.PersistentFlags().String("tls-key", "", "Private key (PEM) of --tls-cert")
+	rootCmd.PersistentFlags().String("tls-client-ca", "", "CA certificates (PEM); if set, HTTP clients must present a certificate they signed")
+	rootCmd.PersistentFlags().String("tls-ca", "", "CA certificates (PEM) trusted for peers' endpoints, besides the system's")
+	rootCmd.PersistentFlags().String("http-token", "", "Bearer token required by the HTTP endpoints, and sent to peers")
+	viper.BindPFlag("tlsCert", rootCmd.PersistentFlags().Lookup("tls-cert"))
+	viper.BindPFlag("tlsKey", rootCmd.PersistentFlags().Lookup("tls-key"))
+	viper.BindPFlag("tlsClientCA", rootCmd.PersistentFlags().Lookup("tls-client-ca"))
+	viper.BindPFlag("tlsCA", rootCmd.PersistentFlags().Lookup("tls-ca"))
+	viper.BindPFlag("httpToken", rootCmd.PersistentFlags().Lookup("http-token"))
+	rootCmd.PersistentFlags().String("swarm-key", "", "Key (hex or base64, 16/24/32 bytes) that encrypts and authenticates swarm gossip (see 'indexer swarm keygen')")
+	rootCmd.PersistentFlags().String("swarm-keyring", "", "File of swarm keys, one per line with the primary first, reloaded on change to rotate keys")
+	viper.BindPFlag("swarmKey", rootCmd.PersistentFlags().Lookup("swarm-key"))
+	viper.BindPFlag("swarmKeyring", rootCmd.PersistentFlags().Lookup("swarm-keyring"))
+	rootCmd.PersistentFlags().StringSlice("swarm-allow-cidr", nil, "Only let swarm nodes with addresses in these networks join (e.g. 10.0.0.0/8)")
+	rootCmd.PersistentFlags().StringSlice("swarm-deny-cidr", nil, "Refuse swarm nodes with addresses in these networks")
+	rootCmd.PersistentFlags().StringSlice("swarm-allow-host", nil, "Only let swarm nodes with these host IDs join")
+	rootCmd.PersistentFlags().StringSlice("swarm-deny-host", nil, "Refuse swarm nodes with these host IDs")
+	rootCmd.PersistentFlags().String("swarm-join-token", "", "Shared token swarm nodes must hold to join and send records")
+	viper.BindPFlag("swarmAllowCIDR", rootCmd.PersistentFlags().Lookup("swarm-allow-cidr"))
+	viper.BindPFlag("swarmDenyCIDR", rootCmd.PersistentFlags().Lookup("swarm-deny-cidr"))
+	viper.BindPFlag("swarmAllowHost", rootCmd.PersistentFlags().Lookup("swarm-allow-host"))
+	viper.BindPFlag("swarmDenyHost", rootCmd.PersistentFlags().Lookup("swarm-deny-host"))
+	viper.BindPFlag("swarmJoinToken", rootCmd.PersistentFlags().Lookup("swarm-join-token"))
 
 	// "index" command: Process a directory with per-subdirectory status and progress.
 	indexCmd := &cobra.Command{
@@ -89,7 +176,7 @@ func init() { // Use init function for Cobra setup
 		Run: func(cmd *cobra.Command, args []string) {
 			dir := args[0]
 			dbPath := viper.GetString("dbpath")
-			ps, err := storage.NewPersistentStore(dbPath)
+			ps, err := openStore(dbPath)
 			if err != nil {
 				color.Red("failed to open persistent store: %v", err)
 				os.Exit(1)
@@ -109,6 +196,7 @@ func init() { // Use init function for Cobra setup
 					os.Exit(1)
 				}
 				defer ml.Shutdown()
+				fileprocessor.SetSwarmDelegate(swarmDelegate)
 			}
 
 			ctx, cancel := context.WithCancel(context.Background())
@@ -120,12 +208,62 @@ func init() { // Use init function for Cobra setup
 				cancel()
 			}()
 
-			if err := fileprocessor.ProcessAllDirectories(ctx, dir, ps); err != nil {
+			if err := fileprocessor.ProcessAllDirectories(ctx, dir, ps); errors.Is(err, context.Canceled) {
+				color.Yellow("Interrupted; 'indexer index --resume %s' continues where this run stopped", dir)
+			} else if err != nil {
 				color.Red("Error during directory processing: %v", err)
 			}
+			if ml != nil && ml.NumMembers() > 1 {
+				swarmDelegate.FlushBroadcasts()
+				deadline := time.Now().Add(indexBroadcastTimeout)
+				for swarmDelegate.Broadcasts.NumQueued() > 0 && time.Now().Before(deadline) {
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
 		},
 	}
 
+	indexCmd.Flags().Bool("git-info", false, "Record git repo root, commit, and tracked/dirty status for files in work trees")
+	indexCmd.Flags().Bool("skip-git", true, "Skip .git directories while scanning")
+	indexCmd.Flags().Bool("text-stats", false, "Record line count, encoding, and language for text files")
+	viper.BindPFlag("gitInfo", indexCmd.Flags().Lookup("git-info"))
+	viper.BindPFlag("skipGit", indexCmd.Flags().Lookup("skip-git"))
+	viper.BindPFlag("textStats", indexCmd.Flags().Lookup("text-stats"))
+	indexCmd.Flags().StringSlice("exclude", nil, "Gitignore-style patterns of paths to skip (e.g. node_modules/,*.tmp); "+fileprocessor.IgnoreFileName+" files in the tree are honoured too")
+	indexCmd.Flags().StringSlice("include", nil, "Gitignore-style patterns; if set, only matching files are indexed (e.g. *.jpg,*.mp4)")
+	viper.BindPFlag("exclude", indexCmd.Flags().Lookup("exclude"))
+	viper.BindPFlag("include", indexCmd.Flags().Lookup("include"))
+	indexCmd.Flags().Bool("detect-types", false, "Record the MIME type (contentType) and kind (fileKind, e.g. video) sniffed from each file's first bytes")
+	viper.BindPFlag("detectTypes", indexCmd.Flags().Lookup("detect-types"))
+	indexCmd.Flags().StringSlice("extract", nil, "Format metadata to record: "+strings.Join(extract.Names(), ", ")+" or all (e.g. exif,id3)")
+	viper.BindPFlag("extract", indexCmd.Flags().Lookup("extract"))
+	indexCmd.Flags().String("hash-mode", "sampled", "Fingerprint strategy: sampled (head/middle/tail), full (whole content, as b3sum) or chunked (the same digest as full, hashed in parallel ranges)")
+	indexCmd.Flags().Int64("sample-size", 1<<20, "Bytes hashed from each of the head, middle and tail of a file in sampled mode")
+	indexCmd.Flags().Bool("full-hash", false, "Same as --hash-mode=chunked")
+	indexCmd.Flags().Int("hash-workers", 0, "Goroutines used to hash ranges of a single large file in chunked mode (0 = one per CPU)")
+	viper.BindPFlag("hashMode", indexCmd.Flags().Lookup("hash-mode"))
+	viper.BindPFlag("sampleSize", indexCmd.Flags().Lookup("sample-size"))
+	viper.BindPFlag("fullHash", indexCmd.Flags().Lookup("full-hash"))
+	viper.BindPFlag("hashWorkers", indexCmd.Flags().Lookup("hash-workers"))
+	indexCmd.Flags().Bool("chunks", false, "Also record content-defined (FastCDC) chunk lists, for sub-file dedupe statistics")
+	indexCmd.Flags().Int("chunk-size", 64<<10, "Average chunk size in bytes (a power of two) with --chunks")
+	viper.BindPFlag("chunks", indexCmd.Flags().Lookup("chunks"))
+	viper.BindPFlag("chunkSize", indexCmd.Flags().Lookup("chunk-size"))
+	indexCmd.Flags().Bool("lock-info", false, "Record whether files were locked or held open by other processes at scan time")
+	viper.BindPFlag("lockInfo", indexCmd.Flags().Lookup("lock-info"))
+	indexCmd.Flags().Bool("force", false, "Re-fingerprint files even if their size, mtime and inode are unchanged since the last scan")
+	viper.BindPFlag("force", indexCmd.Flags().Lookup("force"))
+	indexCmd.Flags().Bool("resume", false, "Continue an interrupted run of this directory, skipping the directories it completed")
+	viper.BindPFlag("resume", indexCmd.Flags().Lookup("resume"))
+	indexCmd.Flags().Bool("shared-scan", false, "With --swarm, split the scan of a network share (NFS, CIFS, ...) with the other nodes indexing it: each top-level subtree is scanned by one node per cycle and replicated to the rest")
+	indexCmd.Flags().Duration("shared-scan-cycle", time.Hour, "How long a node's scan of a shared subtree stands before another node scans it again")
+	viper.BindPFlag("sharedScan", indexCmd.Flags().Lookup("shared-scan"))
+	viper.BindPFlag("sharedScanCycle", indexCmd.Flags().Lookup("shared-scan-cycle"))
+	indexCmd.Flags().Int("anomaly-min-files", 100, "Alert on a burst of changes only if at least this many files are new or modified")
+	indexCmd.Flags().Float64("anomaly-factor", 3, "Alert when a root's change rate exceeds its baseline mean by this factor and by this many standard deviations")
+	viper.BindPFlag("anomalyMinFiles", indexCmd.Flags().Lookup("anomaly-min-files"))
+	viper.BindPFlag("anomalyFactor", indexCmd.Flags().Lookup("anomaly-factor"))
+
 	// "serve" command.
 	serveCmd := &cobra.Command{
 		Use:   "serve",
@@ -133,12 +271,25 @@ func init() { // Use init function for Cobra setup
 		Run: func(cmd *cobra.Command, args []string) {
 			dbPath := viper.GetString("dbpath")
 			addr := viper.GetString("addr")
-			ps, err := storage.NewPersistentStore(dbPath)
+			ps, err := openStore(dbPath)
 			if err != nil {
 				color.Red("failed to open persistent store: %v", err)
 				os.Exit(1)
 			}
 			defer ps.Close()
+			// SIGINT or SIGTERM drains the HTTP server, then the store is
+			// closed cleanly by the deferred Close
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				cancel()
+			}()
+			if viper.GetString("syncURL") == "" {
+				viper.Set("syncURL", network.DefaultSyncURL(addr))
+			}
 			var ml *memberlist.Memberlist
 			if viper.GetBool("swarm") {
 				ml, swarmDelegate, err = network.StartSwarm(ps) // Assign to global swarmDelegate
@@ -147,10 +298,75 @@ func init() { // Use init function for Cobra setup
 					os.Exit(1)
 				}
 				defer ml.Shutdown()
+				// Copies of pinned content the leader assigns to this host
+				swarmDelegate.SetPinCopier(&network.PinCopier{
+					Dir:    viper.GetString("pinDir"),
+					Verify: fileprocessor.MatchesRecord,
+					Index: func(path string) error {
+						_, err := fileprocessor.ProcessFile(ctx, path, ps, true)
+						return err
+					},
+				})
+			}
+			if interval := viper.GetDuration("maintenanceInterval"); interval > 0 {
+				tasks := []network.MaintenanceTask{
+					network.TombstoneGCTask(ps, swarmDelegate, viper.GetDuration("tombstoneRetention")),
+					network.RetiredHostsTask(ps, swarmDelegate),
+					network.ReportTask(ps, ml),
+				}
+				var policies []network.PinPolicy
+				if err := viper.UnmarshalKey("pins", &policies); err != nil {
+					color.Red("invalid \"pins\" config: %v", err)
+					os.Exit(1)
+				}
+				if len(policies) > 0 {
+					tasks = append(tasks, network.PinsTask(ps, swarmDelegate, policies))
+				}
+				go network.RunMaintenance(ctx, ml, interval, tasks)
+			}
+			if network.LagThreshold() > 0 {
+				go network.WatchLag(ps, ctx.Done())
+			}
+			// Resource metrics of this node and its peers, for 'indexer status'
+			go metrics.RunBroadcasts(swarmDelegate, metrics.DefaultBroadcastInterval, ctx.Done())
+			http.HandleFunc("/peer-metrics", metrics.HandlePeerMetrics)
+			if grpcAddr := viper.GetString("grpcAddr"); grpcAddr != "" {
+				go func() {
+					if err := rpc.Serve(grpcAddr, ps); err != nil {
+						color.Red("gRPC server error: %v", err)
+						os.Exit(1)
+					}
+				}()
 			}
-			network.StartHTTPServer(addr, ps)
+			if err := network.StartHTTPServer(ctx, addr, ps); err != nil {
+				color.Red("HTTP server error: %v", err)
+				ps.Close()
+				os.Exit(1)
+			}
+			if ml != nil {
+				// Tell the swarm this node is leaving rather than let it be
+				// found dead
+				ml.Leave(time.Second)
+			}
+			color.Green("Server stopped")
 		},
 	}
+	serveCmd.Flags().String("grpc-addr", "", "Also serve the gRPC API (query, put, delete, change subscription, peer list) on this address, e.g. :9090, with the TLS and --http-token settings of HTTP")
+	viper.BindPFlag("grpcAddr", serveCmd.Flags().Lookup("grpc-addr"))
+	serveCmd.Flags().Duration("maintenance-interval", time.Hour, "How often the swarm leader runs cluster maintenance (tombstone GC, retired host purge, pin reconciliation, cluster report); 0 disables it")
+	serveCmd.Flags().Duration("tombstone-retention", 30*24*time.Hour, "Keep deleted files' tombstones this long before the leader purges them")
+	viper.BindPFlag("maintenanceInterval", serveCmd.Flags().Lookup("maintenance-interval"))
+	viper.BindPFlag("tombstoneRetention", serveCmd.Flags().Lookup("tombstone-retention"))
+	serveCmd.Flags().Bool("serve-blobs", false, "Serve the content of this host's indexed files at /blob/<fingerprint> for 'indexer open' on peers")
+	viper.BindPFlag("serveBlobs", serveCmd.Flags().Lookup("serve-blobs"))
+	serveCmd.Flags().String("pin-dir", filepath.Join(utils.XDGDataHome(), "indexer", "pins"), "Where to store the copies of pinned content the swarm leader assigns to this host (see 'indexer pins')")
+	viper.BindPFlag("pinDir", serveCmd.Flags().Lookup("pin-dir"))
+	serveCmd.Flags().Bool("serve-previews", false, "Serve the first KB of this host's indexed files, with binary detection, at /preview/<id>")
+	viper.BindPFlag("servePreviews", serveCmd.Flags().Lookup("serve-previews"))
+	serveCmd.Flags().String("sync-url", "", "URL swarm peers reach this node's /sync endpoint at (default: from --addr and this host's address)")
+	viper.BindPFlag("syncURL", serveCmd.Flags().Lookup("sync-url"))
+	serveCmd.Flags().Duration("shutdown-timeout", network.DefaultShutdownTimeout, "On SIGINT or SIGTERM, how long to let requests in flight finish before closing their connections")
+	viper.BindPFlag("shutdownTimeout", serveCmd.Flags().Lookup("shutdown-timeout"))
 
 	// "dump" command.
 	dumpCmd := &cobra.Command{
@@ -159,7 +375,7 @@ func init() { // Use init function for Cobra setup
 		Run: func(cmd *cobra.Command, args []string) {
 			dbPath := viper.GetString("dbpath")
 			format := viper.GetString("format")
-			ps, err := storage.NewPersistentStore(dbPath)
+			ps, err := openStore(dbPath)
 			if err != nil {
 				color.Red("failed to open persistent store: %v", err)
 				os.Exit(1)
@@ -187,6 +403,42 @@ func init() { // Use init function for Cobra setup
 	rootCmd.AddCommand(monitorCmd)
 }
 
+// storePath returns the file a driver keeps the store in: dbPath, except
+// that the default path gets the driver's own extension.
+func storePath(driver, dbPath string) string {
+	if driver == storage.DriverSQLite && dbPath == utils.DefaultBoltDBPath() {
+		return strings.TrimSuffix(dbPath, filepath.Ext(dbPath)) + ".sqlite"
+	}
+	return dbPath
+}
+
+// openStore opens the persistent store and applies the store options that
+// come from configuration. With the SQLite driver the default database file
+// is indexer.sqlite rather than indexer.db.
+func openStore(dbPath string) (*storage.PersistentStore, error) {
+	driver := viper.GetString("dbDriver")
+	ps, err := storage.NewPersistentStore(storePath(driver, dbPath), driver)
+	if err != nil {
+		return nil, err
+	}
+	ps.SetCompressThreshold(viper.GetInt("compressThreshold"))
+	if err := ps.SetIndexedFields(viper.GetStringSlice("indexedFields")); err != nil {
+		ps.Close()
+		return nil, fmt.Errorf("configure indexes: %w", err)
+	}
+	if err := ps.SetExtraSchemas(viper.GetStringMapString("extraSchemas")); err != nil {
+		ps.Close()
+		return nil, fmt.Errorf("configure extra schemas: %w", err)
+	}
+	realm, err := loadRealm()
+	if err != nil {
+		ps.Close()
+		return nil, fmt.Errorf("configure realm: %w", err)
+	}
+	ps.SetRealm(realm)
+	return ps, nil
+}
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
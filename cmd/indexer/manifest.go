@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/manifest"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+func init() {
+	manifestCmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "List, export and verify signed scan manifests",
+		Long: `Every completed 'indexer index' run stores a manifest of the scan: the root,
+file and byte counts, duration, fingerprint strategy, and a Merkle root over
+every file's relative path and fingerprint, signed with this host's Ed25519
+key (see --signing-key).
+
+Export a manifest and hand it, with the public key from 'indexer manifest
+pubkey', to whoever needs to check a copy of the dataset later; 'indexer
+manifest verify' checks the signature and recomputes the Merkle root from a
+directory tree.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List stored manifests, oldest first",
+		Run: func(cmd *cobra.Command, args []string) {
+			root, _ := cmd.Flags().GetString("root")
+			format, _ := cmd.Flags().GetString("format")
+			if root != "" {
+				abs, err := filepath.Abs(root)
+				if err != nil {
+					color.Red("failed to resolve %s: %v", root, err)
+					os.Exit(1)
+				}
+				root = abs
+			}
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			manifests, err := ps.Manifests(root)
+			if err != nil {
+				color.Red("failed to read manifests: %v", err)
+				os.Exit(1)
+			}
+			switch format {
+			case "json":
+				if manifests == nil {
+					manifests = []manifest.Manifest{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(manifests); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+			case "text":
+				fmt.Printf("%-16s  %-20s  %-8s  %-10s  %-12s  %s\n", "ID", "FINISHED", "FILES", "SIZE", "MERKLE ROOT", "ROOT")
+				for _, m := range manifests {
+					fmt.Printf("%-16s  %-20s  %-8d  %-10s  %-12s  %s\n", m.ID, m.Finished.Local().Format(time.DateTime),
+						m.Files, utils.FormatBytes(m.Bytes), shortID(m.MerkleRoot), m.Root)
+				}
+			default:
+				color.Red("unknown manifest format: %s", format)
+				os.Exit(1)
+			}
+		},
+	}
+	listCmd.Flags().String("root", "", "Only list manifests of this scan root")
+	listCmd.Flags().String("format", "text", "Output format: text or json")
+
+	exportCmd := &cobra.Command{
+		Use:   "export <id>",
+		Short: "Write a stored manifest as JSON",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			m, found, err := ps.Manifest(args[0])
+			if err != nil {
+				color.Red("failed to read manifests: %v", err)
+				os.Exit(1)
+			}
+			if !found {
+				color.Red("no manifest with ID %s", args[0])
+				os.Exit(1)
+			}
+			data, err := json.MarshalIndent(m, "", "  ")
+			if err != nil {
+				color.Red("failed to encode manifest: %v", err)
+				os.Exit(1)
+			}
+			data = append(data, '\n')
+			if output == "" {
+				os.Stdout.Write(data)
+				return
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				color.Red("failed to write %s: %v", output, err)
+				os.Exit(1)
+			}
+		},
+	}
+	exportCmd.Flags().StringP("output", "o", "", "Write to this file instead of standard output")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify <manifest.json> [dir]",
+		Short: "Check a manifest's signature and, given a directory, that the tree still matches it",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			pubKey, _ := cmd.Flags().GetString("pubkey")
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				color.Red("failed to read manifest: %v", err)
+				os.Exit(1)
+			}
+			var m manifest.Manifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				color.Red("failed to parse manifest: %v", err)
+				os.Exit(1)
+			}
+			if err := m.Verify(pubKey); err != nil {
+				color.Red("Invalid manifest: %v", err)
+				os.Exit(1)
+			}
+			color.Green("Signature valid: %s scanned %s at %s (key %s)", shortID(m.HostID), m.Root,
+				m.Finished.Local().Format(time.RFC3339), m.PublicKey)
+			if pubKey == "" {
+				color.Yellow("The key was not checked; pass --pubkey to require a known signer")
+			}
+			if len(args) < 2 {
+				return
+			}
+
+			leaves, bytes, failed, err := fileprocessor.FingerprintTree(args[1], m)
+			if err != nil {
+				color.Red("failed to read %s: %v", args[1], err)
+				os.Exit(1)
+			}
+			for _, f := range failed {
+				color.Yellow("unreadable: %s", f)
+			}
+			root := manifest.MerkleRoot(leaves)
+			fmt.Printf("Files: %d (manifest: %d)\n", len(leaves), m.Files)
+			fmt.Printf("Bytes: %d (manifest: %d)\n", bytes, m.Bytes)
+			fmt.Printf("Merkle root: %s\n", root)
+			if root != m.MerkleRoot {
+				color.Red("%s does not match the manifest (Merkle root %s)", args[1], m.MerkleRoot)
+				os.Exit(1)
+			}
+			color.Green("%s matches the manifest", args[1])
+		},
+	}
+	verifyCmd.Flags().String("pubkey", "", "Require the manifest to be signed by this Ed25519 public key (hex)")
+
+	pubkeyCmd := &cobra.Command{
+		Use:   "pubkey",
+		Short: "Print this host's manifest signing public key",
+		Run: func(cmd *cobra.Command, args []string) {
+			key, err := manifest.LoadOrCreateKey(fileprocessor.SigningKeyPath())
+			if err != nil {
+				color.Red("failed to load signing key: %v", err)
+				os.Exit(1)
+			}
+			fmt.Println(hex.EncodeToString(key.Public().(ed25519.PublicKey)))
+		},
+	}
+
+	manifestCmd.AddCommand(listCmd, exportCmd, verifyCmd, pubkeyCmd)
+	rootCmd.AddCommand(manifestCmd)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/vfs"
+)
+
+func init() {
+	mountCmd := &cobra.Command{
+		Use:   "mount <mountpoint>",
+		Short: "Browse the replicated index as a read-only filesystem",
+		Long: `Mounts the index of every host in this store at <mountpoint> with FUSE,
+as <mountpoint>/<host ID>/<path>. Each file shows the size and modification
+time of its current record, and carries the rest of the record as extended
+attributes (user.dreamfs.id, .host, .path, .blake3 and .extra.<field>, e.g.
+'getfattr -d -m user.dreamfs <file>'). Deleted files are not shown.
+
+Only metadata is available for other hosts' files; opening them fails with
+EREMOTE. With --passthrough, this host's files read through to the local
+copy, as long as its size and modification time still match the record.
+
+The mount holds the store open, so other commands cannot write to it in the
+meantime; with --swarm, records broadcast by peers are merged as they arrive
+and the tree picks them up within --refresh. Stop with Ctrl-C, which
+unmounts.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			passthrough, _ := cmd.Flags().GetBool("passthrough")
+			refresh, _ := cmd.Flags().GetDuration("refresh")
+			allowOther, _ := cmd.Flags().GetBool("allow-other")
+			debug, _ := cmd.Flags().GetBool("debug-fuse")
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			if viper.GetBool("swarm") {
+				ml, _, err := network.StartSwarm(ps)
+				if err != nil {
+					color.Red("failed to start swarm: %v", err)
+					os.Exit(1)
+				}
+				defer ml.Shutdown()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				cancel()
+			}()
+
+			color.Blue("Mounting the index at %s (Ctrl-C to unmount)", args[0])
+			opts := vfs.Options{Passthrough: passthrough, Refresh: refresh, AllowOther: allowOther, Debug: debug}
+			if err := vfs.Serve(ctx, args[0], ps, opts); err != nil {
+				color.Red("mount %s: %v", args[0], err)
+				os.Exit(1)
+			}
+			color.Green("Unmounted %s", args[0])
+		},
+	}
+	mountCmd.Flags().Bool("passthrough", false, "Serve reads of this host's files from their local copies")
+	mountCmd.Flags().Duration("refresh", vfs.DefaultRefresh, "How often to pick up changes to the store")
+	mountCmd.Flags().Bool("allow-other", false, "Let other users access the mount (needs user_allow_other in /etc/fuse.conf)")
+	mountCmd.Flags().Bool("debug-fuse", false, "Log every FUSE request")
+	rootCmd.AddCommand(mountCmd)
+}
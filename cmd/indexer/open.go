@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// uriScheme prefixes content links: dreamfs://<blake3 fingerprint>.
+const uriScheme = "dreamfs://"
+
+func init() {
+	openCmd := &cobra.Command{
+		Use:   "open <dreamfs://fingerprint>",
+		Short: "Open the content a dreamfs:// link points to",
+		Long: `Resolves a dreamfs://<fingerprint> link (a BLAKE3 fingerprint as shown by
+'indexer dump' or 'indexer dedupe') through the replicated index and opens a
+copy of the content with the default application.
+
+A local copy is used if this host has one. Otherwise the content is fetched
+into the cache directory from the first peer that serves it (--peers, or the
+"upstreams" config value; peers must run 'indexer serve --serve-blobs') and
+checked against the fingerprint before it is opened.
+
+With --register, 'indexer open' is installed as the desktop's handler for
+dreamfs:// links, so they can be followed from notes and wikis.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			register, _ := cmd.Flags().GetBool("register")
+			printOnly, _ := cmd.Flags().GetBool("print")
+			peers, _ := cmd.Flags().GetStringSlice("peers")
+			if len(peers) == 0 {
+				peers = viper.GetStringSlice("upstreams")
+			}
+
+			if register {
+				exe, err := os.Executable()
+				if err != nil {
+					color.Red("failed to locate the indexer executable: %v", err)
+					os.Exit(1)
+				}
+				if err := registerURIHandler(exe); err != nil {
+					color.Red("failed to register the dreamfs:// handler: %v", err)
+					os.Exit(1)
+				}
+				color.Green("Registered %s as the handler for dreamfs:// links", exe)
+				return
+			}
+			if len(args) == 0 {
+				color.Red("no link given (expected dreamfs://<fingerprint>)")
+				os.Exit(1)
+			}
+			fingerprint, err := parseContentURI(args[0])
+			if err != nil {
+				color.Red("%v", err)
+				os.Exit(1)
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			located, err := network.Locate(ps, fingerprint)
+			ps.Close() // Not needed while fetching or opening
+			if err != nil {
+				color.Red("failed to locate content: %v", err)
+				os.Exit(1)
+			}
+			if len(located) == 0 {
+				color.Red("no indexed file holds %s", fingerprint)
+				os.Exit(1)
+			}
+
+			path := network.LocalCopy(located)
+			if path == "" {
+				path, err = fetchContent(located[0], peers)
+				if err != nil {
+					color.Red("%v", err)
+					fmt.Println("Indexed copies:")
+					for _, meta := range located {
+						fmt.Printf("  %s  %s\n", shortHost(meta.HostID), meta.FilePath)
+					}
+					os.Exit(1)
+				}
+			}
+			if printOnly {
+				fmt.Println(path)
+				return
+			}
+			if err := openWithDefaultApp(path); err != nil {
+				color.Red("failed to open %s: %v", path, err)
+				os.Exit(1)
+			}
+		},
+	}
+	openCmd.Flags().StringSlice("peers", nil, "Indexers to fetch remote content from (e.g. http://nas:8080; default: \"upstreams\" config)")
+	openCmd.Flags().Bool("print", false, "Print the path of the resolved copy instead of opening it")
+	openCmd.Flags().Bool("register", false, "Register this executable as the handler for dreamfs:// links")
+	rootCmd.AddCommand(openCmd)
+}
+
+// parseContentURI extracts the fingerprint from dreamfs://<fingerprint>,
+// ignoring any trailing path (e.g. a file name added for readability).
+func parseContentURI(uri string) (string, error) {
+	rest, ok := strings.CutPrefix(uri, uriScheme)
+	if !ok {
+		return "", fmt.Errorf("not a dreamfs:// link: %s", uri)
+	}
+	fingerprint, _, _ := strings.Cut(rest, "/")
+	if !hashPattern.MatchString(fingerprint) {
+		return "", fmt.Errorf("invalid fingerprint in %s (expected 64 hex digits)", uri)
+	}
+	return strings.ToLower(fingerprint), nil
+}
+
+// fetchContent downloads the content of meta from the first peer that has
+// it into the cache (reusing an earlier download), verifying it against the
+// fingerprint. The original extension is kept so the right application
+// opens it.
+func fetchContent(meta metadata.FileMetadata, peers []string) (string, error) {
+	dest := filepath.Join(utils.XDGCacheHome(), "indexer", "blobs", meta.BLAKE3+filepath.Ext(meta.FilePath))
+	verify := func(path string) (bool, error) { return fileprocessor.MatchesRecord(path, meta) }
+	if ok, err := verify(dest); err == nil && ok {
+		return dest, nil
+	}
+	if len(peers) == 0 {
+		return "", errors.New("no local copy, and no peers to fetch from (pass --peers or set \"upstreams\" in config)")
+	}
+	for _, peer := range peers {
+		err := network.FetchBlob(peer, meta.BLAKE3, dest, verify)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			color.Yellow("fetch from %s: %v", peer, err)
+			continue
+		}
+		return dest, nil
+	}
+	return "", errors.New("no local copy, and no peer served the content")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+)
+
+func init() {
+	peersCmd := &cobra.Command{
+		Use:   "peers [url]",
+		Short: "Show the swarm members of a running node and whether the swarm is converged",
+		Long: `Fetches the cluster view (/cluster) of the node serving at url (default:
+the one 'indexer serve' runs here with --addr) and lists its swarm members
+and the peers it has known: their health, when they were last seen, the
+records each held at its last digest exchange and whether that matched,
+and how long since their records were last merged.
+
+The swarm is converged when every member is alive and in sync with the
+node. Exits 1 if it is not.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			if format != "text" && format != "json" {
+				color.Red("unknown peers format: %s", format)
+				os.Exit(1)
+			}
+			url := network.DefaultSyncURL(viper.GetString("addr"))
+			if len(args) == 1 {
+				url = args[0]
+			}
+			st, err := network.FetchClusterStatus(url)
+			if err != nil {
+				color.Red("failed to fetch cluster status: %v", err)
+				os.Exit(1)
+			}
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(st); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+			} else {
+				printPeers(st)
+			}
+			if st.Converged != nil && !*st.Converged {
+				os.Exit(1)
+			}
+		},
+	}
+	peersCmd.Flags().String("format", "text", "Output format: text or json")
+	rootCmd.AddCommand(peersCmd)
+}
+
+func printPeers(st network.ClusterStatus) {
+	color.Cyan("Host %.12s: %d records", st.HostID, st.Records)
+	if st.Converged == nil {
+		fmt.Println("Not running in a swarm")
+		return
+	}
+	fmt.Printf("%-32s  %-22s  %-11s  %-12s  %-9s  %-7s  %-10s  %s\n", "NODE", "ADDRESS", "STATE", "HOST", "RECORDS", "IN SYNC", "LAST SEEN", "LAG")
+	inSync := 0
+	for _, m := range st.Members {
+		name := m.Name
+		if m.Self {
+			name += " (self)"
+		}
+		state := m.State
+		switch state {
+		case network.MemberAlive:
+			state = color.GreenString("%-11s", state)
+		case network.MemberSuspect:
+			state = color.YellowString("%-11s", state)
+		default:
+			state = color.RedString("%-11s", state)
+		}
+		records, sync := "-", "-"
+		if m.Records != nil {
+			records = fmt.Sprint(*m.Records)
+			sync = "no"
+			if m.InSync {
+				sync = "yes"
+				inSync++
+			}
+		}
+		seen := "never"
+		if !m.LastSeen.IsZero() {
+			seen = time.Since(m.LastSeen).Truncate(time.Second).String() + " ago"
+			if m.State == network.MemberAlive {
+				seen = "now"
+			}
+		}
+		lag := "-"
+		if m.Lag > 0 {
+			lag = (time.Duration(m.Lag) * time.Second).String()
+			if m.Lagging {
+				lag = color.RedString(lag)
+			}
+		}
+		fmt.Printf("%-32s  %-22s  %s  %-12.12s  %-9s  %-7s  %-10s  %s\n", name, m.Addr, state, m.HostID, records, sync, seen, lag)
+	}
+	if *st.Converged {
+		color.Green("Swarm converged")
+	} else {
+		color.Red("Swarm not converged (%d of %d nodes in sync)", inSync, len(st.Members))
+	}
+}
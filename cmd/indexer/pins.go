@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+func init() {
+	pinsCmd := &cobra.Command{
+		Use:   "pins [policy...]",
+		Short: "Report swarm compliance with content pinning policies",
+		Long: `Checks that content covered by a pinning policy has at least the required
+number of copies across the hosts in the replicated store, and plans copies
+of under-replicated content onto hosts that lack it.
+
+A policy is "archive=3" (content tagged archive, at least 3 hosts) or
+"field:value=N" for any other metadata field. Policies default to the "pins"
+config value, a list of {"field", "value", "copies"} objects.
+
+Copies are counted by BLAKE3 fingerprint; index with --hash-mode=full for exact
+content identity, and use the same hash mode on every host so that copies
+count.
+
+This command reports, from the local store, and plans copies between all
+indexed hosts. The copies are made by 'indexer serve --swarm' with "pins"
+set: every maintenance interval the swarm leader plans copies between live
+members only and sends each task to its target, which fetches the blob from
+the source's /blob endpoint (the source must run with --serve-blobs) into
+its --pin-dir, checks it against the fingerprint and indexes it. Tasks are
+sent again until the new copies have replicated.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			interval, _ := cmd.Flags().GetDuration("interval")
+			if format != "text" && format != "json" {
+				color.Red("unknown pins format: %s", format)
+				os.Exit(1)
+			}
+
+			var policies []network.PinPolicy
+			for _, arg := range args {
+				p, err := network.ParsePinPolicy(arg)
+				if err != nil {
+					color.Red("%v", err)
+					os.Exit(1)
+				}
+				policies = append(policies, p)
+			}
+			if len(policies) == 0 {
+				if err := viper.UnmarshalKey("pins", &policies); err != nil {
+					color.Red("invalid \"pins\" config: %v", err)
+					os.Exit(1)
+				}
+			}
+			if len(policies) == 0 {
+				color.Red("no pinning policies given (pass e.g. archive=3 or set \"pins\" in config)")
+				os.Exit(1)
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				cancel()
+			}()
+
+			// Reconcile once, or every --interval as the store is replicated
+			for {
+				latest, err := ps.Latest()
+				if err != nil {
+					color.Red("failed to read metadata: %v", err)
+					os.Exit(1)
+				}
+				reports := network.CheckPins(latest, policies, nil)
+				if format == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					if err := enc.Encode(reports); err != nil {
+						color.Red("failed to encode JSON: %v", err)
+						os.Exit(1)
+					}
+				} else {
+					printPinReports(reports)
+				}
+				if interval <= 0 {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(interval):
+				}
+			}
+		},
+	}
+	pinsCmd.Flags().String("format", "text", "Output format: text or json")
+	pinsCmd.Flags().Duration("interval", 0, "Re-check at this interval (0 checks once)")
+	rootCmd.AddCommand(pinsCmd)
+}
+
+func printPinReports(reports []network.PinReport) {
+	for _, r := range reports {
+		status := color.GreenString("compliant")
+		if len(r.UnderReplicated) > 0 {
+			status = color.RedString("%d under-replicated", len(r.UnderReplicated))
+		}
+		color.Cyan("Policy %s: %d/%d contents compliant, %s", r.Policy, r.Compliant, r.Pinned, status)
+		if r.Unsatisfiable > 0 {
+			color.Yellow("  %d contents need more copies than there are known hosts", r.Unsatisfiable)
+		}
+		for _, c := range r.UnderReplicated {
+			fmt.Printf("  %-16s  %10s  %d/%d  %s\n", c.BLAKE3[:min(16, len(c.BLAKE3))], utils.FormatBytes(c.Size), len(c.Hosts), r.Policy.Copies, c.Path)
+		}
+		if len(r.Tasks) > 0 {
+			var bytes int64
+			for _, t := range r.Tasks {
+				bytes += t.Size
+			}
+			color.Cyan("  Planned copies (%d, %s):", len(r.Tasks), utils.FormatBytes(bytes))
+			for _, t := range r.Tasks {
+				fmt.Printf("    %s -> %s  %s\n", shortHost(t.SourceHost), shortHost(t.TargetHost), t.SourcePath)
+			}
+		}
+	}
+}
+
+// shortHost abbreviates the 64-character host IDs for tables.
+func shortHost(id string) string {
+	return id[:min(12, len(id))]
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+)
+
+// priorityRequest is the body of a POST to /_priority.
+type priorityRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// serveControl serves the watch daemon's control endpoint: POST /_priority
+// boosts paths to the front of q, GET /_priority lists those still queued.
+func serveControl(addr string, q *fileprocessor.PriorityQueue) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_priority", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(priorityRequest{Paths: q.Pending()})
+		case http.MethodPost:
+			var req priorityRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, path := range req.Paths {
+				if !filepath.IsAbs(path) {
+					http.Error(w, fmt.Sprintf("path %q is not absolute", path), http.StatusBadRequest)
+					return
+				}
+			}
+			q.Boost(req.Paths...)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(priorityRequest{Paths: q.Pending()})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		color.Red("control server error: %v", err)
+	}
+}
+
+func init() {
+	touchPriorityCmd := &cobra.Command{
+		Use:   "touch-priority <path>...",
+		Short: "Verify files or directories ahead of everything else a running watch is doing",
+		Long: `Asks the 'indexer watch' daemon listening on --control-addr to re-verify
+the given files or directory trees next, ahead of its initial scan and of
+pending change events, e.g. right after restoring a directory from backup.
+Every file beneath a boosted path is re-fingerprinted whether or not it looks
+unchanged; files that differ from the index get a new revision and missing
+ones are tombstoned. The most recently boosted path is verified first.
+
+With no paths, lists the paths still queued.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			url := "http://" + viper.GetString("controlAddr") + "/_priority"
+			var resp *http.Response
+			var err error
+			if len(args) == 0 {
+				resp, err = http.Get(url)
+			} else {
+				req := priorityRequest{}
+				for _, arg := range args {
+					abs, err := filepath.Abs(arg)
+					if err != nil {
+						color.Red("invalid path %s: %v", arg, err)
+						os.Exit(1)
+					}
+					req.Paths = append(req.Paths, abs)
+				}
+				body, _ := json.Marshal(req)
+				resp, err = http.Post(url, "application/json", bytes.NewReader(body))
+			}
+			if err != nil {
+				color.Red("failed to reach the watch daemon: %v", err)
+				os.Exit(1)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+				msg := new(bytes.Buffer)
+				msg.ReadFrom(resp.Body)
+				color.Red("%s: %s %s", url, resp.Status, bytes.TrimSpace(msg.Bytes()))
+				os.Exit(1)
+			}
+			var queued priorityRequest
+			if err := json.NewDecoder(resp.Body).Decode(&queued); err != nil {
+				color.Red("failed to read reply: %v", err)
+				os.Exit(1)
+			}
+			if len(args) > 0 {
+				color.Green("Boosted %d path(s); %d queued for verification", len(args), len(queued.Paths))
+			}
+			for _, path := range queued.Paths {
+				fmt.Println(path)
+			}
+		},
+	}
+	rootCmd.AddCommand(touchPriorityCmd)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// pruneBroadcastTimeout bounds how long 'prune --swarm' waits for the
+// tombstones to be gossiped before exiting.
+const pruneBroadcastTimeout = 30 * time.Second
+
+func init() {
+	pruneCmd := &cobra.Command{
+		Use:   "prune [directory...]",
+		Short: "Record the deletion of indexed files that no longer exist",
+		Long: `Checks this host's indexed files (optionally only those under the given
+directories) and writes a tombstone for each one that no longer exists, so
+reports stop listing it. With --swarm the tombstones are broadcast to the
+swarm as 'indexer watch' does; otherwise peers receive them the next time
+they sync with this host. Either way, peers that receive one ignore older
+revisions of the file from then on.
+
+With --purge the earlier revisions of pruned files are also removed from
+this store right away; otherwise they are kept for 'indexer timeline' until
+the swarm leader's tombstone GC drops them (see 'indexer serve').
+
+Files on network mounts are recorded under their server path and cannot be
+checked from here; they are skipped, as are streams (see 'indexer
+hash-stream'), files on volumes that are not mounted now (see 'indexer
+volumes list') and quarantined files, whose deletion is recorded when they
+are purged (see 'indexer quarantine').`,
+		Run: func(cmd *cobra.Command, args []string) {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			purge, _ := cmd.Flags().GetBool("purge")
+
+			var roots []string
+			for _, arg := range args {
+				abs, err := filepath.Abs(arg)
+				if err != nil {
+					color.Red("failed to resolve %s: %v", arg, err)
+					os.Exit(1)
+				}
+				if canonical, err := fileprocessor.CanonicalizePath(abs); err == nil {
+					abs = canonical
+				}
+				roots = append(roots, abs)
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			latest, err := ps.Latest()
+			if err != nil {
+				color.Red("failed to read metadata: %v", err)
+				os.Exit(1)
+			}
+			// Quarantined files are gone from their place but may yet be
+			// restored; their deletion is recorded when they are purged
+			entries, err := ps.Quarantined()
+			if err != nil {
+				color.Red("failed to read quarantine: %v", err)
+				os.Exit(1)
+			}
+			quarantined := make(map[string]bool, len(entries))
+			for _, e := range entries {
+				path := e.Path
+				if canonical, err := fileprocessor.CanonicalizePath(path); err == nil {
+					path = canonical
+				}
+				quarantined[path] = true
+			}
+			offline, err := fileprocessor.OfflineVolumes(ps)
+			if err != nil {
+				color.Red("failed to read volumes: %v", err)
+				os.Exit(1)
+			}
+
+			var missing []string
+			skipped, detached, held := 0, 0, 0
+			for _, meta := range latest {
+				if meta.HostID != utils.HostID || !underAny(meta.FilePath, roots) {
+					continue
+				}
+				if fileprocessor.IsStreamPath(meta.FilePath) {
+					continue
+				}
+				if !filepath.IsAbs(meta.FilePath) {
+					skipped++
+					continue
+				}
+				if _, ok := fileprocessor.OfflineVolume(&meta, offline); ok {
+					detached++
+					continue
+				}
+				if quarantined[meta.FilePath] {
+					held++
+					continue
+				}
+				if _, err := os.Lstat(meta.FilePath); errors.Is(err, fs.ErrNotExist) {
+					missing = append(missing, meta.FilePath)
+				}
+			}
+			sort.Strings(missing)
+
+			for _, path := range missing {
+				fmt.Println("  " + path)
+			}
+			if skipped > 0 {
+				color.Yellow("Skipped %d files on network mounts", skipped)
+			}
+			if detached > 0 {
+				color.Yellow("Skipped %d files on offline volumes (see 'indexer volumes list')", detached)
+			}
+			if held > 0 {
+				color.Yellow("Skipped %d quarantined files (see 'indexer quarantine list')", held)
+			}
+			if dryRun || len(missing) == 0 {
+				color.Cyan("%d indexed files no longer exist", len(missing))
+				return
+			}
+
+			now := time.Now()
+			dead := make(map[string]bool, len(missing))
+			tombstones := make([]metadata.FileMetadata, 0, len(missing))
+			for _, path := range missing {
+				tombstone := metadata.NewTombstone(utils.HostID, path, now)
+				if err := ps.Put(tombstone); err != nil {
+					color.Red("failed to record deletion of %s: %v", path, err)
+					os.Exit(1)
+				}
+				dead[path] = true
+				tombstones = append(tombstones, tombstone)
+			}
+			removed := 0
+			if purge {
+				var ids []string
+				err := ps.ForEach(func(meta metadata.FileMetadata) error {
+					if meta.HostID == utils.HostID && dead[meta.FilePath] && !meta.Deleted() {
+						ids = append(ids, meta.ID)
+					}
+					return nil
+				})
+				if err != nil {
+					color.Red("failed to read metadata: %v", err)
+					os.Exit(1)
+				}
+				for _, id := range ids {
+					if err := ps.Delete(id); err != nil {
+						color.Red("failed to delete record %s: %v", id, err)
+						os.Exit(1)
+					}
+				}
+				removed = len(ids)
+			}
+			color.Green("Pruned %d files (%d earlier revisions removed)", len(missing), removed)
+
+			if !viper.GetBool("swarm") {
+				return
+			}
+			ml, d, err := network.StartSwarm(ps)
+			if err != nil {
+				color.Red("failed to start swarm: %v", err)
+				os.Exit(1)
+			}
+			defer ml.Shutdown()
+			if ml.NumMembers() <= 1 {
+				color.Yellow("No swarm peers found; they will receive the tombstones through replication")
+				return
+			}
+			for _, tombstone := range tombstones {
+				if err := d.QueueMetadata(tombstone); err != nil {
+					color.Red("failed to broadcast the deletion of %s: %v", tombstone.FilePath, err)
+				}
+			}
+			d.FlushBroadcasts()
+			deadline := time.Now().Add(pruneBroadcastTimeout)
+			for d.Broadcasts.NumQueued() > 0 && time.Now().Before(deadline) {
+				time.Sleep(100 * time.Millisecond)
+			}
+			if n := d.Broadcasts.NumQueued(); n > 0 {
+				color.Yellow("%d tombstones were not broadcast in time; peers will receive them through replication", n)
+			} else {
+				fmt.Println("Broadcast the tombstones to the swarm")
+			}
+		},
+	}
+	pruneCmd.Flags().Bool("dry-run", false, "Only list the files that no longer exist")
+	pruneCmd.Flags().Bool("purge", false, "Also remove the earlier revisions of pruned files from this store")
+	rootCmd.AddCommand(pruneCmd)
+}
+
+// underAny reports whether path is one of roots or lies beneath one; with
+// no roots every path matches.
+func underAny(path string, roots []string) bool {
+	if len(roots) == 0 {
+		return true
+	}
+	sep := string(filepath.Separator)
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, sep)+sep) {
+			return true
+		}
+	}
+	return false
+}
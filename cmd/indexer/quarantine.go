@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/quarantine"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+func init() {
+	quarantineCmd := &cobra.Command{
+		Use:   "quarantine",
+		Short: "Soft-delete files for a grace period before removing them",
+		Long: `Files deleted by the index's remediation actions (the 'indexer dedupe
+--script delete' script) are moved into a quarantine directory (see
+--quarantine-dir) instead of being removed, and tracked in the database with
+an expiry. Until then they can be put back with 'indexer quarantine restore';
+'indexer quarantine purge' deletes the expired ones for good, e.g. from cron.
+
+A quarantined file keeps its record, so the index still lists it and
+restoring it needs no rescan; the purge records its deletion. 'indexer
+prune' leaves quarantined files alone.`,
+	}
+
+	addCmd := &cobra.Command{
+		Use:   "add <file>...",
+		Short: "Move files into quarantine",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			reason, _ := cmd.Flags().GetString("reason")
+			ttl, _ := cmd.Flags().GetDuration("ttl")
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			failed := false
+			for _, path := range args {
+				e, err := quarantine.Move(quarantineDir(), path, ttl)
+				if err != nil {
+					color.Red("failed to quarantine %s: %v", path, err)
+					failed = true
+					continue
+				}
+				e.HostID = utils.HostID
+				e.Reason = reason
+				if err := ps.AddQuarantine(e); err != nil {
+					// Untracked, the file could only be found by hand, so put it back
+					color.Red("failed to record quarantine of %s: %v", e.Path, err)
+					if err := quarantine.Restore(e); err != nil {
+						color.Red("failed to move %s back from %s: %v", e.Path, e.StoredPath, err)
+					}
+					failed = true
+					continue
+				}
+				fmt.Printf("Quarantined %s as %s until %s\n", e.Path, e.ID, e.Expires.Local().Format(time.DateTime))
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	addCmd.Flags().String("reason", "", "Note recorded with the entry (e.g. dedupe)")
+	addCmd.Flags().Duration("ttl", quarantine.DefaultTTL, "How long to keep the files before they may be purged")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List quarantined files, oldest first",
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			expiredOnly, _ := cmd.Flags().GetBool("expired")
+			if format != "text" && format != "json" {
+				color.Red("unknown quarantine format: %s", format)
+				os.Exit(1)
+			}
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			entries, err := ps.Quarantined()
+			if err != nil {
+				color.Red("failed to read quarantine: %v", err)
+				os.Exit(1)
+			}
+			now := time.Now()
+			listed := []quarantine.Entry{}
+			for _, e := range entries {
+				if !expiredOnly || e.Expired(now) {
+					listed = append(listed, e)
+				}
+			}
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(listed); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			fmt.Printf("%-16s  %-20s  %-10s  %-10s  %s\n", "ID", "EXPIRES", "SIZE", "REASON", "PATH")
+			for _, e := range listed {
+				expires := e.Expires.Local().Format(time.DateTime)
+				if e.Expired(now) {
+					expires = "expired"
+				}
+				fmt.Printf("%-16s  %-20s  %-10s  %-10s  %s\n", e.ID, expires, utils.FormatBytes(e.Size), e.Reason, e.Path)
+			}
+		},
+	}
+	listCmd.Flags().String("format", "text", "Output format: text or json")
+	listCmd.Flags().Bool("expired", false, "Only list files whose grace period is over")
+
+	restoreCmd := &cobra.Command{
+		Use:   "restore <id>...",
+		Short: "Move quarantined files back to where they were",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			failed := false
+			for _, id := range args {
+				e, found, err := ps.QuarantineEntry(id)
+				if err == nil && !found {
+					err = fmt.Errorf("no quarantined file with ID %s", id)
+				}
+				if err == nil {
+					err = quarantine.Restore(e)
+				}
+				if err == nil {
+					err = ps.RemoveQuarantine(e.ID)
+				}
+				if err != nil {
+					color.Red("failed to restore %s: %v", id, err)
+					failed = true
+					continue
+				}
+				fmt.Printf("Restored %s\n", e.Path)
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	purgeCmd := &cobra.Command{
+		Use:   "purge [id...]",
+		Short: "Delete quarantined files for good: the expired ones, or those given",
+		Run: func(cmd *cobra.Command, args []string) {
+			all, _ := cmd.Flags().GetBool("all")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			var entries []quarantine.Entry
+			if len(args) > 0 {
+				for _, id := range args {
+					e, found, err := ps.QuarantineEntry(id)
+					if err != nil {
+						color.Red("%v", err)
+						os.Exit(1)
+					}
+					if !found {
+						color.Red("no quarantined file with ID %s", id)
+						os.Exit(1)
+					}
+					entries = append(entries, e)
+				}
+			} else {
+				quarantined, err := ps.Quarantined()
+				if err != nil {
+					color.Red("failed to read quarantine: %v", err)
+					os.Exit(1)
+				}
+				now := time.Now()
+				for _, e := range quarantined {
+					if all || e.Expired(now) {
+						entries = append(entries, e)
+					}
+				}
+			}
+
+			var freed int64
+			for _, e := range entries {
+				if dryRun {
+					fmt.Printf("  %s  %s\n", e.ID, e.Path)
+					freed += e.Size
+					continue
+				}
+				if err := purgeQuarantined(ps, e); err != nil {
+					color.Red("failed to purge %s (%s): %v", e.ID, e.Path, err)
+					os.Exit(1)
+				}
+				freed += e.Size
+			}
+			if dryRun {
+				color.Cyan("%d quarantined files (%s) would be purged", len(entries), utils.FormatBytes(freed))
+				return
+			}
+			color.Green("Purged %d quarantined files (%s)", len(entries), utils.FormatBytes(freed))
+		},
+	}
+	purgeCmd.Flags().Bool("all", false, "Purge every quarantined file, expired or not")
+	purgeCmd.Flags().Bool("dry-run", false, "Only list the files that would be purged")
+
+	quarantineCmd.AddCommand(addCmd, listCmd, restoreCmd, purgeCmd)
+	rootCmd.AddCommand(quarantineCmd)
+}
+
+// quarantineDir returns the directory quarantined files are moved into
+// ("quarantineDir", by default in the XDG data directory).
+func quarantineDir() string {
+	if dir := viper.GetString("quarantineDir"); dir != "" {
+		return dir
+	}
+	return quarantine.DefaultDir(utils.XDGDataHome())
+}
+
+// purgeQuarantined deletes a quarantined file and, unless something has
+// taken its place, records the deletion of its indexed file with a
+// tombstone.
+func purgeQuarantined(ps *storage.PersistentStore, e quarantine.Entry) error {
+	if err := quarantine.Remove(e); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(e.Path); errors.Is(err, fs.ErrNotExist) {
+		path := e.Path
+		if canonical, err := fileprocessor.CanonicalizePath(path); err == nil {
+			path = canonical
+		}
+		meta, found, err := ps.LatestFor(e.HostID, path)
+		if err != nil {
+			return err
+		}
+		if found && !meta.Deleted() {
+			if err := ps.Put(metadata.NewTombstone(e.HostID, path, time.Now())); err != nil {
+				return err
+			}
+		}
+	}
+	return ps.RemoveQuarantine(e.ID)
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/query"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// errQueryLimit stops the store scan once --limit matches were written.
+var errQueryLimit = errors.New("query limit reached")
+
+func init() {
+	queryCmd := &cobra.Command{
+		Use:   "query [expression]",
+		Short: "Stream the records matching a filter expression",
+		Long: `Evaluates a filter expression against every stored record and streams the
+matches as JSON or TSV, without loading the whole store into memory.
+
+  indexer query 'size > 100MB AND path ~ "*.mp4" AND modTime > 2024-01-01'
+
+Comparisons are "field op value" with = != < <= > >= ~ (glob) !~, combined
+with AND, OR, NOT and parentheses. Fields are record JSON names (filePath,
+hostID, size, modTime, blake3, _id or any extra field) or the aliases path,
+host, mtime, hash and id. Sizes take units (100MB, 1.5GiB); dates are
+YYYY-MM-DD or RFC 3339. In globs "*" also matches "/".
+
+With --peers (or --federated, which queries the "upstreams" config value)
+the expression is also run on each peer's /_query endpoint and the matches
+are merged. Where peers disagree on the newest revision of a file, the
+newest is written back to the stale stores (read repair) unless
+--read-repair=false or "readRepair": false is configured; divergences are
+reported on stderr.
+
+With --interactive the expression is built from a form (host, kinds,
+extensions, sizes, age and tags) that shows how many records match as it is
+filled in. The result can be printed, saved as a named query to run again
+with --saved, or saved as a named collection: the records matching now,
+listed again with --collection.
+
+Records of this host's files on a volume that is not mounted now, such as a
+detached external drive (see 'indexer volumes list'), are still matched and
+are flagged with "offline": true and the volume's label (or ID) in
+"offlineVolume", also matched by expressions. --offline lists only those,
+which tells which drive holds a file while none is plugged in:
+
+  indexer query --offline 'path ~ "*/holiday.mp4"'`,
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			limit, _ := cmd.Flags().GetInt("limit")
+			interactive, _ := cmd.Flags().GetBool("interactive")
+			saved, _ := cmd.Flags().GetString("saved")
+			collection, _ := cmd.Flags().GetString("collection")
+			onlyOffline, _ := cmd.Flags().GetBool("offline")
+			if format != "json" && format != "tsv" {
+				color.Red("unknown query format: %s", format)
+				os.Exit(1)
+			}
+			sources := 0
+			for _, given := range []bool{len(args) > 0, interactive, saved != "", collection != ""} {
+				if given {
+					sources++
+				}
+			}
+			if sources > 1 || sources == 0 && !onlyOffline {
+				color.Red("pass one of an expression, --interactive, --saved or --collection")
+				os.Exit(1)
+			}
+			peers, _ := cmd.Flags().GetStringSlice("peers")
+			if federated, _ := cmd.Flags().GetBool("federated"); federated && len(peers) == 0 {
+				peers = viper.GetStringSlice("upstreams")
+				if len(peers) == 0 {
+					color.Red("no peers to federate (pass --peers or set \"upstreams\" in config)")
+					os.Exit(1)
+				}
+			}
+			if collection != "" && len(peers) > 0 {
+				color.Red("--collection lists local records; drop --peers and --federated")
+				os.Exit(1)
+			}
+			if onlyOffline && len(peers) > 0 {
+				color.Red("--offline lists this host's volumes; drop --peers and --federated")
+				os.Exit(1)
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+			vols, err := fileprocessor.OfflineVolumes(ps)
+			if err != nil {
+				color.Red("failed to read volumes: %v", err)
+				os.Exit(1)
+			}
+			offline := offlineFilter{vols: vols, only: onlyOffline}
+
+			exprText := strings.Join(args, " ")
+			switch {
+			case collection != "":
+				writeCollection(ps, collection, format, limit, offline)
+				return
+			case saved != "":
+				q, found, err := ps.SavedQuery(saved)
+				if err != nil {
+					color.Red("failed to read saved query %s: %v", saved, err)
+					os.Exit(1)
+				}
+				if !found {
+					color.Red("no saved query named %s", saved)
+					if queries, err := ps.SavedQueries(); err == nil && len(queries) > 0 {
+						color.Yellow("Saved queries:")
+						for _, q := range queries {
+							color.Yellow("  %s: %s", q.Name, q.Expression)
+						}
+					}
+					os.Exit(1)
+				}
+				exprText = q.Expression
+			case interactive:
+				if exprText = runQueryBuilder(ps); exprText == "" {
+					return
+				}
+			}
+			var expr query.Expr
+			if exprText != "" {
+				if expr, err = query.Parse(exprText); err != nil {
+					color.Red("invalid query: %v", err)
+					os.Exit(1)
+				}
+			}
+
+			out := bufio.NewWriter(os.Stdout)
+			defer out.Flush()
+			w := newQueryWriter(out, format)
+
+			if len(peers) > 0 {
+				result, err := network.FederatedQuery(ps, exprText, peers, limit, viper.GetBool("readRepair"))
+				if err != nil {
+					color.Red("query failed: %v", err)
+					os.Exit(1)
+				}
+				for _, meta := range result.Docs {
+					if !offline.keep(&meta) {
+						continue
+					}
+					if err := w.Write(meta); err != nil {
+						color.Red("failed to write results: %v", err)
+						os.Exit(1)
+					}
+				}
+				if err := w.Close(); err != nil {
+					color.Red("failed to write results: %v", err)
+					os.Exit(1)
+				}
+				out.Flush()
+				printFederationReport(result)
+				return
+			}
+
+			n := 0
+			err = ps.ForEach(func(meta metadata.FileMetadata) error {
+				if !offline.keep(&meta) || expr != nil && !expr.Match(&meta) {
+					return nil
+				}
+				if err := w.Write(meta); err != nil {
+					return err
+				}
+				if n++; limit > 0 && n >= limit {
+					return errQueryLimit
+				}
+				return nil
+			})
+			if err != nil && err != errQueryLimit {
+				out.Flush()
+				color.Red("query failed: %v", err)
+				os.Exit(1)
+			}
+			if err := w.Close(); err != nil {
+				color.Red("failed to write results: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	queryCmd.Flags().String("format", "json", "Output format: json or tsv")
+	queryCmd.Flags().Int("limit", 0, "Stop after this many matches (0 for no limit)")
+	queryCmd.Flags().StringSlice("peers", nil, "Also query these indexers (e.g. http://nas:8080) and merge the results")
+	queryCmd.Flags().Bool("federated", false, "Query the \"upstreams\" peers as well as the local store")
+	queryCmd.Flags().Bool("interactive", false, "Build the expression with a form, and optionally save it")
+	queryCmd.Flags().String("saved", "", "Run the query saved under this name")
+	queryCmd.Flags().String("collection", "", "List the records of the collection saved under this name")
+	queryCmd.Flags().Bool("offline", false, "Only match files on volumes that are not mounted now")
+	queryCmd.Flags().Bool("read-repair", true, "Send the newest revision to stores that returned an older one")
+	viper.BindPFlag("readRepair", queryCmd.Flags().Lookup("read-repair"))
+	rootCmd.AddCommand(queryCmd)
+}
+
+// runQueryBuilder builds an expression with the interactive form and
+// carries out its action. It returns the expression to print the matches
+// of, or "" when there is nothing more to do.
+func runQueryBuilder(ps *storage.PersistentStore) string {
+	records, err := ps.GetAll()
+	if err != nil {
+		color.Red("failed to read records: %v", err)
+		os.Exit(1)
+	}
+	exprText, action, name, err := buildQuery(records)
+	if err != nil {
+		if errors.Is(err, huh.ErrUserAborted) {
+			return ""
+		}
+		color.Red("query builder failed: %v", err)
+		os.Exit(1)
+	}
+	if action == builderCancel {
+		return ""
+	}
+	if exprText == "" {
+		color.Red("no filters chosen; use 'indexer dump' for every record")
+		os.Exit(1)
+	}
+	now := time.Now().UTC()
+	switch action {
+	case builderSaveQuery:
+		if err := ps.SaveQuery(storage.SavedQuery{Name: name, Expression: exprText, Created: now}); err != nil {
+			color.Red("failed to save query %s: %v", name, err)
+			os.Exit(1)
+		}
+		color.Green("Saved query %s: %s", name, exprText)
+		fmt.Printf("Run it with 'indexer query --saved %s'\n", name)
+	case builderSaveCollection:
+		expr, err := query.Parse(exprText)
+		if err != nil {
+			color.Red("invalid query: %v", err)
+			os.Exit(1)
+		}
+		c := storage.Collection{Name: name, Query: exprText, IDs: []string{}, Created: now}
+		for i := range records {
+			if expr.Match(&records[i]) {
+				c.IDs = append(c.IDs, records[i].ID)
+			}
+		}
+		if err := ps.SaveCollection(c); err != nil {
+			color.Red("failed to save collection %s: %v", name, err)
+			os.Exit(1)
+		}
+		color.Green("Saved collection %s with %d records", name, len(c.IDs))
+		fmt.Printf("List them with 'indexer query --collection %s'\n", name)
+	default:
+		return exprText
+	}
+	return ""
+}
+
+// offlineFilter flags the records of files on offline volumes, unless
+// unmarked is set, and with only set keeps just those.
+type offlineFilter struct {
+	vols     map[string]storage.Volume
+	only     bool
+	unmarked bool
+}
+
+func (f offlineFilter) keep(meta *metadata.FileMetadata) bool {
+	if f.unmarked {
+		_, ok := fileprocessor.OfflineVolume(meta, f.vols)
+		return ok || !f.only
+	}
+	return fileprocessor.MarkOffline(meta, f.vols) || !f.only
+}
+
+// writeCollection writes the records of a saved collection. Records since
+// removed from the store are counted on stderr.
+func writeCollection(ps *storage.PersistentStore, name, format string, limit int, offline offlineFilter) {
+	c, found, err := ps.Collection(name)
+	if err != nil {
+		color.Red("failed to read collection %s: %v", name, err)
+		os.Exit(1)
+	}
+	if !found {
+		color.Red("no collection named %s", name)
+		if collections, err := ps.Collections(); err == nil && len(collections) > 0 {
+			color.Yellow("Collections:")
+			for _, c := range collections {
+				color.Yellow("  %s (%d records)", c.Name, len(c.IDs))
+			}
+		}
+		os.Exit(1)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	w := newQueryWriter(out, format)
+	n, missing := 0, 0
+	for _, id := range c.IDs {
+		if limit > 0 && n >= limit {
+			break
+		}
+		meta, ok, err := ps.Get(id)
+		if err != nil {
+			out.Flush()
+			color.Red("failed to read record %s: %v", id, err)
+			os.Exit(1)
+		}
+		if !ok {
+			missing++
+			continue
+		}
+		if !offline.keep(&meta) {
+			continue
+		}
+		if err := w.Write(meta); err != nil {
+			color.Red("failed to write results: %v", err)
+			os.Exit(1)
+		}
+		n++
+	}
+	if err := w.Close(); err != nil {
+		color.Red("failed to write results: %v", err)
+		os.Exit(1)
+	}
+	if missing > 0 {
+		out.Flush()
+		color.New(color.FgYellow).Fprintf(os.Stderr, "%d records of collection %s are no longer in the store\n", missing, name)
+	}
+}
+
+// printFederationReport lists failed peers and divergent revisions on
+// stderr, keeping stdout for the results.
+func printFederationReport(result network.FederatedResult) {
+	warn := color.New(color.FgYellow)
+	for source, err := range result.Errors {
+		color.New(color.FgRed).Fprintf(os.Stderr, "%s: %v\n", source, err)
+	}
+	if len(result.Divergent) == 0 {
+		return
+	}
+	repaired := 0
+	for _, d := range result.Divergent {
+		repaired += len(d.Repaired)
+		warn.Fprintf(os.Stderr, "%s  %s: newest %s, stale on %s", shortHost(d.HostID), d.Path, d.ModTime, strings.Join(d.Stale, ", "))
+		if len(d.Repaired) > 0 {
+			fmt.Fprintf(os.Stderr, " (repaired %s)", strings.Join(d.Repaired, ", "))
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	warn.Fprintf(os.Stderr, "%d divergent files, %d stale copies repaired\n", len(result.Divergent), repaired)
+}
+
+// queryWriter streams matching records in one output format.
+type queryWriter interface {
+	Write(meta metadata.FileMetadata) error
+	Close() error // Finishes the output
+}
+
+func newQueryWriter(out *bufio.Writer, format string) queryWriter {
+	if format == "tsv" {
+		w := csv.NewWriter(out)
+		w.Comma = '\t'
+		w.Write([]string{"_id", "filePath", "size", "modTime", "offline"})
+		return tsvQueryWriter{w}
+	}
+	return &jsonQueryWriter{out: out}
+}
+
+// tsvQueryWriter writes the columns of "dump --format tsv", then the
+// offline volume a file is on, if any.
+type tsvQueryWriter struct{ w *csv.Writer }
+
+func (t tsvQueryWriter) Write(meta metadata.FileMetadata) error {
+	offline, _ := meta.Extra[metadata.OfflineVolumeField].(string)
+	return t.w.Write([]string{meta.ID, meta.FilePath, strconv.FormatInt(meta.Size, 10), meta.ModTime, offline})
+}
+
+func (t tsvQueryWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// jsonQueryWriter writes a single JSON array, one element at a time.
+type jsonQueryWriter struct {
+	out *bufio.Writer
+	n   int
+}
+
+func (j *jsonQueryWriter) Write(meta metadata.FileMetadata) error {
+	data, err := json.MarshalIndent(meta, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if j.n == 0 {
+		sep = "[\n  "
+	}
+	j.n++
+	j.out.WriteString(sep)
+	_, err = j.out.Write(data)
+	return err
+}
+
+func (j *jsonQueryWriter) Close() error {
+	end := "\n]\n"
+	if j.n == 0 {
+		end = "[]\n"
+	}
+	_, err := j.out.WriteString(end)
+	return err
+}
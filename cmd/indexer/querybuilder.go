@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/query"
+)
+
+// What to do with the query built by 'query --interactive'.
+const (
+	builderPrint          = "print"
+	builderSaveQuery      = "save-query"
+	builderSaveCollection = "save-collection"
+	builderCancel         = "cancel"
+)
+
+// builderAges are the modification age choices of the query builder.
+var builderAges = []struct {
+	label string
+	age   time.Duration
+}{
+	{"Any age", 0},
+	{"Last 24 hours", 24 * time.Hour},
+	{"Last 7 days", 7 * 24 * time.Hour},
+	{"Last 30 days", 30 * 24 * time.Hour},
+	{"Last 90 days", 90 * 24 * time.Hour},
+	{"Last year", 365 * 24 * time.Hour},
+}
+
+// queryFilters holds the answers of the query builder. The fields are
+// exported so that huh sees their changes and refreshes the live count.
+type queryFilters struct {
+	Host       string
+	Kinds      []string
+	Extensions string
+	MinSize    string
+	MaxSize    string
+	Age        time.Duration
+	Tags       []string
+}
+
+// queryQuoter escapes a string for a quoted query value.
+var queryQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// noteEscaper keeps huh notes from reading globs and names as markup.
+var noteEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`")
+
+func quoteQuery(s string) string {
+	return `"` + queryQuoter.Replace(s) + `"`
+}
+
+// Expression returns the filter expression selecting what f describes, or
+// "" when no filter is set. Sizes that do not parse are left out; the form
+// reports them.
+func (f *queryFilters) Expression(now time.Time) string {
+	var terms []string
+	anyOf := func(field, op string, values []string) {
+		var alts []string
+		for _, v := range values {
+			alts = append(alts, fmt.Sprintf("%s %s %s", field, op, quoteQuery(v)))
+		}
+		switch len(alts) {
+		case 0:
+		case 1:
+			terms = append(terms, alts[0])
+		default:
+			terms = append(terms, "("+strings.Join(alts, " OR ")+")")
+		}
+	}
+
+	if f.Host != "" {
+		terms = append(terms, "host = "+quoteQuery(f.Host))
+	}
+	anyOf(fileprocessor.FileKindField, "=", f.Kinds)
+	var globs []string
+	for _, ext := range strings.FieldsFunc(f.Extensions, func(r rune) bool { return r == ',' || r == ' ' }) {
+		globs = append(globs, "*."+strings.TrimPrefix(ext, "."))
+	}
+	anyOf("path", "~", globs)
+	if n, err := query.ParseSize(f.MinSize); f.MinSize != "" && err == nil {
+		terms = append(terms, fmt.Sprintf("size >= %d", n))
+	}
+	if n, err := query.ParseSize(f.MaxSize); f.MaxSize != "" && err == nil {
+		terms = append(terms, fmt.Sprintf("size <= %d", n))
+	}
+	if f.Age > 0 {
+		terms = append(terms, "modTime >= "+quoteQuery(now.Add(-f.Age).UTC().Format(time.RFC3339)))
+	}
+	for _, tag := range f.Tags {
+		terms = append(terms, "tags = "+quoteQuery(tag))
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// validSize accepts an empty size or one query.ParseSize understands.
+func validSize(s string) error {
+	if s == "" {
+		return nil
+	}
+	_, err := query.ParseSize(s)
+	return err
+}
+
+// fieldValues returns the distinct values of a field in records, sorted.
+func fieldValues(records []metadata.FileMetadata, field string) []string {
+	seen := map[string]bool{}
+	for i := range records {
+		for _, v := range records[i].FieldStrings(field) {
+			if v != "" {
+				seen[v] = true
+			}
+		}
+	}
+	values := make([]string, 0, len(seen))
+	for v := range seen {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// buildQuery walks the user through filters over records, showing how many
+// of them match as the answers change. It returns the expression and what
+// to do with it: one of the builder* actions, and a name when saving.
+func buildQuery(records []metadata.FileMetadata) (expr, action, name string, err error) {
+	var f queryFilters
+	now := time.Now()
+
+	hostOpts := []huh.Option[string]{huh.NewOption("Any host", "")}
+	for _, h := range fieldValues(records, "hostID") {
+		hostOpts = append(hostOpts, huh.NewOption(shortHost(h), h))
+	}
+	ageOpts := make([]huh.Option[time.Duration], 0, len(builderAges))
+	for _, a := range builderAges {
+		ageOpts = append(ageOpts, huh.NewOption(a.label, a.age))
+	}
+
+	preview := func() string {
+		text := f.Expression(now)
+		if text == "" {
+			return fmt.Sprintf("No filters yet (%d records)", len(records))
+		}
+		parsed, err := query.Parse(text)
+		if err != nil {
+			return noteEscaper.Replace(fmt.Sprintf("%s\ninvalid: %v", text, err))
+		}
+		n := 0
+		for i := range records {
+			if parsed.Match(&records[i]) {
+				n++
+			}
+		}
+		return fmt.Sprintf("%d of %d records match\n%s", n, len(records), noteEscaper.Replace(text))
+	}
+
+	filters := []huh.Field{
+		huh.NewNote().Title("Matches").DescriptionFunc(preview, &f),
+		huh.NewSelect[string]().Title("Host").Options(hostOpts...).Value(&f.Host),
+	}
+	if kinds := fieldValues(records, fileprocessor.FileKindField); len(kinds) > 0 {
+		filters = append(filters, huh.NewMultiSelect[string]().
+			Title("File kinds").
+			Description("Any of the selected; none for every kind").
+			Options(huh.NewOptions(kinds...)...).
+			Value(&f.Kinds))
+	}
+	filters = append(filters,
+		huh.NewInput().Title("Extensions").Placeholder("e.g. mp4, mkv").Value(&f.Extensions),
+		huh.NewInput().Title("Minimum size").Placeholder("e.g. 100MB").Validate(validSize).Value(&f.MinSize),
+		huh.NewInput().Title("Maximum size").Placeholder("e.g. 4GiB").Validate(validSize).Value(&f.MaxSize),
+		huh.NewSelect[time.Duration]().Title("Modified").Options(ageOpts...).Value(&f.Age),
+	)
+	if tags := fieldValues(records, "tags"); len(tags) > 0 {
+		filters = append(filters, huh.NewMultiSelect[string]().
+			Title("Tags").
+			Description("All of the selected").
+			Options(huh.NewOptions(tags...)...).
+			Value(&f.Tags))
+	}
+
+	action = builderPrint
+	saving := func() bool { return action == builderSaveQuery || action == builderSaveCollection }
+	form := huh.NewForm(
+		huh.NewGroup(filters...),
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("With the results").
+				Options(
+					huh.NewOption("Print them", builderPrint),
+					huh.NewOption("Save as a query (run again each time)", builderSaveQuery),
+					huh.NewOption("Save as a collection (these records)", builderSaveCollection),
+					huh.NewOption("Cancel", builderCancel),
+				).
+				Value(&action),
+		),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Name").
+				Validate(func(s string) error {
+					if strings.TrimSpace(s) == "" {
+						return errors.New("a name is required")
+					}
+					return nil
+				}).
+				Value(&name),
+		).WithHideFunc(func() bool { return !saving() }),
+	)
+	if err := form.Run(); err != nil {
+		return "", "", "", err
+	}
+	return f.Expression(now), action, strings.TrimSpace(name), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+func init() {
+	realmCmd := &cobra.Command{
+		Use:   "realm",
+		Short: "Manage the key that encrypts sensitive fields",
+		Long: `A realm is a group of nodes sharing a secret key. With --realm and
+--realm-key (or the "realm" and "realmKeyFile" config values) set, the fields
+listed in --encrypted-fields (default: filePath and notes) are encrypted in
+the store and in everything sent to peers. A stolen database, or a peer
+without the key, still sees hashes, sizes and times, but not paths.
+
+Every node of the realm needs a copy of the same key file. Nodes without it
+replicate the encrypted records unchanged.`,
+	}
+
+	keygenCmd := &cobra.Command{
+		Use:   "keygen <file>",
+		Short: "Generate a new realm key",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			path := args[0]
+			if _, err := os.Stat(path); err == nil {
+				color.Red("%s already exists; refusing to overwrite a realm key", path)
+				os.Exit(1)
+			}
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				color.Red("failed to generate key: %v", err)
+				os.Exit(1)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				color.Red("failed to create key directory: %v", err)
+				os.Exit(1)
+			}
+			if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+				color.Red("failed to write key: %v", err)
+				os.Exit(1)
+			}
+			color.Green("Wrote realm key to %s; copy it to every node of the realm", path)
+		},
+	}
+	realmCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(realmCmd)
+}
+
+// loadRealm returns the configured realm, or nil if none is set.
+func loadRealm() (*metadata.Realm, error) {
+	name := viper.GetString("realm")
+	if name == "" {
+		return nil, nil
+	}
+	keyFile := viper.GetString("realmKeyFile")
+	if keyFile == "" {
+		return nil, errors.New("realm set without a key file (--realm-key)")
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read realm key: %w", err)
+	}
+	key := []byte(strings.TrimSpace(string(data)))
+	if decoded, err := hex.DecodeString(string(key)); err == nil {
+		key = decoded
+	}
+	return metadata.NewRealm(name, key, viper.GetStringSlice("encryptedFields"))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+)
+
+func init() {
+	replicateCmd := &cobra.Command{
+		Use:   "replicate [source-url...]",
+		Short: "Pull metadata from upstream indexers' replication endpoints",
+		Long: `Pulls the /_changes feed of each upstream indexer (e.g. http://nas:8080)
+into the local store. Sources default to the "upstreams" config value.
+A checkpoint per source records the last sequence, last success time and
+document counts; see 'indexer stats'. Later pulls only fetch the changes
+made since the checkpointed sequence. With --lag-alert, an alert is sent
+when a source has gone that long without a successful pull.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			sources := args
+			if len(sources) == 0 {
+				sources = viper.GetStringSlice("upstreams")
+			}
+			if len(sources) == 0 {
+				color.Red("no upstream sources given (pass URLs or set \"upstreams\" in config)")
+				os.Exit(1)
+			}
+			interval, _ := cmd.Flags().GetDuration("interval")
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				cancel()
+			}()
+
+			monitor := network.NewLagMonitor(ps)
+			for {
+				for _, source := range sources {
+					n, err := network.Replicate(ps, source)
+					if err != nil {
+						color.Red("replicate %s: %v", source, err)
+						continue
+					}
+					if !viper.GetBool("quiet") {
+						color.Green("replicated %d documents from %s", n, source)
+					}
+				}
+				if err := monitor.Check(); err != nil {
+					color.Red("replication lag check: %v", err)
+				}
+				if interval <= 0 {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(interval):
+				}
+			}
+		},
+	}
+	replicateCmd.Flags().Duration("interval", 0, "Repeat the pull at this interval (0 pulls once)")
+	rootCmd.AddCommand(replicateCmd)
+}
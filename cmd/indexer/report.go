@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// reportCmd groups the read-only reports derived from the stored index.
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Reports derived from the stored index",
+}
+
+func init() {
+	emptyCmd := &cobra.Command{
+		Use:   "empty",
+		Short: "List zero-byte files and empty directories, optionally removing them",
+		Long: `Lists zero-byte files and empty directories recorded during scans; these
+frequently indicate interrupted copies. With --delete, the entries that are
+on this host and still empty are removed after confirmation.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			allHosts, _ := cmd.Flags().GetBool("all-hosts")
+			doDelete, _ := cmd.Flags().GetBool("delete")
+			yes, _ := cmd.Flags().GetBool("yes")
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			metas, err := ps.Latest()
+			if err != nil {
+				color.Red("failed to read metadata: %v", err)
+				os.Exit(1)
+			}
+			dirs, err := ps.EmptyDirs()
+			if err != nil {
+				color.Red("failed to read empty directories: %v", err)
+				os.Exit(1)
+			}
+
+			var files, emptyDirs []string
+			for _, meta := range metas {
+				if meta.Size == 0 && (allHosts || meta.HostID == utils.HostID) {
+					files = append(files, meta.FilePath)
+				}
+			}
+			for _, d := range dirs {
+				if allHosts || d.HostID == utils.HostID {
+					emptyDirs = append(emptyDirs, d.Path)
+				}
+			}
+			sort.Strings(files)
+			sort.Strings(emptyDirs)
+
+			color.Cyan("Zero-byte files (%d):", len(files))
+			for _, f := range files {
+				fmt.Println("  " + f)
+			}
+			color.Cyan("Empty directories (%d):", len(emptyDirs))
+			for _, d := range emptyDirs {
+				fmt.Println("  " + d)
+			}
+
+			if !doDelete {
+				return
+			}
+			if allHosts {
+				color.Red("--delete only applies to this host; drop --all-hosts")
+				os.Exit(1)
+			}
+			if len(files)+len(emptyDirs) == 0 {
+				return
+			}
+			if !yes {
+				confirm := false
+				err := huh.NewConfirm().
+					Title(fmt.Sprintf("Remove %d zero-byte files and %d empty directories?", len(files), len(emptyDirs))).
+					Value(&confirm).
+					Run()
+				if err != nil || !confirm {
+					fmt.Println("Skipped.")
+					return
+				}
+			}
+			removed := cleanupEmpty(files, emptyDirs)
+			color.Green("Removed %d entries; run 'indexer prune' to record the deletions", removed)
+		},
+	}
+	emptyCmd.Flags().Bool("all-hosts", false, "Include entries recorded by every host")
+	emptyCmd.Flags().Bool("delete", false, "Remove the listed entries on this host")
+	emptyCmd.Flags().Bool("yes", false, "Do not ask for confirmation before removing")
+	reportCmd.AddCommand(emptyCmd)
+
+	typesCmd := &cobra.Command{
+		Use:   "types",
+		Short: "Show file counts and bytes per extension",
+		Long: `Aggregates the latest revision of every indexed file by extension, giving a
+quick composition overview of what a volume contains. By default only this
+host's files are counted; --all-hosts aggregates cluster-wide.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			allHosts, _ := cmd.Flags().GetBool("all-hosts")
+			top, _ := cmd.Flags().GetInt("top")
+			format, _ := cmd.Flags().GetString("format")
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			latest, err := ps.Latest()
+			if err != nil {
+				color.Red("failed to read metadata: %v", err)
+				os.Exit(1)
+			}
+			hostID := utils.HostID
+			if allHosts {
+				hostID = ""
+			}
+			stats := network.ExtensionStats(latest, hostID)
+			if top > 0 && len(stats) > top {
+				stats = stats[:top]
+			}
+
+			switch format {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(stats); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+			case "text":
+				var totalFiles int
+				var totalBytes int64
+				for _, st := range stats {
+					totalFiles += st.Files
+					totalBytes += st.Bytes
+				}
+				fmt.Printf("%-12s  %10s  %12s  %6s\n", "EXTENSION", "FILES", "BYTES", "SHARE")
+				for _, st := range stats {
+					share := 0.0
+					if totalBytes > 0 {
+						share = 100 * float64(st.Bytes) / float64(totalBytes)
+					}
+					fmt.Printf("%-12s  %10d  %12s  %5.1f%%\n", st.Ext, st.Files, utils.FormatBytes(st.Bytes), share)
+				}
+				color.Cyan("%-12s  %10d  %12s", "TOTAL", totalFiles, utils.FormatBytes(totalBytes))
+			default:
+				color.Red("unknown report format: %s", format)
+				os.Exit(1)
+			}
+		},
+	}
+	typesCmd.Flags().Bool("all-hosts", false, "Aggregate across every host in the replicated store")
+	typesCmd.Flags().Int("top", 0, "Only show the N largest extensions (0 shows all)")
+	typesCmd.Flags().String("format", "text", "Output format: text or json")
+	reportCmd.AddCommand(typesCmd)
+
+	atRiskCmd := &cobra.Command{
+		Use:   "at-risk",
+		Short: "List what exists on only one host, for backup planning",
+		Long: `For each host, lists the files whose content (by fingerprint) no other live
+host holds: what would be lost if that machine died. Hosts are ordered by
+the bytes at risk and their files largest first, so the top of the report
+is what most needs a backup.
+
+A host counts as live unless it is named with --down, or its newest record
+is older than --stale. Copies on hosts that are not live do not protect a
+file, but are shown. Retired hosts (see 'indexer host retire') are left out
+altogether, and empty files are ignored.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			host, _ := cmd.Flags().GetString("host")
+			stale, _ := cmd.Flags().GetDuration("stale")
+			down, _ := cmd.Flags().GetStringSlice("down")
+			top, _ := cmd.Flags().GetInt("top")
+			format, _ := cmd.Flags().GetString("format")
+			if format != "text" && format != "json" {
+				color.Red("unknown report format: %s", format)
+				os.Exit(1)
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			latest, err := ps.Latest()
+			if err != nil {
+				color.Red("failed to read metadata: %v", err)
+				os.Exit(1)
+			}
+			hosts, err := ps.Hosts()
+			if err != nil {
+				color.Red("failed to read hosts: %v", err)
+				os.Exit(1)
+			}
+			live := map[string]bool{}
+			for _, h := range hosts {
+				seen, err := time.Parse(time.RFC3339, h.LastSeen)
+				live[h.HostID] = stale <= 0 || err == nil && time.Since(seen) <= stale
+				for _, d := range down {
+					if strings.HasPrefix(h.HostID, d) {
+						live[h.HostID] = false
+					}
+				}
+			}
+			risks := network.AtRisk(latest, func(id string) bool { return live[id] })
+			if host != "" {
+				var only []network.HostRisk
+				for _, r := range risks {
+					if strings.HasPrefix(r.HostID, host) {
+						only = append(only, r)
+					}
+				}
+				risks = only
+			}
+			for i := range risks {
+				if top > 0 && len(risks[i].AtRisk) > top {
+					risks[i].AtRisk = risks[i].AtRisk[:top]
+				}
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(risks); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			printAtRisk(risks)
+		},
+	}
+	atRiskCmd.Flags().String("host", "", "Only report this host (ID or prefix); default: every host")
+	atRiskCmd.Flags().Duration("stale", 0, "Count a host as down when its newest record is older than this (0: every host is live)")
+	atRiskCmd.Flags().StringSlice("down", nil, "Hosts (IDs or prefixes) to count as down, e.g. ones known to have failed")
+	atRiskCmd.Flags().Int("top", 20, "Files listed per host (0 lists all)")
+	atRiskCmd.Flags().String("format", "text", "Output format: text or json")
+	reportCmd.AddCommand(atRiskCmd)
+
+	rootCmd.AddCommand(reportCmd)
+}
+
+func printAtRisk(risks []network.HostRisk) {
+	for _, r := range risks {
+		state := color.GreenString("live")
+		if !r.Live {
+			state = color.RedString("down")
+		}
+		share := 0.0
+		if r.Bytes > 0 {
+			share = 100 * float64(r.AtRiskBytes) / float64(r.Bytes)
+		}
+		color.Cyan("%s (%s): %d of %d files, %s of %s (%.1f%%) only on this host",
+			shortHost(r.HostID), state, r.AtRiskFiles, r.Files, utils.FormatBytes(r.AtRiskBytes), utils.FormatBytes(r.Bytes), share)
+		for _, f := range r.AtRisk {
+			line := fmt.Sprintf("  %12s  %s", utils.FormatBytes(f.Size), f.Path)
+			if len(f.DownCopies) > 0 {
+				short := make([]string, len(f.DownCopies))
+				for i, h := range f.DownCopies {
+					short[i] = shortHost(h)
+				}
+				line += color.YellowString("  (also on down hosts: %s)", strings.Join(short, ", "))
+			}
+			fmt.Println(line)
+		}
+		if n := r.AtRiskFiles - len(r.AtRisk); n > 0 {
+			fmt.Printf("  ... and %d more (see --top)\n", n)
+		}
+	}
+}
+
+// cleanupEmpty removes files that are still zero bytes and directories that
+// are still empty. Directories are removed deepest first so that parents
+// emptied by the removal of their children go too.
+func cleanupEmpty(files, dirs []string) int {
+	removed := 0
+	for _, f := range files {
+		// Records hold canonical paths: server:/share/... on network mounts
+		f = fileprocessor.LocalPath(f)
+		info, err := os.Lstat(f)
+		if err != nil || !info.Mode().IsRegular() || info.Size() != 0 {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			color.Red("failed to remove %s: %v", f, err)
+			continue
+		}
+		removed++
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, d := range dirs {
+		d = fileprocessor.LocalPath(d)
+		// os.Remove refuses to delete a directory that is no longer empty.
+		if err := os.Remove(d); err != nil {
+			if !os.IsNotExist(err) {
+				color.Yellow("kept %s: %v", d, err)
+			}
+			continue
+		}
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+)
+
+func init() {
+	seedCmd := &cobra.Command{
+		Use:   "seed-server",
+		Short: "Run a rendezvous server that swarm nodes register with",
+		Long: `Runs a seed server for networks where multicast (mDNS discovery) is
+blocked. Nodes started with --swarm --seed http://<this host>:<port> register
+their swarm address with a TTL and renew it while they run; entries that are
+not renewed expire. Registered nodes are health-checked by connecting to
+their swarm port, and GET /peerlist returns the healthy ones, in the format
+--peerListURL reads.
+
+With --seed-token (or the "seedToken" config value) set, registering and
+listing require "Authorization: Bearer <token>"; nodes send the same token.
+With --tls-cert and --tls-key the server listens over HTTPS, as 'indexer
+serve' does (and --tls-client-ca requires client certificates); nodes then
+use an https:// --seed URL and trust the certificate through --tls-ca.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			addr := viper.GetString("addr")
+			maxTTL, _ := cmd.Flags().GetDuration("max-ttl")
+			interval, _ := cmd.Flags().GetDuration("check-interval")
+			token := viper.GetString("seedToken")
+			if token == "" {
+				color.Yellow("No --seed-token set; anyone can register")
+			}
+
+			seed := network.NewSeedServer(token, maxTTL)
+			go seed.Run(context.Background(), interval)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/register", seed.HandleRegister)
+			mux.HandleFunc("/peerlist", seed.HandlePeerList)
+
+			tlsConfig, err := network.ServerTLSConfig()
+			if err != nil {
+				color.Red("seed server TLS: %v", err)
+				os.Exit(1)
+			}
+			srv := &http.Server{Addr: addr, Handler: mux, TLSConfig: tlsConfig}
+			if tlsConfig != nil {
+				color.Blue("Starting seed server on %s (HTTPS)", addr)
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				color.Blue("Starting seed server on %s", addr)
+				err = srv.ListenAndServe()
+			}
+			if err != nil {
+				log.Fatalf("seed server error: %v", err)
+			}
+		},
+	}
+	seedCmd.Flags().Duration("max-ttl", 5*time.Minute, "Longest registration TTL granted")
+	seedCmd.Flags().Duration("check-interval", 30*time.Second, "How often to expire entries and health-check peers")
+	rootCmd.AddCommand(seedCmd)
+}
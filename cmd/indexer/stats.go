@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+)
+
+func init() {
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show store statistics and replication lag per upstream",
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			st, err := network.CollectStats(ps)
+			if err != nil {
+				color.Red("failed to collect stats: %v", err)
+				os.Exit(1)
+			}
+
+			switch format {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(st); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+			case "text":
+				printStats(st)
+			default:
+				color.Red("unknown stats format: %s", format)
+				os.Exit(1)
+			}
+		},
+	}
+	statsCmd.Flags().String("format", "text", "Output format: text or json")
+	rootCmd.AddCommand(statsCmd)
+}
+
+func printStats(st network.Stats) {
+	color.Cyan("Records: %d", st.Records)
+	if len(st.IndexedFields) > 0 {
+		fmt.Printf("Indexed fields: %s\n", strings.Join(st.IndexedFields, ", "))
+	}
+	if len(st.Replication) == 0 {
+		return
+	}
+	color.Cyan("\nReplication upstreams:")
+	fmt.Printf("%-40s  %-10s  %-12s  %-10s  %s\n", "SOURCE", "LAST SEQ", "LAG", "LAST DOCS", "STATUS")
+	for _, cp := range st.Replication {
+		lag := "never"
+		if !cp.LastSuccess.IsZero() {
+			lag = cp.Lag().Truncate(time.Second).String()
+		}
+		status := color.GreenString("ok")
+		if cp.LastError != "" {
+			status = color.RedString(cp.LastError)
+		}
+		seq := cp.LastSeq
+		if seq == "" {
+			seq = "-"
+		}
+		fmt.Printf("%-40s  %-10s  %-12s  %-10d  %s\n", cp.Source, seq, lag, cp.DocsReceived, status)
+	}
+}
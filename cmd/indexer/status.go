@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/metrics"
+	"gnomatix/dreamfs/v2/pkg/network"
+)
+
+func init() {
+	statusCmd := &cobra.Command{
+		Use:   "status [url]",
+		Short: "Show the resource use, files indexed, replication lag and errors of a running node and its peers",
+		Long: `Fetches the status of the node serving at url (default: the one 'indexer
+serve' runs here with --addr): the CPU, memory and disk I/O, files indexed
+and latest alerts that it and each swarm peer gossip every few seconds
+(/peer-metrics), with the members' state and replication lag (/cluster).
+
+With --watch the status is shown as a live dashboard, refreshed every
+--interval; press r to refresh now and q to quit.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			watch, _ := cmd.Flags().GetBool("watch")
+			interval, _ := cmd.Flags().GetDuration("interval")
+			format, _ := cmd.Flags().GetString("format")
+			if format != "text" && format != "json" {
+				color.Red("unknown status format: %s", format)
+				os.Exit(1)
+			}
+			url := network.DefaultSyncURL(viper.GetString("addr"))
+			if len(args) == 1 {
+				url = args[0]
+			}
+			if watch {
+				if interval <= 0 {
+					color.Red("--interval must be positive")
+					os.Exit(1)
+				}
+				if err := metrics.RunDashboard(url, interval); err != nil {
+					color.Red("dashboard failed: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			st, err := metrics.FetchStatus(url)
+			if err != nil {
+				color.Red("failed to fetch status: %v", err)
+				os.Exit(1)
+			}
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(st); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			fmt.Print(metrics.RenderStatus(st))
+		},
+	}
+	statusCmd.Flags().Bool("watch", false, "Show a live dashboard until q is pressed")
+	statusCmd.Flags().Duration("interval", 2*time.Second, "How often the dashboard refreshes")
+	statusCmd.Flags().String("format", "text", "Output format without --watch: text or json")
+	rootCmd.AddCommand(statusCmd)
+}
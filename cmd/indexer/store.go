@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+func init() {
+	storeCmd := &cobra.Command{
+		Use:   "store",
+		Short: "Manage the database itself",
+	}
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate --to <driver>",
+		Short: "Copy the database to another storage driver",
+		Long: `Copies every record, index and setting of the database into a new one kept
+by another driver (see --db-driver), e.g. from BoltDB to SQLite, then counts
+the keys of each bucket in both and fails if any differ. The source is left
+untouched; point --dbpath/--db-driver (or the config file) at the new
+database once it is verified.
+
+By default the source is the database --dbpath and --db-driver name, and the
+target is the same path with the target driver's extension (.db or .sqlite).
+Keys are copied --batch at a time; an interrupted migration resumes where it
+stopped when run again. The target must otherwise be new or empty.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString("from")
+			to, _ := cmd.Flags().GetString("to")
+			fromPath, _ := cmd.Flags().GetString("from-path")
+			toPath, _ := cmd.Flags().GetString("to-path")
+			batch, _ := cmd.Flags().GetInt("batch")
+			quiet := viper.GetBool("quiet")
+			if from == "" {
+				from = viper.GetString("dbDriver")
+			}
+			if fromPath == "" {
+				fromPath = storePath(from, viper.GetString("dbpath"))
+			}
+			if toPath == "" {
+				toPath = storePath(to, viper.GetString("dbpath"))
+				if toPath == fromPath {
+					ext := ".db"
+					if to == storage.DriverSQLite {
+						ext = ".sqlite"
+					}
+					toPath = strings.TrimSuffix(fromPath, filepath.Ext(fromPath)) + ext
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				cancel()
+			}()
+
+			if !quiet {
+				fmt.Printf("Migrating %s (%s) to %s (%s)\n", fromPath, from, toPath, to)
+			}
+			counts, err := storage.Migrate(ctx, from, fromPath, to, toPath, batch, func(p storage.MigrateProgress) {
+				if quiet {
+					return
+				}
+				fmt.Printf("\r  %-24s %d/%d", p.Bucket, p.Copied, p.Total)
+				if p.Copied >= p.Total {
+					fmt.Println()
+				}
+			})
+			if ctx.Err() != nil {
+				fmt.Println()
+				color.Yellow("Migration interrupted; run the same command again to resume")
+				os.Exit(1)
+			}
+			if counts != nil {
+				fmt.Printf("%-26s  %10s  %10s\n", "BUCKET", "SOURCE", "TARGET")
+				for _, c := range counts {
+					line := fmt.Sprintf("%-26s  %10d  %10d", c.Bucket, c.Source, c.Target)
+					if c.Source != c.Target {
+						color.Red(line)
+					} else {
+						fmt.Println(line)
+					}
+				}
+			}
+			if err != nil {
+				color.Red("migration failed: %v", err)
+				os.Exit(1)
+			}
+			color.Green("Migrated to %s; use it with --db-driver %s --dbpath %s", toPath, to, toPath)
+		},
+	}
+	migrateCmd.Flags().String("from", "", "Driver of the source database (default: --db-driver)")
+	migrateCmd.Flags().String("to", "", "Driver of the target database: "+storage.DriverBolt+" or "+storage.DriverSQLite)
+	migrateCmd.Flags().String("from-path", "", "Source database file (default: --dbpath)")
+	migrateCmd.Flags().String("to-path", "", "Target database file (default: --dbpath with the target driver's extension)")
+	migrateCmd.Flags().Int("batch", 1000, "Keys copied per transaction")
+	migrateCmd.MarkFlagRequired("to")
+
+	storeCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(storeCmd)
+}
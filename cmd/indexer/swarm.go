@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	swarmCmd := &cobra.Command{
+		Use:   "swarm",
+		Short: "Manage swarm gossip encryption keys",
+		Long: `With --swarm-key (or the "swarmKey" config value) set, swarm gossip is
+encrypted and authenticated with that key, and nodes without it can neither
+read it nor join the swarm. Every node needs the same key.
+
+To rotate keys without a restart, use --swarm-keyring: a file with one key
+per line. The first line encrypts outgoing gossip; every line is accepted
+for incoming gossip. The file is reloaded when it changes, so add the new
+key as a second line on every node, then move it first on every node, then
+remove the old key.
+
+Which nodes may join is limited with --swarm-allow-cidr and
+--swarm-deny-cidr (node addresses), --swarm-allow-host and --swarm-deny-host
+(host IDs) and --swarm-join-token (a shared secret every node must hold).
+Refused nodes are not gossiped to and the state they push is dropped; with
+a join token every message must also carry it, so nodes without it cannot
+send records at all. Only the swarm key keeps gossip private.`,
+	}
+
+	keygenCmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Print a new swarm key",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				color.Red("failed to generate key: %v", err)
+				os.Exit(1)
+			}
+			fmt.Println(base64.StdEncoding.EncodeToString(key))
+		},
+	}
+	swarmCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(swarmCmd)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+)
+
+func init() {
+	syncCheckCmd := &cobra.Command{
+		Use:   "sync-check <url>...",
+		Short: "Check whether nodes hold the same records by comparing their digests",
+		Long: `Fetches the dataset digest (a hash over every record; see /_digest) of
+each node given by its HTTP base URL, e.g. http://host:8080, and reports
+whether they all match. With a single URL it is compared with the local
+database. Exits 1 if the nodes are not in sync.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			type node struct {
+				name   string
+				digest network.Digest
+			}
+			var nodes []node
+			if len(args) == 1 {
+				ps, err := openStore(viper.GetString("dbpath"))
+				if err != nil {
+					color.Red("failed to open persistent store: %v", err)
+					os.Exit(1)
+				}
+				dg, _, err := network.ComputeDigest(ps)
+				ps.Close()
+				if err != nil {
+					color.Red("failed to compute digest: %v", err)
+					os.Exit(1)
+				}
+				nodes = append(nodes, node{"local", dg})
+			}
+			for _, url := range args {
+				dg, err := network.FetchDigest(url)
+				if err != nil {
+					color.Red("failed to fetch digest from %s: %v", url, err)
+					os.Exit(1)
+				}
+				nodes = append(nodes, node{url, dg})
+			}
+
+			inSync := true
+			fmt.Printf("%-40s  %-10s  %s\n", "NODE", "RECORDS", "DIGEST")
+			for _, n := range nodes {
+				fmt.Printf("%-40s  %-10d  %.16s\n", n.name, n.digest.Records, n.digest.Hash)
+				inSync = inSync && n.digest.Hash == nodes[0].digest.Hash
+			}
+			if !inSync {
+				color.Red("Nodes are not in sync")
+				os.Exit(1)
+			}
+			color.Green("Nodes are in sync")
+		},
+	}
+	rootCmd.AddCommand(syncCheckCmd)
+
+	syncCmd := &cobra.Command{
+		Use:   "sync <url>...",
+		Short: "Fetch the records that differ from other nodes, comparing ranges of them",
+		Long: `Brings the local database up to date with each node given by its HTTP base
+URL, e.g. http://host:8080, through its /sync endpoint: the two sides
+compare hashes over ranges of their records, narrowing down to the ranges
+that differ, and only the records of those ranges that differ are
+transferred. Records held in different revisions are settled as in any
+merge. With --push the nodes also receive the local records they lack.
+
+Swarm nodes run by 'indexer serve' do this on their own when they join and
+whenever their digests disagree too much to repair by broadcast.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			push, _ := cmd.Flags().GetBool("push")
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			failed := false
+			for _, url := range args {
+				res, err := network.Sync(ps, url, push)
+				if err != nil {
+					color.Red("failed to sync with %s: %v", url, err)
+					failed = true
+					continue
+				}
+				if res.Ranges == 0 {
+					color.Green("%s: in sync (%d requests)", url, res.Requests)
+					continue
+				}
+				color.Green("%s: %d ranges differed; received %d records, stored %d, pushed %d (%d requests)",
+					url, res.Ranges, res.Received, res.Stored, res.Pushed, res.Requests)
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	syncCmd.Flags().Bool("push", false, "Also send the nodes the local records they lack or hold other revisions of")
+	rootCmd.AddCommand(syncCmd)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// taggedRecord is a record that tagging rules gave tags it lacked.
+type taggedRecord struct {
+	ID       string   `json:"_id"`
+	FilePath string   `json:"filePath"`
+	Added    []string `json:"added"`
+}
+
+func init() {
+	tagsCmd := &cobra.Command{
+		Use:   "tags",
+		Short: "Classify files automatically with tagging rules",
+		Long: `Tagging rules add tags to the files that match them, so that files are
+classified as they are indexed rather than by hand. Rules are the "tagRules"
+config value, a list of objects such as:
+
+  "tagRules": [
+    {"glob": "*.cr2", "tags": ["raw", "photo"]},
+    {"type": "video", "minSize": "1GB", "tags": ["big-video"]},
+    {"glob": "/srv/backups/**", "type": "application/*", "tags": ["backup"]}
+  ]
+
+A rule matches a file when all of its predicates do:
+
+  glob     a .dreamfsignore-style pattern: on the file name at any depth, or
+           on the whole path if it starts with /; ** spans directories
+  type     a kind (video, audio, image, text, archive, document, ...) or a
+           MIME type, which may end in /*; the type sniffed with
+           --detect-types, else the one of the file's extension
+  minSize  sizes such as 100MB or 1.5GiB, inclusive
+  maxSize
+
+The tags of every matching rule are added to the record's "tags" list as
+'indexer index', 'watch' and 'hash-stream' store it. 'indexer tags
+apply-rules' applies the rules to records stored before, or before a rule
+was added. Rules only add tags; tags given by hand are kept.`,
+	}
+
+	rulesCmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Check and list the configured tagging rules",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			if format != "text" && format != "json" {
+				color.Red("unknown tags rules format: %s", format)
+				os.Exit(1)
+			}
+			rules, err := fileprocessor.TagRules()
+			if err != nil {
+				color.Red("%v", err)
+				os.Exit(1)
+			}
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(rules); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			if len(rules) == 0 {
+				color.Yellow("No tagging rules (set \"tagRules\" in config)")
+				return
+			}
+			for i, r := range rules {
+				fmt.Printf("%3d  %s\n", i+1, r)
+			}
+		},
+	}
+	rulesCmd.Flags().String("format", "text", "Output format: text or json")
+
+	applyCmd := &cobra.Command{
+		Use:   "apply-rules",
+		Short: "Tag the stored records of a host's files by the tagging rules",
+		Long: `Applies the configured tagging rules (see 'indexer tags') to the current
+records of a host's files, by default this host's, and stores a new
+revision of each record that gains tags; it replicates to peers as any other
+write does. With --dry-run the records that would gain tags are listed
+without storing anything.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			host, _ := cmd.Flags().GetString("host")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			format, _ := cmd.Flags().GetString("format")
+			if format != "text" && format != "json" {
+				color.Red("unknown apply-rules format: %s", format)
+				os.Exit(1)
+			}
+			if host == "" {
+				host = utils.HostID
+			}
+			rules, err := fileprocessor.TagRules()
+			if err != nil {
+				color.Red("%v", err)
+				os.Exit(1)
+			}
+			if len(rules) == 0 {
+				color.Red("no tagging rules (set \"tagRules\" in config)")
+				os.Exit(1)
+			}
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			metas, err := hostFiles(ps, host)
+			if err != nil {
+				color.Red("failed to read records: %v", err)
+				os.Exit(1)
+			}
+			tagged := []taggedRecord{}
+			counts := map[string]int{}
+			for _, meta := range metas {
+				before := map[string]bool{}
+				for _, tag := range meta.FieldStrings(fileprocessor.TagsField) {
+					before[tag] = true
+				}
+				if !fileprocessor.ApplyTagRules(&meta, rules) {
+					continue
+				}
+				rec := taggedRecord{ID: meta.ID, FilePath: meta.FilePath}
+				for _, tag := range meta.FieldStrings(fileprocessor.TagsField) {
+					if !before[tag] {
+						rec.Added = append(rec.Added, tag)
+						counts[tag]++
+					}
+				}
+				if !dryRun {
+					if err := ps.Put(meta); err != nil {
+						color.Red("failed to store %s: %v", meta.FilePath, err)
+						os.Exit(1)
+					}
+				}
+				tagged = append(tagged, rec)
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(tagged); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			if dryRun {
+				for _, rec := range tagged {
+					fmt.Printf("%s  +%v\n", rec.FilePath, rec.Added)
+				}
+				color.Green("Would tag %d of %d records", len(tagged), len(metas))
+			} else {
+				color.Green("Tagged %d of %d records", len(tagged), len(metas))
+			}
+			tags := make([]string, 0, len(counts))
+			for tag := range counts {
+				tags = append(tags, tag)
+			}
+			sort.Strings(tags)
+			for _, tag := range tags {
+				fmt.Printf("  %-20s %d\n", tag, counts[tag])
+			}
+		},
+	}
+	applyCmd.Flags().String("host", "", "Host ID whose records to tag (default: this host)")
+	applyCmd.Flags().Bool("dry-run", false, "List the records that would gain tags without storing them")
+	applyCmd.Flags().String("format", "text", "Output format: text or json")
+
+	tagsCmd.AddCommand(rulesCmd, applyCmd)
+	rootCmd.AddCommand(tagsCmd)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// timelineEvent describes how a stored revision differs from the one before it.
+type timelineEvent struct {
+	Meta    metadata.FileMetadata
+	Indexed time.Time
+	Events  []string
+}
+
+// indexedAt returns when a revision was written: the physical time of its
+// version clock, or for records written before clocks, its ModTime.
+func indexedAt(meta metadata.FileMetadata) time.Time {
+	_, clock := meta.Version()
+	if t, _, ok := metadata.ClockTime(clock); ok {
+		return t
+	}
+	t, _ := time.Parse(time.RFC3339, meta.ModTime)
+	return t
+}
+
+// buildTimeline orders revisions by when they were indexed and labels each
+// with the changes (size, content, host) relative to the previous revision
+// at its path. A path first seen with the last content of a path on the same
+// host that ends up deleted is reported as that file moved; the tombstone
+// may be written later, when 'indexer prune' notices the old path is gone.
+func buildTimeline(metas []metadata.FileMetadata) []timelineEvent {
+	timeline := make([]timelineEvent, 0, len(metas))
+	for _, meta := range metas {
+		timeline = append(timeline, timelineEvent{Meta: meta, Indexed: indexedAt(meta)})
+	}
+	sort.SliceStable(timeline, func(i, j int) bool {
+		if !timeline[i].Indexed.Equal(timeline[j].Indexed) {
+			return timeline[i].Indexed.Before(timeline[j].Indexed)
+		}
+		_, ci := timeline[i].Meta.Version()
+		_, cj := timeline[j].Meta.Version()
+		if ci != cj {
+			return ci < cj
+		}
+		return timeline[i].Meta.ID < timeline[j].Meta.ID
+	})
+
+	// The last live revision of each path whose latest revision is a tombstone
+	gone := map[string]metadata.FileMetadata{}
+	live := map[string]metadata.FileMetadata{}
+	for _, t := range timeline {
+		key := t.Meta.HostID + "|" + t.Meta.FilePath
+		if t.Meta.Deleted() {
+			if prev, ok := live[key]; ok {
+				gone[key] = prev
+			}
+		} else {
+			live[key] = t.Meta
+			delete(gone, key)
+		}
+	}
+
+	last := map[string]metadata.FileMetadata{} // Latest revision by host and path
+	for i := range timeline {
+		meta := timeline[i].Meta
+		key := meta.HostID + "|" + meta.FilePath
+		prev, seen := last[key]
+		var events []string
+		switch {
+		case meta.Deleted():
+			events = append(events, "deleted")
+		case !seen:
+			if from, ok := movedFrom(meta, timeline[i].Indexed, gone); ok {
+				events = append(events, "moved from "+from)
+			} else {
+				events = append(events, "first seen")
+			}
+		case prev.Deleted():
+			events = append(events, "recreated")
+		default:
+			if meta.BLAKE3 != prev.BLAKE3 {
+				events = append(events, "content changed")
+			}
+			if meta.Size != prev.Size {
+				events = append(events, fmt.Sprintf("size %+d", meta.Size-prev.Size))
+			}
+			if len(events) == 0 {
+				events = append(events, "touched")
+			}
+		}
+		last[key] = meta
+		timeline[i].Events = events
+	}
+	return timeline
+}
+
+// movedFrom finds the path a revision was moved from: another path on the
+// same host that ends up deleted, whose last content, indexed no later than
+// the revision, was the same. Each such path is claimed by the first
+// revision only; later ones are copies.
+func movedFrom(meta metadata.FileMetadata, indexed time.Time, gone map[string]metadata.FileMetadata) (string, bool) {
+	from := ""
+	for key, old := range gone {
+		if old.HostID == meta.HostID && old.FilePath != meta.FilePath && old.BLAKE3 == meta.BLAKE3 && !indexedAt(old).After(indexed) {
+			if from == "" || key < from {
+				from = key
+			}
+		}
+	}
+	if from == "" {
+		return "", false
+	}
+	path := gone[from].FilePath
+	delete(gone, from)
+	return path, true
+}
+
+// relatedRevisions adds to a file's revisions those that tell where its
+// content moved: the revisions of other paths that held one of its
+// fingerprints and were deleted, with their tombstones. Copies at paths
+// that were never deleted are left out.
+func relatedRevisions(ps *storage.PersistentStore, metas []metadata.FileMetadata) ([]metadata.FileMetadata, error) {
+	have := map[string]bool{}
+	paths := map[string]bool{}
+	hashes := map[string]bool{}
+	for _, meta := range metas {
+		have[meta.ID] = true
+		paths[meta.HostID+"|"+meta.FilePath] = true
+		if meta.BLAKE3 != "" {
+			hashes[meta.BLAKE3] = true
+		}
+	}
+	others := map[string]metadata.FileMetadata{} // A revision of each other path, by host and path
+	for hash := range hashes {
+		copies, err := ps.Find(map[string]string{"blake3": hash})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range copies {
+			if !have[c.ID] {
+				have[c.ID] = true
+				metas = append(metas, c)
+			}
+			others[c.HostID+"|"+c.FilePath] = c
+		}
+	}
+	deleted := map[string]bool{}
+	for key, c := range others {
+		revs, err := ps.Find(map[string]string{"filePath": c.FilePath})
+		if err != nil {
+			return nil, err
+		}
+		for _, rev := range revs {
+			if rev.HostID != c.HostID || !rev.Deleted() {
+				continue
+			}
+			deleted[key] = true
+			if !have[rev.ID] {
+				have[rev.ID] = true
+				metas = append(metas, rev)
+			}
+		}
+	}
+	// Copies at paths that still exist are not moves
+	out := metas[:0]
+	for _, meta := range metas {
+		if key := meta.HostID + "|" + meta.FilePath; paths[key] || deleted[key] {
+			out = append(out, meta)
+		}
+	}
+	return out, nil
+}
+
+func shortID(s string) string {
+	if len(s) > 12 {
+		return s[:12]
+	}
+	return s
+}
+
+func init() {
+	timelineCmd := &cobra.Command{
+		Use:   "timeline <path|hash>",
+		Short: "Show the stored revision history of a path or content hash",
+		Long: `Renders every stored revision of a file path (or of a BLAKE3 content hash)
+in the order they were indexed: when it was first seen, size and content
+changes, deletions, and moves, found by following its content to paths on
+the same host that were deleted when it appeared.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			target := args[0]
+			selector := map[string]string{"blake3": target}
+			if !hashPattern.MatchString(target) {
+				absPath, err := filepath.Abs(target)
+				if err != nil {
+					color.Red("failed to resolve %s: %v", target, err)
+					os.Exit(1)
+				}
+				if canonical, err := fileprocessor.CanonicalizePath(absPath); err == nil {
+					absPath = canonical
+				}
+				target = absPath
+				selector = map[string]string{"filePath": target}
+			}
+
+			metas, err := ps.Find(selector)
+			if err == nil && len(metas) > 0 {
+				metas, err = relatedRevisions(ps, metas)
+			}
+			if err != nil {
+				color.Red("failed to read metadata: %v", err)
+				os.Exit(1)
+			}
+			if len(metas) == 0 {
+				color.Yellow("No stored revisions for %s", target)
+				return
+			}
+
+			timeline := buildTimeline(metas)
+			color.Cyan("Timeline for %s (%d revisions)", target, len(timeline))
+			for _, t := range timeline {
+				fmt.Printf("%-25s  %-12s  %-10s  %-12s  %s\n",
+					t.Indexed.Format(time.RFC3339),
+					shortID(t.Meta.HostID),
+					utils.FormatBytes(t.Meta.Size),
+					shortID(t.Meta.BLAKE3),
+					t.Meta.FilePath,
+				)
+				for _, e := range t.Events {
+					color.Magenta("    • %s", e)
+				}
+			}
+		},
+	}
+	rootCmd.AddCommand(timelineCmd)
+}
@@ -0,0 +1,19 @@
+//go:build darwin
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// openWithDefaultApp opens path with the default application.
+func openWithDefaultApp(path string) error {
+	return exec.Command("open", path).Start()
+}
+
+// registerURIHandler is not supported: macOS only dispatches URI schemes to
+// application bundles that declare them in their Info.plist.
+func registerURIHandler(exe string) error {
+	return errors.New("macOS only routes URI schemes to application bundles; wrap 'indexer open' in an app (e.g. with Automator) that declares the dreamfs scheme")
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+const uriDesktopFile = "dreamfs-handler.desktop"
+
+// openWithDefaultApp opens path with the desktop's default application.
+func openWithDefaultApp(path string) error {
+	return exec.Command("xdg-open", path).Start()
+}
+
+// registerURIHandler installs a desktop entry that runs "exe open <uri>" and
+// makes it the default handler for dreamfs:// links.
+func registerURIHandler(exe string) error {
+	dir := filepath.Join(utils.XDGDataHome(), "applications")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	entry := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=DreamFS Link Handler
+Exec="%s" open %%u
+NoDisplay=true
+MimeType=x-scheme-handler/dreamfs;
+`, exe)
+	if err := os.WriteFile(filepath.Join(dir, uriDesktopFile), []byte(entry), 0644); err != nil {
+		return err
+	}
+	if out, err := exec.Command("xdg-mime", "default", uriDesktopFile, "x-scheme-handler/dreamfs").CombinedOutput(); err != nil {
+		return fmt.Errorf("xdg-mime: %v: %s", err, out)
+	}
+	return nil
+}
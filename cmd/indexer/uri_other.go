@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// openWithDefaultApp opens path with the desktop's default application.
+func openWithDefaultApp(path string) error {
+	return exec.Command("xdg-open", path).Start()
+}
+
+func registerURIHandler(exe string) error {
+	return errors.New("registering URI handlers is not supported on this platform")
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// openWithDefaultApp opens path with its associated application.
+func openWithDefaultApp(path string) error {
+	return exec.Command("rundll32", "url.dll,FileProtocolHandler", path).Start()
+}
+
+// registerURIHandler registers "exe open <uri>" as the handler for dreamfs://
+// links for the current user.
+func registerURIHandler(exe string) error {
+	key := `HKCU\Software\Classes\dreamfs`
+	commands := [][]string{
+		{"add", key, "/ve", "/d", "URL:dreamfs Protocol", "/f"},
+		{"add", key, "/v", "URL Protocol", "/d", "", "/f"},
+		{"add", key + `\shell\open\command`, "/ve", "/d", fmt.Sprintf(`"%s" open "%%1"`, exe), "/f"},
+	}
+	for _, args := range commands {
+		if out, err := exec.Command("reg", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("reg %s: %v: %s", args[1], err, out)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// volumeStatus is a known volume with whether it is mounted now, and the
+// records of files on it.
+type volumeStatus struct {
+	storage.Volume
+	Online   bool   `json:"online"`
+	OnlineAt string `json:"onlineAt,omitempty"` // Mountpoint now, when online
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+func init() {
+	volumesCmd := &cobra.Command{
+		Use:   "volumes",
+		Short: "Track the volumes scanned on this host, such as removable drives",
+		Long: `Volumes are filesystems known by their UUID (the volume serial number on
+Windows), recorded when 'indexer index' scans a path on one. A drive is
+recognized when it is attached again, even at another mountpoint, and the
+records of its files carry its ID in the "volume" field, so a drive's
+catalog can be listed while it is offline:
+
+  indexer query 'volume = "<id>"'
+
+
+On Linux, volumes are identified through the links udev keeps in
+/dev/disk; filesystems without a UUID, such as network shares, are not
+tracked.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the known volumes, when each was last scanned, and whether it is online",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			all, _ := cmd.Flags().GetBool("all")
+			if format != "text" && format != "json" {
+				color.Red("unknown volume list format: %s", format)
+				os.Exit(1)
+			}
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			vols, err := ps.Volumes()
+			if err != nil {
+				color.Red("failed to read volumes: %v", err)
+				os.Exit(1)
+			}
+			online, err := fileprocessor.OnlineVolumes()
+			if err != nil {
+				color.Red("failed to list mounted volumes: %v", err)
+				os.Exit(1)
+			}
+			latest, err := ps.Latest()
+			if err != nil {
+				color.Red("failed to read metadata: %v", err)
+				os.Exit(1)
+			}
+			statuses := map[string]*volumeStatus{}
+			for _, v := range vols {
+				statuses[v.ID] = &volumeStatus{Volume: v}
+			}
+			for id, info := range online {
+				st, ok := statuses[id]
+				if !ok {
+					if !all {
+						continue
+					}
+					st = &volumeStatus{Volume: storage.Volume{ID: id, Label: info.Label, FSType: info.FSType, Device: info.Device, Mountpoint: info.Mountpoint, Removable: info.Removable}}
+					statuses[id] = st
+				}
+				st.Online, st.OnlineAt = true, info.Mountpoint
+			}
+			for _, meta := range latest {
+				if id, _ := meta.Extra[metadata.VolumeField].(string); statuses[id] != nil {
+					statuses[id].Files++
+					statuses[id].Bytes += meta.Size
+				}
+			}
+			list := make([]volumeStatus, 0, len(statuses))
+			for _, st := range statuses {
+				list = append(list, *st)
+			}
+			// Most recently scanned first; never-scanned volumes last
+			sort.Slice(list, func(i, j int) bool {
+				if !list[i].LastScanned.Equal(list[j].LastScanned) {
+					return list[i].LastScanned.After(list[j].LastScanned)
+				}
+				return list[i].ID < list[j].ID
+			})
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(list); err != nil {
+					color.Red("failed to encode JSON: %v", err)
+					os.Exit(1)
+				}
+				return
+			}
+			printVolumes(list)
+		},
+	}
+	listCmd.Flags().Bool("all", false, "Also list mounted volumes that have never been scanned")
+	listCmd.Flags().String("format", "text", "Output format: text or json")
+	volumesCmd.AddCommand(listCmd)
+
+	rootCmd.AddCommand(volumesCmd)
+}
+
+func printVolumes(list []volumeStatus) {
+	fmt.Printf("%-36s  %-16s  %-6s  %-9s  %-19s  %-8s  %-10s  %s\n", "VOLUME", "LABEL", "FS", "REMOVABLE", "LAST SCANNED", "FILES", "SIZE", "STATUS")
+	for _, v := range list {
+		removable := "no"
+		if v.Removable {
+			removable = "yes"
+		}
+		scanned := "never"
+		if !v.LastScanned.IsZero() {
+			scanned = v.LastScanned.Local().Format(time.DateTime)
+		}
+		status := color.RedString("offline, last at %s", v.Mountpoint)
+		if v.Online {
+			status = color.GreenString("online at %s", v.OnlineAt)
+		}
+		fmt.Printf("%-36s  %-16.16s  %-6s  %-9s  %-19s  %-8d  %-10s  %s\n", v.ID, v.Label, v.FSType, removable, scanned, v.Files, utils.FormatBytes(v.Bytes), status)
+	}
+}
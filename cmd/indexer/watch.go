@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/memberlist"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/config"
+	"gnomatix/dreamfs/v2/pkg/fileprocessor"
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+func init() {
+	watchCmd := &cobra.Command{
+		Use:   "watch [directory]",
+		Short: "Keep the index of a directory current as files change",
+		Long: `Watches a directory tree and indexes files as they are created, modified
+or renamed into it, without re-scanning. Deleted files (and the old names of
+renamed ones) are recorded as tombstones, so reports stop listing them while
+their history is kept for 'indexer timeline'.
+
+Updates are batched into the store and, with --swarm, broadcast to peers.
+Files deleted while nothing was watching are only noticed with --scan, which
+indexes the whole tree once before watching. Indexing options (skip-git,
+hashMode, git-info...) are read from the config file.
+
+Unless --control-addr is empty, 'indexer touch-priority' can ask the watcher
+to re-verify a path ahead of its scan and pending events.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			debounce, _ := cmd.Flags().GetDuration("debounce")
+			scan, _ := cmd.Flags().GetBool("scan")
+
+			ps, err := openStore(viper.GetString("dbpath"))
+			if err != nil {
+				color.Red("failed to open persistent store: %v", err)
+				os.Exit(1)
+			}
+			defer ps.Close()
+
+			var ml *memberlist.Memberlist
+			if viper.GetBool("swarm") {
+				ml, swarmDelegate, err = network.StartSwarm(ps) // Assign to global swarmDelegate
+				if err != nil {
+					color.Red("failed to start swarm: %v", err)
+					os.Exit(1)
+				}
+				defer ml.Shutdown()
+				fileprocessor.SetSwarmDelegate(swarmDelegate)
+			}
+
+			cw := storage.NewCacheWriter(ps, config.DefaultBatchSize, config.DefaultSyncInterval)
+			defer cw.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				cancel()
+			}()
+
+			q := fileprocessor.NewPriorityQueue()
+			if addr := viper.GetString("controlAddr"); addr != "" {
+				go serveControl(addr, q)
+			}
+
+			opts := fileprocessor.WatchOptions{Debounce: debounce, Scan: scan, Priority: q}
+			if err := fileprocessor.WatchDirectory(ctx, dir, ps, cw, opts); err != nil {
+				color.Red("watch %s: %v", dir, err)
+				os.Exit(1)
+			}
+		},
+	}
+	watchCmd.Flags().Duration("debounce", 500*time.Millisecond, "Wait until a file has been quiet this long before re-indexing it")
+	watchCmd.Flags().Bool("scan", false, "Index the whole tree once before watching")
+	rootCmd.AddCommand(watchCmd)
+}
@@ -158,152 +158,187 @@ Enforces branch protection and manual review.`,
 			return
 		}
 
-		// 4. Processing
-		for _, item := range selected {
-			fmt.Println(strings.Repeat("=", 60))
-			fmt.Printf("Adding: %s\n", styleNew.Render(item.RelPath))
-
-			// Double check existence (Race condition)
-			if _, err := os.Stat(filepath.Join(cfg.WikiDir, item.WikiPath)); err == nil {
-				fmt.Println(styleErr.Render("⛔ ERROR: File already exists in wiki! Use 'wiki-sync push'."))
-				continue
-			}
+		addItems(cfg, selected)
+	},
+}
+
+// addItems reviews each selected new page (offering template frontmatter and
+// validating it against the schema) in $EDITOR, writes the confirmed ones to
+// the wiki clone and commits per --commit/--push.
+func addItems(cfg Config, selected []FileItem) {
+	var written []FileItem
+	for _, item := range selected {
+		fmt.Println(strings.Repeat("=", 60))
+		fmt.Printf("Adding: %s\n", styleNew.Render(item.RelPath))
+		if item.WikiPath == "" {
+			item.WikiPath = ToWikiPath(item.RelPath, WikiPrefixBase)
+		}
+
+		// Double check existence (Race condition)
+		if _, err := os.Stat(filepath.Join(cfg.WikiDir, item.WikiPath)); err == nil {
+			fmt.Println(styleErr.Render("⛔ ERROR: File already exists in wiki! Use 'wiki-sync push'."))
+			continue
+		}
 
-			localContent := item.LocalContent
+		localContent := item.LocalContent
 
-			// Check for Missing or Invalid Frontmatter
-			_, hasFM := parseFrontmatter(localContent)
+		// Check for Missing, Partial or Invalid Frontmatter
+		_, hasFM := parseFrontmatter(localContent)
+		tName, tContent := FindInheritedTemplate(item.RelPath, cfg.WikiDir)
+		var missingKeys []string
+		if hasFM && tName != "" {
+			missingKeys = missingTemplateKeys(tContent, localContent)
+		}
+		if !hasFM || len(missingKeys) > 0 {
 			if !hasFM {
 				fmt.Println(styleInfo.Render("⚠️  Missing or invalid YAML frontmatter detected."))
+			} else {
+				fmt.Println(styleInfo.Render("⚠️  Frontmatter is missing template keys: " + strings.Join(missingKeys, ", ")))
+			}
 
-				confirmInject := false
-
-				// Try inherited template
-				tName, tContent := FindInheritedTemplate(item.RelPath, cfg.WikiDir)
-				if tName != "" {
-					fmt.Printf(styleInfo.Render("Found inherited template: %s")+"\n", tName)
-					huh.NewConfirm().
-						Title("Inject inherited template?").
-						Value(&confirmInject).
-						Run()
-					if confirmInject {
-						localContent = tContent + "\n" + localContent
-					}
-				} else {
-					huh.NewConfirm().
-						Title("Inject frontmatter from template?").
-						Value(&confirmInject).
-						Run()
-
-					if confirmInject {
-						// Load Templates
-						templates, _ := LoadTemplates(cfg.WikiDir)
-						var selectedTemplate string
-
-						if len(templates) > 0 {
-							var options []huh.Option[string]
-							for _, t := range templates {
-								options = append(options, huh.NewOption(t.Name, t.Name))
-							}
+			confirmInject := false
+
+			// Try inherited template
+			if tName != "" {
+				fmt.Printf(styleInfo.Render("Found inherited template: %s")+"\n", tName)
+				huh.NewConfirm().
+					Title("Inject inherited template?").
+					Value(&confirmInject).
+					Run()
+				if confirmInject {
+					localContent = injectTemplate(tContent, localContent)
+				}
+			} else {
+				huh.NewConfirm().
+					Title("Inject frontmatter from template?").
+					Value(&confirmInject).
+					Run()
+
+				if confirmInject {
+					// Load Templates
+					templates, _ := LoadTemplates(cfg.WikiDir)
+					var selectedTemplate string
 
-							huh.NewSelect[string]().
-								Title("Select template").
-								Options(options...).
-								Value(&selectedTemplate).
-								Run()
+					if len(templates) > 0 {
+						var options []huh.Option[string]
+						for _, t := range templates {
+							options = append(options, huh.NewOption(t.Name, t.Name))
 						}
 
-						var itemsToInject string
-						if selectedTemplate != "" {
-							for _, t := range templates {
-								if t.Name == selectedTemplate {
-									itemsToInject = t.Content
-									break
-								}
+						huh.NewSelect[string]().
+							Title("Select template").
+							Options(options...).
+							Value(&selectedTemplate).
+							Run()
+					}
+
+					var itemsToInject string
+					if selectedTemplate != "" {
+						for _, t := range templates {
+							if t.Name == selectedTemplate {
+								itemsToInject = t.Content
+								break
 							}
-						} else {
-							// Generic default
-							itemsToInject = "---\ntitle: " + filepath.Base(item.RelPath) + "\n---\n\n"
 						}
-
-						// Prepend
-						localContent = itemsToInject + "\n" + localContent
+					} else {
+						// Generic default
+						itemsToInject = "---\ntitle: " + filepath.Base(item.RelPath) + "\n---\n\n"
 					}
+
+					localContent = injectTemplate(itemsToInject, localContent)
 				}
 			}
+		}
 
-			// Validation
-			schemaPath := filepath.Join(cfg.WikiDir, ".schemas", "frontmatter.yaml")
-			// Fallback to json if yaml not found? Or config?
-			// For now, let's try both or just check existence.
-			if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
-				schemaPath = filepath.Join(cfg.WikiDir, ".schemas", "frontmatter.json")
-			}
+		// Validation
+		schemaPath := FrontmatterSchemaPath(cfg.WikiDir)
+		if err := ValidateFrontmatter(localContent, schemaPath); err != nil {
+			printFatal("Schema Validation Failed", err, "Correct the frontmatter to match the schema defined in .schemas/frontmatter.yaml")
+		}
 
-			if err := ValidateFrontmatter(localContent, schemaPath); err != nil {
-				printFatal("Schema Validation Failed", err, "Correct the frontmatter to match the schema defined in .schemas/frontmatter.yaml")
-			}
+		// B. Editor Review
+		tmpFile, err := os.CreateTemp("", "wiki-add-*.md")
+		if err != nil {
+			fmt.Println(styleErr.Render("Temp file error: " + err.Error()))
+			continue
+		}
+		tmpPath := tmpFile.Name()
+		if err := os.WriteFile(tmpPath, []byte(localContent), 0644); err != nil {
+			fmt.Println(styleErr.Render("Error writing temp file: " + err.Error()))
+			continue
+		}
+		tmpFile.Close()
 
-			// B. Editor Review
-			tmpFile, err := os.CreateTemp("", "wiki-add-*.md")
-			if err != nil {
-				fmt.Println(styleErr.Render("Temp file error: " + err.Error()))
-				continue
-			}
-			tmpPath := tmpFile.Name()
-			if err := os.WriteFile(tmpPath, []byte(localContent), 0644); err != nil {
-				fmt.Println(styleErr.Render("Error writing temp file: " + err.Error()))
-				continue
-			}
-			tmpFile.Close()
-
-			fmt.Println(styleInfo.Render("Launching $EDITOR..."))
-			editor := os.Getenv("EDITOR")
-
-			cmd := exec.Command(editor, tmpPath)
-			cmd.Stdin = os.Stdin
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
-				fmt.Println(styleErr.Render("Editor failed: " + err.Error()))
-				os.Remove(tmpPath)
-				continue
-			}
+		fmt.Println(styleInfo.Render("Launching $EDITOR..."))
+		editor := os.Getenv("EDITOR")
 
-			editedBytes, _ := os.ReadFile(tmpPath)
-			editedContent := string(editedBytes)
+		cmd := exec.Command(editor, tmpPath)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Println(styleErr.Render("Editor failed: " + err.Error()))
 			os.Remove(tmpPath)
+			continue
+		}
 
-			// C. Confirm
-			confirm := false
-			err = huh.NewConfirm().
-				Title(fmt.Sprintf("Add %s to wiki?", item.RelPath)).
-				Value(&confirm).
-				Run()
+		editedContent, _ := readText(tmpPath)
+		os.Remove(tmpPath)
 
-			if err != nil || !confirm {
-				fmt.Println("Skipped.")
-				continue
-			}
+		if !checkLint(cfg, item.RelPath, editedContent) {
+			fmt.Println("Skipped.")
+			continue
+		}
 
-			// D. Write
-			destPath := filepath.Join(cfg.WikiDir, item.WikiPath)
-			if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-				fmt.Println(styleErr.Render("Mkdir failed: " + err.Error()))
-				continue
-			}
+		// C. Confirm
+		confirm := false
+		err = huh.NewConfirm().
+			Title(fmt.Sprintf("Add %s to wiki?", item.RelPath)).
+			Value(&confirm).
+			Run()
 
-			if err := os.WriteFile(destPath, []byte(editedContent), 0644); err != nil {
-				fmt.Println(styleErr.Render("Write failed: " + err.Error()))
-			} else {
-				fmt.Println(styleSuccess.Render("✓ Added"))
-				// Note: We do NOT update state.go here because we don't have a revision/commit yet.
-				// The next 'pull' will capture the state after the user commits and pushes the wiki repo.
-			}
+		if err != nil || !confirm {
+			fmt.Println("Skipped.")
+			continue
 		}
-	},
+
+		// D. Write
+		editedContent, item.Assets = linksToWiki(cfg, item.RelPath, editedContent, true)
+		if len(item.Assets) > 0 {
+			fmt.Println(styleInfo.Render(fmt.Sprintf("Synced %d asset file(s)", len(item.Assets))))
+		}
+		destPath := filepath.Join(cfg.WikiDir, item.WikiPath)
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			fmt.Println(styleErr.Render("Mkdir failed: " + err.Error()))
+			continue
+		}
+
+		if err := writeText(destPath, editedContent); err != nil {
+			fmt.Println(styleErr.Render("Write failed: " + err.Error()))
+		} else {
+			fmt.Println(styleSuccess.Render("✓ Added"))
+			// State is only updated once a revision exists, i.e. with --commit.
+			// Otherwise the next 'pull' captures it after the wiki repo is committed.
+			written = append(written, item)
+		}
+	}
+
+	commitWritten(cfg, "add", written)
+}
+
+// injectTemplate merges a template's frontmatter into content, leaving the
+// content unchanged (with a warning) if the two cannot be merged.
+func injectTemplate(tmpl, content string) string {
+	merged, err := MergeTemplateFrontmatter(tmpl, content)
+	if err != nil {
+		fmt.Println(styleErr.Render("Cannot merge template frontmatter: " + err.Error()))
+		return content
+	}
+	return merged
 }
 
 func init() {
+	addCommitFlags(addCmd)
+	addTargetFlag(addCmd)
 	rootCmd.AddCommand(addCmd)
 }
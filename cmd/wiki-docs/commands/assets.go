@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const AssetPrefixBase = "src_assets~"
+
+// assetManifestPath records, inside the wiki clone, which repo file each
+// flattened asset came from. Flattening is lossy ("-" becomes "_"), so the
+// manifest is what lets pull put assets back where they belong.
+const assetManifestPath = ".wiki-docs/assets.json"
+
+type assetManifest map[string]string // Wiki filename -> repo-relative path
+
+func loadAssetManifest(wikiDir string) assetManifest {
+	m := assetManifest{}
+	data, err := os.ReadFile(filepath.Join(wikiDir, assetManifestPath))
+	if err == nil {
+		_ = json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+func (m assetManifest) save(wikiDir string) error {
+	p := filepath.Join(wikiDir, assetManifestPath)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// resolveRepoLink resolves a link target found in the page at relPage to a
+// repo-relative path, or "" if it escapes the repo.
+func resolveRepoLink(relPage, target string) string {
+	target = strings.ReplaceAll(target, "%20", " ")
+	p := path.Clean(path.Join(path.Dir(relPage), target))
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return ""
+	}
+	return p
+}
+
+// relativeRepoLink returns the link from the page at relPage to the
+// repo-relative path target.
+func relativeRepoLink(relPage, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(relPage)), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), " ", "%20")
+}
+
+// isAssetLink reports whether a resolved link target is a non-page file.
+func isAssetLink(p string) bool {
+	return p != "" && !strings.EqualFold(path.Ext(p), ".md") && path.Ext(p) != ""
+}
+
+// assetsToWiki rewrites links to local assets in a page being written to the
+// wiki so they point at flattened copies. When copyFiles is set, the assets
+// are copied into the wiki clone and the manifest is updated; the returned
+// list holds the wiki filenames written (for staging).
+func assetsToWiki(cfg Config, relPage, content string, copyFiles bool) (string, []string) {
+	var manifest assetManifest
+	if copyFiles {
+		manifest = loadAssetManifest(cfg.WikiDir)
+	}
+	var written []string
+	seen := map[string]bool{}
+	out := rewriteLinks(content, func(target string) (string, bool) {
+		repoPath := resolveRepoLink(relPage, target)
+		if !isAssetLink(repoPath) {
+			return "", false
+		}
+		src := filepath.Join(cfg.RepoRoot, filepath.FromSlash(repoPath))
+		if info, err := os.Stat(src); err != nil || info.IsDir() {
+			return "", false
+		}
+		wikiName := ToWikiPath(repoPath, AssetPrefixBase)
+		if copyFiles {
+			if err := copyIfChanged(src, filepath.Join(cfg.WikiDir, wikiName)); err != nil {
+				return "", false
+			}
+			manifest[wikiName] = repoPath
+			if !seen[wikiName] {
+				seen[wikiName] = true
+				written = append(written, wikiName)
+			}
+		}
+		return wikiName, true
+	})
+	if copyFiles && len(written) > 0 {
+		if err := manifest.save(cfg.WikiDir); err == nil {
+			written = append(written, assetManifestPath)
+		}
+	}
+	return out, written
+}
+
+// assetsFromWiki is the reverse of assetsToWiki: links to flattened wiki
+// assets are pointed back at their repo paths, copying the files into the
+// repo when copyFiles is set.
+func assetsFromWiki(cfg Config, relPage, content string, copyFiles bool) string {
+	manifest := loadAssetManifest(cfg.WikiDir)
+	return rewriteLinks(content, func(target string) (string, bool) {
+		if strings.Contains(target, "/") || !strings.HasPrefix(target, AssetPrefixBase) {
+			return "", false
+		}
+		repoPath, ok := manifest[target]
+		if !ok {
+			// Best effort for assets added to the wiki by hand.
+			repoPath = strings.ReplaceAll(strings.TrimPrefix(target, AssetPrefixBase), "~", "/")
+		}
+		// The manifest and the wiki are edited remotely: keep the copy
+		// inside the repo.
+		repoPath = path.Clean(repoPath)
+		if path.IsAbs(repoPath) || filepath.IsAbs(filepath.FromSlash(repoPath)) || filepath.VolumeName(filepath.FromSlash(repoPath)) != "" ||
+			repoPath == "." || repoPath == ".." || strings.HasPrefix(repoPath, "../") {
+			return "", false
+		}
+		if copyFiles && cfg.WikiDir != "" {
+			src := filepath.Join(cfg.WikiDir, target)
+			dst := filepath.Join(cfg.RepoRoot, filepath.FromSlash(repoPath))
+			if err := copyIfChanged(src, dst); err != nil {
+				return "", false
+			}
+		}
+		return relativeRepoLink(relPage, repoPath), true
+	})
+}
+
+// copyIfChanged copies src to dst unless dst already has the same content.
+func copyIfChanged(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(dst); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
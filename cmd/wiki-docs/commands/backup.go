@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupRunStamp names the backup directory of the current run, so every
+// file overwritten by one pull lands in the same place.
+var backupRunStamp = time.Now().Format("20060102-150405")
+
+// GetBackupDir returns the directory that local files are saved to before
+// pull overwrites them, next to state.json and ignored by git.
+func GetBackupDir(repoRoot string) string {
+	return filepath.Join(repoRoot, ".config", "wiki-docs", "backups")
+}
+
+// backupLocal copies a local file that is about to be overwritten with
+// different content into a timestamped backup directory, keeping its
+// repo-relative path. It returns the backup path, or "" if no backup was
+// needed (the file is missing or unchanged).
+func backupLocal(cfg Config, relPath, newContent string) (string, error) {
+	src := filepath.Join(cfg.RepoRoot, filepath.FromSlash(relPath))
+	old, err := os.ReadFile(src)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if string(old) == newContent {
+		return "", nil
+	}
+
+	root := GetBackupDir(cfg.RepoRoot)
+	dest := filepath.Join(root, backupRunStamp, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	if err := ensureIgnored(filepath.Dir(root), "backups/"); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dest, old, 0644); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
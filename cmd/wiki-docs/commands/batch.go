@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+)
+
+// batchAction is a push, pull, add or promote over several rows of the list
+// TUI, run in-process after one combined confirmation.
+type batchAction struct {
+	Name    string // "push", "pull", "add" or "promote"
+	Items   []FileItem
+	Skipped int // Selected rows the action does not apply to
+}
+
+// batchDoneMsg tells the list TUI a batch finished, so it rescans.
+type batchDoneMsg struct{ err error }
+
+// batchEligible reports whether an action applies to an item, mirroring the
+// filters of the corresponding command.
+func batchEligible(action string, item FileItem) bool {
+	switch action {
+	case "push":
+		return item.LocalPath != "" && (item.Status == "Changed" || item.Status == "Same" || item.Status == "Legacy")
+	case "pull":
+		return item.LocalPath != "" && item.WikiPath != "" && item.Status != "Same"
+	case "add":
+		return item.LocalPath != "" && item.Status == "Untracked"
+	case "promote":
+		return item.LocalPath != ""
+	}
+	return false
+}
+
+// newBatch collects the marked rows (or the cursor row when none are
+// marked) that the action applies to.
+func (m *listModel) newBatch(name string) batchAction {
+	var rows []FileItem
+	if len(m.marked) > 0 {
+		for _, item := range m.allItems {
+			if m.marked[item.RelPath] {
+				rows = append(rows, item)
+			}
+		}
+	} else if idx := m.table.Cursor(); idx >= 0 && idx < len(m.visibleItems) {
+		rows = append(rows, m.visibleItems[idx])
+	}
+
+	action := batchAction{Name: name}
+	for _, item := range rows {
+		if batchEligible(name, item) {
+			action.Items = append(action.Items, item)
+		} else {
+			action.Skipped++
+		}
+	}
+	return action
+}
+
+// batchExec runs a batch while the TUI has released the terminal. It
+// implements tea.ExecCommand; the package's commands print to os.Stdout, so
+// the supplied streams are not used.
+type batchExec struct {
+	cfg    Config
+	action batchAction
+}
+
+func (b *batchExec) SetStdin(io.Reader)  {}
+func (b *batchExec) SetStdout(io.Writer) {}
+func (b *batchExec) SetStderr(io.Writer) {}
+
+func (b *batchExec) Run() error {
+	defer waitForKey()
+	fmt.Println(styleInfo.Render(fmt.Sprintf("%s: %d file(s)", strings.ToUpper(b.action.Name), len(b.action.Items))))
+
+	switch b.action.Name {
+	case "push":
+		pushItems(b.cfg, b.action.Items)
+	case "pull":
+		pullItems(b.cfg, b.action.Items, false)
+	case "add":
+		addItems(b.cfg, b.action.Items)
+	case "promote":
+		var version string
+		if err := huh.NewInput().
+			Title("Version to add to approved_versions").
+			Value(&version).
+			Run(); err != nil || strings.TrimSpace(version) == "" {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+		pending := pendingPromotions(b.action.Items, strings.TrimSpace(version))
+		if len(pending) == 0 {
+			fmt.Println(styleSuccess.Render("All selected files are already approved for " + version))
+			return nil
+		}
+		if failed := writePromotions(pending); failed > 0 {
+			return fmt.Errorf("%d file(s) could not be written", failed)
+		}
+	}
+	return nil
+}
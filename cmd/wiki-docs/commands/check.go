@@ -34,13 +34,20 @@ var checkCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		fmt.Println(styleInfo.Render("Scanning workspace..."))
+		format, _ := cmd.Flags().GetString("format")
+		if check, _ := cmd.Flags().GetBool("check"); format == "text" && !check {
+			fmt.Println(styleInfo.Render("Scanning workspace..."))
+		}
 		items, err := ScanAll(cfg)
 		if err != nil {
 			fmt.Println(styleErr.Render("Scan failed: " + err.Error()))
 			os.Exit(1)
 		}
 
+		if emitNonInteractive(cmd, items) {
+			return
+		}
+
 		// Main Loop
 		for {
 			// Build List for Selection
@@ -131,6 +138,10 @@ func handleSelection(cfg Config, item FileItem) {
 		actions = append(actions, huh.NewOption("View Diff", "diff"))
 		actions = append(actions, huh.NewOption("Force Pull (Overwrite Local)", "pull_force"))
 		actions = append(actions, huh.NewOption("Force Push (Overwrite Wiki)", "push_force"))
+	case "Changed", "Legacy":
+		actions = append(actions, huh.NewOption("View Diff", "diff"))
+		actions = append(actions, huh.NewOption("Push to Wiki", "push"))
+		actions = append(actions, huh.NewOption("Pull from Wiki", "pull"))
 	case "Synced":
 		actions = append(actions, huh.NewOption("View Wiki Content", "view_wiki"))
 		// Version Promote
@@ -141,6 +152,9 @@ func handleSelection(cfg Config, item FileItem) {
 		actions = append(actions, huh.NewOption("Import to Docs", "pull"))
 	}
 
+	if item.WikiPath != "" {
+		actions = append(actions, huh.NewOption("View Wiki History", "history"))
+	}
 	actions = append(actions, huh.NewOption("Cancel", "cancel"))
 
 	var action string
@@ -157,9 +171,10 @@ func handleSelection(cfg Config, item FileItem) {
 		fmt.Println(lipgloss.NewStyle().Foreground(lipgloss.Color("250")).Render(item.LocalContent))
 		waitForKey()
 	case "diff":
-		// Show diff
-		fmt.Println("Diff not implemented yet in dashboard view.")
+		fmt.Println(RenderDiff("wiki/"+item.WikiPath, item.RelPath, item.WikiContent, item.LocalContent, diffStyle))
 		waitForKey()
+	case "history":
+		showHistory(cfg, item)
 	case "add":
 		fmt.Println("Triggering Add...")
 		fmt.Printf("Run: wiki-sync add %s\n", item.LocalPath)
@@ -172,12 +187,16 @@ func handleSelection(cfg Config, item FileItem) {
 		fmt.Println("Triggering Pull...")
 		fmt.Printf("Run: wiki-sync pull %s\n", item.RelPath)
 		waitForKey()
+	case "pull_force":
+		fmt.Println("Triggering Force Pull (local edits are backed up)...")
+		fmt.Printf("Run: wiki-sync pull --force %s\n", item.RelPath)
+		waitForKey()
 	case "promote":
 		promoted, err := addVersion(item.LocalContent, checkTargetVersion)
 		if err != nil {
 			fmt.Println(styleErr.Render("Failed to promote: " + err.Error()))
 		} else {
-			if err := os.WriteFile(item.LocalPath, []byte(promoted), 0644); err != nil {
+			if err := writeText(item.LocalPath, promoted); err != nil {
 				fmt.Println(styleErr.Render("Failed to write file: " + err.Error()))
 			} else {
 				fmt.Println(styleSuccess.Render("Promoted to " + checkTargetVersion))
@@ -256,5 +275,6 @@ func waitForKey() {
 
 func init() {
 	checkCmd.Flags().StringVar(&checkTargetVersion, "target-version", "", "Highlight files missing this version")
+	addOutputFlags(checkCmd)
 	rootCmd.AddCommand(checkCmd)
 }
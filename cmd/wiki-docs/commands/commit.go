@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultCommitTemplate is the message used by --commit when -m is not given.
+const DefaultCommitTemplate = `docs: {{.Command}} {{len .Files}} page(s) from {{.SourceShort}}
+
+{{range .Files}}- {{.}}
+{{end}}`
+
+var (
+	wikiCommit     bool
+	wikiCommitMsg  string
+	wikiCommitPush bool
+)
+
+// CommitData is the data available to the --message template.
+type CommitData struct {
+	Command     string   // "add", "push", "watch" or "propose"
+	Files       []string // Repo-relative paths of the pages written
+	WikiFiles   []string // Flattened wiki filenames
+	SourceSHA   string   // HEAD of the source repository
+	SourceShort string   // Abbreviated SourceSHA
+}
+
+func addCommitFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&wikiCommit, "commit", false, "Stage and commit the written wiki pages")
+	cmd.Flags().StringVarP(&wikiCommitMsg, "message", "m", DefaultCommitTemplate, "Commit message template (Go text/template; fields: .Command .Files .WikiFiles .SourceSHA .SourceShort)")
+	cmd.Flags().BoolVar(&wikiCommitPush, "push", false, "Push the wiki branch after committing (implies --commit)")
+}
+
+// commitWritten commits the pages written by add/push (plus any extra wiki
+// files, such as a regenerated sidebar) when --commit or --push is set,
+// optionally pushes the branch, and records the new wiki revision of each
+// page in state.json.
+func commitWritten(cfg Config, command string, written []FileItem, extraFiles ...string) {
+	if (!wikiCommit && !wikiCommitPush) || len(written) == 0 {
+		return
+	}
+	if err := commitPages(cfg, command, written, extraFiles...); err != nil {
+		fmt.Println(styleErr.Render(err.Error()))
+		return
+	}
+
+	if wikiCommitPush {
+		refspec := "HEAD"
+		if cfg.Branch != "" {
+			refspec = "HEAD:" + cfg.Branch
+		}
+		if err := runGit("-C", cfg.WikiDir, "push", "origin", refspec); err != nil {
+			fmt.Println(styleErr.Render("git push failed: " + err.Error()))
+		} else {
+			fmt.Println(styleSuccess.Render("✓ Pushed wiki branch"))
+		}
+	}
+
+	recordRevisions(cfg, written)
+}
+
+// commitPages stages the written pages, their assets and extraFiles in the
+// wiki clone and commits them with the --message template.
+func commitPages(cfg Config, command string, written []FileItem, extraFiles ...string) error {
+	data := CommitData{Command: command, SourceShort: "working tree"}
+	for _, item := range written {
+		data.Files = append(data.Files, item.RelPath)
+		data.WikiFiles = append(data.WikiFiles, item.WikiPath)
+	}
+	staged := append([]string{}, data.WikiFiles...)
+	for _, item := range written {
+		staged = append(staged, item.Assets...)
+	}
+	staged = append(staged, extraFiles...)
+	if out, err := exec.Command("git", "-C", cfg.RepoRoot, "rev-parse", "HEAD").Output(); err == nil {
+		data.SourceSHA = strings.TrimSpace(string(out))
+		data.SourceShort = data.SourceSHA
+		if len(data.SourceShort) > 7 {
+			data.SourceShort = data.SourceShort[:7]
+		}
+	}
+
+	tmpl, err := template.New("commit").Parse(wikiCommitMsg)
+	if err != nil {
+		return fmt.Errorf("invalid commit message template: %w", err)
+	}
+	var msg bytes.Buffer
+	if err := tmpl.Execute(&msg, data); err != nil {
+		return fmt.Errorf("commit message template failed: %w", err)
+	}
+
+	addArgs := append([]string{"-C", cfg.WikiDir, "add", "--"}, staged...)
+	if err := runGit(addArgs...); err != nil {
+		return fmt.Errorf("git add failed: %w", err)
+	}
+	if err := runGit("-C", cfg.WikiDir, "commit", "-m", strings.TrimSpace(msg.String())); err != nil {
+		return fmt.Errorf("git commit failed: %w", err)
+	}
+	fmt.Println(styleSuccess.Render(fmt.Sprintf("✓ Committed %d page(s)", len(written))))
+	return nil
+}
+
+// recordRevisions stores the wiki revision and local checksum of each
+// written page in state.json.
+func recordRevisions(cfg Config, written []FileItem) {
+	state, err := LoadState()
+	if err != nil {
+		fmt.Printf("Warning: Failed to load state: %v\n", err)
+		return
+	}
+	for _, item := range written {
+		rev, err := getFileGitRevision(cfg.WikiDir, item.WikiPath)
+		if err != nil || rev == "" {
+			continue
+		}
+		state.Update(item.RelPath, rev, CalculateChecksum(stripFrontmatter(item.LocalContent)))
+	}
+	if err := state.Save(); err != nil {
+		fmt.Printf("Warning: Failed to save state: %v\n", err)
+	}
+}
+
+// runGit runs git with the given arguments, returning its combined output
+// as the error text on failure.
+func runGit(args ...string) error {
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/term"
+)
+
+// Diff styles
+var (
+	styleDiffAdd     = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))  // Green
+	styleDiffDel     = lipgloss.NewStyle().Foreground(lipgloss.Color("203")) // Red
+	styleDiffHunk    = lipgloss.NewStyle().Foreground(lipgloss.Color("39"))  // Blue
+	styleDiffSection = lipgloss.NewStyle().Foreground(lipgloss.Color("255")).Background(lipgloss.Color("238")).Bold(true).Padding(0, 1)
+	styleDiffDim     = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
+)
+
+const diffContext = 3
+
+var diffStyle string
+
+// splitFrontmatter separates a document into its raw frontmatter block
+// (without the --- fences) and the body that follows it.
+func splitFrontmatter(content string) (string, string) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if !strings.HasPrefix(content, "---\n") {
+		return "", content
+	}
+	end := strings.Index(content[4:], "\n---")
+	if end < 0 {
+		return "", content
+	}
+	fm := content[4 : 4+end]
+	body := strings.TrimPrefix(content[4+end+4:], "\n")
+	return fm, strings.TrimLeft(body, "\n")
+}
+
+// RenderDiff renders the difference between two versions of a page, with
+// frontmatter and body compared separately. style is "unified" or
+// "side-by-side".
+func RenderDiff(oldLabel, newLabel, oldContent, newContent, style string) string {
+	oldFM, oldBody := splitFrontmatter(oldContent)
+	newFM, newBody := splitFrontmatter(newContent)
+
+	var sb strings.Builder
+	sb.WriteString(styleDiffDel.Render("--- "+oldLabel) + "\n")
+	sb.WriteString(styleDiffAdd.Render("+++ "+newLabel) + "\n")
+
+	sections := []struct {
+		title    string
+		old, new string
+	}{
+		{"Frontmatter", oldFM, newFM},
+		{"Body", oldBody, newBody},
+	}
+	for _, s := range sections {
+		sb.WriteString("\n" + styleDiffSection.Render(s.title) + "\n")
+		if s.old == s.new {
+			sb.WriteString(styleDiffDim.Render("(no changes)") + "\n")
+			continue
+		}
+		a := splitDiffLines(s.old)
+		b := splitDiffLines(s.new)
+		if style == "side-by-side" {
+			sb.WriteString(renderSideBySide(a, b, terminalWidth()))
+		} else {
+			sb.WriteString(renderUnified(a, b))
+		}
+	}
+	return sb.String()
+}
+
+func splitDiffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func renderUnified(a, b []string) string {
+	var sb strings.Builder
+	m := difflib.NewMatcher(a, b)
+	for _, group := range m.GetGroupedOpCodes(diffContext) {
+		first, last := group[0], group[len(group)-1]
+		sb.WriteString(styleDiffHunk.Render(fmt.Sprintf("@@ -%d,%d +%d,%d @@", first.I1+1, last.I2-first.I1, first.J1+1, last.J2-first.J1)) + "\n")
+		for _, op := range group {
+			if op.Tag == 'e' {
+				for _, line := range a[op.I1:op.I2] {
+					sb.WriteString(" " + line + "\n")
+				}
+				continue
+			}
+			if op.Tag == 'r' || op.Tag == 'd' {
+				for _, line := range a[op.I1:op.I2] {
+					sb.WriteString(styleDiffDel.Render("-"+line) + "\n")
+				}
+			}
+			if op.Tag == 'r' || op.Tag == 'i' {
+				for _, line := range b[op.J1:op.J2] {
+					sb.WriteString(styleDiffAdd.Render("+"+line) + "\n")
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+func renderSideBySide(a, b []string, width int) string {
+	col := (width - 3) / 2
+	if col < 20 {
+		col = 20
+	}
+	cell := func(s string, st lipgloss.Style) string {
+		s = strings.ReplaceAll(s, "\t", "    ")
+		r := []rune(s)
+		if len(r) > col {
+			r = append(r[:col-1], '…')
+		}
+		return st.Render(string(r) + strings.Repeat(" ", col-len(r)))
+	}
+	plain := lipgloss.NewStyle()
+
+	var sb strings.Builder
+	m := difflib.NewMatcher(a, b)
+	for gi, group := range m.GetGroupedOpCodes(diffContext) {
+		if gi > 0 {
+			sb.WriteString(styleDiffHunk.Render(strings.Repeat("┄", col)+" ┊ "+strings.Repeat("┄", col)) + "\n")
+		}
+		for _, op := range group {
+			left := a[op.I1:op.I2]
+			right := b[op.J1:op.J2]
+			n := len(left)
+			if len(right) > n {
+				n = len(right)
+			}
+			for i := 0; i < n; i++ {
+				l, r := "", ""
+				ls, rs := plain, plain
+				if i < len(left) {
+					l = left[i]
+					if op.Tag != 'e' {
+						ls = styleDiffDel
+					}
+				}
+				if i < len(right) {
+					r = right[i]
+					if op.Tag != 'e' {
+						rs = styleDiffAdd
+					}
+				}
+				marker := " │ "
+				if op.Tag != 'e' {
+					marker = styleDiffHunk.Render(" ┃ ")
+				}
+				sb.WriteString(cell(l, ls) + marker + cell(r, rs) + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+func terminalWidth() int {
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	return 160
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&diffStyle, "diff-style", "unified", "Diff rendering: unified or side-by-side")
+}
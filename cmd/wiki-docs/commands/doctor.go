@@ -0,0 +1,262 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorTimeout time.Duration
+
+// doctorResult is the outcome of one doctor check.
+type doctorResult struct {
+	Name   string
+	Level  string // "ok", "warn" or "fail"
+	Detail string
+	Fixes  []string
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment, wiki clone and state for common problems",
+	Long: `Runs every precondition the other commands check one at a time and reports
+them together with suggested fixes: EDITOR, the wiki clone and its branch,
+reachability of the wiki remote, the frontmatter schema, consistency of
+state.json with the sources and the wiki, and pages still using legacy names.
+Exits with status 1 if any check fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var results []doctorResult
+		add := func(r doctorResult) {
+			results = append(results, r)
+			printDoctorResult(r)
+		}
+
+		if err := assertEditorSet(); err != nil {
+			add(doctorResult{Name: "Editor", Level: "fail", Detail: err.Error(),
+				Fixes: []string{"Set EDITOR in your profile, e.g. export EDITOR='code -w'"}})
+		} else {
+			add(doctorResult{Name: "Editor", Level: "ok", Detail: os.Getenv("EDITOR")})
+		}
+
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			add(doctorResult{Name: "Configuration", Level: "fail", Detail: err.Error(),
+				Fixes: []string{"Check .config/wiki-docs/config.yaml and the --provider/--target flags"}})
+			doctorExit(results)
+			return
+		}
+		detail := fmt.Sprintf("sources %s, provider %s", strings.Join(cfg.Sources, ", "), cfg.Provider.Name)
+		if cfg.Target != "" {
+			detail = "target " + cfg.Target + ", " + detail
+		}
+		add(doctorResult{Name: "Configuration", Level: "ok", Detail: detail})
+
+		if err := validateWikiDir(cfg.WikiDir); err != nil {
+			add(doctorResult{Name: "Wiki clone", Level: "fail", Detail: err.Error(),
+				Fixes: []string{"git clone <repo>.wiki.git " + cfg.WikiDir, "Or pass --wiki-path / set WIKI_PATH"}})
+			doctorExit(results)
+			return
+		}
+		if err := runGit("-C", cfg.WikiDir, "rev-parse", "--git-dir"); err != nil {
+			add(doctorResult{Name: "Wiki clone", Level: "fail", Detail: cfg.WikiDir + " is not a git repository",
+				Fixes: []string{"Clone the wiki repository to " + cfg.WikiDir}})
+			doctorExit(results)
+			return
+		}
+		add(doctorResult{Name: "Wiki clone", Level: "ok", Detail: cfg.WikiDir})
+
+		add(doctorBranch(cfg))
+		add(doctorRemote(cfg))
+		add(doctorSchema(cfg))
+
+		items, err := ScanAll(cfg)
+		if err != nil {
+			add(doctorResult{Name: "Scan", Level: "fail", Detail: err.Error()})
+			doctorExit(results)
+			return
+		}
+		add(doctorState(cfg, items))
+		add(doctorNaming(items))
+
+		doctorExit(results)
+	},
+}
+
+func doctorBranch(cfg Config) doctorResult {
+	branch, err := currentBranch(cfg.WikiDir)
+	if err != nil {
+		return doctorResult{Name: "Wiki branch", Level: "fail", Detail: err.Error()}
+	}
+	if err := checkWikiBranch(cfg.WikiDir); err != nil {
+		return doctorResult{Name: "Wiki branch", Level: "warn", Detail: err.Error(),
+			Fixes: []string{"git -C " + cfg.WikiDir + " checkout -b docs-update", "Or use 'wiki-docs propose', which creates the branch"}}
+	}
+	if branch == "" {
+		return doctorResult{Name: "Wiki branch", Level: "warn", Detail: "detached HEAD",
+			Fixes: []string{"git -C " + cfg.WikiDir + " checkout -b docs-update"}}
+	}
+	return doctorResult{Name: "Wiki branch", Level: "ok", Detail: branch}
+}
+
+func doctorRemote(cfg Config) doctorResult {
+	remote, err := getGitRemoteURL(cfg.WikiDir)
+	if err != nil {
+		return doctorResult{Name: "Wiki remote", Level: "warn", Detail: "no 'origin' remote",
+			Fixes: []string{"git -C " + cfg.WikiDir + " remote add origin <url>"}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, "git", "-C", cfg.WikiDir, "ls-remote", "--heads", "origin")
+	c.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := c.CombinedOutput(); err != nil {
+		detail := strings.TrimSpace(string(out))
+		if ctx.Err() != nil {
+			detail = "timed out after " + doctorTimeout.String()
+		}
+		return doctorResult{Name: "Wiki remote", Level: "fail", Detail: remote + ": " + detail,
+			Fixes: []string{"Check network access and credentials for " + remote}}
+	}
+	return doctorResult{Name: "Wiki remote", Level: "ok", Detail: remote}
+}
+
+func doctorSchema(cfg Config) doctorResult {
+	schemaPath := FrontmatterSchemaPath(cfg.WikiDir)
+	if _, err := os.Stat(schemaPath); err != nil {
+		return doctorResult{Name: "Schema", Level: "warn", Detail: "no frontmatter schema in " + filepath.Join(cfg.WikiDir, ".schemas"),
+			Fixes: []string{"wiki-docs schema init"}}
+	}
+	if _, err := LoadFrontmatterSchema(schemaPath); err != nil {
+		return doctorResult{Name: "Schema", Level: "fail", Detail: err.Error(),
+			Fixes: []string{"Fix " + schemaPath + " or regenerate it with 'wiki-docs schema init --force'"}}
+	}
+	return doctorResult{Name: "Schema", Level: "ok", Detail: schemaPath}
+}
+
+// doctorState checks state.json against the sources and the wiki clone:
+// entries for deleted files, revisions the clone does not have, and pages
+// modified outside the workflow (which push will refuse).
+func doctorState(cfg Config, items []FileItem) doctorResult {
+	state, err := LoadState()
+	if err != nil {
+		path, _ := GetStatePath()
+		return doctorResult{Name: "State", Level: "fail", Detail: err.Error(),
+			Fixes: []string{"Remove " + path + "; the next pull rebuilds it"}}
+	}
+
+	local := map[string]FileItem{}
+	for _, item := range items {
+		if item.LocalPath != "" {
+			local[item.RelPath] = item
+		}
+	}
+	var stale, unknownRev, modified []string
+	for relPath, fState := range state.Files {
+		item, ok := local[relPath]
+		if !ok {
+			stale = append(stale, relPath)
+			continue
+		}
+		if fState.LastRev != "" && runGit("-C", cfg.WikiDir, "cat-file", "-e", fState.LastRev+"^{commit}") != nil {
+			unknownRev = append(unknownRev, relPath)
+		}
+		if fState.LastChecksum != "" && fState.LastChecksum != CalculateChecksum(stripFrontmatter(item.LocalContent)) {
+			modified = append(modified, relPath)
+		}
+	}
+
+	var problems, fixes []string
+	if len(stale) > 0 {
+		problems = append(problems, fmt.Sprintf("%d stale entries for files no longer in the sources: %s", len(stale), listSome(stale)))
+		fixes = append(fixes, "Stale entries are harmless; remove them from the state file to tidy up")
+	}
+	if len(unknownRev) > 0 {
+		problems = append(problems, fmt.Sprintf("%d page(s) recorded at revisions missing from the clone: %s", len(unknownRev), listSome(unknownRev)))
+		fixes = append(fixes, "git -C "+cfg.WikiDir+" fetch, then 'wiki-docs pull'")
+	}
+	if len(modified) > 0 {
+		problems = append(problems, fmt.Sprintf("%d page(s) modified outside the workflow (push will refuse them): %s", len(modified), listSome(modified)))
+		fixes = append(fixes, "Revert the local edits, or 'wiki-docs pull <file>' to resync (local edits are backed up)")
+	}
+	if len(problems) > 0 {
+		return doctorResult{Name: "State", Level: "warn", Detail: strings.Join(problems, "; "), Fixes: fixes}
+	}
+	return doctorResult{Name: "State", Level: "ok", Detail: fmt.Sprintf("%d page(s) tracked", len(state.Files))}
+}
+
+// doctorNaming reports wiki pages whose names predate the current convention.
+func doctorNaming(items []FileItem) doctorResult {
+	var legacy []string
+	for _, item := range items {
+		switch {
+		case item.LocalPath != "" && item.WikiPath != "" && item.WikiPath != ToWikiPath(item.RelPath, WikiPrefixBase):
+			legacy = append(legacy, item.WikiPath)
+		case item.Status == "Orphan" && strings.HasPrefix(item.WikiPath, LegacyWikiPrefixBase):
+			legacy = append(legacy, item.WikiPath)
+		}
+	}
+	if len(legacy) > 0 {
+		return doctorResult{Name: "Naming", Level: "warn",
+			Detail: fmt.Sprintf("%d page(s) use legacy names: %s", len(legacy), listSome(legacy)),
+			Fixes:  []string{"wiki-docs migrate --dry-run, then wiki-docs migrate"}}
+	}
+	return doctorResult{Name: "Naming", Level: "ok", Detail: "all pages follow the " + WikiPrefixBase + " convention"}
+}
+
+// listSome joins up to three names, sorted, noting how many were left out.
+func listSome(names []string) string {
+	sort.Strings(names)
+	if len(names) <= 3 {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:3], ", "), len(names)-3)
+}
+
+func printDoctorResult(r doctorResult) {
+	icon := styleSuccess.Render("✓")
+	switch r.Level {
+	case "warn":
+		icon = styleNew.Render("⚠")
+	case "fail":
+		icon = styleErr.Render("✗")
+	}
+	fmt.Printf("%s %-14s %s\n", icon, r.Name, r.Detail)
+	for _, fix := range r.Fixes {
+		fmt.Printf("  %s %s\n", styleInfo.Render("→"), fix)
+	}
+}
+
+// doctorExit summarizes the results and exits 1 if any check failed.
+func doctorExit(results []doctorResult) {
+	warns, fails := 0, 0
+	for _, r := range results {
+		switch r.Level {
+		case "warn":
+			warns++
+		case "fail":
+			fails++
+		}
+	}
+	fmt.Println()
+	if fails > 0 {
+		fmt.Println(styleErr.Render(fmt.Sprintf("%d check(s) failed, %d warning(s).", fails, warns)))
+		os.Exit(1)
+	}
+	if warns > 0 {
+		fmt.Println(styleNew.Render(fmt.Sprintf("All checks passed with %d warning(s).", warns)))
+		return
+	}
+	fmt.Println(styleSuccess.Render("All checks passed."))
+}
+
+func init() {
+	doctorCmd.Flags().DurationVar(&doctorTimeout, "timeout", 15*time.Second, "Timeout for the remote reachability check")
+	addTargetFlag(doctorCmd)
+	rootCmd.AddCommand(doctorCmd)
+}
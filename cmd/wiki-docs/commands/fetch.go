@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// PageFetcher downloads wiki pages over HTTP with a request timeout, retries
+// with exponential backoff, and an optional ETag cache.
+type PageFetcher struct {
+	Client  *http.Client
+	Retries int           // Extra attempts after a network error, 429 or 5xx
+	Backoff time.Duration // Delay before the first retry, doubled each time
+	Cache   *PageCache    // nil disables caching
+}
+
+// NewPageFetcher returns a fetcher whose requests time out after timeout.
+func NewPageFetcher(timeout time.Duration, retries int, cache *PageCache) *PageFetcher {
+	return &PageFetcher{
+		Client:  &http.Client{Timeout: timeout},
+		Retries: retries,
+		Backoff: 500 * time.Millisecond,
+		Cache:   cache,
+	}
+}
+
+// FetchPage downloads a page's markdown. found is false when the wiki does
+// not have the page.
+func (f *PageFetcher) FetchPage(p WikiProvider, repoURL, wikiFile string) (content string, found bool, err error) {
+	pageURL := p.RawURL(repoURL, wikiFile)
+	cached, hasCached := f.Cache.get(pageURL)
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		resp, err = f.get(pageURL, cached.ETag)
+		if err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			break
+		}
+		if attempt >= f.Retries {
+			if err != nil {
+				return "", false, fmt.Errorf("http error: %w", err)
+			}
+			resp.Body.Close()
+			return "", false, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, pageURL)
+		}
+		delay := f.Backoff << attempt
+		if resp != nil {
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				delay = time.Duration(secs) * time.Second
+			}
+			resp.Body.Close()
+		}
+		time.Sleep(delay)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hasCached:
+		return cached.Content, true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return "", false, nil
+	case resp.StatusCode != http.StatusOK:
+		return "", false, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, pageURL)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	content = string(body)
+	if p.decode != nil {
+		if content, err = p.decode(body); err != nil {
+			return "", false, err
+		}
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		f.Cache.put(pageURL, cachedPage{ETag: etag, Content: content})
+	}
+	return content, true, nil
+}
+
+func (f *PageFetcher) get(pageURL, etag string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	return f.Client.Do(req)
+}
+
+// PageCache stores fetched pages by URL with their ETag, one file per page.
+type PageCache struct {
+	dir string
+}
+
+type cachedPage struct {
+	ETag    string `json:"etag"`
+	Content string `json:"content"`
+}
+
+// GetCacheDir returns the project-local page cache, next to state.json and
+// ignored by git.
+func GetCacheDir(repoRoot string) string {
+	return filepath.Join(repoRoot, ".config", "wiki-docs", "cache")
+}
+
+// OpenPageCache returns the page cache in dir, creating it if needed.
+func OpenPageCache(dir string) (*PageCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := ensureIgnored(filepath.Dir(dir), filepath.Base(dir)+"/"); err != nil {
+		return nil, err
+	}
+	return &PageCache{dir: dir}, nil
+}
+
+func (c *PageCache) path(pageURL string) string {
+	sum := sha256.Sum256([]byte(pageURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *PageCache) get(pageURL string) (cachedPage, bool) {
+	if c == nil {
+		return cachedPage{}, false
+	}
+	data, err := os.ReadFile(c.path(pageURL))
+	if err != nil {
+		return cachedPage{}, false
+	}
+	var page cachedPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		return cachedPage{}, false
+	}
+	return page, true
+}
+
+// put writes the entry via a temp file so concurrent workers never read a
+// partial one. Failures only cost a refetch next time.
+func (c *PageCache) put(pageURL string, page cachedPage) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(page)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(c.dir, "page-*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.path(pageURL)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// historyLimit caps how many commits the history view lists.
+const historyLimit = 50
+
+// PageCommit is one commit touching a wiki page.
+type PageCommit struct {
+	SHA     string
+	Author  string
+	Date    time.Time
+	Subject string
+	Added   int // Lines added to the page
+	Deleted int // Lines removed from the page
+}
+
+// pageHistory reads the commits touching wikiPath from the wiki clone,
+// newest first, following renames.
+func pageHistory(wikiDir, wikiPath string, limit int) ([]PageCommit, error) {
+	out, err := exec.Command("git", "-C", wikiDir, "log", "--follow", "--numstat",
+		"-n", strconv.Itoa(limit), "--format=%x1e%H%x1f%an%x1f%aI%x1f%s", "--", wikiPath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %w", err)
+	}
+
+	var commits []PageCommit
+	for _, record := range strings.Split(string(out), "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		fields := strings.SplitN(lines[0], "\x1f", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		c := PageCommit{SHA: fields[0], Author: fields[1], Subject: fields[3]}
+		c.Date, _ = time.Parse(time.RFC3339, fields[2])
+		// numstat lines: "<added>\t<deleted>\t<path>" ("-" for binary files)
+		for _, line := range lines[1:] {
+			stat := strings.Fields(line)
+			if len(stat) < 3 {
+				continue
+			}
+			added, _ := strconv.Atoi(stat[0])
+			deleted, _ := strconv.Atoi(stat[1])
+			c.Added += added
+			c.Deleted += deleted
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// renderHistory formats a page's commits for the terminal.
+func renderHistory(wikiPath string, commits []PageCommit) string {
+	var b strings.Builder
+	b.WriteString(styleInfo.Render("History of "+wikiPath) + "\n\n")
+	if len(commits) == 0 {
+		b.WriteString("No commits touch this page in the wiki clone.\n")
+		return b.String()
+	}
+	dim := lipgloss.NewStyle().Foreground(colorDim)
+	for _, c := range commits {
+		fmt.Fprintf(&b, "%s %s  %-20s %s %s\n    %s\n",
+			styleNew.Render(c.SHA[:min(7, len(c.SHA))]),
+			c.Date.Local().Format("2006-01-02 15:04"),
+			c.Author,
+			styleSuccess.Render(fmt.Sprintf("+%d", c.Added)),
+			styleErr.Render(fmt.Sprintf("-%d", c.Deleted)),
+			c.Subject)
+	}
+	if len(commits) == historyLimit {
+		b.WriteString(dim.Render(fmt.Sprintf("\n(showing the latest %d commits)", historyLimit)) + "\n")
+	}
+	return b.String()
+}
+
+// showHistory prints a page's wiki history and waits for Enter.
+func showHistory(cfg Config, item FileItem) error {
+	defer waitForKey()
+	if item.WikiPath == "" {
+		fmt.Println(item.RelPath + " is not in the wiki yet.")
+		return nil
+	}
+	commits, err := pageHistory(cfg.WikiDir, item.WikiPath, historyLimit)
+	if err != nil {
+		fmt.Println(styleErr.Render(err.Error()))
+		return err
+	}
+	fmt.Print(renderHistory(item.WikiPath, commits))
+	return nil
+}
+
+// historyExec shows a page's history while the list TUI has released the
+// terminal (see batchExec).
+type historyExec struct {
+	cfg  Config
+	item FileItem
+}
+
+func (h *historyExec) SetStdin(io.Reader)  {}
+func (h *historyExec) SetStdout(io.Writer) {}
+func (h *historyExec) SetStderr(io.Writer) {}
+
+func (h *historyExec) Run() error { return showHistory(h.cfg, h.item) }
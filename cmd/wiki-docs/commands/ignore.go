@@ -0,0 +1,243 @@
+package commands
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one line of a gitignore-style file.
+type ignoreRule struct {
+	base     string // Directory of the ignore file, relative to the matcher root ("" for the root)
+	negate   bool   // "!pattern" re-includes
+	dirOnly  bool   // "pattern/" matches directories only
+	basename bool   // No slash in the pattern: match the last path element at any depth
+	re       *regexp.Regexp
+}
+
+// ignoreMatcher answers gitignore queries in-process. Rules are evaluated in
+// git's order of precedence: global excludes, .git/info/exclude, then the
+// per-directory files from the root down, with the last match winning.
+type ignoreMatcher struct {
+	root    string                  // Absolute directory paths are relative to
+	name    string                  // Per-directory ignore file, e.g. ".gitignore" ("" for none)
+	base    []ignoreRule            // Rules that apply everywhere
+	perDir  map[string][]ignoreRule // Lazily loaded rules by directory
+	ignored map[string]bool         // Cached results for directories
+}
+
+// newGitIgnore returns a matcher for the git repository containing dir. When
+// dir is not inside a repository the .gitignore files are still honored,
+// rooted at dir.
+func newGitIgnore(dir string) *ignoreMatcher {
+	root := dir
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			root = d
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	m := &ignoreMatcher{root: root, name: ".gitignore", perDir: map[string][]ignoreRule{}, ignored: map[string]bool{}}
+	if global := globalExcludesFile(); global != "" {
+		m.base = append(m.base, readIgnoreFile(global, "")...)
+	}
+	m.base = append(m.base, readIgnoreFile(filepath.Join(root, ".git", "info", "exclude"), "")...)
+	return m
+}
+
+// newGeminiIgnore returns a matcher for the .geminiignore at the repo root.
+func newGeminiIgnore(repoRoot string) *ignoreMatcher {
+	return &ignoreMatcher{
+		root:    repoRoot,
+		base:    readIgnoreFile(filepath.Join(repoRoot, ".geminiignore"), ""),
+		perDir:  map[string][]ignoreRule{},
+		ignored: map[string]bool{},
+	}
+}
+
+// globalExcludesFile returns git's default core.excludesFile location. An
+// explicitly configured core.excludesFile is not read, as that needs git.
+func globalExcludesFile() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// Ignored reports whether absPath is ignored. As in git, nothing inside an
+// ignored directory can be re-included.
+func (m *ignoreMatcher) Ignored(absPath string, isDir bool) bool {
+	rel, err := filepath.Rel(m.root, absPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.dirIgnored(strings.Join(parts[:i], "/")) {
+			return true
+		}
+	}
+	if isDir {
+		return m.dirIgnored(rel)
+	}
+	return m.match(rel, false)
+}
+
+func (m *ignoreMatcher) dirIgnored(rel string) bool {
+	if v, ok := m.ignored[rel]; ok {
+		return v
+	}
+	v := m.match(rel, true)
+	m.ignored[rel] = v
+	return v
+}
+
+// match applies the rules visible from rel's directory, last match winning.
+func (m *ignoreMatcher) match(rel string, isDir bool) bool {
+	rules := append([]ignoreRule{}, m.base...)
+	if m.name != "" {
+		dir := path.Dir(rel)
+		dirs := []string{""}
+		if dir != "." {
+			parts := strings.Split(dir, "/")
+			for i := 1; i <= len(parts); i++ {
+				dirs = append(dirs, strings.Join(parts[:i], "/"))
+			}
+		}
+		for _, d := range dirs {
+			rules = append(rules, m.dirRules(d)...)
+		}
+	}
+
+	ignored := false
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, r.base+"/")
+		}
+		if r.basename {
+			target = path.Base(target)
+		}
+		if r.re.MatchString(target) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func (m *ignoreMatcher) dirRules(dir string) []ignoreRule {
+	if rules, ok := m.perDir[dir]; ok {
+		return rules
+	}
+	rules := readIgnoreFile(filepath.Join(m.root, filepath.FromSlash(dir), m.name), dir)
+	m.perDir[dir] = rules
+	return rules
+}
+
+// readIgnoreFile parses a gitignore-style file; a missing file has no rules.
+func readIgnoreFile(file, base string) []ignoreRule {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var rules []ignoreRule
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if r, ok := parseIgnoreLine(line, base); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func parseIgnoreLine(line, base string) (ignoreRule, bool) {
+	// Trailing spaces are dropped unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimSuffix(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	r := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	r.basename = !strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	re, err := globToRegexp(line)
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// globToRegexp converts a path glob to a regexp: "**" matches across
+// directories, "*" and "?" within a single path segment, and "[...]" is a
+// character class ("[!...]" negated).
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1])) // Bytes of a multibyte rune pass through as they are
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
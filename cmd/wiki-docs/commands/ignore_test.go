@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*.md", "a.md", true},
+		{"*.md", "dir/a.md", false},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", false},
+		{"**/build", "build", true},
+		{"**/build", "x/y/build", true},
+		{"docs/**", "docs/a/b.md", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"[abc].txt", "b.txt", true},
+		{"[!abc].txt", "b.txt", false},
+		{"[!abc].txt", "d.txt", true},
+		{"[oops", "[oops", true},
+		{`\*.md`, "*.md", true},
+		{`\*.md`, "a.md", false},
+		{"a.b", "aXb", false},
+		{"naïve*", "naïve.md", true},
+		{"日本/*.md", "日本/a.md", true},
+		{`\é`, "é", true},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.glob)
+		if err != nil {
+			t.Errorf("globToRegexp(%q): %v", tt.glob, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("globToRegexp(%q) matching %q = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseIgnoreLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		ok       bool
+		negate   bool
+		dirOnly  bool
+		basename bool
+	}{
+		{"", false, false, false, false},
+		{"   ", false, false, false, false},
+		{"# comment", false, false, false, false},
+		{"/", false, false, false, false},
+		{"*.log", true, false, false, true},
+		{"*.log   ", true, false, false, true},
+		{"!keep.log", true, true, false, true},
+		{`\!bang`, true, false, false, true},
+		{`\#hash`, true, false, false, true},
+		{"build/", true, false, true, true},
+		{"/root.txt", true, false, false, false},
+		{"docs/*.md", true, false, false, false},
+	}
+	for _, tt := range tests {
+		r, ok := parseIgnoreLine(tt.line, "")
+		if ok != tt.ok {
+			t.Errorf("parseIgnoreLine(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if r.negate != tt.negate || r.dirOnly != tt.dirOnly || r.basename != tt.basename {
+			t.Errorf("parseIgnoreLine(%q) = negate %v dirOnly %v basename %v, want %v %v %v",
+				tt.line, r.negate, r.dirOnly, r.basename, tt.negate, tt.dirOnly, tt.basename)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir()) // No global excludes
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".gitignore":            "*.log\n!keep.log\nbuild/\n/top.txt\nvendor\n",
+		"sub/.gitignore":        "local.txt\n!other.log\n",
+		".git/info/exclude":     "secret\n",
+		"sub/deeper/.gitignore": "*.md\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"keep.log", false, false},
+		{"x/y/a.log", false, true},
+		{"build", true, true},
+		{"build", false, false},
+		{"build/out.bin", false, true},
+		{"x/build/out.bin", false, true},
+		{"top.txt", false, true},
+		{"sub/top.txt", false, false},
+		{"vendor/lib.go", false, true},
+		{"secret", false, true},
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+		{"sub/other.log", false, false},
+		{"other.log", false, true},
+		{"sub/deeper/readme.md", false, true},
+		{"sub/readme.md", false, false},
+		// Nothing inside an ignored directory can be re-included
+		{"build/keep.log", false, true},
+	}
+	m := newGitIgnore(root)
+	for _, tt := range tests {
+		path := filepath.Join(root, filepath.FromSlash(tt.path))
+		if got := m.Ignored(path, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+	if m.Ignored(root, true) {
+		t.Error("the root itself is ignored")
+	}
+	if m.Ignored(filepath.Dir(root), true) {
+		t.Error("a path outside the root is ignored")
+	}
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Link forms rewritten when pages move between the repo and the wiki:
+// inline links and images, reference definitions, and HTML src/href.
+var (
+	inlineLinkRe = regexp.MustCompile(`(!?\[[^\]]*\]\()(<[^>]+>|[^)\s]+)((?:\s+"[^"]*")?\))`)
+	refLinkRe    = regexp.MustCompile(`(?m)^(\s{0,3}\[[^\]]+\]:\s*)(\S+)()`)
+	htmlLinkRe   = regexp.MustCompile(`(<(?:img|a)\b[^>]*?\s(?:src|href)=")([^"]+)(")`)
+)
+
+// rewriteLinks passes every link target in content through fn, replacing it
+// when fn reports a change. Anchors and query strings are split off before
+// fn is called and re-attached afterwards.
+func rewriteLinks(content string, fn func(target string) (string, bool)) string {
+	replace := func(re *regexp.Regexp, s string) string {
+		return re.ReplaceAllStringFunc(s, func(m string) string {
+			sub := re.FindStringSubmatch(m)
+			target := sub[2]
+			bracketed := strings.HasPrefix(target, "<") && strings.HasSuffix(target, ">")
+			if bracketed {
+				target = target[1 : len(target)-1]
+			}
+			if isExternalLink(target) {
+				return m
+			}
+			path, suffix := target, ""
+			if i := strings.IndexAny(target, "#?"); i >= 0 {
+				path, suffix = target[:i], target[i:]
+			}
+			if path == "" {
+				return m
+			}
+			newPath, ok := fn(path)
+			if !ok {
+				return m
+			}
+			newTarget := newPath + suffix
+			if bracketed {
+				newTarget = "<" + newTarget + ">"
+			}
+			return sub[1] + newTarget + sub[3]
+		})
+	}
+	content = replace(inlineLinkRe, content)
+	content = replace(refLinkRe, content)
+	return replace(htmlLinkRe, content)
+}
+
+// isExternalLink reports whether a link target points outside the repo.
+func isExternalLink(target string) bool {
+	lower := strings.ToLower(target)
+	return strings.Contains(lower, "://") ||
+		strings.HasPrefix(lower, "mailto:") ||
+		strings.HasPrefix(lower, "data:") ||
+		strings.HasPrefix(target, "#") ||
+		strings.HasPrefix(target, "/")
+}
+
+// pageLinksToWiki rewrites links to other markdown pages in the repo into
+// flattened wiki page names (without the .md extension, as wikis link pages).
+func pageLinksToWiki(relPage, content string) string {
+	return rewriteLinks(content, func(target string) (string, bool) {
+		repoPath := resolveRepoLink(relPage, target)
+		if repoPath == "" || !strings.EqualFold(path.Ext(repoPath), ".md") {
+			return "", false
+		}
+		return strings.TrimSuffix(ToWikiPath(repoPath, WikiPrefixBase), ".md"), true
+	})
+}
+
+// pageLinksFromWiki is the reverse of pageLinksToWiki: links to flattened
+// wiki pages become links relative to the local page. pages maps wiki page
+// names to repo paths (see localPageIndex); pages not in it are unflattened
+// on a best-effort basis.
+func pageLinksFromWiki(pages map[string]string, relPage, content string) string {
+	return rewriteLinks(content, func(target string) (string, bool) {
+		if strings.Contains(target, "/") {
+			return "", false
+		}
+		name := strings.TrimSuffix(target, ".md")
+		var prefix string
+		for _, p := range []string{WikiPrefixBase, LegacyWikiPrefixBase} {
+			if strings.HasPrefix(name, p) {
+				prefix = p
+			}
+		}
+		if prefix == "" {
+			return "", false
+		}
+		repoPath, ok := pages[strings.TrimPrefix(name, prefix)]
+		if !ok {
+			repoPath = strings.ReplaceAll(strings.TrimPrefix(name, prefix), "~", "/") + ".md"
+		}
+		return relativeRepoLink(relPage, repoPath), true
+	})
+}
+
+var (
+	pageIndexMu    sync.Mutex
+	pageIndexCache = map[string]map[string]string{}
+)
+
+// localPageIndex maps flattened page names (prefix and extension removed) to
+// the repo paths of the markdown files under the configured sources. The
+// index is built once per repo root per run.
+func localPageIndex(cfg Config) map[string]string {
+	pageIndexMu.Lock()
+	defer pageIndexMu.Unlock()
+	if idx, ok := pageIndexCache[cfg.RepoRoot]; ok {
+		return idx
+	}
+	idx := map[string]string{}
+	for _, source := range cfg.Sources {
+		filepath.Walk(filepath.Join(cfg.RepoRoot, source), func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(p) != ".md" {
+				return nil
+			}
+			rel, err := filepath.Rel(cfg.RepoRoot, p)
+			if err != nil {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			name := strings.TrimSuffix(strings.TrimPrefix(ToWikiPath(rel, WikiPrefixBase), WikiPrefixBase), ".md")
+			idx[name] = rel
+			return nil
+		})
+	}
+	pageIndexCache[cfg.RepoRoot] = idx
+	return idx
+}
+
+// linksToWiki is the link-rewriting pass applied to a page on its way into
+// the wiki: asset links (see assetsToWiki) and inter-page links.
+func linksToWiki(cfg Config, relPage, content string, copyAssets bool) (string, []string) {
+	content, assets := assetsToWiki(cfg, relPage, content, copyAssets)
+	return pageLinksToWiki(relPage, content), assets
+}
+
+// linksFromWiki is the reverse pass applied to a page pulled from the wiki.
+func linksFromWiki(cfg Config, relPage, content string, copyAssets bool) string {
+	content = assetsFromWiki(cfg, relPage, content, copyAssets)
+	return pageLinksFromWiki(localPageIndex(cfg), relPage, content)
+}
@@ -0,0 +1,198 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LintConfig sets how pre-publish checks treat problems, under "lint" in
+// config.yaml:
+//
+//	lint:
+//	  links: error      # broken internal links
+//	  markdown: warn    # markdown rules
+//	  disable: [single-h1]
+//
+// Levels are "error" (the page is not written), "warn" or "off".
+type LintConfig struct {
+	Links    string   `yaml:"links"`
+	Markdown string   `yaml:"markdown"`
+	Disable  []string `yaml:"disable"` // Markdown rules to skip
+}
+
+// DefaultLintConfig blocks broken links and only warns about markdown style.
+var DefaultLintConfig = LintConfig{Links: "error", Markdown: "warn"}
+
+// lintRules are the markdown rules lintPage knows, for validation of
+// lint.disable.
+var lintRules = []string{"heading-space", "heading-increment", "single-h1", "empty-link", "unclosed-fence"}
+
+// LintIssue is one problem found in a page.
+type LintIssue struct {
+	Line    int
+	Rule    string // "broken-link" or a markdown rule name
+	Level   string // "error" or "warn"
+	Message string
+}
+
+// validate fills defaults and rejects unknown levels and rules.
+func (lc *LintConfig) validate() error {
+	if lc.Links == "" {
+		lc.Links = DefaultLintConfig.Links
+	}
+	if lc.Markdown == "" {
+		lc.Markdown = DefaultLintConfig.Markdown
+	}
+	for _, level := range []string{lc.Links, lc.Markdown} {
+		if level != "error" && level != "warn" && level != "off" {
+			return fmt.Errorf("invalid lint level %q (expected error, warn or off)", level)
+		}
+	}
+	for _, rule := range lc.Disable {
+		known := false
+		for _, r := range lintRules {
+			known = known || r == rule
+		}
+		if !known {
+			return fmt.Errorf("unknown lint rule %q (known: %s)", rule, strings.Join(lintRules, ", "))
+		}
+	}
+	return nil
+}
+
+var (
+	headingRe     = regexp.MustCompile(`^ {0,3}(#{1,6})(\s|$)`)
+	headingNoSpRe = regexp.MustCompile(`^ {0,3}#{1,6}[^#\s]`)
+	fenceRe       = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	emptyLinkRe   = regexp.MustCompile(`(?:^|[^!\]])\[\s*\]\([^)]*\)|\[[^\]]+\]\(\s*\)`)
+)
+
+// lintPage checks a page before it is written to the wiki. Lines in the
+// frontmatter and in fenced code blocks are skipped; line numbers refer to
+// content as given.
+func lintPage(cfg Config, relPath, content string) []LintIssue {
+	lc := cfg.Lint
+	if lc.Links == "" && lc.Markdown == "" {
+		lc = DefaultLintConfig
+	}
+	disabled := map[string]bool{}
+	for _, r := range lc.Disable {
+		disabled[r] = true
+	}
+	var issues []LintIssue
+	md := func(line int, rule, msg string) {
+		if lc.Markdown != "off" && !disabled[rule] {
+			issues = append(issues, LintIssue{line, rule, lc.Markdown, msg})
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	start := 0
+	if len(lines) > 0 && lines[0] == "---" {
+		for i := 1; i < len(lines); i++ {
+			if lines[i] == "---" {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	var fence string
+	fenceLine, lastLevel, h1s := 0, 0, 0
+	for i := start; i < len(lines); i++ {
+		line, n := lines[i], i+1
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			rest := strings.TrimSpace(line)
+			switch {
+			case fence == "":
+				fence, fenceLine = m[1], n
+			case len(rest) >= len(fence) && strings.TrimLeft(rest, fence[:1]) == "":
+				fence = "" // Closing fence: same character, at least as long
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			level := len(m[1])
+			if level == 1 {
+				if h1s++; h1s == 2 {
+					md(n, "single-h1", "more than one top-level heading")
+				}
+			}
+			if lastLevel > 0 && level > lastLevel+1 {
+				md(n, "heading-increment", fmt.Sprintf("heading level jumps from h%d to h%d", lastLevel, level))
+			}
+			lastLevel = level
+		} else if headingNoSpRe.MatchString(line) {
+			md(n, "heading-space", "missing space after '#' in heading")
+		}
+		if emptyLinkRe.MatchString(line) {
+			md(n, "empty-link", "link with empty text or target")
+		}
+
+		if lc.Links != "off" {
+			for _, target := range brokenLinks(cfg, relPath, line) {
+				issues = append(issues, LintIssue{n, "broken-link", lc.Links, "link target not found: " + target})
+			}
+		}
+	}
+	if fence != "" {
+		md(fenceLine, "unclosed-fence", "code fence is never closed")
+	}
+	return issues
+}
+
+// brokenLinks returns the internal link targets in line that resolve neither
+// to a file in the repo nor to a page in the wiki clone.
+func brokenLinks(cfg Config, relPath, line string) []string {
+	var broken []string
+	rewriteLinks(line, func(target string) (string, bool) {
+		if p := resolveRepoLink(relPath, target); p != "" {
+			if _, err := os.Stat(filepath.Join(cfg.RepoRoot, filepath.FromSlash(p))); err == nil {
+				return "", false
+			}
+		}
+		// Flattened wiki page names, with or without the extension
+		if !strings.Contains(target, "/") {
+			for _, name := range []string{target, target + ".md"} {
+				if _, err := os.Stat(filepath.Join(cfg.WikiDir, name)); err == nil {
+					return "", false
+				}
+			}
+		}
+		broken = append(broken, target)
+		return "", false
+	})
+	return broken
+}
+
+// checkLint prints the problems lintPage finds in a page and reports
+// whether the page may be written, i.e. no problem is at error level.
+func checkLint(cfg Config, relPath, content string) bool {
+	issues := lintPage(cfg, relPath, content)
+	if len(issues) == 0 {
+		return true
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	errors := 0
+	for _, issue := range issues {
+		icon := styleNew.Render("⚠")
+		if issue.Level == "error" {
+			icon = styleErr.Render("✗")
+			errors++
+		}
+		fmt.Printf("  %s %s:%d %s %s\n", icon, relPath, issue.Line, issue.Message, styleMeta.Render("("+issue.Rule+")"))
+	}
+	if errors > 0 {
+		fmt.Println(styleErr.Render(fmt.Sprintf("⛔ %d lint error(s) in %s; fix them or relax 'lint' in config.yaml", errors, relPath)))
+		return false
+	}
+	return true
+}
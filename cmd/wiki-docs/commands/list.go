@@ -23,6 +23,10 @@ var listCmd = &cobra.Command{
 			printFatal("Scan Failed", err)
 		}
 
+		if emitNonInteractive(cmd, items) {
+			return
+		}
+
 		if err := runListTUI(items, cfg); err != nil {
 			printFatal("TUI Error", err)
 		}
@@ -30,5 +34,6 @@ var listCmd = &cobra.Command{
 }
 
 func init() {
+	addOutputFlags(listCmd)
 	rootCmd.AddCommand(listCmd)
 }
@@ -4,10 +4,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-
 	"sort"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -56,11 +57,53 @@ type listModel struct {
 	showLocal    bool
 	showOrphan   bool
 	showLegacy   bool
+	search       textinput.Model   // "/" search box
+	searching    bool              // Search box has focus
+	titles       map[string]string // Frontmatter title by RelPath
+	marked       map[string]bool   // Rows selected for a batch action, by RelPath
+	pending      *batchAction      // Batch awaiting confirmation
+	notice       string            // One-line message shown above the help
+}
+
+// statusDisplay returns the icon and label shown for a sync status.
+func statusDisplay(status string) (string, string) {
+	switch status {
+	case "Same":
+		return "✅", "Current"
+	case "Changed":
+		return "📝", "Modified"
+	case "Untracked":
+		return "🆕", "Local"
+	case "Orphan":
+		return "⚠️", "Orphan"
+	case "Legacy":
+		return "💾", "Legacy"
+	}
+	return "❔", "Local"
+}
+
+// matchesSearch reports whether the search text is a case-insensitive
+// substring of the item's path, wiki page, title or status.
+func (m *listModel) matchesSearch(item FileItem) bool {
+	q := strings.ToLower(strings.TrimSpace(m.search.Value()))
+	if q == "" {
+		return true
+	}
+	_, label := statusDisplay(item.Status)
+	for _, field := range []string{item.RelPath, item.WikiPath, m.titles[item.RelPath], item.Status, label} {
+		if strings.Contains(strings.ToLower(field), q) {
+			return true
+		}
+	}
+	return false
 }
 
 func (m *listModel) ApplyFilterAndSort() {
 	var filtered []FileItem
 	for _, item := range m.allItems {
+		if !m.matchesSearch(item) {
+			continue
+		}
 		switch item.Status {
 		case "Same":
 			if m.showSame {
@@ -105,33 +148,20 @@ func (m *listModel) ApplyFilterAndSort() {
 	m.visibleItems = filtered
 	var rows []table.Row
 	for _, item := range filtered {
-		statusIcon := "❔"
-		statusLabel := "Local"
-		switch item.Status {
-		case "Same":
-			statusIcon = "✅"
-			statusLabel = "Current"
-		case "Changed":
-			statusIcon = "📝"
-			statusLabel = "Modified"
-		case "Untracked":
-			statusIcon = "🆕"
-			statusLabel = "Local"
-		case "Orphan":
-			statusIcon = "⚠️"
-			statusLabel = "Orphan"
-		case "Legacy":
-			statusIcon = "💾"
-			statusLabel = "Legacy"
-		}
+		statusIcon, statusLabel := statusDisplay(item.Status)
 
 		yamlIcon := "✅"
 		if !item.HasValidYAML {
 			yamlIcon = "❌"
 		}
 
+		mark := "  "
+		if m.marked[item.RelPath] {
+			mark = "● "
+		}
+
 		rows = append(rows, table.Row{
-			fmt.Sprintf("%s %s", statusIcon, statusLabel),
+			fmt.Sprintf("%s%s %s", mark, statusIcon, statusLabel),
 			yamlIcon,
 			item.Version,
 			item.Approved,
@@ -139,6 +169,9 @@ func (m *listModel) ApplyFilterAndSort() {
 		})
 	}
 	m.table.SetRows(rows)
+	if m.table.Cursor() >= len(rows) {
+		m.table.SetCursor(max(len(rows)-1, 0))
+	}
 }
 
 func (m listModel) Init() tea.Cmd { return nil }
@@ -146,9 +179,65 @@ func (m listModel) Init() tea.Cmd { return nil }
 func (m *listModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
+	case batchDoneMsg:
+		if msg.err != nil {
+			m.notice = "Batch failed: " + msg.err.Error()
+		}
+		if items, err := ScanAll(m.config); err == nil {
+			m.allItems = items
+		}
+		m.marked = map[string]bool{}
+		m.ApplyFilterAndSort()
+		return m, nil
 	case tea.KeyMsg:
+		// A batch awaits a combined confirmation
+		if m.pending != nil {
+			action := *m.pending
+			m.pending = nil
+			if msg.String() == "y" || msg.String() == "Y" {
+				return m, tea.Exec(&batchExec{cfg: m.config, action: action}, func(err error) tea.Msg {
+					return batchDoneMsg{err}
+				})
+			}
+			m.notice = "Cancelled."
+			return m, nil
+		}
+		m.notice = ""
+
+		// While the search box has focus, keys edit the query
+		if m.searching {
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "esc":
+				m.search.SetValue("")
+				fallthrough
+			case "enter":
+				m.searching = false
+				m.search.Blur()
+				m.table.Focus()
+				m.ApplyFilterAndSort()
+				return m, nil
+			}
+			m.search, cmd = m.search.Update(msg)
+			m.ApplyFilterAndSort()
+			return m, cmd
+		}
+
 		switch msg.String() {
-		case "q", "ctrl+c", "esc":
+		case "/":
+			m.searching = true
+			m.table.Blur()
+			return m, m.search.Focus()
+		case "esc":
+			if m.search.Value() != "" {
+				// First esc clears an active search
+				m.search.SetValue("")
+				m.ApplyFilterAndSort()
+				return m, nil
+			}
+			return m, tea.Quit
+		case "q", "ctrl+c":
 			return m, tea.Quit
 		case "e":
 			// Edit selected file
@@ -166,36 +255,57 @@ func (m *listModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					})
 				}
 			}
-		case "p":
-			// Push selected file
+		case "h":
+			// Wiki history of the selected page
 			idx := m.table.Cursor()
 			if idx >= 0 && idx < len(m.visibleItems) {
 				item := m.visibleItems[idx]
-				c := exec.Command(os.Args[0], "push", item.RelPath)
-				return m, tea.ExecProcess(c, func(err error) tea.Msg {
+				if item.WikiPath == "" {
+					m.notice = item.RelPath + " is not in the wiki yet."
+					return m, nil
+				}
+				return m, tea.Exec(&historyExec{cfg: m.config, item: item}, func(err error) tea.Msg {
 					return nil
 				})
 			}
-		case "u":
-			// Pull (Update) selected file
+		case " ":
+			// Toggle the row's mark and move on
 			idx := m.table.Cursor()
 			if idx >= 0 && idx < len(m.visibleItems) {
-				item := m.visibleItems[idx]
-				c := exec.Command(os.Args[0], "pull", item.RelPath)
-				return m, tea.ExecProcess(c, func(err error) tea.Msg {
-					return nil
-				})
+				rel := m.visibleItems[idx].RelPath
+				if m.marked[rel] {
+					delete(m.marked, rel)
+				} else {
+					m.marked[rel] = true
+				}
+				m.ApplyFilterAndSort()
+				m.table.MoveDown(1)
 			}
-		case "a":
-			// Add (Publish) selected file
-			idx := m.table.Cursor()
-			if idx >= 0 && idx < len(m.visibleItems) {
-				item := m.visibleItems[idx]
-				c := exec.Command(os.Args[0], "add", item.RelPath)
-				return m, tea.ExecProcess(c, func(err error) tea.Msg {
-					return nil
-				})
+			return m, nil
+		case "*":
+			// Mark every visible row, or clear the marks if all are marked
+			all := len(m.visibleItems) > 0
+			for _, item := range m.visibleItems {
+				all = all && m.marked[item.RelPath]
+			}
+			for _, item := range m.visibleItems {
+				if all {
+					delete(m.marked, item.RelPath)
+				} else {
+					m.marked[item.RelPath] = true
+				}
 			}
+			m.ApplyFilterAndSort()
+			return m, nil
+		case "p", "u", "a", "v":
+			// Push, pull (update), add or promote the marked rows (or the cursor row)
+			action := m.newBatch(map[string]string{"p": "push", "u": "pull", "a": "add", "v": "promote"}[msg.String()])
+			if len(action.Items) == 0 {
+				m.notice = fmt.Sprintf("Nothing to %s in the selection.", action.Name)
+				return m, nil
+			}
+			m.pending = &action
+			return m, nil
 		case "r":
 			// Refresh logic...
 		case "1":
@@ -244,9 +354,29 @@ func (m listModel) View() string {
 		" Filters: [1] Current:%v [2] Modified:%v [3] Local:%v [4] Orphan:%v [5] Legacy:%v ",
 		m.showSame, m.showChanged, m.showLocal, m.showOrphan, m.showLegacy,
 	)
+	if len(m.marked) > 0 {
+		filterInfo += fmt.Sprintf("• %d marked ", len(m.marked))
+	}
 
-	help := footerStyle.Render(" ↑/↓: Navigate • e: Edit • p: Push • u: Pull • a: Add • q: Quit ")
-	return title +
+	searchLine := ""
+	if m.searching || m.search.Value() != "" {
+		searchLine = m.search.View() + lipgloss.NewStyle().Foreground(colorDim).Render(fmt.Sprintf("  (%d of %d)", len(m.visibleItems), len(m.allItems))) + "\n"
+	}
+
+	help := footerStyle.Render(" ↑/↓: Navigate • space/*: Mark • /: Search • e: Edit • h: History • p: Push • u: Pull • a: Add • v: Promote • q: Quit ")
+	if m.pending != nil {
+		prompt := fmt.Sprintf(" %s %d file(s)?", strings.ToUpper(m.pending.Name[:1])+m.pending.Name[1:], len(m.pending.Items))
+		if m.pending.Skipped > 0 {
+			prompt += fmt.Sprintf(" (%d not eligible, skipped)", m.pending.Skipped)
+		}
+		help = lipgloss.NewStyle().Foreground(colorWarning).Bold(true).MarginTop(1).Render(prompt + " [y/N] ")
+	} else if m.notice != "" {
+		help = lipgloss.NewStyle().Foreground(colorWarning).MarginTop(1).Render(" "+m.notice) + "\n" + help
+	}
+	if m.searching {
+		help = footerStyle.Render(" Type to filter by path, title or status • enter: Apply • esc: Clear ")
+	}
+	return title + searchLine +
 		baseStyle.Render(m.table.View()) + "\n" +
 		paneStyle.Render(info) + "\n" +
 		lipgloss.NewStyle().Foreground(colorDim).Render(filterInfo) + "\n" +
@@ -281,8 +411,29 @@ func runListTUI(items []FileItem, cfg Config) error {
 		Bold(true)
 	t.SetStyles(s)
 
+	search := textinput.New()
+	search.Prompt = "/ "
+	search.Placeholder = "path, title or status"
+	search.CharLimit = 120
+
+	titles := make(map[string]string, len(items))
+	for _, item := range items {
+		content := item.LocalContent
+		if content == "" {
+			content = item.WikiContent
+		}
+		if fm, ok := parseFrontmatter(content); ok {
+			if title, ok := fm["title"].(string); ok {
+				titles[item.RelPath] = title
+			}
+		}
+	}
+
 	m := listModel{
 		table:       t,
+		search:      search,
+		titles:      titles,
+		marked:      map[string]bool{},
 		allItems:    items,
 		config:      cfg,
 		showSame:    true,
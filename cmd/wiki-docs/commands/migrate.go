@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateDryRun   bool
+	migrateNoCommit bool
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rename legacy wiki pages to the current naming convention",
+	Long: `Renames pages using the legacy repo-root~ prefix or hyphenated names to the
+current src_docs~ convention with 'git mv' in the wiki clone, rewrites links to
+the renamed pages across the wiki, and commits the batch. State entries are
+moved to the new revision so later pushes do not report a stomp.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			printFatal("Configuration Error", err)
+		}
+		if err := validateWikiDir(cfg.WikiDir); err != nil {
+			printFatal("Wiki Directory Invalid", err)
+		}
+
+		items, err := ScanAll(cfg)
+		if err != nil {
+			printFatal("Scan Failed", err)
+		}
+
+		renames := map[string]string{}  // Old wiki filename -> new wiki filename
+		relPaths := map[string]string{} // New wiki filename -> repo path
+		for _, item := range items {
+			var target string
+			switch {
+			case item.LegacyName:
+				// Status may be "Changed" instead: the name is what counts
+				target = ToWikiPath(item.RelPath, WikiPrefixBase)
+				relPaths[target] = item.RelPath
+			case item.Status == "Orphan" && strings.HasPrefix(item.WikiPath, LegacyWikiPrefixBase):
+				// No local counterpart: swap the prefix and normalize the name.
+				target = WikiPrefixBase + strings.ReplaceAll(strings.TrimPrefix(item.WikiPath, LegacyWikiPrefixBase), "-", "_")
+			default:
+				continue
+			}
+			if target == item.WikiPath {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(cfg.WikiDir, target)); err == nil {
+				fmt.Println(styleErr.Render(fmt.Sprintf("Skipping %s: %s already exists", item.WikiPath, target)))
+				continue
+			}
+			renames[item.WikiPath] = target
+		}
+
+		if len(renames) == 0 {
+			fmt.Println(styleSuccess.Render("No legacy pages to migrate."))
+			return
+		}
+
+		olds := make([]string, 0, len(renames))
+		for old := range renames {
+			olds = append(olds, old)
+		}
+		sort.Strings(olds)
+		for _, old := range olds {
+			fmt.Printf("  %s → %s\n", styleMeta.Render(old), styleSuccess.Render(renames[old]))
+		}
+		if migrateDryRun {
+			fmt.Println(styleInfo.Render(fmt.Sprintf("%d page(s) would be renamed.", len(renames))))
+			return
+		}
+
+		// 1. Rename (git mv stages the renames itself)
+		for _, old := range olds {
+			if err := runGit("-C", cfg.WikiDir, "mv", "--", old, renames[old]); err != nil {
+				printFatal("git mv failed", err, "Resolve the problem in the wiki clone and re-run 'wiki-docs migrate'.")
+			}
+		}
+
+		// 2. Rewrite incoming links (page names are linked without .md)
+		pageRenames := map[string]string{}
+		for old, target := range renames {
+			pageRenames[strings.TrimSuffix(old, ".md")] = strings.TrimSuffix(target, ".md")
+		}
+		entries, err := os.ReadDir(cfg.WikiDir)
+		if err != nil {
+			printFatal("Read wiki failed", err)
+		}
+		linksUpdated := 0
+		for _, e := range entries {
+			if e.IsDir() || filepath.Ext(e.Name()) != ".md" {
+				continue
+			}
+			p := filepath.Join(cfg.WikiDir, e.Name())
+			data, err := os.ReadFile(p)
+			if err != nil {
+				continue
+			}
+			updated := rewriteLinks(string(data), func(target string) (string, bool) {
+				if newName, ok := pageRenames[strings.TrimSuffix(target, ".md")]; ok {
+					if strings.HasSuffix(target, ".md") {
+						newName += ".md"
+					}
+					return newName, true
+				}
+				return "", false
+			})
+			if updated != string(data) {
+				if err := os.WriteFile(p, []byte(updated), 0644); err != nil {
+					fmt.Println(styleErr.Render("Write failed: " + err.Error()))
+					continue
+				}
+				if err := runGit("-C", cfg.WikiDir, "add", "--", e.Name()); err != nil {
+					fmt.Println(styleErr.Render("git add failed: " + err.Error()))
+				}
+				linksUpdated++
+			}
+		}
+		fmt.Println(styleSuccess.Render(fmt.Sprintf("✓ Renamed %d page(s), updated links in %d page(s)", len(renames), linksUpdated)))
+
+		if migrateNoCommit {
+			fmt.Println(styleInfo.Render("Changes staged but not committed; state.json is updated by the next 'pull'."))
+			return
+		}
+
+		// 3. Commit and move state entries to the new revision
+		msg := fmt.Sprintf("docs: migrate %d legacy page(s) to %s naming", len(renames), WikiPrefixBase)
+		if err := runGit("-C", cfg.WikiDir, "commit", "-m", msg); err != nil {
+			printFatal("git commit failed", err)
+		}
+		fmt.Println(styleSuccess.Render("✓ Committed"))
+
+		state, err := LoadState()
+		if err != nil {
+			fmt.Printf("Warning: Failed to load state: %v\n", err)
+			return
+		}
+		for target, relPath := range relPaths {
+			fState, ok := state.Get(relPath)
+			if !ok {
+				continue
+			}
+			if rev, err := getFileGitRevision(cfg.WikiDir, target); err == nil && rev != "" {
+				state.Update(relPath, rev, fState.LastChecksum)
+			}
+		}
+		if err := state.Save(); err != nil {
+			fmt.Printf("Warning: Failed to save state: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "List the renames without applying them")
+	migrateCmd.Flags().BoolVar(&migrateNoCommit, "no-commit", false, "Rename and rewrite links but leave the changes uncommitted")
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TextNormalization makes pages byte-identical regardless of the platform
+// they were edited on, under "normalize" in config.yaml:
+//
+//	normalize:
+//	  line_endings: lf   # lf, crlf or keep (default)
+//	  strip_bom: true
+//
+// Pages are normalized when read and written, and checksums ignore line
+// endings and the BOM whenever either setting is enabled, so a page saved
+// with CRLF on Windows is neither "Changed" nor an integrity failure.
+type TextNormalization struct {
+	LineEndings string `yaml:"line_endings"`
+	StripBOM    bool   `yaml:"strip_bom"`
+}
+
+const utf8BOM = "\uFEFF"
+
+// textNormalization is the active setting, applied by getConfig.
+var textNormalization TextNormalization
+
+func (n *TextNormalization) validate() error {
+	switch n.LineEndings {
+	case "":
+		n.LineEndings = "keep"
+	case "lf", "crlf", "keep":
+	default:
+		return fmt.Errorf("invalid normalize.line_endings %q (expected lf, crlf or keep)", n.LineEndings)
+	}
+	return nil
+}
+
+func (n TextNormalization) enabled() bool {
+	return n.StripBOM || (n.LineEndings != "" && n.LineEndings != "keep")
+}
+
+// normalizeText applies the configured BOM and line-ending rules.
+func normalizeText(s string) string {
+	n := textNormalization
+	if n.StripBOM {
+		s = strings.TrimPrefix(s, utf8BOM)
+	}
+	switch n.LineEndings {
+	case "lf":
+		s = strings.ReplaceAll(s, "\r\n", "\n")
+	case "crlf":
+		s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+	}
+	return s
+}
+
+// checksumText is the form of content that checksums are computed over: with
+// normalization enabled, the BOM and CRLF line endings are ignored.
+func checksumText(s string) string {
+	if !textNormalization.enabled() {
+		return s
+	}
+	return strings.ReplaceAll(strings.TrimPrefix(s, utf8BOM), "\r\n", "\n")
+}
+
+// readText reads a page and normalizes it.
+func readText(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	return normalizeText(string(data)), err
+}
+
+// writeText normalizes a page and writes it.
+func writeText(path, content string) error {
+	return os.WriteFile(path, []byte(normalizeText(content)), 0644)
+}
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// ItemJSON is the machine-readable form of a FileItem.
+type ItemJSON struct {
+	RelPath      string `json:"relPath"`
+	WikiPath     string `json:"wikiPath,omitempty"`
+	Status       string `json:"status"`
+	Version      string `json:"version,omitempty"`
+	Approved     string `json:"approved,omitempty"`
+	HasValidYAML bool   `json:"hasValidYAML"`
+}
+
+// Summary is the --check object: counts by status and whether anything
+// differs between the sources and the wiki.
+type Summary struct {
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+	Drift  bool           `json:"drift"`
+}
+
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().String("format", "text", "Output format: text (interactive) or json")
+	cmd.Flags().Bool("check", false, "Print a summary of counts by status and exit 1 if any file is out of sync")
+}
+
+// summarize counts items by status. Anything other than "Same" is drift.
+func summarize(items []FileItem) Summary {
+	s := Summary{Total: len(items), Counts: map[string]int{}}
+	for _, item := range items {
+		s.Counts[item.Status]++
+		if item.Status != "Same" {
+			s.Drift = true
+		}
+	}
+	return s
+}
+
+// emitNonInteractive handles --format json and --check for check and list.
+// It returns false when the interactive view should run instead.
+func emitNonInteractive(cmd *cobra.Command, items []FileItem) bool {
+	format, _ := cmd.Flags().GetString("format")
+	check, _ := cmd.Flags().GetBool("check")
+	if format != "text" && format != "json" {
+		printFatal("Invalid Format", fmt.Errorf("unknown format %q", format), "Use --format text or --format json")
+	}
+	if format == "text" && !check {
+		return false
+	}
+
+	if check {
+		s := summarize(items)
+		if format == "json" {
+			printJSON(s)
+		} else {
+			statuses := make([]string, 0, len(s.Counts))
+			for st := range s.Counts {
+				statuses = append(statuses, st)
+			}
+			sort.Strings(statuses)
+			for _, st := range statuses {
+				fmt.Printf("%-10s %d\n", st, s.Counts[st])
+			}
+			fmt.Printf("%-10s %d\n", "Total", s.Total)
+		}
+		if s.Drift {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	out := make([]ItemJSON, 0, len(items))
+	for _, item := range items {
+		out = append(out, ItemJSON{
+			RelPath:      item.RelPath,
+			WikiPath:     item.WikiPath,
+			Status:       item.Status,
+			Version:      item.Version,
+			Approved:     item.Approved,
+			HasValidYAML: item.HasValidYAML,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RelPath < out[j].RelPath })
+	printJSON(out)
+	return true
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		printFatal("JSON Encoding Failed", err)
+	}
+}
@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	promoteVersion string
+	promoteFilters []string
+	promoteYes     bool
+	promoteDryRun  bool
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Add a version to approved_versions across many files",
+	Long: `Adds --target-version to the approved_versions frontmatter of every local page
+matching the filters, and refreshes effectiveDate, after a single confirmation.
+Pages already approved for the version are left untouched.
+
+Filters (repeatable, all must match):
+  status=Same,Changed   Sync status, comma-separated (Synced is an alias of Same)
+  path=docs/guides/**   Glob on the repo-relative path
+  version=1.2           The page's 'version' frontmatter`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if promoteVersion == "" {
+			printFatal("Missing Version", fmt.Errorf("--target-version is required"))
+		}
+		match, err := parsePromoteFilters(promoteFilters)
+		if err != nil {
+			printFatal("Invalid Filter", err, "Use --filter status=Same, --filter path=docs/** or --filter version=1.0")
+		}
+
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			printFatal("Configuration Error", err)
+		}
+		if err := validateWikiDir(cfg.WikiDir); err != nil {
+			printFatal("Wiki Directory Invalid", err)
+		}
+
+		items, err := ScanAll(cfg)
+		if err != nil {
+			printFatal("Scan Failed", err)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].RelPath < items[j].RelPath })
+
+		var candidates []FileItem
+		for _, item := range items {
+			if item.LocalPath != "" && match(item) {
+				candidates = append(candidates, item)
+			}
+		}
+		pending := pendingPromotions(candidates, promoteVersion)
+
+		if len(pending) == 0 {
+			fmt.Println(styleSuccess.Render("No files to promote."))
+			return
+		}
+
+		fmt.Println(styleInfo.Render(fmt.Sprintf("Promoting %d file(s) to %s:", len(pending), promoteVersion)))
+		for _, p := range pending {
+			fmt.Printf("  %s %s (%s)\n", styleNew.Render("+"), p.item.RelPath, p.item.Status)
+		}
+		if promoteDryRun {
+			return
+		}
+
+		if !promoteYes {
+			confirm := false
+			err := huh.NewConfirm().
+				Title(fmt.Sprintf("Promote %d file(s) to %s?", len(pending), promoteVersion)).
+				Value(&confirm).
+				Run()
+			if err != nil || !confirm {
+				fmt.Println("Cancelled.")
+				return
+			}
+		}
+
+		if failed := writePromotions(pending); failed > 0 {
+			fmt.Println(styleErr.Render(fmt.Sprintf("%d file(s) could not be written.", failed)))
+			os.Exit(1)
+		}
+		fmt.Println(styleSuccess.Render(fmt.Sprintf("Promoted %d file(s) to %s", len(pending), promoteVersion)))
+	},
+}
+
+// promotion is a page and its content with the version added.
+type promotion struct {
+	item    FileItem
+	content string
+}
+
+// pendingPromotions adds version to each local item's approved_versions,
+// dropping items that are already approved or cannot be parsed.
+func pendingPromotions(items []FileItem, version string) []promotion {
+	var pending []promotion
+	for _, item := range items {
+		promoted, err := addVersion(item.LocalContent, version)
+		if err != nil {
+			fmt.Println(styleErr.Render(fmt.Sprintf("Skipping %s: %v", item.RelPath, err)))
+			continue
+		}
+		if promoted == item.LocalContent {
+			continue // Already approved
+		}
+		pending = append(pending, promotion{item, promoted})
+	}
+	return pending
+}
+
+// writePromotions writes the promoted pages, returning how many failed.
+func writePromotions(pending []promotion) int {
+	failed := 0
+	for _, p := range pending {
+		if err := writeText(p.item.LocalPath, p.content); err != nil {
+			fmt.Printf("  %s %s: %v\n", styleErr.Render("X"), p.item.RelPath, err)
+			failed++
+			continue
+		}
+		fmt.Printf("  %s %s\n", styleSuccess.Render("✓"), p.item.RelPath)
+	}
+	return failed
+}
+
+// parsePromoteFilters turns key=value filters into a predicate matching
+// items that satisfy every filter.
+func parsePromoteFilters(filters []string) (func(FileItem) bool, error) {
+	var preds []func(FileItem) bool
+	for _, f := range filters {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("filter %q is not key=value", f)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "status":
+			allowed := map[string]bool{}
+			for _, s := range strings.Split(value, ",") {
+				s = strings.ToLower(strings.TrimSpace(s))
+				if s == "synced" {
+					s = "same" // ScanAll reports synced, unchanged pages as Same
+				}
+				allowed[s] = true
+			}
+			preds = append(preds, func(item FileItem) bool { return allowed[strings.ToLower(item.Status)] })
+		case "path":
+			re, err := globToRegexp(filepath.ToSlash(value))
+			if err != nil {
+				return nil, err
+			}
+			preds = append(preds, func(item FileItem) bool { return re.MatchString(item.RelPath) })
+		case "version":
+			preds = append(preds, func(item FileItem) bool { return item.Version == value })
+		default:
+			return nil, fmt.Errorf("unknown filter key %q (expected status, path or version)", key)
+		}
+	}
+	return func(item FileItem) bool {
+		for _, p := range preds {
+			if !p(item) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func init() {
+	promoteCmd.Flags().StringVar(&promoteVersion, "target-version", "", "Version to add to approved_versions (required)")
+	promoteCmd.Flags().StringArrayVar(&promoteFilters, "filter", nil, "Only promote files matching key=value (status, path or version); repeatable")
+	promoteCmd.Flags().BoolVarP(&promoteYes, "yes", "y", false, "Skip the confirmation prompt")
+	promoteCmd.Flags().BoolVar(&promoteDryRun, "dry-run", false, "List the files that would be promoted without changing them")
+	rootCmd.AddCommand(promoteCmd)
+}
@@ -0,0 +1,233 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	proposeBranch string
+	proposeBase   string
+	proposeTitle  string
+	proposeBody   string
+)
+
+var proposeCmd = &cobra.Command{
+	Use:   "propose [file]",
+	Short: "Publish changes to the wiki as a pull request",
+	Long: `Creates a feature branch in the wiki clone, writes the selected changed and
+new pages to it (with links rewritten), commits and pushes the branch, and opens a
+pull request (a merge request on GitLab) so the edits are reviewed instead of
+pushed directly.
+
+The wiki clone's origin must be a regular repository: hosted wikis
+(owner/repo.wiki) do not accept pull requests. The API token is read from
+WIKI_TOKEN, or GITEA_TOKEN/GITHUB_TOKEN/GITLAB_TOKEN for the provider; without
+one the branch is still pushed and the pull request must be opened by hand.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			printFatal("Configuration Error", err)
+		}
+		if err := validateWikiDir(cfg.WikiDir); err != nil {
+			printFatal("Wiki Directory Invalid", err)
+		}
+
+		remote, err := getGitRemoteURL(cfg.WikiDir)
+		if err != nil {
+			printFatal("No Wiki Remote", err, "Add an 'origin' remote to the wiki clone.")
+		}
+		trimmed := strings.TrimSuffix(strings.TrimSpace(remote), ".git")
+		if strings.HasSuffix(trimmed, ".wiki") {
+			printFatal("Pull Requests Unsupported", fmt.Errorf("origin %s is a hosted wiki", remote),
+				"Hosted wikis do not accept pull requests; keep the wiki in a regular repository to use 'propose'.",
+				"Use 'wiki-docs push --push' to publish directly.")
+		}
+		repoURL := deriveWikiURLFromRemote(remote)
+
+		if out, err := exec.Command("git", "-C", cfg.WikiDir, "status", "--porcelain").Output(); err != nil {
+			printFatal("Git Status Failed", err)
+		} else if len(strings.TrimSpace(string(out))) > 0 {
+			printFatal("Wiki Clone Not Clean", fmt.Errorf("%s has uncommitted changes", cfg.WikiDir),
+				"Commit or stash them before proposing.")
+		}
+
+		// 1. Discovery: changed pages plus pages not yet in the wiki
+		targetFile := ""
+		if len(args) > 0 {
+			targetFile = args[0]
+		}
+		fmt.Println(styleInfo.Render("Scanning for changes..."))
+		items, err := ScanAll(cfg)
+		if err != nil {
+			printFatal("Scan Failed", err)
+		}
+
+		var candidates []FileItem
+		for _, item := range items {
+			if targetFile != "" {
+				normTarget := filepath.ToSlash(targetFile)
+				if item.RelPath != normTarget && !strings.HasSuffix(item.RelPath, normTarget) {
+					continue
+				}
+			}
+			switch item.Status {
+			case "Changed", "Legacy":
+				candidates = append(candidates, item)
+			case "Untracked":
+				item.WikiPath = ToWikiPath(item.RelPath, WikiPrefixBase)
+				candidates = append(candidates, item)
+			}
+		}
+		if len(candidates) == 0 {
+			fmt.Println(styleSuccess.Render("No changes to propose."))
+			return
+		}
+
+		// 2. Selection
+		var selected []FileItem
+		if targetFile != "" {
+			selected = candidates
+		} else {
+			selected = runInteractive(candidates)
+		}
+		if len(selected) == 0 {
+			fmt.Println("No files selected.")
+			return
+		}
+
+		// 3. Branch
+		original, err := currentBranch(cfg.WikiDir)
+		if err != nil {
+			printFatal("Git Branch Failed", err)
+		}
+		base := proposeBase
+		if base == "" {
+			base = defaultBaseBranch(cfg, original)
+		}
+		branch := proposeBranch
+		if branch == "" {
+			branch = "wiki-docs/" + time.Now().Format("20060102-150405")
+		}
+		if err := runGit("-C", cfg.WikiDir, "checkout", "-b", branch); err != nil {
+			printFatal("Branch Failed", err)
+		}
+		fmt.Println(styleInfo.Render("Created branch " + branch))
+		defer func() {
+			if original != "" {
+				if err := runGit("-C", cfg.WikiDir, "checkout", original); err != nil {
+					fmt.Println(styleErr.Render("Failed to return to " + original + ": " + err.Error()))
+				}
+			}
+		}()
+
+		// 4. Write
+		var written []FileItem
+		for _, item := range selected {
+			if item.Status != "Untracked" && !verifyPushable(cfg, item, true) {
+				continue
+			}
+			if !checkLint(cfg, item.RelPath, item.LocalContent) {
+				continue
+			}
+			content, assets := linksToWiki(cfg, item.RelPath, item.LocalContent, true)
+			item.Assets = assets
+			if err := writeText(filepath.Join(cfg.WikiDir, item.WikiPath), content); err != nil {
+				fmt.Println(styleErr.Render("Write failed: " + err.Error()))
+				continue
+			}
+			fmt.Printf("  %s %s\n", styleSuccess.Render("✓"), item.RelPath)
+			written = append(written, item)
+		}
+		if len(written) == 0 {
+			fmt.Println("Nothing written; abandoning branch.")
+			if original != "" {
+				runGit("-C", cfg.WikiDir, "checkout", original)
+				runGit("-C", cfg.WikiDir, "branch", "-D", branch)
+				original = ""
+			}
+			return
+		}
+
+		// 5. Commit and push the branch
+		if err := commitPages(cfg, "propose", written, regenerateSidebar(cfg)...); err != nil {
+			printFatal("Commit Failed", err)
+		}
+		recordRevisions(cfg, written)
+		if err := runGit("-C", cfg.WikiDir, "push", "-u", "origin", branch); err != nil {
+			printFatal("Push Failed", err)
+		}
+		fmt.Println(styleSuccess.Render("✓ Pushed branch " + branch))
+
+		// 6. Pull request
+		token := ""
+		for _, env := range cfg.Provider.TokenEnv() {
+			if token = os.Getenv(env); token != "" {
+				break
+			}
+		}
+		if token == "" {
+			fmt.Println(styleInfo.Render(fmt.Sprintf("No API token (%s); open a pull request from %s into %s at %s",
+				strings.Join(cfg.Provider.TokenEnv(), ", "), branch, base, repoURL)))
+			return
+		}
+
+		pr := PullRequest{Title: proposeTitle, Body: proposeBody, Head: branch, Base: base}
+		if pr.Title == "" {
+			pr.Title = fmt.Sprintf("docs: update %d wiki page(s)", len(written))
+		}
+		if pr.Body == "" {
+			var sb strings.Builder
+			sb.WriteString("Proposed by wiki-docs:\n\n")
+			for _, item := range written {
+				sb.WriteString("- " + item.RelPath + " → " + item.WikiPath + "\n")
+			}
+			pr.Body = sb.String()
+		}
+		prURL, err := cfg.Provider.OpenPullRequest(repoURL, token, pr)
+		if err != nil {
+			printFatal("Pull Request Failed", err, "The branch "+branch+" was pushed; open the pull request by hand.")
+		}
+		fmt.Println(styleSuccess.Render("✓ Opened pull request " + prURL))
+	},
+}
+
+// currentBranch returns the checked-out branch of a clone ("" when detached).
+func currentBranch(dir string) (string, error) {
+	out, err := exec.Command("git", "-C", dir, "branch", "--show-current").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// defaultBaseBranch picks the branch a proposal merges into: the target's
+// branch, else origin's default branch, else the branch proposing from.
+func defaultBaseBranch(cfg Config, current string) string {
+	if cfg.Branch != "" {
+		return cfg.Branch
+	}
+	out, err := exec.Command("git", "-C", cfg.WikiDir, "symbolic-ref", "--short", "refs/remotes/origin/HEAD").Output()
+	if err == nil {
+		if ref := strings.TrimPrefix(strings.TrimSpace(string(out)), "origin/"); ref != "" {
+			return ref
+		}
+	}
+	return current
+}
+
+func init() {
+	proposeCmd.Flags().StringVar(&proposeBranch, "branch", "", "Feature branch to create (default: wiki-docs/<timestamp>)")
+	proposeCmd.Flags().StringVar(&proposeBase, "base", "", "Branch to merge into (default: the target's branch, else origin's default branch)")
+	proposeCmd.Flags().StringVar(&proposeTitle, "title", "", "Pull request title")
+	proposeCmd.Flags().StringVar(&proposeBody, "body", "", "Pull request description (default: the list of pages)")
+	proposeCmd.Flags().StringVarP(&wikiCommitMsg, "message", "m", DefaultCommitTemplate, "Commit message template (Go text/template; fields: .Command .Files .WikiFiles .SourceSHA .SourceShort)")
+	addTargetFlag(proposeCmd)
+	rootCmd.AddCommand(proposeCmd)
+}
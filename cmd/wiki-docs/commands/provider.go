@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// WikiProvider describes the conventions of a hosted wiki: where raw page
+// content is served from and the names of its special pages.
+type WikiProvider struct {
+	Name        string
+	HomePage    string // Landing page filename
+	SidebarPage string // Navigation page filename
+
+	// rawURL returns the URL serving a page's markdown, given the repository
+	// web URL (e.g. https://host/owner/repo) and the wiki filename.
+	rawURL func(repoURL, wikiFile string) string
+	// decode extracts page markdown from a successful response body.
+	decode func(body []byte) (string, error)
+}
+
+var providers = map[string]WikiProvider{
+	"gitea": {
+		Name:        "gitea",
+		HomePage:    "Home.md",
+		SidebarPage: "_Sidebar.md",
+		rawURL: func(repoURL, wikiFile string) string {
+			return repoURL + "/wiki/raw/" + url.PathEscape(wikiFile)
+		},
+	},
+	"github": {
+		Name:        "github",
+		HomePage:    "Home.md",
+		SidebarPage: "_Sidebar.md",
+		rawURL: func(repoURL, wikiFile string) string {
+			u, err := url.Parse(repoURL)
+			if err != nil {
+				return repoURL + "/wiki/" + url.PathEscape(wikiFile)
+			}
+			return "https://raw.githubusercontent.com/wiki" + u.Path + "/" + url.PathEscape(wikiFile)
+		},
+	},
+	"gitlab": {
+		Name:        "gitlab",
+		HomePage:    "home.md",
+		SidebarPage: "_sidebar.md",
+		// GitLab has no raw wiki route; the REST API returns the page as JSON.
+		rawURL: func(repoURL, wikiFile string) string {
+			u, err := url.Parse(repoURL)
+			if err != nil {
+				return repoURL
+			}
+			project := url.PathEscape(strings.Trim(u.Path, "/"))
+			slug := url.PathEscape(strings.TrimSuffix(wikiFile, ".md"))
+			return fmt.Sprintf("%s://%s/api/v4/projects/%s/wikis/%s", u.Scheme, u.Host, project, slug)
+		},
+		decode: func(body []byte) (string, error) {
+			var page struct {
+				Content string `json:"content"`
+			}
+			if err := json.Unmarshal(body, &page); err != nil {
+				return "", fmt.Errorf("decode gitlab wiki page: %w", err)
+			}
+			return page.Content, nil
+		},
+	},
+}
+
+// DefaultProvider is used when a remote's host does not identify a provider.
+const DefaultProvider = "gitea"
+
+// GetProvider returns the named provider, or an error listing the valid names.
+func GetProvider(name string) (WikiProvider, error) {
+	p, ok := providers[strings.ToLower(name)]
+	if !ok {
+		return WikiProvider{}, fmt.Errorf("unknown wiki provider %q (expected gitea, github or gitlab)", name)
+	}
+	return p, nil
+}
+
+// DetectProvider guesses the provider from a git remote or repository URL.
+func DetectProvider(remote string) WikiProvider {
+	host := ""
+	if u, err := parseRemote(remote); err == nil {
+		host = strings.ToLower(u.Host)
+	}
+	switch {
+	case strings.Contains(host, "github"):
+		return providers["github"]
+	case strings.Contains(host, "gitlab"):
+		return providers["gitlab"]
+	}
+	return providers[DefaultProvider]
+}
+
+var scpRemote = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+):(.+)$`)
+
+// parseRemote normalizes https, ssh:// and scp-style (git@host:owner/repo)
+// remotes to an https repository URL without the .git or .wiki suffix.
+func parseRemote(remote string) (*url.URL, error) {
+	remote = strings.TrimSpace(remote)
+	if !strings.Contains(remote, "://") {
+		m := scpRemote.FindStringSubmatch(remote)
+		if m == nil {
+			return nil, fmt.Errorf("unrecognized remote %q", remote)
+		}
+		remote = "https://" + m[1] + "/" + m[2]
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "ssh" {
+		// The SSH port says nothing about where the web UI is served.
+		u.Host = u.Hostname()
+	}
+	if u.Scheme != "http" {
+		u.Scheme = "https"
+	}
+	u.User = nil
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, ".git"), ".wiki")
+	return u, nil
+}
+
+// RawURL returns the URL serving the markdown of wikiFile.
+func (p WikiProvider) RawURL(repoURL, wikiFile string) string {
+	return p.rawURL(strings.TrimSuffix(repoURL, "/"), wikiFile)
+}
+
+// PullRequest describes a proposed change from Head into Base.
+type PullRequest struct {
+	Title string
+	Body  string
+	Head  string // Branch holding the changes
+	Base  string // Branch to merge into
+}
+
+// TokenEnv lists the environment variables holding an API token for the
+// provider, in order of preference.
+func (p WikiProvider) TokenEnv() []string {
+	return []string{"WIKI_TOKEN", strings.ToUpper(p.Name) + "_TOKEN"}
+}
+
+// OpenPullRequest opens a pull request (a merge request on GitLab) in the
+// repository at repoURL and returns its web URL.
+func (p WikiProvider) OpenPullRequest(repoURL, token string, pr PullRequest) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(repoURL, "/"))
+	if err != nil {
+		return "", err
+	}
+	repoPath := strings.Trim(u.Path, "/")
+
+	var apiURL string
+	var payload map[string]string
+	var authHeader, authValue, urlField string
+	switch p.Name {
+	case "github":
+		api := u.Scheme + "://" + u.Host + "/api/v3"
+		if u.Host == "github.com" {
+			api = "https://api.github.com"
+		}
+		apiURL = api + "/repos/" + repoPath + "/pulls"
+		payload = map[string]string{"title": pr.Title, "body": pr.Body, "head": pr.Head, "base": pr.Base}
+		authHeader, authValue, urlField = "Authorization", "Bearer "+token, "html_url"
+	case "gitlab":
+		apiURL = fmt.Sprintf("%s://%s/api/v4/projects/%s/merge_requests", u.Scheme, u.Host, url.PathEscape(repoPath))
+		payload = map[string]string{"title": pr.Title, "description": pr.Body, "source_branch": pr.Head, "target_branch": pr.Base}
+		authHeader, authValue, urlField = "PRIVATE-TOKEN", token, "web_url"
+	default:
+		apiURL = u.Scheme + "://" + u.Host + "/api/v1/repos/" + repoPath + "/pulls"
+		payload = map[string]string{"title": pr.Title, "body": pr.Body, "head": pr.Head, "base": pr.Base}
+		authHeader, authValue, urlField = "Authorization", "token "+token, "html_url"
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(authHeader, authValue)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("http error: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from %s: %s", resp.StatusCode, apiURL, strings.TrimSpace(string(respBody)))
+	}
+
+	var created map[string]interface{}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return "", fmt.Errorf("decode %s pull request: %w", p.Name, err)
+	}
+	webURL, _ := created[urlField].(string)
+	return webURL, nil
+}
@@ -2,11 +2,10 @@ package commands
 
 import (
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/huh"
@@ -16,20 +15,28 @@ import (
 )
 
 var (
-	pullForce     bool
-	pullCheck     bool
-	pullDryRun    bool
-	pullURL       string
-	targetVersion string
-	keepAttrs     []string
-	docStyle      = lipgloss.NewStyle().Margin(1, 2)
+	pullForce       bool
+	pullCheck       bool
+	pullDryRun      bool
+	pullURL         string
+	targetVersion   string
+	pullConcurrency int
+	pullTimeout     time.Duration
+	pullRetries     int
+	pullNoCache     bool
+	keepAttrs       []string
+	docStyle        = lipgloss.NewStyle().Margin(1, 2)
 )
 
 var pullCmd = &cobra.Command{
-	Use:   "pull",
+	Use:   "pull [file]",
 	Short: "Sync wiki to local docs (Wiki -> Repo)",
 	Long: `Pulls changes from the wiki back to the local docs folder.
-Supports local wiki clone (default) or HTTP fetching via --url or auto-detected git remote.`,
+Supports local wiki clone (default) or HTTP fetching via --url or auto-detected git remote.
+Page URLs are derived per provider (Gitea, GitHub or GitLab; see --provider).
+When a file is given, only that page is discovered and updated.
+Local files that differ from what is pulled are first copied to
+.config/wiki-docs/backups/<timestamp>/.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg, err := getConfig(cmd)
 		if err != nil {
@@ -37,6 +44,17 @@ Supports local wiki clone (default) or HTTP fetching via --url or auto-detected
 			os.Exit(1)
 		}
 
+		// If target specified, discover only that path
+		targetFile := ""
+		if len(args) > 0 {
+			targetFile, err = pullTargetPath(cfg, args[0])
+			if err != nil {
+				fmt.Println(styleErr.Render(err.Error()))
+				os.Exit(1)
+			}
+			cfg.Sources = []string{targetFile}
+		}
+
 		// 0. Resolve Mode (Local vs URL)
 		useURL := pullURL != ""
 		if !useURL && cfg.WikiDir == "" {
@@ -45,7 +63,11 @@ Supports local wiki clone (default) or HTTP fetching via --url or auto-detected
 
 		_, errWiki := os.Stat(cfg.WikiDir)
 		if os.IsNotExist(errWiki) || pullURL != "" {
-			if pullURL == "" {
+			if pullURL == "" && cfg.WikiURL != "" {
+				pullURL = cfg.WikiURL
+				fmt.Println(styleInfo.Render("Using " + cfg.Target + " target URL: " + pullURL))
+				useURL = true
+			} else if pullURL == "" {
 				remote, err := getGitRemoteURL(cfg.RepoRoot)
 				if err == nil && remote != "" {
 					pullURL = deriveWikiURLFromRemote(remote)
@@ -79,6 +101,10 @@ Supports local wiki clone (default) or HTTP fetching via --url or auto-detected
 		}
 
 		if len(items) == 0 {
+			if targetFile != "" {
+				fmt.Println(styleInfo.Render(fmt.Sprintf("File '%s' is not in the wiki.", targetFile)))
+				return
+			}
 			fmt.Println(styleInfo.Render("No relevant files found."))
 			return
 		}
@@ -176,12 +202,20 @@ Supports local wiki clone (default) or HTTP fetching via --url or auto-detected
 					st.Render(item.ChangeType),
 					styleMeta.Render(metaDetails))
 			}
+
+			for _, item := range changedItems {
+				if item.ChangeType == "New" {
+					continue
+				}
+				fmt.Println()
+				fmt.Println(RenderDiff(item.RelPath, "wiki/"+item.WikiPath, item.LocalContent, item.WikiContent, diffStyle))
+			}
 			return
 		}
 
 		// 3. Interaction
 		var selected []FileItem
-		if pullForce {
+		if pullForce || targetFile != "" {
 			selected = changedItems
 		} else {
 			selected = runInteractive(changedItems)
@@ -189,83 +223,108 @@ Supports local wiki clone (default) or HTTP fetching via --url or auto-detected
 
 		// 4. Execution
 		if len(selected) > 0 {
-			fmt.Println(styleInfo.Render("Updating files..."))
-			for _, item := range selected {
-				// Reconstruct Content
-				cleanBody := stripFrontmatter(item.WikiContent)
-				finalContent := cleanBody
-
-				if len(keepAttrs) > 0 {
-					fm, _ := parseFrontmatter(item.WikiContent)
-					newFM := make(map[string]interface{})
-					for _, key := range keepAttrs {
-						if val, ok := fm[key]; ok {
-							newFM[key] = val
-						}
-					}
-					// Check if effectiveDate is in keepAttrs
-					found := false
-					for _, attr := range keepAttrs {
-						if attr == "effectiveDate" {
-							found = true
-							break
-						}
-					}
-					if found {
-						// Use current date
-						newFM["effectiveDate"] = time.Now().Format("2006-01-02")
-					}
-
-					// Update State (Sync Metadata)
-					// We calculate checksum of the CLEAN body we are about to save.
-					checksum := CalculateChecksum(cleanBody)
-
-					// Load State (SAFE: loading inside loop for now to ensure correctness)
-					state, _ := LoadState()
-					if state != nil && cfg.WikiDir != "" {
-						// Try to get SHA from local Wiki Repo
-						sha, _ := getFileGitRevision(cfg.WikiDir, item.WikiPath)
-						if sha != "" {
-							state.Update(item.RelPath, sha, checksum)
-							if err := state.Save(); err != nil {
-								// Log error but don't stop sync?
-								fmt.Printf("Warning: Failed to save state: %v\n", err)
-							}
-						}
-					}
+			pullItems(cfg, selected, useURL)
+		} else {
+			fmt.Println("No files updated.")
+		}
+	},
+}
 
-					if len(newFM) > 0 {
-						yamlBytes, err := yaml.Marshal(newFM)
-						if err == nil {
-							finalContent = fmt.Sprintf("---\n%s---\n\n%s", string(yamlBytes), cleanBody)
-						}
-					}
+// pullItems writes the wiki version of each selected page over its local
+// file, keeping the --keep-attrs frontmatter, backing up local edits and
+// recording the wiki revision in state.json. fromURL marks pages fetched over
+// HTTP, whose links are not rewritten against the local clone.
+func pullItems(cfg Config, selected []FileItem, fromURL bool) {
+	fmt.Println(styleInfo.Render("Updating files..."))
+	for _, item := range selected {
+		// Reconstruct Content
+		wikiContent := linksFromWiki(cfg, filepath.ToSlash(item.RelPath), item.WikiContent, !fromURL)
+		cleanBody := stripFrontmatter(wikiContent)
+		finalContent := cleanBody
+
+		if len(keepAttrs) > 0 {
+			fm, _ := parseFrontmatter(item.WikiContent)
+			newFM := make(map[string]interface{})
+			for _, key := range keepAttrs {
+				if val, ok := fm[key]; ok {
+					newFM[key] = val
 				}
+			}
+			// Check if effectiveDate is in keepAttrs
+			found := false
+			for _, attr := range keepAttrs {
+				if attr == "effectiveDate" {
+					found = true
+					break
+				}
+			}
+			if found {
+				// Use current date
+				newFM["effectiveDate"] = time.Now().Format("2006-01-02")
+			}
 
-				// Ensure dir
-				if err := os.MkdirAll(filepath.Dir(item.LocalPath), 0755); err != nil {
-					fmt.Printf("  %s %s: %v\n", styleErr.Render("X"), item.RelPath, err)
-					continue
+			// Update State (Sync Metadata)
+			// We calculate checksum of the CLEAN body we are about to save.
+			checksum := CalculateChecksum(cleanBody)
+
+			// Load State (SAFE: loading inside loop for now to ensure correctness)
+			state, _ := LoadState()
+			if state != nil && cfg.WikiDir != "" {
+				// Try to get SHA from local Wiki Repo
+				sha, _ := getFileGitRevision(cfg.WikiDir, item.WikiPath)
+				if sha != "" {
+					state.Update(item.RelPath, sha, checksum)
+					if err := state.Save(); err != nil {
+						// Log error but don't stop sync?
+						fmt.Printf("Warning: Failed to save state: %v\n", err)
+					}
 				}
+			}
 
-				if err := os.WriteFile(item.LocalPath, []byte(finalContent), 0644); err != nil {
-					fmt.Printf("  %s %s: %v\n", styleErr.Render("X"), item.RelPath, err)
-				} else {
-					fmt.Printf("  %s %s\n", styleSuccess.Render("✓"), item.RelPath)
+			if len(newFM) > 0 {
+				yamlBytes, err := yaml.Marshal(newFM)
+				if err == nil {
+					finalContent = fmt.Sprintf("---\n%s---\n\n%s", string(yamlBytes), cleanBody)
 				}
 			}
+		}
+
+		// Ensure dir
+		if err := os.MkdirAll(filepath.Dir(item.LocalPath), 0755); err != nil {
+			fmt.Printf("  %s %s: %v\n", styleErr.Render("X"), item.RelPath, err)
+			continue
+		}
+
+		// Keep a copy of local edits this overwrites
+		backup, err := backupLocal(cfg, filepath.ToSlash(item.RelPath), finalContent)
+		if err != nil {
+			fmt.Printf("  %s %s: backup failed, skipping: %v\n", styleErr.Render("X"), item.RelPath, err)
+			continue
+		}
+		if backup != "" {
+			rel, _ := filepath.Rel(cfg.RepoRoot, backup)
+			fmt.Printf("  %s %s backed up to %s\n", styleInfo.Render("↺"), item.RelPath, filepath.ToSlash(rel))
+		}
+
+		if err := writeText(item.LocalPath, finalContent); err != nil {
+			fmt.Printf("  %s %s: %v\n", styleErr.Render("X"), item.RelPath, err)
 		} else {
-			fmt.Println("No files updated.")
+			fmt.Printf("  %s %s\n", styleSuccess.Render("✓"), item.RelPath)
 		}
-	},
+	}
 }
 
 func init() {
 	pullCmd.Flags().BoolVarP(&pullForce, "force", "f", false, "Confirm all changes without prompt")
 	pullCmd.Flags().BoolVar(&pullCheck, "check", false, "Exit with code 1 if changes are detected")
 	pullCmd.Flags().BoolVar(&pullDryRun, "dry-run", false, "Print changes without applying them")
-	pullCmd.Flags().StringVar(&pullURL, "url", os.Getenv("WIKI_URL"), "Git Wiki URL to fetch from (env: WIKI_URL)")
+	pullCmd.Flags().StringVar(&pullURL, "url", os.Getenv("WIKI_URL"), "Repository web URL whose wiki to fetch from, e.g. https://github.com/owner/repo (env: WIKI_URL)")
 	pullCmd.Flags().StringVar(&targetVersion, "target-version", "", "Filter files by 'approved_versions' frontmatter")
+	pullCmd.Flags().IntVar(&pullConcurrency, "concurrency", 8, "Parallel page fetches when pulling over HTTP")
+	pullCmd.Flags().DurationVar(&pullTimeout, "timeout", 30*time.Second, "Timeout for each HTTP request")
+	pullCmd.Flags().IntVar(&pullRetries, "retries", 3, "Retries (with backoff) for failed or rate-limited HTTP requests")
+	pullCmd.Flags().BoolVar(&pullNoCache, "no-cache", false, "Ignore the ETag page cache in .config/wiki-docs/cache")
+	addTargetFlag(pullCmd)
 
 	// Support comma-separated env var for default
 	defaultKeep := []string{
@@ -286,6 +345,27 @@ func init() {
 	rootCmd.AddCommand(pullCmd)
 }
 
+// pullTargetPath resolves a pull [file] argument to a repo-relative path,
+// rejecting paths outside the configured sources.
+func pullTargetPath(cfg Config, arg string) (string, error) {
+	rel := arg
+	if filepath.IsAbs(rel) {
+		r, err := filepath.Rel(cfg.RepoRoot, rel)
+		if err != nil {
+			return "", err
+		}
+		rel = r
+	}
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	if !cfg.routes(rel) && cfg.Target != "" {
+		return "", fmt.Errorf("file '%s' is not routed to the '%s' wiki target", rel, cfg.Target)
+	}
+	if !cfg.routes(rel) {
+		return "", fmt.Errorf("file '%s' is not under the configured sources (%s)", rel, strings.Join(cfg.Sources, ", "))
+	}
+	return rel, nil
+}
+
 func discoverFilesLocal(cfg Config) ([]FileItem, error) {
 	var items []FileItem
 	files, err := os.ReadDir(cfg.WikiDir)
@@ -299,11 +379,10 @@ func discoverFilesLocal(cfg Config) ([]FileItem, error) {
 		}
 
 		wikiPath := filepath.Join(cfg.WikiDir, f.Name())
-		contentBytes, err := os.ReadFile(wikiPath)
+		content, err := readText(wikiPath)
 		if err != nil {
 			continue
 		}
-		content := string(contentBytes)
 
 		fm, _ := parseFrontmatter(content)
 
@@ -317,21 +396,8 @@ func discoverFilesLocal(cfg Config) ([]FileItem, error) {
 		relPath := strings.ReplaceAll(trimmed, "~", string(filepath.Separator))
 		localPath := filepath.Join(cfg.RepoRoot, relPath)
 
-		// Filter by Sources
-		allowed := false
-		for _, source := range cfg.Sources {
-			// Check if relPath starts with source
-			// Clean paths to be safe
-			cleanSource := filepath.Clean(source)
-			cleanRel := filepath.Clean(relPath)
-			if strings.HasPrefix(cleanRel, cleanSource) {
-				allowed = true
-				break
-			}
-		}
-
-		if !allowed {
-			// Skip files not in configured sources
+		// Filter by Sources (and the target's exclusions)
+		if !cfg.routes(relPath) {
 			continue
 		}
 
@@ -344,10 +410,9 @@ func discoverFilesLocal(cfg Config) ([]FileItem, error) {
 			status = "New"
 			changeType = "New"
 		} else if !info.IsDir() {
-			bytesLocal, _ := os.ReadFile(localPath)
-			localContent = string(bytesLocal)
+			localContent, _ = readText(localPath)
 
-			cleanWiki := stripFrontmatter(content)
+			cleanWiki := stripFrontmatter(linksFromWiki(cfg, filepath.ToSlash(relPath), content, false))
 			cleanLocal := stripFrontmatter(localContent)
 
 			bodyChanged := cleanWiki != cleanLocal
@@ -398,13 +463,14 @@ func discoverFilesLocal(cfg Config) ([]FileItem, error) {
 	return items, nil
 }
 
+// discoverFilesURL fetches the wiki page of every local file in the sources,
+// using --concurrency workers that share one fetcher (timeouts, retries and
+// the ETag cache).
 func discoverFilesURL(cfg Config, baseURL string) ([]FileItem, error) {
-	if !strings.HasSuffix(baseURL, "/") {
-		baseURL += "/"
-	}
-
-	var items []FileItem
+	baseURL = strings.TrimSuffix(baseURL, "/")
 
+	// 1. Collect local files
+	var paths []string
 	for _, source := range cfg.Sources {
 		absSourceDir := filepath.Join(cfg.RepoRoot, source)
 		if _, err := os.Stat(absSourceDir); os.IsNotExist(err) {
@@ -418,94 +484,140 @@ func discoverFilesURL(cfg Config, baseURL string) ([]FileItem, error) {
 			if info.IsDir() || filepath.Ext(path) != ".md" {
 				return nil
 			}
-
 			relPath, _ := filepath.Rel(cfg.RepoRoot, path)
-			relPath = filepath.ToSlash(relPath)
-
-			flattened := strings.ReplaceAll(relPath, "/", "~")
-			wikiFilename := WikiPrefixBase + flattened
-			url := baseURL + wikiFilename
-
-			resp, err := http.Get(url)
-			if err != nil {
-				return fmt.Errorf("http error: %w", err)
+			if !cfg.routes(filepath.ToSlash(relPath)) {
+				return nil
 			}
-			defer resp.Body.Close()
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			localContentBytes, _ := os.ReadFile(path)
-			localContent := string(localContentBytes)
+	var cache *PageCache
+	if !pullNoCache {
+		c, err := OpenPageCache(GetCacheDir(cfg.RepoRoot))
+		if err != nil {
+			fmt.Println(styleErr.Render("Page cache disabled: " + err.Error()))
+		} else {
+			cache = c
+		}
+	}
+	fetcher := NewPageFetcher(pullTimeout, pullRetries, cache)
 
-			if resp.StatusCode == 404 {
-				return nil
-			} else if resp.StatusCode != 200 {
-				return fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, url)
+	// 2. Fetch in parallel, keeping results in walk order
+	type result struct {
+		item  FileItem
+		found bool
+		err   error
+	}
+	results := make([]result, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := pullConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				item, found, err := discoverURLItem(cfg, fetcher, baseURL, paths[i])
+				results[i] = result{item, found, err}
 			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			wikiContent := string(bodyBytes)
+	var items []FileItem
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		if r.found {
+			items = append(items, r.item)
+		}
+	}
+	return items, nil
+}
 
-			status := "Same"
-			changeType := ""
+// discoverURLItem compares one local file with its fetched wiki page. found
+// is false when the wiki does not have the page.
+func discoverURLItem(cfg Config, fetcher *PageFetcher, baseURL, path string) (FileItem, bool, error) {
+	relPath, _ := filepath.Rel(cfg.RepoRoot, path)
+	relPath = filepath.ToSlash(relPath)
 
-			cleanWiki := stripFrontmatter(wikiContent)
-			cleanLocal := stripFrontmatter(localContent)
+	wikiFilename := ToWikiPath(relPath, WikiPrefixBase)
+	url := cfg.Provider.RawURL(baseURL, wikiFilename)
 
-			bodyChanged := cleanWiki != cleanLocal
+	wikiContent, found, err := fetcher.FetchPage(cfg.Provider, baseURL, wikiFilename)
+	if err != nil || !found {
+		return FileItem{}, false, err
+	}
 
-			localFM, _ := parseFrontmatter(localContent)
-			wikiFM, _ := parseFrontmatter(wikiContent)
+	wikiContent = normalizeText(wikiContent)
+	localContent, _ := readText(path)
 
-			expectedFM := make(map[string]interface{})
-			if len(keepAttrs) > 0 {
-				for _, key := range keepAttrs {
-					if val, ok := wikiFM[key]; ok {
-						expectedFM[key] = val
-					}
-				}
-				expectedFM["effectiveDate"] = time.Now().Format("2006-01-02")
-			}
+	status := "Same"
+	changeType := ""
 
-			metaChanged := false
-			var metaDiff []string
+	cleanWiki := stripFrontmatter(wikiContent)
+	cleanLocal := stripFrontmatter(localContent)
 
-			for k, v := range expectedFM {
-				localV, ok := localFM[k]
-				if !ok || fmt.Sprintf("%v", v) != fmt.Sprintf("%v", localV) {
-					metaChanged = true
-					metaDiff = append(metaDiff, k)
-				}
-			}
+	bodyChanged := cleanWiki != cleanLocal
 
-			if bodyChanged && metaChanged {
-				status = "Changed"
-				changeType = "Mixed"
-			} else if bodyChanged {
-				status = "Changed"
-				changeType = "Content"
-			} else if metaChanged {
-				status = "Changed"
-				changeType = "Meta"
+	localFM, _ := parseFrontmatter(localContent)
+	wikiFM, _ := parseFrontmatter(wikiContent)
+
+	expectedFM := make(map[string]interface{})
+	if len(keepAttrs) > 0 {
+		for _, key := range keepAttrs {
+			if val, ok := wikiFM[key]; ok {
+				expectedFM[key] = val
 			}
+		}
+		expectedFM["effectiveDate"] = time.Now().Format("2006-01-02")
+	}
 
-			items = append(items, FileItem{
-				WikiPath:     url,
-				LocalPath:    path,
-				RelPath:      relPath,
-				WikiContent:  wikiContent,
-				LocalContent: localContent,
-				Status:       status,
-				ChangeType:   changeType,
-				MetaDiff:     metaDiff,
-			})
+	metaChanged := false
+	var metaDiff []string
 
-			return nil
-		})
-		if err != nil {
-			return nil, err
+	for k, v := range expectedFM {
+		localV, ok := localFM[k]
+		if !ok || fmt.Sprintf("%v", v) != fmt.Sprintf("%v", localV) {
+			metaChanged = true
+			metaDiff = append(metaDiff, k)
 		}
 	}
 
-	return items, nil
+	if bodyChanged && metaChanged {
+		status = "Changed"
+		changeType = "Mixed"
+	} else if bodyChanged {
+		status = "Changed"
+		changeType = "Content"
+	} else if metaChanged {
+		status = "Changed"
+		changeType = "Meta"
+	}
+
+	return FileItem{
+		WikiPath:     url,
+		LocalPath:    path,
+		RelPath:      relPath,
+		WikiContent:  wikiContent,
+		LocalContent: localContent,
+		Status:       status,
+		ChangeType:   changeType,
+		MetaDiff:     metaDiff,
+	}, true, nil
 }
 
 // Interactive Runner with HUH
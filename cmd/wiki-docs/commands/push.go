@@ -96,123 +96,158 @@ For new files, use 'wiki-sync add'.`,
 			return
 		}
 
-		// 4. Processing
-		for _, item := range selected {
-			fmt.Println(strings.Repeat("=", 60))
-			fmt.Printf("Updating: %s\n", styleInfo.Render(item.RelPath))
-
-			// A. Revision Check
-			remoteSHA, err := getFileGitRevision(cfg.WikiDir, item.WikiPath)
-			if err != nil {
-				fmt.Println(styleErr.Render("Failed to get remote revision: " + err.Error()))
-				continue
-			}
+		pushItems(cfg, selected)
+	},
+}
 
-			var fmMap map[string]interface{}
-			if err := yaml.Unmarshal([]byte(item.LocalContent), &fmMap); err != nil {
-				// Invalid YAML in local file, might not have keys we check.
-				// Proceed but treat as empty map for checks?
-			}
+// pushItems reviews each selected page in $EDITOR, writes the confirmed ones
+// to the wiki clone, regenerates the sidebar and commits per --commit/--push.
+func pushItems(cfg Config, selected []FileItem) {
+	var written []FileItem
+	for _, item := range selected {
+		fmt.Println(strings.Repeat("=", 60))
+		fmt.Printf("Updating: %s\n", styleInfo.Render(item.RelPath))
 
-			// 1. ReadOnly Check
-			if val, ok := fmMap["readonly"]; ok {
-				if isRO, ok := val.(bool); ok && isRO {
-					fmt.Println(styleErr.Render("⛔ SKIPPING: File is marked as 'readonly'"))
-					continue
-				}
-			}
+		if !verifyPushable(cfg, item, true) {
+			continue
+		}
 
-			// 2. Integrity Checks (State-based)
-			state, _ := LoadState()
-			var storedSum, storedRev string
-			if state != nil {
-				if fState, ok := state.Get(item.RelPath); ok {
-					storedSum = fState.LastChecksum
-					storedRev = fState.LastRev
-				}
-			}
+		// B. Editor Review
+		tmpFile, err := os.CreateTemp("", "wiki-update-*.md")
+		if err != nil {
+			fmt.Println(styleErr.Render("Temp file error: " + err.Error()))
+			continue
+		}
+		tmpPath := tmpFile.Name()
+		if err := os.WriteFile(tmpPath, []byte(item.LocalContent), 0644); err != nil {
+			fmt.Println(styleErr.Render("Error writing temp file: " + err.Error()))
+			continue
+		}
+		tmpFile.Close()
 
-			if storedSum != "" {
-				localBody := stripFrontmatter(item.LocalContent)
-				calcSum := CalculateChecksum(localBody)
+		fmt.Println(styleInfo.Render("Launching $EDITOR..."))
+		editor := os.Getenv("EDITOR")
 
-				if storedSum != calcSum {
-					fmt.Println(styleErr.Render("⛔ INTEGRITY ERROR: Local file modified outside of wiki-sync workflow."))
-					fmt.Printf("  Stored Checksum: %s\n", storedSum)
-					fmt.Printf("  Actual Checksum: %s\n", calcSum)
-					fmt.Println(styleInfo.Render("This file is protected. Please revert local changes and edit via wiki or use 'wiki-sync pull'."))
-					continue
-				} else {
-					fmt.Println(styleSuccess.Render("✓ Integrity verified"))
-				}
-			}
+		cmd := exec.Command(editor, tmpPath)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Println(styleErr.Render("Editor failed: " + err.Error()))
+			os.Remove(tmpPath)
+			continue
+		}
 
-			// 3. Revision Check
-			localRev := storedRev
-
-			if remoteSHA != "" && localRev != "" && localRev != remoteSHA {
-				fmt.Println(styleErr.Render("⛔ STOMP DETECTED: Wiki has changed since last pull."))
-				fmt.Printf("  Local Revision:  %s\n", localRev)
-				fmt.Printf("  Remote Revision: %s\n", remoteSHA)
-				fmt.Println(styleInfo.Render("Please 'wiki-sync pull' to merge changes before pushing."))
-				continue
-			} else if remoteSHA != "" && localRev == "" {
-				fmt.Println(styleInfo.Render("⚠️  No local state found. Proceeding with caution."))
-			}
+		editedContent, _ := readText(tmpPath)
+		os.Remove(tmpPath)
 
-			fmt.Println(styleSuccess.Render(fmt.Sprintf("✓ Revision verified (%s)", remoteSHA)))
+		if !checkLint(cfg, item.RelPath, editedContent) {
+			fmt.Println("Skipped.")
+			continue
+		}
 
-			// B. Editor Review
-			tmpFile, err := os.CreateTemp("", "wiki-update-*.md")
-			if err != nil {
-				fmt.Println(styleErr.Render("Temp file error: " + err.Error()))
-				continue
-			}
-			tmpPath := tmpFile.Name()
-			if err := os.WriteFile(tmpPath, []byte(item.LocalContent), 0644); err != nil {
-				fmt.Println(styleErr.Render("Error writing temp file: " + err.Error()))
-				continue
-			}
-			tmpFile.Close()
-
-			fmt.Println(styleInfo.Render("Launching $EDITOR..."))
-			editor := os.Getenv("EDITOR")
-
-			cmd := exec.Command(editor, tmpPath)
-			cmd.Stdin = os.Stdin
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
-				fmt.Println(styleErr.Render("Editor failed: " + err.Error()))
-				os.Remove(tmpPath)
-				continue
-			}
+		preview, _ := linksToWiki(cfg, item.RelPath, editedContent, false)
+		fmt.Println(RenderDiff("wiki/"+item.WikiPath, item.RelPath, item.WikiContent, preview, diffStyle))
 
-			editedBytes, _ := os.ReadFile(tmpPath)
-			editedContent := string(editedBytes)
-			os.Remove(tmpPath)
+		// C. Confirm
+		confirm := false
+		err = huh.NewConfirm().
+			Title(fmt.Sprintf("Push updates to %s?", item.RelPath)).
+			Value(&confirm).
+			Run()
 
-			// C. Confirm
-			confirm := false
-			err = huh.NewConfirm().
-				Title(fmt.Sprintf("Push updates to %s?", item.RelPath)).
-				Value(&confirm).
-				Run()
+		if err != nil || !confirm {
+			fmt.Println("Skipped.")
+			continue
+		}
 
-			if err != nil || !confirm {
-				fmt.Println("Skipped.")
-				continue
-			}
+		// D. Write
+		editedContent, item.Assets = linksToWiki(cfg, item.RelPath, editedContent, true)
+		if len(item.Assets) > 0 {
+			fmt.Println(styleInfo.Render(fmt.Sprintf("Synced %d asset file(s)", len(item.Assets))))
+		}
+		destPath := filepath.Join(cfg.WikiDir, item.WikiPath)
+		if err := writeText(destPath, editedContent); err != nil {
+			fmt.Println(styleErr.Render("Write failed: " + err.Error()))
+		} else {
+			fmt.Println(styleSuccess.Render("✓ Updated"))
+			written = append(written, item)
+		}
+	}
 
-			// D. Write
-			destPath := filepath.Join(cfg.WikiDir, item.WikiPath)
-			if err := os.WriteFile(destPath, []byte(editedContent), 0644); err != nil {
-				fmt.Println(styleErr.Render("Write failed: " + err.Error()))
-			} else {
-				fmt.Println(styleSuccess.Render("✓ Updated"))
-			}
+	var navFiles []string
+	if len(written) > 0 {
+		navFiles = regenerateSidebar(cfg)
+	}
+	commitWritten(cfg, "push", written, navFiles...)
+}
+
+// verifyPushable runs push's safety checks on an item: readonly frontmatter,
+// local integrity against state.json (when checkIntegrity is set), and the
+// stomp check against the wiki revision. Problems are printed; it returns
+// false if the item must not be written to the wiki.
+func verifyPushable(cfg Config, item FileItem, checkIntegrity bool) bool {
+	// A. Revision Check
+	remoteSHA, err := getFileGitRevision(cfg.WikiDir, item.WikiPath)
+	if err != nil {
+		fmt.Println(styleErr.Render("Failed to get remote revision: " + err.Error()))
+		return false
+	}
+
+	var fmMap map[string]interface{}
+	if err := yaml.Unmarshal([]byte(item.LocalContent), &fmMap); err != nil {
+		// Invalid YAML in local file, might not have keys we check.
+		// Proceed but treat as empty map for checks?
+	}
+
+	// 1. ReadOnly Check
+	if val, ok := fmMap["readonly"]; ok {
+		if isRO, ok := val.(bool); ok && isRO {
+			fmt.Println(styleErr.Render("⛔ SKIPPING: File is marked as 'readonly'"))
+			return false
 		}
-	},
+	}
+
+	// 2. Integrity Checks (State-based)
+	state, _ := LoadState()
+	var storedSum, storedRev string
+	if state != nil {
+		if fState, ok := state.Get(item.RelPath); ok {
+			storedSum = fState.LastChecksum
+			storedRev = fState.LastRev
+		}
+	}
+
+	if checkIntegrity && storedSum != "" {
+		localBody := stripFrontmatter(item.LocalContent)
+		calcSum := CalculateChecksum(localBody)
+
+		if storedSum != calcSum {
+			fmt.Println(styleErr.Render("⛔ INTEGRITY ERROR: Local file modified outside of wiki-sync workflow."))
+			fmt.Printf("  Stored Checksum: %s\n", storedSum)
+			fmt.Printf("  Actual Checksum: %s\n", calcSum)
+			fmt.Println(styleInfo.Render("This file is protected. Please revert local changes and edit via wiki or use 'wiki-sync pull'."))
+			return false
+		} else {
+			fmt.Println(styleSuccess.Render("✓ Integrity verified"))
+		}
+	}
+
+	// 3. Revision Check
+	localRev := storedRev
+
+	if remoteSHA != "" && localRev != "" && localRev != remoteSHA {
+		fmt.Println(styleErr.Render("⛔ STOMP DETECTED: Wiki has changed since last pull."))
+		fmt.Printf("  Local Revision:  %s\n", localRev)
+		fmt.Printf("  Remote Revision: %s\n", remoteSHA)
+		fmt.Println(styleInfo.Render("Please 'wiki-sync pull' to merge changes before pushing."))
+		return false
+	} else if remoteSHA != "" && localRev == "" {
+		fmt.Println(styleInfo.Render("⚠️  No local state found. Proceeding with caution."))
+	}
+
+	fmt.Println(styleSuccess.Render(fmt.Sprintf("✓ Revision verified (%s)", remoteSHA)))
+	return true
 }
 
 // discoverFilesPush is deprecated, use ScanAll
@@ -221,5 +256,7 @@ func discoverFilesPush(cfg Config, target string) ([]FileItem, error) {
 }
 
 func init() {
+	addCommitFlags(pushCmd)
+	addTargetFlag(pushCmd)
 	rootCmd.AddCommand(pushCmd)
 }
@@ -13,9 +13,9 @@ var (
 
 	rootCmd = &cobra.Command{
 		Use:   "wiki-docs",
-		Short: "Manage documentation between local docs and Gitea Wiki",
+		Short: "Manage documentation between local docs and a Gitea, GitHub or GitLab wiki",
 		Long: `wiki-docs manages the synchronization and organization of documentation.
-It supports pushing local 'docs/' to a Gitea Wiki repository
+It supports pushing local 'docs/' to a Gitea, GitHub or GitLab wiki repository
 and pulling changes back, with support for interactive selection.`,
 	}
 )
@@ -35,4 +35,5 @@ func init() {
 	}
 
 	rootCmd.PersistentFlags().StringVar(&cfgWikiPath, "wiki-path", defaultWiki, "Path to the local clone of the wiki repository (env: WIKI_PATH)")
+	rootCmd.PersistentFlags().String("provider", os.Getenv("WIKI_PROVIDER"), "Wiki host: gitea, github or gitlab (default: detected from the origin remote; env: WIKI_PROVIDER)")
 }
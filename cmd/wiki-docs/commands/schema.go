@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultFrontmatterSchema is the scaffold written by 'schema init'.
+const defaultFrontmatterSchema = `# JSON Schema (in YAML) for page frontmatter, used by 'wiki-docs add'
+# and 'wiki-docs schema check'.
+$schema: "https://json-schema.org/draft/2020-12/schema"
+type: object
+required:
+  - title
+properties:
+  title:
+    type: string
+    minLength: 1
+  shortTitle:
+    type: string
+  intro:
+    type: string
+  version:
+    type: string
+  approved_versions:
+    oneOf:
+      - type: string
+      - type: array
+        items:
+          type: string
+  effectiveDate:
+    type: string
+    pattern: "^[0-9]{4}-[0-9]{2}-[0-9]{2}$"
+  review_status:
+    type: string
+    enum: [draft, review, approved, deprecated]
+  readonly:
+    type: boolean
+additionalProperties: true
+`
+
+var schemaInitForce bool
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Manage the frontmatter schema",
+}
+
+var schemaInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Scaffold .schemas/frontmatter.yaml in the wiki",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			printFatal("Configuration Error", err)
+		}
+		if err := validateWikiDir(cfg.WikiDir); err != nil {
+			printFatal("Wiki Directory Invalid", err)
+		}
+
+		existing := FrontmatterSchemaPath(cfg.WikiDir)
+		if _, err := os.Stat(existing); err == nil && !schemaInitForce {
+			printFatal("Schema Exists", fmt.Errorf("%s already exists", existing), "Use --force to overwrite it.")
+		}
+
+		dest := filepath.Join(cfg.WikiDir, ".schemas", "frontmatter.yaml")
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			printFatal("Mkdir Failed", err)
+		}
+		if err := os.WriteFile(dest, []byte(defaultFrontmatterSchema), 0644); err != nil {
+			printFatal("Write Failed", err)
+		}
+		fmt.Println(styleSuccess.Render("✓ Wrote " + dest))
+	},
+}
+
+var schemaCheckCmd = &cobra.Command{
+	Use:   "check [path glob]",
+	Short: "Validate local docs against the frontmatter schema",
+	Long: `Validates the frontmatter of every local doc (optionally only those matching a
+repo-relative glob such as 'docs/**/*.md') against the wiki's frontmatter schema,
+reporting each violation with its line. Exits 1 if any document is invalid.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			printFatal("Configuration Error", err)
+		}
+
+		schemaPath := FrontmatterSchemaPath(cfg.WikiDir)
+		if _, err := os.Stat(schemaPath); err != nil {
+			printFatal("No Schema", fmt.Errorf("no frontmatter schema in %s", filepath.Join(cfg.WikiDir, ".schemas")), "Run 'wiki-docs schema init' to scaffold one.")
+		}
+		schema, err := LoadFrontmatterSchema(schemaPath)
+		if err != nil {
+			printFatal("Invalid Schema", err)
+		}
+
+		var match *regexp.Regexp
+		if len(args) > 0 {
+			match, err = globToRegexp(filepath.ToSlash(args[0]))
+			if err != nil {
+				printFatal("Invalid Pattern", err)
+			}
+		}
+
+		items, err := ScanAll(cfg)
+		if err != nil {
+			printFatal("Scan Failed", err)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].RelPath < items[j].RelPath })
+
+		checked, failed := 0, 0
+		for _, item := range items {
+			if item.LocalPath == "" || (match != nil && !match.MatchString(item.RelPath)) {
+				continue
+			}
+			checked++
+			problems := frontmatterProblems(schema, item.LocalContent)
+			if len(problems) == 0 {
+				continue
+			}
+			failed++
+			fmt.Println(styleErr.Render("✗ " + item.RelPath))
+			for _, p := range problems {
+				loc := item.RelPath
+				if p.Line > 0 {
+					loc += ":" + strconv.Itoa(p.Line)
+				}
+				fmt.Printf("  %s %s: %s\n", styleInfo.Render(loc), p.Field, p.Message)
+				if p.Text != "" {
+					fmt.Printf("      %s\n", styleMeta.Render(p.Text))
+				}
+			}
+		}
+
+		if failed > 0 {
+			fmt.Println(styleErr.Render(fmt.Sprintf("%d of %d document(s) failed validation.", failed, checked)))
+			os.Exit(1)
+		}
+		fmt.Println(styleSuccess.Render(fmt.Sprintf("✓ %d document(s) valid.", checked)))
+	},
+}
+
+// schemaProblem is one schema violation located in a document.
+type schemaProblem struct {
+	Field   string // JSON pointer into the frontmatter, "/" for the whole object
+	Message string
+	Line    int    // 1-based line in the document, 0 if unknown
+	Text    string // The document line, for context
+}
+
+// frontmatterProblems validates a document and maps each leaf error back to
+// the frontmatter line it concerns.
+func frontmatterProblems(schema *jsonschema.Schema, content string) []schemaProblem {
+	err := validateFrontmatterWith(schema, content)
+	if err == nil {
+		return nil
+	}
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return []schemaProblem{{Field: "/", Message: err.Error()}}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	var root yaml.Node
+	if fm, _ := splitFrontmatter(content); fm != "" {
+		_ = yaml.Unmarshal([]byte(fm), &root)
+	}
+
+	var problems []schemaProblem
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, c := range e.Causes {
+				walk(c)
+			}
+			return
+		}
+		p := schemaProblem{Field: e.InstanceLocation, Message: e.Message}
+		if p.Field == "" {
+			p.Field = "/"
+		}
+		if line := yamlPointerLine(&root, e.InstanceLocation); line > 0 {
+			p.Line = line + 1 // Offset by the opening --- fence
+			if p.Line <= len(lines) {
+				p.Text = strings.TrimSpace(lines[p.Line-1])
+			}
+		} else if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+			p.Line = 1
+			p.Text = "---"
+		}
+		problems = append(problems, p)
+	}
+	walk(ve)
+	return problems
+}
+
+// yamlPointerLine returns the line (within the YAML text) of the node
+// addressed by a JSON pointer, or 0 if it cannot be found.
+func yamlPointerLine(root *yaml.Node, pointer string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind == 0 || pointer == "" {
+		return 0
+	}
+	line := node.Line
+	for _, tok := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		switch node.Kind {
+		case yaml.MappingNode:
+			found := false
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == tok {
+					line = node.Content[i].Line
+					node = node.Content[i+1]
+					found = true
+					break
+				}
+			}
+			if !found {
+				return line
+			}
+		case yaml.SequenceNode:
+			idx, err := strconv.Atoi(tok)
+			if err != nil || idx >= len(node.Content) {
+				return line
+			}
+			node = node.Content[idx]
+			line = node.Line
+		default:
+			return line
+		}
+	}
+	return line
+}
+
+func init() {
+	schemaInitCmd.Flags().BoolVar(&schemaInitForce, "force", false, "Overwrite an existing schema")
+	schemaCmd.AddCommand(schemaInitCmd)
+	schemaCmd.AddCommand(schemaCheckCmd)
+	rootCmd.AddCommand(schemaCmd)
+}
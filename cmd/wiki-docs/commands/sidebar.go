@@ -0,0 +1,219 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// generatedMarker tags pages written by the sidebar command. Pages without
+// it are hand-written and are only overwritten with --force.
+const generatedMarker = "<!-- generated by wiki-docs sidebar; edits will be overwritten -->"
+
+var (
+	sidebarDryRun bool
+	sidebarForce  bool
+	sidebarNoHome bool
+)
+
+var sidebarCmd = &cobra.Command{
+	Use:   "sidebar",
+	Short: "Generate the wiki sidebar and home page index",
+	Long: `Generates the sidebar (_Sidebar.md) and home page (Home.md) from the directory
+structure of the configured sources and the pages' frontmatter titles.
+Only pages that exist in the wiki are listed. Once generated, the sidebar is
+regenerated automatically by 'push'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			printFatal("Configuration Error", err)
+		}
+		if err := validateWikiDir(cfg.WikiDir); err != nil {
+			printFatal("Wiki Directory Invalid", err)
+		}
+
+		sidebar, home, err := buildNavigation(cfg)
+		if err != nil {
+			printFatal("Scan Failed", err)
+		}
+
+		pages := map[string]string{cfg.Provider.SidebarPage: sidebar}
+		if !sidebarNoHome {
+			pages[cfg.Provider.HomePage] = home
+		}
+
+		if sidebarDryRun {
+			for _, name := range []string{cfg.Provider.SidebarPage, cfg.Provider.HomePage} {
+				if content, ok := pages[name]; ok {
+					fmt.Println(styleInfo.Render("== " + name + " =="))
+					fmt.Println(content)
+				}
+			}
+			return
+		}
+
+		for name, content := range pages {
+			if err := writeGeneratedPage(cfg.WikiDir, name, content, sidebarForce); err != nil {
+				fmt.Println(styleErr.Render(err.Error()))
+				continue
+			}
+			fmt.Println(styleSuccess.Render("✓ Wrote " + name))
+		}
+	},
+}
+
+// navPage is a published page placed in the navigation tree.
+type navPage struct {
+	Title    string
+	Intro    string
+	PageName string // Wiki page name (filename without .md)
+}
+
+type navNode struct {
+	Name     string
+	Pages    []navPage
+	Children map[string]*navNode
+}
+
+// buildNavigation renders the sidebar and home page for all published pages.
+func buildNavigation(cfg Config) (sidebar string, home string, err error) {
+	items, err := ScanAll(cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	root := &navNode{Children: map[string]*navNode{}}
+	for _, item := range items {
+		if item.WikiPath == "" || item.LocalPath == "" {
+			continue
+		}
+		fm, _ := parseFrontmatter(item.LocalContent)
+		page := navPage{PageName: strings.TrimSuffix(item.WikiPath, ".md")}
+		page.Title, _ = fm["title"].(string)
+		if page.Title == "" {
+			page.Title = titleFromFilename(item.RelPath)
+		}
+		page.Intro, _ = fm["intro"].(string)
+
+		node := root
+		if dir := path.Dir(item.RelPath); dir != "." {
+			for _, part := range strings.Split(dir, "/") {
+				child, ok := node.Children[part]
+				if !ok {
+					child = &navNode{Name: part, Children: map[string]*navNode{}}
+					node.Children[part] = child
+				}
+				node = child
+			}
+		}
+		node.Pages = append(node.Pages, page)
+	}
+
+	homeLink := strings.TrimSuffix(cfg.Provider.HomePage, ".md")
+
+	var sb strings.Builder
+	sb.WriteString(generatedMarker + "\n\n")
+	sb.WriteString(fmt.Sprintf("**[Home](%s)**\n\n", homeLink))
+	writeNavTree(&sb, root, 0, false)
+	sidebar = sb.String()
+
+	sb.Reset()
+	sb.WriteString(generatedMarker + "\n\n# Documentation\n\n")
+	writeNavTree(&sb, root, 0, true)
+	home = sb.String()
+	return sidebar, home, nil
+}
+
+// writeNavTree writes pages before subdirectories, each sorted by name. The
+// home page variant also includes each page's intro.
+func writeNavTree(sb *strings.Builder, node *navNode, depth int, withIntro bool) {
+	indent := strings.Repeat("  ", depth)
+	sort.Slice(node.Pages, func(i, j int) bool { return node.Pages[i].Title < node.Pages[j].Title })
+	for _, p := range node.Pages {
+		line := fmt.Sprintf("%s- [%s](%s)", indent, p.Title, p.PageName)
+		if withIntro && p.Intro != "" {
+			line += " — " + strings.TrimSpace(p.Intro)
+		}
+		sb.WriteString(line + "\n")
+	}
+
+	names := make([]string, 0, len(node.Children))
+	for name := range node.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%s- **%s**\n", indent, titleFromFilename(name)))
+		writeNavTree(sb, node.Children[name], depth+1, withIntro)
+	}
+}
+
+// titleFromFilename turns "getting-started.md" into "Getting Started".
+func titleFromFilename(name string) string {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	words := strings.FieldsFunc(base, func(r rune) bool { return r == '-' || r == '_' || r == ' ' })
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	if len(words) == 0 {
+		return base
+	}
+	return strings.Join(words, " ")
+}
+
+// writeGeneratedPage writes a generated page, refusing to replace a
+// hand-written one unless force is set.
+func writeGeneratedPage(wikiDir, name, content string, force bool) error {
+	dest := filepath.Join(wikiDir, name)
+	if existing, err := os.ReadFile(dest); err == nil && !force && !strings.Contains(string(existing), generatedMarker) {
+		return fmt.Errorf("%s exists and was not generated by wiki-docs; use --force to replace it", name)
+	}
+	return os.WriteFile(dest, []byte(content), 0644)
+}
+
+// regenerateSidebar refreshes previously generated navigation pages after a
+// push. It returns the pages written so they can be committed.
+func regenerateSidebar(cfg Config) []string {
+	var targets []string
+	for _, name := range []string{cfg.Provider.SidebarPage, cfg.Provider.HomePage} {
+		data, err := os.ReadFile(filepath.Join(cfg.WikiDir, name))
+		if err == nil && strings.Contains(string(data), generatedMarker) {
+			targets = append(targets, name)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	sidebar, home, err := buildNavigation(cfg)
+	if err != nil {
+		fmt.Println(styleErr.Render("Sidebar regeneration failed: " + err.Error()))
+		return nil
+	}
+	var written []string
+	for _, name := range targets {
+		content := sidebar
+		if name == cfg.Provider.HomePage {
+			content = home
+		}
+		if err := writeGeneratedPage(cfg.WikiDir, name, content, false); err == nil {
+			written = append(written, name)
+		}
+	}
+	if len(written) > 0 {
+		fmt.Println(styleSuccess.Render("✓ Regenerated " + strings.Join(written, ", ")))
+	}
+	return written
+}
+
+func init() {
+	sidebarCmd.Flags().BoolVar(&sidebarDryRun, "dry-run", false, "Print the generated pages instead of writing them")
+	sidebarCmd.Flags().BoolVar(&sidebarForce, "force", false, "Replace existing pages that were not generated by wiki-docs")
+	sidebarCmd.Flags().BoolVar(&sidebarNoHome, "no-home", false, "Only generate the sidebar, not the home page index")
+	rootCmd.AddCommand(sidebarCmd)
+}
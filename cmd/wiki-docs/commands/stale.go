@@ -0,0 +1,210 @@
+package commands
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	staleOlderThan string
+	staleOwner     string
+	staleFormat    string
+)
+
+// StalePage is a page not reviewed within the --older-than window.
+type StalePage struct {
+	RelPath      string    `json:"relPath"`
+	WikiPath     string    `json:"wikiPath,omitempty"`
+	Owners       []string  `json:"owners,omitempty"`
+	LastReviewed time.Time `json:"lastReviewed"`
+	Source       string    `json:"source"` // "effectiveDate", "wiki history" or "never"
+	AgeDays      int       `json:"ageDays"`
+}
+
+var staleCmd = &cobra.Command{
+	Use:   "stale",
+	Short: "List pages that have not been reviewed recently",
+	Long: `Lists pages whose last review is older than --older-than, oldest first and
+grouped by owner. A page was last reviewed at the later of its frontmatter
+effectiveDate and its last commit in the wiki clone; owners come from the
+'authority' frontmatter field (a name or a list of names).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		maxAge, err := parseAge(staleOlderThan)
+		if err != nil {
+			printFatal("Invalid Age", err, "Use a number of days or weeks (180d, 26w) or a Go duration (4320h)")
+		}
+		if staleFormat != "text" && staleFormat != "json" {
+			printFatal("Invalid Format", fmt.Errorf("unknown format %q", staleFormat), "Use --format text or --format json")
+		}
+
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			printFatal("Configuration Error", err)
+		}
+		if err := validateWikiDir(cfg.WikiDir); err != nil {
+			printFatal("Wiki Directory Invalid", err)
+		}
+
+		items, err := ScanAll(cfg)
+		if err != nil {
+			printFatal("Scan Failed", err)
+		}
+
+		now := time.Now()
+		cutoff := now.Add(-maxAge)
+		stale := []StalePage{}
+		for _, item := range items {
+			page := stalePage(cfg, item)
+			if staleOwner != "" && !containsFold(page.Owners, staleOwner) {
+				continue
+			}
+			if !page.LastReviewed.IsZero() && page.LastReviewed.After(cutoff) {
+				continue
+			}
+			if !page.LastReviewed.IsZero() {
+				page.AgeDays = int(now.Sub(page.LastReviewed).Hours() / 24)
+			}
+			stale = append(stale, page)
+		}
+		sort.SliceStable(stale, func(i, j int) bool {
+			if !stale[i].LastReviewed.Equal(stale[j].LastReviewed) {
+				return stale[i].LastReviewed.Before(stale[j].LastReviewed)
+			}
+			return stale[i].RelPath < stale[j].RelPath
+		})
+
+		if staleFormat == "json" {
+			printJSON(stale)
+			return
+		}
+		if len(stale) == 0 {
+			fmt.Println(styleSuccess.Render(fmt.Sprintf("✓ Every page was reviewed within %s.", staleOlderThan)))
+			return
+		}
+
+		byOwner := map[string][]StalePage{}
+		for _, page := range stale {
+			owners := page.Owners
+			if len(owners) == 0 {
+				owners = []string{"(no authority)"}
+			}
+			for _, owner := range owners {
+				byOwner[owner] = append(byOwner[owner], page)
+			}
+		}
+		owners := make([]string, 0, len(byOwner))
+		for owner := range byOwner {
+			owners = append(owners, owner)
+		}
+		sort.Strings(owners)
+
+		for _, owner := range owners {
+			fmt.Println(styleInfo.Render(fmt.Sprintf("%s (%d)", owner, len(byOwner[owner]))))
+			for _, page := range byOwner[owner] {
+				when := styleErr.Render("never reviewed")
+				if !page.LastReviewed.IsZero() {
+					when = fmt.Sprintf("%s  %4dd  %s", page.LastReviewed.Format("2006-01-02"), page.AgeDays, styleMeta.Render(page.Source))
+				}
+				fmt.Printf("  %-60s %s\n", page.RelPath, when)
+			}
+		}
+		fmt.Println(styleNew.Render(fmt.Sprintf("%d page(s) not reviewed within %s.", len(stale), staleOlderThan)))
+	},
+}
+
+// stalePage derives a page's owners and last review date from its
+// frontmatter (local copy first) and the wiki clone's history.
+func stalePage(cfg Config, item FileItem) StalePage {
+	content := item.LocalContent
+	if content == "" {
+		content = item.WikiContent
+	}
+	fm, _ := parseFrontmatter(content)
+	page := StalePage{RelPath: item.RelPath, WikiPath: item.WikiPath, Owners: stringList(fm["authority"]), Source: "never"}
+
+	if d, ok := frontmatterDate(fm["effectiveDate"]); ok {
+		page.LastReviewed, page.Source = d, "effectiveDate"
+	}
+	if item.WikiPath != "" {
+		out, err := exec.Command("git", "-C", cfg.WikiDir, "log", "-n", "1", "--format=%cI", "--", item.WikiPath).Output()
+		if err == nil {
+			if d, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out))); err == nil && d.After(page.LastReviewed) {
+				page.LastReviewed, page.Source = d, "wiki history"
+			}
+		}
+	}
+	return page
+}
+
+// frontmatterDate accepts a YAML date (decoded as time.Time) or a
+// YYYY-MM-DD string.
+func frontmatterDate(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		d, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(t), time.Local)
+		return d, err == nil
+	}
+	return time.Time{}, false
+}
+
+// stringList reads a frontmatter value that is a string or a list of strings.
+func stringList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		if strings.TrimSpace(t) != "" {
+			return []string{strings.TrimSpace(t)}
+		}
+	case []interface{}:
+		var out []string
+		for _, s := range t {
+			if str := strings.TrimSpace(fmt.Sprint(s)); str != "" {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAge parses "180d" and "26w" as well as Go durations such as "4320h".
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+func init() {
+	staleCmd.Flags().StringVar(&staleOlderThan, "older-than", "180d", "Report pages last reviewed before this age (e.g. 180d, 26w)")
+	staleCmd.Flags().StringVar(&staleOwner, "owner", "", "Only report pages whose authority includes this owner")
+	staleCmd.Flags().StringVar(&staleFormat, "format", "text", "Output format: text or json")
+	rootCmd.AddCommand(staleCmd)
+}
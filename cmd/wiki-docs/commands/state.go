@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -25,28 +26,40 @@ func NewSyncState() *SyncState {
 	}
 }
 
+// stateTarget is the wiki target the current command syncs with; each named
+// target keeps its own state file since one page may publish to several.
+var stateTarget string
+
+// GetStatePath returns the project-local state file. State lives inside the
+// repo (next to config.yaml, ignored by git) so that two repos on the same
+// machine do not share entries keyed by the same relative paths.
 func GetStatePath() (string, error) {
-	home, err := os.UserHomeDir()
+	cwd, err := os.Getwd()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".config", "wiki-sync", "state.json"), nil
+	name := "state.json"
+	if stateTarget != "" {
+		name = "state." + stateTarget + ".json"
+	}
+	return filepath.Join(cwd, ".config", "wiki-docs", name), nil
 }
 
-func LoadState() (*SyncState, error) {
-	path, err := GetStatePath()
+// GetGlobalStatePath returns the pre-project-local state file, shared by all
+// repos, which LoadState migrates from.
+func GetGlobalStatePath() (string, error) {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return filepath.Join(home, ".config", "wiki-sync", "state.json"), nil
+}
 
+func readStateFile(path string) (*SyncState, error) {
 	data, err := os.ReadFile(path)
-	if os.IsNotExist(err) {
-		return NewSyncState(), nil
-	}
 	if err != nil {
 		return nil, err
 	}
-
 	var state SyncState
 	if err := json.Unmarshal(data, &state); err != nil {
 		return nil, err
@@ -57,6 +70,52 @@ func LoadState() (*SyncState, error) {
 	return &state, nil
 }
 
+func LoadState() (*SyncState, error) {
+	path, err := GetStatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := readStateFile(path)
+	if os.IsNotExist(err) {
+		if stateTarget != "" {
+			return NewSyncState(), nil
+		}
+		return migrateGlobalState()
+	}
+	return state, err
+}
+
+// migrateGlobalState seeds the project-local state from the global file,
+// taking only entries whose files exist in this repo. The global file is left
+// in place for other repos still to migrate.
+func migrateGlobalState() (*SyncState, error) {
+	state := NewSyncState()
+	globalPath, err := GetGlobalStatePath()
+	if err != nil {
+		return state, nil
+	}
+	global, err := readStateFile(globalPath)
+	if err != nil {
+		return state, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return state, nil
+	}
+	for relPath, fState := range global.Files {
+		if _, err := os.Stat(filepath.Join(cwd, filepath.FromSlash(relPath))); err == nil {
+			state.Files[relPath] = fState
+		}
+	}
+	if len(state.Files) > 0 {
+		if err := state.Save(); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
 func (s *SyncState) Save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -70,6 +129,11 @@ func (s *SyncState) Save() error {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
+	// Ignore every state file, including per-target ones added after an
+	// older .gitignore that only listed state.json.
+	if err := ensureIgnored(dir, "state*.json"); err != nil {
+		return err
+	}
 
 	data, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
@@ -79,6 +143,22 @@ func (s *SyncState) Save() error {
 	return os.WriteFile(path, data, 0644)
 }
 
+// ensureIgnored appends pattern to dir/.gitignore unless already listed.
+func ensureIgnored(dir, pattern string) error {
+	ignorePath := filepath.Join(dir, ".gitignore")
+	ignore, _ := os.ReadFile(ignorePath)
+	for _, line := range strings.Split(string(ignore), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return nil
+		}
+	}
+	if len(ignore) > 0 && !strings.HasSuffix(string(ignore), "\n") {
+		ignore = append(ignore, '\n')
+	}
+	ignore = append(ignore, pattern+"\n"...)
+	return os.WriteFile(ignorePath, ignore, 0644)
+}
+
 func (s *SyncState) Get(relPath string) (FileState, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
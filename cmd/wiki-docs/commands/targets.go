@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// WikiTarget is a named wiki that a subset of the sources publishes to,
+// declared under "targets" in config.yaml:
+//
+//	default_target: public
+//	targets:
+//	  public:
+//	    path: wiki
+//	    sources: [docs]
+//	    exclude: [docs/internal]
+//	  internal:
+//	    path: ../internal-wiki
+//	    url: https://git.example.com/org/internal-docs
+//	    branch: docs
+//	    provider: gitea
+//	    sources: [docs/internal]
+type WikiTarget struct {
+	Path     string   `yaml:"path"`     // Wiki clone, relative to the repo root
+	Branch   string   `yaml:"branch"`   // Remote branch --push publishes to (default: current branch)
+	Provider string   `yaml:"provider"` // Overrides the top-level provider
+	URL      string   `yaml:"url"`      // Repository web URL pull fetches from when the clone is missing
+	Sources  []string `yaml:"sources"`  // Defaults to the top-level sources
+	Exclude  []string `yaml:"exclude"`  // Paths under Sources routed elsewhere
+}
+
+var wikiTarget string
+
+// addTargetFlag registers --target on commands that write to or read from a
+// single wiki.
+func addTargetFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&wikiTarget, "target", "", "Named wiki target from config.yaml (default: default_target)")
+}
+
+// applyTarget resolves the target named by --target (or default_target) and
+// points cfg at its wiki. An explicit --wiki-path still wins over the
+// target's path. It returns the provider name the target asks for, if any.
+func applyTarget(cmd *cobra.Command, cfg *Config, targets map[string]WikiTarget, defaultTarget string) (string, error) {
+	name := defaultTarget
+	if f := cmd.Flags().Lookup("target"); f != nil && f.Value.String() != "" {
+		name = f.Value.String()
+	}
+	if name == "" {
+		return "", nil
+	}
+	t, ok := targets[name]
+	if !ok {
+		return "", fmt.Errorf("unknown wiki target %q (configured: %s)", name, targetNames(targets))
+	}
+
+	cfg.Target = name
+	cfg.Branch = t.Branch
+	cfg.WikiURL = t.URL
+	if t.Path != "" && !cmd.Flags().Changed("wiki-path") {
+		cfg.WikiDir = t.Path
+		if !filepath.IsAbs(cfg.WikiDir) {
+			cfg.WikiDir = filepath.Join(cfg.RepoRoot, cfg.WikiDir)
+		}
+	}
+	if len(t.Sources) > 0 {
+		cfg.Sources = t.Sources
+	}
+	cfg.Exclude = t.Exclude
+	stateTarget = name
+	return t.Provider, nil
+}
+
+func targetNames(targets map[string]WikiTarget) string {
+	if len(targets) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// routes reports whether a repo-relative path belongs to this config's wiki:
+// it lies under one of the sources and under none of the exclusions.
+func (cfg Config) routes(relPath string) bool {
+	rel := filepath.ToSlash(filepath.Clean(relPath))
+	under := func(dir string) bool {
+		dir = filepath.ToSlash(filepath.Clean(dir))
+		return dir == "." || rel == dir || strings.HasPrefix(rel, dir+"/")
+	}
+	for _, ex := range cfg.Exclude {
+		if under(ex) {
+			return false
+		}
+	}
+	for _, source := range cfg.Sources {
+		if under(source) {
+			return true
+		}
+	}
+	return false
+}
@@ -46,6 +46,16 @@ func LoadTemplates(wikiDir string) ([]TemplateItem, error) {
 	return templates, nil
 }
 
+// FrontmatterSchemaPath returns the frontmatter schema in the wiki clone,
+// preferring .schemas/frontmatter.yaml over .schemas/frontmatter.json.
+func FrontmatterSchemaPath(wikiDir string) string {
+	schemaPath := filepath.Join(wikiDir, ".schemas", "frontmatter.yaml")
+	if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
+		schemaPath = filepath.Join(wikiDir, ".schemas", "frontmatter.json")
+	}
+	return schemaPath
+}
+
 // ValidateFrontmatter validates the YAML frontmatter of a file against a JSON schema.
 func ValidateFrontmatter(content string, schemaPath string) error {
 	// 1. Check if schema exists
@@ -53,22 +63,27 @@ func ValidateFrontmatter(content string, schemaPath string) error {
 		return nil // No schema defined, skip validation
 	}
 
-	// 2. Extract and Parse YAML Frontmatter
-	fmMap, _ := parseFrontmatter(content)
-	if len(fmMap) == 0 {
-		// Should we fail if schema exists but no FM?
-		// Maybe. Let's assume yes strict if schema exists.
-		// But parseFrontmatter returns empty map if no FM.
-		// Let's validate the empty map against schema.
+	schema, err := LoadFrontmatterSchema(schemaPath)
+	if err != nil {
+		return err
 	}
 
-	// 3. Convert YAML Map to JSON (structure) for Validator
-	// jsonschema library works on Go objects (interface{}), so map[string]interface{} is fine,
-	// BUT it expects types compatible with JSON. YAML often unmarshals to map[interface{}]interface{} if not careful,
-	// but gopkg.in/yaml.v3 with map[string]interface{} should be fine.
-	// Actually, let's verify.
-	// We might need to marshal to JSON and unmarshal back to ensure types are strictly JSON-compatible (e.g. integer vs float).
+	// 2. Validate
+	if err := validateFrontmatterWith(schema, content); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	return nil
+}
+
+// validateFrontmatterWith validates a document's frontmatter against a
+// compiled schema. A document without frontmatter is validated as an empty
+// object, so required keys are still enforced.
+func validateFrontmatterWith(schema *jsonschema.Schema, content string) error {
+	fmMap, _ := parseFrontmatter(content)
 
+	// Round-trip through JSON so YAML types become JSON-compatible values
+	// (e.g. integers vs floats) for the validator.
 	jsonBytes, err := json.Marshal(fmMap)
 	if err != nil {
 		return fmt.Errorf("failed to convert frontmatter to JSON: %w", err)
@@ -79,46 +94,40 @@ func ValidateFrontmatter(content string, schemaPath string) error {
 		return fmt.Errorf("failed to parse JSON frontmatter: %w", err)
 	}
 
-	// 4. Compile Schema
+	return schema.Validate(jsonObj)
+}
+
+// LoadFrontmatterSchema compiles a JSON schema written in JSON or YAML.
+func LoadFrontmatterSchema(schemaPath string) (*jsonschema.Schema, error) {
 	compiler := jsonschema.NewCompiler()
-	// Allow loading schema from file
-	// We need to handle Windows paths for URL?
-	// jsonschema expects a URL. "file:///..."
-	// simpler to just AddResource directly if we read it?
 
 	schemaBytes, err := os.ReadFile(schemaPath)
 	if err != nil {
-		return fmt.Errorf("failed to read schema file: %w", err)
+		return nil, fmt.Errorf("failed to read schema file: %w", err)
 	}
 
 	// Handle YAML Schemas (transform to JSON object first)
 	if strings.HasSuffix(schemaPath, ".yaml") || strings.HasSuffix(schemaPath, ".yml") {
 		var schemaObj interface{}
 		if err := yaml.Unmarshal(schemaBytes, &schemaObj); err != nil {
-			return fmt.Errorf("failed to parse YAML schema: %w", err)
+			return nil, fmt.Errorf("failed to parse YAML schema: %w", err)
 		}
 		jsonBytes, err := json.Marshal(schemaObj)
 		if err != nil {
-			return fmt.Errorf("failed to convert YAML schema to JSON: %w", err)
+			return nil, fmt.Errorf("failed to convert YAML schema to JSON: %w", err)
 		}
 		schemaBytes = jsonBytes
 	}
 
 	if err := compiler.AddResource("schema.json", strings.NewReader(string(schemaBytes))); err != nil {
-		return fmt.Errorf("failed to compile schema: %w", err)
+		return nil, fmt.Errorf("failed to compile schema: %w", err)
 	}
 
 	schema, err := compiler.Compile("schema.json")
 	if err != nil {
-		return fmt.Errorf("failed to compile schema: %w", err)
-	}
-
-	// 5. Validate
-	if err := schema.Validate(jsonObj); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return nil, fmt.Errorf("failed to compile schema: %w", err)
 	}
-
-	return nil
+	return schema, nil
 }
 
 // FindInheritedTemplate looks for an applicable template in the wiki based on the local file path.
@@ -170,3 +179,87 @@ func FindInheritedTemplate(relPath string, wikiDir string) (string, string) {
 
 	return "", ""
 }
+
+// MergeTemplateFrontmatter injects a template's frontmatter into content.
+// Template keys supply defaults and existing keys win; the template's key
+// order is kept, followed by keys only the document has. The document body
+// is preserved, falling back to the template body when the document is empty.
+// Content whose existing frontmatter is not valid YAML is rejected rather
+// than given a second frontmatter block.
+func MergeTemplateFrontmatter(templateContent, content string) (string, error) {
+	tmplFM, tmplBody := splitFrontmatter(templateContent)
+	docFM, docBody := splitFrontmatter(content)
+
+	merged, err := yamlMapping(tmplFM)
+	if err != nil {
+		return "", fmt.Errorf("template frontmatter: %w", err)
+	}
+	existing, err := yamlMapping(docFM)
+	if err != nil {
+		return "", fmt.Errorf("existing frontmatter is not valid YAML: %w", err)
+	}
+
+	for i := 0; i+1 < len(existing.Content); i += 2 {
+		key, val := existing.Content[i], existing.Content[i+1]
+		replaced := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = val
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged.Content = append(merged.Content, key, val)
+		}
+	}
+
+	body := docBody
+	if strings.TrimSpace(body) == "" {
+		body = tmplBody
+	}
+	if len(merged.Content) == 0 {
+		return body, nil
+	}
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("---\n%s---\n\n%s", string(out), body), nil
+}
+
+// yamlMapping parses frontmatter text into a mapping node (empty if blank).
+func yamlMapping(text string) (*yaml.Node, error) {
+	empty := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if strings.TrimSpace(text) == "" {
+		return empty, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return empty, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("frontmatter is not a mapping")
+	}
+	return doc.Content[0], nil
+}
+
+// missingTemplateKeys lists the template frontmatter keys absent from content.
+func missingTemplateKeys(templateContent, content string) []string {
+	tmplFM, _ := splitFrontmatter(templateContent)
+	tmpl, err := yamlMapping(tmplFM)
+	if err != nil {
+		return nil
+	}
+	fm, _ := parseFrontmatter(content)
+	var missing []string
+	for i := 0; i+1 < len(tmpl.Content); i += 2 {
+		if _, ok := fm[tmpl.Content[i].Value]; !ok {
+			missing = append(missing, tmpl.Content[i].Value)
+		}
+	}
+	return missing
+}
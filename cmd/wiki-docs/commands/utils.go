@@ -35,9 +35,16 @@ func ToWikiPath(relPath string, prefix string) string {
 
 // Config holds the derived configuration
 type Config struct {
-	RepoRoot string
-	Sources  []string // Relative paths from RepoRoot, e.g. ["docs", ".gemini/skills"]
-	WikiDir  string
+	RepoRoot  string
+	Sources   []string // Relative paths from RepoRoot, e.g. ["docs", ".gemini/skills"]
+	Exclude   []string // Paths under Sources not routed to this wiki
+	WikiDir   string
+	Provider  WikiProvider      // Hosting conventions (gitea, github, gitlab)
+	Target    string            // Named wiki target, if config.yaml defines targets
+	Branch    string            // Remote wiki branch to push to (default: current)
+	WikiURL   string            // Repository web URL of the target's wiki, if configured
+	Lint      LintConfig        // Pre-publish link and markdown checks
+	Normalize TextNormalization // Line-ending and BOM handling
 }
 
 // FileItem represents a file to be synced
@@ -48,6 +55,7 @@ type FileItem struct {
 	WikiContent  string
 	LocalContent string
 	Status       string                 // "New", "Changed", "Same", "Runaway"
+	LegacyName   bool                   // The wiki page is named by an older convention, even if Status is "Changed"
 	ChangeType   string                 // "Content", "Meta", "Mixed", "New"
 	Version      string                 // Version from frontmatter
 	Approved     string                 // Approved versions from frontmatter
@@ -56,6 +64,7 @@ type FileItem struct {
 	ExpectedMeta []string               // Attributes expected from template
 	MetaDiff     []string
 	Selected     bool
+	Assets       []string // Asset files copied into the wiki alongside the page
 }
 
 // Styles
@@ -78,8 +87,14 @@ func getGitRemoteURL(dir string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
+// deriveWikiURLFromRemote converts a git remote (https, ssh or scp-style) to
+// the repository web URL that providers derive wiki page URLs from.
 func deriveWikiURLFromRemote(remote string) string {
-	return strings.TrimSuffix(remote, ".git")
+	u, err := parseRemote(remote)
+	if err != nil {
+		return strings.TrimSuffix(remote, ".git")
+	}
+	return u.String()
 }
 
 func getConfig(cmd *cobra.Command) (Config, error) {
@@ -89,6 +104,7 @@ func getConfig(cmd *cobra.Command) (Config, error) {
 	}
 
 	wikiDir, _ := cmd.Flags().GetString("wiki-path")
+	providerName, _ := cmd.Flags().GetString("provider")
 	if !filepath.IsAbs(wikiDir) {
 		wikiDir = filepath.Join(cwd, wikiDir)
 	}
@@ -98,6 +114,7 @@ func getConfig(cmd *cobra.Command) (Config, error) {
 		RepoRoot: cwd,
 		Sources:  []string{DefaultSource},
 		WikiDir:  wikiDir,
+		Lint:     DefaultLintConfig,
 	}
 
 	// Try to load config file
@@ -106,15 +123,56 @@ func getConfig(cmd *cobra.Command) (Config, error) {
 		data, err := os.ReadFile(configPath)
 		if err == nil {
 			var parsed struct {
-				Sources []string `yaml:"sources"`
+				Sources       []string              `yaml:"sources"`
+				Provider      string                `yaml:"provider"`
+				Targets       map[string]WikiTarget `yaml:"targets"`
+				DefaultTarget string                `yaml:"default_target"`
+				Lint          LintConfig            `yaml:"lint"`
+				Normalize     TextNormalization     `yaml:"normalize"`
 			}
 			if err := yaml.Unmarshal(data, &parsed); err == nil {
 				if len(parsed.Sources) > 0 {
 					cfg.Sources = parsed.Sources
 				}
+				if err := parsed.Lint.validate(); err != nil {
+					return Config{}, fmt.Errorf("%s: %w", configPath, err)
+				}
+				cfg.Lint = parsed.Lint
+				if err := parsed.Normalize.validate(); err != nil {
+					return Config{}, fmt.Errorf("%s: %w", configPath, err)
+				}
+				cfg.Normalize = parsed.Normalize
+				targetProvider, err := applyTarget(cmd, &cfg, parsed.Targets, parsed.DefaultTarget)
+				if err != nil {
+					return Config{}, err
+				}
+				if providerName == "" {
+					providerName = targetProvider
+				}
+				if providerName == "" {
+					providerName = parsed.Provider
+				}
 			}
 		}
 	}
+	if cfg.Target == "" && wikiTarget != "" {
+		return Config{}, fmt.Errorf("unknown wiki target %q (no targets in %s)", wikiTarget, configPath)
+	}
+
+	textNormalization = cfg.Normalize
+
+	// Provider: --provider, then config.yaml, then the origin remote's host
+	if providerName != "" {
+		p, err := GetProvider(providerName)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Provider = p
+	} else if remote, err := getGitRemoteURL(cwd); err == nil {
+		cfg.Provider = DetectProvider(remote)
+	} else {
+		cfg.Provider = providers[DefaultProvider]
+	}
 
 	return cfg, nil
 }
@@ -130,28 +188,6 @@ func validateWikiDir(path string) error {
 	return nil
 }
 
-// isGeminiIgnored checks if a path matches any pattern in .geminiignore
-func isGeminiIgnored(repoRoot, relPath string) bool {
-	ignorePath := filepath.Join(repoRoot, ".geminiignore")
-	data, err := os.ReadFile(ignorePath)
-	if err != nil {
-		return false
-	}
-
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		// Simple prefix or contains check for now (mirrors .gitignore basic usage)
-		if strings.HasPrefix(relPath, line) {
-			return true
-		}
-	}
-	return false
-}
-
 // printFatal prints a styled error message and exits with status 1
 func printFatal(title string, err error, suggestions ...string) {
 	fmt.Println()
@@ -239,7 +275,7 @@ func parseFrontmatter(content string) (map[string]interface{}, bool) {
 
 // Helper: Checksum
 func CalculateChecksum(content string) string {
-	hash := sha256.Sum256([]byte(content))
+	hash := sha256.Sum256([]byte(checksumText(content)))
 	return hex.EncodeToString(hash[:])
 }
 
@@ -281,7 +317,9 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 		wikiMap[wf] = wf
 	}
 
-	// 2. Discover Local Files (Respecting .gitignore)
+	// 2. Discover Local Files (Respecting .gitignore and .geminiignore)
+	gitIgnore := newGitIgnore(cfg.RepoRoot)
+	geminiIgnore := newGeminiIgnore(cfg.RepoRoot)
 	localFiles := make(map[string]string) // RelPath -> WikiName
 	for _, source := range cfg.Sources {
 		absSourceDir := filepath.Join(cfg.RepoRoot, source)
@@ -294,7 +332,9 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 				return err
 			}
 			if info.IsDir() {
-				// Don't skip dirs yet, check-ignore handles it
+				if path != absSourceDir && (info.Name() == ".git" || gitIgnore.Ignored(path, true) || geminiIgnore.Ignored(path, true)) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 			if filepath.Ext(path) != ".md" {
@@ -304,15 +344,13 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 			relPathRaw, _ := filepath.Rel(cfg.RepoRoot, path)
 			relPath := filepath.ToSlash(relPathRaw)
 
-			// Check if ignored by git
-			cmdIgnore := exec.Command("git", "check-ignore", "-q", relPath)
-			if err := cmdIgnore.Run(); err == nil {
-				// Exit code 0 means it IS ignored
+			// Skip paths excluded from this wiki target
+			if !cfg.routes(relPath) {
 				return nil
 			}
 
-			// Check if ignored by .geminiignore
-			if isGeminiIgnored(cfg.RepoRoot, relPath) {
+			// Check if ignored by git or .geminiignore
+			if gitIgnore.Ignored(path, false) || geminiIgnore.Ignored(path, false) {
 				return nil
 			}
 
@@ -321,8 +359,7 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 			localFiles[relPath] = wikiName
 
 			// Load contents
-			localContentBytes, _ := os.ReadFile(path)
-			localContent := string(localContentBytes)
+			localContent, _ := readText(path)
 
 			status := "New"
 			wikiContent := ""
@@ -339,6 +376,7 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 			wikiContent = ""
 			finalWikiPath = ""
 			found := false
+			legacy := false
 			actualWikiFile := ""
 
 			// A. Check Primary Match (src-docs~ + underscores)
@@ -352,6 +390,7 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 				if wf, ok := wikiMap[legacyName]; ok {
 					actualWikiFile = wf
 					status = "Legacy"
+					legacy = true
 					found = true
 				} else {
 					// C. Check Legacy-Hyphen (src-docs~ + hyphens)
@@ -359,6 +398,7 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 					if wf, ok := wikiMap[hyphenatedPrimary]; ok {
 						actualWikiFile = wf
 						status = "Legacy"
+						legacy = true
 						found = true
 					} else {
 						// D. Check Legacy-Hyphen (repo-root~ + hyphens)
@@ -366,6 +406,7 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 						if wf, ok := wikiMap[hyphenatedLegacy]; ok {
 							actualWikiFile = wf
 							status = "Legacy"
+							legacy = true
 							found = true
 						}
 					}
@@ -375,10 +416,11 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 			if found {
 				finalWikiPath = actualWikiFile
 				wikiPath := filepath.Join(cfg.WikiDir, actualWikiFile)
-				bytesWiki, _ := os.ReadFile(wikiPath)
-				wikiContent = string(bytesWiki)
+				wikiContent, _ = readText(wikiPath)
 
-				if CalculateChecksum(localContent) != CalculateChecksum(wikiContent) {
+				// Compare in wiki form so rewritten links don't count as changes
+				wikiForm, _ := linksToWiki(cfg, relPath, localContent, false)
+				if CalculateChecksum(wikiForm) != CalculateChecksum(wikiContent) {
 					status = "Changed"
 				} else if status == "Synced" {
 					status = "Same"
@@ -409,6 +451,7 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 				WikiContent:  wikiContent,
 				LocalContent: localContent,
 				Status:       status,
+				LegacyName:   legacy,
 				ChangeType:   status,
 				Version:      version,
 				Approved:     approved,
@@ -453,11 +496,11 @@ func ScanAll(cfg Config) ([]FileItem, error) {
 		if !matched {
 			// Runaway discovery
 			wikiPath := filepath.Join(cfg.WikiDir, actual)
-			bytesWiki, _ := os.ReadFile(wikiPath)
+			wikiContent, _ := readText(wikiPath)
 			items = append(items, FileItem{
 				WikiPath:    actual,
 				RelPath:     actual, // No easy local match
-				WikiContent: string(bytesWiki),
+				WikiContent: wikiContent,
 				Status:      "Orphan",
 				ChangeType:  "Orphan",
 			})
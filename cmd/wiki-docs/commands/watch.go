@@ -0,0 +1,217 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+var watchDebounce time.Duration
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Mirror saved docs into the wiki clone as they change",
+	Long: `Watches the configured source directories and, whenever a page that already
+exists in the wiki is saved, runs the same readonly and stomp checks as push and
+writes it to the wiki clone (with links rewritten). Use --commit/--push to
+commit each update.
+
+Integrity is checked once per page when the session starts: pages modified
+outside the workflow before 'watch' started are refused, while edits made
+during the session are trusted. New pages still go through 'wiki-docs add'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getConfig(cmd)
+		if err != nil {
+			printFatal("Configuration Error", err)
+		}
+		if err := validateWikiDir(cfg.WikiDir); err != nil {
+			printFatal("Wiki Directory Invalid", err)
+		}
+		if err := checkWikiBranch(cfg.WikiDir); err != nil {
+			fmt.Printf("⛔ %s\n", styleErr.Render(err.Error()))
+			os.Exit(1)
+		}
+
+		// Session baseline: which published pages passed the integrity check
+		items, err := ScanAll(cfg)
+		if err != nil {
+			printFatal("Scan Failed", err)
+		}
+		trusted := map[string]bool{}
+		for _, item := range items {
+			if item.LocalPath != "" && item.WikiPath != "" {
+				trusted[item.RelPath] = integrityOK(item)
+			}
+		}
+
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			printFatal("Watcher Failed", err)
+		}
+		defer watcher.Close()
+
+		for _, source := range cfg.Sources {
+			addWatchDirs(watcher, cfg, filepath.Join(cfg.RepoRoot, source))
+		}
+		fmt.Println(styleInfo.Render(fmt.Sprintf("Watching %s for changes (Ctrl+C to stop)...", strings.Join(cfg.Sources, ", "))))
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt)
+
+		if watchDebounce < 50*time.Millisecond {
+			watchDebounce = 50 * time.Millisecond
+		}
+		pending := map[string]time.Time{}
+		ticker := time.NewTicker(watchDebounce / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-sigCh:
+				fmt.Println(styleInfo.Render("Stopped watching."))
+				return
+			case err := <-watcher.Errors:
+				fmt.Println(styleErr.Render("Watch error: " + err.Error()))
+			case ev := <-watcher.Events:
+				if ev.Has(fsnotify.Create) {
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						addWatchDirs(watcher, cfg, ev.Name)
+						continue
+					}
+				}
+				if filepath.Ext(ev.Name) == ".md" && (ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create) || ev.Has(fsnotify.Rename)) {
+					pending[ev.Name] = time.Now()
+				}
+			case <-ticker.C:
+				var ready []string
+				for p, t := range pending {
+					if time.Since(t) >= watchDebounce {
+						ready = append(ready, p)
+						delete(pending, p)
+					}
+				}
+				if len(ready) > 0 {
+					mirrorSaved(cfg, ready, trusted)
+				}
+			}
+		}
+	},
+}
+
+// addWatchDirs watches root and its subdirectories, skipping .git and the
+// wiki clone itself when it lives inside the repo.
+func addWatchDirs(w *fsnotify.Watcher, cfg Config, root string) {
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if info.Name() == ".git" || p == cfg.WikiDir {
+			return filepath.SkipDir
+		}
+		if err := w.Add(p); err != nil {
+			fmt.Println(styleErr.Render("Cannot watch " + p + ": " + err.Error()))
+		}
+		return nil
+	})
+}
+
+// integrityOK reports whether a page's local body still matches the checksum
+// recorded at its last sync (or has no recorded state).
+func integrityOK(item FileItem) bool {
+	state, _ := LoadState()
+	if state == nil {
+		return true
+	}
+	fState, ok := state.Get(item.RelPath)
+	if !ok || fState.LastChecksum == "" {
+		return true
+	}
+	return fState.LastChecksum == CalculateChecksum(stripFrontmatter(item.LocalContent))
+}
+
+// mirrorSaved writes the saved pages to the wiki clone.
+func mirrorSaved(cfg Config, paths []string, trusted map[string]bool) {
+	items, err := ScanAll(cfg)
+	if err != nil {
+		fmt.Println(styleErr.Render("Scan failed: " + err.Error()))
+		return
+	}
+	byPath := map[string]FileItem{}
+	for _, item := range items {
+		if item.LocalPath != "" {
+			byPath[filepath.Clean(item.LocalPath)] = item
+		}
+	}
+
+	var written []FileItem
+	for _, p := range paths {
+		item, ok := byPath[filepath.Clean(p)]
+		if !ok {
+			continue // Ignored, deleted, or outside the sources
+		}
+		stamp := time.Now().Format("15:04:05")
+		if item.WikiPath == "" {
+			fmt.Printf("%s %s %s\n", stamp, styleNew.Render("+"), item.RelPath+" is not in the wiki; use 'wiki-docs add'")
+			continue
+		}
+		if item.Status == "Same" {
+			continue
+		}
+		ok, seen := trusted[item.RelPath]
+		if !seen {
+			// Published during the session (e.g. via add): check it now
+			ok = integrityOK(item)
+			trusted[item.RelPath] = ok
+		}
+		if !ok {
+			fmt.Printf("%s %s %s\n", stamp, styleErr.Render("⛔"), item.RelPath+" was modified outside the workflow before watch started")
+			continue
+		}
+		if !verifyPushable(cfg, item, false) || !checkLint(cfg, item.RelPath, item.LocalContent) {
+			continue
+		}
+
+		content, assets := linksToWiki(cfg, item.RelPath, item.LocalContent, true)
+		item.Assets = assets
+		if err := writeText(filepath.Join(cfg.WikiDir, item.WikiPath), content); err != nil {
+			fmt.Println(styleErr.Render("Write failed: " + err.Error()))
+			continue
+		}
+		fmt.Printf("%s %s %s\n", stamp, styleSuccess.Render("✓"), item.RelPath)
+		written = append(written, item)
+	}
+	if len(written) == 0 {
+		return
+	}
+
+	if wikiCommit || wikiCommitPush {
+		commitWritten(cfg, "watch", written, regenerateSidebar(cfg)...)
+		return
+	}
+
+	// Without a commit there is no new revision; keep the checksum current so
+	// the page stays trusted by later pushes.
+	regenerateSidebar(cfg)
+	if state, err := LoadState(); err == nil {
+		for _, item := range written {
+			if fState, ok := state.Get(item.RelPath); ok {
+				state.Update(item.RelPath, fState.LastRev, CalculateChecksum(stripFrontmatter(item.LocalContent)))
+			}
+		}
+		if err := state.Save(); err != nil {
+			fmt.Printf("Warning: Failed to save state: %v\n", err)
+		}
+	}
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 500*time.Millisecond, "Wait this long after the last change to a file before mirroring it")
+	addCommitFlags(watchCmd)
+	rootCmd.AddCommand(watchCmd)
+}
@@ -0,0 +1,97 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Alerts: Log and Webhook Notifications
+// ------------------------
+
+// Alert levels.
+const (
+	Warning  = "warning"
+	Critical = "critical"
+)
+
+// Alert is a notable condition detected by the indexer.
+type Alert struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Kind    string                 `json:"kind"` // e.g. "change-rate"
+	HostID  string                 `json:"hostID"`
+	Subject string                 `json:"subject"` // What the alert is about, e.g. a scan root
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// recentSize is how many alerts Recent keeps.
+const recentSize = 20
+
+// recent holds the latest alerts sent by this process, oldest first.
+var recent struct {
+	sync.Mutex
+	alerts []Alert
+}
+
+func remember(a Alert) {
+	recent.Lock()
+	defer recent.Unlock()
+	recent.alerts = append(recent.alerts, a)
+	if len(recent.alerts) > recentSize {
+		recent.alerts = recent.alerts[len(recent.alerts)-recentSize:]
+	}
+}
+
+// Recent returns up to n of the latest alerts sent by this process, newest
+// first.
+func Recent(n int) []Alert {
+	recent.Lock()
+	defer recent.Unlock()
+	out := make([]Alert, 0, min(n, len(recent.alerts)))
+	for i := len(recent.alerts) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, recent.alerts[i])
+	}
+	return out
+}
+
+// Send logs an alert and POSTs it as JSON to each URL in the
+// "alertWebhooks" config value. Webhook failures are logged, not returned.
+func Send(a Alert) {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	if a.HostID == "" {
+		a.HostID = utils.HostID
+	}
+	log.Printf("ALERT [%s] %s %s: %s", a.Level, a.Kind, a.Subject, a.Message)
+	remember(a)
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		log.Printf("Alert: failed to encode: %v", err)
+		return
+	}
+	for _, url := range viper.GetStringSlice("alertWebhooks") {
+		resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			log.Printf("Alert: webhook %s: %v", url, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Alert: webhook %s: unexpected status %s", url, resp.Status)
+		}
+	}
+}
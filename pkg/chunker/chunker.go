@@ -0,0 +1,202 @@
+package chunker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+
+	"github.com/zeebo/blake3"
+)
+
+// ------------------------
+// Content-Defined Chunking (FastCDC)
+// ------------------------
+
+// Chunk is a span of a file whose boundaries were chosen by content, so an
+// insertion or deletion only changes the chunks around it.
+type Chunk struct {
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	Hash   string `json:"blake3"` // BLAKE3 of the chunk's bytes
+}
+
+// Options are the chunk size bounds. Avg must be a power of two between Min
+// and Max.
+type Options struct {
+	Min int `json:"min"`
+	Avg int `json:"avg"`
+	Max int `json:"max"`
+}
+
+// DefaultOptions gives chunks of about 64 KiB, between 16 KiB and 256 KiB.
+var DefaultOptions = Options{Min: 16 << 10, Avg: 64 << 10, Max: 256 << 10}
+
+// Validate checks that the bounds can be chunked with.
+func (o Options) Validate() error {
+	if o.Min <= 0 || o.Min > o.Avg || o.Avg > o.Max {
+		return fmt.Errorf("chunk sizes must satisfy 0 < min <= avg <= max (got %d/%d/%d)", o.Min, o.Avg, o.Max)
+	}
+	if o.Avg&(o.Avg-1) != 0 {
+		return fmt.Errorf("average chunk size %d is not a power of two", o.Avg)
+	}
+	return nil
+}
+
+// gear is the table of random values rolled into the fingerprint, one per
+// byte value. It is generated from a fixed seed (with splitmix64) so that
+// every node cuts the same content at the same places.
+var gear [256]uint64
+
+func init() {
+	seed := uint64(0x6472_6561_6d66_7321) // "dreamfs!"
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker splits a stream into chunks with FastCDC: a gear hash over the
+// bytes past the minimum size, cut where its top bits are zero. Normalized
+// chunking uses a stricter mask before the average size and a looser one
+// after it, which pulls chunk sizes towards the average.
+type Chunker struct {
+	r            io.Reader
+	opts         Options
+	maskS, maskL uint64
+
+	buf        []byte
+	start, end int // Unconsumed bytes of buf
+	offset     int64
+	eof        bool
+	last       []byte
+}
+
+// New returns a Chunker reading from r.
+func New(r io.Reader, opts Options) (*Chunker, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	// The top bits of the fingerprint depend on the last 64 bytes, so the
+	// masks are taken from there: two bits more than the average calls for
+	// before it, two bits fewer after it
+	avgBits := bits.Len(uint(opts.Avg)) - 1
+	return &Chunker{
+		r:     r,
+		opts:  opts,
+		maskS: topBits(avgBits + 2),
+		maskL: topBits(max(avgBits-2, 1)),
+		buf:   make([]byte, 2*opts.Max),
+	}, nil
+}
+
+func topBits(n int) uint64 {
+	return ^uint64(0) << (64 - min(n, 64))
+}
+
+// Next returns the next chunk, or io.EOF after the last one. The chunk's
+// bytes are available from Bytes until the following call.
+func (c *Chunker) Next() (Chunk, error) {
+	if err := c.fill(); err != nil {
+		return Chunk{}, err
+	}
+	if c.start == c.end {
+		return Chunk{}, io.EOF
+	}
+	data := c.buf[c.start:c.end]
+	n := c.cut(data)
+	c.last = data[:n]
+	ch := Chunk{Offset: c.offset, Length: n, Hash: fmt.Sprintf("%x", blake3.Sum256(c.last))}
+	c.start += n
+	c.offset += int64(n)
+	return ch, nil
+}
+
+// Bytes returns the content of the chunk last returned by Next.
+func (c *Chunker) Bytes() []byte {
+	return c.last
+}
+
+// fill reads until a maximum-size chunk is buffered or the input ends.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.opts.Max {
+		return nil
+	}
+	// Move the remainder to the front; a chunk returned earlier is no
+	// longer needed
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+	for c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if c.end >= c.opts.Max {
+			return nil
+		}
+	}
+	return nil
+}
+
+// cut returns the length of the chunk at the start of data.
+func (c *Chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.opts.Min {
+		return n
+	}
+	n = min(n, c.opts.Max)
+	normal := min(n, c.opts.Avg)
+	var fp uint64
+	i := c.opts.Min
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Split returns all chunks of r.
+func Split(r io.Reader, opts Options) ([]Chunk, error) {
+	c, err := New(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []Chunk
+	for {
+		ch, err := c.Next()
+		if errors.Is(err, io.EOF) {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, ch)
+	}
+}
+
+// SplitFile returns all chunks of the file at path.
+func SplitFile(path string, opts Options) ([]Chunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+	return Split(f, opts)
+}
@@ -0,0 +1,142 @@
+package chunker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/zeebo/blake3"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts Options
+		ok   bool
+	}{
+		{DefaultOptions, true},
+		{Options{Min: 1, Avg: 1, Max: 1}, true},
+		{Options{Min: 64, Avg: 256, Max: 1024}, true},
+		{Options{Min: 0, Avg: 256, Max: 1024}, false},
+		{Options{Min: 512, Avg: 256, Max: 1024}, false},
+		{Options{Min: 64, Avg: 2048, Max: 1024}, false},
+		{Options{Min: 64, Avg: 300, Max: 1024}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v.Validate() = %v, want ok %v", tt.opts, err, tt.ok)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	small := Options{Min: 256, Avg: 1024, Max: 4096}
+	tests := []struct {
+		name string
+		data []byte
+		opts Options
+	}{
+		{"empty", nil, small},
+		{"below min", randomBytes(1, 100), small},
+		{"exactly max", randomBytes(2, 4096), small},
+		{"random", randomBytes(3, 200_000), small},
+		{"zeros", make([]byte, 50_000), small},
+		{"default options", randomBytes(4, 1<<20), DefaultOptions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := Split(bytes.NewReader(tt.data), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var offset int64
+			for i, ch := range chunks {
+				if ch.Offset != offset {
+					t.Fatalf("chunk %d starts at %d, want %d", i, ch.Offset, offset)
+				}
+				last := i == len(chunks)-1
+				if ch.Length > tt.opts.Max || ch.Length < tt.opts.Min && !last || ch.Length == 0 {
+					t.Errorf("chunk %d has length %d outside %d..%d", i, ch.Length, tt.opts.Min, tt.opts.Max)
+				}
+				data := tt.data[ch.Offset : ch.Offset+int64(ch.Length)]
+				if want := fmt.Sprintf("%x", blake3.Sum256(data)); ch.Hash != want {
+					t.Errorf("chunk %d hash = %s, want %s", i, ch.Hash, want)
+				}
+				offset += int64(ch.Length)
+			}
+			if offset != int64(len(tt.data)) {
+				t.Errorf("chunks cover %d bytes, want %d", offset, len(tt.data))
+			}
+		})
+	}
+}
+
+// Short reads must not move the cut points.
+func TestSplitReaderIndependent(t *testing.T) {
+	data := randomBytes(5, 300_000)
+	opts := Options{Min: 512, Avg: 2048, Max: 8192}
+	want, err := Split(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers := map[string]io.Reader{
+		"one byte": iotest.OneByteReader(bytes.NewReader(data)),
+		"half":     iotest.HalfReader(bytes.NewReader(data)),
+		"data+EOF": iotest.DataErrReader(bytes.NewReader(data)),
+	}
+	for name, r := range readers {
+		got, err := Split(r, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: chunks differ from a plain reader", name)
+		}
+	}
+}
+
+// An insertion only changes the chunks around it.
+func TestSplitInsertion(t *testing.T) {
+	data := randomBytes(6, 500_000)
+	opts := Options{Min: 512, Avg: 2048, Max: 8192}
+	edited := append(append(append([]byte{}, data[:250_000]...), "inserted"...), data[250_000:]...)
+	before, err := Split(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := Split(bytes.NewReader(edited), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := map[string]bool{}
+	for _, ch := range before {
+		hashes[ch.Hash] = true
+	}
+	changed := 0
+	for _, ch := range after {
+		if !hashes[ch.Hash] {
+			changed++
+		}
+	}
+	if changed == 0 || changed > 3 {
+		t.Errorf("%d of %d chunks changed after an insertion, want 1 to 3", changed, len(after))
+	}
+}
+
+func TestSplitError(t *testing.T) {
+	r := io.MultiReader(bytes.NewReader(randomBytes(7, 10_000)), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := Split(r, Options{Min: 256, Avg: 1024, Max: 4096}); err != io.ErrUnexpectedEOF {
+		t.Errorf("Split error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := New(bytes.NewReader(nil), Options{}); err == nil {
+		t.Error("New accepted invalid options")
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"os"
 	"time"
 
 	"github.com/fatih/color"
@@ -33,9 +34,11 @@ func InitConfig(cfgFile string) {
 		viper.SetConfigType("json")
 	}
 	viper.AutomaticEnv()
+	// On stderr, so that output piped from a command (e.g. hash-stream
+	// --tee) is only the command's
 	if err := viper.ReadInConfig(); err == nil {
-		color.Magenta("Using config file: %s", viper.ConfigFileUsed())
+		color.New(color.FgMagenta).Fprintf(os.Stderr, "Using config file: %s\n", viper.ConfigFileUsed())
 	} else {
-		color.Yellow("No config file found; using defaults and flags")
+		color.New(color.FgYellow).Fprintln(os.Stderr, "No config file found; using defaults and flags")
 	}
 }
\ No newline at end of file
@@ -0,0 +1,221 @@
+// Package dedupe finds files with identical content across hosts using the
+// BLAKE3 fingerprints recorded in the store.
+//
+// The store is scanned into a separate BoltDB index keyed by fingerprint, so
+// duplicate groups can be read back in fingerprint order without holding the
+// whole store in memory.
+package dedupe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+const (
+	// latestBucket keeps the newest record per "<hostID>|<path>".
+	latestBucket = "latest"
+	// fingerprintBucket keys copies by "<blake3>\x00<hostID>|<path>".
+	fingerprintBucket = "fingerprints"
+)
+
+const keySep = 0x00
+
+// Copy is one file holding a piece of content.
+type Copy struct {
+	HostID  string `json:"hostID"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"modTime"`
+}
+
+// Group is a piece of content held by more than one file.
+type Group struct {
+	BLAKE3 string `json:"blake3"`
+	Size   int64  `json:"size"`
+	Copies []Copy `json:"copies"`
+}
+
+// Reclaimable returns the bytes freed by keeping one copy per host, counting
+// only hostID's copies unless hostID is empty.
+func (g Group) Reclaimable(hostID string) int64 {
+	perHost := map[string]int{}
+	for _, c := range g.Copies {
+		perHost[c.HostID]++
+	}
+	var n int
+	for host, copies := range perHost {
+		if hostID == "" || host == hostID {
+			n += copies - 1
+		}
+	}
+	return int64(n) * g.Size
+}
+
+// Index is the fingerprint index built from a store.
+type Index struct {
+	db *bolt.DB
+}
+
+// DefaultIndexPath places the index next to the store it is built from.
+func DefaultIndexPath(dbPath string) string {
+	return dbPath + ".dedupe"
+}
+
+// Build (re)creates the index at path from the latest revision of every file
+// in ps. Zero-byte files, records without a fingerprint and deleted files
+// are skipped.
+func Build(ps *storage.PersistentStore, path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open dedupe index: %w", err)
+	}
+	ix := &Index{db: db}
+	if err := ix.rebuild(ps); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ix, nil
+}
+
+func (ix *Index) rebuild(ps *storage.PersistentStore) error {
+	err := ix.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{latestBucket, fingerprintBucket} {
+			if tx.Bucket([]byte(name)) != nil {
+				if err := tx.DeleteBucket([]byte(name)); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reset dedupe index: %w", err)
+	}
+
+	// Pass 1: the newest revision per host and path, written in batches
+	const batchSize = 1000
+	var batch []metadata.FileMetadata
+	flush := func() error {
+		err := ix.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(latestBucket))
+			for _, meta := range batch {
+				key := []byte(meta.HostID + "|" + meta.FilePath)
+				if old := b.Get(key); old != nil {
+					var cur Copy
+					if err := json.Unmarshal(old[bytes.IndexByte(old, keySep)+1:], &cur); err == nil && cur.ModTime >= meta.ModTime {
+						continue
+					}
+				}
+				c, err := json.Marshal(Copy{HostID: meta.HostID, Path: meta.FilePath, Size: meta.Size, ModTime: meta.ModTime})
+				if err != nil {
+					return err
+				}
+				value := append(append([]byte(meta.BLAKE3), keySep), c...)
+				if err := b.Put(key, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		batch = batch[:0]
+		return err
+	}
+	err = ps.ForEach(func(meta metadata.FileMetadata) error {
+		if meta.Archived() {
+			return nil // Retired hosts hold no copies
+		}
+		if batch = append(batch, meta); len(batch) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		return fmt.Errorf("index latest revisions: %w", err)
+	}
+
+	// Pass 2: re-key the latest revisions by fingerprint. Tombstones have
+	// neither a fingerprint nor a size, so they drop out with empty files.
+	err = ix.db.Update(func(tx *bolt.Tx) error {
+		fp := tx.Bucket([]byte(fingerprintBucket))
+		return tx.Bucket([]byte(latestBucket)).ForEach(func(k, v []byte) error {
+			i := bytes.IndexByte(v, keySep)
+			var c Copy
+			if err := json.Unmarshal(v[i+1:], &c); err != nil {
+				return err
+			}
+			if i == 0 || c.Size == 0 {
+				return nil
+			}
+			key := append(append(append([]byte(nil), v[:i]...), keySep), k...)
+			return fp.Put(key, v[i+1:])
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("index fingerprints: %w", err)
+	}
+	return nil
+}
+
+// Close closes the index.
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+// Groups streams every fingerprint held by more than one file, in
+// fingerprint order. Copies are sorted by host, then path.
+func (ix *Index) Groups(fn func(Group) error) error {
+	return ix.db.View(func(tx *bolt.Tx) error {
+		var cur Group
+		emit := func() error {
+			if len(cur.Copies) < 2 {
+				return nil
+			}
+			sort.Slice(cur.Copies, func(i, j int) bool {
+				if cur.Copies[i].HostID != cur.Copies[j].HostID {
+					return cur.Copies[i].HostID < cur.Copies[j].HostID
+				}
+				return cur.Copies[i].Path < cur.Copies[j].Path
+			})
+			return fn(cur)
+		}
+		err := tx.Bucket([]byte(fingerprintBucket)).ForEach(func(k, v []byte) error {
+			hash := string(k[:bytes.IndexByte(k, keySep)])
+			if hash != cur.BLAKE3 {
+				if err := emit(); err != nil {
+					return err
+				}
+				cur = Group{BLAKE3: hash}
+			}
+			var c Copy
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			cur.Size = c.Size
+			cur.Copies = append(cur.Copies, c)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return emit()
+	})
+}
@@ -0,0 +1,95 @@
+package dedupe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Script modes for WriteScript.
+const (
+	ModeHardlink = "hardlink"
+	ModeDelete   = "delete"
+)
+
+// WriteScript writes a POSIX shell script that resolves the duplicates on
+// hostID: in each group the first copy on the host is kept and the host's
+// other copies are replaced by hardlinks to it or deleted. Deleted copies
+// are moved into quarantine by running indexer (the command line of the
+// indexer, which the script appends "quarantine add" to), so they can be
+// restored for a while. Copies on other hosts are left alone. Every action
+// is guarded by cmp, so files whose sampled fingerprints collide without
+// identical content are never touched, and files that are already
+// hardlinked are skipped.
+func WriteScript(w io.Writer, groups []Group, hostID, mode string, indexer []string) error {
+	if mode != ModeHardlink && mode != ModeDelete {
+		return fmt.Errorf("unknown script mode %q (expected %s or %s)", mode, ModeHardlink, ModeDelete)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#!/bin/sh\n# Generated by 'indexer dedupe --script %s' for host %s.\n", mode, commentText(hostID))
+	switch mode {
+	case ModeHardlink:
+		fmt.Fprintln(bw, "# Hardlinks only work within one filesystem; ln reports the others.")
+	case ModeDelete:
+		fmt.Fprintln(bw, "# Deleted copies are quarantined; see 'indexer quarantine list'.")
+		quoted := make([]string, len(indexer))
+		for i, arg := range indexer {
+			quoted[i] = shellWord(arg)
+		}
+		fmt.Fprintf(bw, "quarantine() { %s quarantine add --reason dedupe -- \"$1\"; }\n", strings.Join(quoted, " "))
+	}
+	fmt.Fprintln(bw, "# Review before running.")
+
+	for _, g := range groups {
+		var local []Copy
+		for _, c := range g.Copies {
+			if c.HostID == hostID {
+				local = append(local, c)
+			}
+		}
+		if len(local) < 2 {
+			continue
+		}
+		keep := shellQuote(local[0].Path)
+		fmt.Fprintf(bw, "\n# %s (%d bytes), keeping %s\n", commentText(g.BLAKE3), g.Size, commentText(local[0].Path))
+		for _, c := range local[1:] {
+			extra := shellQuote(c.Path)
+			switch mode {
+			case ModeHardlink:
+				fmt.Fprintf(bw, "[ %s -ef %s ] || { cmp -s %s %s && ln -f %s %s; }\n", keep, extra, keep, extra, keep, extra)
+			case ModeDelete:
+				fmt.Fprintf(bw, "[ %s -ef %s ] || { cmp -s %s %s && quarantine %s; }\n", keep, extra, keep, extra, extra)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// shellQuote single-quotes s for sh, prefixing "./" to paths starting with
+// "-" so they are not taken as options.
+func shellQuote(s string) string {
+	if strings.HasPrefix(s, "-") {
+		s = "./" + s
+	}
+	return shellWord(s)
+}
+
+// commentText makes s safe to print in a comment: with a newline or other
+// control character, which would end the comment and let the rest of s run
+// as commands, it is printed Go-quoted instead.
+func commentText(s string) string {
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// shellWord single-quotes s for sh.
+func shellWord(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
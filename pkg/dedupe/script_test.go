@@ -0,0 +1,127 @@
+package dedupe
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommentText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/data/a.txt", "/data/a.txt"},
+		{"/data/naïve 日本.txt", "/data/naïve 日本.txt"},
+		{"/data/it's $HOME `x`", "/data/it's $HOME `x`"},
+		{"/data/a\nrm -rf ~", `"/data/a\nrm -rf ~"`},
+		{"/data/a\rb", `"/data/a\rb"`},
+		{"/data/a\x00b", `"/data/a\x00b"`},
+		{"/data/a\u2028b", `"/data/a\u2028b"`},
+		{"/data/a\x1b[2Jb", `"/data/a\x1b[2Jb"`},
+	}
+	for _, tt := range tests {
+		if got := commentText(tt.in); got != tt.want {
+			t.Errorf("commentText(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a", "'a'"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"$(x) `y` \"z\"", "'$(x) `y` \"z\"'"},
+		{"-rf", "'./-rf'"},
+		{"a\nb", "'a\nb'"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// The script is run against files whose names try to break out of quotes
+// and comments; it must link the copies and run nothing else.
+func TestWriteScriptHostilePaths(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	names := []string{
+		"keep.txt",
+		"x'; touch PWNED; echo '",
+		"y\ntouch PWNED",
+		"$(touch PWNED)",
+		"`touch PWNED`",
+		"-f",
+	}
+	group := Group{BLAKE3: "abc\ntouch PWNED", Size: 5}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("same\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		group.Copies = append(group.Copies, Copy{HostID: "h", Path: path})
+	}
+	group.Copies = append(group.Copies, Copy{HostID: "other", Path: filepath.Join(dir, "elsewhere")})
+
+	var script bytes.Buffer
+	if err := WriteScript(&script, []Group{group}, "h\ntouch PWNED", ModeHardlink, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The host in the header is hostile too, but then no copy is local
+	if strings.Contains(script.String(), "ln -f") {
+		t.Fatalf("script for another host links files:\n%s", script.String())
+	}
+	script.Reset()
+	if err := WriteScript(&script, []Group{group}, "h", ModeHardlink, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(sh, "-")
+	cmd.Dir = dir
+	cmd.Stdin = &script
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("script failed: %v\n%s\nscript:\n%s", err, out, script.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "PWNED")); err == nil {
+		t.Fatalf("script ran an injected command:\n%s", script.String())
+	}
+	keep, err := os.Stat(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names[1:] {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(keep, info) {
+			t.Errorf("%q was not linked to %q", name, names[0])
+		}
+	}
+}
+
+func TestWriteScriptMode(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteScript(&b, nil, "h", "move", nil); err == nil {
+		t.Error("WriteScript accepted an unknown mode")
+	}
+	b.Reset()
+	if err := WriteScript(&b, nil, "h", ModeDelete, []string{"/opt/my indexer", "--db=it's"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `quarantine() { '/opt/my indexer' '--db=it'\''s' quarantine add --reason dedupe -- "$1"; }`
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("script lacks %s:\n%s", want, b.String())
+	}
+}
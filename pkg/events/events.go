@@ -0,0 +1,96 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Change Events and Sinks
+// ------------------------
+
+// Event is a change of the store's change log (see storage.Change), as sent
+// to sinks.
+type Event struct {
+	Seq     uint64                 `json:"seq"`
+	ID      string                 `json:"id"`
+	Rev     string                 `json:"rev"`
+	Deleted bool                   `json:"deleted,omitempty"`
+	HostID  string                 `json:"hostID"` // The node publishing the event
+	Doc     *metadata.FileMetadata `json:"doc,omitempty"`
+}
+
+// Sink receives change events.
+type Sink interface {
+	// Publish sends an event. It may buffer it until Flush.
+	Publish(e Event) error
+	// Flush returns once every event published so far is delivered.
+	Flush() error
+	Close() error
+}
+
+// Open returns the sink at target:
+//
+//	http://... or https://...      a webhook: each event is POSTed as JSON
+//	nats://[user:pass@]host[:port]/subject
+//	                               each event is published to the subject
+//
+// headers are added to webhook requests, e.g. for authorization.
+func Open(target string, headers http.Header) (Sink, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink %q: %w", target, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &webhookSink{url: target, headers: headers}, nil
+	case "nats":
+		return dialNATS(u)
+	}
+	return nil, fmt.Errorf("unsupported sink %q (use an http(s):// webhook or a nats:// subject)", target)
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookSink POSTs each event to a URL, one request per event, and counts
+// anything but a 2xx response as a failed delivery.
+type webhookSink struct {
+	url     string
+	headers http.Header
+}
+
+func (s *webhookSink) Publish(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for name, values := range s.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Dreamfs-Seq", strconv.FormatUint(e.Seq, 10))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: unexpected status %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Flush() error { return nil } // Publish delivers
+
+func (s *webhookSink) Close() error { return nil }
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ------------------------
+// NATS Sink
+// ------------------------
+
+// natsSink publishes events with the core NATS text protocol: no
+// JetStream, no TLS. PUBs are buffered, and Flush round-trips a PING, which
+// the server answers after processing everything sent before it, or with
+// an -ERR.
+type natsSink struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	w          *bufio.Writer
+	subject    string
+	maxPayload int
+}
+
+const (
+	natsDefaultPort = "4222"
+	natsTimeout     = 10 * time.Second
+)
+
+// natsInfo is the part of the server's INFO the sink uses.
+type natsInfo struct {
+	MaxPayload  int  `json:"max_payload"`
+	TLSRequired bool `json:"tls_required"`
+}
+
+// dialNATS connects to the server of a nats:// URL, authenticating with its
+// user and password, or its user alone as a token.
+func dialNATS(u *url.URL) (*natsSink, error) {
+	subject := strings.TrimPrefix(u.Path, "/")
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("nats sink %s needs a subject, e.g. nats://%s/dreamfs.changes", u.Redacted(), u.Host)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), natsDefaultPort)
+	}
+	conn, err := net.DialTimeout("tcp", addr, natsTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s := &natsSink{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), subject: subject}
+	if err := s.handshake(u.User); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats %s: %w", addr, err)
+	}
+	return s, nil
+}
+
+func (s *natsSink) handshake(user *url.Userinfo) error {
+	line, err := s.readLine()
+	if err != nil {
+		return err
+	}
+	infoJSON, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		return fmt.Errorf("invalid INFO: %w", err)
+	}
+	if info.TLSRequired {
+		return errors.New("server requires TLS, which the nats sink does not support")
+	}
+	s.maxPayload = info.MaxPayload
+
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "dreamfs", "lang": "go", "protocol": 0}
+	if user != nil {
+		if pass, ok := user.Password(); ok {
+			opts["user"], opts["pass"] = user.Username(), pass
+		} else {
+			opts["auth_token"] = user.Username()
+		}
+	}
+	connect, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.w, "CONNECT %s\r\n", connect)
+	return s.Flush() // Confirms the server accepted the connection
+}
+
+func (s *natsSink) readLine() (string, error) {
+	s.conn.SetReadDeadline(time.Now().Add(natsTimeout))
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (s *natsSink) Publish(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if s.maxPayload > 0 && len(data) > s.maxPayload {
+		return fmt.Errorf("event %d is %d bytes, over the server's limit of %d", e.Seq, len(data), s.maxPayload)
+	}
+	fmt.Fprintf(s.w, "PUB %s %d\r\n", s.subject, len(data))
+	s.w.Write(data)
+	_, err = s.w.WriteString("\r\n")
+	return err
+}
+
+func (s *natsSink) Flush() error {
+	if _, err := s.w.WriteString("PING\r\n"); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// INFO updates and +OK are ignored
+	}
+}
+
+func (s *natsSink) Close() error {
+	return s.conn.Close()
+}
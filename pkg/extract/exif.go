@@ -0,0 +1,302 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// ------------------------
+// EXIF (JPEG and TIFF Images)
+// ------------------------
+
+func init() { Register(exifExtractor{}) }
+
+type exifExtractor struct{}
+
+func (exifExtractor) Name() string { return "exif" }
+
+func (exifExtractor) Match(head []byte) bool {
+	return bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}) ||
+		bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*"))
+}
+
+// EXIF tags recorded, by IFD.
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagFocalLength      = 0x920A
+	tagPixelXDimension  = 0xA002
+	tagPixelYDimension  = 0xA003
+	tagLensModel        = 0xA434
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+	tagGPSAltitudeRef   = 0x0005
+	tagGPSAltitude      = 0x0006
+)
+
+// Extract records the camera, capture settings, time taken, dimensions and
+// GPS position of an image.
+func (exifExtractor) Extract(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	base := int64(0)
+	if head, err := readAt(r, 0, 2); err != nil {
+		return nil, err
+	} else if head[0] == 0xFF {
+		var err error
+		if base, err = jpegExifOffset(r, size); err != nil || base < 0 {
+			return nil, err
+		}
+	}
+	t, err := newTIFFReader(r, base)
+	if err != nil {
+		return nil, err
+	}
+	ifd0, err := t.ifd(t.first)
+	if err != nil {
+		return nil, err
+	}
+	extra := map[string]interface{}{}
+	setString(extra, "exifMake", t.ascii(ifd0[tagMake]))
+	setString(extra, "exifModel", t.ascii(ifd0[tagModel]))
+	if v, ok := t.uint(ifd0[tagOrientation]); ok {
+		extra["exifOrientation"] = v
+	}
+	if ts, ok := exifTime(t.ascii(ifd0[tagDateTime])); ok {
+		extra["exifDateTime"] = ts
+	}
+
+	if off, ok := t.uint(ifd0[tagExifIFD]); ok {
+		if sub, err := t.ifd(int64(off)); err == nil {
+			if ts, ok := exifTime(t.ascii(sub[tagDateTimeOriginal])); ok {
+				extra["exifDateTaken"] = ts
+			}
+			if v, ok := t.rational(sub[tagExposureTime], 0); ok {
+				extra["exifExposureTime"] = v
+			}
+			if v, ok := t.rational(sub[tagFNumber], 0); ok {
+				extra["exifFNumber"] = v
+			}
+			if v, ok := t.uint(sub[tagISO]); ok {
+				extra["exifISO"] = v
+			}
+			if v, ok := t.rational(sub[tagFocalLength], 0); ok {
+				extra["exifFocalLength"] = v
+			}
+			if v, ok := t.uint(sub[tagPixelXDimension]); ok {
+				extra["exifWidth"] = v
+			}
+			if v, ok := t.uint(sub[tagPixelYDimension]); ok {
+				extra["exifHeight"] = v
+			}
+			setString(extra, "exifLensModel", t.ascii(sub[tagLensModel]))
+		}
+	}
+
+	if off, ok := t.uint(ifd0[tagGPSIFD]); ok {
+		if gps, err := t.ifd(int64(off)); err == nil {
+			if lat, ok := t.degrees(gps[tagGPSLatitude], t.ascii(gps[tagGPSLatitudeRef]) == "S"); ok {
+				extra["gpsLatitude"] = lat
+			}
+			if lon, ok := t.degrees(gps[tagGPSLongitude], t.ascii(gps[tagGPSLongitudeRef]) == "W"); ok {
+				extra["gpsLongitude"] = lon
+			}
+			if alt, ok := t.rational(gps[tagGPSAltitude], 0); ok {
+				if ref, _ := t.uint(gps[tagGPSAltitudeRef]); ref == 1 {
+					alt = -alt
+				}
+				extra["gpsAltitude"] = alt
+			}
+		}
+	}
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	return extra, nil
+}
+
+// jpegExifOffset walks the JPEG markers to the APP1 Exif segment and
+// returns the offset of its TIFF header, or -1 if there is none.
+func jpegExifOffset(r io.ReaderAt, size int64) (int64, error) {
+	off := int64(2)
+	for off+4 <= size {
+		hdr, err := readAt(r, off, 4)
+		if err != nil {
+			return -1, err
+		}
+		if hdr[0] != 0xFF {
+			return -1, errors.New("malformed JPEG marker")
+		}
+		marker := hdr[1]
+		if marker == 0xD9 || marker == 0xDA { // End of image, or start of scan: no more metadata
+			return -1, nil
+		}
+		length := int64(binary.BigEndian.Uint16(hdr[2:]))
+		if marker == 0xE1 && length >= 8 {
+			id, err := readAt(r, off+4, 6)
+			if err != nil {
+				return -1, err
+			}
+			if string(id) == "Exif\x00\x00" {
+				return off + 10, nil
+			}
+		}
+		off += 2 + length
+	}
+	return -1, nil
+}
+
+// tiffReader reads the IFDs of a TIFF structure starting at base.
+type tiffReader struct {
+	r     io.ReaderAt
+	base  int64
+	order binary.ByteOrder
+	first int64
+}
+
+// tiffEntry is an IFD entry with its value bytes.
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// tiffTypeSize is the size in bytes of each TIFF field type.
+var tiffTypeSize = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+const (
+	maxIFDEntries = 1024
+	maxTIFFValue  = 64 << 10
+)
+
+func newTIFFReader(r io.ReaderAt, base int64) (*tiffReader, error) {
+	hdr, err := readAt(r, base, 8)
+	if err != nil {
+		return nil, err
+	}
+	t := &tiffReader{r: r, base: base}
+	switch string(hdr[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("malformed TIFF header")
+	}
+	t.first = int64(t.order.Uint32(hdr[4:]))
+	return t, nil
+}
+
+// ifd reads the entries of the IFD at off, keyed by tag.
+func (t *tiffReader) ifd(off int64) (map[uint16]tiffEntry, error) {
+	buf, err := readAt(t.r, t.base+off, 2)
+	if err != nil {
+		return nil, err
+	}
+	n := int(t.order.Uint16(buf))
+	if n > maxIFDEntries {
+		return nil, fmt.Errorf("IFD with %d entries", n)
+	}
+	raw, err := readAt(t.r, t.base+off+2, n*12)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[uint16]tiffEntry, n)
+	for i := 0; i < n; i++ {
+		e := raw[i*12 : i*12+12]
+		tag, typ, count := t.order.Uint16(e), t.order.Uint16(e[2:]), t.order.Uint32(e[4:])
+		size := tiffTypeSize[typ] * int(count)
+		if size == 0 || size > maxTIFFValue {
+			continue
+		}
+		value := e[8 : 8+min(size, 4)]
+		if size > 4 {
+			if value, err = readAt(t.r, t.base+int64(t.order.Uint32(e[8:])), size); err != nil {
+				continue
+			}
+		}
+		entries[tag] = tiffEntry{typ: typ, count: count, value: value}
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) ascii(e tiffEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(e.value), "\x00")
+	return strings.TrimSpace(s)
+}
+
+// uint returns the first value of a BYTE, SHORT or LONG entry.
+func (t *tiffReader) uint(e tiffEntry) (uint32, bool) {
+	switch {
+	case e.typ == 1 && len(e.value) >= 1:
+		return uint32(e.value[0]), true
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value)), true
+	case e.typ == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+// rational returns the i'th value of a RATIONAL or SRATIONAL entry.
+func (t *tiffReader) rational(e tiffEntry, i int) (float64, bool) {
+	if (e.typ != 5 && e.typ != 10) || len(e.value) < (i+1)*8 {
+		return 0, false
+	}
+	num, den := t.order.Uint32(e.value[i*8:]), t.order.Uint32(e.value[i*8+4:])
+	if den == 0 {
+		return 0, false
+	}
+	if e.typ == 10 {
+		return float64(int32(num)) / float64(int32(den)), true
+	}
+	return float64(num) / float64(den), true
+}
+
+// degrees converts a GPS degrees/minutes/seconds entry to decimal degrees.
+func (t *tiffReader) degrees(e tiffEntry, negative bool) (float64, bool) {
+	d, ok1 := t.rational(e, 0)
+	m, ok2 := t.rational(e, 1)
+	s, ok3 := t.rational(e, 2)
+	if !ok1 || !ok2 || !ok3 {
+		return 0, false
+	}
+	v := d + m/60 + s/3600
+	if negative {
+		v = -v
+	}
+	return math.Round(v*1e7) / 1e7, true
+}
+
+// exifTime converts an EXIF "YYYY:MM:DD HH:MM:SS" time, which has no zone,
+// to RFC 3339 without one.
+func exifTime(s string) (string, bool) {
+	ts, err := time.Parse("2006:01:02 15:04:05", s)
+	if err != nil {
+		return "", false
+	}
+	return ts.Format("2006-01-02T15:04:05"), true
+}
+
+func setString(extra map[string]interface{}, key, value string) {
+	if value != "" {
+		extra[key] = value
+	}
+}
@@ -0,0 +1,136 @@
+// Package extract reads format-specific metadata (EXIF, ID3 tags, media
+// duration and codecs, PDF document info) out of files, for the Extra
+// fields of their records.
+package extract
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ------------------------
+// Extractor Registry
+// ------------------------
+
+// Extractor reads one family of formats. Extractors register themselves by
+// name from init, so adding one is a matter of adding a file.
+type Extractor interface {
+	// Name is the name given to --extract, e.g. "exif".
+	Name() string
+	// Match reports from a file's first bytes (up to HeadSize) whether the
+	// extractor handles it.
+	Match(head []byte) bool
+	// Extract returns the Extra fields for a file Match accepted. Fields it
+	// cannot find are left out; a file with none yields nil.
+	Extract(r io.ReaderAt, size int64) (map[string]interface{}, error)
+}
+
+// HeadSize is the number of leading bytes passed to Match.
+const HeadSize = 512
+
+// All selects every registered extractor in Lookup.
+const All = "all"
+
+var registry = map[string]Extractor{}
+
+// Register makes an extractor available by name. Registering a name twice
+// panics.
+func Register(e Extractor) {
+	if _, dup := registry[e.Name()]; dup {
+		panic("extract: extractor registered twice: " + e.Name())
+	}
+	registry[e.Name()] = e
+}
+
+// Names returns the names of the registered extractors, sorted.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the extractors with the given names ("all" for every one).
+func Lookup(names []string) ([]Extractor, error) {
+	var exts []Extractor
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if name == All {
+			return Lookup(Names())
+		}
+		e, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extractor %q (available: %s)", name, strings.Join(Names(), ", "))
+		}
+		exts = append(exts, e)
+	}
+	return exts, nil
+}
+
+// File runs the matching extractors on the file at path and merges their
+// fields. The first extractor error is returned along with the fields the
+// others found.
+func File(path string, exts []Extractor) (map[string]interface{}, error) {
+	if len(exts) == 0 {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, HeadSize)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	var extra map[string]interface{}
+	var firstErr error
+	for _, e := range exts {
+		if !e.Match(head) {
+			continue
+		}
+		fields, err := e.Extract(f, info.Size())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", e.Name(), err)
+			}
+			continue
+		}
+		for k, v := range fields {
+			if extra == nil {
+				extra = map[string]interface{}{}
+			}
+			extra[k] = v
+		}
+	}
+	return extra, firstErr
+}
+
+// readAt reads n bytes at off, failing on a short read.
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
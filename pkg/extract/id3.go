@@ -0,0 +1,182 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ------------------------
+// ID3 Tags (MP3 Audio)
+// ------------------------
+
+func init() { Register(id3Extractor{}) }
+
+type id3Extractor struct{}
+
+func (id3Extractor) Name() string { return "id3" }
+
+// Match accepts files with an ID3v2 tag or starting with an MPEG audio
+// frame, which may carry an ID3v1 tag at the end.
+func (id3Extractor) Match(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("ID3")) ||
+		len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0
+}
+
+// id3Fields maps ID3v2.3/2.4 and (three-letter) ID3v2.2 text frames to the
+// Extra fields they fill.
+var id3Fields = map[string]string{
+	"TIT2": "id3Title", "TT2": "id3Title",
+	"TPE1": "id3Artist", "TP1": "id3Artist",
+	"TPE2": "id3AlbumArtist", "TP2": "id3AlbumArtist",
+	"TALB": "id3Album", "TAL": "id3Album",
+	"TYER": "id3Year", "TYE": "id3Year", "TDRC": "id3Year",
+	"TCON": "id3Genre", "TCO": "id3Genre",
+	"TRCK": "id3Track", "TRK": "id3Track",
+	"TCOM": "id3Composer", "TCM": "id3Composer",
+}
+
+// maxID3Size bounds the ID3v2 tag read; larger tags hold pictures, which
+// are not recorded.
+const maxID3Size = 1 << 20
+
+// Extract records the title, artist, album, year, genre and track number
+// from an ID3v2 tag, or else an ID3v1 tag.
+func (id3Extractor) Extract(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	extra := map[string]interface{}{}
+	if hdr, err := readAt(r, 0, 10); err == nil && string(hdr[:3]) == "ID3" {
+		readID3v2(r, hdr, extra)
+	}
+	if len(extra) == 0 && size >= 128 {
+		if tag, err := readAt(r, size-128, 128); err == nil && string(tag[:3]) == "TAG" {
+			readID3v1(tag, extra)
+		}
+	}
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	return extra, nil
+}
+
+func readID3v2(r io.ReaderAt, hdr []byte, extra map[string]interface{}) {
+	version, flags := hdr[3], hdr[5]
+	tagSize := int(syncsafe(hdr[6:10]))
+	if version < 2 || version > 4 {
+		return
+	}
+	tag, err := readAt(r, 10, min(tagSize, maxID3Size))
+	if err != nil {
+		return
+	}
+	if flags&0x80 != 0 && version < 4 {
+		tag = bytes.ReplaceAll(tag, []byte{0xFF, 0x00}, []byte{0xFF}) // Unsynchronised tag
+	}
+	pos := 0
+	if flags&0x40 != 0 && version >= 3 && len(tag) >= 4 { // Extended header
+		if version == 3 {
+			pos = 4 + int(binary.BigEndian.Uint32(tag))
+		} else {
+			pos = int(syncsafe(tag[:4]))
+		}
+	}
+
+	idLen, hdrLen := 4, 10
+	if version == 2 {
+		idLen, hdrLen = 3, 6
+	}
+	for pos+hdrLen <= len(tag) {
+		id := string(tag[pos : pos+idLen])
+		if id[0] == 0 { // Padding
+			break
+		}
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(tag[pos+3])<<16 | int(tag[pos+4])<<8 | int(tag[pos+5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(tag[pos+4:]))
+		default:
+			frameSize = int(syncsafe(tag[pos+4 : pos+8]))
+		}
+		body := pos + hdrLen
+		if frameSize < 0 || body+frameSize > len(tag) {
+			break
+		}
+		if field, ok := id3Fields[id]; ok && frameSize > 1 {
+			if s := id3Text(tag[body : body+frameSize]); s != "" {
+				extra[field] = s
+			}
+		}
+		pos = body + frameSize
+	}
+}
+
+// readID3v1 reads the fixed-width fields of a 128-byte ID3v1 tag.
+func readID3v1(tag []byte, extra map[string]interface{}) {
+	field := func(b []byte) string {
+		s, _, _ := strings.Cut(latin1(b), "\x00")
+		return strings.TrimSpace(s)
+	}
+	setString(extra, "id3Title", field(tag[3:33]))
+	setString(extra, "id3Artist", field(tag[33:63]))
+	setString(extra, "id3Album", field(tag[63:93]))
+	setString(extra, "id3Year", field(tag[93:97]))
+	if tag[125] == 0 && tag[126] != 0 { // ID3v1.1 track number
+		extra["id3Track"] = strconv.Itoa(int(tag[126]))
+	}
+}
+
+// id3Text decodes a text frame body: an encoding byte, then the text in
+// Latin-1, UTF-16 with a byte order mark, UTF-16BE or UTF-8. Of several
+// NUL-separated values only the first is kept.
+func id3Text(body []byte) string {
+	enc, text := body[0], body[1:]
+	var s string
+	switch enc {
+	case 0:
+		s = latin1(text)
+	case 1, 2:
+		s = utf16Text(text, enc == 2)
+	case 3:
+		s = string(text)
+	default:
+		return ""
+	}
+	s, _, _ = strings.Cut(s, "\x00")
+	return strings.TrimSpace(s)
+}
+
+// utf16Text decodes UTF-16 with a byte order mark, or big-endian without
+// one if bigEndian.
+func utf16Text(b []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.BigEndian
+	if !bigEndian && len(b) >= 2 {
+		if b[0] == 0xFF && b[1] == 0xFE {
+			order = binary.LittleEndian
+		}
+		if b[0] == 0xFF && b[1] == 0xFE || b[0] == 0xFE && b[1] == 0xFF {
+			b = b[2:]
+		}
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// syncsafe decodes a 28-bit integer stored seven bits per byte.
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
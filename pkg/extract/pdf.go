@@ -0,0 +1,391 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------
+// PDF Document Information
+// ------------------------
+
+func init() { Register(pdfExtractor{}) }
+
+type pdfExtractor struct{}
+
+func (pdfExtractor) Name() string { return "pdf" }
+
+func (pdfExtractor) Match(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("%PDF-"))
+}
+
+// pdfFields maps document information keys to the Extra fields they fill.
+var pdfFields = map[string]string{
+	"Title":    "pdfTitle",
+	"Author":   "pdfAuthor",
+	"Subject":  "pdfSubject",
+	"Keywords": "pdfKeywords",
+	"Creator":  "pdfCreator",
+	"Producer": "pdfProducer",
+}
+
+const (
+	pdfTailSize  = 64 << 10  // Bytes at the end searched for the trailer
+	pdfScanLimit = 256 << 20 // Bytes searched for the info object without an xref table
+	pdfObjSize   = 16 << 10  // Most bytes of the info object read
+)
+
+var (
+	pdfInfoRef   = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfStartXref = regexp.MustCompile(`startxref\s+(\d+)`)
+	pdfPrev      = regexp.MustCompile(`/Prev\s+(\d+)`)
+)
+
+// Extract records the title, author, subject, keywords, creating and
+// producing applications and creation time from a PDF's document
+// information dictionary. Values held in compressed object streams (common
+// since PDF 1.5) cannot be read and are left out.
+func (pdfExtractor) Extract(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	tailOff := max(size-pdfTailSize, 0)
+	tail, err := readAt(r, tailOff, int(size-tailOff))
+	if err != nil {
+		return nil, err
+	}
+	refs := pdfInfoRef.FindAllSubmatch(tail, -1)
+	if refs == nil {
+		return nil, nil
+	}
+	ref := refs[len(refs)-1] // The newest trailer comes last
+	num, _ := strconv.Atoi(string(ref[1]))
+	gen, _ := strconv.Atoi(string(ref[2]))
+
+	off := int64(-1)
+	if xref := pdfStartXref.FindAllSubmatch(tail, -1); xref != nil {
+		start, _ := strconv.ParseInt(string(xref[len(xref)-1][1]), 10, 64)
+		off = pdfXrefLookup(r, size, start, num)
+	}
+	if off < 0 {
+		if off, err = pdfFindObject(r, size, num, gen); err != nil || off < 0 {
+			return nil, err
+		}
+	}
+	obj, err := readAt(r, off, int(min(pdfObjSize, size-off)))
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := pdfDict(obj, fmt.Sprintf("%d %d obj", num, gen))
+	if !ok {
+		return nil, nil
+	}
+
+	extra := map[string]interface{}{}
+	for key, value := range dict {
+		if field, ok := pdfFields[key]; ok {
+			setString(extra, field, value)
+		}
+	}
+	if ts, ok := pdfDate(dict["CreationDate"]); ok {
+		extra["pdfCreated"] = ts
+	}
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	return extra, nil
+}
+
+// pdfXrefLookup finds object num's offset in a classic cross-reference
+// table at start (following /Prev to older sections), or returns -1.
+func pdfXrefLookup(r io.ReaderAt, size, start int64, num int) int64 {
+	for hops := 0; hops < 32 && start > 0 && start < size; hops++ {
+		buf, err := readAt(r, start, int(min(pdfTailSize, size-start)))
+		if err != nil || !bytes.HasPrefix(buf, []byte("xref")) {
+			return -1 // A cross-reference stream, which is compressed
+		}
+		lines := strings.Split(strings.ReplaceAll(string(buf), "\r", "\n"), "\n")
+		i := 1
+		for i < len(lines) {
+			fields := strings.Fields(lines[i])
+			if len(fields) == 0 {
+				i++
+				continue
+			}
+			if fields[0] == "trailer" {
+				break
+			}
+			first, err1 := strconv.Atoi(fields[0])
+			count, err2 := 0, error(nil)
+			if len(fields) == 2 {
+				count, err2 = strconv.Atoi(fields[1])
+			}
+			if err1 != nil || err2 != nil || len(fields) != 2 {
+				return -1
+			}
+			i++
+			for j := 0; j < count && i < len(lines); i++ {
+				entry := strings.Fields(lines[i])
+				if len(entry) == 0 {
+					continue
+				}
+				if first+j == num && len(entry) == 3 && entry[2] == "n" {
+					off, err := strconv.ParseInt(entry[0], 10, 64)
+					if err != nil {
+						return -1
+					}
+					return off
+				}
+				j++
+			}
+		}
+		prev := pdfPrev.FindStringSubmatch(strings.Join(lines[i:], "\n"))
+		if prev == nil {
+			return -1
+		}
+		start, _ = strconv.ParseInt(prev[1], 10, 64)
+	}
+	return -1
+}
+
+// pdfFindObject scans the file for the start of object num, for files
+// whose cross-reference table cannot be read. It returns -1 if not found.
+func pdfFindObject(r io.ReaderAt, size int64, num, gen int) (int64, error) {
+	needle := []byte(fmt.Sprintf("%d %d obj", num, gen))
+	const chunk = 1 << 20
+	found := int64(-1)
+	for off := int64(0); off < min(size, pdfScanLimit); off += chunk - int64(len(needle)) {
+		buf, err := readAt(r, off, int(min(chunk, size-off)))
+		if err != nil {
+			return -1, err
+		}
+		for i := 0; ; {
+			j := bytes.Index(buf[i:], needle)
+			if j < 0 {
+				break
+			}
+			at := i + j
+			// The object number must not be the tail of a longer one
+			if at == 0 && off == 0 || at > 0 && !isDigit(buf[at-1]) {
+				found = off + int64(at) // Keep the last: updates append newer objects
+			}
+			i = at + len(needle)
+		}
+		if off+chunk >= size {
+			break
+		}
+	}
+	return found, nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// pdfDict parses the dictionary of the object starting at obj into its
+// string values. Keys whose values are not strings are left out.
+func pdfDict(obj []byte, header string) (map[string]string, bool) {
+	i := bytes.Index(obj, []byte(header))
+	if i < 0 {
+		return nil, false
+	}
+	p := &pdfParser{b: obj, i: i + len(header)}
+	p.space()
+	if !p.consume("<<") {
+		return nil, false
+	}
+	dict := map[string]string{}
+	for {
+		p.space()
+		if p.i >= len(p.b) || p.consume(">>") {
+			return dict, true
+		}
+		if p.b[p.i] != '/' {
+			return dict, len(dict) > 0
+		}
+		key := p.name()
+		p.space()
+		if value, ok := p.value(); ok {
+			dict[key] = value
+		}
+	}
+}
+
+type pdfParser struct {
+	b []byte
+	i int
+}
+
+func (p *pdfParser) space() {
+	for p.i < len(p.b) && strings.IndexByte(" \t\r\n\f\x00", p.b[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+func (p *pdfParser) consume(s string) bool {
+	if bytes.HasPrefix(p.b[p.i:], []byte(s)) {
+		p.i += len(s)
+		return true
+	}
+	return false
+}
+
+// name reads a /Name token, without the slash.
+func (p *pdfParser) name() string {
+	p.i++
+	start := p.i
+	for p.i < len(p.b) && strings.IndexByte(" \t\r\n\f\x00/<>[]()%", p.b[p.i]) < 0 {
+		p.i++
+	}
+	return string(p.b[start:p.i])
+}
+
+// value reads a value, returning its text for literal and hexadecimal
+// strings and skipping other kinds.
+func (p *pdfParser) value() (string, bool) {
+	if p.i >= len(p.b) {
+		return "", false
+	}
+	switch {
+	case p.b[p.i] == '(':
+		return pdfText(p.literal()), true
+	case p.consume("<<"):
+		p.skipUntil(">>")
+	case p.b[p.i] == '<':
+		return pdfText(p.hex()), true
+	case p.b[p.i] == '[':
+		p.skipUntil("]")
+	case p.b[p.i] == '/':
+		p.name()
+	default: // Numbers, booleans, null, and indirect references
+		for p.i < len(p.b) && p.b[p.i] != '/' && p.b[p.i] != '>' {
+			p.i++
+		}
+	}
+	return "", false
+}
+
+func (p *pdfParser) skipUntil(s string) {
+	if j := bytes.Index(p.b[p.i:], []byte(s)); j >= 0 {
+		p.i += j + len(s)
+	} else {
+		p.i = len(p.b)
+	}
+}
+
+// literal reads a (string) with its escapes and balanced parentheses.
+func (p *pdfParser) literal() []byte {
+	var out []byte
+	depth := 0
+	for p.i++; p.i < len(p.b); p.i++ {
+		c := p.b[p.i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				p.i++
+				return out
+			}
+			depth--
+		case '\\':
+			p.i++
+			if p.i >= len(p.b) {
+				return out
+			}
+			c = p.b[p.i]
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n': // Line continuation
+				if c == '\r' && p.i+1 < len(p.b) && p.b[p.i+1] == '\n' {
+					p.i++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := 0
+					for k := 0; k < 3 && p.i < len(p.b) && p.b[p.i] >= '0' && p.b[p.i] <= '7'; k++ {
+						v = v*8 + int(p.b[p.i]-'0')
+						p.i++
+					}
+					p.i--
+					c = byte(v)
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// hex reads a <hexadecimal string>.
+func (p *pdfParser) hex() []byte {
+	p.i++
+	var digits []byte
+	for ; p.i < len(p.b) && p.b[p.i] != '>'; p.i++ {
+		if c := p.b[p.i]; isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' {
+			digits = append(digits, c)
+		}
+	}
+	p.i++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, _ := strconv.ParseUint(string(digits[i*2:i*2+2]), 16, 8)
+		out[i] = byte(v)
+	}
+	return out
+}
+
+// pdfText decodes a text string: UTF-16BE with a byte order mark, UTF-8
+// with one (PDF 2.0), or else PDFDocEncoding, read as Latin-1.
+func pdfText(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		return strings.TrimSpace(utf16Text(b[2:], true))
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return strings.TrimSpace(string(b[3:]))
+	}
+	return strings.TrimSpace(latin1(b))
+}
+
+// pdfDate converts a PDF date, D:YYYYMMDDHHmmSSOHH'mm', to RFC 3339. Only
+// the year is required.
+func pdfDate(s string) (string, bool) {
+	s = strings.TrimPrefix(s, "D:")
+	if len(s) < 4 {
+		return "", false
+	}
+	digits := "00000101000000"
+	n := 0
+	for n < len(s) && n < len(digits) && isDigit(s[n]) {
+		n++
+	}
+	if n < 4 {
+		return "", false
+	}
+	ts, err := time.Parse("20060102150405", s[:n]+digits[n:])
+	if err != nil {
+		return "", false
+	}
+	zone := strings.NewReplacer("'", "").Replace(s[n:])
+	if len(zone) >= 5 && (zone[0] == '+' || zone[0] == '-') {
+		if z, err := time.Parse("-0700", zone[:5]); err == nil {
+			ts = time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), 0, z.Location())
+		}
+	} else if !strings.HasPrefix(zone, "Z") {
+		return ts.Format("2006-01-02T15:04:05"), true
+	}
+	return ts.Format(time.RFC3339), true
+}
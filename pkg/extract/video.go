@@ -0,0 +1,390 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// ------------------------
+// Media Duration and Codecs (MP4/QuickTime and Matroska/WebM)
+// ------------------------
+
+func init() { Register(videoExtractor{}) }
+
+type videoExtractor struct{}
+
+func (videoExtractor) Name() string { return "video" }
+
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+func (videoExtractor) Match(head []byte) bool {
+	return len(head) >= 8 && string(head[4:8]) == "ftyp" || bytes.HasPrefix(head, ebmlMagic)
+}
+
+// Extract records the duration in seconds, the video and audio codecs and
+// the picture size of a movie.
+func (videoExtractor) Extract(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	m := &mediaInfo{}
+	var err error
+	if head, rerr := readAt(r, 0, 4); rerr != nil {
+		return nil, rerr
+	} else if bytes.Equal(head, ebmlMagic) {
+		err = readMatroska(r, size, m)
+	} else {
+		err = readMP4Boxes(r, 0, size, m, 0)
+	}
+	if err != nil && !m.found() {
+		return nil, err
+	}
+	return m.extra(), nil
+}
+
+// mediaInfo collects what the container parsers find.
+type mediaInfo struct {
+	duration      float64
+	videoCodec    string
+	audioCodec    string
+	width, height uint64
+	lastHandler   string // Handler of the MP4 track being read
+}
+
+func (m *mediaInfo) found() bool {
+	return m.duration > 0 || m.videoCodec != "" || m.audioCodec != ""
+}
+
+func (m *mediaInfo) extra() map[string]interface{} {
+	if !m.found() {
+		return nil
+	}
+	extra := map[string]interface{}{}
+	if m.duration > 0 {
+		extra["mediaDuration"] = math.Round(m.duration*1000) / 1000
+	}
+	setString(extra, "videoCodec", m.videoCodec)
+	setString(extra, "audioCodec", m.audioCodec)
+	if m.width > 0 && m.height > 0 {
+		extra["videoWidth"] = m.width
+		extra["videoHeight"] = m.height
+	}
+	return extra
+}
+
+// MP4 container boxes descended into on the way to the track headers.
+var mp4Containers = map[string]bool{"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true}
+
+// maxBoxDepth bounds recursion on malformed files.
+const maxBoxDepth = 8
+
+// readMP4Boxes walks the boxes between off and end.
+func readMP4Boxes(r io.ReaderAt, off, end int64, m *mediaInfo, depth int) error {
+	if depth > maxBoxDepth {
+		return errors.New("boxes nested too deeply")
+	}
+	for off+8 <= end {
+		hdr, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		boxSize, typ, hdrLen := int64(binary.BigEndian.Uint32(hdr)), string(hdr[4:8]), int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = end - off
+		case 1:
+			ext, err := readAt(r, off+8, 8)
+			if err != nil {
+				return err
+			}
+			boxSize, hdrLen = int64(binary.BigEndian.Uint64(ext)), 16
+		}
+		if boxSize < hdrLen || off+boxSize > end {
+			return errors.New("malformed box")
+		}
+		body, bodyLen := off+hdrLen, boxSize-hdrLen
+		switch {
+		case mp4Containers[typ]:
+			if err := readMP4Boxes(r, body, body+bodyLen, m, depth+1); err != nil {
+				return err
+			}
+		case typ == "mvhd":
+			if d, ok := mp4Duration(r, body, bodyLen); ok {
+				m.duration = d
+			}
+		case typ == "hdlr" && bodyLen >= 12:
+			if b, err := readAt(r, body+8, 4); err == nil {
+				m.lastHandler = string(b)
+			}
+		case typ == "stsd" && bodyLen >= 16:
+			readSampleDescription(r, body, m)
+		}
+		off += boxSize
+	}
+	return nil
+}
+
+// mp4Duration reads a movie header's duration in seconds.
+func mp4Duration(r io.ReaderAt, body, bodyLen int64) (float64, bool) {
+	b, err := readAt(r, body, int(min(bodyLen, 32)))
+	if err != nil {
+		return 0, false
+	}
+	var timescale, duration uint64
+	if b[0] == 1 && len(b) >= 32 { // Version 1: 64-bit times
+		timescale, duration = uint64(binary.BigEndian.Uint32(b[20:])), binary.BigEndian.Uint64(b[24:])
+	} else if len(b) >= 20 {
+		timescale, duration = uint64(binary.BigEndian.Uint32(b[12:])), uint64(binary.BigEndian.Uint32(b[16:]))
+	}
+	if timescale == 0 || duration == 0 || duration == math.MaxUint32 || duration == math.MaxUint64 {
+		return 0, false
+	}
+	return float64(duration) / float64(timescale), true
+}
+
+// readSampleDescription records the codec of a track's first sample entry,
+// and for video its width and height. The track's handler, read from the
+// hdlr box that precedes the stsd box, tells video from audio.
+func readSampleDescription(r io.ReaderAt, body int64, m *mediaInfo) {
+	entry, err := readAt(r, body+8, 8+28)
+	if err != nil {
+		return
+	}
+	codec := strings.TrimSpace(string(entry[4:8]))
+	switch m.lastHandler {
+	case "vide":
+		if m.videoCodec == "" {
+			m.videoCodec = codec
+			m.width = uint64(binary.BigEndian.Uint16(entry[32:]))
+			m.height = uint64(binary.BigEndian.Uint16(entry[34:]))
+		}
+	case "soun":
+		if m.audioCodec == "" {
+			m.audioCodec = codec
+		}
+	}
+}
+
+// Matroska element IDs read, with their length marker bits kept.
+const (
+	mkvSegment       = 0x18538067
+	mkvInfo          = 0x1549A966
+	mkvTimecodeScale = 0x2AD7B1
+	mkvDuration      = 0x4489
+	mkvTracks        = 0x1654AE6B
+	mkvTrackEntry    = 0xAE
+	mkvTrackType     = 0x83
+	mkvCodecID       = 0x86
+	mkvVideo         = 0xE0
+	mkvPixelWidth    = 0xB0
+	mkvPixelHeight   = 0xBA
+	mkvCluster       = 0x1F43B675
+)
+
+// readMatroska reads the segment info and track entries, which precede
+// the first cluster.
+func readMatroska(r io.ReaderAt, size int64, m *mediaInfo) error {
+	off := int64(0)
+	for off < size {
+		id, dataSize, hdrLen, err := ebmlHeader(r, off)
+		if err != nil {
+			return err
+		}
+		if id == mkvSegment {
+			end := size
+			if dataSize >= 0 {
+				end = min(off+hdrLen+dataSize, size)
+			}
+			return readMatroskaSegment(r, off+hdrLen, end, m)
+		}
+		if dataSize < 0 {
+			return errors.New("unknown-size element before segment")
+		}
+		off += hdrLen + dataSize
+	}
+	return nil
+}
+
+func readMatroskaSegment(r io.ReaderAt, off, end int64, m *mediaInfo) error {
+	var gotInfo, gotTracks bool
+	for off < end && !(gotInfo && gotTracks) {
+		id, dataSize, hdrLen, err := ebmlHeader(r, off)
+		if err != nil {
+			return err
+		}
+		if id == mkvCluster || dataSize < 0 {
+			break
+		}
+		body := off + hdrLen
+		switch id {
+		case mkvInfo:
+			gotInfo = true
+			if err := readMatroskaInfo(r, body, body+dataSize, m); err != nil {
+				return err
+			}
+		case mkvTracks:
+			gotTracks = true
+			err := ebmlChildren(r, body, body+dataSize, func(id uint32, body, size int64) error {
+				if id == mkvTrackEntry {
+					return readMatroskaTrack(r, body, body+size, m)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		off = body + dataSize
+	}
+	return nil
+}
+
+func readMatroskaInfo(r io.ReaderAt, off, end int64, m *mediaInfo) error {
+	scale, duration := uint64(1000000), 0.0
+	err := ebmlChildren(r, off, end, func(id uint32, body, size int64) error {
+		switch id {
+		case mkvTimecodeScale:
+			v, err := ebmlUint(r, body, size)
+			if err == nil && v > 0 {
+				scale = v
+			}
+			return err
+		case mkvDuration:
+			v, err := ebmlFloat(r, body, size)
+			duration = v
+			return err
+		}
+		return nil
+	})
+	if duration > 0 {
+		m.duration = duration * float64(scale) / 1e9
+	}
+	return err
+}
+
+func readMatroskaTrack(r io.ReaderAt, off, end int64, m *mediaInfo) error {
+	var trackType uint64
+	var codec string
+	var width, height uint64
+	err := ebmlChildren(r, off, end, func(id uint32, body, size int64) error {
+		var err error
+		switch id {
+		case mkvTrackType:
+			trackType, err = ebmlUint(r, body, size)
+		case mkvCodecID:
+			var b []byte
+			if b, err = readAt(r, body, int(min(size, 64))); err == nil {
+				codec = strings.TrimRight(string(b), "\x00")
+			}
+		case mkvVideo:
+			err = ebmlChildren(r, body, body+size, func(id uint32, body, size int64) error {
+				var err error
+				switch id {
+				case mkvPixelWidth:
+					width, err = ebmlUint(r, body, size)
+				case mkvPixelHeight:
+					height, err = ebmlUint(r, body, size)
+				}
+				return err
+			})
+		}
+		return err
+	})
+	switch {
+	case trackType == 1 && m.videoCodec == "":
+		m.videoCodec, m.width, m.height = codec, width, height
+	case trackType == 2 && m.audioCodec == "":
+		m.audioCodec = codec
+	}
+	return err
+}
+
+// ebmlChildren calls fn with each element between off and end.
+func ebmlChildren(r io.ReaderAt, off, end int64, fn func(id uint32, body, size int64) error) error {
+	for off < end {
+		id, dataSize, hdrLen, err := ebmlHeader(r, off)
+		if err != nil {
+			return err
+		}
+		if dataSize < 0 || off+hdrLen+dataSize > end {
+			return errors.New("malformed element")
+		}
+		if err := fn(id, off+hdrLen, dataSize); err != nil {
+			return err
+		}
+		off += hdrLen + dataSize
+	}
+	return nil
+}
+
+// ebmlHeader reads an element's ID and data size at off. A size of -1 is
+// unknown (the element runs to the end of its parent).
+func ebmlHeader(r io.ReaderAt, off int64) (id uint32, size, hdrLen int64, err error) {
+	b, err := readAt(r, off, 1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	idLen := bits.LeadingZeros8(b[0]) + 1
+	if idLen > 4 {
+		return 0, 0, 0, errors.New("malformed element ID")
+	}
+	if b, err = readAt(r, off, idLen+1); err != nil {
+		return 0, 0, 0, err
+	}
+	for _, c := range b[:idLen] {
+		id = id<<8 | uint32(c)
+	}
+	sizeLen := bits.LeadingZeros8(b[idLen]) + 1
+	if sizeLen > 8 {
+		return 0, 0, 0, errors.New("malformed element size")
+	}
+	sb, err := readAt(r, off+int64(idLen), sizeLen)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	v := uint64(sb[0] & (0xFF >> sizeLen))
+	allOnes := v == uint64(0xFF>>sizeLen)
+	for _, c := range sb[1:] {
+		v = v<<8 | uint64(c)
+		allOnes = allOnes && c == 0xFF
+	}
+	hdrLen = int64(idLen + sizeLen)
+	if allOnes {
+		return id, -1, hdrLen, nil
+	}
+	if v > math.MaxInt64/2 {
+		return 0, 0, 0, errors.New("malformed element size")
+	}
+	return id, int64(v), hdrLen, nil
+}
+
+func ebmlUint(r io.ReaderAt, off, size int64) (uint64, error) {
+	if size > 8 {
+		return 0, errors.New("malformed unsigned integer")
+	}
+	b, err := readAt(r, off, int(size))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func ebmlFloat(r io.ReaderAt, off, size int64) (float64, error) {
+	b, err := readAt(r, off, int(size))
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	}
+	return 0, errors.New("malformed float")
+}
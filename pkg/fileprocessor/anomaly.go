@@ -0,0 +1,86 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/alert"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Change-Rate Anomaly Detection
+// ------------------------
+
+// minBaselineScans is the number of earlier scans of a root needed before
+// its change rate is judged.
+const minBaselineScans = 3
+
+// changeRate is the number of new or modified files per hour between a
+// scan and the one before it.
+func changeRate(changed int, since time.Duration) float64 {
+	hours := math.Max(since.Hours(), 1.0/60) // Back-to-back scans count as a minute apart
+	return float64(changed) / hours
+}
+
+// checkChangeRate records a completed scan of root and raises a
+// change-rate alert if the scan found far more new or modified files per
+// hour than the root's recent history: at least "anomalyMinFiles" files,
+// and a rate above both "anomalyFactor" times the mean and the mean plus
+// that many standard deviations. Bursts like this are typical of
+// ransomware or runaway processes rewriting a tree.
+func checkChangeRate(ps *storage.PersistentStore, root string, scanned, changed int) error {
+	now := time.Now()
+	history, err := ps.AddScan(utils.HostID, root, storage.ScanRecord{At: now, Scanned: scanned, Changed: changed})
+	if err != nil {
+		return err
+	}
+	// The first scan has nothing to compare with, so it sets no rate
+	var rates []float64
+	for i := 1; i < len(history); i++ {
+		rates = append(rates, changeRate(history[i].Changed, history[i].At.Sub(history[i-1].At)))
+	}
+	if len(rates) < minBaselineScans || len(history) == 0 {
+		return nil
+	}
+	rate := changeRate(changed, now.Sub(history[len(history)-1].At))
+
+	var mean, variance float64
+	for _, r := range rates {
+		mean += r
+	}
+	mean /= float64(len(rates))
+	for _, r := range rates {
+		variance += (r - mean) * (r - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(rates)))
+
+	factor := viper.GetFloat64("anomalyFactor")
+	if changed < viper.GetInt("anomalyMinFiles") || rate <= factor*mean || rate <= mean+factor*stddev {
+		return nil
+	}
+	level := alert.Warning
+	if scanned > 0 && float64(changed)/float64(scanned) >= 0.5 {
+		level = alert.Critical
+	}
+	alert.Send(alert.Alert{
+		Level:   level,
+		Kind:    "change-rate",
+		Subject: root,
+		Message: fmt.Sprintf("%d of %d files new or modified since the last scan (%.0f/h against a baseline of %.1f/h)",
+			changed, scanned, rate, mean),
+		Details: map[string]interface{}{
+			"scanned":      scanned,
+			"changed":      changed,
+			"ratePerHour":  rate,
+			"baselineMean": mean,
+			"baselineStd":  stddev,
+			"baselineRuns": len(rates),
+		},
+	})
+	return nil
+}
@@ -0,0 +1,32 @@
+package fileprocessor
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Resumable Index Runs
+// ------------------------
+
+// startCheckpoint returns the checkpoint of the interrupted index run of
+// absRoot when --resume ("resume") is set and there is one, reporting
+// whether it did. Otherwise it discards any old checkpoint and starts a new
+// one.
+func startCheckpoint(ps *storage.PersistentStore, absRoot string) (storage.ScanCheckpoint, bool, error) {
+	if viper.GetBool("resume") {
+		cp, found, err := ps.ScanCheckpoint(utils.HostID, absRoot)
+		if err != nil || found {
+			return cp, found, err
+		}
+	}
+	if err := ps.ClearScanCheckpoint(utils.HostID, absRoot); err != nil {
+		return storage.ScanCheckpoint{}, false, err
+	}
+	cp := storage.ScanCheckpoint{Started: time.Now(), Pending: -1, Done: map[string]bool{}}
+	return cp, false, ps.SaveScanCheckpoint(utils.HostID, absRoot, cp)
+}
@@ -0,0 +1,48 @@
+package fileprocessor
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/chunker"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// Content-Defined Chunk Lists
+// ------------------------
+
+// ChunkOptions returns the chunk size bounds for an average chunk size of
+// "chunkSize" bytes: a quarter of it at least, four times it at most.
+func ChunkOptions() chunker.Options {
+	avg := viper.GetInt("chunkSize")
+	if avg <= 0 {
+		return chunker.DefaultOptions
+	}
+	return chunker.Options{Min: avg / 4, Avg: avg, Max: avg * 4}
+}
+
+// storeChunks records the content-defined chunks of the file at path under
+// meta's ID when "chunks" is set. The file is read in full, in addition to
+// fingerprinting it.
+func storeChunks(ps *storage.PersistentStore, path string, meta metadata.FileMetadata) error {
+	if !viper.GetBool("chunks") {
+		return nil
+	}
+	opts := ChunkOptions()
+	chunks, err := chunker.SplitFile(path, opts)
+	if err != nil {
+		return fmt.Errorf("failed to chunk %s: %w", path, err)
+	}
+	return ps.PutChunks(meta.ID, storage.ChunkList{Options: opts, Chunks: chunks})
+}
+
+// checkChunkOptions rejects unusable chunk sizes before a scan starts.
+func checkChunkOptions() error {
+	if !viper.GetBool("chunks") {
+		return nil
+	}
+	return ChunkOptions().Validate()
+}
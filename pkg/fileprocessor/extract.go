@@ -0,0 +1,32 @@
+package fileprocessor
+
+import (
+	"os"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/extract"
+)
+
+// ------------------------
+// Format Metadata Extraction
+// ------------------------
+
+// Extractors returns the extractors selected with --extract ("extract").
+func Extractors() ([]extract.Extractor, error) {
+	return extract.Lookup(viper.GetStringSlice("extract"))
+}
+
+// extractExtra returns the fields the selected extractors find in a file.
+// Files they cannot read yield what was found before the failure.
+func extractExtra(path string, info os.FileInfo) map[string]interface{} {
+	if info.Size() == 0 || len(viper.GetStringSlice("extract")) == 0 {
+		return nil
+	}
+	exts, err := Extractors()
+	if err != nil {
+		return nil // Reported once by ProcessAllDirectories
+	}
+	extra, _ := extract.File(path, exts)
+	return extra
+}
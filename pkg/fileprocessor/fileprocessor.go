@@ -2,7 +2,6 @@ package fileprocessor
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -13,10 +12,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/charmbracelet/bubbles/progress"
-	"github.com/charmbracelet/bubbles/spinner"
-	"github.com/charmbracelet/lipgloss"
-	"github.com/karrick/godirwalk"
 	"github.com/shirou/gopsutil/disk"
 	"github.com/spf13/viper"
 	"github.com/zeebo/blake3"
@@ -57,6 +52,16 @@ func GetPartitions() ([]disk.PartitionStat, error) {
 // Canonicalize Paths for Physical Uniqueness
 // ------------------------
 
+// networkFSTypes are the filesystems whose paths CanonicalizePath records
+// by server and share rather than by local mountpoint.
+var networkFSTypes = map[string]bool{
+	"nfs":   true,
+	"nfs4":  true,
+	"cifs":  true,
+	"smbfs": true,
+	"afp":   true,
+}
+
 func CanonicalizePath(absPath string) (string, error) {
 	// Windows UNC paths.
 	if runtime.GOOS == "windows" {
@@ -88,13 +93,6 @@ func CanonicalizePath(absPath string) (string, error) {
 		}
 	}
 	if bestLen > 0 {
-		networkFSTypes := map[string]bool{
-			"nfs":   true,
-			"nfs4":  true,
-			"cifs":  true,
-			"smbfs": true,
-			"afp":   true,
-		}
 		if networkFSTypes[strings.ToLower(bestMatch.Fstype)] {
 			relPath := absPath[len(bestMatch.Mountpoint):]
 			if !strings.HasPrefix(relPath, "/") {
@@ -106,252 +104,346 @@ func CanonicalizePath(absPath string) (string, error) {
 	return absPath, nil
 }
 
+// LocalPath reverses CanonicalizePath for this host: a path on a network
+// share mounted here is returned under its mountpoint. Other paths,
+// including those on shares not mounted here, are returned unchanged.
+func LocalPath(canonical string) string {
+	if runtime.GOOS == "windows" {
+		if server, rest, ok := strings.Cut(canonical, ":/"); ok && !strings.Contains(server, `\`) && len(server) > 1 {
+			return `\\` + server + `\` + filepath.FromSlash(rest)
+		}
+		return canonical
+	}
+	parts, err := GetPartitions()
+	if err != nil {
+		return canonical
+	}
+	for _, p := range parts {
+		if !networkFSTypes[strings.ToLower(p.Fstype)] {
+			continue
+		}
+		if rel, ok := strings.CutPrefix(canonical, p.Device+":"); ok {
+			return filepath.Join(p.Mountpoint, filepath.FromSlash(rel))
+		}
+	}
+	return canonical
+}
+
 // ------------------------
 // Fingerprinting and File Processing
 // ------------------------
 
-const fileSampleSize = 1 << 20
-
+// FingerprintFile fingerprints the file at path with the configured
+// strategy (see HashMode and SampleSize).
 func FingerprintFile(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", fmt.Errorf("open file: %w", err)
-	}
-	defer f.Close()
+	return fingerprintPath(path, HashMode(), SampleSize())
+}
 
-	info, err := f.Stat()
-	if err != nil {
-		return "", fmt.Errorf("stat file: %w", err)
-	}
+// MatchesRecord reports whether the file at path has the fingerprint of
+// meta, hashed by the strategy and sample size that produced it.
+func MatchesRecord(path string, meta metadata.FileMetadata) (bool, error) {
+	mode, sampleSize := meta.HashMode()
+	fp, err := fingerprintPath(path, mode, sampleSize)
+	return err == nil && fp == meta.BLAKE3, err
+}
 
-	var data []byte
-	if info.Size() < 3*fileSampleSize {
-		data, err = io.ReadAll(f)
-		if err != nil {
-			return "", fmt.Errorf("read file: %w", err)
-		}
-	} else {
-		data = make([]byte, 0, 3*fileSampleSize)
-		head := make([]byte, fileSampleSize)
-		if _, err := f.Read(head); err != nil {
-			return "", fmt.Errorf("read head: %w", err)
+// MatchesFingerprint reports whether the file at path has the given
+// fingerprint under any strategy, trying the configured one first, since the
+// host that indexed the content may have hashed it differently.
+func MatchesFingerprint(path, fingerprint string) (bool, error) {
+	type strategy struct {
+		mode       string
+		sampleSize int64
+	}
+	tried := map[strategy]bool{}
+	for _, s := range []strategy{
+		{HashMode(), SampleSize()},
+		{metadata.HashSampled, metadata.DefaultSampleSize},
+		{metadata.HashFull, 0}, // chunked gives the same digest
+	} {
+		if s.mode != metadata.HashSampled {
+			s.sampleSize = 0
 		}
-		data = append(data, head...)
-
-		midOffset := info.Size() / 2
-		if _, err := f.Seek(midOffset, io.SeekStart); err != nil {
-			return "", fmt.Errorf("seek middle: %w", err)
+		if tried[s] {
+			continue
 		}
-		mid := make([]byte, fileSampleSize)
-		if _, err := io.ReadFull(f, mid); err != nil {
-			return "", fmt.Errorf("read middle: %w", err)
+		tried[s] = true
+		fp, err := fingerprintPath(path, s.mode, s.sampleSize)
+		if err != nil || fp == fingerprint {
+			return fp == fingerprint, err
 		}
-		data = append(data, mid...)
+	}
+	return false, nil
+}
+
+// sampledHashFile hashes the head, middle and tail of f, sampleSize bytes
+// each, or all of it when it is smaller than three samples. The samples are
+// streamed through the hasher, so memory use does not grow with the sample
+// or file size.
+func sampledHashFile(f *os.File, size, sampleSize int64) (string, error) {
+	if useMmap(size, sampleSize) {
+		return fingerprintMmap(f, size, sampleSize)
+	}
+	if size < 3*sampleSize {
+		return streamHashFile(f)
+	}
 
-		tailOffset := info.Size() - fileSampleSize
-		if _, err := f.Seek(tailOffset, io.SeekStart); err != nil {
-			return "", fmt.Errorf("seek tail: %w", err)
+	buf := getHashBuffer()
+	defer putHashBuffer(buf)
+	h := blake3.New()
+	for _, sample := range []struct {
+		name   string
+		offset int64
+	}{
+		{"head", 0},
+		{"middle", size / 2},
+		{"tail", size - sampleSize},
+	} {
+		n, err := hashCopy(h, io.NewSectionReader(f, sample.offset, sampleSize), *buf)
+		if err == nil && n < sampleSize {
+			err = io.ErrUnexpectedEOF // The file shrank while it was read
 		}
-		tail := make([]byte, fileSampleSize)
-		if _, err := io.ReadFull(f, tail); err != nil {
-			return "", fmt.Errorf("read tail: %w", err)
+		if err != nil {
+			return "", fmt.Errorf("read %s: %w", sample.name, err)
 		}
-		data = append(data, tail...)
 	}
-
-	hash := blake3.Sum256(data)
-	return fmt.Sprintf("%x", hash), nil
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
 // Global swarm delegate.
 var swarmDelegate *network.SwarmDelegate
 
+// SetSwarmDelegate makes processed files broadcast their metadata to the
+// swarm through d (nil stops broadcasting).
+func SetSwarmDelegate(d *network.SwarmDelegate) {
+	swarmDelegate = d
+}
+
+// broadcast queues meta for gossip to the swarm, if one is running.
+func broadcast(meta metadata.FileMetadata) {
+	if swarmDelegate == nil {
+		return
+	}
+	swarmDelegate.QueueMetadata(meta) // Records that fail to seal are not sent
+}
+
 func ProcessFile(ctx context.Context, filePath string, ps *storage.PersistentStore, store bool) (string, error) {
+	fingerprint, _, err := processFile(ctx, filePath, ps, store)
+	return fingerprint, err
+}
+
+// processFile is ProcessFile, also returning the file's info for scan
+// bookkeeping (e.g. counting zero-byte files).
+func processFile(ctx context.Context, filePath string, ps *storage.PersistentStore, store bool) (string, os.FileInfo, error) {
+	meta, info, err := readMetadata(ctx, filePath)
+	if err != nil || info.IsDir() {
+		return "", info, err
+	}
+	if store {
+		if meta, err = ps.Stamp(meta); err != nil {
+			return "", info, fmt.Errorf("failed to store metadata for %s: %w", filePath, err)
+		}
+		if err := ps.Put(meta); err != nil {
+			return "", info, fmt.Errorf("failed to store metadata for %s: %w", filePath, err)
+		}
+		if err := storeChunks(ps, filePath, meta); err != nil {
+			return "", info, err
+		}
+		broadcast(meta)
+	}
+	return meta.BLAKE3, info, nil
+}
+
+// readMetadata stats and fingerprints a file and builds the record stored
+// for it. Directories yield their info and an empty record.
+func readMetadata(ctx context.Context, filePath string) (metadata.FileMetadata, os.FileInfo, error) {
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
+		return metadata.FileMetadata{}, nil, ctx.Err()
 	default:
 	}
 	info, err := os.Stat(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to stat %s: %w", filePath, err)
+		return metadata.FileMetadata{}, nil, fmt.Errorf("failed to stat %s: %w", filePath, err)
 	}
 	if info.IsDir() {
-		return "", nil
+		return metadata.FileMetadata{}, info, nil
 	}
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path for %s: %w", filePath, err)
+		return metadata.FileMetadata{}, info, fmt.Errorf("failed to get absolute path for %s: %w", filePath, err)
 	}
 	canonicalPath, err := CanonicalizePath(absPath)
 	if err != nil {
 		canonicalPath = absPath
 	}
-	fingerprint, err := FingerprintFile(filePath)
+	mode, sampleSize := HashMode(), SampleSize()
+	hashStart := time.Now()
+	fingerprint, err := fingerprintPath(filePath, mode, sampleSize)
 	if err != nil {
-		return "", fmt.Errorf("failed to fingerprint %s: %w", filePath, err)
+		return metadata.FileMetadata{}, info, fmt.Errorf("failed to fingerprint %s: %w", filePath, err)
 	}
-	if store {
-		bytes := info.Size()
-		modTime := info.ModTime().Format(time.RFC3339)
+	network.ObserveHash(hashedBytes(info.Size(), mode, sampleSize), time.Since(hashStart))
+	bytes := info.Size()
+	modTime := info.ModTime().Format(time.RFC3339)
 
-		idString := utils.HostID + "|" + canonicalPath + "|" + modTime + "|" + strconv.FormatInt(bytes, 16) + "|" + fingerprint
-		UUID := utils.GenerateUUID(idString)
+	extra := detailsExtra(filePath, info)
+	for k, v := range macOSExtra(filePath) {
+		extra[k] = v
+	}
+	for k, v := range gitExtra(absPath) {
+		extra[k] = v
+	}
+	for k, v := range textStatsExtra(filePath, info) {
+		extra[k] = v
+	}
+	for k, v := range lockExtra(filePath, info) {
+		extra[k] = v
+	}
+	for k, v := range fileTypeExtra(filePath, info) {
+		extra[k] = v
+	}
+	for k, v := range extractExtra(filePath, info) {
+		extra[k] = v
+	}
+	for k, v := range volumeExtra(absPath) {
+		extra[k] = v
+	}
+	extra[metadata.HashModeField] = mode
+	if mode == metadata.HashSampled {
+		extra[metadata.SampleSizeField] = sampleSize
+	}
 
-		meta := metadata.FileMetadata{
-			ID:       UUID,
-			IDString: idString,
-			HostID:   utils.HostID,
-			FilePath: canonicalPath,
-			Size:     bytes,
-			ModTime:  modTime,
-			BLAKE3:   fingerprint,
-			Extra:    map[string]interface{}{},
-		}
-		if err := ps.Put(meta); err != nil {
-			return "", fmt.Errorf("failed to store metadata for %s: %w", filePath, err)
-		}
-		if swarmDelegate != nil {
-			data, err := json.Marshal(meta)
-			if err == nil {
-				swarmDelegate.Broadcasts.QueueBroadcast(&network.FileMetaBroadcast{Msg: data})
-			}
-		}
+	idString := utils.HostID + "|" + canonicalPath + "|" + modTime + "|" + strconv.FormatInt(bytes, 16) + "|" + fingerprint
+	meta := metadata.FileMetadata{
+		ID:       utils.GenerateUUID(idString),
+		IDString: idString,
+		HostID:   utils.HostID,
+		FilePath: canonicalPath,
+		Size:     bytes,
+		ModTime:  modTime,
+		BLAKE3:   fingerprint,
+		Extra:    extra,
 	}
-	return fingerprint, nil
+	tagByRules(&meta)
+	return meta, info, nil
 }
 
 // ------------------------
-// Directory Processing with godirwalk and Charm UI Feedback
+// Directory Processing
 // ------------------------
 
-// ProcessAllDirectories scans the root directory and processes its files,
-// then collects subdirectories and processes them one at a time. A spinner is
-// shown while reading directories, and a progress bar is updated per subdirectory.
+// ProcessAllDirectories indexes the files under root through the scan
+// pipeline (see runScan), then records the empty directories, the change
+// rate and a signed manifest of the scan, and notes when the volume holding
+// root was scanned (see noteVolume). A scan of a network share may be
+// shared with other swarm nodes (see claimSharedScan).
 func ProcessAllDirectories(ctx context.Context, root string, ps *storage.PersistentStore) error {
+	if err := checkHashMode(); err != nil {
+		return err
+	}
+	if err := checkChunkOptions(); err != nil {
+		return err
+	}
+	if err := checkTagRules(); err != nil {
+		return err
+	}
+	if _, err := Extractors(); err != nil {
+		return err
+	}
 	quiet := viper.GetBool("quiet")
-	if !quiet {
-		fmt.Println("Reading files...")
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	cp, resumed, err := startCheckpoint(ps, absRoot)
+	if err != nil {
+		return err
+	}
+	started := cp.Started
+	leaves := &scanLeaves{root: root, errors: cp.Errors}
+	if resumed && !quiet {
+		fmt.Printf("Resuming the scan of %s started %s (%d directories done)\n", absRoot, started.Local().Format(time.DateTime), len(cp.Done))
 	}
-	// Process files in the root directory.
 	if !quiet {
-		fmt.Printf("Processing root directory: %s\n", root)
-	}
-	err := godirwalk.Walk(root, &godirwalk.Options{
-		Unsorted: true,
-		Callback: func(path string, de *godirwalk.Dirent) error {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
-			// Only process files directly in root.
-			if de.IsDir() && path != root {
-				return godirwalk.SkipThis
-			}
-			if !de.IsDir() {
-				_, err := ProcessFile(ctx, path, ps, true)
-				if err != nil && !quiet {
-					fmt.Printf("Error processing %s: %v\n", path, err)
-				}
-			}
-			return nil
-		},
-	})
+		fmt.Printf("Indexing %s with %d workers...\n", root, scanWorkers())
+	}
+	shared, err := claimSharedScan(ctx, absRoot)
 	if err != nil {
 		return err
 	}
-
-	// Collect all subdirectories.
-	var subdirs []string
-	err = godirwalk.Walk(root, &godirwalk.Options{
-		Unsorted: true,
-		Callback: func(path string, de *godirwalk.Dirent) error {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
-			if de.IsDir() && path != root {
-				subdirs = append(subdirs, path)
-			}
-			return nil
-		},
-	})
+	vol, onVolume := noteVolume(ps, absRoot, quiet)
+	walk, err := runScan(ctx, root, absRoot, ps, &cp, leaves, shared.pruned())
+	shared.finish(err)
 	if err != nil {
 		return err
 	}
-
-	// Process each subdirectory.
-	for i, dir := range subdirs {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-		if !quiet {
-			fmt.Printf("\nProcessing directory (%d/%d): %s\n", i+1, len(subdirs), dir)
-		}
-		// Collect files in the subdirectory.
-		var filesInDir []string
-		err = godirwalk.Walk(dir, &godirwalk.Options{
-			Unsorted: true,
-			Callback: func(path string, de *godirwalk.Dirent) error {
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-				}
-				if !de.IsDir() {
-					filesInDir = append(filesInDir, path)
+	partial := len(shared.pruned()) > 0
+	if onVolume && !partial {
+		finishVolumeScan(ps, vol, absRoot, quiet)
+	}
+	zeroByteFiles, skipped, scanned, changed := cp.ZeroByte, cp.Skipped, cp.Scanned, cp.Changed
+	// Recorded by canonical path, as file records are
+	canonicalDirs := func(dirs []string) []string {
+		for i, dir := range dirs {
+			if abs, err := filepath.Abs(dir); err == nil {
+				dirs[i] = abs
+				if canonical, err := CanonicalizePath(abs); err == nil {
+					dirs[i] = canonical
 				}
-				return nil
-			},
-		})
-		if err != nil {
-			if !quiet {
-				fmt.Printf("Error reading directory %s: %v\n", dir, err)
 			}
-			continue
 		}
-		totalFiles := len(filesInDir)
-		if totalFiles == 0 {
-			continue
+		return dirs
+	}
+	emptyDirs := canonicalDirs(walk.emptyDirs)
+	// The empty directories found before in subtrees this scan left to
+	// other nodes or could not list are kept
+	unscanned := walk.unreadDirs
+	for name := range shared.pruned() {
+		if name != "." {
+			unscanned = append(unscanned, filepath.Join(absRoot, name))
 		}
-		// Initialize progress bar and spinner.
-		var sp spinner.Model
-		if !quiet {
-			sp = spinner.New()
-			sp.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Bold(true)
-			go func() {
-				for {
-					sp.Tick()
-					time.Sleep(sp.Spinner.FPS)
-				}
-			}()
-			fmt.Printf("Processing files in %s...\n", dir)
+	}
+	unscanned = canonicalDirs(unscanned)
+	canonicalRoot, err := CanonicalizePath(absRoot)
+	if err != nil {
+		canonicalRoot = absRoot
+	}
+	if err := ps.ReplaceEmptyDirs(utils.HostID, canonicalRoot, unscanned, emptyDirs); err != nil && !quiet {
+		fmt.Printf("Error recording empty directories: %v\n", err)
+	}
+	// A forced scan re-fingerprints everything, which says nothing
+	// about how much changed; a shared one sees only part of the tree
+	if !viper.GetBool("force") && !partial {
+		if err := checkChangeRate(ps, absRoot, scanned, changed); err != nil && !quiet {
+			fmt.Printf("Error recording scan history: %v\n", err)
 		}
-		p := progress.New(progress.WithDefaultGradient())
-		var processed int64
-		for _, fpath := range filesInDir {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
-			_, err := ProcessFile(ctx, fpath, ps, true)
-			if err != nil && !quiet {
-				fmt.Printf("Error processing %s: %v\n", fpath, err)
-			}
-			processed++
-			if !quiet {
-				percent := float64(processed) / float64(totalFiles)
-				fmt.Printf("\r%s", p.ViewAs(percent))
-			}
+	}
+	// A resumed run has not seen the files of the directories it skipped
+	if resumed {
+		if !quiet {
+			fmt.Println("No manifest is signed for a resumed scan; a full scan signs one")
 		}
+	} else if partial {
 		if !quiet {
-			fmt.Println()
+			fmt.Println("No manifest is signed for a scan shared with other swarm nodes")
+		}
+	} else if m, err := writeManifest(ps, absRoot, leaves, started, changed); err != nil && !quiet {
+		fmt.Printf("Error writing scan manifest: %v\n", err)
+	} else if err == nil && !quiet {
+		fmt.Printf("Signed manifest %s: %d files, Merkle root %s\n", m.ID, m.Files, m.MerkleRoot)
+	}
+	if err := ps.ClearScanCheckpoint(utils.HostID, absRoot); err != nil && !quiet {
+		fmt.Printf("Error clearing scan checkpoint: %v\n", err)
+	}
+	if !quiet {
+		if skipped > 0 {
+			fmt.Printf("Skipped %d unchanged files (use --force to re-fingerprint them)\n", skipped)
+		}
+		if walk.excludedFiles > 0 || walk.excludedDirs > 0 {
+			fmt.Printf("Excluded %d files and %d directories (--exclude, --include, %s)\n", walk.excludedFiles, walk.excludedDirs, IgnoreFileName)
 		}
+		fmt.Printf("Found %d zero-byte files and %d empty directories (see 'indexer report empty')\n", zeroByteFiles, len(emptyDirs))
 	}
 	return nil
 }
@@ -0,0 +1,155 @@
+package fileprocessor
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// MIME Type and Magic-Number Detection
+// ------------------------
+
+// Extra fields recorded by --detect-types.
+const (
+	ContentTypeField = "contentType" // MIME type sniffed from the content, without parameters
+	FileKindField    = "fileKind"    // Broad kind, e.g. video or archive (see fileKinds)
+)
+
+// typeSniffSize is the number of leading bytes inspected, as many as
+// http.DetectContentType considers.
+const typeSniffSize = 512
+
+// magic is a signature at an offset, for formats http.DetectContentType
+// does not know or reports only generically.
+type magic struct {
+	offset   int
+	sig      []byte
+	mimeType string
+}
+
+// magicNumbers are checked in order before http.DetectContentType.
+var magicNumbers = []magic{
+	{0, []byte("\x7fELF"), "application/x-executable"},
+	{0, []byte{0xFE, 0xED, 0xFA, 0xCE}, "application/x-mach-binary"},
+	{0, []byte{0xFE, 0xED, 0xFA, 0xCF}, "application/x-mach-binary"},
+	{0, []byte{0xCE, 0xFA, 0xED, 0xFE}, "application/x-mach-binary"},
+	{0, []byte{0xCF, 0xFA, 0xED, 0xFE}, "application/x-mach-binary"},
+	{0, []byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{0, []byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{0, []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}, "application/x-xz"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte{0x28, 0xB5, 0x2F, 0xFD}, "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("8BPS"), "image/vnd.adobe.photoshop"},
+	{4, []byte("ftypheic"), "image/heic"},
+	{4, []byte("ftypheix"), "image/heic"},
+	{4, []byte("ftypmif1"), "image/heif"},
+	{4, []byte("ftypavif"), "image/avif"},
+	{4, []byte("ftypqt  "), "video/quicktime"},
+	{4, []byte("ftypM4A "), "audio/mp4"},
+	{4, []byte("ftyp3gp"), "video/3gpp"},
+	{0, []byte{0x1A, 0x45, 0xDF, 0xA3}, ""}, // EBML: Matroska or WebM, see ebmlType
+}
+
+// fileKinds maps MIME types that do not name their kind by their top-level
+// type (video/, audio/, image/, text/, font/) to one.
+var fileKinds = map[string]string{
+	"application/zip":                               "archive",
+	"application/x-gzip":                            "archive",
+	"application/gzip":                              "archive",
+	"application/x-rar-compressed":                  "archive",
+	"application/x-7z-compressed":                   "archive",
+	"application/x-xz":                              "archive",
+	"application/x-bzip2":                           "archive",
+	"application/zstd":                              "archive",
+	"application/x-tar":                             "archive",
+	"application/pdf":                               "document",
+	"application/postscript":                        "document",
+	"application/rtf":                               "document",
+	"application/x-executable":                      "executable",
+	"application/x-mach-binary":                     "executable",
+	"application/wasm":                              "executable",
+	"application/vnd.sqlite3":                       "database",
+	"application/json":                              "text",
+	"application/xml":                               "text",
+	"application/javascript":                        "text",
+	"application/ogg":                               "audio",
+	"application/vnd.ms-fontobject":                 "font",
+	"application/x-shockwave-flash":                 "video",
+	"application/vnd.adobe.photoshop":               "image",
+	"application/vnd.microsoft.portable-executable": "executable",
+}
+
+// fileTypeExtra returns the MIME type and kind of a file sniffed from its
+// first bytes when --detect-types is enabled. Empty files yield nil.
+func fileTypeExtra(path string, info os.FileInfo) map[string]interface{} {
+	if !viper.GetBool("detectTypes") || info.Size() == 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	head := make([]byte, typeSniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil
+	}
+	mimeType := DetectContentType(head[:n])
+	return map[string]interface{}{
+		ContentTypeField: mimeType,
+		FileKindField:    FileKind(mimeType),
+	}
+}
+
+// DetectContentType returns the MIME type of content from its leading
+// bytes, without parameters; "application/octet-stream" if unknown.
+func DetectContentType(head []byte) string {
+	for _, m := range magicNumbers {
+		if len(head) < m.offset+len(m.sig) || !bytes.Equal(head[m.offset:m.offset+len(m.sig)], m.sig) {
+			continue
+		}
+		if m.mimeType == "" {
+			return ebmlType(head)
+		}
+		return m.mimeType
+	}
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mimeType
+}
+
+// ebmlType tells WebM from other Matroska files by the DocType in the EBML
+// header.
+func ebmlType(head []byte) string {
+	if bytes.Contains(head, []byte("webm")) {
+		return "video/webm"
+	}
+	return "video/x-matroska"
+}
+
+// FileKind returns the broad kind of a MIME type: video, audio, image,
+// text, font, archive, document, executable, database or other.
+func FileKind(mimeType string) string {
+	if kind, ok := fileKinds[mimeType]; ok {
+		return kind
+	}
+	switch top, _, _ := strings.Cut(mimeType, "/"); top {
+	case "video", "audio", "image", "text", "font":
+		return top
+	}
+	return "other"
+}
@@ -0,0 +1,213 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/spf13/viper"
+	"github.com/zeebo/blake3"
+	"lukechampine.com/blake3/guts"
+)
+
+// ------------------------
+// Full-Content Hashing
+// ------------------------
+
+// fullHashRangeSize is the span each worker hashes when a file is split for
+// parallel hashing: 2^16 BLAKE3 chunks, so that each range is a complete
+// subtree of the file's chunk tree.
+const fullHashRangeSize = 64 << 20
+
+// fullHashBufferSize is the read buffer used while streaming a file or a
+// range of one.
+const fullHashBufferSize = 1 << 20
+
+// hashBuffers holds read buffers for hashing, so that each file or range
+// hashed reuses one instead of allocating its own.
+var hashBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, fullHashBufferSize)
+		return &buf
+	},
+}
+
+func getHashBuffer() *[]byte {
+	return hashBuffers.Get().(*[]byte)
+}
+
+func putHashBuffer(buf *[]byte) {
+	hashBuffers.Put(buf)
+}
+
+// hashCopy streams r into h through buf. r is wrapped so that io.CopyBuffer
+// really uses buf: *os.File implements io.WriterTo, which would otherwise
+// take over and allocate a buffer of its own.
+func hashCopy(h io.Writer, r io.Reader, buf []byte) (int64, error) {
+	return io.CopyBuffer(h, struct{ io.Reader }{r}, buf)
+}
+
+// hashWorkers returns the number of goroutines used to hash ranges of a
+// single file (--hash-workers; 0 means one per CPU).
+func hashWorkers() int {
+	if n := viper.GetInt("hashWorkers"); n > 0 {
+		return n
+	}
+	return runtime.NumCPU()
+}
+
+// streamHashFile hashes the entire content of f through a single BLAKE3
+// hasher, giving the same digest as b3sum.
+func streamHashFile(f *os.File) (string, error) {
+	buf := getHashBuffer()
+	defer putHashBuffer(buf)
+	h := blake3.New()
+	if _, err := hashCopy(h, f, *buf); err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// cvStack holds the chaining values of the complete BLAKE3 subtrees hashed
+// so far, at most one per height, as the reference hasher keeps them. Its
+// counter is the number of chunks they cover, from base.
+type cvStack struct {
+	cvs     [64][8]uint32
+	base    uint64
+	counter uint64
+}
+
+func (s *cvStack) has(height int) bool {
+	return s.counter&(1<<height) != 0
+}
+
+// push adds the chaining value of the next subtree, of 2^height chunks,
+// merging it with the subtrees before it that it completes.
+func (s *cvStack) push(cv [8]uint32, height int) {
+	i := height
+	for ; s.has(i); i++ {
+		cv = guts.ChainingValue(guts.ParentNode(s.cvs[i], cv, &guts.IV, 0))
+	}
+	s.cvs[i] = cv
+	s.counter += 1 << height
+}
+
+// pushStack adds the subtrees of t, which follows s, largest first.
+func (s *cvStack) pushStack(t *cvStack) {
+	for i := len(t.cvs) - 1; i >= 0; i-- {
+		if t.has(i) {
+			s.push(t.cvs[i], i)
+		}
+	}
+}
+
+// root merges the last chunk of the input with the stacked subtrees into
+// the root node.
+func (s *cvStack) root(last []byte) guts.Node {
+	n := guts.CompressChunk(last, &guts.IV, s.base+s.counter, 0)
+	for i := bits.TrailingZeros64(s.counter); i < bits.Len64(s.counter); i++ {
+		if s.has(i) {
+			n = guts.ParentNode(s.cvs[i], guts.ChainingValue(n), &guts.IV, 0)
+		}
+	}
+	n.Flags |= guts.FlagRoot
+	return n
+}
+
+// hashSubtrees hashes length bytes of f from offset into the BLAKE3 subtrees
+// they form. offset and length are whole chunks; offset starts a subtree at
+// least as large as the span.
+func hashSubtrees(f *os.File, offset, length int64, buf []byte) (*cvStack, error) {
+	const group = guts.MaxSIMD * guts.ChunkSize
+	s := &cvStack{base: uint64(offset / guts.ChunkSize)}
+	section := io.NewSectionReader(f, offset, length)
+	for {
+		n, err := io.ReadFull(section, buf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		data := buf[:n]
+		for ; len(data) >= group; data = data[group:] {
+			node := guts.CompressBuffer((*[group]byte)(data[:group]), group, &guts.IV, s.base+s.counter, 0)
+			s.push(guts.ChainingValue(node), 4)
+		}
+		for ; len(data) > 0; data = data[guts.ChunkSize:] {
+			node := guts.CompressChunk(data[:guts.ChunkSize], &guts.IV, s.base+s.counter, 0)
+			s.push(guts.ChainingValue(node), 0)
+		}
+		if err != nil {
+			return s, nil
+		}
+	}
+}
+
+// fullHashFile hashes the entire content of f. Files no larger than one range
+// are streamed through a single BLAKE3 hasher. Larger files are split into
+// fixed-size ranges, each a complete subtree of BLAKE3's chunk tree, that are
+// hashed concurrently and then joined as BLAKE3 joins subtrees, so that the
+// fingerprint is the file's BLAKE3 digest, as b3sum prints it, and a single
+// huge file no longer serializes the pipeline.
+func fullHashFile(f *os.File, size int64) (string, error) {
+	if size <= fullHashRangeSize {
+		return streamHashFile(f)
+	}
+
+	// The last chunk is held back: it becomes the root node's input
+	lastLen := (size-1)%guts.ChunkSize + 1
+	ranges := int((size + fullHashRangeSize - 1) / fullHashRangeSize)
+	stacks := make([]*cvStack, ranges)
+	jobs := make(chan int)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	workers := hashWorkers()
+	if workers > ranges {
+		workers = ranges
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := getHashBuffer()
+			defer putHashBuffer(buf)
+			for i := range jobs {
+				offset := int64(i) * fullHashRangeSize
+				length := size - lastLen - offset
+				if length > fullHashRangeSize {
+					length = fullHashRangeSize
+				}
+				s, err := hashSubtrees(f, offset, length, *buf)
+				if err != nil {
+					errOnce.Do(func() { firstErr = fmt.Errorf("read range %d: %w", i, err) })
+					continue
+				}
+				stacks[i] = s
+			}
+		}()
+	}
+	for i := 0; i < ranges; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	last := make([]byte, lastLen)
+	if _, err := f.ReadAt(last, size-lastLen); err != nil {
+		return "", fmt.Errorf("read last chunk: %w", err)
+	}
+	tree := &cvStack{}
+	for _, s := range stacks {
+		tree.pushStack(s)
+	}
+	out := guts.WordsToBytes(guts.CompressNode(tree.root(last)))
+	return fmt.Sprintf("%x", out[:32]), nil
+}
@@ -0,0 +1,95 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zeebo/blake3"
+)
+
+// writeTestFile writes size pseudo-random bytes to a file under t's temp
+// directory and returns it opened, with the bytes' BLAKE3 digest.
+func writeTestFile(t *testing.T, size int64) (*os.File, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := blake3.New()
+	rng := rand.New(rand.NewSource(size))
+	buf := make([]byte, 1<<20)
+	for left := size; left > 0; {
+		n := int64(len(buf))
+		if left < n {
+			n = left
+		}
+		rng.Read(buf[:n])
+		if _, err := out.Write(buf[:n]); err != nil {
+			t.Fatal(err)
+		}
+		h.Write(buf[:n])
+		left -= n
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f, fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func TestFullHashFile(t *testing.T) {
+	const chunk = 1024 // BLAKE3 chunk size
+	tests := []struct {
+		name string
+		size int64
+	}{
+		{"empty", 0},
+		{"one byte", 1},
+		{"one chunk", chunk},
+		{"chunk and a byte", chunk + 1},
+		{"one range", fullHashRangeSize},
+		{"range and a byte", fullHashRangeSize + 1},
+		{"range and a chunk", fullHashRangeSize + chunk},
+		{"two ranges", 2 * fullHashRangeSize},
+		{"uneven tail", 2*fullHashRangeSize + 3*chunk + 7},
+		{"three ranges", 3 * fullHashRangeSize},
+	}
+	t.Cleanup(func() { viper.Set("hashWorkers", 0) })
+	for _, workers := range []int{1, 4} {
+		viper.Set("hashWorkers", workers)
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/%d workers", tt.name, workers), func(t *testing.T) {
+				if testing.Short() && tt.size > fullHashRangeSize {
+					t.Skip("large file")
+				}
+				f, want := writeTestFile(t, tt.size)
+				got, err := fullHashFile(f, tt.size)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("fullHashFile = %s, want %s", got, want)
+				}
+				if _, err := f.Seek(0, 0); err != nil {
+					t.Fatal(err)
+				}
+				streamed, err := streamHashFile(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if streamed != want {
+					t.Errorf("streamHashFile = %s, want %s", streamed, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package fileprocessor
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karrick/godirwalk"
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// Git Work Tree Awareness
+// ------------------------
+
+// gitRepo caches what we learn about a work tree so git is consulted once
+// per repository rather than once per file.
+type gitRepo struct {
+	Root    string
+	Commit  string
+	Branch  string
+	tracked map[string]bool // Repo-relative slash paths known to the index
+	dirty   map[string]bool // Repo-relative slash paths with uncommitted changes
+	hasIdx  bool            // Whether tracked/dirty could be determined
+
+	gitDir string
+	stamp  gitStamp
+	loaded time.Time
+}
+
+// gitRepoTTL bounds how long a repository's status is reused: edits to
+// tracked files make them dirty without touching .git, so a long-running
+// 'indexer watch' must ask git again.
+const gitRepoTTL = 5 * time.Second
+
+// gitStamp is the modification times of .git/HEAD and .git/index, which
+// change on checkout, commit, staging and reset.
+type gitStamp struct {
+	head, index time.Time
+}
+
+func readGitStamp(gitDir string) gitStamp {
+	var st gitStamp
+	if info, err := os.Stat(filepath.Join(gitDir, "HEAD")); err == nil {
+		st.head = info.ModTime()
+	}
+	if info, err := os.Stat(filepath.Join(gitDir, "index")); err == nil {
+		st.index = info.ModTime()
+	}
+	return st
+}
+
+// stale reports whether the repository may have changed since it was
+// loaded.
+func (r *gitRepo) stale() bool {
+	return time.Since(r.loaded) > gitRepoTTL || readGitStamp(r.gitDir) != r.stamp
+}
+
+var (
+	gitRepoCache = make(map[string]string)   // Directory -> work tree root ("" if not in one)
+	gitRepos     = make(map[string]*gitRepo) // Work tree root -> repo, reloaded when stale
+	gitRepoMutex sync.Mutex
+)
+
+// isGitDir reports whether a walked entry is a .git directory that should be
+// skipped; indexing thousands of loose git objects is rarely useful.
+func isGitDir(de *godirwalk.Dirent) bool {
+	return de.IsDir() && de.Name() == ".git" && viper.GetBool("skipGit")
+}
+
+// gitExtra returns Extra fields describing the git work tree containing path
+// (repo root, current commit and branch, tracked/dirty status), or nil if
+// git info is disabled or the file is not in a work tree.
+func gitExtra(absPath string) map[string]interface{} {
+	if !viper.GetBool("gitInfo") {
+		return nil
+	}
+	repo := findGitRepo(filepath.Dir(absPath))
+	if repo == nil {
+		return nil
+	}
+	extra := map[string]interface{}{
+		"gitRoot": repo.Root,
+	}
+	if repo.Commit != "" {
+		extra["gitCommit"] = repo.Commit
+	}
+	if repo.Branch != "" {
+		extra["gitBranch"] = repo.Branch
+	}
+	if repo.hasIdx {
+		if rel, err := filepath.Rel(repo.Root, absPath); err == nil {
+			rel = filepath.ToSlash(rel)
+			extra["gitTracked"] = repo.tracked[rel]
+			extra["gitDirty"] = repo.dirty[rel]
+		}
+	}
+	return extra
+}
+
+func findGitRepo(dir string) *gitRepo {
+	gitRepoMutex.Lock()
+	defer gitRepoMutex.Unlock()
+	return findGitRepoLocked(dir)
+}
+
+func findGitRepoLocked(dir string) *gitRepo {
+	root, ok := gitRepoCache[dir]
+	if !ok {
+		root = findGitRoot(dir)
+		gitRepoCache[dir] = root
+	}
+	if root == "" {
+		return nil
+	}
+	// Repos are replaced rather than updated, as callers read them unlocked
+	repo := gitRepos[root]
+	if repo == nil || repo.stale() {
+		gitDir := resolveGitDir(root)
+		if gitDir == "" {
+			return nil
+		}
+		repo = loadGitRepo(root, gitDir)
+		gitRepos[root] = repo
+	}
+	return repo
+}
+
+// findGitRoot returns the root of the work tree containing dir, "" if none.
+func findGitRoot(dir string) string {
+	if root, ok := gitRepoCache[dir]; ok {
+		return root
+	}
+	root := ""
+	if resolveGitDir(dir) != "" {
+		root = dir
+	} else if parent := filepath.Dir(dir); parent != dir {
+		root = findGitRoot(parent)
+	}
+	gitRepoCache[dir] = root
+	return root
+}
+
+// resolveGitDir returns the git directory for a work tree root, following
+// the "gitdir:" indirection used by worktrees and submodules.
+func resolveGitDir(root string) string {
+	dotGit := filepath.Join(root, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return ""
+	}
+	if info.IsDir() {
+		return dotGit
+	}
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return ""
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return ""
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(root, gitDir)
+	}
+	return gitDir
+}
+
+func loadGitRepo(root, gitDir string) *gitRepo {
+	// Stamped before reading, so a change while loading reloads next time
+	repo := &gitRepo{Root: root, gitDir: gitDir, stamp: readGitStamp(gitDir), loaded: time.Now()}
+	repo.Commit, repo.Branch = readGitHead(gitDir)
+
+	// Tracked and dirty status come from git itself; without git on PATH we
+	// still record the root and commit.
+	lsFiles, err := exec.Command("git", "-C", root, "ls-files", "-z").Output()
+	if err != nil {
+		return repo
+	}
+	status, err := exec.Command("git", "-C", root, "status", "--porcelain", "-z").Output()
+	if err != nil {
+		return repo
+	}
+	repo.hasIdx = true
+	repo.tracked = make(map[string]bool)
+	for _, p := range bytes.Split(lsFiles, []byte{0}) {
+		if len(p) > 0 {
+			repo.tracked[string(p)] = true
+		}
+	}
+	repo.dirty = make(map[string]bool)
+	entries := bytes.Split(status, []byte{0})
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if len(e) < 4 {
+			continue
+		}
+		repo.dirty[string(e[3:])] = true
+		// Renames and copies are followed by the original path.
+		if e[0] == 'R' || e[0] == 'C' {
+			i++
+		}
+	}
+	return repo
+}
+
+// readGitHead resolves HEAD to a commit without shelling out.
+func readGitHead(gitDir string) (commit, branch string) {
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", ""
+	}
+	head := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(head, "ref: ") {
+		return head, "" // Detached HEAD
+	}
+	ref := strings.TrimPrefix(head, "ref: ")
+	branch = strings.TrimPrefix(ref, "refs/heads/")
+
+	// Worktrees keep shared refs in the common directory.
+	dirs := []string{gitDir}
+	if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		c := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(c) {
+			c = filepath.Join(gitDir, c)
+		}
+		dirs = append(dirs, c)
+	}
+	for _, dir := range dirs {
+		if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(data)), branch
+		}
+	}
+	for _, dir := range dirs {
+		f, err := os.Open(filepath.Join(dir, "packed-refs"))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && fields[1] == ref {
+				f.Close()
+				return fields[0], branch
+			}
+		}
+		f.Close()
+	}
+	return "", branch
+}
@@ -0,0 +1,83 @@
+package fileprocessor
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Fingerprint Benchmark
+// ------------------------
+
+// HashBenchResult is the cost of fingerprinting one file with one strategy.
+type HashBenchResult struct {
+	Mode       string        `json:"mode"`
+	Size       int64         `json:"size"` // File size
+	Read       int64         `json:"read"` // Bytes hashed
+	Elapsed    time.Duration `json:"elapsed"`
+	Allocated  uint64        `json:"allocated"`  // Bytes allocated while hashing
+	PeakHeap   uint64        `json:"peakHeap"`   // Highest in-use heap seen, above the starting heap
+	Goroutines int           `json:"goroutines"` // Hashing goroutines (chunked mode)
+}
+
+// Throughput returns the bytes hashed per second.
+func (r HashBenchResult) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Read) / r.Elapsed.Seconds()
+}
+
+// HashBench fingerprints the file at path with the given strategy and
+// measures time and memory. The heap is sampled every few milliseconds
+// while hashing, so PeakHeap shows whether memory stays flat as files grow.
+func HashBench(path, mode string, sampleSize int64) (HashBenchResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return HashBenchResult{}, err
+	}
+	res := HashBenchResult{Mode: mode, Size: info.Size(), Read: info.Size(), Goroutines: 1}
+	switch {
+	case mode == metadata.HashSampled && info.Size() >= 3*sampleSize:
+		res.Read = 3 * sampleSize
+	case mode == metadata.HashChunked && info.Size() > fullHashRangeSize:
+		res.Goroutines = min(hashWorkers(), int((info.Size()+fullHashRangeSize-1)/fullHashRangeSize))
+	}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var max uint64
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			if ms.HeapInuse > before.HeapInuse && ms.HeapInuse-before.HeapInuse > max {
+				max = ms.HeapInuse - before.HeapInuse
+			}
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	start := time.Now()
+	_, err = fingerprintPath(path, mode, sampleSize)
+	res.Elapsed = time.Since(start)
+	close(done)
+	res.PeakHeap = <-peak
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	res.Allocated = after.TotalAlloc - before.TotalAlloc
+	return res, err
+}
@@ -0,0 +1,82 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Fingerprint Strategies
+// ------------------------
+
+// HashMode returns the configured fingerprint strategy (--hash-mode):
+// "sampled" (the default), "full" or "chunked". The older --full-hash flag
+// selects chunked hashing, which is what it has always done.
+func HashMode() string {
+	if viper.GetBool("fullHash") {
+		return metadata.HashChunked
+	}
+	if mode := viper.GetString("hashMode"); mode != "" {
+		return mode
+	}
+	return metadata.HashSampled
+}
+
+// SampleSize returns the bytes hashed from each of the head, middle and
+// tail of a file in sampled mode (--sample-size).
+func SampleSize() int64 {
+	if n := viper.GetInt64("sampleSize"); n > 0 {
+		return n
+	}
+	return metadata.DefaultSampleSize
+}
+
+// checkHashMode rejects an unknown --hash-mode before a scan starts.
+func checkHashMode() error {
+	switch mode := HashMode(); mode {
+	case metadata.HashSampled, metadata.HashFull, metadata.HashChunked:
+		return nil
+	default:
+		return fmt.Errorf("unknown hash mode %q (want sampled, full or chunked)", mode)
+	}
+}
+
+// fingerprintPath fingerprints the file at path with the given strategy.
+// sampleSize is used only in sampled mode.
+func fingerprintPath(path, mode string, sampleSize int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat file: %w", err)
+	}
+
+	switch mode {
+	case metadata.HashSampled:
+		return sampledHashFile(f, info.Size(), sampleSize)
+	case metadata.HashFull:
+		return streamHashFile(f)
+	case metadata.HashChunked:
+		return fullHashFile(f, info.Size())
+	default:
+		return "", fmt.Errorf("unknown hash mode %q", mode)
+	}
+}
+
+// hashedBytes returns how many bytes of a file of the given size
+// fingerprintPath reads: three samples in sampled mode, unless the file is
+// too small to sample, and the whole file otherwise.
+func hashedBytes(size int64, mode string, sampleSize int64) int64 {
+	if mode == metadata.HashSampled && size >= 3*sampleSize {
+		return 3 * sampleSize
+	}
+	return size
+}
@@ -0,0 +1,238 @@
+package fileprocessor
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// Exclude/Include Patterns and .dreamfsignore
+// ------------------------
+
+// IgnoreFileName is the file whose patterns, with gitignore semantics, leave
+// paths in its directory and below out of scans.
+const IgnoreFileName = ".dreamfsignore"
+
+// ignoreRule is one gitignore-style pattern.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool // "!pattern": re-includes what earlier rules ignored
+	dirOnly bool // "pattern/": matches directories only
+}
+
+// parseIgnoreRule compiles a gitignore pattern line. Blank lines and
+// comments yield false.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	if strings.HasPrefix(line, "!") {
+		r.negate, line = true, line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	// A slash anywhere but the end anchors the pattern to its directory;
+	// otherwise it matches a name at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr := globRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// globRegexp translates a glob with gitignore's "**" to a regular
+// expression over slash-separated paths.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		atSegment := i == 0 || glob[i-1] == '/'
+		switch {
+		case c == '*' && atSegment && strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && atSegment && glob[i:] == "**":
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1])) // Bytes of a multibyte rune pass through as they are
+		}
+	}
+	return b.String()
+}
+
+// matchRules applies rules to a slash-separated relative path; the last
+// matching rule decides. It reports whether any matched, and if so whether
+// the path is ignored.
+func matchRules(rules []ignoreRule, rel string, isDir bool) (matched, ignored bool) {
+	for _, r := range rules {
+		if r.dirOnly && !isDir || !r.re.MatchString(rel) {
+			continue
+		}
+		matched, ignored = true, !r.negate
+	}
+	return matched, ignored
+}
+
+// Filter decides which paths under a scanned root are left out: those
+// matching an --exclude pattern, those ignored by a .dreamfsignore file in
+// the root or a directory below it, and, when there are --include
+// patterns, files matching none of them. A nil Filter leaves nothing out.
+type Filter struct {
+	root    string
+	exclude []ignoreRule
+	include []ignoreRule
+
+	mu   sync.Mutex
+	dirs map[string][]ignoreRule // Directory -> rules of its .dreamfsignore
+}
+
+// NewFilter returns a Filter for the tree at root. Patterns are
+// gitignore-style and relative to root.
+func NewFilter(root string, exclude, include []string) *Filter {
+	f := &Filter{root: filepath.Clean(root), dirs: map[string][]ignoreRule{}}
+	for _, p := range exclude {
+		if r, ok := parseIgnoreRule(p); ok {
+			f.exclude = append(f.exclude, r)
+		}
+	}
+	for _, p := range include {
+		if r, ok := parseIgnoreRule(p); ok {
+			f.include = append(f.include, r)
+		}
+	}
+	return f
+}
+
+// scanFilter returns the Filter for root from --exclude ("exclude") and
+// --include ("include").
+func scanFilter(root string) *Filter {
+	return NewFilter(root, viper.GetStringSlice("exclude"), viper.GetStringSlice("include"))
+}
+
+// Skip reports whether a walked path is left out, assuming the directories
+// above it were not. The root itself never is.
+func (f *Filter) Skip(path string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	if _, ignored := matchRules(f.exclude, filepath.ToSlash(rel), isDir); ignored {
+		return true
+	}
+	// Deeper .dreamfsignore files override shallower ones
+	ignored := false
+	dir := filepath.Dir(path)
+	for d := dir; ; d = filepath.Dir(d) {
+		drel, _ := filepath.Rel(d, path)
+		if m, ig := matchRules(f.rules(d), filepath.ToSlash(drel), isDir); m {
+			ignored = ig
+			break
+		}
+		if d == f.root || d == filepath.Dir(d) {
+			break
+		}
+	}
+	if ignored {
+		return true
+	}
+	if !isDir && len(f.include) > 0 {
+		_, included := matchRules(f.include, filepath.ToSlash(rel), false)
+		return !included
+	}
+	return false
+}
+
+// SkipTree reports whether path is left out, either itself or because a
+// directory between it and the root is.
+func (f *Filter) SkipTree(path string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	path = filepath.Clean(path)
+	var dirs []string
+	for d := filepath.Dir(path); d != f.root && underPath(d, f.root); d = filepath.Dir(d) {
+		dirs = append(dirs, d)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if f.Skip(dirs[i], true) {
+			return true
+		}
+	}
+	return f.Skip(path, isDir)
+}
+
+// Forget drops the cached rules of dir, whose .dreamfsignore changed.
+func (f *Filter) Forget(dir string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.dirs, filepath.Clean(dir))
+}
+
+// rules returns the rules of dir's .dreamfsignore, reading it once.
+func (f *Filter) rules(dir string) []ignoreRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rules, ok := f.dirs[dir]; ok {
+		return rules
+	}
+	var rules []ignoreRule
+	if file, err := os.Open(filepath.Join(dir, IgnoreFileName)); err == nil {
+		sc := bufio.NewScanner(file)
+		for sc.Scan() {
+			if r, ok := parseIgnoreRule(sc.Text()); ok {
+				rules = append(rules, r)
+			}
+		}
+		file.Close()
+	}
+	f.dirs[dir] = rules
+	return rules
+}
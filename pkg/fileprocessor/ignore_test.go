@@ -0,0 +1,131 @@
+package fileprocessor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchRules(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		isDir    bool
+		matched  bool
+		ignored  bool
+	}{
+		{[]string{"*.tmp"}, "a.tmp", false, true, true},
+		{[]string{"*.tmp"}, "x/y/a.tmp", false, true, true},
+		{[]string{"/a.tmp"}, "x/a.tmp", false, false, false},
+		{[]string{"x/*.tmp"}, "x/a.tmp", false, true, true},
+		{[]string{"x/*.tmp"}, "x/y/a.tmp", false, false, false},
+		{[]string{"**/cache"}, "a/b/cache", true, true, true},
+		{[]string{"logs/**"}, "logs/a/b.txt", false, true, true},
+		{[]string{"cache/"}, "cache", false, false, false},
+		{[]string{"cache/"}, "cache", true, true, true},
+		{[]string{"*.tmp", "!keep.tmp"}, "keep.tmp", false, true, false},
+		{[]string{"!keep.tmp", "*.tmp"}, "keep.tmp", false, true, true},
+		{[]string{"[ab].txt"}, "b.txt", false, true, true},
+		{[]string{"[!ab].txt"}, "b.txt", false, false, false},
+		{[]string{`\!x`}, "!x", false, true, true},
+		{[]string{"# comment", ""}, "# comment", false, false, false},
+		{[]string{"vidéos/"}, "vidéos", true, true, true},
+		{[]string{"*.日本"}, "a/b.日本", false, true, true},
+	}
+	for _, tt := range tests {
+		var rules []ignoreRule
+		for _, p := range tt.patterns {
+			if r, ok := parseIgnoreRule(p); ok {
+				rules = append(rules, r)
+			}
+		}
+		matched, ignored := matchRules(rules, tt.rel, tt.isDir)
+		if matched != tt.matched || ignored != tt.ignored {
+			t.Errorf("matchRules(%q, %q, dir=%v) = %v, %v, want %v, %v",
+				tt.patterns, tt.rel, tt.isDir, matched, ignored, tt.matched, tt.ignored)
+		}
+	}
+}
+
+func TestFilterSkip(t *testing.T) {
+	root := t.TempDir()
+	ignores := map[string]string{
+		IgnoreFileName:                    "*.bak\nbuild/\n",
+		"src/" + IgnoreFileName:           "!important.bak\ngen/\n",
+		"src/vendor/" + IgnoreFileName:    "*\n",
+		"docs/drafts/" + IgnoreFileName:   "# nothing but a comment\n",
+		"media/raw/" + IgnoreFileName:     "/*.cr2\n",
+		"media/raw/sub/" + IgnoreFileName: "",
+	}
+	for name, content := range ignores {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		exclude []string
+		include []string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"plain file", nil, nil, "a.txt", false, false},
+		{"root ignore", nil, nil, "a.bak", false, true},
+		{"root ignore below", nil, nil, "docs/a.bak", false, true},
+		{"deeper negation", nil, nil, "src/important.bak", false, false},
+		{"deeper negation elsewhere", nil, nil, "docs/important.bak", false, true},
+		{"dir-only rule on a dir", nil, nil, "build", true, true},
+		{"dir-only rule on a file", nil, nil, "build", false, false},
+		{"nested dir rule", nil, nil, "src/gen", true, true},
+		{"ignore everything", nil, nil, "src/vendor/lib.go", false, true},
+		{"anchored to its directory", nil, nil, "media/raw/a.cr2", false, true},
+		{"anchored not below", nil, nil, "media/raw/sub/a.cr2", false, false},
+		{"exclude flag", []string{"*.iso"}, nil, "images/a.iso", false, true},
+		{"exclude dir flag", []string{"node_modules/"}, nil, "web/node_modules", true, true},
+		{"include keeps matches", nil, []string{"*.jpg"}, "a.jpg", false, false},
+		{"include drops others", nil, []string{"*.jpg"}, "a.png", false, true},
+		{"include leaves dirs", nil, []string{"*.jpg"}, "photos", true, false},
+		{"root itself", []string{"*"}, nil, ".", true, false},
+		{"outside the root", []string{"*"}, nil, "../elsewhere", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFilter(root, tt.exclude, tt.include)
+			path := filepath.Join(root, filepath.FromSlash(tt.path))
+			if got := f.Skip(path, tt.isDir); got != tt.want {
+				t.Errorf("Skip(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterSkipTree(t *testing.T) {
+	root := t.TempDir()
+	f := NewFilter(root, []string{"build/"}, nil)
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"build/out/a.o", false, true},
+		{"src/build/a.o", false, true},
+		{"src/a.go", false, false},
+		{"build", true, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(root, filepath.FromSlash(tt.path))
+		if got := f.SkipTree(path, tt.isDir); got != tt.want {
+			t.Errorf("SkipTree(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+	var nilFilter *Filter
+	if nilFilter.Skip(filepath.Join(root, "a"), false) || nilFilter.SkipTree(filepath.Join(root, "a"), false) {
+		t.Error("a nil Filter leaves a path out")
+	}
+}
@@ -0,0 +1,53 @@
+package fileprocessor
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Change Detection for Incremental Re-indexing
+// ------------------------
+
+// unchanged reports whether the file at path still matches its newest stored
+// record (same size, modification time and, where both are known, inode and
+// device) and that record was fingerprinted with the configured strategy, so
+// it need not be fingerprinted again. It always reports false
+// when "force" is set. The returned info is nil if the file cannot be stat'ed;
+// the record is returned when the file is unchanged.
+func unchanged(ps *storage.PersistentStore, path string) (os.FileInfo, metadata.FileMetadata, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || viper.GetBool("force") {
+		return info, metadata.FileMetadata{}, false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return info, metadata.FileMetadata{}, false
+	}
+	meta, found, err := ps.LatestFor(utils.HostID, canonical(absPath))
+	if err != nil || !found || meta.Deleted() || meta.BLAKE3 == "" {
+		return info, metadata.FileMetadata{}, false
+	}
+	if meta.Size != info.Size() || meta.ModTime != info.ModTime().Format(time.RFC3339) {
+		return info, metadata.FileMetadata{}, false
+	}
+	if mode, sampleSize := meta.HashMode(); mode != HashMode() || (mode == metadata.HashSampled && sampleSize != SampleSize()) {
+		return info, metadata.FileMetadata{}, false
+	}
+	d := statDetails(path, info)
+	// JSON decodes stored numbers as float64, so compare in that domain
+	if inode, ok := meta.Extra["inode"].(float64); ok && d.Inode != 0 {
+		device, _ := meta.Extra["device"].(float64)
+		if inode != float64(d.Inode) || device != float64(d.Device) {
+			return info, metadata.FileMetadata{}, false
+		}
+	}
+	return info, meta, true
+}
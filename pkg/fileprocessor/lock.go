@@ -0,0 +1,45 @@
+package fileprocessor
+
+import (
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// File Lock / Open-Handle Detection
+// ------------------------
+
+// lockState describes whether other processes held a file at scan time.
+// Implementations live in lock_<platform>.go.
+type lockState struct {
+	Checked  bool     // False when the platform cannot tell
+	Locked   bool     // Another process holds a lock on the file
+	Locks    []string // Lock kinds, e.g. "posix-write" (Linux only)
+	InUse    bool     // Another process has the file open
+	OpenPIDs []int    // Processes holding the file open (Linux only)
+}
+
+// lockExtra records lock and open-handle state when --lock-info is enabled,
+// so later verification mismatches can be attributed to files that were being
+// written while they were scanned.
+func lockExtra(path string, info os.FileInfo) map[string]interface{} {
+	if !viper.GetBool("lockInfo") {
+		return nil
+	}
+	s := lockStatus(path, info)
+	if !s.Checked {
+		return nil
+	}
+	extra := map[string]interface{}{
+		"locked": s.Locked,
+		"inUse":  s.InUse,
+	}
+	if len(s.Locks) > 0 {
+		extra["lockTypes"] = s.Locks
+	}
+	if len(s.OpenPIDs) > 0 {
+		extra["openPids"] = s.OpenPIDs
+	}
+	return extra
+}
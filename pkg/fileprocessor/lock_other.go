@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package fileprocessor
+
+import "os"
+
+func lockStatus(path string, info os.FileInfo) lockState {
+	return lockState{}
+}
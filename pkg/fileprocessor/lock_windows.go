@@ -0,0 +1,48 @@
+//go:build windows
+
+package fileprocessor
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func lockStatus(path string, info os.FileInfo) lockState {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return lockState{}
+	}
+
+	// An open that refuses to share fails if any other handle is open.
+	h, err := windows.CreateFile(p, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == nil {
+		windows.CloseHandle(h)
+		return lockState{Checked: true}
+	}
+	if !errors.Is(err, windows.ERROR_SHARING_VIOLATION) {
+		return lockState{}
+	}
+	s := lockState{Checked: true, InUse: true}
+
+	// Reopen with full sharing and probe for a byte-range lock.
+	share := uint32(windows.FILE_SHARE_READ | windows.FILE_SHARE_WRITE | windows.FILE_SHARE_DELETE)
+	h, err = windows.CreateFile(p, windows.GENERIC_READ, share, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		// Opened elsewhere without sharing: effectively an exclusive lock.
+		s.Locked = true
+		s.Locks = []string{"exclusive-open"}
+		return s
+	}
+	defer windows.CloseHandle(h)
+	ol := new(windows.Overlapped)
+	err = windows.LockFileEx(h, windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	if err == nil {
+		windows.UnlockFileEx(h, 0, 1, 0, ol)
+	} else if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		s.Locked = true
+		s.Locks = []string{"byte-range"}
+	}
+	return s
+}
@@ -0,0 +1,184 @@
+//go:build darwin
+
+package fileprocessor
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/sys/unix"
+)
+
+// ------------------------
+// macOS Metadata (Finder tags, quarantine, resource forks)
+// ------------------------
+
+const (
+	xattrUserTags     = "com.apple.metadata:_kMDItemUserTags"
+	xattrQuarantine   = "com.apple.quarantine"
+	xattrResourceFork = "com.apple.ResourceFork"
+)
+
+// macOSExtra records Finder tags, Gatekeeper quarantine attributes, and
+// resource-fork presence, which often are the only thing distinguishing
+// otherwise identical files in a creative workflow.
+func macOSExtra(path string) map[string]interface{} {
+	extra := map[string]interface{}{}
+
+	if data, err := getxattr(path, xattrUserTags); err == nil {
+		if tags, err := parseFinderTags(data); err == nil && len(tags) > 0 {
+			list := make([]interface{}, len(tags))
+			for i, t := range tags {
+				list[i] = t
+			}
+			extra["finderTags"] = list
+		}
+	}
+
+	if data, err := getxattr(path, xattrQuarantine); err == nil {
+		// Format: flags;hex-unix-time;agent;event-uuid
+		extra["quarantined"] = true
+		parts := strings.Split(string(data), ";")
+		if len(parts) > 1 {
+			if secs, err := strconv.ParseInt(parts[1], 16, 64); err == nil {
+				extra["quarantineTime"] = time.Unix(secs, 0).Format(time.RFC3339)
+			}
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			extra["quarantineAgent"] = parts[2]
+		}
+	}
+
+	if size, err := unix.Getxattr(path, xattrResourceFork, nil); err == nil && size > 0 {
+		extra["hasResourceFork"] = true
+		extra["resourceForkSize"] = size
+	}
+
+	return extra
+}
+
+func getxattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	n, err := unix.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// parseFinderTags decodes the binary property list stored in the user tags
+// attribute: an array of strings of the form "Name\n<color index>". Only the
+// subset of bplist00 needed for that shape is supported.
+func parseFinderTags(data []byte) ([]string, error) {
+	if len(data) < 40 || string(data[:8]) != "bplist00" {
+		return nil, errors.New("not a binary plist")
+	}
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:16])
+	topObject := binary.BigEndian.Uint64(trailer[16:24])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:32])
+	if offsetSize == 0 || refSize == 0 || topObject >= numObjects ||
+		tableOffset+numObjects*uint64(offsetSize) > uint64(len(data)) {
+		return nil, errors.New("malformed plist trailer")
+	}
+
+	objectOffset := func(ref uint64) (int, error) {
+		if ref >= numObjects {
+			return 0, errors.New("object reference out of range")
+		}
+		start := tableOffset + ref*uint64(offsetSize)
+		off := int(readUint(data[start : start+uint64(offsetSize)]))
+		if off >= len(data) {
+			return 0, errors.New("object offset out of range")
+		}
+		return off, nil
+	}
+
+	// length decodes an object's count, which either fits in the marker's low
+	// nibble or follows as an int object.
+	length := func(off int) (int, int, error) {
+		n := int(data[off] & 0x0F)
+		if n != 0x0F {
+			return n, off + 1, nil
+		}
+		if off+1 >= len(data) || data[off+1]&0xF0 != 0x10 {
+			return 0, 0, errors.New("malformed length")
+		}
+		width := 1 << (data[off+1] & 0x0F)
+		if off+2+width > len(data) {
+			return 0, 0, errors.New("truncated length")
+		}
+		return int(readUint(data[off+2 : off+2+width])), off + 2 + width, nil
+	}
+
+	off, err := objectOffset(topObject)
+	if err != nil {
+		return nil, err
+	}
+	if data[off]&0xF0 != 0xA0 {
+		return nil, errors.New("top object is not an array")
+	}
+	count, pos, err := length(off)
+	if err != nil {
+		return nil, err
+	}
+	if pos+count*refSize > len(data) {
+		return nil, errors.New("truncated array")
+	}
+
+	var tags []string
+	for i := 0; i < count; i++ {
+		ref := readUint(data[pos+i*refSize : pos+(i+1)*refSize])
+		soff, err := objectOffset(ref)
+		if err != nil {
+			return nil, err
+		}
+		n, start, err := length(soff)
+		if err != nil {
+			return nil, err
+		}
+		var s string
+		switch data[soff] & 0xF0 {
+		case 0x50: // ASCII string
+			if start+n > len(data) {
+				return nil, errors.New("truncated string")
+			}
+			s = string(data[start : start+n])
+		case 0x60: // UTF-16BE string
+			if start+2*n > len(data) {
+				return nil, errors.New("truncated string")
+			}
+			units := make([]uint16, n)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(data[start+2*j:])
+			}
+			s = string(utf16.Decode(units))
+		default:
+			continue
+		}
+		// Drop the "\n<color index>" suffix Finder appends to each tag.
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[:i]
+		}
+		tags = append(tags, s)
+	}
+	return tags, nil
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package fileprocessor
+
+// macOSExtra records nothing on platforms other than macOS.
+func macOSExtra(path string) map[string]interface{} {
+	return nil
+}
@@ -0,0 +1,117 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/karrick/godirwalk"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/manifest"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Scan Manifests
+// ------------------------
+
+// SigningKeyPath returns the file holding this host's manifest signing key
+// ("signingKey", by default in the XDG data directory).
+func SigningKeyPath() string {
+	if path := viper.GetString("signingKey"); path != "" {
+		return path
+	}
+	return manifest.DefaultKeyPath(utils.XDGDataHome())
+}
+
+// scanLeaves collects the files of a scan for its manifest.
+type scanLeaves struct {
+	root   string
+	leaves []manifest.Leaf
+	bytes  int64
+	errors int
+}
+
+// add records a fingerprinted file under its path relative to the root.
+func (s *scanLeaves) add(path, fingerprint string, size int64) {
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.leaves = append(s.leaves, manifest.Leaf{Path: filepath.ToSlash(rel), Fingerprint: fingerprint})
+	s.bytes += size
+}
+
+// writeManifest signs a manifest of a completed scan of absRoot and stores
+// it.
+func writeManifest(ps *storage.PersistentStore, absRoot string, s *scanLeaves, started time.Time, changed int) (manifest.Manifest, error) {
+	key, err := manifest.LoadOrCreateKey(SigningKeyPath())
+	if err != nil {
+		return manifest.Manifest{}, err
+	}
+	finished := time.Now().UTC()
+	m := manifest.Manifest{
+		HostID:     utils.HostID,
+		Root:       absRoot,
+		Started:    started.UTC(),
+		Finished:   finished,
+		Duration:   float64(finished.Sub(started).Milliseconds()) / 1000,
+		Files:      len(s.leaves),
+		Bytes:      s.bytes,
+		Changed:    changed,
+		Errors:     s.errors,
+		HashMode:   HashMode(),
+		SkipGit:    viper.GetBool("skipGit"),
+		Exclude:    viper.GetStringSlice("exclude"),
+		Include:    viper.GetStringSlice("include"),
+		MerkleRoot: manifest.MerkleRoot(s.leaves),
+	}
+	if m.HashMode == metadata.HashSampled {
+		m.SampleSize = SampleSize()
+	}
+	m.Sign(key)
+	return m, ps.AddManifest(m)
+}
+
+// FingerprintTree fingerprints every file under root the way the scan
+// described by m did, for comparison with its Merkle root. It returns the
+// leaves, their total size, and the files that could not be read.
+func FingerprintTree(root string, m manifest.Manifest) ([]manifest.Leaf, int64, []string, error) {
+	s := &scanLeaves{root: root}
+	filter := NewFilter(root, m.Exclude, m.Include)
+	var failed []string
+	err := godirwalk.Walk(root, &godirwalk.Options{
+		Unsorted: true,
+		Callback: func(path string, de *godirwalk.Dirent) error {
+			if de.IsDir() {
+				if m.SkipGit && de.Name() == ".git" || filter.Skip(path, true) {
+					return godirwalk.SkipThis
+				}
+				return nil
+			}
+			if filter.Skip(path, false) {
+				return nil
+			}
+			info, err := os.Stat(path)
+			if err == nil && info.IsDir() {
+				return nil // A link to a directory, which scans do not follow
+			}
+			var fp string
+			if err == nil {
+				fp, err = fingerprintPath(path, m.HashMode, m.SampleSize)
+			}
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+				return nil
+			}
+			s.add(path, fp, info.Size())
+			return nil
+		},
+	})
+	return s.leaves, s.bytes, failed, err
+}
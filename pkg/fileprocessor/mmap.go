@@ -0,0 +1,39 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+	"github.com/zeebo/blake3"
+)
+
+// ------------------------
+// Memory-Mapped Sampled Hashing
+// ------------------------
+
+// useMmap reports whether a file of the given size should be hashed through
+// a memory mapping. The threshold comes from --mmap-threshold; 0 disables.
+func useMmap(size, sampleSize int64) bool {
+	threshold := viper.GetInt64("mmapThreshold")
+	return mmapSupported && threshold > 0 && size >= threshold && size >= 3*sampleSize
+}
+
+// fingerprintMmap computes the same sampled fingerprint as sampledHashFile
+// (head, middle, and tail samples) by hashing slices of a read-only mapping,
+// avoiding the copies into intermediate read buffers.
+func fingerprintMmap(f *os.File, size, sampleSize int64) (string, error) {
+	data, unmap, err := mmapFile(f, size)
+	if err != nil {
+		return "", fmt.Errorf("mmap file: %w", err)
+	}
+	defer unmap()
+
+	h := blake3.New()
+	mid := size / 2
+	tail := size - sampleSize
+	h.Write(data[:sampleSize])
+	h.Write(data[mid : mid+sampleSize])
+	h.Write(data[tail:])
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
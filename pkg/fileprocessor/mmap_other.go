@@ -0,0 +1,14 @@
+//go:build !unix
+
+package fileprocessor
+
+import (
+	"errors"
+	"os"
+)
+
+const mmapSupported = false
+
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("mmap is not supported on this platform")
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package fileprocessor
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const mmapSupported = true
+
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	data, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Only three small windows are touched, so read-ahead would be wasted.
+	_ = unix.Madvise(data, unix.MADV_RANDOM)
+	return data, func() error { return unix.Munmap(data) }, nil
+}
@@ -0,0 +1,335 @@
+package fileprocessor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/karrick/godirwalk"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/config"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Directory Scan Pipeline
+// ------------------------
+
+// A scan runs as a pipeline: one goroutine walks the tree and queues files,
+// scanWorkers goroutines fingerprint them, and the caller's goroutine
+// batches the records into the store through a CacheWriter. The queue is
+// bounded, so the walk never gets far ahead of the hashing.
+
+// scanQueuePerWorker is how many files the walk may queue per worker.
+const scanQueuePerWorker = 64
+
+// scanJob is a file queued by the walk.
+type scanJob struct {
+	dir  string // Directory relative to the root
+	path string
+}
+
+// scanResult is a fingerprinted (or unchanged) file on its way to the store.
+type scanResult struct {
+	scanJob
+	meta      metadata.FileMetadata
+	size      int64
+	unchanged bool // meta is the stored record; nothing to write
+	isDir     bool // path led to a directory (e.g. through a symlink)
+	err       error
+}
+
+// scanWalk is what the walk found besides files to index.
+type scanWalk struct {
+	emptyDirs     []string
+	unreadDirs    []string // Directories that could not be listed
+	excludedFiles int
+	excludedDirs  int
+	found         atomic.Int64 // Files queued so far
+	err           error        // Reading the root failed
+}
+
+// dirTracker follows how many of each directory's files are still in the
+// pipeline, to know which directories a checkpoint can record as done.
+// A directory with a file that failed is not done: --resume retries it.
+type dirTracker struct {
+	mu        sync.Mutex
+	pending   map[string]int
+	failed    map[string]bool
+	completed []string
+}
+
+// open registers dir's n queued files.
+func (t *dirTracker) open(dir string, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n == 0 {
+		t.completed = append(t.completed, dir)
+		return
+	}
+	t.pending[dir] = n
+}
+
+// done records that one of dir's files is stored, or failed if ok is false.
+func (t *dirTracker) done(dir string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !ok {
+		t.failed[dir] = true
+	}
+	if t.pending[dir]--; t.pending[dir] == 0 {
+		delete(t.pending, dir)
+		if t.failed[dir] {
+			delete(t.failed, dir)
+			return
+		}
+		t.completed = append(t.completed, dir)
+	}
+}
+
+// take returns the directories completed since the last call, and how many
+// are still in progress.
+func (t *dirTracker) take() ([]string, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	completed := t.completed
+	t.completed = nil
+	return completed, len(t.pending)
+}
+
+// walkTree lists root depth first, queueing the files of each directory
+// not in skip (which are still descended into) on jobs, and closes jobs
+// when done or when ctx is cancelled. The subdirectories of root named in
+// prune are left out altogether, as are root's own files if it holds ".".
+func walkTree(ctx context.Context, root string, filter *Filter, skip, prune map[string]bool, tracker *dirTracker, jobs chan<- scanJob, w *scanWalk) {
+	defer close(jobs)
+	quiet := viper.GetBool("quiet")
+	stack := []string{root}
+	for len(stack) > 0 {
+		dir := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if ctx.Err() != nil {
+			return
+		}
+		dirents, err := godirwalk.ReadDirents(dir, nil)
+		if err != nil {
+			if dir == root {
+				w.err = err
+				return
+			}
+			if !quiet {
+				fmt.Printf("Error reading directory %s: %v\n", dir, err)
+			}
+			w.unreadDirs = append(w.unreadDirs, dir)
+			continue
+		}
+		if len(dirents) == 0 && dir != root {
+			w.emptyDirs = append(w.emptyDirs, dir)
+		}
+		rel, _ := filepath.Rel(root, dir)
+		var files []string
+		for _, de := range dirents {
+			path := filepath.Join(dir, de.Name())
+			switch {
+			case isGitDir(de):
+			case de.IsDir() && filter.Skip(path, true):
+				w.excludedDirs++
+			case de.IsDir() && dir == root && prune[de.Name()]:
+			case de.IsDir():
+				stack = append(stack, path)
+			case skip[rel] || prune[rel]:
+			case filter.Skip(path, false):
+				w.excludedFiles++
+			default:
+				files = append(files, path)
+			}
+		}
+		if skip[rel] || prune[rel] {
+			continue
+		}
+		tracker.open(rel, len(files))
+		for _, path := range files {
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- scanJob{dir: rel, path: path}:
+				w.found.Add(1)
+			}
+		}
+	}
+}
+
+// hashFiles fingerprints the files on jobs that changed since the last scan
+// until jobs is closed, dropping the rest once ctx is cancelled.
+func hashFiles(ctx context.Context, ps *storage.PersistentStore, jobs <-chan scanJob, results chan<- scanResult) {
+	for job := range jobs {
+		if ctx.Err() != nil {
+			continue
+		}
+		r := scanResult{scanJob: job}
+		if info, meta, ok := unchanged(ps, job.path); ok {
+			r.meta, r.size, r.unchanged = meta, info.Size(), true
+			results <- r
+			continue
+		}
+		meta, info, err := readMetadata(ctx, job.path)
+		switch {
+		case err != nil:
+			r.err = err
+		case info.IsDir():
+			r.isDir = true
+		default:
+			r.meta, r.size = meta, info.Size()
+			// Chunking rereads the file, so it stays off the writer
+			r.err = storeChunks(ps, job.path, meta)
+		}
+		if ctx.Err() != nil && r.err != nil {
+			continue // Neither stored nor failed; a resumed run retries it
+		}
+		results <- r
+	}
+}
+
+// scanStats is the throughput line shown once a second during a scan.
+type scanStats struct {
+	files, bytes         int64
+	lastFiles, lastBytes int64
+	last                 time.Time
+	shown                bool
+}
+
+func (s *scanStats) add(size int64) {
+	s.files++
+	s.bytes += size
+}
+
+// print shows the files and bytes indexed since the last call, per second.
+func (s *scanStats) print(found int64, queued int) {
+	now := time.Now()
+	secs := now.Sub(s.last).Seconds()
+	if secs <= 0 {
+		return
+	}
+	files := float64(s.files-s.lastFiles) / secs
+	bytes := int64(float64(s.bytes-s.lastBytes) / secs)
+	fmt.Printf("\rIndexed %d/%d files: %.0f files/s, %s/s, %d queued   ", s.files, found, files, utils.FormatBytes(bytes), queued)
+	s.lastFiles, s.lastBytes, s.last = s.files, s.bytes, now
+	s.shown = true
+}
+
+// endLine ends the throughput line, if shown, before other output.
+func (s *scanStats) endLine() {
+	if s.shown {
+		fmt.Println()
+		s.shown = false
+	}
+}
+
+// runScan indexes the files under root through the pipeline, but for the
+// subtrees in prune (see walkTree), adding to the tallies in cp and the
+// scan's leaves, and saving cp every second. It returns what the walk
+// found, and ctx.Err() if it was cancelled.
+func runScan(ctx context.Context, root, absRoot string, ps *storage.PersistentStore, cp *storage.ScanCheckpoint, leaves *scanLeaves, prune map[string]bool) (*scanWalk, error) {
+	quiet := viper.GetBool("quiet")
+	workers := scanWorkers()
+	jobs := make(chan scanJob, workers*scanQueuePerWorker)
+	results := make(chan scanResult, workers)
+	tracker := &dirTracker{pending: map[string]int{}, failed: map[string]bool{}}
+	walk := &scanWalk{}
+
+	go walkTree(ctx, root, scanFilter(root), cp.Done, prune, tracker, jobs, walk)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hashFiles(ctx, ps, jobs, results)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	cw := storage.NewCacheWriter(ps, config.DefaultBatchSize, config.DefaultSyncInterval)
+	defer cw.Close()
+	// checkpoint records the directories whose records are all stored, so
+	// that --resume can skip them.
+	checkpoint := func() {
+		cw.Sync()
+		dirs, pending := tracker.take()
+		if len(dirs) > 0 {
+			cp.LastDir = dirs[len(dirs)-1]
+		}
+		cp.Pending = pending
+		cp.Errors = leaves.errors
+		if err := ps.SaveScanCheckpoint(utils.HostID, absRoot, *cp, dirs...); err != nil && !quiet {
+			fmt.Printf("Error saving scan checkpoint: %v\n", err)
+		}
+	}
+
+	stats := &scanStats{last: time.Now()}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				stats.endLine()
+				checkpoint()
+				if walk.err != nil {
+					return walk, walk.err
+				}
+				return walk, ctx.Err()
+			}
+			storeResult(r, cw, cp, leaves, stats)
+			tracker.done(r.dir, r.err == nil)
+		case <-ticker.C:
+			if !quiet {
+				stats.print(walk.found.Load(), len(jobs))
+			}
+			checkpoint()
+		}
+	}
+}
+
+// storeResult queues a changed file's record for the store and counts the
+// file. Zero-byte files are counted too, since those frequently indicate
+// interrupted copies.
+func storeResult(r scanResult, cw *storage.CacheWriter, cp *storage.ScanCheckpoint, leaves *scanLeaves, stats *scanStats) {
+	cp.Scanned++
+	if r.err != nil {
+		leaves.errors++
+		if !viper.GetBool("quiet") {
+			stats.endLine()
+			fmt.Printf("Error processing %s: %v\n", r.path, r.err)
+		}
+		return
+	}
+	if r.isDir {
+		return
+	}
+	if r.unchanged {
+		cp.Skipped++
+	} else {
+		broadcast(cw.Write(r.meta))
+		cp.Changed++
+	}
+	leaves.add(r.path, r.meta.BLAKE3, r.size)
+	if r.size == 0 {
+		cp.ZeroByte++
+	}
+	stats.add(r.size)
+}
+
+// scanWorkers returns the number of files indexed at once ("workers",
+// which --all-procs sets to the number of CPUs).
+func scanWorkers() int {
+	return max(viper.GetInt("workers"), 1)
+}
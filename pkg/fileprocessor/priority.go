@@ -0,0 +1,183 @@
+package fileprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/karrick/godirwalk"
+)
+
+// ------------------------
+// Priority Verification Queue
+// ------------------------
+
+// PriorityQueue holds paths to verify ahead of everything else a watcher
+// has to do, e.g. a directory just restored from backup. The most recently
+// boosted path comes first.
+type PriorityQueue struct {
+	mu     sync.Mutex
+	paths  []string
+	notify chan struct{}
+}
+
+// NewPriorityQueue returns an empty queue.
+func NewPriorityQueue() *PriorityQueue {
+	return &PriorityQueue{notify: make(chan struct{}, 1)}
+}
+
+// Boost puts absolute paths (files or directory trees) at the front of the
+// queue, moving any already queued.
+func (q *PriorityQueue) Boost(paths ...string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, path := range paths {
+		for i, queued := range q.paths {
+			if queued == path {
+				q.paths = append(q.paths[:i], q.paths[i+1:]...)
+				break
+			}
+		}
+		q.paths = append([]string{path}, q.paths...)
+	}
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Pending returns the queued paths in the order they will be verified.
+func (q *PriorityQueue) Pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string{}, q.paths...)
+}
+
+// next takes the path at the front of the queue.
+func (q *PriorityQueue) next() (string, bool) {
+	if q == nil {
+		return "", false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.paths) == 0 {
+		return "", false
+	}
+	path := q.paths[0]
+	q.paths = q.paths[1:]
+	return path, true
+}
+
+// ready is signalled when paths are boosted; a nil queue never is.
+func (q *PriorityQueue) ready() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+	return q.notify
+}
+
+// drainPriority verifies every boosted path. It is called between files of
+// a scan and from the event loop, so boosted paths jump the queue.
+func (w *watcher) drainPriority(ctx context.Context) {
+	for ctx.Err() == nil {
+		path, ok := w.priority.next()
+		if !ok {
+			return
+		}
+		w.verify(ctx, path)
+	}
+}
+
+// verify re-fingerprints a boosted file, or every file beneath a boosted
+// directory, whether or not it looks unchanged, and records a new revision
+// for each whose fingerprint, size or modification time differs from the
+// index. Paths that no longer exist are tombstoned.
+func (w *watcher) verify(ctx context.Context, path string) {
+	if !underPath(path, w.root) {
+		if !w.quiet {
+			fmt.Printf("Not verifying %s: outside the watched tree %s\n", path, w.root)
+		}
+		return
+	}
+	info, err := os.Stat(path)
+	if err == nil && w.filter.SkipTree(path, info.IsDir()) {
+		if !w.quiet {
+			fmt.Printf("Not verifying %s: excluded\n", path)
+		}
+		return
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		w.remove(canonical(path))
+		return
+	case err != nil:
+		if !w.quiet {
+			fmt.Printf("Error verifying %s: %v\n", path, err)
+		}
+		return
+	case !info.IsDir():
+		if !w.verifyFile(ctx, path) && !w.quiet {
+			fmt.Printf("Verified %s: unchanged\n", path)
+		}
+		return
+	}
+	if !w.quiet {
+		fmt.Printf("Verifying %s (priority)\n", path)
+	}
+	var verified, changed int
+	godirwalk.Walk(path, &godirwalk.Options{
+		Unsorted: true,
+		Callback: func(p string, de *godirwalk.Dirent) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if isGitDir(de) || p != path && w.filter.Skip(p, de.IsDir()) {
+				if de.IsDir() {
+					return godirwalk.SkipThis
+				}
+				return nil
+			}
+			if de.IsDir() {
+				return nil
+			}
+			verified++
+			if w.verifyFile(ctx, p) {
+				changed++
+			}
+			return nil
+		},
+		ErrorCallback: func(p string, err error) godirwalk.ErrorAction {
+			if !w.quiet {
+				fmt.Printf("Error reading %s: %v\n", p, err)
+			}
+			return godirwalk.SkipNode
+		},
+	})
+	if !w.quiet {
+		fmt.Printf("Verified %s: %d files, %d changed\n", path, verified, changed)
+	}
+}
+
+// verifyFile re-fingerprints one file and indexes it if its record
+// changed, reporting whether it did.
+func (w *watcher) verifyFile(ctx context.Context, path string) bool {
+	meta, _, err := readMetadata(ctx, path)
+	if err != nil {
+		if !w.quiet && !errors.Is(err, context.Canceled) {
+			fmt.Printf("Error verifying %s: %v\n", path, err)
+		}
+		return false
+	}
+	cur, found, err := w.ps.LatestFor(meta.HostID, meta.FilePath)
+	if err == nil && found && !cur.Deleted() && cur.ID == meta.ID {
+		return false
+	}
+	if found && !cur.Deleted() && cur.BLAKE3 != meta.BLAKE3 && cur.Size == meta.Size && cur.ModTime == meta.ModTime && !w.quiet {
+		fmt.Printf("Content of %s changed without a new size or modification time\n", path)
+	}
+	w.store(path, meta)
+	return true
+}
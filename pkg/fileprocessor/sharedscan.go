@@ -0,0 +1,97 @@
+package fileprocessor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+)
+
+// ------------------------
+// Shared Scanning of Network Mounts
+// ------------------------
+
+// sharedScan is the part of a scan of a network share that other swarm
+// nodes do this cycle (see network.ClaimScans).
+type sharedScan struct {
+	lease *network.ScanLease
+	// prune holds the subtrees of the root other nodes scan, by name, and
+	// "." if they scan the files directly in the root.
+	prune map[string]bool
+}
+
+// claimSharedScan claims the root of a scan and each of its subdirectories
+// for this node when "sharedScan" is set, the swarm is running and absRoot
+// is on a network share. It returns nil when the scan is not shared.
+func claimSharedScan(ctx context.Context, absRoot string) (*sharedScan, error) {
+	if !viper.GetBool("sharedScan") || swarmDelegate == nil {
+		return nil, nil
+	}
+	cycle := viper.GetDuration("sharedScanCycle")
+	if cycle <= 0 {
+		return nil, fmt.Errorf("--shared-scan-cycle must be positive")
+	}
+	canonicalRoot, err := CanonicalizePath(absRoot)
+	if err != nil || canonicalRoot == absRoot {
+		return nil, nil // Not a network share, so no other node sees it
+	}
+	entries, err := os.ReadDir(absRoot)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{"."}
+	units := []network.ScanUnit{{Path: canonicalRoot, FilesOnly: true}}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		names = append(names, e.Name())
+		units = append(units, network.ScanUnit{Path: canonical(filepath.Join(absRoot, e.Name()))})
+	}
+	others, lease, err := swarmDelegate.ClaimScans(ctx, units, cycle)
+	if err != nil {
+		return nil, err
+	}
+	s := &sharedScan{lease: lease, prune: map[string]bool{}}
+	for i := range units {
+		c, ok := others[i]
+		if !ok {
+			continue
+		}
+		s.prune[names[i]] = true
+		if viper.GetBool("quiet") {
+			continue
+		}
+		if names[i] == "." {
+			fmt.Printf("Skipping the files directly in %s: scanned by swarm host %.12s this cycle\n", absRoot, c.HostID)
+		} else {
+			fmt.Printf("Skipping %s: scanned by swarm host %.12s this cycle\n", filepath.Join(absRoot, names[i]), c.HostID)
+		}
+	}
+	return s, nil
+}
+
+// pruned returns the subtrees other nodes scan (nil for an unshared scan).
+func (s *sharedScan) pruned() map[string]bool {
+	if s == nil {
+		return nil
+	}
+	return s.prune
+}
+
+// finish marks this node's part of the scan done, or gives it up if the
+// scan failed.
+func (s *sharedScan) finish(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.lease.Release()
+		return
+	}
+	s.lease.Finish()
+}
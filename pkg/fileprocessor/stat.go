@@ -0,0 +1,38 @@
+package fileprocessor
+
+import (
+	"os"
+	"time"
+)
+
+// ------------------------
+// Platform-Specific File Details
+// ------------------------
+
+// fileDetails holds filesystem details that os.FileInfo does not expose
+// portably. Implementations live in stat_<platform>.go.
+type fileDetails struct {
+	BirthTime      time.Time // Creation time; zero if not recorded by the platform/filesystem
+	AllocatedBytes int64     // Bytes allocated on disk; -1 if unknown
+	Inode          uint64    // File serial number; 0 if unknown
+	Device         uint64    // ID of the device holding the file
+}
+
+// detailsExtra converts file details into Extra metadata fields. A file whose
+// allocation is smaller than its apparent size is flagged as sparse.
+func detailsExtra(path string, info os.FileInfo) map[string]interface{} {
+	d := statDetails(path, info)
+	extra := map[string]interface{}{}
+	if !d.BirthTime.IsZero() {
+		extra["birthTime"] = d.BirthTime.Format(time.RFC3339)
+	}
+	if d.AllocatedBytes >= 0 {
+		extra["allocatedSize"] = d.AllocatedBytes
+		extra["sparse"] = d.AllocatedBytes < info.Size()
+	}
+	if d.Inode != 0 {
+		extra["inode"] = d.Inode
+		extra["device"] = d.Device
+	}
+	return extra
+}
@@ -0,0 +1,21 @@
+//go:build darwin
+
+package fileprocessor
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func statDetails(path string, info os.FileInfo) fileDetails {
+	d := fileDetails{AllocatedBytes: -1}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return d
+	}
+	d.BirthTime = time.Unix(st.Birthtimespec.Sec, st.Birthtimespec.Nsec)
+	d.AllocatedBytes = st.Blocks * 512
+	d.Inode, d.Device = st.Ino, uint64(st.Dev)
+	return d
+}
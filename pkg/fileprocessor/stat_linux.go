@@ -0,0 +1,31 @@
+//go:build linux
+
+package fileprocessor
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func statDetails(path string, info os.FileInfo) fileDetails {
+	d := fileDetails{AllocatedBytes: -1}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		d.Inode, d.Device = uint64(st.Ino), uint64(st.Dev)
+	}
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, path, unix.AT_STATX_DONT_SYNC, unix.STATX_BTIME|unix.STATX_BLOCKS, &stx)
+	if err != nil {
+		return d
+	}
+	if stx.Mask&unix.STATX_BTIME != 0 {
+		d.BirthTime = time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+	}
+	if stx.Mask&unix.STATX_BLOCKS != 0 {
+		// st_blocks is always in 512-byte units, regardless of the block size.
+		d.AllocatedBytes = int64(stx.Blocks) * 512
+	}
+	return d
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package fileprocessor
+
+import "os"
+
+func statDetails(path string, info os.FileInfo) fileDetails {
+	return fileDetails{AllocatedBytes: -1}
+}
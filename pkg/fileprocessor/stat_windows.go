@@ -0,0 +1,19 @@
+//go:build windows
+
+package fileprocessor
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func statDetails(path string, info os.FileInfo) fileDetails {
+	d := fileDetails{AllocatedBytes: -1}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return d
+	}
+	d.BirthTime = time.Unix(0, attrs.CreationTime.Nanoseconds())
+	return d
+}
@@ -0,0 +1,76 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/blake3"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Stream Indexing
+// ------------------------
+
+// StreamPath returns the virtual path content read from a stream is
+// recorded under (see metadata.StreamPrefix).
+func StreamPath(name string) string {
+	return metadata.StreamPrefix + name
+}
+
+// IsStreamPath reports whether path is the virtual path of a stream.
+func IsStreamPath(path string) bool {
+	return strings.HasPrefix(path, metadata.StreamPrefix)
+}
+
+// IndexStream fingerprints everything read from r and stores it as a
+// revision of the stream named name, modified now. The whole content goes
+// through one hasher, as in full hash mode, since a stream cannot be
+// sampled; the fingerprint therefore matches b3sum's and the "full" records
+// of files with the same content. The record is also sent to the swarm, if
+// this process runs in one.
+func IndexStream(r io.Reader, name string, ps *storage.PersistentStore) (metadata.FileMetadata, error) {
+	if name == "" || strings.ContainsAny(name, "\n\x00") {
+		return metadata.FileMetadata{}, fmt.Errorf("invalid stream name %q", name)
+	}
+	buf := getHashBuffer()
+	defer putHashBuffer(buf)
+	h := blake3.New()
+	start := time.Now()
+	size, err := hashCopy(h, r, *buf)
+	if err != nil {
+		return metadata.FileMetadata{}, fmt.Errorf("read stream: %w", err)
+	}
+	network.ObserveHash(size, time.Since(start))
+	fingerprint := fmt.Sprintf("%x", h.Sum(nil))
+	path := StreamPath(name)
+	modTime := time.Now().Format(time.RFC3339)
+
+	idString := utils.HostID + "|" + path + "|" + modTime + "|" + strconv.FormatInt(size, 16) + "|" + fingerprint
+	meta := metadata.FileMetadata{
+		ID:       utils.GenerateUUID(idString),
+		IDString: idString,
+		HostID:   utils.HostID,
+		FilePath: path,
+		Size:     size,
+		ModTime:  modTime,
+		BLAKE3:   fingerprint,
+		Extra:    map[string]interface{}{metadata.HashModeField: metadata.HashFull},
+	}
+	tagByRules(&meta)
+	if meta, err = ps.Stamp(meta); err != nil {
+		return meta, fmt.Errorf("failed to store metadata for %s: %w", path, err)
+	}
+	if err := ps.Put(meta); err != nil {
+		return meta, fmt.Errorf("failed to store metadata for %s: %w", path, err)
+	}
+	broadcast(meta)
+	return meta, nil
+}
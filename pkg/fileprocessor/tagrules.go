@@ -0,0 +1,215 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/query"
+)
+
+// ------------------------
+// Tagging Rules
+// ------------------------
+
+// TagsField is the Extra field holding a record's tags, a list of strings.
+const TagsField = "tags"
+
+// TagRule tags the files that match all of its predicates, e.g. "tag
+// videos of at least 1GB big-video". Rules come from the "tagRules" config
+// value and are applied as files are indexed and, to records already
+// stored, by 'indexer tags apply-rules'.
+type TagRule struct {
+	Glob    string   `json:"glob,omitempty" mapstructure:"glob"`       // Gitignore-style pattern on the path
+	Type    string   `json:"type,omitempty" mapstructure:"type"`       // Kind (video) or MIME type, may end in /*
+	MinSize string   `json:"minSize,omitempty" mapstructure:"minSize"` // e.g. 100MB
+	MaxSize string   `json:"maxSize,omitempty" mapstructure:"maxSize"`
+	Tags    []string `json:"tags" mapstructure:"tags"`
+
+	re       *regexp.Regexp
+	min, max int64 // max < 0: no upper bound
+}
+
+// compile parses the rule's predicates.
+func (r *TagRule) compile() error {
+	if len(r.Tags) == 0 {
+		return fmt.Errorf("no tags")
+	}
+	for _, tag := range r.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("empty tag")
+		}
+	}
+	if r.Glob == "" && r.Type == "" && r.MinSize == "" && r.MaxSize == "" {
+		return fmt.Errorf("no glob, type, minSize or maxSize to match")
+	}
+	if r.Glob != "" {
+		// Unanchored, as in .dreamfsignore, unless the pattern starts at
+		// the root
+		glob := filepath.ToSlash(r.Glob)
+		expr := globRegexp(strings.TrimPrefix(glob, "/"))
+		if strings.HasPrefix(glob, "/") {
+			expr = "/" + expr
+		} else {
+			expr = "(?:.*/)?" + expr
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return fmt.Errorf("glob %q: %w", r.Glob, err)
+		}
+		r.re = re
+	}
+	var err error
+	if r.MinSize != "" {
+		if r.min, err = query.ParseSize(r.MinSize); err != nil {
+			return fmt.Errorf("minSize %q: %w", r.MinSize, err)
+		}
+	}
+	r.max = -1
+	if r.MaxSize != "" {
+		if r.max, err = query.ParseSize(r.MaxSize); err != nil {
+			return fmt.Errorf("maxSize %q: %w", r.MaxSize, err)
+		}
+	}
+	return nil
+}
+
+func (r TagRule) String() string {
+	var preds []string
+	if r.Glob != "" {
+		preds = append(preds, "glob "+r.Glob)
+	}
+	if r.Type != "" {
+		preds = append(preds, "type "+r.Type)
+	}
+	if r.MinSize != "" {
+		preds = append(preds, ">= "+r.MinSize)
+	}
+	if r.MaxSize != "" {
+		preds = append(preds, "<= "+r.MaxSize)
+	}
+	return strings.Join(preds, ", ") + " -> " + strings.Join(r.Tags, ", ")
+}
+
+// Matches reports whether a record satisfies every predicate of the rule.
+// Tombstones match nothing.
+func (r TagRule) Matches(meta *metadata.FileMetadata) bool {
+	if meta.Deleted() {
+		return false
+	}
+	if r.re != nil && !r.re.MatchString(filepath.ToSlash(meta.FilePath)) {
+		return false
+	}
+	if meta.Size < r.min || r.max >= 0 && meta.Size > r.max {
+		return false
+	}
+	return r.Type == "" || matchesType(r.Type, meta)
+}
+
+// matchesType matches a kind (see FileKind) or MIME type pattern against
+// the type sniffed at index time (--detect-types) or, for records without
+// one, the type of the file's extension.
+func matchesType(want string, meta *metadata.FileMetadata) bool {
+	mimeType, _ := meta.Extra[ContentTypeField].(string)
+	kind, _ := meta.Extra[FileKindField].(string)
+	if mimeType == "" {
+		mimeType, _, _ = mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(filepath.Ext(meta.FilePath))))
+		if mimeType == "" {
+			return false
+		}
+		kind = FileKind(mimeType)
+	}
+	want = strings.ToLower(want)
+	if !strings.Contains(want, "/") {
+		return want == kind
+	}
+	ok, _ := path.Match(want, mimeType)
+	return ok
+}
+
+// ApplyTagRules adds the tags of every matching rule that a record lacks,
+// reporting whether it gained any. Extra is copied before it is changed.
+func ApplyTagRules(meta *metadata.FileMetadata, rules []TagRule) bool {
+	tags := meta.FieldStrings(TagsField)
+	have := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		have[tag] = true
+	}
+	added := false
+	for _, r := range rules {
+		if !r.Matches(meta) {
+			continue
+		}
+		for _, tag := range r.Tags {
+			if !have[tag] {
+				have[tag] = true
+				tags = append(tags, tag)
+				added = true
+			}
+		}
+	}
+	if !added {
+		return false
+	}
+	extra := make(map[string]interface{}, len(meta.Extra)+1)
+	for k, v := range meta.Extra {
+		extra[k] = v
+	}
+	list := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		list[i] = tag
+	}
+	extra[TagsField] = list
+	meta.Extra = extra
+	return true
+}
+
+// TagRules returns the rules of the "tagRules" config value, a list of
+// {"glob", "type", "minSize", "maxSize", "tags"} objects.
+func TagRules() ([]TagRule, error) {
+	var rules []TagRule
+	if err := viper.UnmarshalKey("tagRules", &rules); err != nil {
+		return nil, fmt.Errorf("invalid \"tagRules\" config: %w", err)
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("tag rule %d: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// indexTagRules caches the configured rules for indexing.
+var indexTagRules struct {
+	once  sync.Once
+	rules []TagRule
+	err   error
+}
+
+func configuredTagRules() ([]TagRule, error) {
+	indexTagRules.once.Do(func() {
+		indexTagRules.rules, indexTagRules.err = TagRules()
+	})
+	return indexTagRules.rules, indexTagRules.err
+}
+
+// checkTagRules rejects invalid tagging rules before a scan starts.
+func checkTagRules() error {
+	_, err := configuredTagRules()
+	return err
+}
+
+// tagByRules applies the configured rules to a record being indexed.
+// checkTagRules reports invalid rules; here they tag nothing.
+func tagByRules(meta *metadata.FileMetadata) {
+	if rules, err := configuredTagRules(); err == nil {
+		ApplyTagRules(meta, rules)
+	}
+}
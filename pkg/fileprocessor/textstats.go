@@ -0,0 +1,165 @@
+package fileprocessor
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// Text File Statistics
+// ------------------------
+
+const (
+	textSniffSize    = 8 << 10   // Bytes inspected to decide whether a file is text
+	textStatsMaxSize = 256 << 20 // Larger files are not line-counted
+)
+
+// languageByExt maps file extensions to the language recorded in Extra.
+var languageByExt = map[string]string{
+	".go": "Go", ".py": "Python", ".js": "JavaScript", ".mjs": "JavaScript", ".ts": "TypeScript",
+	".tsx": "TypeScript", ".jsx": "JavaScript", ".java": "Java", ".kt": "Kotlin", ".c": "C",
+	".h": "C", ".cc": "C++", ".cpp": "C++", ".hpp": "C++", ".cs": "C#", ".rs": "Rust",
+	".rb": "Ruby", ".php": "PHP", ".swift": "Swift", ".scala": "Scala", ".pl": "Perl",
+	".sh": "Shell", ".bash": "Shell", ".zsh": "Shell", ".ps1": "PowerShell", ".lua": "Lua",
+	".r": "R", ".sql": "SQL", ".html": "HTML", ".htm": "HTML", ".css": "CSS", ".scss": "SCSS",
+	".md": "Markdown", ".rst": "reStructuredText", ".tex": "TeX", ".txt": "Text",
+	".json": "JSON", ".yaml": "YAML", ".yml": "YAML", ".toml": "TOML", ".xml": "XML",
+	".csv": "CSV", ".tsv": "TSV", ".ini": "INI", ".proto": "Protocol Buffers",
+}
+
+// languageByInterpreter maps shebang interpreters to languages.
+var languageByInterpreter = map[string]string{
+	"sh": "Shell", "bash": "Shell", "zsh": "Shell", "python": "Python", "python3": "Python",
+	"perl": "Perl", "ruby": "Ruby", "node": "JavaScript", "lua": "Lua", "Rscript": "R",
+}
+
+// textStatsExtra returns line count, encoding and language for text files
+// when --text-stats is enabled. Binary files yield nil.
+func textStatsExtra(path string, info os.FileInfo) map[string]interface{} {
+	if !viper.GetBool("textStats") || info.Size() == 0 || info.Size() > textStatsMaxSize {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	head := make([]byte, textSniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil
+	}
+	head = head[:n]
+	encoding := detectTextEncoding(head)
+	if encoding == "" {
+		return nil
+	}
+
+	lines := bytes.Count(head, []byte{'\n'})
+	last := byte(0)
+	if n > 0 {
+		last = head[n-1]
+	}
+	buf := make([]byte, 64<<10)
+	for {
+		m, err := f.Read(buf)
+		if m > 0 {
+			lines += bytes.Count(buf[:m], []byte{'\n'})
+			last = buf[m-1]
+		}
+		if err != nil {
+			break
+		}
+	}
+	if last != '\n' {
+		lines++ // Count a final unterminated line
+	}
+	if strings.HasPrefix(encoding, "utf-16") {
+		lines = -1 // Byte-wise newline counting is meaningless for UTF-16
+	}
+
+	extra := map[string]interface{}{
+		"encoding": encoding,
+	}
+	if lines >= 0 {
+		extra["lineCount"] = lines
+	}
+	if lang := detectLanguage(path, head); lang != "" {
+		extra["language"] = lang
+	}
+	return extra
+}
+
+// detectTextEncoding classifies a file's leading bytes, returning "" for
+// content that looks binary.
+func detectTextEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8-bom"
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return ""
+	}
+	ascii := true
+	for _, c := range head {
+		if c >= 0x80 {
+			ascii = false
+			break
+		}
+		// Control characters other than common whitespace suggest binary data.
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' && c != '\f' && c != 0x1b {
+			return ""
+		}
+	}
+	if ascii {
+		return "ascii"
+	}
+	// A multi-byte sequence may be cut off at the end of the sniffed block.
+	trimmed := head
+	for i := 0; i < utf8.UTFMax && len(trimmed) > 0 && !utf8.Valid(trimmed); i++ {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	if utf8.Valid(trimmed) {
+		return "utf-8"
+	}
+	return "latin-1"
+}
+
+// detectLanguage guesses a file's language from its extension, falling back
+// to a shebang line.
+func detectLanguage(path string, head []byte) string {
+	if lang, ok := languageByExt[strings.ToLower(filepath.Ext(path))]; ok {
+		return lang
+	}
+	switch filepath.Base(path) {
+	case "Makefile", "GNUmakefile":
+		return "Makefile"
+	case "Dockerfile":
+		return "Dockerfile"
+	}
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return ""
+	}
+	line, _ := bufio.NewReader(bytes.NewReader(head)).ReadString('\n')
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	interp := filepath.Base(fields[0])
+	if interp == "env" && len(fields) > 1 {
+		interp = fields[1]
+	}
+	return languageByInterpreter[interp]
+}
@@ -0,0 +1,226 @@
+package fileprocessor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Volumes and Removable Media
+// ------------------------
+
+// VolumeInfo is a mounted filesystem with a stable ID: its UUID, or the
+// volume serial number on Windows. Filesystems without one (network shares,
+// pseudo filesystems, or block devices where udev keeps no /dev/disk links)
+// are not tracked as volumes.
+type VolumeInfo struct {
+	ID         string `json:"id"`
+	Label      string `json:"label,omitempty"`
+	FSType     string `json:"fsType,omitempty"`
+	Device     string `json:"device,omitempty"`
+	Mountpoint string `json:"mountpoint"`
+	Removable  bool   `json:"removable,omitempty"`
+}
+
+// mountFor returns the mounted partition holding absPath.
+func mountFor(absPath string) (disk.PartitionStat, bool) {
+	parts, err := GetPartitions()
+	if err != nil {
+		return disk.PartitionStat{}, false
+	}
+	var best disk.PartitionStat
+	found := false
+	for _, p := range parts {
+		if !underDir(absPath, p.Mountpoint) {
+			continue
+		}
+		if !found || len(p.Mountpoint) >= len(best.Mountpoint) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// underDir reports whether path is dir or inside it.
+func underDir(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	dir = strings.TrimRight(dir, `/\`)
+	return strings.HasPrefix(path, dir+"/") || strings.HasPrefix(path, dir+`\`)
+}
+
+func volumeOf(p disk.PartitionStat) (VolumeInfo, bool) {
+	id, label, removable := volumeIdentity(p)
+	if id == "" {
+		return VolumeInfo{}, false
+	}
+	return VolumeInfo{ID: id, Label: label, FSType: p.Fstype, Device: p.Device, Mountpoint: p.Mountpoint, Removable: removable}, true
+}
+
+// IdentifyVolume returns the volume absPath is on, if it has a stable ID.
+func IdentifyVolume(absPath string) (VolumeInfo, bool) {
+	p, ok := mountFor(absPath)
+	if !ok {
+		return VolumeInfo{}, false
+	}
+	return volumeOf(p)
+}
+
+// OnlineVolumes returns the volumes mounted now, by ID.
+func OnlineVolumes() (map[string]VolumeInfo, error) {
+	parts, err := GetPartitions()
+	if err != nil {
+		return nil, err
+	}
+	online := map[string]VolumeInfo{}
+	for _, p := range parts {
+		if v, ok := volumeOf(p); ok {
+			if _, seen := online[v.ID]; !seen { // Bind mounts repeat a volume
+				online[v.ID] = v
+			}
+		}
+	}
+	return online, nil
+}
+
+// OfflineVolumes returns the known volumes that are not mounted now, by ID.
+func OfflineVolumes(ps *storage.PersistentStore) (map[string]storage.Volume, error) {
+	vols, err := ps.Volumes()
+	if err != nil {
+		return nil, err
+	}
+	online, err := OnlineVolumes()
+	if err != nil {
+		return nil, err
+	}
+	offline := map[string]storage.Volume{}
+	for _, v := range vols {
+		if _, ok := online[v.ID]; !ok {
+			offline[v.ID] = v
+		}
+	}
+	return offline, nil
+}
+
+// OfflineVolume returns the volume in offline holding the file of a record,
+// if the record is this host's and the volume is among them.
+func OfflineVolume(meta *metadata.FileMetadata, offline map[string]storage.Volume) (storage.Volume, bool) {
+	if meta.HostID != utils.HostID {
+		return storage.Volume{}, false
+	}
+	id, _ := meta.Extra[metadata.VolumeField].(string)
+	v, ok := offline[id]
+	return v, ok
+}
+
+// MarkOffline flags a record of a file on an offline volume (see
+// metadata.OfflineField), reporting whether it is one.
+func MarkOffline(meta *metadata.FileMetadata, offline map[string]storage.Volume) bool {
+	v, ok := OfflineVolume(meta, offline)
+	if !ok {
+		return false
+	}
+	name := v.Label
+	if name == "" {
+		name = v.ID
+	}
+	extra := make(map[string]interface{}, len(meta.Extra)+2)
+	for k, val := range meta.Extra {
+		extra[k] = val
+	}
+	extra[metadata.OfflineField] = true
+	extra[metadata.OfflineVolumeField] = name
+	meta.Extra = extra
+	return true
+}
+
+// volumeIDs caches the volume ID of each mounted device for records, as
+// long as the partition list is (a drive may be swapped under a mountpoint).
+var volumeIDs = struct {
+	sync.Mutex
+	ids map[string]volumeIDEntry // By device and mountpoint
+}{ids: map[string]volumeIDEntry{}}
+
+type volumeIDEntry struct {
+	id string
+	at time.Time
+}
+
+// volumeExtra tags a record with the ID of the volume its file is on.
+func volumeExtra(absPath string) map[string]interface{} {
+	p, ok := mountFor(absPath)
+	if !ok {
+		return nil
+	}
+	key := p.Device + "\x00" + p.Mountpoint
+	volumeIDs.Lock()
+	e, ok := volumeIDs.ids[key]
+	volumeIDs.Unlock()
+	if !ok || time.Since(e.at) > cacheDuration {
+		e = volumeIDEntry{at: time.Now()}
+		if v, ok := volumeOf(p); ok {
+			e.id = v.ID
+		}
+		volumeIDs.Lock()
+		volumeIDs.ids[key] = e
+		volumeIDs.Unlock()
+	}
+	if e.id == "" {
+		return nil
+	}
+	return map[string]interface{}{metadata.VolumeField: e.id}
+}
+
+// noteVolume records the volume a scan's root is on as seen now, telling
+// of a volume known from an earlier scan that is now mounted elsewhere.
+func noteVolume(ps *storage.PersistentStore, absRoot string, quiet bool) (storage.Volume, bool) {
+	info, ok := IdentifyVolume(absRoot)
+	if !ok {
+		return storage.Volume{}, false
+	}
+	now := time.Now()
+	v, found, err := ps.Volume(info.ID)
+	if err != nil {
+		return storage.Volume{}, false
+	}
+	if !found {
+		v = storage.Volume{ID: info.ID, FirstSeen: now}
+	} else if !quiet && v.Mountpoint != info.Mountpoint {
+		scanned := "never scanned"
+		if !v.LastScanned.IsZero() {
+			scanned = "last scanned " + v.LastScanned.Local().Format(time.DateTime)
+		}
+		fmt.Printf("Recognized volume %s%s, previously at %s (%s)\n", info.ID, labelSuffix(info.Label), v.Mountpoint, scanned)
+	}
+	v.Label, v.FSType, v.Device, v.Mountpoint, v.Removable = info.Label, info.FSType, info.Device, info.Mountpoint, info.Removable
+	v.LastSeen = now
+	if err := ps.PutVolume(v); err != nil && !quiet {
+		fmt.Printf("Error recording volume %s: %v\n", v.ID, err)
+	}
+	return v, true
+}
+
+// finishVolumeScan records a complete scan of absRoot on volume v.
+func finishVolumeScan(ps *storage.PersistentStore, v storage.Volume, absRoot string, quiet bool) {
+	v.LastScanned, v.LastScanRoot = time.Now(), absRoot
+	v.LastSeen = v.LastScanned
+	if err := ps.PutVolume(v); err != nil && !quiet {
+		fmt.Printf("Error recording volume %s: %v\n", v.ID, err)
+	}
+}
+
+func labelSuffix(label string) string {
+	if label == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%q)", label)
+}
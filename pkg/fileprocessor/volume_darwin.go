@@ -0,0 +1,41 @@
+//go:build darwin
+
+package fileprocessor
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// volumeIdentity reads a volume's UUID, name and location from diskutil.
+func volumeIdentity(p disk.PartitionStat) (id, label string, removable bool) {
+	out, err := exec.Command("diskutil", "info", p.Mountpoint).Output()
+	if err != nil {
+		return "", "", false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Volume UUID":
+			id = value
+		case "Volume Name":
+			label = value
+		case "Removable Media":
+			removable = removable || value == "Removable"
+		case "Device Location":
+			removable = removable || value == "External"
+		case "Protocol":
+			removable = removable || value == "USB"
+		}
+	}
+	return id, label, removable
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package fileprocessor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// volumeIdentity finds a partition's filesystem UUID and label among the
+// links udev keeps in /dev/disk, and whether its disk is removable or
+// attached over USB.
+func volumeIdentity(p disk.PartitionStat) (id, label string, removable bool) {
+	dev, err := filepath.EvalSymlinks(p.Device)
+	if err != nil || !strings.HasPrefix(dev, "/dev/") {
+		return "", "", false
+	}
+	if id = diskLink("/dev/disk/by-uuid", dev); id == "" {
+		return "", "", false
+	}
+	label = diskLink("/dev/disk/by-label", dev)
+	if unquoted, err := strconv.Unquote(`"` + label + `"`); err == nil {
+		label = unquoted // udev escapes spaces and the like as \x20
+	}
+	return id, label, removableDevice(dev)
+}
+
+// diskLink returns the name of the link in dir that resolves to dev.
+func diskLink(dir, dev string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if target, err := filepath.EvalSymlinks(filepath.Join(dir, e.Name())); err == nil && target == dev {
+			return e.Name()
+		}
+	}
+	return ""
+}
+
+// removableDevice reports whether sysfs marks the block device dev, or the
+// disk it is a partition of, removable, or places it on a USB bus.
+func removableDevice(dev string) bool {
+	sys, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", filepath.Base(dev)))
+	if err != nil {
+		return false
+	}
+	if strings.Contains(sys, "/usb") {
+		return true
+	}
+	for _, dir := range []string{sys, filepath.Dir(sys)} {
+		if data, err := os.ReadFile(filepath.Join(dir, "removable")); err == nil && strings.TrimSpace(string(data)) == "1" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package fileprocessor
+
+import "github.com/shirou/gopsutil/disk"
+
+func volumeIdentity(p disk.PartitionStat) (id, label string, removable bool) {
+	return "", "", false
+}
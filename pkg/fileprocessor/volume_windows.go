@@ -0,0 +1,26 @@
+//go:build windows
+
+package fileprocessor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shirou/gopsutil/disk"
+	"golang.org/x/sys/windows"
+)
+
+// volumeIdentity reads a drive's volume serial number and label.
+func volumeIdentity(p disk.PartitionStat) (id, label string, removable bool) {
+	root, err := windows.UTF16PtrFromString(strings.TrimRight(p.Mountpoint, `\`) + `\`)
+	if err != nil {
+		return "", "", false
+	}
+	var serial uint32
+	name := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(root, &name[0], uint32(len(name)), &serial, nil, nil, nil, 0); err != nil {
+		return "", "", false
+	}
+	id = fmt.Sprintf("%04X-%04X", serial>>16, serial&0xffff)
+	return id, windows.UTF16ToString(name), windows.GetDriveType(root) == windows.DRIVE_REMOVABLE
+}
@@ -0,0 +1,309 @@
+package fileprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/karrick/godirwalk"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Continuous Indexing with fsnotify
+// ------------------------
+
+// WatchOptions configures WatchDirectory.
+type WatchOptions struct {
+	// Debounce is how long a path must be quiet before it is re-indexed, so
+	// a burst of writes to one file costs a single update.
+	Debounce time.Duration
+	// Scan indexes every file under the root that changed since it was
+	// last indexed before watching, and records the removal of files
+	// deleted while nothing was watching.
+	Scan bool
+	// Priority, if set, holds paths to verify before anything else,
+	// including the rest of the scan and pending events.
+	Priority *PriorityQueue
+}
+
+// watcher keeps the index of one directory tree current.
+type watcher struct {
+	fsw      *fsnotify.Watcher
+	ps       *storage.PersistentStore
+	cw       *storage.CacheWriter
+	root     string
+	quiet    bool
+	known    map[string]bool // Canonical paths of live files indexed on this host
+	priority *PriorityQueue
+	filter   *Filter
+}
+
+// WatchDirectory watches root recursively and writes a new revision through
+// cw whenever a file is created or modified, and a tombstone (see
+// metadata.DeletedField) whenever a known file is deleted or renamed away.
+// Every update is also broadcast to the swarm (see SetSwarmDelegate). It
+// returns when ctx is cancelled.
+func WatchDirectory(ctx context.Context, root string, ps *storage.PersistentStore, cw *storage.CacheWriter, opts WatchOptions) error {
+	if err := checkHashMode(); err != nil {
+		return err
+	}
+	if err := checkChunkOptions(); err != nil {
+		return err
+	}
+	if err := checkTagRules(); err != nil {
+		return err
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(root); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	w := &watcher{fsw: fsw, ps: ps, cw: cw, root: root, quiet: viper.GetBool("quiet"), known: map[string]bool{}, priority: opts.Priority, filter: scanFilter(root)}
+	if err := w.loadKnown(root); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	if err := w.addTree(ctx, root, opts.Scan, seen); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	if opts.Scan {
+		for path := range w.known {
+			if !seen[path] {
+				w.remove(path)
+			}
+		}
+	}
+	if !w.quiet {
+		fmt.Printf("Watching %s (%d files known, Ctrl+C to stop)...\n", root, len(w.known))
+	}
+
+	debounce := opts.Debounce
+	if debounce < 50*time.Millisecond {
+		debounce = 50 * time.Millisecond
+	}
+	type pendingEvent struct {
+		op   fsnotify.Op
+		last time.Time
+	}
+	pending := map[string]*pendingEvent{}
+	ticker := time.NewTicker(debounce / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			if !w.quiet {
+				fmt.Printf("Watch error: %v\n", err)
+			}
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			p := pending[ev.Name]
+			if p == nil {
+				p = &pendingEvent{}
+				pending[ev.Name] = p
+			}
+			p.op |= ev.Op
+			p.last = time.Now()
+		case <-w.priority.ready():
+			w.drainPriority(ctx)
+		case <-ticker.C:
+			for path, p := range pending {
+				if time.Since(p.last) < debounce {
+					continue
+				}
+				delete(pending, path)
+				w.update(ctx, path, p.op)
+			}
+		}
+	}
+}
+
+// loadKnown collects this host's live files under root from the store.
+// Files on a volume that is not mounted now (a detached drive whose
+// mountpoint is left as an empty directory) are not known, so that watching
+// does not record their deletion.
+func (w *watcher) loadKnown(root string) error {
+	prefix := canonical(root)
+	latest, err := w.ps.Latest()
+	if err != nil {
+		return fmt.Errorf("read index: %w", err)
+	}
+	offline, err := OfflineVolumes(w.ps)
+	if err != nil {
+		return fmt.Errorf("read volumes: %w", err)
+	}
+	for _, meta := range latest {
+		if meta.HostID != utils.HostID || !underPath(meta.FilePath, prefix) {
+			continue
+		}
+		if _, ok := OfflineVolume(&meta, offline); ok {
+			continue
+		}
+		w.known[meta.FilePath] = true
+	}
+	return nil
+}
+
+// addTree watches dir and its subdirectories. With index set, the files
+// found are indexed as well and their canonical paths recorded in seen (if
+// not nil).
+func (w *watcher) addTree(ctx context.Context, dir string, index bool, seen map[string]bool) error {
+	return godirwalk.Walk(dir, &godirwalk.Options{
+		Unsorted: true,
+		Callback: func(path string, de *godirwalk.Dirent) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			if isGitDir(de) {
+				return godirwalk.SkipThis
+			}
+			if path != dir && w.filter.Skip(path, de.IsDir()) {
+				if de.IsDir() {
+					return godirwalk.SkipThis
+				}
+				return nil
+			}
+			if de.IsDir() {
+				if err := w.fsw.Add(path); err != nil && !w.quiet {
+					fmt.Printf("Cannot watch %s: %v\n", path, err)
+				}
+				return nil
+			}
+			if index {
+				w.drainPriority(ctx)
+				if seen != nil {
+					seen[canonical(path)] = true
+				}
+				if _, _, ok := unchanged(w.ps, path); !ok {
+					w.index(ctx, path)
+				}
+			}
+			return nil
+		},
+		ErrorCallback: func(path string, err error) godirwalk.ErrorAction {
+			if !w.quiet {
+				fmt.Printf("Error reading %s: %v\n", path, err)
+			}
+			return godirwalk.SkipNode
+		},
+	})
+}
+
+// update handles the settled events for one path: it is re-indexed if it
+// still exists and tombstoned (with everything known beneath it) if not.
+// Excluded paths are left alone.
+func (w *watcher) update(ctx context.Context, path string, op fsnotify.Op) {
+	if filepath.Base(path) == IgnoreFileName {
+		w.filter.Forget(filepath.Dir(path))
+	}
+	info, err := os.Stat(path)
+	if err == nil && w.filter.SkipTree(path, info.IsDir()) {
+		return
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		w.remove(canonical(path))
+	case err != nil:
+		if !w.quiet {
+			fmt.Printf("Error processing %s: %v\n", path, err)
+		}
+	case info.IsDir():
+		// New directories (including ones moved in) are watched and their
+		// contents indexed; other directory events need no action
+		if op.Has(fsnotify.Create) && !(info.Name() == ".git" && viper.GetBool("skipGit")) {
+			w.addTree(ctx, path, true, nil)
+		}
+	default:
+		w.index(ctx, path)
+	}
+}
+
+// index writes a new revision of a file and broadcasts it.
+func (w *watcher) index(ctx context.Context, path string) {
+	meta, _, err := readMetadata(ctx, path)
+	if err != nil {
+		if !w.quiet && !errors.Is(err, context.Canceled) {
+			fmt.Printf("Error processing %s: %v\n", path, err)
+		}
+		return
+	}
+	w.store(path, meta)
+}
+
+// store writes the record read from the file at path and broadcasts it.
+func (w *watcher) store(path string, meta metadata.FileMetadata) {
+	meta = w.cw.Write(meta)
+	if err := storeChunks(w.ps, path, meta); err != nil && !w.quiet {
+		fmt.Printf("Error processing %s: %v\n", path, err)
+	}
+	broadcast(meta)
+	w.known[meta.FilePath] = true
+	if !w.quiet {
+		fmt.Printf("Indexed %s\n", path)
+	}
+}
+
+// remove writes tombstones for the known file at path, or for every known
+// file under it when path was a directory.
+func (w *watcher) remove(path string) {
+	now := time.Now()
+	for known := range w.known {
+		if !underPath(known, path) {
+			continue
+		}
+		meta := metadata.NewTombstone(utils.HostID, known, now)
+		broadcast(w.cw.Write(meta))
+		delete(w.known, known)
+		if !w.quiet {
+			fmt.Printf("Removed %s\n", known)
+		}
+	}
+}
+
+// canonical returns the canonical form of an absolute path, which need not
+// exist any more.
+func canonical(absPath string) string {
+	if c, err := CanonicalizePath(absPath); err == nil {
+		return c
+	}
+	return absPath
+}
+
+// underPath reports whether path is dir itself or lies beneath it.
+func underPath(path, dir string) bool {
+	sep := string(filepath.Separator)
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, sep)+sep)
+}
@@ -0,0 +1,196 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// ------------------------
+// Signed Scan Manifests
+// ------------------------
+
+// Manifest describes a completed scan of a root: what was seen, how it was
+// fingerprinted, and a Merkle root over every file's path and fingerprint,
+// signed by the scanning host. Anyone holding a copy of the tree can
+// recompute the Merkle root and check it against a manifest they trust.
+type Manifest struct {
+	ID         string    `json:"id"` // Derived from the signed payload, not part of it
+	HostID     string    `json:"hostID"`
+	Root       string    `json:"root"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Duration   float64   `json:"durationSeconds"`
+	Files      int       `json:"files"`   // Files in the Merkle tree
+	Bytes      int64     `json:"bytes"`   // Their total size
+	Changed    int       `json:"changed"` // Files new or modified since the previous scan
+	Errors     int       `json:"errors"`  // Files that could not be read, and are not in the tree
+	HashMode   string    `json:"hashMode"`
+	SampleSize int64     `json:"sampleSize,omitempty"` // In sampled mode
+	SkipGit    bool      `json:"skipGit,omitempty"`    // Whether .git directories were left out
+	Exclude    []string  `json:"exclude,omitempty"`    // --exclude patterns; .dreamfsignore files are always honoured
+	Include    []string  `json:"include,omitempty"`    // --include patterns
+	MerkleRoot string    `json:"merkleRoot"`
+	PublicKey  string    `json:"publicKey"` // Ed25519, hex
+	Signature  string    `json:"signature"` // Ed25519 over Payload, hex
+}
+
+// Leaf is a file in the Merkle tree: its slash-separated path relative to
+// the scanned root, and its fingerprint.
+type Leaf struct {
+	Path        string
+	Fingerprint string
+}
+
+// MerkleRoot hashes the leaves, sorted by path, into a binary Merkle tree.
+// A leaf hashes as BLAKE3(0x00 || path || 0x00 || fingerprint) and a node as
+// BLAKE3(0x01 || left || right); an odd node is carried up unchanged. An
+// empty tree hashes as BLAKE3 of nothing.
+func MerkleRoot(leaves []Leaf) string {
+	sorted := append([]Leaf(nil), leaves...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	if len(sorted) == 0 {
+		sum := blake3.Sum256(nil)
+		return hex.EncodeToString(sum[:])
+	}
+	level := make([][]byte, len(sorted))
+	for i, l := range sorted {
+		h := blake3.New()
+		h.Write([]byte{0})
+		h.Write([]byte(l.Path))
+		h.Write([]byte{0})
+		h.Write([]byte(l.Fingerprint))
+		level[i] = h.Sum(nil)
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := blake3.New()
+			h.Write([]byte{1})
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// Payload is what the signature covers: a versioned header and one
+// "key=value" line per field, in a fixed order, so that the signature can
+// be checked without a JSON encoder that agrees on field order.
+func (m Manifest) Payload() []byte {
+	var b strings.Builder
+	b.WriteString("dreamfs-manifest-v1\n")
+	for _, kv := range [][2]string{
+		{"hostID", m.HostID},
+		{"root", m.Root},
+		{"started", m.Started.UTC().Format(time.RFC3339Nano)},
+		{"finished", m.Finished.UTC().Format(time.RFC3339Nano)},
+		{"durationSeconds", strconv.FormatFloat(m.Duration, 'f', 3, 64)},
+		{"files", strconv.Itoa(m.Files)},
+		{"bytes", strconv.FormatInt(m.Bytes, 10)},
+		{"changed", strconv.Itoa(m.Changed)},
+		{"errors", strconv.Itoa(m.Errors)},
+		{"hashMode", m.HashMode},
+		{"sampleSize", strconv.FormatInt(m.SampleSize, 10)},
+		{"skipGit", strconv.FormatBool(m.SkipGit)},
+		{"merkleRoot", m.MerkleRoot},
+		{"publicKey", m.PublicKey},
+	} {
+		fmt.Fprintf(&b, "%s=%s\n", kv[0], strconv.Quote(kv[1]))
+	}
+	// Added later, so only present when set to keep older signatures valid
+	for _, kv := range []struct {
+		key      string
+		patterns []string
+	}{{"exclude", m.Exclude}, {"include", m.Include}} {
+		for _, p := range kv.patterns {
+			fmt.Fprintf(&b, "%s=%s\n", kv.key, strconv.Quote(p))
+		}
+	}
+	return []byte(b.String())
+}
+
+// Sign sets the public key, signature and ID with key.
+func (m *Manifest) Sign(key ed25519.PrivateKey) {
+	m.PublicKey = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	payload := m.Payload()
+	m.Signature = hex.EncodeToString(ed25519.Sign(key, payload))
+	m.ID = payloadID(payload)
+}
+
+// Verify checks the signature against the manifest's own public key, and,
+// if pubKey is not empty, that the key is that one (hex).
+func (m Manifest) Verify(pubKey string) error {
+	if pubKey != "" && !strings.EqualFold(pubKey, m.PublicKey) {
+		return fmt.Errorf("manifest is signed by %s, not the expected key", m.PublicKey)
+	}
+	key, err := hex.DecodeString(m.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+	sig, err := hex.DecodeString(m.Signature)
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+	payload := m.Payload()
+	if !ed25519.Verify(ed25519.PublicKey(key), payload, sig) {
+		return errors.New("signature does not match the manifest")
+	}
+	if m.ID != "" && m.ID != payloadID(payload) {
+		return errors.New("manifest ID does not match its content")
+	}
+	return nil
+}
+
+func payloadID(payload []byte) string {
+	sum := blake3.Sum256(payload)
+	return hex.EncodeToString(sum[:8])
+}
+
+// DefaultKeyPath is where the host's signing key is kept unless configured.
+func DefaultKeyPath(dataHome string) string {
+	return filepath.Join(dataHome, "indexer", "manifest.key")
+}
+
+// LoadOrCreateKey reads the Ed25519 signing key (a hex seed) at path,
+// generating and saving a new one if the file does not exist.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, fmt.Errorf("generate signing key: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("write signing key: %w", err)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s is not a hex-encoded Ed25519 seed", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
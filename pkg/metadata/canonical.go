@@ -0,0 +1,62 @@
+package metadata
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ------------------------
+// Canonical Form
+// ------------------------
+
+// Canonical returns the record with its timestamps normalized: modTime,
+// and every string in Extra that is an RFC 3339 timestamp, in UTC with
+// trailing zero fractions dropped. The same instant then always reads the
+// same, whatever zone the indexing host was in. idString, the input of the
+// record's ID, is left as it was.
+func (fm FileMetadata) Canonical() FileMetadata {
+	fm.ModTime = canonicalTime(fm.ModTime)
+	if fm.Extra != nil {
+		fm.Extra = canonicalValue(fm.Extra).(map[string]interface{})
+	}
+	return fm
+}
+
+// CanonicalJSON encodes the canonical form of a record with the keys of
+// every object sorted and no insignificant whitespace, so that equal
+// records encode to equal bytes.
+func CanonicalJSON(fm FileMetadata) ([]byte, error) {
+	// encoding/json writes map keys sorted, and MarshalJSON encodes through
+	// a map
+	return json.Marshal(fm.Canonical())
+}
+
+func canonicalTime(s string) string {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return s
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// canonicalValue returns a copy of a decoded JSON value with its timestamps
+// normalized.
+func canonicalValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return canonicalTime(v)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = canonicalValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = canonicalValue(item)
+		}
+		return out
+	}
+	return v
+}
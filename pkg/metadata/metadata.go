@@ -2,6 +2,10 @@ package metadata
 
 import (
 	"encoding/json"
+	"fmt"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/utils"
 )
 
 type FileMetadata struct {
@@ -57,7 +61,9 @@ func (fm *FileMetadata) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func (fm *FileMetadata) MarshalJSON() ([]byte, error) {
+// MarshalJSON uses a value receiver so that Extra is preserved when a
+// FileMetadata value (rather than a pointer) is marshaled.
+func (fm FileMetadata) MarshalJSON() ([]byte, error) {
 	m := map[string]interface{}{
 		"_id":      fm.ID,
 		"idString": fm.IDString,
@@ -74,3 +80,162 @@ func (fm *FileMetadata) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(m)
 }
+
+// Field returns the value of a document field by its JSON name. Core fields
+// are checked first; anything else is looked up in Extra.
+func (fm *FileMetadata) Field(name string) (interface{}, bool) {
+	switch name {
+	case "_id":
+		return fm.ID, true
+	case "idString":
+		return fm.IDString, true
+	case "hostID":
+		return fm.HostID, true
+	case "filePath":
+		return fm.FilePath, true
+	case "size":
+		return fm.Size, true
+	case "modTime":
+		return fm.ModTime, true
+	case "blake3":
+		return fm.BLAKE3, true
+	}
+	v, ok := fm.Extra[name]
+	return v, ok
+}
+
+// FieldStrings returns the string forms of a field's value. List values (such
+// as tags) yield one string per element; missing fields yield nil.
+func (fm *FileMetadata) FieldStrings(name string) []string {
+	v, ok := fm.Field(name)
+	if !ok || v == nil {
+		return nil
+	}
+	if list, ok := v.([]interface{}); ok {
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// DeletedField marks a tombstone: a record written when a file is removed
+// from a watched tree. Tombstones carry no size or fingerprint, and their
+// ModTime is the time the removal was seen.
+const DeletedField = "deleted"
+
+// Deleted reports whether the record is a tombstone.
+func (fm *FileMetadata) Deleted() bool {
+	deleted, _ := fm.Extra[DeletedField].(bool)
+	return deleted
+}
+
+// NewTombstone builds the record marking hostID's file at path as deleted at
+// the given time.
+func NewTombstone(hostID, path string, at time.Time) FileMetadata {
+	modTime := at.Format(time.RFC3339)
+	idString := hostID + "|" + path + "|" + modTime + "|" + DeletedField
+	return FileMetadata{
+		ID:       utils.GenerateUUID(idString),
+		IDString: idString,
+		HostID:   hostID,
+		FilePath: path,
+		ModTime:  modTime,
+		Extra:    map[string]interface{}{DeletedField: true},
+	}
+}
+
+// DeletedAt returns when the file of a tombstone was deleted; ok is false
+// for other records.
+func (fm *FileMetadata) DeletedAt() (at time.Time, ok bool) {
+	if !fm.Deleted() {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(time.RFC3339, fm.ModTime)
+	return at, err == nil
+}
+
+// ArchivedField marks a record of a retired host (see 'indexer host
+// retire'): kept for history, but left out of current files, duplicates and
+// reports. ArchivedAtField holds when the host was retired, and
+// PurgeAfterField, if set, when its records may be purged (both RFC 3339).
+const (
+	ArchivedField   = "archived"
+	ArchivedAtField = "archivedAt"
+	PurgeAfterField = "purgeAfter"
+)
+
+// Archived reports whether the record belongs to a retired host.
+func (fm *FileMetadata) Archived() bool {
+	archived, _ := fm.Extra[ArchivedField].(bool)
+	return archived
+}
+
+// PurgeAfter returns when an archived record may be purged; ok is false for
+// records kept indefinitely.
+func (fm *FileMetadata) PurgeAfter() (at time.Time, ok bool) {
+	s, _ := fm.Extra[PurgeAfterField].(string)
+	if !fm.Archived() || s == "" {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(time.RFC3339, s)
+	return at, err == nil
+}
+
+// VolumeField holds the ID of the volume a file was indexed on (see
+// storage.Volume), so that the records of a removable drive can be found
+// whatever it was mounted as.
+const VolumeField = "volume"
+
+// StreamPrefix starts the virtual path of content indexed from a stream
+// rather than a file (see 'indexer hash-stream'), e.g. "stream:nightly.sql".
+// Such paths name no file on the host, so nothing checks them on disk.
+const StreamPrefix = "stream:"
+
+// OfflineField and OfflineVolumeField flag, in query and export output, a
+// record of a file on a volume that is not mounted now, and name the volume
+// (its label, or ID if it has none). They describe the volume as the output
+// was written and are not stored.
+const (
+	OfflineField       = "offline"
+	OfflineVolumeField = "offlineVolume"
+)
+
+// Fingerprint strategies. The strategy that produced a record's BLAKE3 is
+// recorded in HashModeField, and the sample size of sampled fingerprints in
+// SampleSizeField, so that records hashed different ways can be told apart.
+const (
+	HashModeField   = "hashMode"
+	SampleSizeField = "sampleSize"
+
+	HashSampled = "sampled" // Head, middle and tail samples (the whole file if smaller than three)
+	HashFull    = "full"    // The whole content through one hasher, as b3sum prints it
+	HashChunked = "chunked" // The full digest, from fixed ranges hashed in parallel
+
+	DefaultSampleSize = 1 << 20
+)
+
+// HashMode returns the strategy that produced the record's fingerprint and,
+// for sampled fingerprints, the sample size. Records written before the
+// strategy was recorded were sampled with the default size.
+func (fm *FileMetadata) HashMode() (mode string, sampleSize int64) {
+	mode, _ = fm.Extra[HashModeField].(string)
+	if mode == "" {
+		mode = HashSampled
+	}
+	if mode != HashSampled {
+		return mode, 0
+	}
+	switch n := fm.Extra[SampleSizeField].(type) {
+	case float64: // As decoded from JSON
+		sampleSize = int64(n)
+	case int64:
+		sampleSize = n
+	}
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	return mode, sampleSize
+}
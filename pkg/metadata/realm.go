@@ -0,0 +1,252 @@
+package metadata
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ------------------------
+// Field Encryption by Realm
+// ------------------------
+
+// A realm is the set of nodes sharing a secret key. The fields a realm
+// encrypts are sealed before a record is stored or sent to a peer, so a copy
+// of the store or a peer outside the realm sees IDs, hosts, sizes, times and
+// fingerprints, but not paths or notes.
+//
+// Sealing is deterministic: the nonce is derived from the field and value, so
+// equal values seal to equal strings. Revisions of a file therefore still
+// share a path, and nodes without the key can order, merge and replicate
+// them. The price is that equality of sealed values is visible.
+
+// sealedPrefix starts every sealed value: "enc:<realm>:<base64 nonce+ciphertext>".
+const sealedPrefix = "enc:"
+
+// unsealable lists the fields replication depends on, which stay readable.
+var unsealable = map[string]bool{
+	"_id": true, "hostID": true, "size": true, "modTime": true, "blake3": true, DeletedField: true,
+	ArchivedField: true, ArchivedAtField: true, PurgeAfterField: true,
+	VersionVectorField: true, VersionClockField: true, RevField: true,
+}
+
+// Realm seals and opens the encrypted fields of records. A nil *Realm
+// encrypts nothing.
+type Realm struct {
+	name     string
+	fields   map[string]bool
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+// NewRealm returns the realm called name, with key material of at least 32
+// bytes, encrypting the given fields (e.g. filePath, notes). Encrypting
+// filePath also encrypts idString, which embeds the path.
+func NewRealm(name string, key []byte, fields []string) (*Realm, error) {
+	if name == "" || strings.ContainsAny(name, ":/") {
+		return nil, fmt.Errorf("invalid realm name %q", name)
+	}
+	if len(key) < 32 {
+		return nil, errors.New("realm key must be at least 32 bytes")
+	}
+	block, err := aes.NewCipher(deriveKey(key, "dreamfs field encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	r := &Realm{name: name, fields: map[string]bool{}, aead: aead, nonceKey: deriveKey(key, "dreamfs field nonce")}
+	for _, field := range fields {
+		if unsealable[field] {
+			return nil, fmt.Errorf("field %s cannot be encrypted (replication depends on it)", field)
+		}
+		r.fields[field] = true
+	}
+	if r.fields["filePath"] {
+		r.fields["idString"] = true
+	}
+	return r, nil
+}
+
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Name returns the realm's name, or "" for a nil realm.
+func (r *Realm) Name() string {
+	if r == nil {
+		return ""
+	}
+	return r.name
+}
+
+// Encrypts reports whether the realm seals the given field.
+func (r *Realm) Encrypts(field string) bool {
+	return r != nil && r.fields[field]
+}
+
+// Seal returns a copy of meta with the realm's fields sealed. Values that
+// are already sealed, by this realm or another, are kept as they are.
+func (r *Realm) Seal(meta FileMetadata) (FileMetadata, error) {
+	if r == nil || len(r.fields) == 0 {
+		return meta, nil
+	}
+	meta.Extra = copyExtra(meta.Extra)
+	for field := range r.fields {
+		v, ok := meta.Field(field)
+		if !ok || v == nil || v == "" {
+			continue
+		}
+		if s, ok := v.(string); ok && IsSealed(s) {
+			continue
+		}
+		sealed, err := r.seal(field, v)
+		if err != nil {
+			return meta, fmt.Errorf("seal %s: %w", field, err)
+		}
+		meta.setField(field, sealed)
+	}
+	return meta, nil
+}
+
+// SealPath returns path as it appears in records sealed by the realm.
+func (r *Realm) SealPath(path string) string {
+	if !r.Encrypts("filePath") || path == "" || IsSealed(path) {
+		return path
+	}
+	sealed, err := r.seal("filePath", path)
+	if err != nil {
+		return path
+	}
+	return sealed
+}
+
+// OpenPath reverses SealPath; paths sealed by other realms stay sealed.
+func (r *Realm) OpenPath(path string) string {
+	if r == nil {
+		return path
+	}
+	if plain, ok := r.open("filePath", path); ok {
+		if s, ok := plain.(string); ok {
+			return s
+		}
+	}
+	return path
+}
+
+// Open returns a copy of meta with the values sealed by this realm
+// decrypted. Values sealed by other realms, or that fail to decrypt, stay
+// sealed.
+func (r *Realm) Open(meta FileMetadata) FileMetadata {
+	if r == nil {
+		return meta
+	}
+	meta.Extra = copyExtra(meta.Extra)
+	for _, field := range []string{"filePath", "idString"} {
+		v, _ := meta.Field(field)
+		if plain, ok := r.open(field, v); ok {
+			meta.setField(field, plain)
+		}
+	}
+	for field, v := range meta.Extra {
+		if plain, ok := r.open(field, v); ok {
+			meta.Extra[field] = plain
+		}
+	}
+	return meta
+}
+
+// IsSealed reports whether s is a sealed value.
+func IsSealed(s string) bool {
+	_, _, ok := parseSealed(s)
+	return ok
+}
+
+func (r *Realm) seal(field string, v interface{}) (string, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, r.nonceKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write(plain)
+	nonce := mac.Sum(nil)[:r.aead.NonceSize()]
+	blob := r.aead.Seal(nonce, nonce, plain, []byte(field))
+	return sealedPrefix + r.name + ":" + base64.RawURLEncoding.EncodeToString(blob), nil
+}
+
+func (r *Realm) open(field string, v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	realm, blob, ok := parseSealed(s)
+	if !ok || realm != r.name || len(blob) < r.aead.NonceSize() {
+		return nil, false
+	}
+	n := r.aead.NonceSize()
+	plain, err := r.aead.Open(nil, blob[:n], blob[n:], []byte(field))
+	if err != nil {
+		return nil, false
+	}
+	var out interface{}
+	if err := json.Unmarshal(plain, &out); err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// parseSealed splits a sealed value into its realm and nonce+ciphertext.
+// Paths such as "enc:/data" (a share on a host named enc) do not parse.
+func parseSealed(s string) (realm string, blob []byte, ok bool) {
+	rest, found := strings.CutPrefix(s, sealedPrefix)
+	if !found {
+		return "", nil, false
+	}
+	realm, encoded, found := strings.Cut(rest, ":")
+	if !found || realm == "" || strings.Contains(realm, "/") {
+		return "", nil, false
+	}
+	blob, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(blob) <= 12+16 { // Nonce and GCM tag
+		return "", nil, false
+	}
+	return realm, blob, true
+}
+
+// setField sets a field by its JSON name; see Field.
+func (fm *FileMetadata) setField(name string, v interface{}) {
+	switch name {
+	case "filePath":
+		fm.FilePath, _ = v.(string)
+	case "idString":
+		fm.IDString, _ = v.(string)
+	default:
+		if fm.Extra == nil {
+			fm.Extra = map[string]interface{}{}
+		}
+		fm.Extra[name] = v
+	}
+}
+
+func copyExtra(extra map[string]interface{}) map[string]interface{} {
+	if extra == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(extra))
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
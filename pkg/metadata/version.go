@@ -0,0 +1,238 @@
+package metadata
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Record Versions
+// ------------------------
+
+// A record's version is a version vector, counting each host's writes of
+// the record, and the hybrid logical clock time of its latest write. The
+// vectors tell whether one copy of a record supersedes another or both were
+// written without seeing each other (a conflict); the clock picks the
+// winner of a conflict, last writer wins. Records written before versions
+// were recorded have neither, and are all equal.
+const (
+	VersionVectorField = "versionVector"
+	VersionClockField  = "versionClock"
+)
+
+// VersionVector maps host IDs to how many times each wrote the record.
+type VersionVector map[string]uint64
+
+// Ordering is how two versions relate.
+type Ordering int
+
+const (
+	VersionEqual      Ordering = iota
+	VersionBefore              // Superseded by the other
+	VersionAfter               // Supersedes the other
+	VersionConcurrent          // Neither saw the other: a conflict
+)
+
+// Compare returns how v relates to o.
+func (v VersionVector) Compare(o VersionVector) Ordering {
+	less, greater := false, false
+	for host, n := range v {
+		if n > o[host] {
+			greater = true
+		} else if n < o[host] {
+			less = true
+		}
+	}
+	for host, n := range o {
+		if _, ok := v[host]; !ok && n > 0 {
+			less = true
+		}
+	}
+	switch {
+	case less && greater:
+		return VersionConcurrent
+	case less:
+		return VersionBefore
+	case greater:
+		return VersionAfter
+	}
+	return VersionEqual
+}
+
+// Merge returns the pointwise maximum of v and o, which supersedes both.
+func (v VersionVector) Merge(o VersionVector) VersionVector {
+	out := make(VersionVector, len(v)+len(o))
+	for host, n := range v {
+		out[host] = n
+	}
+	for host, n := range o {
+		if n > out[host] {
+			out[host] = n
+		}
+	}
+	return out
+}
+
+// Version returns the record's version vector and clock time.
+func (fm *FileMetadata) Version() (VersionVector, string) {
+	vv := VersionVector{}
+	switch m := fm.Extra[VersionVectorField].(type) {
+	case map[string]interface{}: // As decoded from JSON
+		for host, n := range m {
+			switch n := n.(type) {
+			case float64:
+				vv[host] = uint64(n)
+			case uint64:
+				vv[host] = n
+			}
+		}
+	case VersionVector:
+		for host, n := range m {
+			vv[host] = n
+		}
+	}
+	clock, _ := fm.Extra[VersionClockField].(string)
+	return vv, clock
+}
+
+// SetVersion records a version on the record, copying Extra first so that
+// copies of the record sharing it are not changed.
+func (fm *FileMetadata) SetVersion(vv VersionVector, clock string) {
+	extra := copyExtra(fm.Extra)
+	if extra == nil {
+		extra = make(map[string]interface{}, 2)
+	}
+	m := make(map[string]interface{}, len(vv))
+	for host, n := range vv {
+		m[host] = n
+	}
+	extra[VersionVectorField] = m
+	extra[VersionClockField] = clock
+	fm.Extra = extra
+}
+
+// HLC is a hybrid logical clock: physical time in milliseconds that never
+// goes backwards, with a counter to order events within a millisecond and
+// after clock skew. Times are strings that sort in clock order, ending with
+// the host that took them so that no two hosts' times are equal.
+type HLC struct {
+	mu      sync.Mutex
+	wall    int64 // Milliseconds since the epoch
+	logical uint32
+}
+
+// LocalClock stamps this host's writes.
+var LocalClock = &HLC{}
+
+// Now returns a time after every time this clock returned or observed.
+func (c *HLC) Now() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := time.Now().UnixMilli(); now > c.wall {
+		c.wall, c.logical = now, 0
+	} else {
+		c.logical++
+	}
+	return fmt.Sprintf("%012x%08x-%s", c.wall, c.logical, utils.HostID)
+}
+
+// Observe moves the clock past a time received from another host.
+func (c *HLC) Observe(t string) {
+	wall, logical, _, ok := parseClock(t)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if wall > c.wall || wall == c.wall && logical > c.logical {
+		c.wall, c.logical = wall, logical
+	}
+}
+
+// ClockTime returns the physical time of a clock time and the host that
+// took it.
+func ClockTime(t string) (time.Time, string, bool) {
+	wall, _, hostID, ok := parseClock(t)
+	if !ok {
+		return time.Time{}, "", false
+	}
+	return time.UnixMilli(wall), hostID, true
+}
+
+func parseClock(t string) (wall int64, logical uint32, hostID string, ok bool) {
+	stamp, hostID, _ := strings.Cut(t, "-")
+	if _, err := fmt.Sscanf(stamp, "%012x%08x", &wall, &logical); err != nil {
+		return 0, 0, "", false
+	}
+	return wall, logical, hostID, true
+}
+
+// ------------------------
+// Document Revisions
+// ------------------------
+
+// RevField holds a record's CouchDB-style revision, "<generation>-<hash>":
+// each write of the record on a host takes the next generation, hashing
+// the previous revision with the new content, while copies received from
+// peers and replicators keep theirs. Revisions tell CouchDB and PouchDB
+// replicators which records they hold already.
+const RevField = "_rev"
+
+// Rev returns the record's revision, "" if it has none.
+func (fm *FileMetadata) Rev() string {
+	rev, _ := fm.Extra[RevField].(string)
+	return rev
+}
+
+// SetRev records rev on the record ("" removes it), copying Extra first so
+// that copies of the record sharing it are not changed.
+func (fm *FileMetadata) SetRev(rev string) {
+	extra := copyExtra(fm.Extra)
+	if extra == nil {
+		extra = make(map[string]interface{}, 1)
+	}
+	if rev == "" {
+		delete(extra, RevField)
+	} else {
+		extra[RevField] = rev
+	}
+	fm.Extra = extra
+}
+
+// NextRev returns the revision following prev ("" for none) for a write of
+// content.
+func NextRev(prev string, content []byte) string {
+	gen, _ := RevGeneration(prev)
+	h := md5.New()
+	h.Write([]byte(prev))
+	h.Write(content)
+	return fmt.Sprintf("%d-%x", gen+1, h.Sum(nil))
+}
+
+// RevGeneration splits a revision into its generation and hash; a
+// malformed revision is generation 0.
+func RevGeneration(rev string) (int, string) {
+	genText, hash, ok := strings.Cut(rev, "-")
+	gen, err := strconv.Atoi(genText)
+	if !ok || err != nil || gen < 0 {
+		return 0, rev
+	}
+	return gen, hash
+}
+
+// RevWins reports whether revision a wins over b as CouchDB picks between
+// conflicting revisions: the higher generation, then the greater hash.
+func RevWins(a, b string) bool {
+	ga, ha := RevGeneration(a)
+	gb, hb := RevGeneration(b)
+	if ga != gb {
+		return ga > gb
+	}
+	return ha > hb
+}
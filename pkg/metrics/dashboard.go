@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/theme"
+)
+
+// ------------------------
+// Status Dashboard
+// ------------------------
+
+// Status is what 'indexer status' shows of a running node: the metrics it
+// has from itself and its peers, and its view of the cluster.
+type Status struct {
+	URL     string                `json:"url"`
+	Peers   []PeerMetrics         `json:"peers"`
+	Cluster network.ClusterStatus `json:"cluster"`
+	Fetched time.Time             `json:"fetched"`
+}
+
+// FetchStatus fetches the status of the node serving at baseURL.
+func FetchStatus(baseURL string) (Status, error) {
+	st := Status{URL: baseURL, Fetched: time.Now()}
+	var err error
+	if st.Peers, err = FetchPeerMetrics(baseURL); err != nil {
+		return st, err
+	}
+	st.Cluster, err = network.FetchClusterStatus(baseURL)
+	return st, err
+}
+
+// statusRow is a node as the dashboard lists it: its metrics, its
+// membership, or both.
+type statusRow struct {
+	node    string
+	metrics *PeerMetrics
+	member  *network.MemberStatus
+}
+
+func statusRows(st Status) []statusRow {
+	var rows []statusRow
+	index := map[string]int{}
+	for i := range st.Peers {
+		index[st.Peers[i].Node] = len(rows)
+		rows = append(rows, statusRow{node: st.Peers[i].Node, metrics: &st.Peers[i]})
+	}
+	for i := range st.Cluster.Members {
+		m := &st.Cluster.Members[i]
+		if j, ok := index[m.Name]; ok {
+			rows[j].member = m
+			continue
+		}
+		rows = append(rows, statusRow{node: m.Name, member: m})
+	}
+	return rows
+}
+
+// RenderStatus renders a status as the dashboard shows it: a line per node
+// with its resource use, files indexed and replication lag, cluster totals,
+// then the nodes' recent errors.
+func RenderStatus(st Status) string {
+	var b strings.Builder
+	title := "dreamfs " + st.URL
+	if st.Cluster.Node != "" {
+		title = "dreamfs " + st.Cluster.Node + " (" + st.URL + ")"
+	}
+	fmt.Fprintf(&b, "%s  %s\n", theme.Primary.Render(title), theme.Info.Render("updated "+st.Fetched.Format(time.TimeOnly)))
+	switch {
+	case st.Cluster.Converged == nil:
+		b.WriteString(theme.Info.Render("Not running in a swarm") + "\n")
+	case *st.Cluster.Converged:
+		b.WriteString(theme.Success.Render("Swarm converged") + "\n")
+	default:
+		b.WriteString(theme.Warning.Render("Swarm not converged") + "\n")
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "%-32s  %-11s  %6s  %7s  %10s  %10s  %8s  %-10s  %s\n", "NODE", "STATE", "CPU%", "RAM GB", "READ MB/s", "WRITE MB/s", "FILES", "LAG", "HEARD")
+	var cpu, ram, read, write float64
+	var files, sampled int
+	for _, r := range statusRows(st) {
+		name := r.node
+		if r.metrics != nil && r.metrics.Self || r.member != nil && r.member.Self {
+			name += " (self)"
+		}
+		state, lag := "-", "-"
+		if r.member != nil {
+			state = r.member.State
+			if r.member.Lag > 0 {
+				lag = (time.Duration(r.member.Lag) * time.Second).String()
+			}
+		}
+		stateCell := fmt.Sprintf("%-11s", state)
+		switch state {
+		case network.MemberAlive:
+			stateCell = theme.Success.Render(stateCell)
+		case network.MemberSuspect:
+			stateCell = theme.Warning.Render(stateCell)
+		case "-":
+		default:
+			stateCell = theme.Error.Render(stateCell)
+		}
+		lagCell := fmt.Sprintf("%-10s", lag)
+		if r.member != nil && r.member.Lagging {
+			lagCell = theme.Error.Render(lagCell)
+		}
+		if r.metrics == nil {
+			fmt.Fprintf(&b, "%-32.32s  %s  %6s  %7s  %10s  %10s  %8s  %s  %s\n", name, stateCell, "-", "-", "-", "-", "-", lagCell, "never")
+			continue
+		}
+		m := r.metrics
+		heard := time.Since(m.Time).Truncate(time.Second).String() + " ago"
+		fmt.Fprintf(&b, "%-32.32s  %s  %6.1f  %7.1f  %10.1f  %10.1f  %8d  %s  %s\n", name, stateCell, m.CPU, m.MemoryGB, m.IOReadMB, m.IOWriteMB, m.FilesIndexed, lagCell, heard)
+		cpu += m.CPU
+		ram += m.MemoryGB
+		read += m.IOReadMB
+		write += m.IOWriteMB
+		files += m.FilesIndexed
+		sampled++
+	}
+	if sampled > 1 {
+		fmt.Fprintf(&b, "%-32s  %-11s  %6.1f  %7.1f  %10.1f  %10.1f  %8d\n", "CLUSTER TOTAL", "", cpu/float64(sampled), ram, read, write, files)
+	}
+
+	b.WriteString("\nRecent errors\n")
+	shown := 0
+	for _, m := range st.Peers {
+		for _, e := range m.Errors {
+			fmt.Fprintf(&b, "  %s  %s\n", m.Node, theme.Error.Render(e))
+			shown++
+		}
+	}
+	for _, p := range st.Cluster.Peers {
+		if p.LastError != "" {
+			fmt.Fprintf(&b, "  pull %s  %s\n", p.Peer, theme.Error.Render(p.LastError))
+			shown++
+		}
+	}
+	if shown == 0 {
+		b.WriteString("  " + theme.Success.Render("none") + "\n")
+	}
+	return b.String()
+}
+
+// dashboard is the bubbletea model of 'indexer status --watch'.
+type dashboard struct {
+	url      string
+	interval time.Duration
+	status   Status
+	fetched  bool
+	err      error
+}
+
+// statusMsg is the result of a fetch; tick is set for the periodic ones,
+// which schedule the next.
+type statusMsg struct {
+	status Status
+	err    error
+	tick   bool
+}
+
+type tickMsg struct{}
+
+func (m dashboard) fetch(tick bool) tea.Cmd {
+	return func() tea.Msg {
+		st, err := FetchStatus(m.url)
+		return statusMsg{status: st, err: err, tick: tick}
+	}
+}
+
+func (m dashboard) Init() tea.Cmd {
+	return m.fetch(true)
+}
+
+func (m dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return m, tea.Quit
+		case "r":
+			return m, m.fetch(false)
+		}
+	case statusMsg:
+		m.err = msg.err
+		if msg.err == nil {
+			m.status, m.fetched = msg.status, true
+		}
+		if msg.tick {
+			return m, tea.Tick(m.interval, func(time.Time) tea.Msg { return tickMsg{} })
+		}
+	case tickMsg:
+		return m, m.fetch(true)
+	}
+	return m, nil
+}
+
+func (m dashboard) View() string {
+	var b strings.Builder
+	if m.fetched {
+		b.WriteString(RenderStatus(m.status))
+	} else if m.err == nil {
+		b.WriteString(theme.Info.Render("Fetching status from "+m.url+"...") + "\n")
+	}
+	if m.err != nil {
+		b.WriteString("\n" + theme.Error.Render("Failed to fetch status: "+m.err.Error()) + "\n")
+	}
+	b.WriteString(theme.Info.Render(fmt.Sprintf("\nRefreshing every %s · r refresh · q quit", m.interval)) + "\n")
+	return b.String()
+}
+
+// RunDashboard shows the status of the node serving at baseURL, refreshed
+// every interval, until the user quits.
+func RunDashboard(baseURL string, interval time.Duration) error {
+	_, err := tea.NewProgram(dashboard{url: baseURL, interval: interval}, tea.WithAltScreen()).Run()
+	return err
+}
@@ -3,30 +3,68 @@ package metrics
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
-	"github.com/charmbracelet/bubbles/table"
-	"github.com/charmbracelet/lipgloss"
+	"github.com/fatih/color"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/mem"
 
+	"gnomatix/dreamfs/v2/pkg/alert"
 	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/utils"
 )
 
+// ------------------------
+// Peer Metrics
+// ------------------------
+
+// DefaultBroadcastInterval is how often 'indexer serve' samples its metrics
+// and gossips them to the swarm.
+const DefaultBroadcastInterval = 5 * time.Second
+
+// forgetAfter is how long the metrics of a node that stopped gossiping are
+// kept.
+const forgetAfter = 10 * time.Minute
+
+// maxErrors is how many of its latest alerts a node gossips, kept short to
+// fit a gossip message.
+const maxErrors = 3
+
+// PeerMetrics is a node's resource use as it last gossiped it.
 type PeerMetrics struct {
-	Host         string  `json:"host"`
-	IP           string  `json:"ip"`
-	CPU          float64 `json:"cpu"`
-	MemoryGB     float64 `json:"memory"`
-	IOReadMB     float64 `json:"io_read"`
-	IOWriteMB    float64 `json:"io_write"`
-	FilesIndexed int     `json:"files_indexed"`
+	Node         string    `json:"node,omitempty"` // Swarm node name
+	HostID       string    `json:"hostID,omitempty"`
+	Host         string    `json:"host"`
+	IP           string    `json:"ip"`
+	CPU          float64   `json:"cpu"`
+	MemoryGB     float64   `json:"memory"`
+	IOReadMB     float64   `json:"io_read"` // MB/s since the previous sample
+	IOWriteMB    float64   `json:"io_write"`
+	FilesIndexed int       `json:"files_indexed"`    // Since the node started
+	Errors       []string  `json:"errors,omitempty"` // Latest alerts, newest first
+	Time         time.Time `json:"time,omitzero"`    // When sampled, or for peers received
+	Self         bool      `json:"self,omitempty"`   // The node serving them
 }
 
-var peerMetrics = make(map[string]PeerMetrics)
+var peerMetrics = make(map[string]PeerMetrics) // By node name
 var peerMetricsMutex sync.Mutex
+var selfNode string
+
+func init() {
+	network.OnPeerMetrics(receivePeerMetrics)
+}
+
+// lastIO is the previous disk I/O sample, for rates.
+var lastIO struct {
+	sync.Mutex
+	read, write float64 // MB
+	at          time.Time
+}
 
 func CollectLocalMetrics(filesIndexed int) PeerMetrics {
 	cpuPercent, _ := cpu.Percent(0, false)
@@ -38,81 +76,165 @@ func CollectLocalMetrics(filesIndexed int) PeerMetrics {
 		ioRead += float64(io.ReadBytes) / (1024 * 1024)   // MB
 		ioWrite += float64(io.WriteBytes) / (1024 * 1024) // MB
 	}
+	now := time.Now()
+	var readRate, writeRate float64
+	lastIO.Lock()
+	if !lastIO.at.IsZero() {
+		if secs := now.Sub(lastIO.at).Seconds(); secs > 0 {
+			readRate, writeRate = max(ioRead-lastIO.read, 0)/secs, max(ioWrite-lastIO.write, 0)/secs
+		}
+	}
+	lastIO.read, lastIO.write, lastIO.at = ioRead, ioWrite, now
+	lastIO.Unlock()
 
 	host, _ := os.Hostname()
 	ip := network.GetLocalIP()
 
-	return PeerMetrics{
+	m := PeerMetrics{
+		HostID:       utils.HostID,
 		Host:         host,
 		IP:           ip,
-		CPU:          cpuPercent[0],
-		MemoryGB:     float64(memStats.Used) / (1024 * 1024 * 1024),
-		IOReadMB:     ioRead,
-		IOWriteMB:    ioWrite,
+		IOReadMB:     readRate,
+		IOWriteMB:    writeRate,
 		FilesIndexed: filesIndexed,
+		Time:         now,
+	}
+	if len(cpuPercent) > 0 {
+		m.CPU = cpuPercent[0]
 	}
+	if memStats != nil {
+		m.MemoryGB = float64(memStats.Used) / (1024 * 1024 * 1024)
+	}
+	for _, a := range alert.Recent(maxErrors) {
+		m.Errors = append(m.Errors, alertLine(a))
+	}
+	return m
 }
 
-// BroadcastPeerMetrics now takes a *network.SwarmDelegate
+// alertLine summarizes an alert for gossip; in privacy mode without its
+// subject and message, which may name paths.
+func alertLine(a alert.Alert) string {
+	if network.PrivacyEnabled() {
+		return fmt.Sprintf("%s %s %s", a.Time.Format(time.TimeOnly), a.Level, a.Kind)
+	}
+	line := fmt.Sprintf("%s %s %s: %s", a.Time.Format(time.TimeOnly), a.Kind, a.Subject, a.Message)
+	if len(line) > 120 {
+		line = line[:117] + "..."
+	}
+	return line
+}
+
+// masked returns m as peers and HTTP clients see it in privacy mode.
+func masked(m PeerMetrics) PeerMetrics {
+	m.Host = network.PrivateHost(m.Host)
+	m.IP = network.PrivateHost(m.IP)
+	return m
+}
+
+// BroadcastPeerMetrics samples this node's metrics, records them and, when
+// d is not nil, gossips them to the swarm.
 func BroadcastPeerMetrics(d *network.SwarmDelegate, filesIndexed int) {
 	metrics := CollectLocalMetrics(filesIndexed)
-	data, _ := json.Marshal(metrics)
+	if d != nil {
+		metrics.Node = d.NodeName()
+	}
+	if metrics.Node == "" {
+		metrics.Node = network.PrivateHost(metrics.Host) // As StartSwarm names nodes
+	}
 
 	peerMetricsMutex.Lock()
-	defer peerMetricsMutex.Unlock()
-	peerMetrics[metrics.IP] = metrics
+	selfNode = metrics.Node
+	peerMetrics[metrics.Node] = metrics
+	peerMetricsMutex.Unlock()
+
+	if d != nil {
+		// Peers get the host by hash in privacy mode; the local view keeps it
+		data, _ := json.Marshal(masked(metrics))
+		d.QueuePeerMetrics(data)
+	}
+}
 
-	// Use the broadcasts queue from the SwarmDelegate
-	d.Broadcasts.QueueBroadcast(&network.PeerMetaBroadcast{Msg: data})
+// RunBroadcasts samples and gossips this node's metrics every interval
+// until stop is closed (see BroadcastPeerMetrics).
+func RunBroadcasts(d *network.SwarmDelegate, interval time.Duration, stop <-chan struct{}) {
+	BroadcastPeerMetrics(d, int(network.FilesIndexed()))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			BroadcastPeerMetrics(d, int(network.FilesIndexed()))
+		}
+	}
 }
 
-func RenderPeerMetricsUI() {
+func receivePeerMetrics(data []byte) {
+	var m PeerMetrics
+	if err := json.Unmarshal(data, &m); err != nil {
+		return
+	}
+	if m.Node == "" {
+		m.Node = m.IP
+	}
+	m.Time, m.Self = time.Now(), false // Heard now, whatever the peer's clock says
 	peerMetricsMutex.Lock()
 	defer peerMetricsMutex.Unlock()
+	if m.Node != selfNode {
+		peerMetrics[m.Node] = m
+	}
+}
 
-	columns := []table.Column{
-		{Title: "Host", Width: 12},
-		{Title: "IP", Width: 15},
-		{Title: "CPU%", Width: 7},
-		{Title: "RAM GB", Width: 8},
-		{Title: "I/O RW", Width: 12},
-		{Title: "Files Indexed", Width: 15},
-	}
-
-	var rows []table.Row
-	var totalCPU, totalMemory, totalIORead, totalIOWrite float64
-	var totalFiles int
-
-	for _, peer := range peerMetrics {
-	
-rows = append(rows, table.Row{
-			peer.Host, peer.IP,
-			fmt.Sprintf("%.1f", peer.CPU),
-			fmt.Sprintf("%.1f", peer.MemoryGB),
-			fmt.Sprintf("%.1fMB/s", peer.IOReadMB+peer.IOWriteMB),
-			fmt.Sprintf("%d", peer.FilesIndexed),
-		})
-
-		totalCPU += peer.CPU
-		totalMemory += peer.MemoryGB
-		totalIORead += peer.IOReadMB
-		totalIOWrite += peer.IOWriteMB
-		totalFiles += peer.FilesIndexed
-	}
-
-
-rows = append(rows, table.Row{
-		"CLUSTER TOTAL", "",
-		fmt.Sprintf("%.1f", totalCPU/float64(len(peerMetrics))),
-		fmt.Sprintf("%.1f", totalMemory),
-		fmt.Sprintf("%.1fMB/s", totalIORead+totalIOWrite),
-		fmt.Sprintf("%d", totalFiles),
+// Snapshot returns the latest metrics of this node (first) and of the nodes
+// heard from in the last forgetAfter.
+func Snapshot() []PeerMetrics {
+	peerMetricsMutex.Lock()
+	defer peerMetricsMutex.Unlock()
+	out := make([]PeerMetrics, 0, len(peerMetrics))
+	for node, m := range peerMetrics {
+		if node != selfNode && time.Since(m.Time) > forgetAfter {
+			delete(peerMetrics, node)
+			continue
+		}
+		m.Self = node == selfNode
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Self != out[j].Self {
+			return out[i].Self
+		}
+		return out[i].Node < out[j].Node
 	})
+	return out
+}
 
-	t := table.New()      // Fix: table.New() takes no arguments
-	t.SetColumns(columns) // Fix: Set columns using SetColumns()
-	t.SetRows(rows)
+// HandlePeerMetrics serves the metrics of this node and its peers (see
+// Snapshot), with this node's host masked in privacy mode.
+func HandlePeerMetrics(w http.ResponseWriter, r *http.Request) {
+	peers := Snapshot()
+	for i := range peers {
+		if peers[i].Self && network.PrivacyEnabled() {
+			peers[i] = masked(peers[i])
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(peers); err != nil {
+		color.Red("failed to encode peer metrics: %v", err)
+	}
+}
 
-	fmt.Println(lipgloss.NewStyle().Bold(true).Render("\nPEER STATUS"))
-	fmt.Println(t.View()) // Fix: Use t.View() instead of t.Render()
-}
\ No newline at end of file
+// FetchPeerMetrics returns the peer metrics served by the node at baseURL.
+func FetchPeerMetrics(baseURL string) ([]PeerMetrics, error) {
+	var peers []PeerMetrics
+	resp, err := network.PeerClient(10 * time.Second).Get(baseURL + "/peer-metrics")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s/peer-metrics: %s", baseURL, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&peers)
+	return peers, err
+}
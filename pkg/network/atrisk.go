@@ -0,0 +1,108 @@
+package network
+
+import (
+	"sort"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Single-Copy Content for Backup Planning
+// ------------------------
+
+// AtRiskFile is a file whose content no other live host holds.
+type AtRiskFile struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"modTime"`
+	BLAKE3  string `json:"blake3"`
+	// Hosts that are not live but held the content when last seen
+	DownCopies []string `json:"downCopies,omitempty"`
+}
+
+// HostRisk is what would be lost with one host.
+type HostRisk struct {
+	HostID      string       `json:"hostID"`
+	Live        bool         `json:"live"`
+	Files       int          `json:"files"` // Files with content, at risk or not
+	Bytes       int64        `json:"bytes"`
+	AtRiskFiles int          `json:"atRiskFiles"`
+	AtRiskBytes int64        `json:"atRiskBytes"`
+	AtRisk      []AtRiskFile `json:"atRisk,omitempty"` // Largest first
+}
+
+// AtRisk finds, for each host, the files whose content (by BLAKE3
+// fingerprint) no other live host holds, so would be lost if that host
+// died. Copies on hosts that are not live do not count, but are noted.
+// Several paths with the same content on one host are one copy, and each is
+// listed. Empty files are left out. Hosts come most bytes at risk first,
+// their files largest first.
+func AtRisk(latest []metadata.FileMetadata, live func(hostID string) bool) []HostRisk {
+	holders := map[string]map[string]bool{} // blake3 -> hosts
+	for _, meta := range latest {
+		if meta.BLAKE3 == "" || meta.Size == 0 {
+			continue
+		}
+		if holders[meta.BLAKE3] == nil {
+			holders[meta.BLAKE3] = map[string]bool{}
+		}
+		holders[meta.BLAKE3][meta.HostID] = true
+	}
+
+	hosts := map[string]*HostRisk{}
+	for _, meta := range latest {
+		if meta.BLAKE3 == "" || meta.Size == 0 {
+			continue
+		}
+		h, ok := hosts[meta.HostID]
+		if !ok {
+			h = &HostRisk{HostID: meta.HostID, Live: live(meta.HostID)}
+			hosts[meta.HostID] = h
+		}
+		h.Files++
+		h.Bytes += meta.Size
+		var down []string
+		safe := false
+		for other := range holders[meta.BLAKE3] {
+			if other == meta.HostID {
+				continue
+			}
+			if live(other) {
+				safe = true
+				break
+			}
+			down = append(down, other)
+		}
+		if safe {
+			continue
+		}
+		sort.Strings(down)
+		h.AtRiskFiles++
+		h.AtRiskBytes += meta.Size
+		h.AtRisk = append(h.AtRisk, AtRiskFile{
+			Path:       meta.FilePath,
+			Size:       meta.Size,
+			ModTime:    meta.ModTime,
+			BLAKE3:     meta.BLAKE3,
+			DownCopies: down,
+		})
+	}
+
+	risks := make([]HostRisk, 0, len(hosts))
+	for _, h := range hosts {
+		sort.Slice(h.AtRisk, func(i, j int) bool {
+			if h.AtRisk[i].Size != h.AtRisk[j].Size {
+				return h.AtRisk[i].Size > h.AtRisk[j].Size
+			}
+			return h.AtRisk[i].Path < h.AtRisk[j].Path
+		})
+		risks = append(risks, *h)
+	}
+	sort.Slice(risks, func(i, j int) bool {
+		if risks[i].AtRiskBytes != risks[j].AtRiskBytes {
+			return risks[i].AtRiskBytes > risks[j].AtRiskBytes
+		}
+		return risks[i].HostID < risks[j].HostID
+	})
+	return risks
+}
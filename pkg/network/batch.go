@@ -0,0 +1,157 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Broadcast Batching
+// ------------------------
+
+// batchMsgPrefix starts a batch of records: the JSON array of them,
+// compressed with zstd. Single records are broadcast as plain JSON objects
+// when they fit a gossip packet, and as batches of one otherwise. Records
+// that do not fit either way are not broadcast; peers get them from this
+// node's /_sync on their next push/pull (see sync.go).
+var batchMsgPrefix = []byte("batch ")
+
+// Batching defaults: records per batch, and how long the first record of a
+// batch waits for others.
+const (
+	DefaultBroadcastBatch     = 64
+	DefaultBroadcastBatchWait = 200 * time.Millisecond
+)
+
+const (
+	// batchSlack is kept free of a gossip packet for memberlist's framing
+	// and the join token tag.
+	batchSlack = 200
+	// batchMaxInflated bounds what a received batch may inflate to.
+	batchMaxInflated = 16 << 20
+)
+
+// broadcastBatcher coalesces the records QueueMetadata is given into
+// batches of up to size records, or what arrived within wait of the first,
+// compressed and split to fit a gossip packet of maxBytes.
+type broadcastBatcher struct {
+	size     int // 1 or less broadcasts each record on its own
+	wait     time.Duration
+	maxBytes int
+
+	mu      sync.Mutex
+	pending []json.RawMessage
+	timer   *time.Timer
+}
+
+// add queues a sealed record, flushing when the batch is full.
+func (b *broadcastBatcher) add(d *SwarmDelegate, data []byte) {
+	if b.size <= 1 {
+		for _, msg := range encodeBatches([]json.RawMessage{data}, b.maxBytes) {
+			d.Broadcasts.QueueBroadcast(&FileMetaBroadcast{Msg: msg})
+		}
+		return
+	}
+	b.mu.Lock()
+	b.pending = append(b.pending, data)
+	if len(b.pending) < b.size {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.wait, func() { b.flush(d) })
+		}
+		b.mu.Unlock()
+		return
+	}
+	b.mu.Unlock()
+	b.flush(d)
+}
+
+// flush queues the pending records as broadcasts.
+func (b *broadcastBatcher) flush(d *SwarmDelegate) {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+	for _, msg := range encodeBatches(pending, b.maxBytes) {
+		d.Broadcasts.QueueBroadcast(&FileMetaBroadcast{Msg: msg})
+	}
+}
+
+// encodeBatches encodes records as batch messages of at most maxBytes,
+// halving runs of them that compress past it. A record that fits on its
+// own is sent as a plain one; records too large even compressed are
+// dropped, left to range sync.
+func encodeBatches(records []json.RawMessage, maxBytes int) [][]byte {
+	switch len(records) {
+	case 0:
+		return nil
+	case 1:
+		if maxBytes <= 0 || len(records[0]) <= maxBytes {
+			return [][]byte{records[0]}
+		}
+		if msg, err := encodeBatch(records); err == nil && len(msg) <= maxBytes {
+			return [][]byte{msg}
+		}
+		log.Printf("Swarm: a record of %d bytes exceeds the gossip packet budget of %d; peers receive it through sync", len(records[0]), maxBytes)
+		return nil
+	}
+	msg, err := encodeBatch(records)
+	if err == nil && (maxBytes <= 0 || len(msg) <= maxBytes) {
+		return [][]byte{msg}
+	}
+	if err != nil {
+		log.Printf("Swarm: failed to encode a batch of %d records: %v", len(records), err)
+	}
+	half := len(records) / 2
+	return append(encodeBatches(records[:half], maxBytes), encodeBatches(records[half:], maxBytes)...)
+}
+
+func encodeBatch(records []json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+	return batchEncoder().EncodeAll(data, append([]byte(nil), batchMsgPrefix...)), nil
+}
+
+// The zstd encoder and decoder are safe for concurrent EncodeAll and
+// DecodeAll calls, so one of each serves every batch.
+var (
+	batchEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		return enc
+	})
+	batchDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(batchMaxInflated))
+		return dec
+	})
+)
+
+// decodeBatch returns the records of a batch message.
+func decodeBatch(msg []byte) ([]metadata.FileMetadata, error) {
+	data, err := batchDecoder().DecodeAll(msg[len(batchMsgPrefix):], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	var metas []metadata.FileMetadata
+	if err := json.Unmarshal(data, &metas); err != nil {
+		return nil, err
+	}
+	return metas, nil
+}
+
+// FlushBroadcasts queues the records waiting to be batched now, e.g.
+// before waiting for the broadcast queue to drain.
+func (d *SwarmDelegate) FlushBroadcasts() {
+	d.batches.flush(d)
+}
@@ -0,0 +1,148 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Content Location and Blob Transfer
+// ------------------------
+
+// Locate returns the files whose current revision holds the content with the
+// given BLAKE3 fingerprint, on every host known to the store. This host's
+// files come first; the others are sorted by host, then path.
+func Locate(ps *storage.PersistentStore, fingerprint string) ([]metadata.FileMetadata, error) {
+	found, err := ps.Find(map[string]string{"blake3": fingerprint})
+	if err != nil {
+		return nil, err
+	}
+	var current []metadata.FileMetadata
+	for _, meta := range found {
+		latest, ok, err := ps.LatestFor(meta.HostID, meta.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		// Revisions since replaced by other content (or deleted) do not count
+		if ok && latest.ID == meta.ID {
+			current = append(current, meta)
+		}
+	}
+	sort.Slice(current, func(i, j int) bool {
+		a, b := current[i], current[j]
+		if (a.HostID == utils.HostID) != (b.HostID == utils.HostID) {
+			return a.HostID == utils.HostID
+		}
+		if a.HostID != b.HostID {
+			return a.HostID < b.HostID
+		}
+		return a.FilePath < b.FilePath
+	})
+	return current, nil
+}
+
+// LocalCopy returns the first of this host's located files that still has
+// its indexed size, or "" if there is none. Content is not re-hashed.
+func LocalCopy(located []metadata.FileMetadata) string {
+	for _, meta := range located {
+		if meta.HostID != utils.HostID {
+			continue
+		}
+		if info, err := os.Stat(meta.FilePath); err == nil && info.Mode().IsRegular() && info.Size() == meta.Size {
+			return meta.FilePath
+		}
+	}
+	return ""
+}
+
+// HandleBlob serves GET /blob/<fingerprint> from a local copy of the content,
+// for peers resolving dreamfs:// links. Only files this host indexed are
+// served.
+func HandleBlob(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	fingerprint := strings.TrimPrefix(r.URL.Path, "/blob/")
+	if fingerprint == "" || strings.Contains(fingerprint, "/") {
+		http.Error(w, "GET /blob/<fingerprint>", http.StatusBadRequest)
+		return
+	}
+	located, err := Locate(ps, fingerprint)
+	if err != nil {
+		http.Error(w, "failed to locate content", http.StatusInternalServerError)
+		return
+	}
+	path := LocalCopy(located)
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "failed to open content", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "failed to open content", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filepath.Base(path)))
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), f)
+}
+
+// ErrBlobMismatch is returned by FetchBlob for content that does not match
+// the fingerprint asked for.
+var ErrBlobMismatch = errors.New("content does not match the fingerprint")
+
+// FetchBlob downloads the content with the given fingerprint from a peer's
+// /blob endpoint (e.g. http://nas:8080) to dest. The download replaces dest
+// only if verify accepts it, hashing it as the record of the content was
+// (see fileprocessor.MatchesRecord); otherwise it is deleted and
+// ErrBlobMismatch returned. A peer without the content yields
+// os.ErrNotExist.
+func FetchBlob(peer, fingerprint, dest string, verify func(path string) (bool, error)) error {
+	u := strings.TrimSuffix(peer, "/") + "/blob/" + fingerprint
+	resp, err := peerClient(0).Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return os.ErrNotExist
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, u)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".fetch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("download %s: %w", u, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	ok, err := verify(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("verify download from %s: %w", u, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", u, ErrBlobMismatch)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
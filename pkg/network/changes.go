@@ -0,0 +1,194 @@
+package network
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fatih/color"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// CouchDB-style Changes Feed
+// ------------------------
+
+// Defaults for waiting feeds, in the manner of CouchDB, and the largest
+// page served at once; clients page on with since=last_seq while pending
+// is non-zero.
+const (
+	changesTimeout   = 60 * time.Second
+	changesHeartbeat = 60 * time.Second
+	changesMaxLimit  = 10000
+)
+
+// changeRow is a row of the changes feed, as CouchDB formats it.
+type changeRow struct {
+	Seq     uint64                 `json:"seq"`
+	ID      string                 `json:"id"`
+	Changes []map[string]string    `json:"changes"`
+	Deleted bool                   `json:"deleted,omitempty"`
+	Doc     *metadata.FileMetadata `json:"doc,omitempty"`
+}
+
+// HandleChanges serves GET /_changes with the CouchDB parameters:
+//
+//	since=N|now        only changes after sequence N (default 0)
+//	limit=N            at most N rows (and never more than 10000 at once)
+//	include_docs=true  include each current record (sealed with the realm)
+//	feed=normal        {"results": [...], "last_seq": N} (default)
+//	feed=longpoll      as normal, but wait for a change if there is none
+//	feed=continuous    one row per line as changes happen, then {"last_seq": N}
+//	timeout=ms         how long longpoll and continuous feeds wait (default 60000;
+//	                   they also end when the server shuts down)
+//	heartbeat=ms       newline keep-alives for the continuous feed (default 60000)
+//
+// Each record appears once, at the sequence of its latest write or deletion.
+func HandleChanges(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	q := r.URL.Query()
+	var since uint64
+	if s := q.Get("since"); s == "now" {
+		seq, err := ps.UpdateSeq()
+		if err != nil {
+			http.Error(w, "failed to read changes", http.StatusInternalServerError)
+			return
+		}
+		since = seq
+	} else if s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid since: "+s, http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+	limit, err := queryInt(q.Get("limit"), 0) // 0: no limit
+	if err != nil || limit < 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	timeoutMS, err := queryInt(q.Get("timeout"), int(changesTimeout/time.Millisecond))
+	if err != nil {
+		http.Error(w, "invalid timeout", http.StatusBadRequest)
+		return
+	}
+	heartbeatMS := int(changesHeartbeat / time.Millisecond)
+	if hb := q.Get("heartbeat"); hb != "" && hb != "true" {
+		if heartbeatMS, err = queryInt(hb, 0); err != nil || heartbeatMS <= 0 {
+			http.Error(w, "invalid heartbeat", http.StatusBadRequest)
+			return
+		}
+	}
+	includeDocs := q.Get("include_docs") == "true"
+	timeout := time.After(time.Duration(timeoutMS) * time.Millisecond)
+
+	read := func() ([]changeRow, uint64, int, error) {
+		page := changesMaxLimit
+		if limit > 0 {
+			page = min(limit, changesMaxLimit)
+		}
+		changes, lastSeq, pending, err := ps.Changes(since, page, includeDocs)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		rows := make([]changeRow, 0, len(changes))
+		for _, ch := range changes {
+			row := changeRow{Seq: ch.Seq, ID: ch.ID, Changes: []map[string]string{{"rev": ch.Rev}}, Deleted: ch.Deleted}
+			if ch.Doc != nil {
+				sealed, err := ps.Realm().Seal(*ch.Doc)
+				if err != nil {
+					return nil, 0, 0, err
+				}
+				row.Doc = &sealed
+			}
+			rows = append(rows, row)
+		}
+		return rows, lastSeq, pending, nil
+	}
+
+	switch feed := q.Get("feed"); feed {
+	case "", "normal", "longpoll":
+		notify := ps.ChangesNotify() // Taken before reading, so no change is missed
+		rows, lastSeq, pending, err := read()
+		if err == nil && len(rows) == 0 && feed == "longpoll" {
+			select {
+			case <-notify:
+				rows, lastSeq, pending, err = read()
+			case <-timeout:
+			case <-shuttingDown():
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if err != nil {
+			http.Error(w, "failed to read changes", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"results": rows, "last_seq": lastSeq, "pending": pending}); err != nil {
+			color.Red("failed to encode changes: %v", err)
+		}
+	case "continuous":
+		w.Header().Set("Content-Type", "application/json")
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		heartbeat := time.NewTicker(time.Duration(heartbeatMS) * time.Millisecond)
+		defer heartbeat.Stop()
+		for {
+			notify := ps.ChangesNotify()
+			rows, lastSeq, pending, err := read()
+			if err != nil {
+				color.Red("failed to read changes: %v", err)
+				return
+			}
+			for _, row := range rows {
+				if err := enc.Encode(row); err != nil {
+					return
+				}
+			}
+			since = lastSeq
+			if flusher != nil {
+				flusher.Flush()
+			}
+			if limit > 0 {
+				if limit -= len(rows); limit <= 0 {
+					enc.Encode(map[string]uint64{"last_seq": since})
+					return
+				}
+			}
+			if pending > 0 {
+				continue // Send the backlog in pages before waiting
+			}
+			select {
+			case <-notify:
+				continue
+			case <-heartbeat.C:
+				w.Write([]byte("\n"))
+				if flusher != nil {
+					flusher.Flush()
+				}
+			case <-timeout:
+				enc.Encode(map[string]uint64{"last_seq": since})
+				return
+			case <-shuttingDown():
+				enc.Encode(map[string]uint64{"last_seq": since})
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		http.Error(w, "unsupported feed: "+feed, http.StatusBadRequest)
+	}
+}
+
+// queryInt parses an optional integer query parameter.
+func queryInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
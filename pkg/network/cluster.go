@@ -0,0 +1,196 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/memberlist"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Cluster Status and Topology
+// ------------------------
+
+// Member states, as memberlist reports them, and for known peers (see
+// rejoin.go) that are not members now.
+const (
+	MemberAlive       = "alive"
+	MemberSuspect     = "suspect" // Failing probes; declared dead unless it answers
+	MemberDead        = "dead"
+	MemberLeft        = "left"
+	MemberUnreachable = "unreachable" // A known peer that is not a member
+)
+
+// localSwarm is the swarm this process runs, if any, for /cluster.
+var localSwarm atomic.Pointer[SwarmDelegate]
+
+// MemberStatus is one swarm node as this node sees it.
+type MemberStatus struct {
+	Name     string    `json:"name"`
+	Addr     string    `json:"addr"`
+	HostID   string    `json:"hostID,omitempty"`
+	State    string    `json:"state"`
+	Self     bool      `json:"self,omitempty"`
+	LastSeen time.Time `json:"lastSeen,omitzero"` // Now for live members
+	// Records is the number of records the node held at the last digest
+	// exchange with it, when InSync compared its digest with this node's.
+	Records *int      `json:"records,omitempty"`
+	InSync  bool      `json:"inSync"`
+	Checked time.Time `json:"checked,omitzero"`
+	Lag     float64   `json:"lagSeconds"` // Seconds since its records were last merged (0 if never)
+	Lagging bool      `json:"lagging"`
+}
+
+// ClusterStatus is this node's view of the cluster. Members and Converged
+// are only set when the node runs in the swarm; it is converged when every
+// other member is alive and its last digest matched this node's.
+type ClusterStatus struct {
+	HostID          string                 `json:"hostID"`
+	Node            string                 `json:"node,omitempty"`
+	Records         int                    `json:"records"`
+	LagAlertSeconds float64                `json:"lagAlertSeconds"`
+	Members         []MemberStatus         `json:"members,omitempty"`
+	Converged       *bool                  `json:"converged,omitempty"`
+	Peers           []PeerLag              `json:"peers"` // Replication lag by peer, swarm and pulled
+	Digests         map[string]DigestCheck `json:"digests"`
+}
+
+// memberState names a memberlist node state.
+func memberState(s memberlist.NodeStateType) string {
+	switch s {
+	case memberlist.StateAlive:
+		return MemberAlive
+	case memberlist.StateSuspect:
+		return MemberSuspect
+	case memberlist.StateDead:
+		return MemberDead
+	}
+	return MemberLeft
+}
+
+// CollectClusterStatus gathers this node's view of the cluster: its swarm
+// members and known peers, their record counts and digest agreement, and the
+// replication lag per peer.
+func CollectClusterStatus(ps *storage.PersistentStore) (ClusterStatus, error) {
+	st := ClusterStatus{HostID: utils.HostID, LagAlertSeconds: LagThreshold().Seconds(), Digests: DigestChecks()}
+	var err error
+	if st.Records, err = ps.Count(); err != nil {
+		return st, err
+	}
+	if st.Peers, err = CollectPeerLag(ps); err != nil {
+		return st, err
+	}
+	if st.Peers == nil {
+		st.Peers = []PeerLag{}
+	}
+	st.Peers = privatePeerLag(st.Peers)
+	d := localSwarm.Load()
+	if d == nil {
+		return st, nil
+	}
+	lags := map[string]PeerLag{}
+	for _, p := range st.Peers {
+		if p.Via == ViaSwarm {
+			lags[p.Peer] = p
+		}
+	}
+	known, err := ps.KnownPeers()
+	if err != nil {
+		return st, err
+	}
+	now := time.Now()
+	self := d.ml.LocalNode().Name
+	st.Node = self
+	converged := true
+	seen := map[string]bool{}
+	for _, n := range d.ml.Members() {
+		m := MemberStatus{Name: n.Name, Addr: n.Address(), State: memberState(n.State), Self: n.Name == self}
+		var meta nodeMeta
+		if json.Unmarshal(n.Meta, &meta) == nil {
+			m.HostID = meta.HostID
+		}
+		if m.State == MemberAlive {
+			m.LastSeen = now
+		}
+		if m.Self {
+			records := st.Records
+			m.Records, m.InSync, m.Checked = &records, true, now
+		} else if dc, ok := st.Digests[m.HostID]; ok && m.HostID != "" {
+			records := dc.Records
+			m.Records, m.InSync, m.Checked = &records, dc.InSync, dc.Checked
+		}
+		if lag, ok := lags[m.HostID]; ok && m.HostID != "" {
+			m.Lag, m.Lagging = lag.Lag, lag.Lagging
+		}
+		converged = converged && (m.Self || m.State == MemberAlive && m.InSync)
+		seen[n.Address()] = true
+		st.Members = append(st.Members, m)
+	}
+	for _, p := range known {
+		if seen[p.Addr] {
+			continue
+		}
+		st.Members = append(st.Members, MemberStatus{Name: p.Name, Addr: p.Addr, State: MemberUnreachable, LastSeen: p.LastSeen})
+	}
+	for i := range st.Members {
+		m := &st.Members[i]
+		if m.LastSeen.IsZero() {
+			for _, p := range known {
+				if p.Addr == m.Addr {
+					m.LastSeen = p.LastSeen
+				}
+			}
+		}
+		if PrivacyEnabled() {
+			if host, port, err := net.SplitHostPort(m.Addr); err == nil {
+				m.Addr = net.JoinHostPort(PrivateHost(host), port)
+			}
+		}
+	}
+	sort.SliceStable(st.Members, func(i, j int) bool {
+		if st.Members[i].Self != st.Members[j].Self {
+			return st.Members[i].Self
+		}
+		return st.Members[i].Name < st.Members[j].Name
+	})
+	st.Converged = &converged
+	return st, nil
+}
+
+// HandleCluster serves this node's view of the cluster (see ClusterStatus).
+func HandleCluster(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	st, err := CollectClusterStatus(ps)
+	if err != nil {
+		http.Error(w, "failed to collect cluster status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		color.Red("failed to encode cluster status: %v", err)
+	}
+}
+
+// FetchClusterStatus returns the cluster status served by the node at
+// baseURL.
+func FetchClusterStatus(baseURL string) (ClusterStatus, error) {
+	var st ClusterStatus
+	resp, err := peerClient(0).Get(baseURL + "/cluster")
+	if err != nil {
+		return st, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return st, fmt.Errorf("%s/cluster: %s", baseURL, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&st)
+	return st, err
+}
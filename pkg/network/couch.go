@@ -0,0 +1,307 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// CouchDB Documents and Replication Endpoints
+// ------------------------
+
+// With /_changes and /_bulk_docs, these endpoints let CouchDB and PouchDB
+// replicate with the store as a database at the server's root: records are
+// documents whose _rev is kept as storage.Edit and storage.Merge describe.
+// Only the current revision of a record is kept, so a revision history
+// (_revisions) holds just that one.
+
+// couchDBName is the database name reported to CouchDB clients.
+const couchDBName = "dreamfs"
+
+// couchError writes an error as CouchDB does.
+func couchError(w http.ResponseWriter, status int, name, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": name, "reason": reason})
+}
+
+func writeCouchJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		color.Red("failed to encode response: %v", err)
+	}
+}
+
+// couchDoc seals a record for a client, adding its revision history with
+// revs.
+func couchDoc(ps *storage.PersistentStore, meta metadata.FileMetadata, revs bool) (metadata.FileMetadata, error) {
+	sealed, err := ps.Realm().Seal(meta)
+	if err != nil {
+		return sealed, err
+	}
+	if revs {
+		gen, hash := metadata.RevGeneration(meta.Rev())
+		extra := make(map[string]interface{}, len(sealed.Extra)+1)
+		for k, v := range sealed.Extra {
+			extra[k] = v
+		}
+		extra["_revisions"] = map[string]interface{}{"start": gen, "ids": []string{hash}}
+		sealed.Extra = extra
+	}
+	return sealed, nil
+}
+
+// clientDoc strips what CouchDB clients send along with a document but is
+// not part of it.
+func clientDoc(meta metadata.FileMetadata) metadata.FileMetadata {
+	if _, ok := meta.Extra["_revisions"]; ok {
+		extra := make(map[string]interface{}, len(meta.Extra))
+		for k, v := range meta.Extra {
+			if k != "_revisions" {
+				extra[k] = v
+			}
+		}
+		meta.Extra = extra
+	}
+	return meta
+}
+
+// isDeletion reports whether a client's document marks a deletion.
+func isDeletion(meta metadata.FileMetadata) bool {
+	deleted, _ := meta.Extra["_deleted"].(bool)
+	return deleted
+}
+
+// HandleDBInfo serves GET / as CouchDB's database information, which
+// replicators read first.
+func HandleDBInfo(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	if r.URL.Path != "/" {
+		couchError(w, http.StatusNotFound, "not_found", "missing")
+		return
+	}
+	seq, err := ps.UpdateSeq()
+	if err != nil {
+		couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+		return
+	}
+	writeCouchJSON(w, http.StatusOK, map[string]interface{}{
+		"db_name":             couchDBName,
+		"update_seq":          strconv.FormatUint(seq, 10),
+		"instance_start_time": "0",
+	})
+}
+
+// HandleDoc serves a record as a CouchDB document at /doc/<id>:
+//
+//	GET     the record with its _rev (and ETag); ?revs=true adds _revisions,
+//	        and ?rev= answers 404 unless it is the current revision
+//	PUT     an edit of the revision in the body's _rev (or ?rev=, or
+//	        If-Match), or a new record without one; 409 if not current
+//	DELETE  deletes the record from this store, given its current ?rev=
+func HandleDoc(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	id := strings.TrimPrefix(r.URL.Path, "/doc/")
+	if id == "" || strings.Contains(id, "/") {
+		couchError(w, http.StatusBadRequest, "bad_request", "use /doc/<id>")
+		return
+	}
+	q := r.URL.Query()
+	rev := q.Get("rev")
+	if rev == "" {
+		rev = strings.Trim(r.Header.Get("If-Match"), `"`)
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		meta, found, err := ps.Doc(id)
+		if err != nil {
+			couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+			return
+		}
+		if !found || (rev != "" && rev != meta.Rev()) {
+			couchError(w, http.StatusNotFound, "not_found", "missing")
+			return
+		}
+		etag := `"` + meta.Rev() + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		doc, err := couchDoc(ps, meta, q.Get("revs") == "true")
+		if err != nil {
+			couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+			return
+		}
+		writeCouchJSON(w, http.StatusOK, doc)
+	case http.MethodPut:
+		var meta metadata.FileMetadata
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+			couchError(w, http.StatusBadRequest, "bad_request", "invalid document: "+err.Error())
+			return
+		}
+		if meta.ID == "" {
+			meta.ID = id
+		}
+		if meta.ID != id {
+			couchError(w, http.StatusBadRequest, "bad_request", "_id does not match the URL")
+			return
+		}
+		if bodyRev := meta.Rev(); bodyRev != "" {
+			rev = bodyRev
+		}
+		if isDeletion(meta) {
+			deleteDoc(w, ps, id, rev)
+			return
+		}
+		stored, err := ps.Edit(clientDoc(meta), rev)
+		if errors.Is(err, storage.ErrRevConflict) {
+			couchError(w, http.StatusConflict, "conflict", "Document update conflict.")
+			return
+		}
+		if err != nil {
+			couchError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		w.Header().Set("ETag", `"`+stored.Rev()+`"`)
+		writeCouchJSON(w, http.StatusCreated, map[string]interface{}{"ok": true, "id": id, "rev": stored.Rev()})
+	case http.MethodDelete:
+		deleteDoc(w, ps, id, rev)
+	default:
+		couchError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use GET, PUT or DELETE")
+	}
+}
+
+func deleteDoc(w http.ResponseWriter, ps *storage.PersistentStore, id, rev string) {
+	deleted, err := ps.DeleteRev(id, rev)
+	if errors.Is(err, storage.ErrRevConflict) {
+		couchError(w, http.StatusConflict, "conflict", "Document update conflict.")
+		return
+	}
+	if err != nil {
+		couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+		return
+	}
+	writeCouchJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "id": id, "rev": deleted})
+}
+
+// HandleLocalDoc serves /_local/<id>: documents kept on this node only,
+// where replicators record their checkpoints.
+func HandleLocalDoc(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	id := strings.TrimPrefix(r.URL.Path, "/_local/")
+	if id == "" {
+		couchError(w, http.StatusBadRequest, "bad_request", "use /_local/<id>")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		doc, found, err := ps.LocalDoc(id)
+		if err != nil {
+			couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+			return
+		}
+		if !found {
+			couchError(w, http.StatusNotFound, "not_found", "missing")
+			return
+		}
+		writeCouchJSON(w, http.StatusOK, doc)
+	case http.MethodPut:
+		var doc map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc == nil {
+			couchError(w, http.StatusBadRequest, "bad_request", "invalid document")
+			return
+		}
+		doc["_id"] = "_local/" + id
+		rev, err := ps.PutLocalDoc(id, doc)
+		if err != nil {
+			couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+			return
+		}
+		writeCouchJSON(w, http.StatusCreated, map[string]interface{}{"ok": true, "id": "_local/" + id, "rev": rev})
+	default:
+		couchError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use GET or PUT")
+	}
+}
+
+// HandleRevsDiff serves POST /_revs_diff: given revisions of records by ID,
+// it answers those this store does not hold, which a replicator then sends.
+func HandleRevsDiff(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	if r.Method != http.MethodPost {
+		couchError(w, http.StatusMethodNotAllowed, "method_not_allowed", "POST revisions by ID")
+		return
+	}
+	var req map[string][]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		couchError(w, http.StatusBadRequest, "bad_request", "invalid body: "+err.Error())
+		return
+	}
+	diff := map[string]map[string][]string{}
+	for id, revs := range req {
+		meta, found, err := ps.Doc(id)
+		if err != nil {
+			couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+			return
+		}
+		var missing []string
+		for _, rev := range revs {
+			if !found || rev != meta.Rev() {
+				missing = append(missing, rev)
+			}
+		}
+		if len(missing) > 0 {
+			diff[id] = map[string][]string{"missing": missing}
+		}
+	}
+	writeCouchJSON(w, http.StatusOK, diff)
+}
+
+// HandleBulkGet serves POST /_bulk_get ({"docs": [{"id": ..., "rev": ...}]}),
+// through which replicators fetch the records they miss, with _revisions.
+func HandleBulkGet(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	if r.Method != http.MethodPost {
+		couchError(w, http.StatusMethodNotAllowed, "method_not_allowed", "POST a JSON body with docs")
+		return
+	}
+	var req struct {
+		Docs []struct {
+			ID  string `json:"id"`
+			Rev string `json:"rev"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		couchError(w, http.StatusBadRequest, "bad_request", "invalid body: "+err.Error())
+		return
+	}
+	type result struct {
+		ID   string                   `json:"id"`
+		Docs []map[string]interface{} `json:"docs"`
+	}
+	results := make([]result, 0, len(req.Docs))
+	for _, d := range req.Docs {
+		res := result{ID: d.ID}
+		meta, found, err := ps.Doc(d.ID)
+		switch {
+		case err != nil:
+			couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+			return
+		case !found || (d.Rev != "" && d.Rev != meta.Rev()):
+			res.Docs = append(res.Docs, map[string]interface{}{"error": map[string]string{"id": d.ID, "rev": d.Rev, "error": "not_found", "reason": "missing"}})
+		default:
+			doc, err := couchDoc(ps, meta, true)
+			if err != nil {
+				couchError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+				return
+			}
+			res.Docs = append(res.Docs, map[string]interface{}{"ok": doc})
+		}
+		results = append(results, res)
+	}
+	writeCouchJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
@@ -0,0 +1,337 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+	"github.com/zeebo/blake3"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Dataset Digests for Swarm Convergence Checks
+// ------------------------
+
+// A swarm push/pull used to send the whole index both ways every interval.
+// Now each side sends a Digest instead: the number of records, a hash over
+// all of them, and a bloom filter of them. Equal hashes mean the two nodes
+// are in sync and nothing more happens. Otherwise each side broadcasts the
+// records missing from the other's bloom filter. If that finds too much to
+// send, or nothing while the peer has no more records than this node (a
+// false positive, or revisions the peer refuses), the next push/pull
+// carries the full state as before, or the node's sync URL to sync from
+// (see sync.go). Joins always exchange full states or sync URLs.
+
+// digestMsgPrefix marks a push/pull state that is a Digest rather than the
+// full state.
+var digestMsgPrefix = []byte("digest ")
+
+const (
+	// bloomBitsPerRecord and bloomHashes give about a 1% false positive rate.
+	bloomBitsPerRecord = 10
+	bloomHashes        = 7
+
+	// maxDigestRepair is the most records sent by broadcast after a digest
+	// mismatch; a bigger difference is left to a full state exchange.
+	maxDigestRepair = 256
+)
+
+// Digest summarizes a node's records.
+type Digest struct {
+	HostID  string `json:"hostID"`
+	Records int    `json:"records"`
+	Hash    string `json:"hash"`            // BLAKE3 of the sorted record hashes
+	Bloom   []byte `json:"bloom,omitempty"` // Bloom filter of the record hashes
+	Hashes  int    `json:"hashes,omitempty"`
+}
+
+// recordHash identifies a record's content. Records are hashed opened:
+// sealed fields are encrypted with a random nonce, so the same record is
+// stored differently on every node.
+func recordHash(meta metadata.FileMetadata) ([32]byte, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return blake3.Sum256(data), nil
+}
+
+// bloomIndexes returns the bits of h in a filter of m bits, by double
+// hashing on the two halves of h.
+func bloomIndexes(h [32]byte, k int, m uint64) []uint64 {
+	h1 := binary.BigEndian.Uint64(h[0:8])
+	h2 := binary.BigEndian.Uint64(h[8:16]) | 1
+	idx := make([]uint64, k)
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) % m
+	}
+	return idx
+}
+
+// mayContain reports whether the digest's bloom filter may hold h; without
+// a filter it holds nothing.
+func (dg Digest) mayContain(h [32]byte) bool {
+	m := uint64(len(dg.Bloom)) * 8
+	if m == 0 || dg.Hashes <= 0 {
+		return false
+	}
+	for _, i := range bloomIndexes(h, dg.Hashes, m) {
+		if dg.Bloom[i/8]&(1<<(i%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ComputeDigest hashes every record in ps and builds the digest.
+func ComputeDigest(ps *storage.PersistentStore) (Digest, [][32]byte, error) {
+	var hashes [][32]byte
+	err := ps.ForEach(func(meta metadata.FileMetadata) error {
+		h, err := recordHash(meta)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, h)
+		return nil
+	})
+	if err != nil {
+		return Digest{}, nil, err
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	sum := blake3.New()
+	for _, h := range hashes {
+		sum.Write(h[:])
+	}
+	bits := uint64(max(len(hashes)*bloomBitsPerRecord, 64))
+	bloom := make([]byte, (bits+7)/8)
+	m := uint64(len(bloom)) * 8
+	for _, h := range hashes {
+		for _, i := range bloomIndexes(h, bloomHashes, m) {
+			bloom[i/8] |= 1 << (i % 8)
+		}
+	}
+	dg := Digest{
+		HostID:  utils.HostID,
+		Records: len(hashes),
+		Hash:    hex.EncodeToString(sum.Sum(nil)),
+		Bloom:   bloom,
+		Hashes:  bloomHashes,
+	}
+	return dg, hashes, nil
+}
+
+// digestCache keeps a node's digest until its store changes.
+type digestCache struct {
+	mu       sync.Mutex
+	seq      uint64
+	valid    bool
+	digest   Digest
+	hashes   [][32]byte
+	fullSync bool // Send the full state on the next push/pull
+}
+
+// get returns the digest of ps and its record hashes, recomputing them only
+// if the store changed since the last call.
+func (c *digestCache) get(ps *storage.PersistentStore) (Digest, [][32]byte, error) {
+	seq, err := ps.UpdateSeq()
+	if err != nil {
+		return Digest{}, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.valid && c.seq == seq {
+		return c.digest, c.hashes, nil
+	}
+	dg, hashes, err := ComputeDigest(ps)
+	if err != nil {
+		return Digest{}, nil, err
+	}
+	c.seq, c.valid, c.digest, c.hashes = seq, true, dg, hashes
+	return dg, hashes, nil
+}
+
+// takeFullSync reports whether a full state exchange is due, and clears it.
+func (c *digestCache) takeFullSync() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	full := c.fullSync
+	c.fullSync = false
+	return full
+}
+
+func (c *digestCache) requestFullSync() {
+	c.mu.Lock()
+	c.fullSync = true
+	c.mu.Unlock()
+}
+
+// digestState returns the push/pull state to send: a digest, or nil if the
+// full state is due or digests are off ("fullStateSync").
+func (d *SwarmDelegate) digestState(join bool) []byte {
+	if join || viper.GetBool("fullStateSync") || d.digests.takeFullSync() {
+		return nil
+	}
+	dg, _, err := d.digests.get(d.ps)
+	if err != nil {
+		log.Printf("Swarm: failed to compute digest, sending full state: %v", err)
+		return nil
+	}
+	data, err := json.Marshal(dg)
+	if err != nil {
+		return nil
+	}
+	return append(append([]byte{}, digestMsgPrefix...), data...)
+}
+
+// mergeDigest compares a peer's digest with this node's and starts the
+// repair when they disagree.
+func (d *SwarmDelegate) mergeDigest(buf []byte) {
+	var remote Digest
+	if err := json.Unmarshal(bytes.TrimPrefix(buf, digestMsgPrefix), &remote); err != nil {
+		log.Printf("Swarm: failed to decode digest: %v", err)
+		return
+	}
+	local, hashes, err := d.digests.get(d.ps)
+	if err != nil {
+		log.Printf("Swarm: failed to compute digest: %v", err)
+		return
+	}
+	noteDigest(remote, local.Hash == remote.Hash, time.Now())
+	if local.Hash == remote.Hash {
+		// Nothing to merge, but the peer's records are current here
+		noteSwarmContact(remote.HostID, time.Now())
+		return
+	}
+
+	var missing [][32]byte
+	for _, h := range hashes {
+		if !remote.mayContain(h) {
+			missing = append(missing, h)
+			if len(missing) > maxDigestRepair {
+				break
+			}
+		}
+	}
+	if len(missing) == 0 && remote.Records > local.Records {
+		// The peer has records this node lacks; it finds and sends them
+		return
+	}
+	if len(missing) == 0 || len(missing) > maxDigestRepair {
+		log.Printf("Swarm: digest differs from %s (%d records here, %d there); sending full state next", remote.HostID, local.Records, remote.Records)
+		d.digests.requestFullSync()
+		return
+	}
+	sent, err := d.queueRecords(missing)
+	if err != nil {
+		log.Printf("Swarm: failed to send records missing from %s, sending full state next: %v", remote.HostID, err)
+		d.digests.requestFullSync()
+		return
+	}
+	log.Printf("Swarm: digest differs from %s; broadcast %d records it lacks", remote.HostID, sent)
+}
+
+// queueRecords broadcasts the records with the given hashes.
+func (d *SwarmDelegate) queueRecords(hashes [][32]byte) (int, error) {
+	want := make(map[[32]byte]bool, len(hashes))
+	for _, h := range hashes {
+		want[h] = true
+	}
+	sent := 0
+	err := d.ps.ForEach(func(meta metadata.FileMetadata) error {
+		h, err := recordHash(meta)
+		if err != nil || !want[h] {
+			return err
+		}
+		sent++
+		return d.QueueMetadata(meta)
+	})
+	return sent, err
+}
+
+// swarmDigests tracks the last digest received from each host, for /cluster
+// and /_digest.
+var swarmDigests = struct {
+	sync.Mutex
+	peers map[string]DigestCheck
+}{peers: map[string]DigestCheck{}}
+
+// DigestCheck is the outcome of the last digest comparison with a peer.
+type DigestCheck struct {
+	Records int       `json:"records"`
+	InSync  bool      `json:"inSync"`
+	Checked time.Time `json:"checked"`
+}
+
+func noteDigest(remote Digest, inSync bool, at time.Time) {
+	if remote.HostID == "" {
+		return
+	}
+	swarmDigests.Lock()
+	swarmDigests.peers[remote.HostID] = DigestCheck{Records: remote.Records, InSync: inSync, Checked: at}
+	swarmDigests.Unlock()
+}
+
+// DigestChecks returns the last digest comparison with each swarm peer,
+// keyed by host ID.
+func DigestChecks() map[string]DigestCheck {
+	swarmDigests.Lock()
+	defer swarmDigests.Unlock()
+	checks := make(map[string]DigestCheck, len(swarmDigests.peers))
+	for host, c := range swarmDigests.peers {
+		checks[host] = c
+	}
+	return checks
+}
+
+// HandleDigest serves this node's digest, without the bloom filter unless
+// ?bloom=true, and the last digest comparison with each swarm peer. Two
+// nodes are in sync when their hashes are equal.
+func HandleDigest(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	dg, _, err := ComputeDigest(ps)
+	if err != nil {
+		http.Error(w, "failed to compute digest", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("bloom") != "true" {
+		dg.Bloom, dg.Hashes = nil, 0
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(struct {
+		Digest
+		Peers map[string]DigestCheck `json:"peers"`
+	}{dg, DigestChecks()})
+	if err != nil {
+		color.Red("failed to encode digest: %v", err)
+	}
+}
+
+// FetchDigest returns the digest served by the node at baseURL.
+func FetchDigest(baseURL string) (Digest, error) {
+	resp, err := peerClient(0).Get(baseURL + "/_digest")
+	if err != nil {
+		return Digest{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Digest{}, fmt.Errorf("%s/_digest: %s", baseURL, resp.Status)
+	}
+	var dg Digest
+	if err := json.NewDecoder(resp.Body).Decode(&dg); err != nil {
+		return Digest{}, err
+	}
+	return dg, nil
+}
@@ -0,0 +1,327 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/hashicorp/memberlist"
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// Peer Discovery Backends
+// ------------------------
+
+// Discovery backends, selected with --discovery ("discovery").
+const (
+	DiscoveryMDNS = "mdns" // Advertise and query _indexer._tcp on the local network
+	DiscoveryDNS  = "dns"  // Look up the SRV records of --discovery-dns
+	DiscoveryFile = "file" // Read --peers-file, and again when it changes
+	DiscoveryK8s  = "k8s"  // Resolve the pods of a Kubernetes headless service
+	DiscoveryHTTP = "http" // Fetch the JSON peer list at --peerListURL
+)
+
+// DiscoveryModes lists the backends, for flag help.
+var DiscoveryModes = []string{DiscoveryMDNS, DiscoveryDNS, DiscoveryFile, DiscoveryK8s, DiscoveryHTTP}
+
+const (
+	// DefaultDiscoveryInterval is how often the backends other than file
+	// look for peers that are not members yet.
+	DefaultDiscoveryInterval = time.Minute
+	// peersFileCheckInterval is how often the peers file is checked for
+	// changes.
+	peersFileCheckInterval = 5 * time.Second
+	// k8sNamespaceFile holds the namespace of the pod a node runs in.
+	k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Discoverer finds the swarm addresses ("host:port") of peers.
+type Discoverer interface {
+	Peers() ([]string, error)
+}
+
+// discoveryMode returns the configured backend. Without --discovery it is
+// what the other flags imply, as before backends could be chosen: http
+// with --peerListURL, none in stealth mode (--peers only), else mdns.
+func discoveryMode() string {
+	if mode := viper.GetString("discovery"); mode != "" {
+		return mode
+	}
+	switch {
+	case viper.GetString("peerListURL") != "":
+		return DiscoveryHTTP
+	case viper.GetBool("stealth"):
+		return ""
+	}
+	return DiscoveryMDNS
+}
+
+// newDiscoverer returns the backend for mode, how often to run it again
+// (0 for once), and an error if it is unknown or not configured.
+func newDiscoverer(mode, hostname string, port int) (Discoverer, time.Duration, error) {
+	interval := viper.GetDuration("discoveryInterval")
+	switch mode {
+	case DiscoveryMDNS:
+		return &mdnsDiscovery{hostname: hostname, port: port}, interval, nil
+	case DiscoveryDNS:
+		name := viper.GetString("discoveryDNS")
+		if name == "" {
+			return nil, 0, fmt.Errorf("--discovery=dns needs --discovery-dns (an SRV name, e.g. _dreamfs._udp.example.com)")
+		}
+		return dnsDiscovery{name: name}, interval, nil
+	case DiscoveryFile:
+		path := viper.GetString("peersFile")
+		if path == "" {
+			return nil, 0, fmt.Errorf("--discovery=file needs --peers-file")
+		}
+		return &fileDiscovery{path: path, port: port}, peersFileCheckInterval, nil
+	case DiscoveryK8s:
+		service := viper.GetString("discoveryK8sService")
+		if service == "" {
+			return nil, 0, fmt.Errorf("--discovery=k8s needs --discovery-k8s-service")
+		}
+		return k8sDiscovery{host: k8sServiceHost(service), port: port}, interval, nil
+	case DiscoveryHTTP:
+		url := viper.GetString("peerListURL")
+		if url == "" {
+			return nil, 0, fmt.Errorf("--discovery=http needs --peerListURL")
+		}
+		return httpDiscovery{url: url}, interval, nil
+	}
+	return nil, 0, fmt.Errorf("unknown discovery backend %q (use one of %s)", mode, strings.Join(DiscoveryModes, ", "))
+}
+
+// runDiscovery joins the peers d finds, then, every interval (if not 0),
+// those that are not members yet, in the background.
+func runDiscovery(ml *memberlist.Memberlist, mode string, d Discoverer, interval time.Duration) {
+	discoverOnce(ml, mode, d, true)
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			discoverOnce(ml, mode, d, false)
+		}
+	}()
+}
+
+func discoverOnce(ml *memberlist.Memberlist, mode string, d Discoverer, first bool) {
+	peers, err := d.Peers()
+	if err != nil {
+		log.Printf("Swarm discovery (%s): %v", mode, err)
+		return
+	}
+	fresh := freshPeers(ml, peers)
+	if len(fresh) == 0 {
+		if first {
+			log.Printf("Swarm discovery (%s): no peers found", mode)
+		}
+		return
+	}
+	n, err := ml.Join(fresh)
+	if err != nil {
+		log.Printf("Swarm discovery (%s): failed to join peers: %v", mode, err)
+	}
+	log.Printf("Swarm discovery (%s): joined %d peers", mode, n)
+}
+
+// freshPeers returns the addresses of peers, resolved to IPs, that are not
+// those of members (the local node included).
+func freshPeers(ml *memberlist.Memberlist, peers []string) []string {
+	known := map[string]bool{}
+	for _, m := range ml.Members() {
+		known[m.Address()] = true
+	}
+	var fresh []string
+	for _, p := range peers {
+		host, port, err := net.SplitHostPort(p)
+		if err != nil {
+			continue
+		}
+		addrs := []string{host}
+		if net.ParseIP(host) == nil {
+			if addrs, err = net.LookupHost(host); err != nil {
+				continue
+			}
+		}
+		for _, a := range addrs {
+			if addr := net.JoinHostPort(a, port); !known[addr] {
+				known[addr] = true
+				fresh = append(fresh, addr)
+			}
+		}
+	}
+	return fresh
+}
+
+// withPort adds port to an address that has none.
+func withPort(addr string, port int) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), strconv.Itoa(port))
+}
+
+// mdnsDiscovery advertises the node over mDNS for as long as it runs, and
+// queries for others. Each query first advertises the node anew if its
+// address has changed, e.g. after a DHCP renewal or a move between networks.
+type mdnsDiscovery struct {
+	hostname string
+	port     int
+	ip       net.IP
+	server   *mdns.Server
+}
+
+// advertise (re)starts the mDNS server answering for the node's current
+// address.
+func (m *mdnsDiscovery) advertise() {
+	ip := net.ParseIP(GetLocalIP())
+	if m.server != nil && ip.Equal(m.ip) {
+		return
+	}
+	if m.server != nil {
+		m.server.Shutdown()
+		m.server = nil
+	}
+	m.ip = ip
+	srv, err := mdns.NewMDNSService(m.hostname, "_indexer._tcp", "", "", m.port, []net.IP{ip}, []string{"Hello friend"})
+	if err != nil {
+		log.Printf("mDNS service error: %v", err)
+		return
+	}
+	if m.server, err = mdns.NewServer(&mdns.Config{Zone: srv}); err != nil {
+		log.Printf("mDNS server error: %v", err)
+	}
+}
+
+func (m *mdnsDiscovery) Peers() ([]string, error) {
+	m.advertise()
+	var discovered []string
+	entriesCh := make(chan *mdns.ServiceEntry, 4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for entry := range entriesCh {
+			if entry.AddrV4.String() == m.ip.String() {
+				continue
+			}
+			discovered = append(discovered, fmt.Sprintf("%s:%d", entry.AddrV4.String(), m.port))
+		}
+	}()
+	err := mdns.Query(&mdns.QueryParam{
+		Service: "_indexer._tcp",
+		Domain:  "local",
+		Timeout: time.Second * 3,
+		Entries: entriesCh,
+	})
+	close(entriesCh)
+	<-done
+	return discovered, err
+}
+
+// dnsDiscovery looks up the targets of an SRV name.
+type dnsDiscovery struct {
+	name string
+}
+
+func (d dnsDiscovery) Peers() ([]string, error) {
+	_, srvs, err := net.LookupSRV("", "", d.name)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		peers = append(peers, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+	}
+	return peers, nil
+}
+
+// fileDiscovery reads a file of peer addresses, one per line ("#" starts a
+// comment; the swarm port is the default), whenever its modification time
+// changes.
+type fileDiscovery struct {
+	path    string
+	port    int
+	lastMod time.Time
+}
+
+func (f *fileDiscovery) Peers() ([]string, error) {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if !f.lastMod.IsZero() && fi.ModTime().Equal(f.lastMod) {
+		return nil, nil
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var peers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			peers = append(peers, withPort(line, f.port))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	f.lastMod = fi.ModTime()
+	return peers, nil
+}
+
+// k8sDiscovery resolves a Kubernetes headless service, whose DNS name has
+// an address record for each ready pod.
+type k8sDiscovery struct {
+	host string
+	port int
+}
+
+// k8sServiceHost returns the DNS name of a service given as "name",
+// "name.namespace" or a full name. A bare name is looked up in the
+// namespace of the node's pod, or "default".
+func k8sServiceHost(service string) string {
+	if strings.Contains(service, ".svc") {
+		return service
+	}
+	if !strings.Contains(service, ".") {
+		namespace := "default"
+		if data, err := os.ReadFile(k8sNamespaceFile); err == nil && strings.TrimSpace(string(data)) != "" {
+			namespace = strings.TrimSpace(string(data))
+		}
+		service += "." + namespace
+	}
+	return service + ".svc.cluster.local"
+}
+
+func (k k8sDiscovery) Peers() ([]string, error) {
+	addrs, err := net.LookupHost(k.host)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		peers = append(peers, net.JoinHostPort(a, strconv.Itoa(k.port)))
+	}
+	return peers, nil
+}
+
+// httpDiscovery fetches a JSON array of peer addresses (see
+// GetPeerListFromHTTP).
+type httpDiscovery struct {
+	url string
+}
+
+func (h httpDiscovery) Peers() ([]string, error) {
+	return GetPeerListFromHTTP(h.url)
+}
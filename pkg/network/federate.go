@@ -0,0 +1,342 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/query"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// Federated Queries with Read Repair
+// ------------------------
+
+// LocalSource names the local store among the sources of a federated query.
+const LocalSource = "local"
+
+// federateTimeout bounds each request to a peer.
+const federateTimeout = 60 * time.Second
+
+// errQueryLimit stops a store scan once enough matches were collected.
+var errQueryLimit = errors.New("query limit reached")
+
+// HandleQuery answers GET /_query?q=<expression>&limit=N with the stored
+// records matching a filter expression (see package query) as {"docs": [...]}.
+func HandleQuery(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	expr, err := query.Parse(r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	docs, err := queryStore(ps, expr, limit)
+	if err == nil {
+		docs, err = sealAll(ps, docs)
+	}
+	if err != nil {
+		http.Error(w, "failed to query metadata", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"docs": docs}); err != nil {
+		color.Red("failed to encode query results: %v", err)
+	}
+}
+
+// HandleBulkDocs stores the records POSTed as {"docs": [...]}, CouchDB-style.
+// Read repair uses it to push newer revisions to stale peers. With
+// "new_edits": false, as replicators send, records keep their _rev and are
+// merged (see PersistentStore.Merge); otherwise each is an edit of the
+// revision in its _rev, as by PUT /doc/<id>. Docs marked "_deleted" delete
+// the record.
+func HandleBulkDocs(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a JSON body with docs", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Docs     []metadata.FileMetadata `json:"docs"`
+		NewEdits *bool                   `json:"new_edits"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid docs: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	newEdits := req.NewEdits == nil || *req.NewEdits
+	type result struct {
+		ID     string `json:"id"`
+		OK     bool   `json:"ok,omitempty"`
+		Rev    string `json:"rev,omitempty"`
+		Error  string `json:"error,omitempty"`
+		Reason string `json:"reason,omitempty"`
+	}
+	results := make([]result, 0, len(req.Docs))
+	for _, meta := range req.Docs {
+		meta = clientDoc(meta)
+		res := result{ID: meta.ID}
+		var err error
+		stored := true
+		switch {
+		case newEdits && isDeletion(meta):
+			res.Rev, err = ps.DeleteRev(meta.ID, meta.Rev())
+		case newEdits:
+			meta, err = ps.Edit(meta, meta.Rev())
+			res.Rev = meta.Rev()
+		case isDeletion(meta):
+			stored, err = ps.MergeDeletion(meta.ID, meta.Rev())
+			res.Rev = meta.Rev()
+		default:
+			stored, err = ps.Merge(meta)
+			res.Rev = meta.Rev()
+		}
+		switch {
+		case errors.Is(err, storage.ErrRevConflict):
+			res.Rev, res.Error, res.Reason = "", "conflict", "Document update conflict."
+		case err != nil:
+			res.Rev, res.Error = "", err.Error()
+		case !stored:
+			res.Error = "superseded by a deletion or a newer version"
+		default:
+			res.OK = true
+		}
+		results = append(results, res)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		color.Red("failed to encode bulk results: %v", err)
+	}
+}
+
+// Divergence is a file (host and path) for which the sources of a federated
+// query returned different latest revisions.
+type Divergence struct {
+	HostID   string   `json:"hostID"`
+	Path     string   `json:"path"`
+	NewestID string   `json:"newestID"`
+	ModTime  string   `json:"modTime"`
+	Stale    []string `json:"stale"`              // Sources holding an older revision
+	Repaired []string `json:"repaired,omitempty"` // Stale sources that now hold the newest
+}
+
+// FederatedResult is the merged outcome of a federated query.
+type FederatedResult struct {
+	Docs      []metadata.FileMetadata `json:"docs"` // Distinct matching records
+	Divergent []Divergence            `json:"divergent,omitempty"`
+	Errors    map[string]string       `json:"errors,omitempty"` // Source -> failure
+}
+
+// FederatedQuery runs a filter expression against the local store and the
+// /_query endpoint of each peer (e.g. http://nas:8080), merging the matches
+// by record ID. Peers that fail are reported in Errors, not fatal.
+//
+// Where sources disagree on the newest revision of a file, the sources
+// holding an older one are listed as stale and, with repair set, sent the
+// newest: stored directly for the local store, POSTed to /_bulk_docs for
+// peers. Sources that returned no revision of the file are left alone, since
+// they may not replicate that host at all.
+func FederatedQuery(ps *storage.PersistentStore, exprText string, peers []string, limit int, repair bool) (FederatedResult, error) {
+	expr, err := query.Parse(exprText)
+	if err != nil {
+		return FederatedResult{}, err
+	}
+	result := FederatedResult{Errors: map[string]string{}}
+
+	bySource := map[string][]metadata.FileMetadata{}
+	if bySource[LocalSource], err = queryStore(ps, expr, limit); err != nil {
+		return result, fmt.Errorf("query local store: %w", err)
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			docs, err := queryPeer(peer, exprText, limit)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Errors[peer] = err.Error()
+				return
+			}
+			for i := range docs {
+				docs[i] = ps.Realm().Open(docs[i])
+			}
+			bySource[peer] = docs
+		}(peer)
+	}
+	wg.Wait()
+
+	// Distinct records, and each source's newest revision per host and path
+	seen := map[string]bool{}
+	newest := map[string]map[string]metadata.FileMetadata{} // host|path -> source -> newest
+	sources := append([]string{LocalSource}, peers...)
+	for _, source := range sources {
+		for _, meta := range bySource[source] {
+			if !seen[meta.ID] {
+				seen[meta.ID] = true
+				result.Docs = append(result.Docs, meta)
+			}
+			key := meta.HostID + "|" + meta.FilePath
+			if newest[key] == nil {
+				newest[key] = map[string]metadata.FileMetadata{}
+			}
+			if cur, ok := newest[key][source]; !ok || storage.Newer(meta, cur) {
+				newest[key][source] = meta
+			}
+		}
+	}
+	if limit > 0 && len(result.Docs) > limit {
+		result.Docs = result.Docs[:limit]
+	}
+
+	pushes := map[string][]metadata.FileMetadata{} // peer -> revisions to send
+	for _, revs := range newest {
+		var best metadata.FileMetadata
+		for _, meta := range revs {
+			if best.ID == "" || storage.Newer(meta, best) {
+				best = meta
+			}
+		}
+		d := Divergence{HostID: best.HostID, Path: best.FilePath, NewestID: best.ID, ModTime: best.ModTime}
+		for _, source := range sources {
+			if meta, ok := revs[source]; ok && storage.Newer(best, meta) {
+				d.Stale = append(d.Stale, source)
+			}
+		}
+		if len(d.Stale) == 0 {
+			continue
+		}
+		if repair {
+			for _, source := range d.Stale {
+				if source == LocalSource {
+					if _, err := ps.Merge(best); err != nil {
+						result.Errors[LocalSource] = err.Error()
+						continue
+					}
+					d.Repaired = append(d.Repaired, source)
+				} else {
+					pushes[source] = append(pushes[source], best)
+				}
+			}
+		}
+		result.Divergent = append(result.Divergent, d)
+	}
+
+	// One bulk write per stale peer
+	pushed := map[string]map[string]bool{} // peer -> IDs stored
+	for peer, docs := range pushes {
+		docs, err := sealAll(ps, docs)
+		if err != nil {
+			return result, err
+		}
+		ids, err := pushPeer(peer, docs)
+		if err != nil {
+			result.Errors[peer] = "read repair: " + err.Error()
+		}
+		pushed[peer] = ids
+	}
+	for i, d := range result.Divergent {
+		for _, source := range d.Stale {
+			if pushed[source][d.NewestID] {
+				result.Divergent[i].Repaired = append(result.Divergent[i].Repaired, source)
+			}
+		}
+	}
+	sort.Slice(result.Divergent, func(i, j int) bool {
+		if result.Divergent[i].HostID != result.Divergent[j].HostID {
+			return result.Divergent[i].HostID < result.Divergent[j].HostID
+		}
+		return result.Divergent[i].Path < result.Divergent[j].Path
+	})
+	return result, nil
+}
+
+// queryStore collects up to limit (0 for all) records matching expr.
+func queryStore(ps *storage.PersistentStore, expr query.Expr, limit int) ([]metadata.FileMetadata, error) {
+	docs := []metadata.FileMetadata{}
+	err := ps.ForEach(func(meta metadata.FileMetadata) error {
+		if !expr.Match(&meta) {
+			return nil
+		}
+		docs = append(docs, meta)
+		if limit > 0 && len(docs) >= limit {
+			return errQueryLimit
+		}
+		return nil
+	})
+	if err == errQueryLimit {
+		err = nil
+	}
+	return docs, err
+}
+
+// queryPeer fetches the matches of exprText from a peer's /_query endpoint.
+func queryPeer(peer, exprText string, limit int) ([]metadata.FileMetadata, error) {
+	params := url.Values{"q": {exprText}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	u := strings.TrimSuffix(peer, "/") + "/_query?" + params.Encode()
+	resp, err := peerClient(federateTimeout).Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, u)
+	}
+	var body struct {
+		Docs []metadata.FileMetadata `json:"docs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode query results: %w", err)
+	}
+	return body.Docs, nil
+}
+
+// pushPeer POSTs docs to a peer's /_bulk_docs endpoint and returns the IDs
+// it stored.
+func pushPeer(peer string, docs []metadata.FileMetadata) (map[string]bool, error) {
+	data, err := json.Marshal(map[string]interface{}{"docs": docs, "new_edits": false})
+	if err != nil {
+		return nil, err
+	}
+	u := strings.TrimSuffix(peer, "/") + "/_bulk_docs"
+	resp, err := peerClient(federateTimeout).Post(u, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, u)
+	}
+	var results []struct {
+		ID    string `json:"id"`
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("decode bulk results: %w", err)
+	}
+	ids := map[string]bool{}
+	for _, r := range results {
+		if r.OK {
+			ids[r.ID] = true
+		}
+	}
+	return ids, nil
+}
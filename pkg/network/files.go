@@ -0,0 +1,86 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fatih/color"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/query"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// Paged File Listing
+// ------------------------
+
+// Page sizes for /files.
+const (
+	filesDefaultLimit = 1000
+	filesMaxLimit     = 10000
+)
+
+// HandleFiles serves GET /files: the current files (newest revision of
+// each, without deleted files) one page at a time, as {"docs": [...],
+// "next": cursor}. Pass next back as ?cursor= for the following page; it
+// is absent on the last one. Filters:
+//
+//	host=<hostID>             one host's files
+//	prefix=/data/photos       paths starting with the prefix
+//	minSize=100MB, maxSize=   size bounds (units as in queries)
+//	after=2024-01-01, before= modTime bounds (date or RFC 3339)
+//	limit=N                   page size (default 1000, at most 10000)
+func HandleFiles(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	q := r.URL.Query()
+	f := storage.FileFilter{HostID: q.Get("host"), Prefix: q.Get("prefix")}
+	var err error
+	for param, dest := range map[string]*int64{"minSize": &f.MinSize, "maxSize": &f.MaxSize} {
+		if v := q.Get(param); v != "" {
+			if *dest, err = query.ParseSize(v); err != nil {
+				http.Error(w, "invalid "+param+": "+v, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	for param, dest := range map[string]*time.Time{"after": &f.After, "before": &f.Before} {
+		if v := q.Get(param); v != "" {
+			if *dest, err = query.ParseTime(v); err != nil {
+				http.Error(w, "invalid "+param+": "+v, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	limit, err := queryInt(q.Get("limit"), filesDefaultLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, filesMaxLimit)
+
+	docs, next, err := ps.ListFiles(f, q.Get("cursor"), limit)
+	if err == nil {
+		docs, err = sealAll(ps, docs)
+	}
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to list files", http.StatusInternalServerError)
+		return
+	}
+	if docs == nil {
+		docs = []metadata.FileMetadata{}
+	}
+	resp := map[string]interface{}{"docs": docs}
+	if next != "" {
+		resp["next"] = next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		color.Red("failed to encode files: %v", err)
+	}
+}
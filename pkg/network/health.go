@@ -0,0 +1,136 @@
+package network
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// Health Probes and Shutdown
+// ------------------------
+
+// DefaultShutdownTimeout is how long 'indexer serve' lets in-flight
+// requests finish on SIGINT or SIGTERM before closing their connections.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// shutdown is closed when the HTTP server starts shutting down: /readyz
+// then fails, and waiting _changes feeds end so the server can drain.
+var shutdown = struct {
+	once sync.Once
+	ch   chan struct{}
+}{ch: make(chan struct{})}
+
+func beginShutdown() {
+	shutdown.once.Do(func() { close(shutdown.ch) })
+}
+
+// shuttingDown returns a channel closed once the server shuts down.
+func shuttingDown() <-chan struct{} {
+	return shutdown.ch
+}
+
+// ShutdownTimeout returns the configured grace period for in-flight
+// requests (--shutdown-timeout).
+func ShutdownTimeout() time.Duration {
+	if d := viper.GetDuration("shutdownTimeout"); d > 0 {
+		return d
+	}
+	return DefaultShutdownTimeout
+}
+
+// probePaths are served without the "httpToken", for orchestrators.
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// exemptProbes serves the health probes from mux directly and everything
+// else through h (see RequireToken).
+func exemptProbes(mux *http.ServeMux, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probePaths[r.URL.Path] {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// SwarmHealth is the swarm as the health probes report it.
+type SwarmHealth struct {
+	Node  string `json:"node"`
+	Alive int    `json:"alive"` // Live members, this node included
+	// Score is memberlist's awareness of this node's own health: 0 is
+	// healthy, higher when it is slow to answer probes.
+	Score int `json:"score"`
+}
+
+// Health is the answer of /healthz and /readyz.
+type Health struct {
+	Status   string       `json:"status"` // ok, or unavailable
+	Store    string       `json:"store"`  // ok, or the error reading it
+	Swarm    *SwarmHealth `json:"swarm,omitempty"`
+	Draining bool         `json:"draining,omitempty"`
+	Reasons  []string     `json:"reasons,omitempty"` // Why the probe failed
+}
+
+// checkHealth evaluates the node. Liveness fails only if the store cannot
+// be read; readiness also fails while the server shuts down and, with
+// --swarm, until the swarm has started. A node alone in its swarm is ready.
+func checkHealth(ps *storage.PersistentStore, ready bool) Health {
+	h := Health{Status: "ok", Store: "ok"}
+	if err := ps.Check(); err != nil {
+		h.Store = err.Error()
+		h.Reasons = append(h.Reasons, "store unreadable")
+	}
+	if d := localSwarm.Load(); d != nil {
+		sh := &SwarmHealth{Node: d.ml.LocalNode().Name, Score: d.ml.GetHealthScore()}
+		for _, n := range d.ml.Members() {
+			if memberState(n.State) == MemberAlive {
+				sh.Alive++
+			}
+		}
+		h.Swarm = sh
+	} else if ready && viper.GetBool("swarm") {
+		h.Reasons = append(h.Reasons, "swarm not started")
+	}
+	select {
+	case <-shuttingDown():
+		h.Draining = true
+		if ready {
+			h.Reasons = append(h.Reasons, "shutting down")
+		}
+	default:
+	}
+	if len(h.Reasons) > 0 {
+		h.Status = "unavailable"
+	}
+	return h
+}
+
+// HandleHealthz serves GET /healthz, the liveness probe: 200 while the
+// process can read its store, 503 otherwise.
+func HandleHealthz(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	writeHealth(w, checkHealth(ps, false))
+}
+
+// HandleReadyz serves GET /readyz, the readiness probe: 200 while the node
+// can take requests, 503 while it starts its swarm or shuts down.
+func HandleReadyz(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	writeHealth(w, checkHealth(ps, true))
+}
+
+func writeHealth(w http.ResponseWriter, h Health) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if h.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		color.Red("failed to encode health: %v", err)
+	}
+}
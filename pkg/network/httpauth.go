@@ -0,0 +1,164 @@
+package network
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// TLS and Authentication for the HTTP Endpoints
+// ------------------------
+
+// The HTTP server serves TLS when "tlsCert" and "tlsKey" are set, and then
+// also requires a client certificate signed by "tlsClientCA" when that is
+// set. With "httpToken" set, every request must carry it as a bearer
+// token. Requests to peers (replication, digests, blobs, federated
+// queries) present the same certificate and token, and trust the
+// certificates signed by "tlsCA" besides the system's.
+
+// loadCertPool reads the PEM certificates in path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// nodeCertificate loads this node's certificate, if configured.
+func nodeCertificate() ([]tls.Certificate, error) {
+	certFile, keyFile := viper.GetString("tlsCert"), viper.GetString("tlsKey")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("--tls-cert and --tls-key must be given together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// ServerTLSConfig returns the TLS configuration of the HTTP server, or nil
+// to serve plaintext.
+func ServerTLSConfig() (*tls.Config, error) {
+	certs, err := nodeCertificate()
+	if err != nil || certs == nil {
+		if err == nil && viper.GetString("tlsClientCA") != "" {
+			err = errors.New("--tls-client-ca needs --tls-cert and --tls-key")
+		}
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: certs, MinVersion: tls.VersionTLS12}
+	if caFile := viper.GetString("tlsClientCA"); caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client CA: %w", err)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ValidToken reports whether an Authorization value carries "httpToken" as
+// a bearer token. It always does when no token is set.
+func ValidToken(authorization string) bool {
+	token := viper.GetString("httpToken")
+	if token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// RequireToken wraps h so that, with "httpToken" set, requests without it
+// as a bearer token are refused.
+func RequireToken(h http.Handler) http.Handler {
+	if viper.GetString("httpToken") == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ValidToken(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dreamfs"`)
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// peerTransport carries requests to peers: over TLS with this node's
+// certificate and "tlsCA", and with "httpToken" unless the request sets its
+// own Authorization (e.g. for a seed server).
+type peerTransport struct {
+	base  http.RoundTripper
+	token string
+	err   error // Loading the TLS configuration failed
+}
+
+func (t *peerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if t.token != "" && req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return t.base.RoundTrip(req)
+}
+
+var loadPeerTransport = sync.OnceValue(func() http.RoundTripper {
+	t := &peerTransport{token: viper.GetString("httpToken")}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	certs, err := nodeCertificate()
+	if err != nil {
+		t.err = err
+		return t
+	}
+	base.TLSClientConfig = &tls.Config{Certificates: certs, MinVersion: tls.VersionTLS12}
+	if caFile := viper.GetString("tlsCA"); caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		data, err := os.ReadFile(caFile)
+		if err == nil && !pool.AppendCertsFromPEM(data) {
+			err = fmt.Errorf("no PEM certificates in %s", caFile)
+		}
+		if err != nil {
+			t.err = fmt.Errorf("load TLS CA: %w", err)
+			return t
+		}
+		base.TLSClientConfig.RootCAs = pool
+	}
+	t.base = base
+	return t
+})
+
+// peerClient returns a client for requests to peers' HTTP endpoints, with
+// the given timeout (0 for none).
+func peerClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: loadPeerTransport(), Timeout: timeout}
+}
+
+// PeerClient is peerClient for other packages that fetch from nodes.
+func PeerClient(timeout time.Duration) *http.Client {
+	return peerClient(timeout)
+}
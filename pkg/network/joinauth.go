@@ -0,0 +1,256 @@
+package network
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Swarm Join Authorization
+// ------------------------
+
+// Without configuration any node that reaches the swarm port can join and
+// send records. The swarm can instead be limited to:
+//
+//   - addresses in "swarmAllowCIDR" and not in "swarmDenyCIDR"; packets from
+//     outside the allowlist are dropped by memberlist itself
+//   - host IDs in "swarmAllowHost" and not in "swarmDenyHost", as each node
+//     advertises in its memberlist metadata
+//   - nodes holding "swarmJoinToken": a node advertises an HMAC of its name
+//     and host ID with the token, checked when it joins or is gossiped
+//     about, and every message and state exchange is tagged with an HMAC
+//     too, so nodes without the token cannot inject records
+//
+// Refused nodes are not members: they are not gossiped to, and the state
+// they push is dropped. memberlist does not say who sent a broadcast,
+// though, so only the token (or --swarm-key) keeps a refused node that
+// still knows a member's address from sending records. Neither keeps it
+// from reading the state a member answers its join with; the token is not
+// encryption, --swarm-key is.
+
+// authTagSize is the length of the HMAC tag on swarm messages.
+const authTagSize = 16
+
+// stateSenderPrefix starts every push/pull state, followed by the sending
+// node's name and a newline.
+var stateSenderPrefix = []byte("from ")
+
+// nodeMeta is what a node advertises in its memberlist metadata.
+type nodeMeta struct {
+	HostID string `json:"hostID"`
+	URL    string `json:"url,omitempty"`   // HTTP endpoints ("syncURL")
+	Proof  string `json:"proof,omitempty"` // See joinProof
+}
+
+// joinAuth decides which nodes may be swarm members. It implements
+// memberlist's AliveDelegate and MergeDelegate, which are only installed
+// when restricted.
+type joinAuth struct {
+	self       string // The local node's name, always allowed
+	allowCIDRs []net.IPNet
+	denyCIDRs  []net.IPNet
+	allowHosts map[string]bool
+	denyHosts  map[string]bool
+	token      []byte
+	ml         atomic.Pointer[memberlist.Memberlist] // Set once created
+}
+
+// loadJoinAuth returns the configured join policy of the node named self.
+func loadJoinAuth(self string) (*joinAuth, error) {
+	a := &joinAuth{self: self, token: []byte(viper.GetString("swarmJoinToken"))}
+	var err error
+	if allow := viper.GetStringSlice("swarmAllowCIDR"); len(allow) > 0 {
+		if a.allowCIDRs, err = memberlist.ParseCIDRs(allow); err != nil {
+			return nil, fmt.Errorf("--swarm-allow-cidr: %w", err)
+		}
+	}
+	if a.denyCIDRs, err = memberlist.ParseCIDRs(viper.GetStringSlice("swarmDenyCIDR")); err != nil {
+		return nil, fmt.Errorf("--swarm-deny-cidr: %w", err)
+	}
+	a.allowHosts = hostSet(viper.GetStringSlice("swarmAllowHost"))
+	a.denyHosts = hostSet(viper.GetStringSlice("swarmDenyHost"))
+	return a, nil
+}
+
+// restricted reports whether any node may be refused.
+func (a *joinAuth) restricted() bool {
+	return len(a.allowCIDRs)+len(a.denyCIDRs)+len(a.allowHosts)+len(a.denyHosts)+len(a.token) > 0
+}
+
+func hostSet(hosts []string) map[string]bool {
+	if len(hosts) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		set[h] = true
+	}
+	return set
+}
+
+// joinProof is the HMAC of a node's name and host ID with the join token.
+func joinProof(token []byte, name, hostID string) string {
+	mac := hmac.New(sha256.New, token)
+	mac.Write([]byte(name + "\x00" + hostID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// nodeMeta returns the local node's metadata.
+func (a *joinAuth) nodeMeta() []byte {
+	meta := nodeMeta{HostID: utils.HostID, URL: viper.GetString("syncURL")}
+	if len(a.token) > 0 {
+		meta.Proof = joinProof(a.token, a.self, utils.HostID)
+	}
+	data, _ := json.Marshal(meta)
+	return data
+}
+
+// authorize returns why n may not be a member, or nil if it may.
+func (a *joinAuth) authorize(n *memberlist.Node) error {
+	if n.Name == a.self {
+		return nil
+	}
+	ip := n.Addr
+	if a.allowCIDRs != nil && !inNets(ip, a.allowCIDRs) {
+		return fmt.Errorf("address %s is not in the swarm allowlist", ip)
+	}
+	if inNets(ip, a.denyCIDRs) {
+		return fmt.Errorf("address %s is denied", ip)
+	}
+	var meta nodeMeta
+	if len(n.Meta) > 0 {
+		if err := json.Unmarshal(n.Meta, &meta); err != nil {
+			return fmt.Errorf("unreadable node metadata: %w", err)
+		}
+	}
+	if a.allowHosts != nil && !a.allowHosts[meta.HostID] {
+		return fmt.Errorf("host %q is not in the swarm allowlist", meta.HostID)
+	}
+	if a.denyHosts[meta.HostID] {
+		return fmt.Errorf("host %q is denied", meta.HostID)
+	}
+	if len(a.token) > 0 && !hmac.Equal([]byte(meta.Proof), []byte(joinProof(a.token, n.Name, meta.HostID))) {
+		return fmt.Errorf("missing or invalid join token")
+	}
+	return nil
+}
+
+func inNets(ip net.IP, nets []net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotifyAlive keeps unauthorized nodes out of the member list, however
+// their existence is learned.
+func (a *joinAuth) NotifyAlive(peer *memberlist.Node) error {
+	if err := a.authorize(peer); err != nil {
+		log.Printf("Swarm: refused node %s (%s): %v", peer.Name, peer.Addr, err)
+		return err
+	}
+	return nil
+}
+
+// NotifyMerge refuses a join with a cluster that includes an unauthorized
+// node.
+func (a *joinAuth) NotifyMerge(peers []*memberlist.Node) error {
+	for _, peer := range peers {
+		if err := a.authorize(peer); err != nil {
+			log.Printf("Swarm: refused join with %s (%s): %v", peer.Name, peer.Addr, err)
+			return fmt.Errorf("node %s: %w", peer.Name, err)
+		}
+	}
+	return nil
+}
+
+// tagSize is the length sign adds to a message.
+func (a *joinAuth) tagSize() int {
+	if len(a.token) == 0 {
+		return 0
+	}
+	return authTagSize
+}
+
+// sign tags msg with the HMAC of the join token, if set.
+func (a *joinAuth) sign(msg []byte) []byte {
+	if len(a.token) == 0 {
+		return msg
+	}
+	mac := hmac.New(sha256.New, a.token)
+	mac.Write(msg)
+	return append(mac.Sum(nil)[:authTagSize], msg...)
+}
+
+// verify checks and strips the tag added by sign.
+func (a *joinAuth) verify(msg []byte) ([]byte, bool) {
+	if len(a.token) == 0 {
+		return msg, true
+	}
+	if len(msg) < authTagSize {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, a.token)
+	mac.Write(msg[authTagSize:])
+	if !hmac.Equal(msg[:authTagSize], mac.Sum(nil)[:authTagSize]) {
+		return nil, false
+	}
+	return msg[authTagSize:], true
+}
+
+// wrapState names the local node as the sender of a push/pull state, so
+// that a restricted receiver can drop state from nodes that are not
+// members, and tags it.
+func (a *joinAuth) wrapState(state []byte) []byte {
+	buf := make([]byte, 0, len(stateSenderPrefix)+len(a.self)+1+len(state))
+	buf = append(append(append(buf, stateSenderPrefix...), a.self...), '\n')
+	return a.sign(append(buf, state...))
+}
+
+// unwrapState checks the tag and sender of a state from wrapState. Open
+// nodes also take states without a sender, from peers that predate it.
+func (a *joinAuth) unwrapState(buf []byte) ([]byte, error) {
+	buf, ok := a.verify(buf)
+	if !ok {
+		return nil, errors.New("no valid join token tag")
+	}
+	rest, named := bytes.CutPrefix(buf, stateSenderPrefix)
+	if !named {
+		if a.restricted() {
+			return nil, errors.New("state does not name its sender")
+		}
+		return buf, nil
+	}
+	sender, state, ok := bytes.Cut(rest, []byte("\n"))
+	if !ok {
+		return nil, errors.New("state does not name its sender")
+	}
+	if !a.restricted() {
+		return state, nil
+	}
+	ml := a.ml.Load()
+	if ml == nil {
+		return nil, errors.New("not started")
+	}
+	for _, n := range ml.Members() {
+		if n.Name == string(sender) {
+			return state, nil
+		}
+	}
+	return nil, fmt.Errorf("sender %s is not a swarm member", sender)
+}
@@ -0,0 +1,278 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"gnomatix/dreamfs/v2/pkg/alert"
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Per-Peer Replication Lag
+// ------------------------
+
+// Replication paths a peer's records arrive by.
+const (
+	ViaSwarm = "swarm" // Gossip and state sync; the peer is the records' host ID
+	ViaPull  = "pull"  // 'indexer replicate'; the peer is the upstream URL
+)
+
+// PeerLag is how current this node is with one peer's records.
+type PeerLag struct {
+	Peer      string    `json:"peer"`
+	Via       string    `json:"via"`
+	LastSeq   string    `json:"lastSeq,omitempty"` // Newest sequence received (pulls)
+	Newest    string    `json:"newest,omitempty"`  // Newest record modification time received (swarm)
+	Received  int64     `json:"received"`          // Records received since this node started (swarm) or written in total (pulls)
+	LastMerge time.Time `json:"lastMerge"`
+	Lag       float64   `json:"lagSeconds"` // Seconds since LastMerge
+	LastError string    `json:"lastError,omitempty"`
+	Lagging   bool      `json:"lagging"` // Lag is over the alert threshold
+}
+
+// swarmLag tracks, per host, the records merged from the swarm since this
+// node started, and when this node last found itself current with the host:
+// a record merged, or a digest or range sync that left nothing to merge. It
+// is kept in memory: every peer's digest arrives within a push/pull
+// interval, so it is rebuilt within one.
+var swarmLag = struct {
+	sync.Mutex
+	peers map[string]*PeerLag
+}{peers: map[string]*PeerLag{}}
+
+// noteSwarmMerge records that a record of meta's host arrived from the
+// swarm. This node's own records, echoed back by peers, are not counted.
+func noteSwarmMerge(meta metadata.FileMetadata, at time.Time) {
+	if meta.HostID == "" || meta.HostID == utils.HostID {
+		return
+	}
+	swarmLag.Lock()
+	defer swarmLag.Unlock()
+	p := swarmPeer(meta.HostID)
+	p.Received++
+	p.LastMerge = at
+	if meta.ModTime > p.Newest {
+		p.Newest = meta.ModTime
+	}
+}
+
+// noteSwarmContact records that this node was found current with host: its
+// digest matched, or a sync with it completed.
+func noteSwarmContact(host string, at time.Time) {
+	if host == "" || host == utils.HostID {
+		return
+	}
+	swarmLag.Lock()
+	defer swarmLag.Unlock()
+	swarmPeer(host).LastMerge = at
+}
+
+// swarmPeer returns the lag entry of a host, adding it if new. swarmLag must
+// be locked.
+func swarmPeer(host string) *PeerLag {
+	p, ok := swarmLag.peers[host]
+	if !ok {
+		p = &PeerLag{Peer: host, Via: ViaSwarm}
+		swarmLag.peers[host] = p
+	}
+	return p
+}
+
+// LagThreshold returns how long a peer may go without a merge before it
+// counts as lagging ("lagAlert"; 0 disables lag alerts).
+func LagThreshold() time.Duration {
+	return viper.GetDuration("lagAlert")
+}
+
+// CollectPeerLag returns the replication lag of every swarm peer seen since
+// this node started and every upstream pulled from, most lagging first.
+func CollectPeerLag(ps *storage.PersistentStore) ([]PeerLag, error) {
+	now := time.Now()
+	var peers []PeerLag
+	swarmLag.Lock()
+	for _, p := range swarmLag.peers {
+		peers = append(peers, *p)
+	}
+	swarmLag.Unlock()
+	checkpoints, err := ps.Checkpoints()
+	if err != nil {
+		return nil, err
+	}
+	for _, cp := range checkpoints {
+		peers = append(peers, PeerLag{
+			Peer:      cp.Source,
+			Via:       ViaPull,
+			LastSeq:   cp.LastSeq,
+			Received:  cp.DocsWritten,
+			LastMerge: cp.LastSuccess,
+			LastError: cp.LastError,
+		})
+	}
+	threshold := LagThreshold()
+	for i := range peers {
+		p := &peers[i]
+		if !p.LastMerge.IsZero() {
+			p.Lag = now.Sub(p.LastMerge).Seconds()
+		}
+		p.Lagging = threshold > 0 && (p.LastMerge.IsZero() || now.Sub(p.LastMerge) > threshold)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Lag != peers[j].Lag {
+			return peers[i].Lag > peers[j].Lag
+		}
+		return peers[i].Peer < peers[j].Peer
+	})
+	return peers, nil
+}
+
+// LagMonitor alerts once when a peer starts lagging, and again only after
+// it has caught up in between.
+type LagMonitor struct {
+	ps      *storage.PersistentStore
+	alerted map[string]bool
+}
+
+// NewLagMonitor returns a monitor of the peers replicating into ps.
+func NewLagMonitor(ps *storage.PersistentStore) *LagMonitor {
+	return &LagMonitor{ps: ps, alerted: map[string]bool{}}
+}
+
+// Check compares every peer's lag with the threshold and sends an alert for
+// each peer newly over it.
+func (m *LagMonitor) Check() error {
+	threshold := LagThreshold()
+	if threshold <= 0 {
+		return nil
+	}
+	peers, err := CollectPeerLag(m.ps)
+	if err != nil {
+		return err
+	}
+	for _, p := range peers {
+		key := p.Via + "|" + p.Peer
+		if !p.Lagging {
+			if m.alerted[key] {
+				log.Printf("Replication from %s (%s) caught up", p.Peer, p.Via)
+				delete(m.alerted, key)
+			}
+			continue
+		}
+		if m.alerted[key] {
+			continue
+		}
+		m.alerted[key] = true
+		msg := "no successful merge yet"
+		if !p.LastMerge.IsZero() {
+			msg = fmt.Sprintf("no merge for %s (threshold %s)", time.Duration(p.Lag*float64(time.Second)).Round(time.Second), threshold)
+		}
+		if p.LastError != "" {
+			msg += "; last error: " + p.LastError
+		}
+		alert.Send(alert.Alert{
+			Level:   alert.Warning,
+			Kind:    "replication-lag",
+			Subject: p.Peer,
+			Message: msg,
+			Details: map[string]interface{}{
+				"via":        p.Via,
+				"lagSeconds": p.Lag,
+				"lastMerge":  p.LastMerge,
+				"lastSeq":    p.LastSeq,
+			},
+		})
+	}
+	return nil
+}
+
+// WatchLag checks the peers' lag a few times per threshold, at least every
+// minute, until stop is closed.
+func WatchLag(ps *storage.PersistentStore, stop <-chan struct{}) {
+	interval := min(max(LagThreshold()/4, 10*time.Second), time.Minute)
+	m := NewLagMonitor(ps)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := m.Check(); err != nil {
+				log.Printf("Replication lag check failed: %v", err)
+			}
+		}
+	}
+}
+
+// privatePeerLag returns peers as privacy mode shows them: upstream URLs,
+// and the errors naming them, masked (see PrivateURL). Swarm peers are named
+// by host ID already.
+func privatePeerLag(peers []PeerLag) []PeerLag {
+	if !PrivacyEnabled() {
+		return peers
+	}
+	masked := make([]PeerLag, len(peers))
+	for i, p := range peers {
+		if p.Via == ViaPull {
+			p.LastError = privateError(p.LastError, p.Peer)
+			p.Peer = PrivateURL(p.Peer)
+		}
+		masked[i] = p
+	}
+	return masked
+}
+
+// HandleMetrics serves the per-peer replication metrics, and the indexing,
+// store, swarm and HTTP metrics of the daemon (see writeDaemonMetrics), in
+// the Prometheus text exposition format.
+func HandleMetrics(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	peers, err := CollectPeerLag(ps)
+	if err != nil {
+		http.Error(w, "failed to collect peer lag", http.StatusInternalServerError)
+		return
+	}
+	peers = privatePeerLag(peers)
+	var b strings.Builder
+	metric := func(name, help, typ string, value func(PeerLag) (float64, bool)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, p := range peers {
+			if v, ok := value(p); ok {
+				fmt.Fprintf(&b, "%s{peer=\"%s\",via=\"%s\"} %g\n", name, labelValue.Replace(p.Peer), p.Via, v)
+			}
+		}
+	}
+	metric("dreamfs_replication_lag_seconds", "Seconds since records from the peer were last merged.", "gauge",
+		func(p PeerLag) (float64, bool) { return p.Lag, !p.LastMerge.IsZero() })
+	metric("dreamfs_replication_last_merge_timestamp_seconds", "Unix time records from the peer were last merged.", "gauge",
+		func(p PeerLag) (float64, bool) { return float64(p.LastMerge.Unix()), !p.LastMerge.IsZero() })
+	metric("dreamfs_replication_received_records_total", "Records received from the peer.", "counter",
+		func(p PeerLag) (float64, bool) { return float64(p.Received), true })
+	metric("dreamfs_replication_error", "Whether the last pull from the peer failed.", "gauge",
+		func(p PeerLag) (float64, bool) { return boolMetric(p.LastError != ""), p.Via == ViaPull })
+	metric("dreamfs_replication_lagging", "Whether the peer is over the lag alert threshold.", "gauge",
+		func(p PeerLag) (float64, bool) { return boolMetric(p.Lagging), true })
+	fmt.Fprintf(&b, "# HELP dreamfs_replication_lag_alert_seconds The lag alert threshold (0 when disabled).\n")
+	fmt.Fprintf(&b, "# TYPE dreamfs_replication_lag_alert_seconds gauge\ndreamfs_replication_lag_alert_seconds %g\n", LagThreshold().Seconds())
+	writeDaemonMetrics(&b)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+// labelValue escapes a Prometheus label value.
+var labelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Leader Election for Cluster Maintenance
+// ------------------------
+
+// Leader returns the name of the swarm leader: the live member with the
+// lowest name. Every node computes the same answer from its membership view,
+// so no votes are exchanged; when the leader fails, memberlist's failure
+// detector drops it and the next-lowest member takes over. Node names embed
+// their start time, so a restarted node does not reclaim leadership. During
+// a network partition each side elects its own leader.
+func Leader(ml *memberlist.Memberlist) string {
+	leader := ""
+	for _, m := range ml.Members() {
+		if m.State == memberlist.StateAlive && (leader == "" || m.Name < leader) {
+			leader = m.Name
+		}
+	}
+	return leader
+}
+
+// IsLeader reports whether the local node leads the swarm. A node outside a
+// swarm (nil ml) leads itself.
+func IsLeader(ml *memberlist.Memberlist) bool {
+	return ml == nil || Leader(ml) == ml.LocalNode().Name
+}
+
+// MaintenanceTask is a cluster-wide duty that only the leader runs.
+type MaintenanceTask struct {
+	Name string
+	Run  func() error
+}
+
+// RunMaintenance runs the tasks every interval while the local node is the
+// leader, logging leadership changes, until ctx is done.
+func RunMaintenance(ctx context.Context, ml *memberlist.Memberlist, interval time.Duration, tasks []MaintenanceTask) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	leading := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if now := IsLeader(ml); now != leading {
+			leading = now
+			if leading {
+				log.Printf("Maintenance: this node is now the leader")
+			} else {
+				log.Printf("Maintenance: leadership passed to %s", Leader(ml))
+			}
+		}
+		if !leading {
+			continue
+		}
+		for _, task := range tasks {
+			if err := task.Run(); err != nil {
+				log.Printf("Maintenance: %s failed: %v", task.Name, err)
+			}
+		}
+	}
+}
+
+// purgeMsgPrefix marks a swarm message asking every node to purge the
+// tombstones written before the RFC 3339 time that follows it. Metadata
+// messages are JSON objects, so they never start with it.
+var purgeMsgPrefix = []byte("purge-tombstones ")
+
+// purgeRetiredMsgPrefix likewise asks every node to purge the records of
+// retired hosts due for purging before the time that follows it.
+var purgeRetiredMsgPrefix = []byte("purge-retired ")
+
+// MaintenanceBroadcast carries leader instructions to the swarm.
+type MaintenanceBroadcast struct {
+	Msg []byte
+}
+
+func (b *MaintenanceBroadcast) Message() []byte { return b.Msg }
+func (b *MaintenanceBroadcast) Finished()       {}
+func (b *MaintenanceBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	o, ok := other.(*MaintenanceBroadcast)
+	if !ok {
+		return false
+	}
+	for _, prefix := range [][]byte{purgeMsgPrefix, purgeRetiredMsgPrefix} {
+		if bytes.HasPrefix(o.Msg, prefix) && bytes.HasPrefix(b.Msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePurgeMsg applies a purge instruction from the leader.
+func (d *SwarmDelegate) handlePurgeMsg(msg []byte) {
+	cutoff, err := time.Parse(time.RFC3339, string(bytes.TrimPrefix(msg, purgeMsgPrefix)))
+	if err != nil {
+		log.Printf("Swarm: invalid purge message: %v", err)
+		return
+	}
+	n, err := d.ps.PurgeTombstones(cutoff)
+	if err != nil {
+		log.Printf("Swarm: failed to purge tombstones: %v", err)
+		return
+	}
+	log.Printf("Swarm: purged %d records of files deleted before %s", n, cutoff.Format(time.RFC3339))
+}
+
+// handlePurgeRetiredMsg applies a purge of retired hosts from the leader.
+func (d *SwarmDelegate) handlePurgeRetiredMsg(msg []byte) {
+	now, err := time.Parse(time.RFC3339, string(bytes.TrimPrefix(msg, purgeRetiredMsgPrefix)))
+	if err != nil {
+		log.Printf("Swarm: invalid purge message: %v", err)
+		return
+	}
+	n, err := d.ps.PurgeRetired(now)
+	if err != nil {
+		log.Printf("Swarm: failed to purge retired hosts: %v", err)
+		return
+	}
+	log.Printf("Swarm: purged %d records of retired hosts", n)
+}
+
+// TombstoneGCTask purges the files deleted more than retention ago from the
+// local store and tells the rest of the swarm (through d, if set) to do the
+// same. Retention must exceed the longest time a node may stay offline, or
+// a returning node can push the purged revisions back as live files.
+func TombstoneGCTask(ps *storage.PersistentStore, d *SwarmDelegate, retention time.Duration) MaintenanceTask {
+	return MaintenanceTask{Name: "tombstone GC", Run: func() error {
+		cutoff := time.Now().Add(-retention)
+		n, err := ps.PurgeTombstones(cutoff)
+		if err != nil {
+			return err
+		}
+		if d != nil {
+			msg := append(append([]byte(nil), purgeMsgPrefix...), cutoff.Format(time.RFC3339)...)
+			d.Broadcasts.QueueBroadcast(&MaintenanceBroadcast{Msg: msg})
+		}
+		log.Printf("Maintenance: purged %d records of files deleted before %s", n, cutoff.Format(time.RFC3339))
+		return nil
+	}}
+}
+
+// RetiredHostsTask purges the records of retired hosts whose retention
+// (see 'indexer host retire --purge-after') has run out from the local
+// store, and tells the rest of the swarm (through d, if set) to do the same.
+func RetiredHostsTask(ps *storage.PersistentStore, d *SwarmDelegate) MaintenanceTask {
+	return MaintenanceTask{Name: "retired host purge", Run: func() error {
+		now := time.Now()
+		n, err := ps.PurgeRetired(now)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if d != nil {
+			msg := append(append([]byte(nil), purgeRetiredMsgPrefix...), now.Format(time.RFC3339)...)
+			d.Broadcasts.QueueBroadcast(&MaintenanceBroadcast{Msg: msg})
+		}
+		log.Printf("Maintenance: purged %d records of retired hosts", n)
+		return nil
+	}}
+}
+
+// PinsTask reconciles the replication factor of pinned content: it plans
+// copies of under-replicated content between live members and, through d if
+// set, asks the target hosts to fetch them (see PinCopier). Copies count
+// once the targets' records replicate, so tasks are sent again each run
+// until then; targets ignore those already in progress.
+func PinsTask(ps *storage.PersistentStore, d *SwarmDelegate, policies []PinPolicy) MaintenanceTask {
+	return MaintenanceTask{Name: "pin reconciliation", Run: func() error {
+		latest, err := ps.Latest()
+		if err != nil {
+			return err
+		}
+		var live map[string]string
+		if d != nil {
+			live = d.LiveHosts()
+		}
+		for _, r := range CheckPins(latest, policies, live) {
+			sent := 0
+			if d != nil {
+				sent = d.DispatchPinCopies(r.Tasks)
+			}
+			log.Printf("Maintenance: pin policy %s: %d/%d contents compliant, %d under-replicated, %d copies planned, %d dispatched",
+				r.Policy, r.Compliant, r.Pinned, len(r.UnderReplicated), len(r.Tasks), sent)
+		}
+		return nil
+	}}
+}
+
+// ReportTask logs a summary of the cluster as seen by the replicated store.
+func ReportTask(ps *storage.PersistentStore, ml *memberlist.Memberlist) MaintenanceTask {
+	return MaintenanceTask{Name: "cluster report", Run: func() error {
+		records, err := ps.Count()
+		if err != nil {
+			return err
+		}
+		latest, err := ps.Latest()
+		if err != nil {
+			return err
+		}
+		hosts := map[string]bool{}
+		var total int64
+		for _, meta := range latest {
+			hosts[meta.HostID] = true
+			total += meta.Size
+		}
+		members := 1
+		if ml != nil {
+			members = ml.NumMembers()
+		}
+		log.Printf("Maintenance: cluster report: %d members, %d indexed hosts, %d files (%s), %d records",
+			members, len(hosts), len(latest), utils.FormatBytes(total), records)
+		return nil
+	}}
+}
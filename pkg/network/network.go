@@ -1,6 +1,8 @@
 package network
 
 import (
+	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -10,10 +12,10 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/color"
-	"github.com/hashicorp/mdns"
 	"github.com/hashicorp/memberlist"
 	"github.com/spf13/viper"
 
@@ -30,6 +32,13 @@ var (
 	peerListMutex sync.Mutex
 )
 
+// Peers returns the peer addresses collected by /peerlist.
+func Peers() []string {
+	peerListMutex.Lock()
+	defer peerListMutex.Unlock()
+	return append([]string{}, peerList...)
+}
+
 func HandlePeerList(w http.ResponseWriter, r *http.Request) {
 	// Extract remote IP address.
 	host, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -58,24 +67,148 @@ func HandlePeerList(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func StartHTTPServer(addr string, ps *storage.PersistentStore) {
-	http.HandleFunc("/_changes", func(w http.ResponseWriter, r *http.Request) {
-		metas, err := ps.GetAll()
-		if err != nil {
-			http.Error(w, "failed to get metadata", http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(metas); err != nil {
-			color.Red("failed to encode changes: %v", err)
+// HandleFind answers a CouchDB-style Mango query. Only equality selectors are
+// supported, e.g. {"selector": {"contentType": "image/jpeg", "tags": "raw"}};
+// selectors on indexed Extra fields are served from the secondary indexes.
+func HandleFind(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a JSON body with a selector", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	selector := make(map[string]string, len(req.Selector))
+	for field, v := range req.Selector {
+		if op, ok := v.(map[string]interface{}); ok {
+			eq, ok := op["$eq"]
+			if !ok || len(op) != 1 {
+				http.Error(w, fmt.Sprintf("unsupported operator for field %s (only $eq)", field), http.StatusBadRequest)
+				return
+			}
+			v = eq
 		}
+		selector[field] = fmt.Sprint(v)
+	}
+	docs, err := ps.Find(selector)
+	if err == nil {
+		docs, err = sealAll(ps, docs)
+	}
+	if err != nil {
+		http.Error(w, "failed to query metadata", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"docs": docs}); err != nil {
+		color.Red("failed to encode find results: %v", err)
+	}
+}
+
+// StartHTTPServer serves the replication endpoints on addr until ctx is
+// cancelled, then shuts down gracefully: it stops accepting connections,
+// fails /readyz, ends waiting _changes feeds and lets in-flight requests
+// finish for up to ShutdownTimeout before closing what remains. It returns
+// the error that stopped it, or nil after a clean shutdown.
+func StartHTTPServer(ctx context.Context, addr string, ps *storage.PersistentStore) error {
+	http.HandleFunc("/_changes", func(w http.ResponseWriter, r *http.Request) {
+		HandleChanges(w, r, ps)
+	})
+	http.HandleFunc("/files", func(w http.ResponseWriter, r *http.Request) {
+		HandleFiles(w, r, ps)
+	})
+	http.HandleFunc("/_find", func(w http.ResponseWriter, r *http.Request) {
+		HandleFind(w, r, ps)
+	})
+	http.HandleFunc("/_query", func(w http.ResponseWriter, r *http.Request) {
+		HandleQuery(w, r, ps)
+	})
+	http.HandleFunc("/_bulk_docs", func(w http.ResponseWriter, r *http.Request) {
+		HandleBulkDocs(w, r, ps)
+	})
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		HandleDBInfo(w, r, ps)
+	})
+	http.HandleFunc("/doc/", func(w http.ResponseWriter, r *http.Request) {
+		HandleDoc(w, r, ps)
+	})
+	http.HandleFunc("/_local/", func(w http.ResponseWriter, r *http.Request) {
+		HandleLocalDoc(w, r, ps)
+	})
+	http.HandleFunc("/_revs_diff", func(w http.ResponseWriter, r *http.Request) {
+		HandleRevsDiff(w, r, ps)
+	})
+	http.HandleFunc("/_bulk_get", func(w http.ResponseWriter, r *http.Request) {
+		HandleBulkGet(w, r, ps)
+	})
+	if viper.GetBool("serveBlobs") {
+		http.HandleFunc("/blob/", func(w http.ResponseWriter, r *http.Request) {
+			HandleBlob(w, r, ps)
+		})
+	}
+	if viper.GetBool("servePreviews") {
+		http.HandleFunc("/preview/", func(w http.ResponseWriter, r *http.Request) {
+			HandlePreview(w, r, ps)
+		})
+	}
+	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		HandleStats(w, r, ps)
 	})
 	http.HandleFunc("/peerlist", HandlePeerList) // Corrected call
+	http.HandleFunc("/cluster", func(w http.ResponseWriter, r *http.Request) {
+		HandleCluster(w, r, ps)
+	})
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		HandleMetrics(w, r, ps)
+	})
+	http.HandleFunc("/_digest", func(w http.ResponseWriter, r *http.Request) {
+		HandleDigest(w, r, ps)
+	})
+	http.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+		HandleSync(w, r, ps)
+	})
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		HandleHealthz(w, r, ps)
+	})
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		HandleReadyz(w, r, ps)
+	})
+
+	tlsConfig, err := ServerTLSConfig()
+	if err != nil {
+		return fmt.Errorf("HTTP server TLS: %w", err)
+	}
+	handler := exemptProbes(http.DefaultServeMux, RequireToken(http.DefaultServeMux))
+	srv := &http.Server{Addr: addr, Handler: instrumentHTTP(http.DefaultServeMux, handler), TLSConfig: tlsConfig}
+	srv.RegisterOnShutdown(beginShutdown)
+	served := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			color.Blue("Starting HTTPS server on %s", addr)
+			served <- srv.ListenAndServeTLS("", "")
+		} else {
+			color.Blue("Starting HTTP server on %s", addr)
+			served <- srv.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
 
-	color.Blue("Starting HTTP server on %s", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatalf("HTTP server error: %v", err)
+	timeout := ShutdownTimeout()
+	color.Yellow("Shutting down HTTP server (waiting up to %s for requests in flight)", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("shutdown: %w", err)
 	}
+	return nil
 }
 
 // ------------------------
@@ -121,6 +254,8 @@ func (f *FileMetaBroadcast) Invalidates(other memberlist.Broadcast) bool {
 	return false
 }
 
+// PeerMetaBroadcast carries this node's resource metrics (see
+// QueuePeerMetrics); a newer one replaces any still queued.
 type PeerMetaBroadcast struct {
 	Msg []byte
 }
@@ -128,16 +263,29 @@ type PeerMetaBroadcast struct {
 func (p *PeerMetaBroadcast) Message() []byte { return p.Msg }
 func (p *PeerMetaBroadcast) Finished()       {}
 func (p *PeerMetaBroadcast) Invalidates(other memberlist.Broadcast) bool {
-	return false
+	_, ok := other.(*PeerMetaBroadcast)
+	return ok
 }
 
 type SwarmDelegate struct {
 	ps         *storage.PersistentStore
+	ml         *memberlist.Memberlist
 	Broadcasts *memberlist.TransmitLimitedQueue // Exported Broadcasts
+	digests    digestCache                      // See digest.go
+	auth       *joinAuth                        // See joinauth.go
+	syncs      syncRuns                         // See sync.go
+	batches    broadcastBatcher                 // See batch.go
+	claims     scanClaims                       // See scanclaims.go
+	pins       atomic.Pointer[PinCopier]        // See pinning.go
 }
 
 func NewSwarmDelegate(ps *storage.PersistentStore, ml *memberlist.Memberlist) *SwarmDelegate {
-	d := &SwarmDelegate{ps: ps}
+	d := &SwarmDelegate{ps: ps, ml: ml, auth: &joinAuth{}} // Open until StartSwarm loads the policy
+	d.batches = broadcastBatcher{
+		size:     DefaultBroadcastBatch,
+		wait:     DefaultBroadcastBatchWait,
+		maxBytes: memberlist.DefaultLocalConfig().UDPBufferSize - batchSlack,
+	}
 	d.Broadcasts = &memberlist.TransmitLimitedQueue{ // Use Broadcasts
 		NumNodes: func() int { return len(ml.Members()) },
 		RetransmitMult: 3,
@@ -145,29 +293,131 @@ func NewSwarmDelegate(ps *storage.PersistentStore, ml *memberlist.Memberlist) *S
 	return d
 }
 
+// QueueMetadata broadcasts a record to the swarm, sealed with the store's
+// realm, batched with the records queued around it (see batch.go).
+func (d *SwarmDelegate) QueueMetadata(meta metadata.FileMetadata) error {
+	sealed, err := d.ps.Realm().Seal(meta)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+	d.batches.add(d, data)
+	return nil
+}
+
+// sealAll seals records with the store's realm before they leave the node.
+func sealAll(ps *storage.PersistentStore, metas []metadata.FileMetadata) ([]metadata.FileMetadata, error) {
+	if ps.Realm() == nil {
+		return metas, nil
+	}
+	sealed := make([]metadata.FileMetadata, len(metas))
+	for i, meta := range metas {
+		var err error
+		if sealed[i], err = ps.Realm().Seal(meta); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
 func (d *SwarmDelegate) NodeMeta(limit int) []byte {
-	return []byte{}
+	return d.auth.nodeMeta()
 }
 
 func (d *SwarmDelegate) NotifyMsg(msg []byte) {
+	msg, ok := d.auth.verify(msg)
+	if !ok {
+		log.Printf("Swarm: dropped a message without a valid join token tag")
+		return
+	}
+	if bytes.HasPrefix(msg, purgeMsgPrefix) {
+		d.handlePurgeMsg(msg)
+		return
+	}
+	if bytes.HasPrefix(msg, purgeRetiredMsgPrefix) {
+		d.handlePurgeRetiredMsg(msg)
+		return
+	}
+	if bytes.HasPrefix(msg, pinCopyMsgPrefix) {
+		d.handlePinCopyMsg(msg)
+		return
+	}
+	if bytes.HasPrefix(msg, scanClaimMsgPrefix) {
+		d.handleScanClaim(msg)
+		return
+	}
+	if bytes.HasPrefix(msg, peerMetricsMsgPrefix) {
+		receivePeerMetrics(msg[len(peerMetricsMsgPrefix):])
+		return
+	}
+	if bytes.HasPrefix(msg, batchMsgPrefix) {
+		metas, err := decodeBatch(msg)
+		if err != nil {
+			log.Printf("Swarm: failed to decode metadata batch: %v", err)
+			return
+		}
+		for _, meta := range metas {
+			d.receiveMetadata(meta)
+		}
+		return
+	}
 	var meta metadata.FileMetadata
 	if err := json.Unmarshal(msg, &meta); err != nil {
 		log.Printf("Swarm: failed to unmarshal metadata: %v", err)
 		return
 	}
-	if err := d.ps.Put(meta); err != nil {
+	d.receiveMetadata(meta)
+}
+
+// receiveMetadata merges a record broadcast by a peer.
+func (d *SwarmDelegate) receiveMetadata(meta metadata.FileMetadata) {
+	meta = d.ps.Realm().Open(meta) // For the log; the store seals it again
+	stored, err := d.ps.Merge(meta)
+	if err != nil {
 		log.Printf("Swarm: failed to store metadata for %s: %v", meta.FilePath, err)
 		return
 	}
+	noteSwarmMerge(meta, time.Now())
+	if !stored {
+		log.Printf("Swarm: ignored superseded metadata for %s", meta.FilePath)
+		return
+	}
+	if meta.Deleted() {
+		log.Printf("Swarm: received deletion of %s", meta.FilePath)
+		return
+	}
 	log.Printf("Swarm: received and stored metadata for %s", meta.FilePath)
 }
 
 func (d *SwarmDelegate) GetBroadcasts(overhead, limit int) [][]byte {
-	return d.Broadcasts.GetBroadcasts(overhead, limit) // Use Broadcasts
+	msgs := d.Broadcasts.GetBroadcasts(overhead+d.auth.tagSize(), limit) // Use Broadcasts
+	for i, msg := range msgs {
+		msgs[i] = d.auth.sign(msg)
+	}
+	return msgs
 }
 
 func (d *SwarmDelegate) LocalState(join bool) []byte {
+	if state := d.localState(join); state != nil {
+		return d.auth.wrapState(state)
+	}
+	return nil
+}
+
+func (d *SwarmDelegate) localState(join bool) []byte {
+	if state := d.digestState(join); state != nil {
+		return state
+	}
+	if state := syncState(); state != nil {
+		return state
+	}
 	metas, err := d.ps.GetAll()
+	if err == nil {
+		metas, err = sealAll(d.ps, metas)
+	}
 	if err != nil {
 		return nil
 	}
@@ -179,15 +429,31 @@ func (d *SwarmDelegate) LocalState(join bool) []byte {
 }
 
 func (d *SwarmDelegate) MergeRemoteState(buf []byte, join bool) {
+	buf, err := d.auth.unwrapState(buf)
+	if err != nil {
+		log.Printf("Swarm: dropped remote state: %v", err)
+		return
+	}
+	if bytes.HasPrefix(buf, digestMsgPrefix) {
+		d.mergeDigest(buf)
+		return
+	}
+	if bytes.HasPrefix(buf, syncMsgPrefix) {
+		d.startSync(buf)
+		return
+	}
 	var metas []metadata.FileMetadata
 	if err := json.Unmarshal(buf, &metas); err != nil {
 		log.Printf("Swarm: failed to merge remote state: %v", err)
 		return
 	}
+	now := time.Now()
 	for _, meta := range metas {
-		if err := d.ps.Put(meta); err != nil {
+		if _, err := d.ps.Merge(meta); err != nil {
 			log.Printf("Swarm: failed to merge metadata for %s: %v", meta.FilePath, err)
+			continue
 		}
+		noteSwarmMerge(meta, now)
 	}
 }
 
@@ -207,7 +473,14 @@ func GetLocalIP() string {
 }
 
 func GetPeerListFromHTTP(url string) ([]string, error) {
-	resp, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := viper.GetString("seedToken"); token != "" { // Seed servers may require it
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := peerClient(0).Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -225,82 +498,74 @@ func StartSwarm(ps *storage.PersistentStore) (*memberlist.Memberlist, *SwarmDele
 	if err != nil {
 		hostname = "node"
 	}
+	hostname = PrivateHost(hostname) // Peers see the node by this name
 	cfg.Name = fmt.Sprintf("%s-%d", hostname, time.Now().UnixNano())
 	cfg.BindPort = viper.GetInt("swarmPort")
+	keyring, err := swarmKeyring()
+	if err != nil {
+		return nil, nil, err
+	}
+	if keyring != nil {
+		cfg.Keyring = keyring
+		// Refuse gossip that is not encrypted with an installed key
+		cfg.GossipVerifyIncoming = true
+		cfg.GossipVerifyOutgoing = true
+	}
+
+	auth, err := loadJoinAuth(cfg.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if auth.restricted() {
+		cfg.Alive = auth
+		cfg.Merge = auth
+		cfg.CIDRsAllowed = auth.allowCIDRs
+	}
 
 	ml, err := memberlist.Create(cfg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create memberlist: %w", err)
 	}
 	d := NewSwarmDelegate(ps, ml)
+	d.auth = auth
+	d.batches.size = viper.GetInt("broadcastBatch")
+	d.batches.wait = viper.GetDuration("broadcastBatchWait")
+	d.batches.maxBytes = cfg.UDPBufferSize - batchSlack
+	auth.ml.Store(ml)
 	cfg.Delegate = d
+	cfg.Events = d // Passes scan claims on to joining nodes and records them as known peers
+	// The node was created before its delegate; advertise its metadata now
+	if err := ml.UpdateNode(0); err != nil {
+		log.Printf("Swarm: failed to advertise node metadata: %v", err)
+	}
+	if path := viper.GetString("swarmKeyring"); keyring != nil && path != "" {
+		go watchKeyring(keyring, path)
+	}
 
-	peerListURL := viper.GetString("peerListURL")
-	if peerListURL != "" {
-		discovered, err := GetPeerListFromHTTP(peerListURL)
-		if err != nil {
-			log.Printf("HTTP peer list lookup error: %v", err)
-		} else if len(discovered) > 0 {
-			n, err := ml.Join(discovered)
-			if err != nil {
-				log.Printf("Failed to join HTTP-discovered peers: %v", err)
-			}
-			log.Printf("Joined %d HTTP-discovered peers", n)
-		} else {
-			log.Printf("No peers discovered from HTTP endpoint")
+	static := viper.GetStringSlice("peers")
+	if n := d.joinPeers(static); n > 0 {
+		log.Printf("Swarm: joined %d manual and known peers", n)
+	}
+	seedURL := viper.GetString("seedURL")
+	if seedURL != "" {
+		ttl := viper.GetDuration("seedTTL")
+		if ttl <= 0 {
+			ttl = time.Minute
 		}
-	} else if !viper.GetBool("stealth") {
-		ip := net.ParseIP(GetLocalIP())
-		srv, err := mdns.NewMDNSService(hostname, "_indexer._tcp", "", "", viper.GetInt("swarmPort"), []net.IP{ip}, []string{"Hello friend"})
+		go keepRegistered(ml, seedURL, viper.GetString("seedToken"), cfg.BindPort, ttl)
+	}
+	// A seed server stands in for discovery unless a backend is chosen
+	if mode := discoveryMode(); mode != "" && (seedURL == "" || viper.GetString("discovery") != "") {
+		disc, interval, err := newDiscoverer(mode, hostname, cfg.BindPort)
 		if err != nil {
-			log.Printf("mDNS service error: %v", err)
-		} else {
-			mdnsServer, err := mdns.NewServer(&mdns.Config{Zone: srv})
-			if err != nil {
-				log.Printf("mDNS server error: %v", err)
-			}
-			go func() {
-				<-time.After(10 * time.Minute)
-				mdnsServer.Shutdown()
-			}()
-		}
-		var discovered []string
-		entriesCh := make(chan *mdns.ServiceEntry, 4)
-		go func() {
-			for entry := range entriesCh {
-				if entry.AddrV4.String() == ip.String() {
-					continue
-				}
-				discovered = append(discovered, fmt.Sprintf("%s:%d", entry.AddrV4.String(), viper.GetInt("swarmPort")))
-			}
-		}()
-		err = mdns.Query(&mdns.QueryParam{
-			Service: "_indexer._tcp",
-			Domain:  "local",
-			Timeout: time.Second * 3,
-			Entries: entriesCh,
-		})
-		close(entriesCh)
-		if len(discovered) > 0 {
-			n, err := ml.Join(discovered)
-			if err != nil {
-				log.Printf("Swarm auto-discovery join error: %v", err)
-			}
-			log.Printf("Swarm auto-discovery: joined %d peers", n)
-		} else {
-			log.Printf("Swarm auto-discovery: no peers found")
-		}
-	} else {
-		peers := viper.GetStringSlice("peers")
-		if len(peers) > 0 {
-			n, err := ml.Join(peers)
-			if err != nil {
-				log.Printf("Swarm: failed to join manual peers: %v", err)
-			}
-			log.Printf("Swarm: joined %d manual peers", n)
+			ml.Shutdown()
+			return nil, nil, err
 		}
+		runDiscovery(ml, mode, disc, interval)
 	}
+	go d.keepJoined(static)
 
+	localSwarm.Store(d)
 	log.Printf("Swarm: node %s started on port %d", cfg.Name, cfg.BindPort)
 	return ml, d, nil
 }
\ No newline at end of file
@@ -0,0 +1,38 @@
+package network
+
+import "sync/atomic"
+
+// ------------------------
+// Peer Metrics Gossip
+// ------------------------
+
+// peerMetricsMsgPrefix starts a node's resource metrics, as encoded by
+// pkg/metrics, which this package only carries.
+var peerMetricsMsgPrefix = []byte("peer-metrics ")
+
+// peerMetricsHandler receives the metrics gossiped by other nodes.
+var peerMetricsHandler atomic.Pointer[func(data []byte)]
+
+// OnPeerMetrics has fn receive the metrics other swarm nodes gossip (see
+// QueuePeerMetrics).
+func OnPeerMetrics(fn func(data []byte)) {
+	peerMetricsHandler.Store(&fn)
+}
+
+func receivePeerMetrics(data []byte) {
+	if fn := peerMetricsHandler.Load(); fn != nil {
+		(*fn)(data)
+	}
+}
+
+// QueuePeerMetrics gossips this node's metrics to the swarm, replacing any
+// not yet sent.
+func (d *SwarmDelegate) QueuePeerMetrics(data []byte) {
+	msg := append(append([]byte{}, peerMetricsMsgPrefix...), data...)
+	d.Broadcasts.QueueBroadcast(&PeerMetaBroadcast{Msg: msg})
+}
+
+// NodeName returns this node's name in the swarm.
+func (d *SwarmDelegate) NodeName() string {
+	return d.ml.LocalNode().Name
+}
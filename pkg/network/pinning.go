@@ -0,0 +1,365 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/memberlist"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Content Pinning and Replication Factor
+// ------------------------
+
+// PinPolicy requires at least Copies hosts to hold every distinct content
+// (by BLAKE3 fingerprint) whose Field contains Value, e.g. "keep at least
+// three copies of content tagged archive".
+type PinPolicy struct {
+	Field  string `json:"field" mapstructure:"field"` // Defaults to "tags"
+	Value  string `json:"value" mapstructure:"value"`
+	Copies int    `json:"copies" mapstructure:"copies"`
+}
+
+func (p PinPolicy) String() string {
+	if p.Field == "" || p.Field == "tags" {
+		return fmt.Sprintf("%s=%d", p.Value, p.Copies)
+	}
+	return fmt.Sprintf("%s:%s=%d", p.Field, p.Value, p.Copies)
+}
+
+// ParsePinPolicy parses "archive=3" (content tagged archive) or
+// "field:value=N" for any other metadata field.
+func ParsePinPolicy(s string) (PinPolicy, error) {
+	sel, n, ok := strings.Cut(s, "=")
+	if !ok {
+		return PinPolicy{}, fmt.Errorf("pin policy %q: expected [field:]value=copies", s)
+	}
+	copies, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil || copies < 1 {
+		return PinPolicy{}, fmt.Errorf("pin policy %q: copies must be a positive integer", s)
+	}
+	p := PinPolicy{Field: "tags", Value: strings.TrimSpace(sel), Copies: copies}
+	if field, value, ok := strings.Cut(sel, ":"); ok {
+		p.Field, p.Value = strings.TrimSpace(field), strings.TrimSpace(value)
+	}
+	if p.Value == "" {
+		return PinPolicy{}, fmt.Errorf("pin policy %q: empty value", s)
+	}
+	return p, nil
+}
+
+// PinnedContent is one fingerprint covered by a policy and where it lives.
+type PinnedContent struct {
+	BLAKE3 string   `json:"blake3"`
+	Size   int64    `json:"size"`
+	Hosts  []string `json:"hosts"`
+	Path   string   `json:"path"` // A path on the first host, for reference
+
+	paths map[string]string // A path on each host
+}
+
+// CopyTask asks TargetHost to obtain a copy of a blob from SourceHost, whose
+// /blob endpoint is at SourceURL when the source is a live swarm member.
+type CopyTask struct {
+	BLAKE3     string `json:"blake3"`
+	Size       int64  `json:"size"`
+	SourceHost string `json:"sourceHost"`
+	SourcePath string `json:"sourcePath"`
+	SourceURL  string `json:"sourceURL,omitempty"`
+	TargetHost string `json:"targetHost"`
+}
+
+// PinReport is the compliance of the swarm with one policy.
+type PinReport struct {
+	Policy          PinPolicy       `json:"policy"`
+	Pinned          int             `json:"pinned"`    // Distinct contents covered
+	Compliant       int             `json:"compliant"` // Contents with enough copies
+	UnderReplicated []PinnedContent `json:"underReplicated,omitempty"`
+	Unsatisfiable   int             `json:"unsatisfiable"` // Need more copies than there are hosts
+	Tasks           []CopyTask      `json:"tasks,omitempty"`
+}
+
+// CheckPins evaluates each policy against the latest file revisions of every
+// known host (see PersistentStore.Latest). Copies are counted per host, so
+// several paths with the same content on one host count once. For
+// under-replicated content it schedules copies onto the hosts that do not
+// hold it, preferring those with the fewest bytes already scheduled.
+//
+// live maps the host IDs of the live swarm members to their HTTP URLs (see
+// LiveHosts). When it is set, copies are only scheduled between live hosts;
+// when nil, membership is unknown and every indexed host is a candidate.
+func CheckPins(latest []metadata.FileMetadata, policies []PinPolicy, live map[string]string) []PinReport {
+	hostSet := map[string]bool{}
+	if live == nil {
+		for _, meta := range latest {
+			hostSet[meta.HostID] = true
+		}
+	}
+	for h := range live {
+		hostSet[h] = true
+	}
+	hosts := make([]string, 0, len(hostSet))
+	for h := range hostSet {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	scheduled := map[string]int64{} // Bytes scheduled per target host, across policies
+	planned := map[string]bool{}    // blake3|target already scheduled by an earlier policy
+
+	reports := make([]PinReport, 0, len(policies))
+	for _, policy := range policies {
+		contents := pinnedContents(latest, policy)
+		report := PinReport{Policy: policy, Pinned: len(contents)}
+		for _, c := range contents {
+			missing := policy.Copies - len(c.Hosts)
+			if missing <= 0 {
+				report.Compliant++
+				continue
+			}
+			report.UnderReplicated = append(report.UnderReplicated, c)
+			if policy.Copies > len(hosts) {
+				report.Unsatisfiable++
+			}
+
+			holders := map[string]bool{}
+			source := ""
+			for _, h := range c.Hosts {
+				holders[h] = true
+				if _, ok := live[h]; source == "" && (live == nil || ok) {
+					source = h
+				}
+			}
+			if source == "" {
+				continue // No live host to copy from
+			}
+			var candidates []string
+			for _, h := range hosts {
+				if !holders[h] {
+					candidates = append(candidates, h)
+				}
+			}
+			sort.SliceStable(candidates, func(i, j int) bool {
+				return scheduled[candidates[i]] < scheduled[candidates[j]]
+			})
+			for _, target := range candidates {
+				if missing == 0 {
+					break
+				}
+				missing--
+				key := c.BLAKE3 + "|" + target
+				if planned[key] {
+					continue
+				}
+				planned[key] = true
+				scheduled[target] += c.Size
+				report.Tasks = append(report.Tasks, CopyTask{
+					BLAKE3: c.BLAKE3, Size: c.Size,
+					SourceHost: source, SourcePath: c.paths[source], SourceURL: live[source],
+					TargetHost: target,
+				})
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// pinnedContents groups the records matching a policy by fingerprint,
+// largest first.
+func pinnedContents(latest []metadata.FileMetadata, policy PinPolicy) []PinnedContent {
+	field := policy.Field
+	if field == "" {
+		field = "tags"
+	}
+	byHash := map[string]*PinnedContent{}
+	var pinned []string
+	for _, meta := range latest {
+		if meta.BLAKE3 == "" || !hasValue(&meta, field, policy.Value) {
+			continue
+		}
+		if _, ok := byHash[meta.BLAKE3]; !ok {
+			byHash[meta.BLAKE3] = &PinnedContent{BLAKE3: meta.BLAKE3, Size: meta.Size, paths: map[string]string{}}
+			pinned = append(pinned, meta.BLAKE3)
+		}
+	}
+	// Count every host holding pinned content, tagged there or not
+	for _, meta := range latest {
+		c, ok := byHash[meta.BLAKE3]
+		if !ok {
+			continue
+		}
+		if _, held := c.paths[meta.HostID]; !held {
+			c.Hosts = append(c.Hosts, meta.HostID)
+			c.paths[meta.HostID] = meta.FilePath
+		}
+	}
+
+	out := make([]PinnedContent, 0, len(pinned))
+	for _, hash := range pinned {
+		c := byHash[hash]
+		sort.Strings(c.Hosts)
+		c.Path = c.paths[c.Hosts[0]]
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Size != out[j].Size {
+			return out[i].Size > out[j].Size
+		}
+		return out[i].BLAKE3 < out[j].BLAKE3
+	})
+	return out
+}
+
+func hasValue(meta *metadata.FileMetadata, field, value string) bool {
+	for _, v := range meta.FieldStrings(field) {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------
+// Copy Dispatch
+// ------------------------
+
+// pinCopyMsgPrefix marks a swarm message from the leader asking the target
+// host of the CopyTask (JSON) that follows to fetch its copy.
+var pinCopyMsgPrefix = []byte("pin-copy ")
+
+// fingerprintPattern matches the fingerprints copies are named by.
+var fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// PinCopier makes the copies of pinned content the leader assigns to this
+// host: blobs are fetched from the source's /blob endpoint into Dir, checked
+// with Verify against a record of the content, and recorded with Index so
+// that they count towards the policy once replicated.
+type PinCopier struct {
+	Dir    string
+	Verify func(path string, meta metadata.FileMetadata) (bool, error)
+	Index  func(path string) error
+
+	mu      sync.Mutex
+	running map[string]bool // Fingerprints being copied
+}
+
+// SetPinCopier makes this node carry out the copy tasks addressed to it
+// (nil ignores them).
+func (d *SwarmDelegate) SetPinCopier(c *PinCopier) {
+	d.pins.Store(c)
+}
+
+// LiveHosts maps the host IDs of the live swarm members to the HTTP URLs
+// they advertise ("syncURL"; empty for nodes without one).
+func (d *SwarmDelegate) LiveHosts() map[string]string {
+	live := map[string]string{}
+	for _, n := range d.ml.Members() {
+		if n.State != memberlist.StateAlive {
+			continue
+		}
+		var meta nodeMeta
+		if json.Unmarshal(n.Meta, &meta) == nil && meta.HostID != "" {
+			live[meta.HostID] = meta.URL
+		}
+	}
+	return live
+}
+
+// DispatchPinCopies asks the target hosts of the tasks, through the swarm, to
+// make their copies. Tasks whose source has no URL cannot be served and are
+// skipped; it returns how many were sent.
+func (d *SwarmDelegate) DispatchPinCopies(tasks []CopyTask) int {
+	sent := 0
+	for _, t := range tasks {
+		if t.SourceURL == "" {
+			continue
+		}
+		data, err := json.Marshal(t)
+		if err != nil {
+			continue
+		}
+		msg := append(append([]byte(nil), pinCopyMsgPrefix...), data...)
+		if t.TargetHost == utils.HostID {
+			d.handlePinCopyMsg(msg) // Gossip is not delivered to the sender
+		} else {
+			d.Broadcasts.QueueBroadcast(&MaintenanceBroadcast{Msg: msg})
+		}
+		sent++
+	}
+	return sent
+}
+
+// handlePinCopyMsg starts the copy a leader's message asks of this host, in
+// the background, unless the same content is being copied already.
+func (d *SwarmDelegate) handlePinCopyMsg(msg []byte) {
+	var t CopyTask
+	if err := json.Unmarshal(bytes.TrimPrefix(msg, pinCopyMsgPrefix), &t); err != nil {
+		log.Printf("Swarm: invalid pin copy message: %v", err)
+		return
+	}
+	c := d.pins.Load()
+	if t.TargetHost != utils.HostID || c == nil || !fingerprintPattern.MatchString(t.BLAKE3) {
+		return
+	}
+	c.mu.Lock()
+	if c.running[t.BLAKE3] {
+		c.mu.Unlock()
+		return
+	}
+	if c.running == nil {
+		c.running = map[string]bool{}
+	}
+	c.running[t.BLAKE3] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.running, t.BLAKE3)
+			c.mu.Unlock()
+		}()
+		if err := d.copyPinned(c, t); err != nil {
+			log.Printf("Swarm: pinned copy of %s from %s failed: %v", t.BLAKE3, t.SourceURL, err)
+			return
+		}
+		log.Printf("Swarm: copied pinned content %s (%s) from %s", t.BLAKE3, utils.FormatBytes(t.Size), t.SourceURL)
+	}()
+}
+
+// copyPinned fetches and records one copy. A copy fetched earlier but not
+// yet counted is recorded again rather than fetched.
+func (d *SwarmDelegate) copyPinned(c *PinCopier, t CopyTask) error {
+	found, err := d.ps.Find(map[string]string{"blake3": t.BLAKE3})
+	if err != nil {
+		return err
+	}
+	var record *metadata.FileMetadata
+	for i := range found {
+		if !found[i].Deleted() {
+			record = &found[i]
+			break
+		}
+	}
+	if record == nil {
+		return fmt.Errorf("no record of the content")
+	}
+	verify := func(path string) (bool, error) { return c.Verify(path, *record) }
+	dest := filepath.Join(c.Dir, t.BLAKE3+filepath.Ext(record.FilePath))
+	if ok, err := verify(dest); err != nil || !ok {
+		if err := FetchBlob(t.SourceURL, t.BLAKE3, dest, verify); err != nil {
+			return err
+		}
+	}
+	return c.Index(dest)
+}
@@ -0,0 +1,146 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Content Previews
+// ------------------------
+
+// Preview sizes in KB: the default, and the most a request may ask for.
+const (
+	previewDefaultKB = 4
+	previewMaxKB     = 64
+)
+
+// Preview is the start of an indexed file, for showing without
+// transferring the whole file (see /blob).
+type Preview struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`     // Of the file now
+	MimeType  string `json:"mimeType"` // Sniffed from the start of the content
+	Binary    bool   `json:"binary"`   // Text is left empty
+	Text      string `json:"text,omitempty"`
+	Truncated bool   `json:"truncated"` // The file goes on past Text
+	Changed   bool   `json:"changed"`   // The file's size differs from the record's
+}
+
+// looksBinary reports whether data, the start of a file, is not text: it
+// holds NUL bytes, is not UTF-8, or is mostly control characters.
+func looksBinary(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	// A rune cut off at the end of the sample is fine
+	for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+	if !utf8.Valid(data) {
+		return true
+	}
+	control := 0
+	for _, b := range data {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' {
+			control++
+		}
+	}
+	return control*10 > len(data)
+}
+
+// readPreview reads up to limit bytes from the start of the file of meta.
+func readPreview(meta metadata.FileMetadata, limit int) (Preview, error) {
+	p := Preview{ID: meta.ID, Path: meta.FilePath}
+	f, err := os.Open(meta.FilePath)
+	if err != nil {
+		return p, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return p, err
+	}
+	if !info.Mode().IsRegular() {
+		return p, fs.ErrNotExist
+	}
+	data, err := io.ReadAll(io.LimitReader(f, int64(limit)))
+	if err != nil {
+		return p, err
+	}
+	p.Size = info.Size()
+	p.Changed = info.Size() != meta.Size
+	p.Truncated = int64(len(data)) < info.Size()
+	p.MimeType = http.DetectContentType(data)
+	if p.Binary = looksBinary(data); !p.Binary {
+		for len(data) > 0 && !utf8.Valid(data) {
+			data = data[:len(data)-1] // Drop a rune cut off at the limit
+		}
+		p.Text = string(data)
+	}
+	return p, nil
+}
+
+// HandlePreview serves GET /preview/<id>: the first ?kb= KB (default 4, at
+// most 64) of the file of the record with that ID, as a Preview. Only
+// current files this host indexed are previewed.
+func HandlePreview(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	id := strings.TrimPrefix(r.URL.Path, "/preview/")
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "GET /preview/<id>", http.StatusBadRequest)
+		return
+	}
+	kb := previewDefaultKB
+	if s := r.URL.Query().Get("kb"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid kb", http.StatusBadRequest)
+			return
+		}
+		kb = min(n, previewMaxKB)
+	}
+	meta, found, err := ps.Get(id)
+	if err != nil {
+		http.Error(w, "failed to read record", http.StatusInternalServerError)
+		return
+	}
+	if !found || meta.Deleted() || meta.Archived() {
+		http.NotFound(w, r)
+		return
+	}
+	if meta.HostID != utils.HostID {
+		http.Error(w, "file is not on this host", http.StatusNotFound)
+		return
+	}
+	p, err := readPreview(meta, kb*1024)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "file no longer exists", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		color.Red("failed to encode preview: %v", err)
+	}
+}
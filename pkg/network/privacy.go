@@ -0,0 +1,109 @@
+package network
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// Privacy Mode for Cluster Views
+// ------------------------
+
+// With "privacy" set, what a node tells others about itself and the cluster
+// -- its swarm node name (and so seed and member peer lists), mDNS
+// advertisement, metrics broadcasts and the /cluster, /metrics and /stats
+// views -- names hosts by hash and shows paths truncated, for screenshots
+// and demos and for sites that may not share them. The store and the local
+// commands keep the full values. Swarm addresses are left alone, since
+// peers join by them. Hashes are salted with "privacySalt", so that they
+// cannot be matched against guessed names by anyone without it; nodes
+// sharing a salt hash a name alike.
+
+// DefaultPrivacyPathDepth is how many leading directories of a path privacy
+// mode keeps.
+const DefaultPrivacyPathDepth = 1
+
+// privacyHashLen is the number of hex digits of a privacy hash shown.
+const privacyHashLen = 10
+
+// PrivacyEnabled reports whether privacy mode is on.
+func PrivacyEnabled() bool {
+	return viper.GetBool("privacy")
+}
+
+func privacyHash(s string) string {
+	sum := sha256.Sum256([]byte(viper.GetString("privacySalt") + "\x00" + s))
+	return hex.EncodeToString(sum[:])[:privacyHashLen]
+}
+
+// PrivateHost returns a hostname or IP address as privacy mode shows it:
+// "host-" and a hash. It returns host unchanged when privacy mode is off.
+func PrivateHost(host string) string {
+	if !PrivacyEnabled() || host == "" {
+		return host
+	}
+	return "host-" + privacyHash(host)
+}
+
+// PrivatePath returns a path as privacy mode shows it: its first
+// "privacyPathDepth" directories, then a hash of the rest keeping the
+// extension, e.g. /home/…/3fa9c1d2e0.jpg. It returns p unchanged when
+// privacy mode is off.
+func PrivatePath(p string) string {
+	if !PrivacyEnabled() || p == "" {
+		return p
+	}
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	parts := strings.Split(strings.TrimPrefix(slashed, "/"), "/")
+	depth := min(max(viper.GetInt("privacyPathDepth"), 0), len(parts)-1)
+	kept := strings.Join(parts[:depth], "/")
+	if strings.HasPrefix(slashed, "/") {
+		kept = "/" + kept
+	}
+	if depth > 0 {
+		kept += "/"
+	}
+	return kept + "…/" + privacyHash(p) + path.Ext(parts[len(parts)-1])
+}
+
+// PrivateURL returns a URL, such as a replication upstream's, with its host
+// hashed and its path truncated as privacy mode shows them. It returns u
+// unchanged when privacy mode is off.
+func PrivateURL(u string) string {
+	if !PrivacyEnabled() || u == "" {
+		return u
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return PrivatePath(u)
+	}
+	host := PrivateHost(parsed.Hostname())
+	if port := parsed.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	masked := parsed.Scheme + "://" + host
+	if p := strings.TrimSuffix(parsed.Path, "/"); p != "" {
+		masked += PrivatePath(p)
+	}
+	return masked
+}
+
+// privateError returns the text of an error about upstream u with the URL
+// shown as PrivateURL shows it.
+func privateError(msg, u string) string {
+	if !PrivacyEnabled() || msg == "" || u == "" {
+		return msg
+	}
+	parsed, err := url.Parse(u)
+	if err == nil && parsed.Hostname() != "" {
+		msg = strings.ReplaceAll(msg, strings.TrimSuffix(u, "/"), PrivateURL(u))
+		msg = strings.ReplaceAll(msg, parsed.Hostname(), PrivateHost(parsed.Hostname()))
+	}
+	return msg
+}
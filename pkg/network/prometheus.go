@@ -0,0 +1,215 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// Daemon Metrics (Prometheus)
+// ------------------------
+
+// Bucket upper bounds, in seconds, of the latency histograms.
+var (
+	requestBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	hashBuckets    = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60}
+	writeBuckets   = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+)
+
+// The instruments /metrics reports besides replication lag (see
+// HandleMetrics). Hashing is reported by the indexer (ObserveHash) and
+// store writes by the store (storage.ObserveWrites).
+var (
+	filesIndexed    atomic.Uint64
+	bytesHashed     atomic.Uint64
+	hashSeconds     = newHistogram(hashBuckets)
+	writeSeconds    = newHistogram(writeBuckets)
+	requestDuration = histogramVec{bounds: requestBuckets, byLabels: map[string]*histogram{}}
+)
+
+func init() {
+	storage.ObserveWrites(writeSeconds.observe)
+}
+
+// ObserveHash records a file fingerprinted for the index: the bytes read to
+// hash it and how long that took.
+func ObserveHash(bytes int64, took time.Duration) {
+	filesIndexed.Add(1)
+	bytesHashed.Add(uint64(max(bytes, 0)))
+	hashSeconds.observe(took)
+}
+
+// FilesIndexed returns how many files this process has fingerprinted for
+// the index.
+func FilesIndexed() uint64 {
+	return filesIndexed.Load()
+}
+
+// histogram counts durations into buckets, reported cumulatively as
+// Prometheus histograms are.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64 // Upper bounds in seconds, ascending; +Inf is implied
+	counts []uint64  // Per bucket, the last for +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	i := 0
+	for i < len(h.bounds) && s > h.bounds[i] {
+		i++
+	}
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += s
+	h.count++
+	h.mu.Unlock()
+}
+
+// write writes the series of the histogram, with labels (`a="b",...`) if
+// any.
+func (h *histogram) write(b *strings.Builder, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, n := range h.counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, le, cumulative)
+	}
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(b, "%s_sum%s %g\n%s_count%s %d\n", name, labels, h.sum, name, labels, h.count)
+}
+
+// histogramVec is a histogram per set of label values.
+type histogramVec struct {
+	mu       sync.Mutex
+	bounds   []float64
+	byLabels map[string]*histogram // By rendered labels
+}
+
+func (v *histogramVec) with(labels string) *histogram {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.byLabels[labels]
+	if !ok {
+		h = newHistogram(v.bounds)
+		v.byLabels[labels] = h
+	}
+	return h
+}
+
+func (v *histogramVec) write(b *strings.Builder, name string) {
+	v.mu.Lock()
+	labels := make([]string, 0, len(v.byLabels))
+	for l := range v.byLabels {
+		labels = append(labels, l)
+	}
+	v.mu.Unlock()
+	sort.Strings(labels)
+	for _, l := range labels {
+		v.with(l).write(b, name, l)
+	}
+}
+
+// statusRecorder notes the status a handler responds with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming responses (such as the continuous _changes feed)
+// streaming.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// instrumentHTTP times the requests mux serves through h, by the route
+// pattern they match (not the path, which would name every document),
+// method and status.
+func instrumentHTTP(mux *http.ServeMux, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		labels := fmt.Sprintf(`handler="%s",method="%s",code="%d"`, labelValue.Replace(route), labelValue.Replace(r.Method), rec.status)
+		requestDuration.with(labels).observe(time.Since(start))
+	})
+}
+
+// writeDaemonMetrics writes the indexing, store, swarm and HTTP metrics.
+func writeDaemonMetrics(b *strings.Builder) {
+	header := func(name, help, typ string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	header("dreamfs_files_indexed_total", "Files fingerprinted for the index.", "counter")
+	fmt.Fprintf(b, "dreamfs_files_indexed_total %d\n", filesIndexed.Load())
+	header("dreamfs_hashed_bytes_total", "Bytes read to fingerprint files.", "counter")
+	fmt.Fprintf(b, "dreamfs_hashed_bytes_total %d\n", bytesHashed.Load())
+	header("dreamfs_hash_duration_seconds", "Time to fingerprint a file.", "histogram")
+	hashSeconds.write(b, "dreamfs_hash_duration_seconds", "")
+	header("dreamfs_store_write_duration_seconds", "Time to commit a write transaction to the store (BoltDB or SQLite).", "histogram")
+	writeSeconds.write(b, "dreamfs_store_write_duration_seconds", "")
+	if d := localSwarm.Load(); d != nil {
+		peers := 0
+		for _, n := range d.ml.Members() {
+			if n.Name != d.ml.LocalNode().Name && memberState(n.State) == MemberAlive {
+				peers++
+			}
+		}
+		header("dreamfs_swarm_peers", "Other swarm members alive.", "gauge")
+		fmt.Fprintf(b, "dreamfs_swarm_peers %d\n", peers)
+		header("dreamfs_broadcast_queue_depth", "Gossip broadcasts queued for the swarm.", "gauge")
+		fmt.Fprintf(b, "dreamfs_broadcast_queue_depth %d\n", d.Broadcasts.NumQueued())
+	}
+	header("dreamfs_http_request_duration_seconds", "Time to serve an HTTP request, by route pattern.", "histogram")
+	requestDuration.write(b, "dreamfs_http_request_duration_seconds")
+}
@@ -0,0 +1,108 @@
+package network
+
+import (
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// Known Peers and Rejoining the Swarm
+// ------------------------
+
+// A node records the peers it is joined with in the store (see
+// storage.KnownPeer) and joins them again on its next start, along with
+// --peers. While it has no other members -- every peer was down at start,
+// or all have since left -- it keeps trying them in the background, backing
+// off exponentially between attempts.
+
+const (
+	// rejoinMinBackoff and rejoinMaxBackoff bound the wait between attempts
+	// to rejoin while the node is alone.
+	rejoinMinBackoff = time.Second
+	rejoinMaxBackoff = 5 * time.Minute
+	// peerRefreshInterval is how often a joined node records its members as
+	// seen, and checks that it still has some.
+	peerRefreshInterval = time.Minute
+	// knownPeerTTL is how long a peer not seen is kept to rejoin.
+	knownPeerTTL = 7 * 24 * time.Hour
+)
+
+// knownPeerAddrs returns the addresses of the peers recorded in ps that
+// were seen within knownPeerTTL, forgetting the rest.
+func knownPeerAddrs(ps *storage.PersistentStore) []string {
+	if _, err := ps.ForgetPeers(time.Now().Add(-knownPeerTTL)); err != nil {
+		log.Printf("Swarm: failed to prune known peers: %v", err)
+	}
+	peers, err := ps.KnownPeers()
+	if err != nil {
+		log.Printf("Swarm: failed to read known peers: %v", err)
+		return nil
+	}
+	addrs := make([]string, 0, len(peers))
+	for _, p := range peers {
+		addrs = append(addrs, p.Addr)
+	}
+	return addrs
+}
+
+// notePeer records a member as seen now. memberlist reports joins holding
+// its node lock, so NotifyJoin calls it from another goroutine.
+func (d *SwarmDelegate) notePeer(n *memberlist.Node) {
+	if d.ml == nil || n.Name == d.ml.LocalNode().Name {
+		return
+	}
+	if err := d.ps.NotePeer(storage.KnownPeer{Addr: n.Address(), Name: n.Name, LastSeen: time.Now()}); err != nil {
+		log.Printf("Swarm: failed to record peer %s: %v", n.Address(), err)
+	}
+}
+
+// joinPeers joins the given addresses (--peers) and the known peers,
+// returning how many it reached.
+func (d *SwarmDelegate) joinPeers(static []string) int {
+	port := int(d.ml.LocalNode().Port)
+	var addrs []string
+	for _, p := range static {
+		addrs = append(addrs, withPort(p, port))
+	}
+	peers := freshPeers(d.ml, append(addrs, knownPeerAddrs(d.ps)...))
+	if len(peers) == 0 {
+		return 0
+	}
+	n, err := d.ml.Join(peers)
+	if n == 0 && err != nil {
+		log.Printf("Swarm: failed to join known peers: %v", err)
+	}
+	return n
+}
+
+// keepJoined records the members as seen every peerRefreshInterval, and
+// whenever the node finds itself alone, tries to rejoin static and the
+// known peers with exponential backoff until one answers.
+func (d *SwarmDelegate) keepJoined(static []string) {
+	backoff, wait := rejoinMinBackoff, rejoinMinBackoff
+	for {
+		time.Sleep(wait)
+		if d.ml.NumMembers() > 1 {
+			for _, m := range d.ml.Members() {
+				if m.State == memberlist.StateAlive {
+					d.notePeer(m)
+				}
+			}
+			backoff, wait = rejoinMinBackoff, peerRefreshInterval
+			continue
+		}
+		if n := d.joinPeers(static); n > 0 {
+			log.Printf("Swarm: rejoined %d peers", n)
+			backoff, wait = rejoinMinBackoff, peerRefreshInterval
+			continue
+		}
+		// Jittered so that nodes restarted together do not retry in step
+		wait = backoff/2 + rand.N(backoff/2+1)
+		backoff = min(backoff*2, rejoinMaxBackoff)
+	}
+}
@@ -0,0 +1,141 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// Pull Replication from Upstream Indexers
+// ------------------------
+
+// Replicate pulls the change feed of an upstream indexer (e.g.
+// http://nas:8080) into the local store and records a checkpoint for the
+// source, whether or not the pull succeeds. It returns the number of
+// documents written.
+func Replicate(ps *storage.PersistentStore, source string) (int, error) {
+	cp, _, err := ps.GetCheckpoint(source)
+	if err != nil {
+		return 0, fmt.Errorf("read checkpoint: %w", err)
+	}
+	cp.Source = source
+	cp.LastAttempt = time.Now()
+
+	written, lastSeq, err := pullChanges(ps, source, cp.LastSeq)
+	if err != nil {
+		cp.LastError = err.Error()
+	} else {
+		cp.LastError = ""
+		cp.LastSuccess = cp.LastAttempt
+		cp.DocsReceived = written
+		cp.DocsWritten += int64(written)
+		if lastSeq != "" {
+			cp.LastSeq = lastSeq
+		}
+	}
+	if perr := ps.PutCheckpoint(cp); perr != nil && err == nil {
+		err = fmt.Errorf("save checkpoint: %w", perr)
+	}
+	return written, err
+}
+
+// changesBatch is the number of changes requested per /_changes call.
+const changesBatch = 1000
+
+// pullChanges fetches the changes after since from the source's /_changes
+// feed, in batches, and stores every document. It returns the number of
+// documents written and the last sequence seen ("" if the source reports
+// none).
+func pullChanges(ps *storage.PersistentStore, source, since string) (int, string, error) {
+	written := 0
+	for {
+		n, more, lastSeq, err := pullChangesBatch(ps, source, since)
+		written += n
+		if err != nil {
+			return written, since, err
+		}
+		if lastSeq != "" {
+			since = lastSeq
+		}
+		if !more {
+			return written, since, nil
+		}
+	}
+}
+
+// pullChangesBatch fetches one batch of changes. Both a bare array of
+// documents (from indexers without sequence numbers, which send everything)
+// and a CouchDB-style {"results", "last_seq"} object are accepted; more
+// reports whether a full batch came back.
+func pullChangesBatch(ps *storage.PersistentStore, source, since string) (written int, more bool, lastSeq string, err error) {
+	params := url.Values{"include_docs": {"true"}, "limit": {strconv.Itoa(changesBatch)}}
+	if since != "" {
+		params.Set("since", since)
+	}
+	u := strings.TrimSuffix(source, "/") + "/_changes?" + params.Encode()
+	resp, err := peerClient(0).Get(u)
+	if err != nil {
+		return 0, false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, "", fmt.Errorf("unexpected status %s from %s", resp.Status, u)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return 0, false, "", fmt.Errorf("decode changes: %w", err)
+	}
+	var metas []metadata.FileMetadata
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+		var feed struct {
+			Results []struct {
+				Doc *metadata.FileMetadata `json:"doc"`
+			} `json:"results"`
+			LastSeq interface{} `json:"last_seq"`
+			Pending *int        `json:"pending"`
+		}
+		if err := json.Unmarshal(raw, &feed); err != nil {
+			return 0, false, "", fmt.Errorf("decode changes: %w", err)
+		}
+		for _, r := range feed.Results {
+			// Deletions are local to the source; files are removed
+			// cluster-wide by tombstones, which arrive as documents
+			if r.Doc != nil {
+				metas = append(metas, *r.Doc)
+			}
+		}
+		if feed.LastSeq != nil {
+			lastSeq = fmt.Sprint(feed.LastSeq)
+		}
+		if feed.Pending != nil {
+			more = *feed.Pending > 0 && len(feed.Results) > 0
+		} else {
+			more = len(feed.Results) >= changesBatch
+		}
+	} else if err := json.Unmarshal(raw, &metas); err != nil {
+		return 0, false, "", fmt.Errorf("decode changes: %w", err)
+	}
+
+	for _, meta := range metas {
+		stored, err := ps.Merge(meta)
+		if err != nil {
+			log.Printf("Replicate: failed to store metadata for %s: %v", meta.FilePath, err)
+			continue
+		}
+		if stored {
+			written++
+		}
+	}
+	return written, more, lastSeq, nil
+}
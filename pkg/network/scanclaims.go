@@ -0,0 +1,292 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Shared Scanning of Network Mounts
+// ------------------------
+
+// Nodes that index the same network share see its files at the same
+// canonical "device:path" (see fileprocessor.CanonicalizePath), so before a
+// scan they claim its subtrees over gossip: a node scans only the subtrees
+// no other node holds this cycle, and the records of the rest reach it
+// through replication. A claim lasts the cycle from its last renewal, so a
+// subtree is scanned once per cycle; claims of a node that leaves the swarm
+// mid-scan lapse with it. Of competing claims, that of a finished scan
+// wins, then the earliest, then that of the node with the lowest name, as
+// leadership goes (see Leader). Nodes pass the claims they know of on to
+// nodes that join, so that an index run started later in the cycle learns
+// of the scans of runs that have since exited.
+
+// scanClaimMsgPrefix starts a gossiped ScanClaim (as JSON).
+var scanClaimMsgPrefix = []byte("scan-claim ")
+
+// scanClaimSettle is how long a node waits after claiming subtrees for the
+// claims of others made at the same time.
+const scanClaimSettle = 2 * time.Second
+
+// ScanUnit is a subtree of a share, by canonical path. A FilesOnly unit
+// holds just the files directly in the directory, so that the root of a
+// scan can be claimed apart from its subdirectories.
+type ScanUnit struct {
+	Path      string `json:"path"`
+	FilesOnly bool   `json:"filesOnly,omitempty"`
+}
+
+// covers reports whether a claim on u takes in other as well.
+func (u ScanUnit) covers(other ScanUnit) bool {
+	if u == other {
+		return true
+	}
+	if u.FilesOnly {
+		return false
+	}
+	return other.Path == u.Path || strings.HasPrefix(other.Path, strings.TrimSuffix(u.Path, "/")+"/")
+}
+
+// ScanClaim is a node's claim on a subtree until Expires. Done claims are
+// of finished scans, and hold even after their node leaves.
+type ScanClaim struct {
+	ScanUnit
+	Node    string    `json:"node"` // memberlist node name
+	HostID  string    `json:"hostID"`
+	Claimed time.Time `json:"claimed"`
+	Expires time.Time `json:"expires"`
+	Done    bool      `json:"done,omitempty"`
+}
+
+// beats reports whether claim c wins over other.
+func (c ScanClaim) beats(other ScanClaim) bool {
+	if c.Done != other.Done {
+		return c.Done
+	}
+	if !c.Claimed.Equal(other.Claimed) {
+		return c.Claimed.Before(other.Claimed)
+	}
+	return c.Node < other.Node
+}
+
+type scanClaimKey struct {
+	unit ScanUnit
+	node string
+}
+
+// scanClaims holds the claims a node knows of, its own included.
+type scanClaims struct {
+	mu     sync.Mutex
+	claims map[scanClaimKey]ScanClaim
+}
+
+func (s *scanClaims) put(c ScanClaim) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.claims == nil {
+		s.claims = map[scanClaimKey]ScanClaim{}
+	}
+	s.claims[scanClaimKey{c.ScanUnit, c.Node}] = c
+}
+
+// holder returns the claim on u that wins, of those that have not expired
+// and are done or of a live node.
+func (s *scanClaims) holder(u ScanUnit, alive map[string]bool, now time.Time) (ScanClaim, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var best ScanClaim
+	found := false
+	for k, c := range s.claims {
+		if !c.Expires.After(now) {
+			delete(s.claims, k)
+			continue
+		}
+		if !c.covers(u) || (!c.Done && !alive[c.Node]) {
+			continue
+		}
+		if !found || c.beats(best) {
+			best, found = c, true
+		}
+	}
+	return best, found
+}
+
+// ScanClaimBroadcast carries a node's claim to the swarm.
+type ScanClaimBroadcast struct {
+	claim ScanClaim
+	Msg   []byte
+}
+
+func (b *ScanClaimBroadcast) Message() []byte { return b.Msg }
+func (b *ScanClaimBroadcast) Finished()       {}
+func (b *ScanClaimBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	o, ok := other.(*ScanClaimBroadcast)
+	return ok && o.claim.ScanUnit == b.claim.ScanUnit && o.claim.Node == b.claim.Node
+}
+
+// announce records the local node's claims on units and gossips them.
+func (d *SwarmDelegate) announce(units []ScanUnit, claimed, expires time.Time, done bool) {
+	for _, u := range units {
+		c := ScanClaim{ScanUnit: u, Node: d.ml.LocalNode().Name, HostID: utils.HostID, Claimed: claimed, Expires: expires, Done: done}
+		d.claims.put(c)
+		d.gossipClaim(c)
+	}
+}
+
+func (d *SwarmDelegate) gossipClaim(c ScanClaim) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	d.Broadcasts.QueueBroadcast(&ScanClaimBroadcast{claim: c, Msg: append(append([]byte{}, scanClaimMsgPrefix...), data...)})
+}
+
+// NotifyJoin passes the claims that still hold on to the swarm when a node
+// joins (memberlist.EventDelegate), and records the node as a known peer
+// (see rejoin.go). memberlist calls it holding its node lock, so both are
+// done from another goroutine.
+func (d *SwarmDelegate) NotifyJoin(n *memberlist.Node) {
+	go func() {
+		d.passClaims(n.Name)
+		d.notePeer(n)
+	}()
+}
+
+func (d *SwarmDelegate) passClaims(joined string) {
+	if d.ml == nil || joined == d.ml.LocalNode().Name {
+		return
+	}
+	alive, now := d.aliveNodes(), time.Now()
+	d.claims.mu.Lock()
+	var held []ScanClaim
+	for _, c := range d.claims.claims {
+		if c.Expires.After(now) && (c.Done || alive[c.Node]) {
+			held = append(held, c)
+		}
+	}
+	d.claims.mu.Unlock()
+	for _, c := range held {
+		d.gossipClaim(c)
+	}
+}
+
+func (d *SwarmDelegate) NotifyLeave(n *memberlist.Node)  {}
+func (d *SwarmDelegate) NotifyUpdate(n *memberlist.Node) {}
+
+// handleScanClaim records a peer's claim.
+func (d *SwarmDelegate) handleScanClaim(msg []byte) {
+	var c ScanClaim
+	if err := json.Unmarshal(bytes.TrimPrefix(msg, scanClaimMsgPrefix), &c); err != nil {
+		log.Printf("Swarm: invalid scan claim: %v", err)
+		return
+	}
+	d.claims.put(c)
+}
+
+func (d *SwarmDelegate) aliveNodes() map[string]bool {
+	alive := map[string]bool{}
+	for _, m := range d.ml.Members() {
+		if m.State == memberlist.StateAlive {
+			alive[m.Name] = true
+		}
+	}
+	return alive
+}
+
+// ScanLease is the local node's hold on the subtrees it claimed. It renews
+// itself until Finish or Release.
+type ScanLease struct {
+	d       *SwarmDelegate
+	units   []ScanUnit
+	claimed time.Time
+	cycle   time.Duration
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// ClaimScans claims the units no other node holds this cycle, waits for
+// competing claims, and returns the claims of other nodes on the units the
+// local node is not to scan (by index in units), with a lease on the rest.
+func (d *SwarmDelegate) ClaimScans(ctx context.Context, units []ScanUnit, cycle time.Duration) (map[int]ScanClaim, *ScanLease, error) {
+	self := d.ml.LocalNode().Name
+	others := map[int]ScanClaim{}
+	var wanted []int
+	alive, now := d.aliveNodes(), time.Now()
+	for i, u := range units {
+		if c, ok := d.claims.holder(u, alive, now); ok && c.Node != self {
+			others[i] = c
+			continue
+		}
+		wanted = append(wanted, i)
+	}
+	claimed := make([]ScanUnit, len(wanted))
+	for j, i := range wanted {
+		claimed[j] = units[i]
+	}
+	start := time.Now()
+	d.announce(claimed, start, start.Add(cycle), false)
+	if len(claimed) > 0 && len(d.ml.Members()) > 1 {
+		select {
+		case <-ctx.Done():
+			d.announce(claimed, start, time.Now(), false)
+			return nil, nil, ctx.Err()
+		case <-time.After(scanClaimSettle):
+		}
+	}
+
+	lease := &ScanLease{d: d, claimed: start, cycle: cycle, stop: make(chan struct{})}
+	var lost []ScanUnit
+	alive, now = d.aliveNodes(), time.Now()
+	for _, i := range wanted {
+		if c, ok := d.claims.holder(units[i], alive, now); ok && c.Node != self {
+			others[i] = c
+			lost = append(lost, units[i])
+			continue
+		}
+		lease.units = append(lease.units, units[i])
+	}
+	d.announce(lost, start, time.Now(), false) // Withdrawn, so they never outlive the winner's
+	go lease.renew()
+	return others, lease, nil
+}
+
+// renew extends the lease's claims every half cycle.
+func (l *ScanLease) renew() {
+	ticker := time.NewTicker(l.cycle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.d.announce(l.units, l.claimed, time.Now().Add(l.cycle), false)
+		}
+	}
+}
+
+// Finish marks the lease's subtrees scanned, keeping them claimed for the
+// rest of the cycle.
+func (l *ScanLease) Finish() {
+	l.once.Do(func() {
+		close(l.stop)
+		l.d.announce(l.units, l.claimed, time.Now().Add(l.cycle), true)
+	})
+}
+
+// Release gives the lease's subtrees up unscanned, e.g. when a scan is
+// interrupted, so that other nodes can scan them.
+func (l *ScanLease) Release() {
+	l.once.Do(func() {
+		close(l.stop)
+		l.d.announce(l.units, l.claimed, time.Now(), false)
+	})
+}
@@ -0,0 +1,279 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// ------------------------
+// Seed Server: Rendezvous for Networks without Multicast
+// ------------------------
+
+// SeedRegistration is what a node POSTs to a seed server's /register.
+type SeedRegistration struct {
+	Name string `json:"name"`           // Memberlist node name
+	Addr string `json:"addr,omitempty"` // host:port; the port alone uses the caller's address
+	Port int    `json:"port,omitempty"` // Swarm port, when Addr is empty
+	TTL  int    `json:"ttl"`            // Seconds until the entry expires unless renewed
+}
+
+// SeedPeer is a registered node as the seed server tracks it.
+type SeedPeer struct {
+	Name       string    `json:"name"`
+	Addr       string    `json:"addr"`
+	Registered time.Time `json:"registered"`
+	Expires    time.Time `json:"expires"`
+	Healthy    bool      `json:"healthy"`
+	LastCheck  time.Time `json:"lastCheck,omitempty"`
+}
+
+// SeedServer keeps the registry of a rendezvous server. Nodes register with
+// a shared token and a TTL and renew before it runs out; entries that are
+// not renewed expire. Peers are health-checked by connecting to their swarm
+// port, and only healthy, unexpired peers are handed out.
+type SeedServer struct {
+	token  string
+	maxTTL time.Duration
+
+	mu    sync.Mutex
+	peers map[string]*SeedPeer // By address
+}
+
+// NewSeedServer returns a seed server accepting registrations that carry
+// token (none if empty), with TTLs capped at maxTTL.
+func NewSeedServer(token string, maxTTL time.Duration) *SeedServer {
+	return &SeedServer{token: token, maxTTL: maxTTL, peers: map[string]*SeedPeer{}}
+}
+
+// authorized checks the request's bearer token.
+func (s *SeedServer) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+}
+
+// HandleRegister serves POST /register (register or renew, answered with
+// the other live peers as SeedPeer entries) and DELETE
+// /register?addr=host:port (leave).
+func (s *SeedServer) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.peers, r.URL.Query().Get("addr"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "POST a registration or DELETE ?addr=", http.StatusMethodNotAllowed)
+		return
+	}
+	var reg SeedRegistration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		http.Error(w, "invalid registration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	addr := reg.Addr
+	if addr == "" {
+		if reg.Port <= 0 {
+			http.Error(w, "registration needs addr or port", http.StatusBadRequest)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		addr = net.JoinHostPort(host, strconv.Itoa(reg.Port))
+	}
+	ttl := time.Duration(reg.TTL) * time.Second
+	if ttl <= 0 || ttl > s.maxTTL {
+		ttl = s.maxTTL
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	p, ok := s.peers[addr]
+	if !ok {
+		p = &SeedPeer{Addr: addr, Registered: now, Healthy: true} // Until the first check says otherwise
+		s.peers[addr] = p
+		log.Printf("Seed: registered %s (%s)", addr, reg.Name)
+	}
+	p.Name = reg.Name
+	p.Expires = now.Add(ttl)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.livePeers(addr)); err != nil {
+		http.Error(w, "failed to encode peer list", http.StatusInternalServerError)
+	}
+}
+
+// HandlePeerList serves GET /peerlist: the addresses of the healthy,
+// unexpired peers, as a JSON array (the format GetPeerListFromHTTP reads).
+// With ?verbose=true the full entries, including unhealthy ones, are listed.
+func (s *SeedServer) HandlePeerList(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Query().Get("verbose") == "true" {
+		s.mu.Lock()
+		peers := make([]SeedPeer, 0, len(s.peers))
+		for _, p := range s.peers {
+			peers = append(peers, *p)
+		}
+		s.mu.Unlock()
+		sort.Slice(peers, func(i, j int) bool { return peers[i].Addr < peers[j].Addr })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(peers)
+		return
+	}
+	addrs := []string{}
+	for _, p := range s.livePeers("") {
+		addrs = append(addrs, p.Addr)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(addrs); err != nil {
+		http.Error(w, "failed to encode peer list", http.StatusInternalServerError)
+	}
+}
+
+// livePeers returns the healthy, unexpired peers other than exclude, by
+// address.
+func (s *SeedServer) livePeers(exclude string) []SeedPeer {
+	now := time.Now()
+	s.mu.Lock()
+	peers := []SeedPeer{}
+	for addr, p := range s.peers {
+		if addr != exclude && p.Healthy && now.Before(p.Expires) {
+			peers = append(peers, *p)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Addr < peers[j].Addr })
+	return peers
+}
+
+// Run drops expired entries and health-checks the rest every interval
+// until ctx is done.
+func (s *SeedServer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		var addrs []string
+		s.mu.Lock()
+		for addr, p := range s.peers {
+			if now.After(p.Expires) {
+				delete(s.peers, addr)
+				log.Printf("Seed: %s (%s) expired", addr, p.Name)
+				continue
+			}
+			addrs = append(addrs, addr)
+		}
+		s.mu.Unlock()
+
+		for _, addr := range addrs {
+			conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+			healthy := err == nil
+			if healthy {
+				conn.Close()
+			}
+			s.mu.Lock()
+			if p, ok := s.peers[addr]; ok {
+				if p.Healthy != healthy {
+					log.Printf("Seed: %s (%s) is now %s", addr, p.Name, map[bool]string{true: "healthy", false: "unreachable"}[healthy])
+				}
+				p.Healthy, p.LastCheck = healthy, time.Now()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// RegisterWithSeed registers this node with a seed server (e.g.
+// http://seed:8080) and returns the other live peers it knows.
+func RegisterWithSeed(seedURL, token string, reg SeedRegistration) ([]SeedPeer, error) {
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return nil, err
+	}
+	u := strings.TrimSuffix(seedURL, "/") + "/register"
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := peerClient(federateTimeout).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, u)
+	}
+	var peers []SeedPeer
+	if err := json.NewDecoder(resp.Body).Decode(&peers); err != nil {
+		return nil, fmt.Errorf("decode peer list: %w", err)
+	}
+	return peers, nil
+}
+
+// keepRegistered registers with the seed server every third of ttl, joining
+// any peers it returns that are not members yet, so the node stays listed
+// for as long as it runs.
+func keepRegistered(ml *memberlist.Memberlist, seedURL, token string, port int, ttl time.Duration) {
+	reg := SeedRegistration{Name: ml.LocalNode().Name, Port: port, TTL: int(ttl / time.Second)}
+	for {
+		peers, err := RegisterWithSeed(seedURL, token, reg)
+		if err != nil {
+			log.Printf("Swarm: seed registration failed: %v", err)
+		} else {
+			known := map[string]bool{}
+			for _, m := range ml.Members() {
+				known[m.Name] = true
+			}
+			var fresh []string
+			for _, p := range peers {
+				if !known[p.Name] {
+					fresh = append(fresh, p.Addr)
+				}
+			}
+			if len(fresh) > 0 {
+				n, err := ml.Join(fresh)
+				if err != nil {
+					log.Printf("Swarm: failed to join seed peers: %v", err)
+				}
+				log.Printf("Swarm: joined %d peers from seed server", n)
+			}
+		}
+		time.Sleep(ttl / 3)
+	}
+}
@@ -0,0 +1,113 @@
+package network
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Store Statistics
+// ------------------------
+
+// Stats summarizes the local store for the stats command and /stats endpoint.
+type Stats struct {
+	Records       int                             `json:"records"`
+	IndexedFields []string                        `json:"indexedFields,omitempty"`
+	Replication   []storage.ReplicationCheckpoint `json:"replication"`
+	Extensions    struct {
+		Local   []ExtensionStat `json:"local"`
+		Cluster []ExtensionStat `json:"cluster"`
+	} `json:"extensions"`
+}
+
+// CollectStats gathers record counts, per-upstream replication checkpoints,
+// and per-extension composition of the latest file revisions.
+func CollectStats(ps *storage.PersistentStore) (Stats, error) {
+	var st Stats
+	var err error
+	if st.Records, err = ps.Count(); err != nil {
+		return st, err
+	}
+	st.IndexedFields = ps.IndexedFields()
+	if st.Replication, err = ps.Checkpoints(); err != nil {
+		return st, err
+	}
+	latest, err := ps.Latest()
+	if err != nil {
+		return st, err
+	}
+	st.Extensions.Local = ExtensionStats(latest, utils.HostID)
+	st.Extensions.Cluster = ExtensionStats(latest, "")
+	return st, nil
+}
+
+func HandleStats(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	st, err := CollectStats(ps)
+	if err != nil {
+		http.Error(w, "failed to collect stats", http.StatusInternalServerError)
+		return
+	}
+	if PrivacyEnabled() {
+		replication := make([]storage.ReplicationCheckpoint, len(st.Replication))
+		for i, cp := range st.Replication {
+			cp.LastError = privateError(cp.LastError, cp.Source)
+			cp.Source = PrivateURL(cp.Source)
+			replication[i] = cp
+		}
+		st.Replication = replication
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		color.Red("failed to encode stats: %v", err)
+	}
+}
+
+// ExtensionStat aggregates the files sharing one extension.
+type ExtensionStat struct {
+	Ext   string `json:"ext"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// ExtensionStats aggregates counts and bytes per lower-cased file extension,
+// largest total first. An empty hostID aggregates across the whole cluster.
+func ExtensionStats(metas []metadata.FileMetadata, hostID string) []ExtensionStat {
+	byExt := make(map[string]*ExtensionStat)
+	for _, meta := range metas {
+		if hostID != "" && meta.HostID != hostID {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(filepath.ToSlash(meta.FilePath)))
+		if ext == "" {
+			ext = "(none)"
+		}
+		st, ok := byExt[ext]
+		if !ok {
+			st = &ExtensionStat{Ext: ext}
+			byExt[ext] = st
+		}
+		st.Files++
+		st.Bytes += meta.Size
+	}
+	stats := make([]ExtensionStat, 0, len(byExt))
+	for _, st := range byExt {
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Bytes != stats[j].Bytes {
+			return stats[i].Bytes > stats[j].Bytes
+		}
+		return stats[i].Ext < stats[j].Ext
+	})
+	return stats
+}
@@ -0,0 +1,150 @@
+package network
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/spf13/viper"
+)
+
+// ------------------------
+// Swarm Gossip Encryption
+// ------------------------
+
+// With "swarmKey" or "swarmKeyring" set, memberlist encrypts and
+// authenticates all gossip (AES-GCM) and drops packets and streams that no
+// installed key opens, so nodes without the key can neither read the
+// swarm's records nor join it.
+//
+// A keyring file holds one key per line, the first encrypting outgoing
+// gossip and all of them accepted. It is reloaded every
+// keyringReloadInterval, so a key is rotated without a restart: add the new
+// key as a second line on every node, then move it first, then remove the
+// old key.
+
+// keyringReloadInterval is how often the keyring file is checked for changes.
+const keyringReloadInterval = 30 * time.Second
+
+// ParseSwarmKey decodes a swarm key given in hex or base64. Keys are 16, 24
+// or 32 bytes (AES-128, -192 or -256).
+func ParseSwarmKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, errors.New("swarm key is neither base64 nor hex")
+	}
+	if err := memberlist.ValidateKey(key); err != nil {
+		return nil, fmt.Errorf("swarm key: %w", err)
+	}
+	return key, nil
+}
+
+// readKeyring reads the keys of a keyring file, primary first. Blank lines
+// and lines starting with # are ignored.
+func readKeyring(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys [][]byte
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := ParseSwarmKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in %s", path)
+	}
+	return keys, nil
+}
+
+// swarmKeyring returns the keyring configured by "swarmKey" or
+// "swarmKeyring", or nil to gossip in the clear.
+func swarmKeyring() (*memberlist.Keyring, error) {
+	keyText, path := viper.GetString("swarmKey"), viper.GetString("swarmKeyring")
+	switch {
+	case keyText != "" && path != "":
+		return nil, errors.New("pass --swarm-key or --swarm-keyring, not both")
+	case keyText != "":
+		key, err := ParseSwarmKey(keyText)
+		if err != nil {
+			return nil, err
+		}
+		return memberlist.NewKeyring(nil, key)
+	case path != "":
+		keys, err := readKeyring(path)
+		if err != nil {
+			return nil, fmt.Errorf("read swarm keyring: %w", err)
+		}
+		return memberlist.NewKeyring(keys, keys[0])
+	}
+	return nil, nil
+}
+
+// watchKeyring installs the keys of the keyring file at path into kr
+// whenever the file changes. A file that fails to read or parse leaves the
+// installed keys as they are.
+func watchKeyring(kr *memberlist.Keyring, path string) {
+	var lastMod time.Time
+	if fi, err := os.Stat(path); err == nil {
+		lastMod = fi.ModTime()
+	}
+	for range time.Tick(keyringReloadInterval) {
+		fi, err := os.Stat(path)
+		if err != nil || fi.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod = fi.ModTime()
+		keys, err := readKeyring(path)
+		if err != nil {
+			log.Printf("Swarm: keyring not reloaded: %v", err)
+			continue
+		}
+		if err := installKeyring(kr, keys); err != nil {
+			log.Printf("Swarm: keyring not reloaded: %v", err)
+			continue
+		}
+		log.Printf("Swarm: reloaded %d keys from %s", len(keys), path)
+	}
+}
+
+// installKeyring makes keys, primary first, the keys of kr.
+func installKeyring(kr *memberlist.Keyring, keys [][]byte) error {
+	for _, key := range keys {
+		if err := kr.AddKey(key); err != nil {
+			return err
+		}
+	}
+	if err := kr.UseKey(keys[0]); err != nil {
+		return err
+	}
+	for _, old := range kr.GetKeys() {
+		keep := false
+		for _, key := range keys {
+			keep = keep || bytes.Equal(old, key)
+		}
+		if !keep {
+			if err := kr.RemoveKey(old); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
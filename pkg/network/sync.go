@@ -0,0 +1,496 @@
+package network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+	"github.com/zeebo/blake3"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Anti-Entropy Sync over Range Fingerprints
+// ------------------------
+
+// Each record is placed in a keyspace by the hex BLAKE3 of its ID, and a
+// range of the keyspace (a hex prefix) is summarized by its record count
+// and a hash over the hashes of its records (see recordHash): a Merkle tree
+// of fanout 16 computed on demand. Two nodes compare the children of the
+// ranges that differ, starting from the whole keyspace, until the ranges
+// are small; then they compare those ranges' record IDs and hashes, and
+// transfer only the records that differ. Everything goes through POST
+// /sync (see SyncRequest), so the exchange costs a few requests per level
+// of the tree rather than the whole state.
+//
+// Swarm nodes serving HTTP advertise their /sync URL in place of the full
+// state memberlist would otherwise carry on joins and after a digest
+// mismatch (see digest.go): a node receiving the URL pulls from it, and
+// since both sides of a push/pull do the same, records flow both ways.
+// Nodes without a sync URL ("syncURL", set by 'indexer serve') still send
+// the full state.
+
+const (
+	// syncLeafSize is the largest range whose records are listed rather
+	// than split further.
+	syncLeafSize = 256
+	// syncMaxDepth is the longest prefix a range is split to.
+	syncMaxDepth = 8
+	// syncBatch is the most ranges, or records, asked for per request.
+	syncBatch = 1000
+	// syncLeafBatch is the most small ranges listed per request.
+	syncLeafBatch = 64
+	// syncTimeout bounds each /sync request.
+	syncTimeout = 2 * time.Minute
+)
+
+// syncMsgPrefix marks a push/pull state that is a sync URL, followed by the
+// URL.
+var syncMsgPrefix = []byte("sync ")
+
+// RangeSummary summarizes the records of a keyspace range.
+type RangeSummary struct {
+	Count int    `json:"count"`
+	Hash  string `json:"hash"`
+}
+
+// SyncRequest is the body of POST /sync. Each field asks for something
+// different, and any may be combined.
+type SyncRequest struct {
+	Ranges  []string `json:"ranges,omitempty"`  // Prefixes whose children to summarize ("" is the whole keyspace)
+	Entries []string `json:"entries,omitempty"` // Prefixes whose records' IDs and hashes to list
+	Docs    []string `json:"docs,omitempty"`    // IDs of records to return
+}
+
+// SyncResponse answers a SyncRequest.
+type SyncResponse struct {
+	HostID  string                  `json:"hostId,omitempty"`  // The answering node
+	Ranges  map[string]RangeSummary `json:"ranges,omitempty"`  // Non-empty children, by prefix
+	Entries map[string]string       `json:"entries,omitempty"` // Record hash by ID
+	Docs    []metadata.FileMetadata `json:"docs,omitempty"`    // Sealed with the realm
+}
+
+// syncEntry is a record's place in the keyspace.
+type syncEntry struct {
+	key  string // Hex BLAKE3 of the ID
+	id   string
+	hash [32]byte
+}
+
+// syncIndex is the records of a store sorted by key.
+type syncIndex []syncEntry
+
+func buildSyncIndex(ps *storage.PersistentStore) (syncIndex, error) {
+	var idx syncIndex
+	err := ps.ForEach(func(meta metadata.FileMetadata) error {
+		h, err := recordHash(meta)
+		if err != nil {
+			return err
+		}
+		key := blake3.Sum256([]byte(meta.ID))
+		idx = append(idx, syncEntry{key: hex.EncodeToString(key[:8]), id: meta.ID, hash: h})
+		return nil
+	})
+	sort.Slice(idx, func(i, j int) bool { return idx[i].key < idx[j].key })
+	return idx, err
+}
+
+// span returns the entries of the range prefix.
+func (idx syncIndex) span(prefix string) syncIndex {
+	lo := sort.Search(len(idx), func(i int) bool { return idx[i].key >= prefix })
+	hi := lo + sort.Search(len(idx)-lo, func(i int) bool { return !strings.HasPrefix(idx[lo+i].key, prefix) })
+	return idx[lo:hi]
+}
+
+func (idx syncIndex) summary() RangeSummary {
+	if len(idx) == 0 {
+		return RangeSummary{}
+	}
+	sum := blake3.New()
+	for _, e := range idx {
+		sum.Write(e.hash[:])
+	}
+	return RangeSummary{Count: len(idx), Hash: hex.EncodeToString(sum.Sum(nil)[:16])}
+}
+
+// children summarizes the non-empty children of the range prefix.
+func (idx syncIndex) children(prefix string, into map[string]RangeSummary) {
+	if len(prefix) >= syncMaxDepth {
+		return
+	}
+	for _, c := range "0123456789abcdef" {
+		child := prefix + string(c)
+		if s := idx.span(child).summary(); s.Count > 0 {
+			into[child] = s
+		}
+	}
+}
+
+// syncIndexCache keeps the sync index of a store until it changes.
+type syncIndexCache struct {
+	mu  sync.Mutex
+	ps  *storage.PersistentStore
+	seq uint64
+	idx syncIndex
+}
+
+var syncIndexes syncIndexCache
+
+func (c *syncIndexCache) get(ps *storage.PersistentStore) (syncIndex, error) {
+	seq, err := ps.UpdateSeq()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ps == ps && c.seq == seq && c.idx != nil {
+		return c.idx, nil
+	}
+	idx, err := buildSyncIndex(ps)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		idx = syncIndex{}
+	}
+	c.ps, c.seq, c.idx = ps, seq, idx
+	return idx, nil
+}
+
+// HandleSync serves POST /sync (see SyncRequest). GET summarizes the
+// children of the whole keyspace.
+func HandleSync(w http.ResponseWriter, r *http.Request, ps *storage.PersistentStore) {
+	req := SyncRequest{Ranges: []string{""}}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		req = SyncRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid sync request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "GET or POST a sync request", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(req.Ranges)+len(req.Entries) > syncBatch || len(req.Docs) > syncBatch {
+		http.Error(w, fmt.Sprintf("at most %d ranges and %d docs per request", syncBatch, syncBatch), http.StatusBadRequest)
+		return
+	}
+	resp, err := answerSync(ps, req)
+	if err != nil {
+		http.Error(w, "failed to read records", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		color.Red("failed to encode sync response: %v", err)
+	}
+}
+
+func answerSync(ps *storage.PersistentStore, req SyncRequest) (SyncResponse, error) {
+	resp := SyncResponse{HostID: utils.HostID}
+	idx, err := syncIndexes.get(ps)
+	if err != nil {
+		return resp, err
+	}
+	if len(req.Ranges) > 0 {
+		resp.Ranges = map[string]RangeSummary{}
+		for _, prefix := range req.Ranges {
+			idx.children(prefix, resp.Ranges)
+		}
+	}
+	if len(req.Entries) > 0 {
+		resp.Entries = map[string]string{}
+		for _, prefix := range req.Entries {
+			for _, e := range idx.span(prefix) {
+				resp.Entries[e.id] = hex.EncodeToString(e.hash[:])
+			}
+		}
+	}
+	for _, id := range req.Docs {
+		meta, found, err := ps.Get(id)
+		if err != nil {
+			return resp, err
+		}
+		if !found {
+			continue
+		}
+		sealed, err := ps.Realm().Seal(meta)
+		if err != nil {
+			return resp, err
+		}
+		resp.Docs = append(resp.Docs, sealed)
+	}
+	return resp, nil
+}
+
+// SyncResult reports what a sync transferred.
+type SyncResult struct {
+	Peer     string `json:"peer,omitempty"` // The peer's host ID
+	Requests int    `json:"requests"`
+	Ranges   int    `json:"ranges"`   // Differing ranges whose records were compared
+	Received int    `json:"received"` // Records the peer sent
+	Stored   int    `json:"stored"`   // Received records that were stored
+	Pushed   int    `json:"pushed"`   // Records sent to the peer
+}
+
+// Sync brings ps up to date with the node at baseURL (e.g.
+// http://nas:8080), receiving only the records of the ranges that differ,
+// and with push also sends the peer the records it lacks or holds other
+// revisions of, through its /_bulk_docs.
+func Sync(ps *storage.PersistentStore, baseURL string, push bool) (SyncResult, error) {
+	var res SyncResult
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	local, err := syncIndexes.get(ps)
+	if err != nil {
+		return res, err
+	}
+	ask := func(req SyncRequest) (SyncResponse, error) {
+		res.Requests++
+		resp, err := postSync(baseURL, req)
+		if resp.HostID != "" {
+			res.Peer = resp.HostID
+		}
+		return resp, err
+	}
+
+	// Walk down the ranges that differ, a level per round
+	var leaves []string
+	for level := []string{""}; len(level) > 0; {
+		var next []string
+		for batch := range chunk(level, syncBatch) {
+			resp, err := ask(SyncRequest{Ranges: batch})
+			if err != nil {
+				return res, err
+			}
+			mine := map[string]RangeSummary{}
+			for _, prefix := range batch {
+				local.children(prefix, mine)
+			}
+			for child := range resp.Ranges {
+				if _, ok := mine[child]; !ok {
+					mine[child] = RangeSummary{} // Only the peer has records there
+				}
+			}
+			for child, l := range mine {
+				r := resp.Ranges[child]
+				switch {
+				case l == r:
+				case max(l.Count, r.Count) <= syncLeafSize || len(child) >= syncMaxDepth:
+					leaves = append(leaves, child)
+				default:
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+	res.Ranges = len(leaves)
+
+	// Compare the records of the differing ranges. Records both hold in
+	// different revisions go both ways; Merge decides which is kept.
+	var pull, send []string
+	for batch := range chunk(leaves, syncLeafBatch) {
+		resp, err := ask(SyncRequest{Entries: batch})
+		if err != nil {
+			return res, err
+		}
+		for _, prefix := range batch {
+			for _, e := range local.span(prefix) {
+				theirs, ok := resp.Entries[e.id]
+				delete(resp.Entries, e.id)
+				if ok && theirs == hex.EncodeToString(e.hash[:]) {
+					continue
+				}
+				send = append(send, e.id)
+				if ok {
+					pull = append(pull, e.id)
+				}
+			}
+		}
+		for id := range resp.Entries { // Held by the peer only
+			pull = append(pull, id)
+		}
+	}
+
+	for batch := range chunk(pull, syncBatch) {
+		resp, err := ask(SyncRequest{Docs: batch})
+		if err != nil {
+			return res, err
+		}
+		for _, meta := range resp.Docs {
+			res.Received++
+			stored, err := ps.Merge(meta)
+			if err != nil {
+				log.Printf("Sync: failed to store metadata for %s: %v", meta.FilePath, err)
+				continue
+			}
+			if stored {
+				res.Stored++
+			}
+			noteSwarmMerge(meta, time.Now())
+		}
+	}
+
+	if push && len(send) > 0 {
+		n, err := pushRecords(ps, baseURL, send)
+		res.Pushed += n
+		res.Requests += (len(send) + syncBatch - 1) / syncBatch
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// pushRecords sends the records with the given IDs to the peer's
+// /_bulk_docs, and returns how many it sent.
+func pushRecords(ps *storage.PersistentStore, baseURL string, ids []string) (int, error) {
+	sent := 0
+	for batch := range chunk(ids, syncBatch) {
+		var docs []metadata.FileMetadata
+		for _, id := range batch {
+			meta, found, err := ps.Get(id)
+			if err != nil {
+				return sent, err
+			}
+			if found {
+				docs = append(docs, meta)
+			}
+		}
+		docs, err := sealAll(ps, docs)
+		if err != nil {
+			return sent, err
+		}
+		body, err := json.Marshal(map[string]interface{}{"docs": docs, "new_edits": false})
+		if err != nil {
+			return sent, err
+		}
+		resp, err := peerClient(syncTimeout).Post(baseURL+"/_bulk_docs", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return sent, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			return sent, fmt.Errorf("%s/_bulk_docs: %s", baseURL, resp.Status)
+		}
+		sent += len(docs)
+	}
+	return sent, nil
+}
+
+func postSync(baseURL string, req SyncRequest) (SyncResponse, error) {
+	var out SyncResponse
+	body, err := json.Marshal(req)
+	if err != nil {
+		return out, err
+	}
+	resp, err := peerClient(syncTimeout).Post(baseURL+"/sync", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return out, fmt.Errorf("%s/sync: %s", baseURL, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	return out, err
+}
+
+// chunk yields s in slices of at most n.
+func chunk(s []string, n int) func(yield func([]string) bool) {
+	return func(yield func([]string) bool) {
+		for len(s) > 0 {
+			k := min(n, len(s))
+			if !yield(s[:k]) {
+				return
+			}
+			s = s[k:]
+		}
+	}
+}
+
+// DefaultSyncURL returns the URL peers reach the HTTP server listening on
+// addr at: on this host's address when addr has no host, and over HTTPS
+// when the server serves TLS.
+func DefaultSyncURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = GetLocalIP()
+	}
+	scheme := "http"
+	if viper.GetString("tlsCert") != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// syncState returns the push/pull state offering this node's sync URL, or
+// nil if it has none.
+func syncState() []byte {
+	url := viper.GetString("syncURL")
+	if url == "" || viper.GetBool("fullStateSync") {
+		return nil
+	}
+	return append(append([]byte{}, syncMsgPrefix...), url...)
+}
+
+// syncRuns keeps one sync per peer URL running at a time.
+type syncRuns struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// startSync pulls, in the background, from the peer whose sync URL a
+// push/pull state carried.
+func (d *SwarmDelegate) startSync(buf []byte) {
+	url := string(bytes.TrimPrefix(buf, syncMsgPrefix))
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") || url == viper.GetString("syncURL") {
+		return
+	}
+	d.syncs.mu.Lock()
+	if d.syncs.running[url] {
+		d.syncs.mu.Unlock()
+		return
+	}
+	if d.syncs.running == nil {
+		d.syncs.running = map[string]bool{}
+	}
+	d.syncs.running[url] = true
+	d.syncs.mu.Unlock()
+
+	go func() {
+		defer func() {
+			d.syncs.mu.Lock()
+			delete(d.syncs.running, url)
+			d.syncs.mu.Unlock()
+		}()
+		res, err := Sync(d.ps, url, false)
+		if err != nil {
+			log.Printf("Swarm: sync with %s failed after %d requests: %v", url, res.Requests, err)
+			return
+		}
+		// In sync with the peer as of now, even if nothing differed
+		noteSwarmContact(res.Peer, time.Now())
+		if res.Ranges > 0 {
+			log.Printf("Swarm: synced with %s: %d ranges differed, received %d records, stored %d", url, res.Ranges, res.Received, res.Stored)
+		}
+	}()
+}
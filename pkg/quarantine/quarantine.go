@@ -0,0 +1,163 @@
+package quarantine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ------------------------
+// Soft-Delete Quarantine
+// ------------------------
+
+// DefaultTTL is how long a quarantined file is kept before it may be purged.
+const DefaultTTL = 30 * 24 * time.Hour
+
+// Entry records a file moved into quarantine: where it came from, where it
+// is kept, and when it may be deleted for good.
+type Entry struct {
+	ID          string    `json:"id"`
+	HostID      string    `json:"hostID"`
+	Path        string    `json:"path"`       // Where the file was
+	StoredPath  string    `json:"storedPath"` // Where it is kept until restored or purged
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	Reason      string    `json:"reason,omitempty"`
+	Quarantined time.Time `json:"quarantined"`
+	Expires     time.Time `json:"expires"`
+}
+
+// Expired reports whether the grace period of e is over at now.
+func (e Entry) Expired(now time.Time) bool {
+	return !now.Before(e.Expires)
+}
+
+// DefaultDir returns the quarantine directory under the given XDG data
+// directory.
+func DefaultDir(dataHome string) string {
+	return filepath.Join(dataHome, "dreamfs", "quarantine")
+}
+
+// Move moves the regular file at path into dir, under a directory named by a
+// new entry ID, and returns the entry. Within one filesystem the file is
+// renamed; across filesystems it is copied (keeping its mode and times) and
+// the original removed.
+func Move(dir, path string, ttl time.Duration) (Entry, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return Entry{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return Entry{}, fmt.Errorf("%s is not a regular file", abs)
+	}
+	id, err := newID()
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, id), 0700); err != nil {
+		return Entry{}, err
+	}
+	stored := filepath.Join(dir, id, filepath.Base(abs))
+	if err := moveFile(abs, stored, info); err != nil {
+		os.Remove(filepath.Join(dir, id))
+		return Entry{}, err
+	}
+	now := time.Now().UTC()
+	return Entry{
+		ID:          id,
+		Path:        abs,
+		StoredPath:  stored,
+		Size:        info.Size(),
+		ModTime:     info.ModTime().UTC(),
+		Quarantined: now,
+		Expires:     now.Add(ttl),
+	}, nil
+}
+
+// Restore moves a quarantined file back to its original path, which must
+// not exist, recreating missing parent directories.
+func Restore(e Entry) error {
+	if _, err := os.Lstat(e.Path); err == nil {
+		return fmt.Errorf("%s already exists", e.Path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	info, err := os.Lstat(e.StoredPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0755); err != nil {
+		return err
+	}
+	if err := moveFile(e.StoredPath, e.Path, info); err != nil {
+		return err
+	}
+	os.Remove(filepath.Dir(e.StoredPath))
+	return nil
+}
+
+// Remove deletes a quarantined file for good. A file already gone is not
+// an error.
+func Remove(e Entry) error {
+	if err := os.Remove(e.StoredPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	os.Remove(filepath.Dir(e.StoredPath))
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// moveFile renames src to dst, copying across filesystems.
+func moveFile(src, dst string, info os.FileInfo) error {
+	err := os.Rename(src, dst)
+	var linkErr *os.LinkError
+	if err == nil || !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(src, dst, info); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
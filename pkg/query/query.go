@@ -0,0 +1,433 @@
+// Package query implements the filter expressions accepted by
+// "indexer query", e.g.
+//
+//	size > 100MB AND path ~ "*.mp4" AND modTime > 2024-01-01
+//
+// An expression is comparisons joined with AND, OR and NOT (in increasing
+// order of precedence) and grouped with parentheses. A comparison is
+// "field op value" where op is one of = != < <= > >= ~ (glob match) and !~.
+// Fields are FileMetadata JSON names (filePath, hostID, size, modTime,
+// blake3, _id, or any Extra field) or the aliases path, host, mtime, hash
+// and id. Keywords are case-insensitive.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// Expr is a parsed filter expression.
+type Expr interface {
+	Match(meta *metadata.FileMetadata) bool
+	String() string
+}
+
+// fieldAliases maps short names to FileMetadata JSON field names.
+var fieldAliases = map[string]string{
+	"path":  "filePath",
+	"host":  "hostID",
+	"mtime": "modTime",
+	"hash":  "blake3",
+	"id":    "_id",
+}
+
+// Parse parses a filter expression.
+func Parse(input string) (Expr, error) {
+	toks, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", t, t.pos)
+	}
+	return expr, nil
+}
+
+// ------------------------
+// Lexer
+// ------------------------
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		c := s[i]
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			toks = append(toks, token{tokString, b.String(), i})
+			i = j + 1
+		case strings.ContainsRune("=!<>~", r):
+			op := string(c)
+			if i+1 < len(s) && (s[i+1] == '=' || (c == '!' && s[i+1] == '~')) {
+				op += string(s[i+1])
+			}
+			if op == "!" || op == "~=" {
+				return nil, fmt.Errorf("unknown operator %q at offset %d", op, i)
+			}
+			toks = append(toks, token{tokOp, strings.Replace(op, "==", "=", 1), i})
+			i += len(op)
+		default:
+			j := i
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if unicode.IsSpace(r) || strings.ContainsRune("()=!<>~\"'", r) {
+					break
+				}
+				j += size
+			}
+			toks = append(toks, token{tokWord, s[i:j], i})
+			i = j
+		}
+	}
+	return append(toks, token{tokEOF, "", len(s)}), nil
+}
+
+// ------------------------
+// Parser
+// ------------------------
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	if t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at offset %d, got %s", t.pos, t)
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	f := p.next()
+	if f.kind != tokWord {
+		return nil, fmt.Errorf("expected a field name at offset %d, got %s", f.pos, f)
+	}
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, fmt.Errorf("expected an operator after %q at offset %d, got %s", f.text, op.pos, op)
+	}
+	v := p.next()
+	if v.kind != tokWord && v.kind != tokString {
+		return nil, fmt.Errorf("expected a value after %s at offset %d, got %s", op, v.pos, v)
+	}
+
+	field := f.text
+	if alias, ok := fieldAliases[strings.ToLower(field)]; ok {
+		field = alias
+	}
+	c := &comparison{field: field, op: op.text, raw: v.text}
+	switch {
+	case op.text == "~" || op.text == "!~":
+		re, err := globRegexp(v.text)
+		if err != nil {
+			return nil, err
+		}
+		c.glob = re
+	case field == "size":
+		n, err := ParseSize(v.text)
+		if err != nil {
+			return nil, fmt.Errorf("size %q: %w", v.text, err)
+		}
+		c.num, c.isNum = float64(n), true
+	case field == "modTime":
+		t, err := ParseTime(v.text)
+		if err != nil {
+			return nil, fmt.Errorf("modTime %q: expected YYYY-MM-DD or RFC 3339", v.text)
+		}
+		c.time, c.isTime = t, true
+	default:
+		// Other fields compare as numbers or dates when the literal is one
+		if n, err := strconv.ParseFloat(v.text, 64); err == nil && v.kind == tokWord {
+			c.num, c.isNum = n, true
+		} else if t, err := ParseTime(v.text); err == nil && v.kind == tokWord {
+			c.time, c.isTime = t, true
+		}
+	}
+	return c, nil
+}
+
+// ------------------------
+// Evaluation
+// ------------------------
+
+type andExpr struct{ left, right Expr }
+type orExpr struct{ left, right Expr }
+type notExpr struct{ inner Expr }
+
+func (e andExpr) Match(m *metadata.FileMetadata) bool { return e.left.Match(m) && e.right.Match(m) }
+func (e orExpr) Match(m *metadata.FileMetadata) bool  { return e.left.Match(m) || e.right.Match(m) }
+func (e notExpr) Match(m *metadata.FileMetadata) bool { return !e.inner.Match(m) }
+
+func (e andExpr) String() string { return "(" + e.left.String() + " AND " + e.right.String() + ")" }
+func (e orExpr) String() string  { return "(" + e.left.String() + " OR " + e.right.String() + ")" }
+func (e notExpr) String() string { return "NOT " + e.inner.String() }
+
+// comparison is "field op value". The literal is decoded once at parse time
+// as a number, time or glob, depending on the field and operator.
+type comparison struct {
+	field, op, raw string
+	num            float64
+	isNum          bool
+	time           time.Time
+	isTime         bool
+	glob           *regexp.Regexp
+}
+
+func (c *comparison) String() string { return c.field + " " + c.op + " " + strconv.Quote(c.raw) }
+
+// Match reports whether any value of the field satisfies the comparison, so
+// that list fields such as tags match if one element does. Missing fields
+// only satisfy the negative operators.
+func (c *comparison) Match(m *metadata.FileMetadata) bool {
+	found := false
+	for _, v := range m.FieldStrings(c.field) {
+		if c.matchValue(v) {
+			found = true
+			break
+		}
+	}
+	if c.op == "!=" || c.op == "!~" {
+		return !found
+	}
+	return found
+}
+
+// matchValue evaluates the comparison for one value; for the negative
+// operators it returns whether the positive form holds.
+func (c *comparison) matchValue(v string) bool {
+	if c.glob != nil {
+		return c.glob.MatchString(v)
+	}
+	var cmp int
+	switch {
+	case c.isNum:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		cmp = compare(n, c.num)
+	case c.isTime:
+		t, err := ParseTime(v)
+		if err != nil {
+			return false
+		}
+		cmp = t.Compare(c.time)
+	default:
+		cmp = strings.Compare(v, c.raw)
+	}
+	switch c.op {
+	case "=", "!=":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func compare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ParseTime accepts RFC 3339 timestamps (as stored in modTime) and plain
+// dates, which are taken as midnight UTC.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// sizeUnits are decimal (KB = 1000) and binary (KiB = 1024) multipliers.
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1000, "kb": 1000, "kib": 1 << 10,
+	"m": 1000 * 1000, "mb": 1000 * 1000, "mib": 1 << 20,
+	"g": 1000 * 1000 * 1000, "gb": 1000 * 1000 * 1000, "gib": 1 << 30,
+	"t": 1000 * 1000 * 1000 * 1000, "tb": 1000 * 1000 * 1000 * 1000, "tib": 1 << 40,
+}
+
+// ParseSize parses a byte count with an optional unit, such as 100MB,
+// 1.5GiB or 4096.
+func ParseSize(s string) (int64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return unicode.IsLetter(r) })
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.ToLower(s[i:])
+	}
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", s[i:])
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size")
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// globRegexp converts a glob to an anchored regexp. "*" matches any run of
+// characters, including path separators, so "*.mp4" matches every MP4 file;
+// "?" matches one character and [...] a character class.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("glob %q: unterminated '['", glob)
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1])) // Bytes of a multibyte rune pass through as they are
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,137 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []token
+	}{
+		{"empty", "", []token{{tokEOF, "", 0}}},
+		{"comparison", "size>=1MB", []token{
+			{tokWord, "size", 0}, {tokOp, ">=", 4}, {tokWord, "1MB", 6}, {tokEOF, "", 9},
+		}},
+		{"double equals", "host == a", []token{
+			{tokWord, "host", 0}, {tokOp, "=", 5}, {tokWord, "a", 8}, {tokEOF, "", 9},
+		}},
+		{"not glob", "path!~*.tmp", []token{
+			{tokWord, "path", 0}, {tokOp, "!~", 4}, {tokWord, "*.tmp", 6}, {tokEOF, "", 11},
+		}},
+		{"parens and keywords", "(a=1 OR b=2)", []token{
+			{tokLParen, "(", 0}, {tokWord, "a", 1}, {tokOp, "=", 2}, {tokWord, "1", 3},
+			{tokWord, "OR", 5}, {tokWord, "b", 8}, {tokOp, "=", 9}, {tokWord, "2", 10},
+			{tokRParen, ")", 11}, {tokEOF, "", 12},
+		}},
+		{"quoted with escapes", `path ~ "a \"b\" c"`, []token{
+			{tokWord, "path", 0}, {tokOp, "~", 5}, {tokString, `a "b" c`, 7}, {tokEOF, "", 18},
+		}},
+		{"single quoted", `host='x y'`, []token{
+			{tokWord, "host", 0}, {tokOp, "=", 4}, {tokString, "x y", 5}, {tokEOF, "", 10},
+		}},
+		{"multibyte word", "path=naïve", []token{
+			{tokWord, "path", 0}, {tokOp, "=", 4}, {tokWord, "naïve", 5}, {tokEOF, "", 11},
+		}},
+		{"multibyte quoted", `path ~ "*日本*"`, []token{
+			{tokWord, "path", 0}, {tokOp, "~", 5}, {tokString, "*日本*", 7}, {tokEOF, "", 17},
+		}},
+		// U+0085 is a space; its second byte alone must not be taken for one
+		{"unicode space", "a=x\u0085y", []token{
+			{tokWord, "a", 0}, {tokOp, "=", 1}, {tokWord, "x", 2}, {tokWord, "y", 5}, {tokEOF, "", 6},
+		}},
+		{"byte 0x85 in a word", "a=Ņ", []token{
+			{tokWord, "a", 0}, {tokOp, "=", 1}, {tokWord, "Ņ", 2}, {tokEOF, "", 4},
+		}},
+		{"ideographic space", "a=x　b=y", []token{
+			{tokWord, "a", 0}, {tokOp, "=", 1}, {tokWord, "x", 2},
+			{tokWord, "b", 6}, {tokOp, "=", 7}, {tokWord, "y", 8}, {tokEOF, "", 9},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lex(tt.input)
+			if err != nil {
+				t.Fatalf("lex(%q): %v", tt.input, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("lex(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("lex(%q) token %d = %+v, want %+v", tt.input, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`path ~ "abc`, "unterminated string"},
+		{"path ! x", `unknown operator "!"`},
+		{"path ~= x", `unknown operator "~="`},
+	}
+	for _, tt := range tests {
+		if _, err := lex(tt.input); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("lex(%q) error = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestParseMatch(t *testing.T) {
+	meta := &metadata.FileMetadata{
+		ID:       "id1",
+		HostID:   "host-a",
+		FilePath: "/data/vidéos/clip.mp4",
+		Size:     200 << 20,
+		ModTime:  "2024-06-01T12:00:00Z",
+		BLAKE3:   "abc123",
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"size > 100MB", true},
+		{"size <= 100MB", false},
+		{`path ~ "*.mp4"`, true},
+		{"path ~ *vidéos*", true},
+		{"path !~ *.mp4", false},
+		{"host = host-a AND hash = abc123", true},
+		{"host = host-b OR NOT id = id2", true},
+		{"NOT (host = host-a OR size < 1)", false},
+		{"mtime > 2024-01-01 and mtime < 2025-01-01", true},
+	}
+	for _, tt := range tests {
+		expr, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := expr.Match(meta); got != tt.want {
+			t.Errorf("Parse(%q).Match = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"size >",
+		"size 100",
+		"(size > 1",
+		"size > 1 size < 2",
+		"= 1",
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", input)
+		}
+	}
+}
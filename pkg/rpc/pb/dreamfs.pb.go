@@ -0,0 +1,784 @@
+// gRPC API of an indexer node (see 'indexer serve --grpc-addr').
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: dreamfs.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// FileMetadata is a stored record. Fields the node's realm encrypts are
+// sent sealed, as over HTTP.
+type FileMetadata struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	IdString      string                 `protobuf:"bytes,2,opt,name=id_string,json=idString,proto3" json:"id_string,omitempty"`
+	HostId        string                 `protobuf:"bytes,3,opt,name=host_id,json=hostId,proto3" json:"host_id,omitempty"`
+	FilePath      string                 `protobuf:"bytes,4,opt,name=file_path,json=filePath,proto3" json:"file_path,omitempty"`
+	Size          int64                  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	ModTime       string                 `protobuf:"bytes,6,opt,name=mod_time,json=modTime,proto3" json:"mod_time,omitempty"` // RFC 3339
+	Blake3        string                 `protobuf:"bytes,7,opt,name=blake3,proto3" json:"blake3,omitempty"`
+	Extra         *structpb.Struct       `protobuf:"bytes,8,opt,name=extra,proto3" json:"extra,omitempty"` // Every other field (tags, deleted, hashMode...)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileMetadata) Reset() {
+	*x = FileMetadata{}
+	mi := &file_dreamfs_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileMetadata) ProtoMessage() {}
+
+func (x *FileMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileMetadata.ProtoReflect.Descriptor instead.
+func (*FileMetadata) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FileMetadata) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *FileMetadata) GetIdString() string {
+	if x != nil {
+		return x.IdString
+	}
+	return ""
+}
+
+func (x *FileMetadata) GetHostId() string {
+	if x != nil {
+		return x.HostId
+	}
+	return ""
+}
+
+func (x *FileMetadata) GetFilePath() string {
+	if x != nil {
+		return x.FilePath
+	}
+	return ""
+}
+
+func (x *FileMetadata) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileMetadata) GetModTime() string {
+	if x != nil {
+		return x.ModTime
+	}
+	return ""
+}
+
+func (x *FileMetadata) GetBlake3() string {
+	if x != nil {
+		return x.Blake3
+	}
+	return ""
+}
+
+func (x *FileMetadata) GetExtra() *structpb.Struct {
+	if x != nil {
+		return x.Extra
+	}
+	return nil
+}
+
+type QueryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// A query in the language of 'indexer query' (e.g. "size>1GB ext:iso").
+	Query string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	// Equality selectors, served from the secondary indexes where possible.
+	Selector map[string]string `protobuf:"bytes,2,rep,name=selector,proto3" json:"selector,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// At most this many records (0 for all).
+	Limit         int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRequest) Reset() {
+	*x = QueryRequest{}
+	mi := &file_dreamfs_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRequest) ProtoMessage() {}
+
+func (x *QueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRequest.ProtoReflect.Descriptor instead.
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *QueryRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetSelector() map[string]string {
+	if x != nil {
+		return x.Selector
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type PutRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Docs          []*FileMetadata        `protobuf:"bytes,1,rep,name=docs,proto3" json:"docs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutRequest) Reset() {
+	*x = PutRequest{}
+	mi := &file_dreamfs_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutRequest) ProtoMessage() {}
+
+func (x *PutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutRequest.ProtoReflect.Descriptor instead.
+func (*PutRequest) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PutRequest) GetDocs() []*FileMetadata {
+	if x != nil {
+		return x.Docs
+	}
+	return nil
+}
+
+type PutResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Ok            bool                   `protobuf:"varint,2,opt,name=ok,proto3" json:"ok,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"` // Why the record was not stored
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutResult) Reset() {
+	*x = PutResult{}
+	mi := &file_dreamfs_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutResult) ProtoMessage() {}
+
+func (x *PutResult) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutResult.ProtoReflect.Descriptor instead.
+func (*PutResult) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PutResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PutResult) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *PutResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type PutResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*PutResult           `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutResponse) Reset() {
+	*x = PutResponse{}
+	mi := &file_dreamfs_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutResponse) ProtoMessage() {}
+
+func (x *PutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutResponse.ProtoReflect.Descriptor instead.
+func (*PutResponse) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PutResponse) GetResults() []*PutResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type DeleteRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Remove the record from this node only, instead of writing a tombstone
+	// that deletes the file cluster-wide.
+	Purge         bool `protobuf:"varint,2,opt,name=purge,proto3" json:"purge,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_dreamfs_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteRequest) GetPurge() bool {
+	if x != nil {
+		return x.Purge
+	}
+	return false
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Found         bool                   `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	Tombstone     *FileMetadata          `protobuf:"bytes,2,opt,name=tombstone,proto3" json:"tombstone,omitempty"` // The tombstone written, unless purged
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_dreamfs_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *DeleteResponse) GetTombstone() *FileMetadata {
+	if x != nil {
+		return x.Tombstone
+	}
+	return nil
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Since         uint64                 `protobuf:"varint,1,opt,name=since,proto3" json:"since,omitempty"` // Only changes after this sequence
+	IncludeDocs   bool                   `protobuf:"varint,2,opt,name=include_docs,json=includeDocs,proto3" json:"include_docs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_dreamfs_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SubscribeRequest) GetSince() uint64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+func (x *SubscribeRequest) GetIncludeDocs() bool {
+	if x != nil {
+		return x.IncludeDocs
+	}
+	return false
+}
+
+type Change struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Rev           string                 `protobuf:"bytes,3,opt,name=rev,proto3" json:"rev,omitempty"`
+	Deleted       bool                   `protobuf:"varint,4,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	Doc           *FileMetadata          `protobuf:"bytes,5,opt,name=doc,proto3" json:"doc,omitempty"` // With include_docs, for writes
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Change) Reset() {
+	*x = Change{}
+	mi := &file_dreamfs_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Change) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Change) ProtoMessage() {}
+
+func (x *Change) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Change.ProtoReflect.Descriptor instead.
+func (*Change) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Change) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Change) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Change) GetRev() string {
+	if x != nil {
+		return x.Rev
+	}
+	return ""
+}
+
+func (x *Change) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *Change) GetDoc() *FileMetadata {
+	if x != nil {
+		return x.Doc
+	}
+	return nil
+}
+
+type PeerListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PeerListRequest) Reset() {
+	*x = PeerListRequest{}
+	mi := &file_dreamfs_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PeerListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PeerListRequest) ProtoMessage() {}
+
+func (x *PeerListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PeerListRequest.ProtoReflect.Descriptor instead.
+func (*PeerListRequest) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{9}
+}
+
+type PeerListResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Peers         []string               `protobuf:"bytes,1,rep,name=peers,proto3" json:"peers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PeerListResponse) Reset() {
+	*x = PeerListResponse{}
+	mi := &file_dreamfs_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PeerListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PeerListResponse) ProtoMessage() {}
+
+func (x *PeerListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dreamfs_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PeerListResponse.ProtoReflect.Descriptor instead.
+func (*PeerListResponse) Descriptor() ([]byte, []int) {
+	return file_dreamfs_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *PeerListResponse) GetPeers() []string {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+var File_dreamfs_proto protoreflect.FileDescriptor
+
+const file_dreamfs_proto_rawDesc = "" +
+	"\n" +
+	"\rdreamfs.proto\x12\n" +
+	"dreamfs.v1\x1a\x1cgoogle/protobuf/struct.proto\"\xe7\x01\n" +
+	"\fFileMetadata\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tid_string\x18\x02 \x01(\tR\bidString\x12\x17\n" +
+	"\ahost_id\x18\x03 \x01(\tR\x06hostId\x12\x1b\n" +
+	"\tfile_path\x18\x04 \x01(\tR\bfilePath\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04size\x12\x19\n" +
+	"\bmod_time\x18\x06 \x01(\tR\amodTime\x12\x16\n" +
+	"\x06blake3\x18\a \x01(\tR\x06blake3\x12-\n" +
+	"\x05extra\x18\b \x01(\v2\x17.google.protobuf.StructR\x05extra\"\xbb\x01\n" +
+	"\fQueryRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12B\n" +
+	"\bselector\x18\x02 \x03(\v2&.dreamfs.v1.QueryRequest.SelectorEntryR\bselector\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\x1a;\n" +
+	"\rSelectorEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\":\n" +
+	"\n" +
+	"PutRequest\x12,\n" +
+	"\x04docs\x18\x01 \x03(\v2\x18.dreamfs.v1.FileMetadataR\x04docs\"A\n" +
+	"\tPutResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x0e\n" +
+	"\x02ok\x18\x02 \x01(\bR\x02ok\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\">\n" +
+	"\vPutResponse\x12/\n" +
+	"\aresults\x18\x01 \x03(\v2\x15.dreamfs.v1.PutResultR\aresults\"5\n" +
+	"\rDeleteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05purge\x18\x02 \x01(\bR\x05purge\"^\n" +
+	"\x0eDeleteResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x126\n" +
+	"\ttombstone\x18\x02 \x01(\v2\x18.dreamfs.v1.FileMetadataR\ttombstone\"K\n" +
+	"\x10SubscribeRequest\x12\x14\n" +
+	"\x05since\x18\x01 \x01(\x04R\x05since\x12!\n" +
+	"\finclude_docs\x18\x02 \x01(\bR\vincludeDocs\"\x82\x01\n" +
+	"\x06Change\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x10\n" +
+	"\x03rev\x18\x03 \x01(\tR\x03rev\x12\x18\n" +
+	"\adeleted\x18\x04 \x01(\bR\adeleted\x12*\n" +
+	"\x03doc\x18\x05 \x01(\v2\x18.dreamfs.v1.FileMetadataR\x03doc\"\x11\n" +
+	"\x0fPeerListRequest\"(\n" +
+	"\x10PeerListResponse\x12\x14\n" +
+	"\x05peers\x18\x01 \x03(\tR\x05peers2\xc7\x02\n" +
+	"\x05Store\x12=\n" +
+	"\x05Query\x12\x18.dreamfs.v1.QueryRequest\x1a\x18.dreamfs.v1.FileMetadata0\x01\x126\n" +
+	"\x03Put\x12\x16.dreamfs.v1.PutRequest\x1a\x17.dreamfs.v1.PutResponse\x12?\n" +
+	"\x06Delete\x12\x19.dreamfs.v1.DeleteRequest\x1a\x1a.dreamfs.v1.DeleteResponse\x12?\n" +
+	"\tSubscribe\x12\x1c.dreamfs.v1.SubscribeRequest\x1a\x12.dreamfs.v1.Change0\x01\x12E\n" +
+	"\bPeerList\x12\x1b.dreamfs.v1.PeerListRequest\x1a\x1c.dreamfs.v1.PeerListResponseB Z\x1egnomatix/dreamfs/v2/pkg/rpc/pbb\x06proto3"
+
+var (
+	file_dreamfs_proto_rawDescOnce sync.Once
+	file_dreamfs_proto_rawDescData []byte
+)
+
+func file_dreamfs_proto_rawDescGZIP() []byte {
+	file_dreamfs_proto_rawDescOnce.Do(func() {
+		file_dreamfs_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_dreamfs_proto_rawDesc), len(file_dreamfs_proto_rawDesc)))
+	})
+	return file_dreamfs_proto_rawDescData
+}
+
+var file_dreamfs_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_dreamfs_proto_goTypes = []any{
+	(*FileMetadata)(nil),     // 0: dreamfs.v1.FileMetadata
+	(*QueryRequest)(nil),     // 1: dreamfs.v1.QueryRequest
+	(*PutRequest)(nil),       // 2: dreamfs.v1.PutRequest
+	(*PutResult)(nil),        // 3: dreamfs.v1.PutResult
+	(*PutResponse)(nil),      // 4: dreamfs.v1.PutResponse
+	(*DeleteRequest)(nil),    // 5: dreamfs.v1.DeleteRequest
+	(*DeleteResponse)(nil),   // 6: dreamfs.v1.DeleteResponse
+	(*SubscribeRequest)(nil), // 7: dreamfs.v1.SubscribeRequest
+	(*Change)(nil),           // 8: dreamfs.v1.Change
+	(*PeerListRequest)(nil),  // 9: dreamfs.v1.PeerListRequest
+	(*PeerListResponse)(nil), // 10: dreamfs.v1.PeerListResponse
+	nil,                      // 11: dreamfs.v1.QueryRequest.SelectorEntry
+	(*structpb.Struct)(nil),  // 12: google.protobuf.Struct
+}
+var file_dreamfs_proto_depIdxs = []int32{
+	12, // 0: dreamfs.v1.FileMetadata.extra:type_name -> google.protobuf.Struct
+	11, // 1: dreamfs.v1.QueryRequest.selector:type_name -> dreamfs.v1.QueryRequest.SelectorEntry
+	0,  // 2: dreamfs.v1.PutRequest.docs:type_name -> dreamfs.v1.FileMetadata
+	3,  // 3: dreamfs.v1.PutResponse.results:type_name -> dreamfs.v1.PutResult
+	0,  // 4: dreamfs.v1.DeleteResponse.tombstone:type_name -> dreamfs.v1.FileMetadata
+	0,  // 5: dreamfs.v1.Change.doc:type_name -> dreamfs.v1.FileMetadata
+	1,  // 6: dreamfs.v1.Store.Query:input_type -> dreamfs.v1.QueryRequest
+	2,  // 7: dreamfs.v1.Store.Put:input_type -> dreamfs.v1.PutRequest
+	5,  // 8: dreamfs.v1.Store.Delete:input_type -> dreamfs.v1.DeleteRequest
+	7,  // 9: dreamfs.v1.Store.Subscribe:input_type -> dreamfs.v1.SubscribeRequest
+	9,  // 10: dreamfs.v1.Store.PeerList:input_type -> dreamfs.v1.PeerListRequest
+	0,  // 11: dreamfs.v1.Store.Query:output_type -> dreamfs.v1.FileMetadata
+	4,  // 12: dreamfs.v1.Store.Put:output_type -> dreamfs.v1.PutResponse
+	6,  // 13: dreamfs.v1.Store.Delete:output_type -> dreamfs.v1.DeleteResponse
+	8,  // 14: dreamfs.v1.Store.Subscribe:output_type -> dreamfs.v1.Change
+	10, // 15: dreamfs.v1.Store.PeerList:output_type -> dreamfs.v1.PeerListResponse
+	11, // [11:16] is the sub-list for method output_type
+	6,  // [6:11] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_dreamfs_proto_init() }
+func file_dreamfs_proto_init() {
+	if File_dreamfs_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_dreamfs_proto_rawDesc), len(file_dreamfs_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_dreamfs_proto_goTypes,
+		DependencyIndexes: file_dreamfs_proto_depIdxs,
+		MessageInfos:      file_dreamfs_proto_msgTypes,
+	}.Build()
+	File_dreamfs_proto = out.File
+	file_dreamfs_proto_goTypes = nil
+	file_dreamfs_proto_depIdxs = nil
+}
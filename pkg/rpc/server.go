@@ -0,0 +1,278 @@
+package rpc
+
+//go:generate protoc -I pb --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative pb/dreamfs.proto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/fatih/color"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpcmeta "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/network"
+	"gnomatix/dreamfs/v2/pkg/query"
+	"gnomatix/dreamfs/v2/pkg/rpc/pb"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// gRPC Store Service
+// ------------------------
+
+// subscribePage is the most changes read from the store at once for a
+// subscription.
+const subscribePage = 1000
+
+// Server implements the Store service (see pb/dreamfs.proto) over a
+// persistent store. Records leave sealed with the store's realm and are
+// opened on the way in, as over HTTP.
+type Server struct {
+	pb.UnimplementedStoreServer
+	ps *storage.PersistentStore
+}
+
+// NewServer returns a Store service for ps.
+func NewServer(ps *storage.PersistentStore) *Server {
+	return &Server{ps: ps}
+}
+
+// Serve listens on addr and serves the Store service until the listener
+// fails. It is secured as the HTTP server is: over TLS with --tls-cert
+// (and client certificates with --tls-client-ca), and with "httpToken"
+// required as a bearer token in the "authorization" metadata of every call.
+func Serve(addr string, ps *storage.PersistentStore) error {
+	tlsConfig, err := network.ServerTLSConfig()
+	if err != nil {
+		return fmt.Errorf("gRPC server TLS: %w", err)
+	}
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := checkToken(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkToken(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer(opts...)
+	pb.RegisterStoreServer(s, NewServer(ps))
+	if tlsConfig != nil {
+		color.Blue("Starting gRPC server on %s (TLS)", addr)
+	} else {
+		color.Blue("Starting gRPC server on %s", addr)
+	}
+	return s.Serve(lis)
+}
+
+// checkToken refuses calls without "httpToken", if set, as a bearer token.
+func checkToken(ctx context.Context) error {
+	md, _ := grpcmeta.FromIncomingContext(ctx)
+	var auth string
+	if v := md.Get("authorization"); len(v) > 0 {
+		auth = v[0]
+	}
+	if !network.ValidToken(auth) {
+		return status.Error(codes.Unauthenticated, "invalid or missing token")
+	}
+	return nil
+}
+
+// Query streams the records matching the request's selectors and query.
+func (s *Server) Query(req *pb.QueryRequest, stream pb.Store_QueryServer) error {
+	var expr query.Expr
+	if req.GetQuery() != "" {
+		var err error
+		if expr, err = query.Parse(req.GetQuery()); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+		}
+	}
+	limit := int(req.GetLimit())
+	var docs []metadata.FileMetadata
+	keep := func(meta metadata.FileMetadata) {
+		if (expr == nil || expr.Match(&meta)) && (limit <= 0 || len(docs) < limit) {
+			docs = append(docs, meta)
+		}
+	}
+	// Matches are collected before sending, so a slow client does not hold
+	// a read transaction open
+	if len(req.GetSelector()) > 0 {
+		found, err := s.ps.Find(req.GetSelector())
+		if err != nil {
+			return status.Errorf(codes.Internal, "query failed: %v", err)
+		}
+		for _, meta := range found {
+			keep(meta)
+		}
+	} else {
+		err := s.ps.ForEach(func(meta metadata.FileMetadata) error {
+			keep(meta)
+			return nil
+		})
+		if err != nil {
+			return status.Errorf(codes.Internal, "query failed: %v", err)
+		}
+	}
+	for _, meta := range docs {
+		msg, err := s.toProto(meta)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put merges the records into the store, as /_bulk_docs does.
+func (s *Server) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	resp := &pb.PutResponse{}
+	for _, doc := range req.GetDocs() {
+		res := &pb.PutResult{Id: doc.GetId()}
+		stored, err := s.ps.Merge(fromProto(doc))
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+		case !stored:
+			res.Error = "superseded by a deletion or a newer version"
+		default:
+			res.Ok = true
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	return resp, nil
+}
+
+// Delete writes a tombstone for the record's file, which replicates to
+// peers, or with purge removes the record from this store only.
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	meta, found, err := s.ps.Get(req.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "read record: %v", err)
+	}
+	if !found {
+		return &pb.DeleteResponse{}, nil
+	}
+	if req.GetPurge() {
+		if err := s.ps.Delete(meta.ID); err != nil {
+			return nil, status.Errorf(codes.Internal, "delete record: %v", err)
+		}
+		return &pb.DeleteResponse{Found: true}, nil
+	}
+	tombstone := meta
+	if !meta.Deleted() {
+		tombstone = metadata.NewTombstone(meta.HostID, meta.FilePath, time.Now())
+		if err := s.ps.Put(tombstone); err != nil {
+			return nil, status.Errorf(codes.Internal, "write tombstone: %v", err)
+		}
+	}
+	msg, err := s.toProto(tombstone)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteResponse{Found: true, Tombstone: msg}, nil
+}
+
+// Subscribe streams the change feed after req.Since, then each change as
+// it is committed, until the client cancels.
+func (s *Server) Subscribe(req *pb.SubscribeRequest, stream pb.Store_SubscribeServer) error {
+	since := req.GetSince()
+	for {
+		notify := s.ps.ChangesNotify() // Taken before reading, so no change is missed
+		changes, lastSeq, pending, err := s.ps.Changes(since, subscribePage, req.GetIncludeDocs())
+		if err != nil {
+			return status.Errorf(codes.Internal, "read changes: %v", err)
+		}
+		for _, ch := range changes {
+			msg := &pb.Change{Seq: ch.Seq, Id: ch.ID, Rev: ch.Rev, Deleted: ch.Deleted}
+			if ch.Doc != nil {
+				if msg.Doc, err = s.toProto(*ch.Doc); err != nil {
+					return err
+				}
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+		since = lastSeq
+		if pending > 0 {
+			continue
+		}
+		select {
+		case <-notify:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// PeerList returns the peers collected by the HTTP /peerlist endpoint.
+func (s *Server) PeerList(ctx context.Context, req *pb.PeerListRequest) (*pb.PeerListResponse, error) {
+	return &pb.PeerListResponse{Peers: network.Peers()}, nil
+}
+
+// toProto seals a record with the realm and converts it.
+func (s *Server) toProto(meta metadata.FileMetadata) (*pb.FileMetadata, error) {
+	meta, err := s.ps.Realm().Seal(meta)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "seal record: %v", err)
+	}
+	msg := &pb.FileMetadata{
+		Id:       meta.ID,
+		IdString: meta.IDString,
+		HostId:   meta.HostID,
+		FilePath: meta.FilePath,
+		Size:     meta.Size,
+		ModTime:  meta.ModTime,
+		Blake3:   meta.BLAKE3,
+	}
+	if len(meta.Extra) > 0 {
+		// Through JSON, which is how Extra values are stored anyway
+		data, err := json.Marshal(meta.Extra)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "encode extra fields: %v", err)
+		}
+		msg.Extra = &structpb.Struct{}
+		if err := protojson.Unmarshal(data, msg.Extra); err != nil {
+			return nil, status.Errorf(codes.Internal, "encode extra fields: %v", err)
+		}
+	}
+	return msg, nil
+}
+
+// fromProto converts a received record.
+func fromProto(msg *pb.FileMetadata) metadata.FileMetadata {
+	return metadata.FileMetadata{
+		ID:       msg.GetId(),
+		IDString: msg.GetIdString(),
+		HostID:   msg.GetHostId(),
+		FilePath: msg.GetFilePath(),
+		Size:     msg.GetSize(),
+		ModTime:  msg.GetModTime(),
+		BLAKE3:   msg.GetBlake3(),
+		Extra:    msg.GetExtra().AsMap(),
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Change Sequence Log
+// ------------------------
+
+// Every write and delete takes the next update sequence, CouchDB-style. The
+// change log maps the sequence (8 bytes, big-endian) to the change; the
+// sequence index maps a record ID to its current sequence, so that only a
+// record's latest change is kept in the log.
+const (
+	changeBucketName    = "changes"
+	changeSeqBucketName = "change_seqs"
+)
+
+// maxPending caps the count of changes left after a page (see Changes), so
+// that paging through a long log does not rescan its tail for every page.
+const maxPending = 10000
+
+// Change is an entry of the change log.
+type Change struct {
+	Seq     uint64                 `json:"seq"`
+	ID      string                 `json:"id"`
+	Rev     string                 `json:"rev"`
+	Deleted bool                   `json:"deleted,omitempty"`
+	Doc     *metadata.FileMetadata `json:"-"` // Set when docs are requested, nil for deletions
+}
+
+// buildChangeLog assigns sequences to the stored records, in ID order. It
+// runs once, when a store created before the change log existed is opened.
+func buildChangeLog(tx kvTx) error {
+	if tx.Bucket([]byte(changeBucketName)) != nil {
+		return nil
+	}
+	if _, err := tx.CreateBucket([]byte(changeBucketName)); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucketIfNotExists([]byte(changeSeqBucketName)); err != nil {
+		return err
+	}
+	err := tx.Bucket([]byte(boltBucketName)).ForEach(func(k, v []byte) error {
+		rev, err := storedRev(v)
+		if err != nil {
+			return err
+		}
+		return recordChangeTx(tx, k, rev, false)
+	})
+	if err != nil {
+		return fmt.Errorf("build change log: %w", err)
+	}
+	return nil
+}
+
+// revOf derives a revision token from a stored record without one (see
+// revs.go), so that replicators can tell whether they already hold it.
+func revOf(data []byte) string {
+	return fmt.Sprintf("1-%x", md5.Sum(data))
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// recordChangeTx gives the record the next sequence, replacing its earlier
+// change.
+func recordChangeTx(tx kvTx, id []byte, rev string, deleted bool) error {
+	changeLog := tx.Bucket([]byte(changeBucketName))
+	seqs := tx.Bucket([]byte(changeSeqBucketName))
+	if old := seqs.Get(id); old != nil {
+		if err := changeLog.Delete(old); err != nil {
+			return err
+		}
+	}
+	seq, err := changeLog.NextSequence()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(Change{Seq: seq, ID: string(id), Rev: rev, Deleted: deleted})
+	if err != nil {
+		return err
+	}
+	if err := changeLog.Put(seqKey(seq), data); err != nil {
+		return err
+	}
+	return seqs.Put(id, seqKey(seq))
+}
+
+// UpdateSeq returns the sequence of the latest write or delete.
+func (ps *PersistentStore) UpdateSeq() (uint64, error) {
+	var seq uint64
+	err := ps.db.View(func(tx kvTx) error {
+		seq = tx.Bucket([]byte(changeBucketName)).Sequence()
+		return nil
+	})
+	return seq, err
+}
+
+// Changes returns the changes after since, oldest first, up to limit (0 for
+// all), with the current record of each when includeDocs is set. lastSeq is
+// the sequence of the last change returned, or the current update sequence
+// if there is none; pending counts the changes left after the page, up to
+// maxPending.
+func (ps *PersistentStore) Changes(since uint64, limit int, includeDocs bool) (changes []Change, lastSeq uint64, pending int, err error) {
+	err = ps.db.View(func(tx kvTx) error {
+		changeLog := tx.Bucket([]byte(changeBucketName))
+		docs := tx.Bucket([]byte(boltBucketName))
+		lastSeq = changeLog.Sequence()
+		c := changeLog.Cursor()
+		for k, v := c.Seek(seqKey(since + 1)); k != nil; k, v = c.Next() {
+			if limit > 0 && len(changes) >= limit {
+				if pending++; pending >= maxPending {
+					break
+				}
+				continue
+			}
+			var ch Change
+			if err := json.Unmarshal(v, &ch); err != nil {
+				return err
+			}
+			if includeDocs && !ch.Deleted {
+				if data := docs.Get([]byte(ch.ID)); data != nil {
+					meta, err := ps.decode(data)
+					if err != nil {
+						return err
+					}
+					ch.Doc = &meta
+				}
+			}
+			changes = append(changes, ch)
+		}
+		if len(changes) > 0 {
+			lastSeq = changes[len(changes)-1].Seq
+		}
+		return nil
+	})
+	return changes, lastSeq, pending, err
+}
+
+// ChangesNotify returns a channel that is closed at the next committed
+// write or delete. Waiters should call it again after each wakeup.
+func (ps *PersistentStore) ChangesNotify() <-chan struct{} {
+	ps.changesMu.Lock()
+	defer ps.changesMu.Unlock()
+	return ps.changed
+}
+
+func (ps *PersistentStore) notifyChanges() {
+	ps.changesMu.Lock()
+	defer ps.changesMu.Unlock()
+	close(ps.changed)
+	ps.changed = make(chan struct{})
+}
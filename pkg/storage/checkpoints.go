@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ------------------------
+// Replication Checkpoints
+// ------------------------
+
+const checkpointBucketName = "replication_checkpoints"
+
+// ReplicationCheckpoint records the progress of pulling from one upstream
+// source, so replication lag can be reported per upstream.
+type ReplicationCheckpoint struct {
+	Source       string    `json:"source"`
+	LastSeq      string    `json:"lastSeq,omitempty"` // Last sequence reported by the source, if any
+	LastSuccess  time.Time `json:"lastSuccess"`
+	LastAttempt  time.Time `json:"lastAttempt"`
+	LastError    string    `json:"lastError,omitempty"`
+	DocsReceived int       `json:"docsReceived"` // Documents received in the last successful pull
+	DocsWritten  int64     `json:"docsWritten"`  // Documents written across all pulls
+}
+
+// Lag returns the time since the last successful pull.
+func (cp ReplicationCheckpoint) Lag() time.Duration {
+	if cp.LastSuccess.IsZero() {
+		return 0
+	}
+	return time.Since(cp.LastSuccess)
+}
+
+// GetCheckpoint returns the checkpoint for a source, if one is stored.
+func (ps *PersistentStore) GetCheckpoint(source string) (ReplicationCheckpoint, bool, error) {
+	var cp ReplicationCheckpoint
+	var found bool
+	err := ps.db.View(func(tx kvTx) error {
+		data := tx.Bucket([]byte(checkpointBucketName)).Get([]byte(source))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &cp)
+	})
+	return cp, found, err
+}
+
+// PutCheckpoint stores the checkpoint for its source.
+func (ps *PersistentStore) PutCheckpoint(cp ReplicationCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("marshal checkpoint: %w", err)
+	}
+	return ps.db.Update(func(tx kvTx) error {
+		return tx.Bucket([]byte(checkpointBucketName)).Put([]byte(cp.Source), data)
+	})
+}
+
+// Checkpoints returns all stored replication checkpoints, ordered by source.
+func (ps *PersistentStore) Checkpoints() ([]ReplicationCheckpoint, error) {
+	var cps []ReplicationCheckpoint
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(checkpointBucketName)).ForEach(func(k, v []byte) error {
+			var cp ReplicationCheckpoint
+			if err := json.Unmarshal(v, &cp); err != nil {
+				return err
+			}
+			cps = append(cps, cp)
+			return nil
+		})
+	})
+	return cps, err
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gnomatix/dreamfs/v2/pkg/chunker"
+)
+
+// ------------------------
+// Chunk-Level Index
+// ------------------------
+
+// The chunk list bucket maps a record ID to the content-defined chunks of
+// that revision of the file. The chunk reference index holds
+// "<chunk hash>|<record ID>" keys, so the records sharing a chunk are found
+// by a prefix scan.
+const (
+	chunkListBucketName = "chunk_lists"
+	chunkRefBucketName  = "chunk_refs"
+)
+
+// ChunkList is the chunking of one record's content.
+type ChunkList struct {
+	Options chunker.Options `json:"options"` // Size bounds the chunks were cut with
+	Chunks  []chunker.Chunk `json:"chunks"`
+}
+
+// PutChunks stores the chunk list of the record with the given ID,
+// replacing any earlier one.
+func (ps *PersistentStore) PutChunks(id string, list ChunkList) error {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return ps.db.Update(func(tx kvTx) error {
+		if err := deleteChunksTx(tx, []byte(id)); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(chunkListBucketName)).Put([]byte(id), data); err != nil {
+			return err
+		}
+		refs := tx.Bucket([]byte(chunkRefBucketName))
+		for _, ch := range list.Chunks {
+			if err := refs.Put([]byte(ch.Hash+"|"+id), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Chunks returns the chunk list of the record with the given ID, if it was
+// chunked.
+func (ps *PersistentStore) Chunks(id string) (ChunkList, bool, error) {
+	var list ChunkList
+	var found bool
+	err := ps.db.View(func(tx kvTx) error {
+		data := tx.Bucket([]byte(chunkListBucketName)).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &list)
+	})
+	return list, found, err
+}
+
+// ChunkHolders returns the IDs of the records containing the chunk with
+// the given hash.
+func (ps *PersistentStore) ChunkHolders(hash string) ([]string, error) {
+	var ids []string
+	err := ps.db.View(func(tx kvTx) error {
+		prefix := []byte(hash + "|")
+		c := tx.Bucket([]byte(chunkRefBucketName)).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			ids = append(ids, string(k[len(prefix):]))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// deleteChunksTx drops a record's chunk list and its references.
+func deleteChunksTx(tx kvTx, id []byte) error {
+	lists := tx.Bucket([]byte(chunkListBucketName))
+	data := lists.Get(id)
+	if data == nil {
+		return nil
+	}
+	var list ChunkList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decode chunk list: %w", err)
+	}
+	refs := tx.Bucket([]byte(chunkRefBucketName))
+	for _, ch := range list.Chunks {
+		if err := refs.Delete([]byte(ch.Hash + "|" + string(id))); err != nil {
+			return err
+		}
+	}
+	return lists.Delete(id)
+}
+
+// ChunkStats summarizes sub-file duplication across the newest revision of
+// every chunked file.
+type ChunkStats struct {
+	Files        int   `json:"files"`        // Files with a chunk list
+	Chunks       int   `json:"chunks"`       // Chunks in those files
+	UniqueChunks int   `json:"uniqueChunks"` // Distinct chunks
+	Bytes        int64 `json:"bytes"`        // Total size of the files
+	UniqueBytes  int64 `json:"uniqueBytes"`  // Size of the distinct chunks
+}
+
+// CollectChunkStats computes ChunkStats, optionally for one host's files.
+func (ps *PersistentStore) CollectChunkStats(hostID string) (ChunkStats, error) {
+	var st ChunkStats
+	seen := map[string]bool{}
+	err := ps.db.View(func(tx kvTx) error {
+		lists := tx.Bucket([]byte(chunkListBucketName))
+		var prefix []byte
+		if hostID != "" {
+			prefix = []byte(hostID + "|")
+		}
+		c := tx.Bucket([]byte(pathBucketName)).Cursor()
+		for k, id := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, id = c.Next() {
+			data := lists.Get(id)
+			if data == nil {
+				continue
+			}
+			var list ChunkList
+			if err := json.Unmarshal(data, &list); err != nil {
+				return fmt.Errorf("decode chunk list: %w", err)
+			}
+			st.Files++
+			for _, ch := range list.Chunks {
+				st.Chunks++
+				st.Bytes += int64(ch.Length)
+				if !seen[ch.Hash] {
+					seen[ch.Hash] = true
+					st.UniqueChunks++
+					st.UniqueBytes += int64(ch.Length)
+				}
+			}
+		}
+		return nil
+	})
+	return st, err
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// ------------------------
+// Record Compression
+// ------------------------
+
+// DefaultCompressThreshold is the size from which the BoltDB driver stores
+// records compressed. Plain records rarely reach it; ones carrying large
+// Extra payloads (extracted text, EXIF, chunk lists) do.
+const DefaultCompressThreshold = 4096
+
+// compressedPrefix marks a compressed value. Records are JSON objects, so
+// an uncompressed one never starts with it.
+var compressedPrefix = []byte{0, 'z'}
+
+var flateWriters = sync.Pool{New: func() interface{} {
+	w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return w
+}}
+
+// SetCompressThreshold sets the size from which records are stored
+// compressed (0 disables compression). Only the BoltDB driver compresses;
+// SQLite keeps records readable by SQL. Records are decompressed on read
+// whatever the setting, and are compressed or not when next written.
+func (ps *PersistentStore) SetCompressThreshold(n int) {
+	if d, ok := ps.db.(*boltDriver); ok {
+		d.compressAbove = n
+	}
+}
+
+// compressValue deflates v if it is at least threshold bytes long and
+// compressing saves space.
+func compressValue(v []byte, threshold int) []byte {
+	if threshold <= 0 || len(v) < threshold {
+		return v
+	}
+	var buf bytes.Buffer
+	buf.Write(compressedPrefix)
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(v); err != nil {
+		return v
+	}
+	if err := w.Close(); err != nil || buf.Len() >= len(v) {
+		return v
+	}
+	return buf.Bytes()
+}
+
+// decompressValue inflates a value compressValue compressed, returning
+// others unchanged. A corrupt value is returned as stored, so decoding it
+// fails where the record is read.
+func decompressValue(v []byte) []byte {
+	if !bytes.HasPrefix(v, compressedPrefix) {
+		return v
+	}
+	r := flate.NewReader(bytes.NewReader(v[len(compressedPrefix):]))
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return v
+	}
+	return out
+}
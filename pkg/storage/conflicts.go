@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// Record Versions and Conflicts
+// ------------------------
+
+// Every write of a record by this host bumps the host's count in the
+// record's version vector (see metadata.VersionVector), so Merge can tell a
+// stale copy from a peer, which it ignores, from a newer one, which it
+// stores. Copies written on two hosts without either seeing the other's
+// conflict: the one with the later clock time is kept, under a version
+// superseding both so that every replica settles on it, and the other is
+// recorded in the conflicts bucket for inspection.
+//
+// Conflicts are keyed by "<record ID>|<detected, as zero-padded Unix
+// nanoseconds>", and are not replicated.
+const conflictBucketName = "conflicts"
+
+// Conflict is a pair of concurrent writes of a record, and which was kept.
+type Conflict struct {
+	Detected  time.Time             `json:"detected"`
+	Kept      metadata.FileMetadata `json:"kept"`
+	Discarded metadata.FileMetadata `json:"discarded"`
+}
+
+// Stamp returns meta versioned as written by this host. Put and
+// CacheWriter stamp records themselves; a record also sent to peers is
+// stamped first, so that they receive the version stored.
+func (ps *PersistentStore) Stamp(meta metadata.FileMetadata) (metadata.FileMetadata, error) {
+	err := ps.db.View(func(tx kvTx) error {
+		return ps.stampTx(tx, &meta)
+	})
+	return meta, err
+}
+
+// writeTx stores meta as written by this host, at the next revision.
+func (ps *PersistentStore) writeTx(tx kvTx, meta metadata.FileMetadata) error {
+	meta.SetRev("")
+	if err := ps.versionTx(tx, &meta); err != nil {
+		return err
+	}
+	return ps.storeTx(tx, meta)
+}
+
+// versionTx stamps meta, written by this host, unless it was stamped
+// already (its version is after the stored copy's).
+func (ps *PersistentStore) versionTx(tx kvTx, meta *metadata.FileMetadata) error {
+	vv, _ := meta.Version()
+	var cvv metadata.VersionVector
+	if data := tx.Bucket([]byte(boltBucketName)).Get([]byte(meta.ID)); data != nil {
+		var cur metadata.FileMetadata
+		if err := json.Unmarshal(data, &cur); err != nil {
+			return err
+		}
+		cvv, _ = cur.Version()
+	}
+	if len(vv) > 0 && vv.Compare(cvv) == metadata.VersionAfter {
+		return nil
+	}
+	return ps.stampTx(tx, meta)
+}
+
+// stampTx versions meta as written by this host: after both its own
+// version and that of the stored copy.
+func (ps *PersistentStore) stampTx(tx kvTx, meta *metadata.FileMetadata) error {
+	vv, _ := meta.Version()
+	if data := tx.Bucket([]byte(boltBucketName)).Get([]byte(meta.ID)); data != nil {
+		var cur metadata.FileMetadata
+		if err := json.Unmarshal(data, &cur); err != nil {
+			return err
+		}
+		cvv, _ := cur.Version()
+		vv = vv.Merge(cvv)
+	}
+	vv[utils.HostID]++
+	meta.SetVersion(vv, metadata.LocalClock.Now())
+	return nil
+}
+
+// mergeVersionTx stores meta, received from a peer, if its version is after
+// that of the stored copy cur (found reports whether there is one), and
+// settles a conflict between them. Records without a version come from
+// peers or clients that do not version them, and are stored as writes of
+// this host, but for those with a revision (see mergeRevTx). It reports
+// whether meta was stored.
+func (ps *PersistentStore) mergeVersionTx(tx kvTx, meta, cur metadata.FileMetadata, found bool) (bool, error) {
+	vv, clock := meta.Version()
+	if len(vv) == 0 && meta.Rev() != "" {
+		return ps.mergeRevTx(tx, meta, cur, found)
+	}
+	if len(vv) == 0 {
+		return true, ps.writeTx(tx, meta)
+	}
+	metadata.LocalClock.Observe(clock)
+	if !found {
+		return true, ps.storeTx(tx, meta)
+	}
+	cvv, curClock := cur.Version()
+	switch vv.Compare(cvv) {
+	case metadata.VersionBefore:
+		return false, nil
+	case metadata.VersionEqual:
+		return true, nil // Already stored
+	case metadata.VersionAfter:
+		return true, ps.storeTx(tx, meta)
+	}
+
+	won := clock > curClock // Last writer wins
+	kept, discarded, keptClock := cur, meta, curClock
+	if won {
+		kept, discarded, keptClock = meta, cur, clock
+	}
+	kept.SetVersion(vv.Merge(cvv), keptClock)
+	if err := ps.addConflictTx(tx, kept, discarded); err != nil {
+		return false, err
+	}
+	return won, ps.storeTx(tx, kept)
+}
+
+// mergeRevTx stores meta, an unversioned record with a revision (as CouchDB
+// and PouchDB replicators send), unless the stored copy is at that
+// revision, or at one that wins over it as CouchDB settles conflicts, when
+// meta is recorded as a discarded conflict. A stored record keeps its
+// revision.
+func (ps *PersistentStore) mergeRevTx(tx kvTx, meta, cur metadata.FileMetadata, found bool) (bool, error) {
+	if found {
+		curRev, _, err := revOfTx(tx, cur.ID)
+		if err != nil {
+			return false, err
+		}
+		if meta.Rev() == curRev {
+			return true, nil // Already stored
+		}
+		if !metadata.RevWins(meta.Rev(), curRev) {
+			return false, ps.addConflictTx(tx, cur, meta)
+		}
+	}
+	if err := ps.versionTx(tx, &meta); err != nil {
+		return false, err
+	}
+	return true, ps.storeTx(tx, meta)
+}
+
+func (ps *PersistentStore) addConflictTx(tx kvTx, kept, discarded metadata.FileMetadata) error {
+	c := Conflict{Detected: time.Now().UTC()}
+	var err error
+	if c.Kept, err = ps.realm.Seal(ps.realm.Open(kept)); err != nil {
+		return err
+	}
+	if c.Discarded, err = ps.realm.Seal(ps.realm.Open(discarded)); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s|%020d", kept.ID, c.Detected.UnixNano())
+	return tx.Bucket([]byte(conflictBucketName)).Put([]byte(key), data)
+}
+
+// Conflicts returns the recorded conflicts, oldest first.
+func (ps *PersistentStore) Conflicts() ([]Conflict, error) {
+	var conflicts []Conflict
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(conflictBucketName)).ForEach(func(k, v []byte) error {
+			var c Conflict
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("decode conflict %s: %w", k, err)
+			}
+			c.Kept = ps.realm.Open(c.Kept)
+			c.Discarded = ps.realm.Open(c.Discarded)
+			conflicts = append(conflicts, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		return conflicts[i].Detected.Before(conflicts[j].Detected)
+	})
+	return conflicts, nil
+}
+
+// ClearConflicts forgets the recorded conflicts of the records whose IDs
+// start with one of ids, or every conflict if ids is empty, and returns how
+// many it forgot.
+func (ps *PersistentStore) ClearConflicts(ids ...string) (int, error) {
+	cleared := 0
+	err := ps.db.Update(func(tx kvTx) error {
+		b := tx.Bucket([]byte(conflictBucketName))
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			id, _, _ := strings.Cut(string(k), "|")
+			match := len(ids) == 0
+			for _, prefix := range ids {
+				match = match || strings.HasPrefix(id, prefix)
+			}
+			if match {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		cleared = len(keys)
+		return nil
+	})
+	return cleared, err
+}
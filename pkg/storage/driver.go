@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ------------------------
+// Storage Drivers
+// ------------------------
+
+// Drivers a PersistentStore can run on. Both keep the same buckets of keys
+// and values; SQLite additionally keeps every record in a "files" table
+// with indexes, so the index can be queried with SQL (see sqlite.go).
+const (
+	DriverBolt   = "bolt"
+	DriverSQLite = "sqlite"
+)
+
+// driver is the transactional key-value engine under a PersistentStore.
+// Its shape is BoltDB's: named buckets (which may nest) of byte keys in
+// byte order, with a sequence per bucket.
+type driver interface {
+	View(fn func(tx kvTx) error) error
+	Update(fn func(tx kvTx) error) error
+	Close() error
+}
+
+// kvBuckets opens, creates and drops buckets, at the top level of a
+// transaction or nested in a bucket. Bucket returns nil if there is none.
+type kvBuckets interface {
+	Bucket(name []byte) kvBucket
+	CreateBucket(name []byte) (kvBucket, error)
+	CreateBucketIfNotExists(name []byte) (kvBucket, error)
+	DeleteBucket(name []byte) error
+}
+
+type kvTx interface {
+	kvBuckets
+	// ForEachBucket calls fn with the name of each top-level bucket.
+	ForEachBucket(fn func(name []byte) error) error
+	// OnCommit runs fn after the transaction commits.
+	OnCommit(fn func())
+}
+
+// kvBucket is a bucket within a transaction. As in BoltDB, ForEach passes
+// nested buckets with a nil value, and values are only valid until the
+// transaction ends.
+type kvBucket interface {
+	kvBuckets
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(k, v []byte) error) error
+	Cursor() kvCursor
+	NextSequence() (uint64, error)
+	Sequence() uint64
+	SetSequence(seq uint64) error
+	// Len returns the number of keys.
+	Len() int
+}
+
+// kvCursor walks a bucket in key order; both methods return a nil key at
+// the end.
+type kvCursor interface {
+	Seek(seek []byte) (key, value []byte)
+	Next() (key, value []byte)
+}
+
+// openDriver opens the store file at dbPath with the named driver ("" is
+// BoltDB).
+func openDriver(name, dbPath string) (driver, error) {
+	switch name {
+	case "", DriverBolt:
+		db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+		if err != nil {
+			return nil, fmt.Errorf("open bolt db: %w", err)
+		}
+		return &boltDriver{db: db, compressAbove: DefaultCompressThreshold}, nil
+	case DriverSQLite:
+		db, err := openSQLite(dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("open sqlite db: %w", err)
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q (expected %s or %s)", name, DriverBolt, DriverSQLite)
+	}
+}
+
+// writeObserver, if set, is told how long each write transaction took.
+var writeObserver atomic.Pointer[func(time.Duration)]
+
+// ObserveWrites has fn told how long each write transaction takes, on
+// either driver, e.g. for the daemon's /metrics.
+func ObserveWrites(fn func(time.Duration)) {
+	writeObserver.Store(&fn)
+}
+
+func observeWrite(start time.Time) {
+	if fn := writeObserver.Load(); fn != nil {
+		(*fn)(time.Since(start))
+	}
+}
+
+// ------------------------
+// BoltDB Driver
+// ------------------------
+
+type boltDriver struct {
+	db            *bolt.DB
+	compressAbove int // Records at least this long are stored compressed; 0 disables
+}
+
+func (d *boltDriver) View(fn func(tx kvTx) error) error {
+	return d.db.View(func(tx *bolt.Tx) error { return fn(boltTx{tx, d}) })
+}
+
+func (d *boltDriver) Update(fn func(tx kvTx) error) error {
+	defer observeWrite(time.Now())
+	return d.db.Update(func(tx *bolt.Tx) error { return fn(boltTx{tx, d}) })
+}
+
+func (d *boltDriver) Close() error {
+	return d.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+	d  *boltDriver
+}
+
+// bucket wraps a top-level bucket; only records are compressed.
+func (t boltTx) bucket(name []byte, b *bolt.Bucket) kvBucket {
+	if b == nil {
+		return nil
+	}
+	return boltBucket{b: b, compressAbove: t.d.compressAbove, records: string(name) == boltBucketName}
+}
+
+func (t boltTx) Bucket(name []byte) kvBucket {
+	return t.bucket(name, t.tx.Bucket(name))
+}
+
+func (t boltTx) CreateBucket(name []byte) (kvBucket, error) {
+	b, err := t.tx.CreateBucket(name)
+	return t.bucket(name, b), err
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (kvBucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	return t.bucket(name, b), err
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	return t.tx.DeleteBucket(name)
+}
+
+func (t boltTx) ForEachBucket(fn func(name []byte) error) error {
+	return t.tx.ForEach(func(name []byte, _ *bolt.Bucket) error { return fn(name) })
+}
+
+func (t boltTx) OnCommit(fn func()) {
+	t.tx.OnCommit(fn)
+}
+
+type boltBucket struct {
+	b             *bolt.Bucket
+	compressAbove int  // See boltDriver
+	records       bool // Whether values may be compressed
+}
+
+// wrapBoltBucket wraps a nested bucket, keeping a missing one a nil
+// interface.
+func wrapBoltBucket(b *bolt.Bucket) kvBucket {
+	if b == nil {
+		return nil
+	}
+	return boltBucket{b: b}
+}
+
+func (b boltBucket) Bucket(name []byte) kvBucket {
+	return wrapBoltBucket(b.b.Bucket(name))
+}
+
+func (b boltBucket) CreateBucket(name []byte) (kvBucket, error) {
+	nb, err := b.b.CreateBucket(name)
+	return wrapBoltBucket(nb), err
+}
+
+func (b boltBucket) CreateBucketIfNotExists(name []byte) (kvBucket, error) {
+	nb, err := b.b.CreateBucketIfNotExists(name)
+	return wrapBoltBucket(nb), err
+}
+
+func (b boltBucket) DeleteBucket(name []byte) error { return b.b.DeleteBucket(name) }
+func (b boltBucket) Delete(key []byte) error        { return b.b.Delete(key) }
+func (b boltBucket) NextSequence() (uint64, error)  { return b.b.NextSequence() }
+func (b boltBucket) Sequence() uint64               { return b.b.Sequence() }
+func (b boltBucket) SetSequence(seq uint64) error   { return b.b.SetSequence(seq) }
+func (b boltBucket) Len() int                       { return b.b.Stats().KeyN }
+
+func (b boltBucket) Get(key []byte) []byte {
+	if !b.records {
+		return b.b.Get(key)
+	}
+	return decompressValue(b.b.Get(key))
+}
+
+func (b boltBucket) Put(key, value []byte) error {
+	if b.records {
+		value = compressValue(value, b.compressAbove)
+	}
+	return b.b.Put(key, value)
+}
+
+func (b boltBucket) ForEach(fn func(k, v []byte) error) error {
+	if !b.records {
+		return b.b.ForEach(fn)
+	}
+	return b.b.ForEach(func(k, v []byte) error { return fn(k, decompressValue(v)) })
+}
+
+func (b boltBucket) Cursor() kvCursor {
+	if !b.records {
+		return b.b.Cursor()
+	}
+	return boltRecordCursor{b.b.Cursor()}
+}
+
+// boltRecordCursor decompresses the records it passes over.
+type boltRecordCursor struct {
+	c *bolt.Cursor
+}
+
+func (c boltRecordCursor) Seek(seek []byte) ([]byte, []byte) {
+	k, v := c.c.Seek(seek)
+	return k, decompressValue(v)
+}
+
+func (c boltRecordCursor) Next() ([]byte, []byte) {
+	k, v := c.c.Next()
+	return k, decompressValue(v)
+}
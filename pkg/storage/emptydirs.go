@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ------------------------
+// Empty Directory Tracking
+// ------------------------
+
+// Empty directories are keyed by "<hostID>|<path>" so that a rescan of a
+// root can replace exactly the entries it is responsible for. Paths are
+// sealed like file paths when the store's realm encrypts them.
+const emptyDirBucketName = "empty_dirs"
+
+// EmptyDir is a directory with no entries, as seen during a scan.
+type EmptyDir struct {
+	HostID string    `json:"hostID"`
+	Path   string    `json:"path"`
+	SeenAt time.Time `json:"seenAt"`
+}
+
+// ReplaceEmptyDirs records the empty directories found by scanning root on
+// hostID, dropping entries under root from earlier scans but for those
+// under the subtrees in unscanned, which the scan did not walk.
+func (ps *PersistentStore) ReplaceEmptyDirs(hostID, root string, unscanned, dirs []string) error {
+	now := time.Now()
+	return ps.db.Update(func(tx kvTx) error {
+		b := tx.Bucket([]byte(emptyDirBucketName))
+		prefix := []byte(hostID + "|")
+		if !ps.realm.Encrypts("filePath") {
+			prefix = append(prefix, root...) // Sealed paths do not sort by directory
+		}
+		var stale [][]byte
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			path := ps.realm.OpenPath(strings.TrimPrefix(string(k), hostID+"|"))
+			if !underDir(path, root) {
+				continue
+			}
+			kept := false
+			for _, dir := range unscanned {
+				kept = kept || underDir(path, dir)
+			}
+			if !kept {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		for _, dir := range dirs {
+			dir = ps.realm.SealPath(dir)
+			data, err := json.Marshal(EmptyDir{HostID: hostID, Path: dir, SeenAt: now})
+			if err != nil {
+				return fmt.Errorf("marshal empty dir: %w", err)
+			}
+			if err := b.Put([]byte(hostID+"|"+dir), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EmptyDirs returns every recorded empty directory.
+func (ps *PersistentStore) EmptyDirs() ([]EmptyDir, error) {
+	var dirs []EmptyDir
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(emptyDirBucketName)).ForEach(func(k, v []byte) error {
+			var d EmptyDir
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			d.Path = ps.realm.OpenPath(d.Path)
+			dirs = append(dirs, d)
+			return nil
+		})
+	})
+	return dirs, err
+}
+
+// underDir reports whether path is dir itself or lies beneath it.
+func underDir(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
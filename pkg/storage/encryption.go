@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Encrypted Fields at Rest
+// ------------------------
+
+// SetRealm makes the store seal the realm's encrypted fields (see
+// metadata.Realm) in every record it writes, and open them in every record
+// it returns. Records written before are sealed when next rewritten; records
+// sealed by another realm are returned sealed. The path and secondary
+// indexes hold sealed values only.
+func (ps *PersistentStore) SetRealm(realm *metadata.Realm) {
+	ps.realm = realm
+}
+
+// Realm returns the store's realm, which may be nil. Records leaving the
+// node (replication, swarm broadcasts, query answers) are sealed with it.
+func (ps *PersistentStore) Realm() *metadata.Realm {
+	return ps.realm
+}
+
+// encode validates a record and marshals it in its stored, sealed form.
+func (ps *PersistentStore) encode(meta metadata.FileMetadata) ([]byte, error) {
+	meta = ps.realm.Open(meta) // Records from peers arrive sealed
+	if err := ps.ValidateExtra(meta); err != nil {
+		return nil, err
+	}
+	sealed, err := ps.realm.Seal(meta)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("marshal metadata: %w", err)
+	}
+	return data, nil
+}
+
+// decode unmarshals a stored record and opens its sealed fields.
+func (ps *PersistentStore) decode(data []byte) (metadata.FileMetadata, error) {
+	var meta metadata.FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, err
+	}
+	return ps.realm.Open(meta), nil
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Host Retirement
+// ------------------------
+
+// A decommissioned host's records are archived rather than deleted: each is
+// rewritten under the same ID with metadata.ArchivedField set, so the
+// change replicates like any other, while Latest, ListFiles and the reports
+// built on them leave the host out. Archiving is one way; Merge keeps an
+// archived record over an unarchived copy of it from a peer.
+
+// RetireHost archives every record of hostID as of at, to be purged after
+// purgeAfter unless that is zero, and returns the archived records so that
+// they can be broadcast.
+func (ps *PersistentStore) RetireHost(hostID string, at, purgeAfter time.Time) ([]metadata.FileMetadata, error) {
+	var archived []metadata.FileMetadata
+	err := ps.db.Update(func(tx kvTx) error {
+		var metas []metadata.FileMetadata
+		err := tx.Bucket([]byte(boltBucketName)).ForEach(func(k, v []byte) error {
+			var meta metadata.FileMetadata
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return err
+			}
+			if meta.HostID == hostID && !meta.Archived() {
+				metas = append(metas, meta)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, meta := range metas {
+			meta = ps.realm.Open(meta)
+			extra := make(map[string]interface{}, len(meta.Extra)+3)
+			for k, v := range meta.Extra {
+				extra[k] = v
+			}
+			extra[metadata.ArchivedField] = true
+			extra[metadata.ArchivedAtField] = at.UTC().Format(time.RFC3339)
+			if !purgeAfter.IsZero() {
+				extra[metadata.PurgeAfterField] = purgeAfter.UTC().Format(time.RFC3339)
+			}
+			meta.Extra = extra
+			meta.SetRev("")
+			if err := ps.stampTx(tx, &meta); err != nil {
+				return err
+			}
+			if err := ps.revTx(tx, &meta); err != nil {
+				return err
+			}
+			data, err := ps.encode(meta)
+			if err != nil {
+				return err
+			}
+			if err := ps.putTx(tx, meta.ID, data); err != nil {
+				return err
+			}
+			archived = append(archived, meta)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return archived, nil
+}
+
+// PurgeRetired deletes the archived records whose purge time is before
+// now, and returns how many it deleted.
+func (ps *PersistentStore) PurgeRetired(now time.Time) (int, error) {
+	purged := 0
+	err := ps.db.Update(func(tx kvTx) error {
+		var ids [][]byte
+		err := tx.Bucket([]byte(boltBucketName)).ForEach(func(k, v []byte) error {
+			var meta metadata.FileMetadata
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return err
+			}
+			if at, ok := meta.PurgeAfter(); ok && at.Before(now) {
+				ids = append(ids, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := ps.deleteTx(tx, id); err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+		return nil
+	})
+	return purged, err
+}
+
+// HostSummary is what the store holds of one host.
+type HostSummary struct {
+	HostID     string    `json:"hostID"`
+	Records    int       `json:"records"`  // Every revision, tombstones included
+	Archived   int       `json:"archived"` // Records of the host archived by a retirement
+	LastSeen   string    `json:"lastSeen"` // Newest ModTime among its records
+	RetiredAt  time.Time `json:"retiredAt,omitzero"`
+	PurgeAfter time.Time `json:"purgeAfter,omitzero"`
+}
+
+// Retired reports whether the host has been retired and has not indexed
+// anything since.
+func (h HostSummary) Retired() bool {
+	return h.Archived > 0 && h.Archived == h.Records
+}
+
+// Hosts summarizes the records of every host in the store, by host ID.
+func (ps *PersistentStore) Hosts() ([]HostSummary, error) {
+	hosts := map[string]*HostSummary{}
+	err := ps.ForEach(func(meta metadata.FileMetadata) error {
+		h, ok := hosts[meta.HostID]
+		if !ok {
+			h = &HostSummary{HostID: meta.HostID}
+			hosts[meta.HostID] = h
+		}
+		h.Records++
+		if meta.ModTime > h.LastSeen {
+			h.LastSeen = meta.ModTime
+		}
+		if !meta.Archived() {
+			return nil
+		}
+		h.Archived++
+		if s, _ := meta.Extra[metadata.ArchivedAtField].(string); s != "" {
+			if at, err := time.Parse(time.RFC3339, s); err == nil && at.After(h.RetiredAt) {
+				h.RetiredAt = at
+			}
+		}
+		if at, ok := meta.PurgeAfter(); ok && at.After(h.PurgeAfter) {
+			h.PurgeAfter = at
+		}
+		return nil
+	})
+	summaries := make([]HostSummary, 0, len(hosts))
+	for _, h := range hosts {
+		summaries = append(summaries, *h)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].HostID < summaries[j].HostID })
+	return summaries, err
+}
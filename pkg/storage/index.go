@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Secondary Indexes on Extra Fields
+// ------------------------
+
+// Each indexed field gets a sub-bucket of indexBucketName. Keys are the
+// field value and the document ID separated by a NUL byte; values are empty.
+const indexBucketName = "extra_index"
+
+const indexSep = 0x00
+
+// SetIndexedFields declares which Extra fields (e.g. contentType, tags) are
+// indexed. Indexes for newly declared fields are built from existing records,
+// and indexes for fields no longer declared are dropped.
+func (ps *PersistentStore) SetIndexedFields(fields []string) error {
+	ps.indexedFields = fields
+	return ps.db.Update(func(tx kvTx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(indexBucketName))
+		if err != nil {
+			return err
+		}
+
+		declared := make(map[string]bool, len(fields))
+		for _, field := range fields {
+			declared[field] = true
+		}
+		var stale [][]byte
+		err = root.ForEach(func(k, v []byte) error {
+			if v == nil && !declared[string(k)] {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := root.DeleteBucket(k); err != nil {
+				return err
+			}
+		}
+
+		docs := tx.Bucket([]byte(boltBucketName))
+		for _, field := range fields {
+			if root.Bucket([]byte(field)) != nil {
+				continue
+			}
+			fb, err := root.CreateBucket([]byte(field))
+			if err != nil {
+				return fmt.Errorf("create index %s: %w", field, err)
+			}
+			err = docs.ForEach(func(k, v []byte) error {
+				var meta metadata.FileMetadata
+				if err := json.Unmarshal(v, &meta); err != nil {
+					return err
+				}
+				for _, key := range indexKeys(&meta, field) {
+					if err := fb.Put(key, nil); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("build index %s: %w", field, err)
+			}
+		}
+		return nil
+	})
+}
+
+// IndexedFields returns the Extra fields that currently have an index.
+func (ps *PersistentStore) IndexedFields() []string {
+	return ps.indexedFields
+}
+
+func indexKeys(meta *metadata.FileMetadata, field string) [][]byte {
+	var keys [][]byte
+	for _, v := range meta.FieldStrings(field) {
+		key := make([]byte, 0, len(v)+1+len(meta.ID))
+		key = append(key, v...)
+		key = append(key, indexSep)
+		key = append(key, meta.ID...)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (ps *PersistentStore) indexTx(tx kvTx, data []byte) error {
+	return ps.updateIndexTx(tx, data, func(b kvBucket, key []byte) error {
+		return b.Put(key, nil)
+	})
+}
+
+func (ps *PersistentStore) unindexTx(tx kvTx, data []byte) error {
+	return ps.updateIndexTx(tx, data, func(b kvBucket, key []byte) error {
+		return b.Delete(key)
+	})
+}
+
+func (ps *PersistentStore) updateIndexTx(tx kvTx, data []byte, apply func(kvBucket, []byte) error) error {
+	if len(ps.indexedFields) == 0 {
+		return nil
+	}
+	root := tx.Bucket([]byte(indexBucketName))
+	if root == nil {
+		return nil
+	}
+	var meta metadata.FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	for _, field := range ps.indexedFields {
+		fb := root.Bucket([]byte(field))
+		if fb == nil {
+			continue
+		}
+		for _, key := range indexKeys(&meta, field) {
+			if err := apply(fb, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Find returns the records whose fields equal every value in selector, in
+// the manner of a CouchDB Mango equality selector. If any selected field is
+// indexed, the index narrows the candidates; otherwise the store is scanned.
+func (ps *PersistentStore) Find(selector map[string]string) ([]metadata.FileMetadata, error) {
+	var results []metadata.FileMetadata
+	err := ps.db.View(func(tx kvTx) error {
+		docs := tx.Bucket([]byte(boltBucketName))
+		check := func(v []byte) error {
+			meta, err := ps.decode(v)
+			if err != nil {
+				return err
+			}
+			if matchesSelector(&meta, selector) {
+				results = append(results, meta)
+			}
+			return nil
+		}
+
+		if root := tx.Bucket([]byte(indexBucketName)); root != nil {
+			for _, field := range ps.indexedFields {
+				want, ok := selector[field]
+				if !ok || ps.realm.Encrypts(field) { // Indexed values are sealed
+					continue
+				}
+				fb := root.Bucket([]byte(field))
+				if fb == nil {
+					continue
+				}
+				prefix := append([]byte(want), indexSep)
+				c := fb.Cursor()
+				for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+					if v := docs.Get(k[len(prefix):]); v != nil {
+						if err := check(v); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			}
+		}
+
+		return docs.ForEach(func(k, v []byte) error {
+			return check(v)
+		})
+	})
+	return results, err
+}
+
+func matchesSelector(meta *metadata.FileMetadata, selector map[string]string) bool {
+	for field, want := range selector {
+		found := false
+		for _, v := range meta.FieldStrings(field) {
+			if v == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gnomatix/dreamfs/v2/pkg/manifest"
+)
+
+// ------------------------
+// Scan Manifests
+// ------------------------
+
+// Manifests are kept in the order they were written, keyed by sequence (8
+// bytes, big-endian). The root is sealed with the realm like any path.
+const manifestBucketName = "manifests"
+
+// AddManifest stores a signed scan manifest.
+func (ps *PersistentStore) AddManifest(m manifest.Manifest) error {
+	m.Root = ps.realm.SealPath(m.Root)
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ps.db.Update(func(tx kvTx) error {
+		b := tx.Bucket([]byte(manifestBucketName))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(seqKey(seq), data)
+	})
+}
+
+// Manifests returns the stored manifests, oldest first, optionally only
+// those of one root.
+func (ps *PersistentStore) Manifests(root string) ([]manifest.Manifest, error) {
+	var manifests []manifest.Manifest
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(manifestBucketName)).ForEach(func(k, v []byte) error {
+			var m manifest.Manifest
+			if err := json.Unmarshal(v, &m); err != nil {
+				return fmt.Errorf("decode manifest: %w", err)
+			}
+			m.Root = ps.realm.OpenPath(m.Root)
+			if root == "" || m.Root == root {
+				manifests = append(manifests, m)
+			}
+			return nil
+		})
+	})
+	return manifests, err
+}
+
+// Manifest returns the stored manifest whose ID starts with id.
+func (ps *PersistentStore) Manifest(id string) (manifest.Manifest, bool, error) {
+	manifests, err := ps.Manifests("")
+	if err != nil || id == "" {
+		return manifest.Manifest{}, false, err
+	}
+	for i := len(manifests) - 1; i >= 0; i-- {
+		if strings.HasPrefix(manifests[i].ID, id) {
+			return manifests[i], true, nil
+		}
+	}
+	return manifest.Manifest{}, false, nil
+}
@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ------------------------
+// Cross-Driver Migration
+// ------------------------
+
+// migrationBucketName holds a migration's progress in the target store
+// until it has been verified, so an interrupted migration can resume.
+const migrationBucketName = "_migration"
+
+// Progress keys in the migration bucket. Bucket paths are their names
+// joined with NUL bytes.
+var (
+	migrationSourceKey = []byte("source")
+	migrationCursor    = []byte("cursor\x00") // + path -> last key copied
+	migrationDone      = []byte("done\x00")   // + path -> present once copied
+)
+
+// MigrateProgress reports how far the copy of one bucket has got.
+type MigrateProgress struct {
+	Bucket string // Slash-separated for nested buckets
+	Copied int
+	Total  int
+}
+
+// BucketCount is the number of keys in a bucket of the source and target
+// stores after a migration.
+type BucketCount struct {
+	Bucket string
+	Source int
+	Target int
+}
+
+// Migrate copies every bucket, key and sequence of the store at fromPath
+// (driver fromDriver) into a new store at toPath (driver toDriver), batch
+// keys per transaction, calling progress (if set) after each batch. A
+// migration that was interrupted, or cancelled through ctx, resumes where
+// it stopped when run again with the same source; the target must
+// otherwise be empty. Finally the keys of each bucket are counted in both
+// stores, and an error returned with the counts if any differ.
+func Migrate(ctx context.Context, fromDriver, fromPath, toDriver, toPath string, batch int, progress func(MigrateProgress)) ([]BucketCount, error) {
+	if batch < 1 {
+		batch = 1
+	}
+	if _, err := os.Stat(fromPath); err != nil {
+		return nil, err
+	}
+	absFrom, err := filepath.Abs(fromPath)
+	if err != nil {
+		return nil, err
+	}
+	if absTo, err := filepath.Abs(toPath); err != nil {
+		return nil, err
+	} else if absTo == absFrom {
+		return nil, errors.New("source and target are the same file")
+	}
+	if err := os.MkdirAll(filepath.Dir(toPath), 0755); err != nil {
+		return nil, err
+	}
+	src, err := openDriver(fromDriver, fromPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	dst, err := openDriver(toDriver, toPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	source := []byte(driverName(fromDriver) + ":" + absFrom)
+	if err := startMigration(dst, source); err != nil {
+		return nil, err
+	}
+
+	var paths [][][]byte
+	counts := map[string]int{}
+	err = src.View(func(tx kvTx) error {
+		return tx.ForEachBucket(func(name []byte) error {
+			if string(name) == migrationBucketName {
+				return nil
+			}
+			return walkBuckets(tx.Bucket(name), [][]byte{bytes.Clone(name)}, func(path [][]byte, b kvBucket) error {
+				paths = append(paths, path)
+				counts[bucketLabel(path)] = countKeys(b)
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read source: %w", err)
+	}
+
+	for _, path := range paths {
+		if err := copyBucket(ctx, src, dst, path, batch, counts[bucketLabel(path)], progress); err != nil {
+			return nil, fmt.Errorf("copy bucket %s: %w", bucketLabel(path), err)
+		}
+	}
+
+	var result []BucketCount
+	mismatch := false
+	err = dst.View(func(tx kvTx) error {
+		for _, path := range paths {
+			n := 0
+			if b := bucketAt(tx, path); b != nil {
+				n = countKeys(b)
+			}
+			label := bucketLabel(path)
+			result = append(result, BucketCount{Bucket: label, Source: counts[label], Target: n})
+			mismatch = mismatch || n != counts[label]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verify target: %w", err)
+	}
+	if mismatch {
+		return result, errors.New("key counts differ between source and target")
+	}
+	return result, dst.Update(func(tx kvTx) error {
+		return tx.DeleteBucket([]byte(migrationBucketName))
+	})
+}
+
+// startMigration records source in the target's migration bucket, or
+// checks that an unfinished migration there came from it.
+func startMigration(dst driver, source []byte) error {
+	return dst.Update(func(tx kvTx) error {
+		if mb := tx.Bucket([]byte(migrationBucketName)); mb != nil {
+			if prev := mb.Get(migrationSourceKey); !bytes.Equal(prev, source) {
+				return fmt.Errorf("target holds an unfinished migration from %s", prev)
+			}
+			return nil
+		}
+		empty := true
+		err := tx.ForEachBucket(func(name []byte) error {
+			return walkBuckets(tx.Bucket(name), nil, func(_ [][]byte, b kvBucket) error {
+				empty = empty && countKeys(b) == 0
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return errors.New("target already holds data")
+		}
+		mb, err := tx.CreateBucket([]byte(migrationBucketName))
+		if err != nil {
+			return err
+		}
+		return mb.Put(migrationSourceKey, source)
+	})
+}
+
+// copyBucket copies the keys of the bucket at path batch at a time,
+// starting after the last key a previous run copied.
+func copyBucket(ctx context.Context, src, dst driver, path [][]byte, batch, total int, progress func(MigrateProgress)) error {
+	pathKey := bytes.Join(path, []byte{0})
+	cursorKey := append(bytes.Clone(migrationCursor), pathKey...)
+	doneKey := append(bytes.Clone(migrationDone), pathKey...)
+	var last []byte
+	done := false
+	copied := 0
+	err := dst.View(func(tx kvTx) error {
+		mb := tx.Bucket([]byte(migrationBucketName))
+		done = mb.Get(doneKey) != nil
+		if last = bytes.Clone(mb.Get(cursorKey)); last != nil {
+			copied = countKeysThrough(bucketAt(tx, path), last)
+		}
+		return nil
+	})
+	if err != nil || done {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var keys, values [][]byte
+		var seq uint64
+		err := src.View(func(tx kvTx) error {
+			b := bucketAt(tx, path)
+			if b == nil {
+				return errors.New("bucket disappeared from the source")
+			}
+			seq = b.Sequence()
+			c := b.Cursor()
+			k, v := c.Seek(last)
+			if last != nil && bytes.Equal(k, last) {
+				k, v = c.Next()
+			}
+			for ; k != nil && len(keys) < batch; k, v = c.Next() {
+				if v == nil {
+					continue // A nested bucket, copied on its own
+				}
+				keys, values = append(keys, bytes.Clone(k)), append(values, bytes.Clone(v))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		finished := len(keys) < batch
+		err = dst.Update(func(tx kvTx) error {
+			b, err := createBucketAt(tx, path)
+			if err != nil {
+				return err
+			}
+			for i := range keys {
+				if err := b.Put(keys[i], values[i]); err != nil {
+					return err
+				}
+			}
+			if err := b.SetSequence(seq); err != nil {
+				return err
+			}
+			mb := tx.Bucket([]byte(migrationBucketName))
+			if finished {
+				return mb.Put(doneKey, []byte{1})
+			}
+			return mb.Put(cursorKey, keys[len(keys)-1])
+		})
+		if err != nil {
+			return err
+		}
+		copied += len(keys)
+		if len(keys) > 0 {
+			last = keys[len(keys)-1]
+		}
+		if progress != nil {
+			progress(MigrateProgress{Bucket: bucketLabel(path), Copied: copied, Total: total})
+		}
+		if finished {
+			return nil
+		}
+	}
+}
+
+// walkBuckets calls fn with b and then each bucket nested in it.
+func walkBuckets(b kvBucket, path [][]byte, fn func(path [][]byte, b kvBucket) error) error {
+	if b == nil {
+		return nil
+	}
+	if err := fn(path, b); err != nil {
+		return err
+	}
+	var nested [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nested = append(nested, bytes.Clone(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range nested {
+		child := append(append([][]byte{}, path...), name)
+		if err := walkBuckets(b.Bucket(name), child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bucketAt returns the bucket at path, or nil.
+func bucketAt(tx kvTx, path [][]byte) kvBucket {
+	b := tx.Bucket(path[0])
+	for _, name := range path[1:] {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket(name)
+	}
+	return b
+}
+
+// createBucketAt returns the bucket at path, creating it and its parents.
+func createBucketAt(tx kvTx, path [][]byte) (kvBucket, error) {
+	b, err := tx.CreateBucketIfNotExists(path[0])
+	for _, name := range path[1:] {
+		if err != nil {
+			return nil, err
+		}
+		b, err = b.CreateBucketIfNotExists(name)
+	}
+	return b, err
+}
+
+// countKeys counts a bucket's keys, leaving out nested buckets.
+func countKeys(b kvBucket) int {
+	return countKeysThrough(b, nil)
+}
+
+// countKeysThrough counts a bucket's keys up to and including through, or
+// all of them if through is nil.
+func countKeysThrough(b kvBucket, through []byte) int {
+	if b == nil {
+		return 0
+	}
+	n := 0
+	c := b.Cursor()
+	for k, v := c.Seek(nil); k != nil; k, v = c.Next() {
+		if through != nil && bytes.Compare(k, through) > 0 {
+			break
+		}
+		if v != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func bucketLabel(path [][]byte) string {
+	names := make([]string, len(path))
+	for i, name := range path {
+		names[i] = string(name)
+	}
+	return strings.Join(names, "/")
+}
+
+func driverName(name string) string {
+	if name == "" {
+		return DriverBolt
+	}
+	return name
+}
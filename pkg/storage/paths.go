@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Latest Revision per Path
+// ------------------------
+
+// The path index maps "<hostID>|<path>" to the ID of the newest record for
+// that file, so a rescan can find a file's last revision without scanning.
+const pathBucketName = "latest_paths"
+
+// buildPathIndex fills the path index from the stored records. It runs
+// once, when a store created before the index existed is opened.
+func buildPathIndex(tx kvTx) error {
+	if tx.Bucket([]byte(pathBucketName)) != nil {
+		return nil
+	}
+	pb, err := tx.CreateBucket([]byte(pathBucketName))
+	if err != nil {
+		return err
+	}
+	newest := map[string]metadata.FileMetadata{}
+	err = tx.Bucket([]byte(boltBucketName)).ForEach(func(k, v []byte) error {
+		var meta metadata.FileMetadata
+		if err := json.Unmarshal(v, &meta); err != nil {
+			return err
+		}
+		key := meta.HostID + "|" + meta.FilePath
+		if cur, ok := newest[key]; !ok || Newer(meta, cur) {
+			// Only the fields Newer compares are kept
+			newest[key] = metadata.FileMetadata{ID: meta.ID, ModTime: meta.ModTime, Extra: map[string]interface{}{metadata.DeletedField: meta.Deleted()}}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("build path index: %w", err)
+	}
+	for key, meta := range newest {
+		if err := pb.Put([]byte(key), []byte(meta.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updatePathTx points the path index at meta if it is the newest revision
+// of its file.
+func updatePathTx(tx kvTx, meta metadata.FileMetadata) error {
+	pb := tx.Bucket([]byte(pathBucketName))
+	key := []byte(meta.HostID + "|" + meta.FilePath)
+	if id := pb.Get(key); id != nil && string(id) != meta.ID {
+		if data := tx.Bucket([]byte(boltBucketName)).Get(id); data != nil {
+			var cur metadata.FileMetadata
+			if err := json.Unmarshal(data, &cur); err == nil && Newer(cur, meta) {
+				return nil
+			}
+		}
+	}
+	return pb.Put(key, []byte(meta.ID))
+}
+
+// LatestFor returns the newest stored revision of hostID's file at path,
+// which may be a tombstone.
+func (ps *PersistentStore) LatestFor(hostID, path string) (metadata.FileMetadata, bool, error) {
+	var meta metadata.FileMetadata
+	var found bool
+	err := ps.db.View(func(tx kvTx) error {
+		var err error
+		meta, found, err = ps.latestForTx(tx, hostID, path)
+		return err
+	})
+	return meta, found, err
+}
+
+func (ps *PersistentStore) latestForTx(tx kvTx, hostID, path string) (metadata.FileMetadata, bool, error) {
+	id := tx.Bucket([]byte(pathBucketName)).Get([]byte(hostID + "|" + ps.realm.SealPath(path)))
+	if id == nil {
+		return metadata.FileMetadata{}, false, nil
+	}
+	data := tx.Bucket([]byte(boltBucketName)).Get(id)
+	if data == nil {
+		return metadata.FileMetadata{}, false, nil
+	}
+	meta, err := ps.decode(data)
+	return meta, true, err
+}
+
+// ErrInvalidCursor is returned for a ListFiles cursor it did not issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FileFilter selects current files for ListFiles. Zero fields do not
+// filter.
+type FileFilter struct {
+	HostID  string
+	Prefix  string // Path prefix
+	MinSize int64
+	MaxSize int64
+	After   time.Time // ModTime bounds, inclusive
+	Before  time.Time
+}
+
+// Match reports whether a record passes the filter.
+func (f FileFilter) Match(meta metadata.FileMetadata) bool {
+	if f.HostID != "" && meta.HostID != f.HostID || !strings.HasPrefix(meta.FilePath, f.Prefix) {
+		return false
+	}
+	if meta.Size < f.MinSize || f.MaxSize > 0 && meta.Size > f.MaxSize {
+		return false
+	}
+	if !f.After.IsZero() || !f.Before.IsZero() {
+		t, err := time.Parse(time.RFC3339, meta.ModTime)
+		if err != nil || !f.After.IsZero() && t.Before(f.After) || !f.Before.IsZero() && t.After(f.Before) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListFiles returns up to limit current files (newest revisions, without
+// deleted files or those of retired hosts) matching f, walking the path
+// index from after, an opaque cursor returned as next by the previous page
+// ("" for the first). next is "" on the last page. Only the requested page
+// is read into memory.
+//
+// With a host, the walk seeks straight to the host's files, and to the
+// path prefix too unless the realm encrypts paths.
+func (ps *PersistentStore) ListFiles(f FileFilter, after string, limit int) (files []metadata.FileMetadata, next string, err error) {
+	var seek []byte
+	if f.HostID != "" {
+		seek = []byte(f.HostID + "|")
+		if !ps.realm.Encrypts("filePath") {
+			seek = append(seek, f.Prefix...)
+		}
+	}
+	var cursor []byte
+	if after != "" {
+		if cursor, err = base64.RawURLEncoding.DecodeString(after); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+	var lastKey []byte
+	err = ps.db.View(func(tx kvTx) error {
+		docs := tx.Bucket([]byte(boltBucketName))
+		c := tx.Bucket([]byte(pathBucketName)).Cursor()
+		k, id := c.Seek(seek)
+		if cursor != nil {
+			if k, id = c.Seek(cursor); k != nil && bytes.Equal(k, cursor) {
+				k, id = c.Next()
+			}
+		}
+		for ; k != nil && bytes.HasPrefix(k, seek); k, id = c.Next() {
+			data := docs.Get(id)
+			if data == nil {
+				continue
+			}
+			meta, err := ps.decode(data)
+			if err != nil {
+				return err
+			}
+			if meta.Deleted() || meta.Archived() || !f.Match(meta) {
+				continue
+			}
+			if limit > 0 && len(files) == limit {
+				next = base64.RawURLEncoding.EncodeToString(lastKey)
+				return nil
+			}
+			files = append(files, meta)
+			lastKey = append(lastKey[:0], k...)
+		}
+		return nil
+	})
+	return files, next, err
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ------------------------
+// Known Swarm Peers
+// ------------------------
+
+// peerBucketName holds the swarm peers this node has been joined with, by
+// address, so that it can find the swarm again after a restart.
+const peerBucketName = "swarm_peers"
+
+// KnownPeer is a swarm peer's address and when it was last a member.
+type KnownPeer struct {
+	Addr     string    `json:"addr"` // host:port of its swarm port
+	Name     string    `json:"name,omitempty"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// NotePeer records that the peer at p.Addr is a member as of p.LastSeen.
+func (ps *PersistentStore) NotePeer(p KnownPeer) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("marshal peer: %w", err)
+	}
+	return ps.db.Update(func(tx kvTx) error {
+		return tx.Bucket([]byte(peerBucketName)).Put([]byte(p.Addr), data)
+	})
+}
+
+// KnownPeers returns the recorded peers, most recently seen first.
+func (ps *PersistentStore) KnownPeers() ([]KnownPeer, error) {
+	var peers []KnownPeer
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(peerBucketName)).ForEach(func(k, v []byte) error {
+			var p KnownPeer
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			peers = append(peers, p)
+			return nil
+		})
+	})
+	sort.Slice(peers, func(i, j int) bool { return peers[i].LastSeen.After(peers[j].LastSeen) })
+	return peers, err
+}
+
+// ForgetPeers removes the peers last seen before cutoff, returning how many.
+func (ps *PersistentStore) ForgetPeers(cutoff time.Time) (int, error) {
+	removed := 0
+	err := ps.db.Update(func(tx kvTx) error {
+		b := tx.Bucket([]byte(peerBucketName))
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var p KnownPeer
+			if err := json.Unmarshal(v, &p); err != nil || p.LastSeen.Before(cutoff) {
+				stale = append(stale, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return nil
+	})
+	return removed, err
+}
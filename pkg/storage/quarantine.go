@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gnomatix/dreamfs/v2/pkg/quarantine"
+)
+
+// ------------------------
+// Quarantined Files
+// ------------------------
+
+// Quarantine entries are keyed by ID. The original path is sealed with the
+// realm like any path.
+const quarantineBucketName = "quarantine"
+
+// AddQuarantine records a file moved into quarantine.
+func (ps *PersistentStore) AddQuarantine(e quarantine.Entry) error {
+	e.Path = ps.realm.SealPath(e.Path)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return ps.db.Update(func(tx kvTx) error {
+		return tx.Bucket([]byte(quarantineBucketName)).Put([]byte(e.ID), data)
+	})
+}
+
+// Quarantined returns the quarantined files, oldest first.
+func (ps *PersistentStore) Quarantined() ([]quarantine.Entry, error) {
+	var entries []quarantine.Entry
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(quarantineBucketName)).ForEach(func(k, v []byte) error {
+			var e quarantine.Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("decode quarantine entry: %w", err)
+			}
+			e.Path = ps.realm.OpenPath(e.Path)
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Quarantined.Before(entries[j].Quarantined)
+	})
+	return entries, nil
+}
+
+// QuarantineEntry returns the quarantined file whose ID starts with id. An
+// ambiguous prefix is an error.
+func (ps *PersistentStore) QuarantineEntry(id string) (quarantine.Entry, bool, error) {
+	entries, err := ps.Quarantined()
+	if err != nil || id == "" {
+		return quarantine.Entry{}, false, err
+	}
+	var match []quarantine.Entry
+	for _, e := range entries {
+		if strings.HasPrefix(e.ID, id) {
+			match = append(match, e)
+		}
+	}
+	switch len(match) {
+	case 0:
+		return quarantine.Entry{}, false, nil
+	case 1:
+		return match[0], true, nil
+	default:
+		return quarantine.Entry{}, false, fmt.Errorf("quarantine ID %s is ambiguous (%d matches)", id, len(match))
+	}
+}
+
+// RemoveQuarantine forgets a quarantine entry, once its file is restored or
+// purged.
+func (ps *PersistentStore) RemoveQuarantine(id string) error {
+	return ps.db.Update(func(tx kvTx) error {
+		return tx.Bucket([]byte(quarantineBucketName)).Delete([]byte(id))
+	})
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Document Revisions
+// ------------------------
+
+// Records carry CouchDB-style revisions (see metadata.RevField). A write by
+// this host gives a record the revision following the stored copy's;
+// records merged from peers keep the revision they arrive with, and are
+// given one the same way if they have none, so that hosts storing the same
+// write of a record agree on its revision. Records stored before revisions
+// were kept are taken to be at the revision the change log gave them.
+
+// ErrRevConflict is returned for an edit of a revision that is not the
+// current one, as CouchDB answers 409 Conflict.
+var ErrRevConflict = errors.New("document update conflict")
+
+// revOfTx returns the revision of the stored record id, and whether there
+// is one.
+func revOfTx(tx kvTx, id string) (string, bool, error) {
+	data := tx.Bucket([]byte(boltBucketName)).Get([]byte(id))
+	if data == nil {
+		return "", false, nil
+	}
+	rev, err := storedRev(data)
+	return rev, true, err
+}
+
+// storedRev returns the revision of an encoded record.
+func storedRev(data []byte) (string, error) {
+	var meta metadata.FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", err
+	}
+	if rev := meta.Rev(); rev != "" {
+		return rev, nil
+	}
+	return revOf(data), nil
+}
+
+// revTx gives meta the revision following that of the stored copy, unless
+// it has one. The content hashed is the record opened, as all hosts of a
+// realm see it.
+func (ps *PersistentStore) revTx(tx kvTx, meta *metadata.FileMetadata) error {
+	if meta.Rev() != "" {
+		return nil
+	}
+	prev, _, err := revOfTx(tx, meta.ID)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(ps.realm.Open(*meta))
+	if err != nil {
+		return err
+	}
+	meta.SetRev(metadata.NextRev(prev, content))
+	return nil
+}
+
+// Doc returns the record with the given ID with its revision, which
+// records stored before revisions were kept lack.
+func (ps *PersistentStore) Doc(id string) (metadata.FileMetadata, bool, error) {
+	var meta metadata.FileMetadata
+	var found bool
+	err := ps.db.View(func(tx kvTx) error {
+		data := tx.Bucket([]byte(boltBucketName)).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		var err error
+		if meta, err = ps.decode(data); err != nil {
+			return err
+		}
+		if meta.Rev() == "" {
+			meta.SetRev(revOf(data))
+		}
+		return nil
+	})
+	return meta, found, err
+}
+
+// Edit stores meta as an edit of revision rev of the record ("" to create
+// it), as a CouchDB client writes, and returns the record as stored. It
+// fails with ErrRevConflict if rev is not the stored revision.
+func (ps *PersistentStore) Edit(meta metadata.FileMetadata, rev string) (metadata.FileMetadata, error) {
+	err := ps.db.Update(func(tx kvTx) error {
+		cur, found, err := revOfTx(tx, meta.ID)
+		if err != nil {
+			return err
+		}
+		if (found && cur != rev) || (!found && rev != "") {
+			return ErrRevConflict
+		}
+		meta.SetRev("")
+		if err := ps.versionTx(tx, &meta); err != nil {
+			return err
+		}
+		if err := ps.revTx(tx, &meta); err != nil {
+			return err
+		}
+		return ps.storeTx(tx, meta)
+	})
+	return meta, err
+}
+
+// DeleteRev deletes the record with the given ID from this store, as Delete
+// does, if rev is its revision, failing with ErrRevConflict otherwise. It
+// returns the revision of the deletion.
+func (ps *PersistentStore) DeleteRev(id, rev string) (string, error) {
+	var deleted string
+	err := ps.db.Update(func(tx kvTx) error {
+		cur, found, err := revOfTx(tx, id)
+		if err != nil {
+			return err
+		}
+		if !found || cur != rev {
+			return ErrRevConflict
+		}
+		deleted = deletionRev(cur)
+		return ps.deleteTx(tx, []byte(id))
+	})
+	return deleted, err
+}
+
+// deletionRev returns the revision of the deletion of a record at rev.
+func deletionRev(rev string) string {
+	return metadata.NextRev(rev, []byte(`{"_deleted":true}`))
+}
+
+// MergeDeletion deletes the record with the given ID from this store, as a
+// replicator's deletion at revision rev, unless the stored revision wins
+// over it. It reports whether the record was deleted (or was not stored).
+func (ps *PersistentStore) MergeDeletion(id, rev string) (bool, error) {
+	var deleted bool
+	err := ps.db.Update(func(tx kvTx) error {
+		cur, found, err := revOfTx(tx, id)
+		if err != nil || !found {
+			deleted = err == nil
+			return err
+		}
+		if cur == rev || metadata.RevWins(cur, rev) {
+			return nil
+		}
+		deleted = true
+		return ps.deleteTx(tx, []byte(id))
+	})
+	return deleted, err
+}
+
+// localDocBucketName holds CouchDB "_local" documents, such as replicator
+// checkpoints, by ID. They are neither replicated nor in the change log.
+const localDocBucketName = "local_docs"
+
+// LocalDoc returns the _local document with the given ID (without the
+// "_local/" prefix).
+func (ps *PersistentStore) LocalDoc(id string) (map[string]interface{}, bool, error) {
+	var doc map[string]interface{}
+	found, err := ps.getNamed(localDocBucketName, id, &doc)
+	return doc, found, err
+}
+
+// PutLocalDoc stores a _local document, at revision "0-<n>" as CouchDB
+// numbers them, and returns the revision.
+func (ps *PersistentStore) PutLocalDoc(id string, doc map[string]interface{}) (string, error) {
+	var old map[string]interface{}
+	if _, err := ps.getNamed(localDocBucketName, id, &old); err != nil {
+		return "", err
+	}
+	prev, _ := old[metadata.RevField].(string)
+	_, n := metadata.RevGeneration(prev)
+	gen, _ := strconv.Atoi(n)
+	rev := fmt.Sprintf("0-%d", gen+1)
+	doc[metadata.RevField] = rev
+	return rev, ps.putNamed(localDocBucketName, id, doc)
+}
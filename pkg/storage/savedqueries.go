@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ------------------------
+// Saved Queries and Collections
+// ------------------------
+
+// Saved queries and collections are keyed by name. A saved query keeps the
+// expression and is run again each time; a collection keeps the record IDs
+// that matched when it was saved.
+const (
+	savedQueryBucketName = "saved_queries"
+	collectionBucketName = "collections"
+)
+
+// SavedQuery is a named filter expression (see package query).
+type SavedQuery struct {
+	Name       string    `json:"name"`
+	Expression string    `json:"expression"`
+	Created    time.Time `json:"created"`
+}
+
+// Collection is a named, fixed set of records.
+type Collection struct {
+	Name    string    `json:"name"`
+	Query   string    `json:"query,omitempty"` // The expression the records matched
+	IDs     []string  `json:"ids"`
+	Created time.Time `json:"created"`
+}
+
+// SaveQuery stores q under its name, replacing any query of that name.
+func (ps *PersistentStore) SaveQuery(q SavedQuery) error {
+	return ps.putNamed(savedQueryBucketName, q.Name, q)
+}
+
+// SavedQuery returns the query saved under name.
+func (ps *PersistentStore) SavedQuery(name string) (SavedQuery, bool, error) {
+	var q SavedQuery
+	found, err := ps.getNamed(savedQueryBucketName, name, &q)
+	return q, found, err
+}
+
+// SavedQueries returns the saved queries by name.
+func (ps *PersistentStore) SavedQueries() ([]SavedQuery, error) {
+	var queries []SavedQuery
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(savedQueryBucketName)).ForEach(func(k, v []byte) error {
+			var q SavedQuery
+			if err := json.Unmarshal(v, &q); err != nil {
+				return fmt.Errorf("decode saved query %s: %w", k, err)
+			}
+			queries = append(queries, q)
+			return nil
+		})
+	})
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries, err
+}
+
+// SaveCollection stores c under its name, replacing any collection of that
+// name.
+func (ps *PersistentStore) SaveCollection(c Collection) error {
+	return ps.putNamed(collectionBucketName, c.Name, c)
+}
+
+// Collection returns the collection saved under name.
+func (ps *PersistentStore) Collection(name string) (Collection, bool, error) {
+	var c Collection
+	found, err := ps.getNamed(collectionBucketName, name, &c)
+	return c, found, err
+}
+
+// Collections returns the saved collections by name.
+func (ps *PersistentStore) Collections() ([]Collection, error) {
+	var collections []Collection
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(collectionBucketName)).ForEach(func(k, v []byte) error {
+			var c Collection
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("decode collection %s: %w", k, err)
+			}
+			collections = append(collections, c)
+			return nil
+		})
+	})
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+	return collections, err
+}
+
+func (ps *PersistentStore) putNamed(bucket, name string, v interface{}) error {
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ps.db.Update(func(tx kvTx) error {
+		return tx.Bucket([]byte(bucket)).Put([]byte(name), data)
+	})
+}
+
+func (ps *PersistentStore) getNamed(bucket, name string, v interface{}) (bool, error) {
+	var found bool
+	err := ps.db.View(func(tx kvTx) error {
+		data := tx.Bucket([]byte(bucket)).Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, v)
+	})
+	return found, err
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ------------------------
+// Scan Checkpoints
+// ------------------------
+
+// An index run of a root keeps its progress under "<hostID>|<root>\x00":
+// the checkpoint itself, and one "<prefix><dir>" key per directory whose
+// files have all been indexed. They are removed when the run completes.
+const scanCheckpointBucketName = "scan_checkpoints"
+
+// ScanCheckpoint is how far an unfinished index run of a root got.
+type ScanCheckpoint struct {
+	Started time.Time `json:"started"`
+	LastDir string    `json:"lastDir,omitempty"` // Most recently completed directory
+	Pending int       `json:"pending"`           // Directories found but not completed when last saved
+	// Tallies of the files indexed so far, carried into the summary
+	Scanned  int `json:"scanned"`
+	Changed  int `json:"changed"`
+	Skipped  int `json:"skipped"`
+	ZeroByte int `json:"zeroByte"`
+	Errors   int `json:"errors"`
+
+	Done map[string]bool `json:"-"` // Directories whose own files are all indexed
+}
+
+func (ps *PersistentStore) scanCheckpointPrefix(hostID, root string) []byte {
+	return []byte(hostID + "|" + ps.realm.SealPath(root) + "\x00")
+}
+
+// ScanCheckpoint returns the checkpoint of an unfinished index run of root,
+// with its completed directories.
+func (ps *PersistentStore) ScanCheckpoint(hostID, root string) (ScanCheckpoint, bool, error) {
+	var cp ScanCheckpoint
+	found := false
+	prefix := ps.scanCheckpointPrefix(hostID, root)
+	err := ps.db.View(func(tx kvTx) error {
+		b := tx.Bucket([]byte(scanCheckpointBucketName))
+		if b == nil {
+			return nil
+		}
+		data := b.Get(prefix)
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &cp); err != nil {
+			return fmt.Errorf("decode scan checkpoint: %w", err)
+		}
+		found = true
+		cp.Done = map[string]bool{}
+		c := b.Cursor()
+		c.Seek(prefix) // The checkpoint itself
+		for k, _ := c.Next(); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			cp.Done[ps.realm.OpenPath(string(k[len(prefix):]))] = true
+		}
+		return nil
+	})
+	return cp, found, err
+}
+
+// SaveScanCheckpoint records cp for root, and dirs as completed.
+func (ps *PersistentStore) SaveScanCheckpoint(hostID, root string, cp ScanCheckpoint, dirs ...string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	prefix := ps.scanCheckpointPrefix(hostID, root)
+	return ps.db.Update(func(tx kvTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(scanCheckpointBucketName))
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			key := append(append([]byte{}, prefix...), ps.realm.SealPath(dir)...)
+			if err := b.Put(key, []byte{1}); err != nil {
+				return err
+			}
+		}
+		return b.Put(prefix, data)
+	})
+}
+
+// ClearScanCheckpoint removes root's checkpoint and completed directories.
+func (ps *PersistentStore) ClearScanCheckpoint(hostID, root string) error {
+	prefix := ps.scanCheckpointPrefix(hostID, root)
+	return ps.db.Update(func(tx kvTx) error {
+		b := tx.Bucket([]byte(scanCheckpointBucketName))
+		if b == nil {
+			return nil
+		}
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
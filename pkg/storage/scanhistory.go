@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ------------------------
+// Scan History per Root
+// ------------------------
+
+// Scan summaries are kept under "<hostID>|<root>", newest last, as a
+// baseline for change-rate anomaly detection.
+const scanHistoryBucketName = "scan_history"
+
+// scanHistoryLen is the number of scans kept per root.
+const scanHistoryLen = 30
+
+// ScanRecord summarizes a completed scan of a root.
+type ScanRecord struct {
+	At      time.Time `json:"at"`
+	Scanned int       `json:"scanned"` // Files seen
+	Changed int       `json:"changed"` // Files new or modified since the previous scan
+}
+
+// AddScan appends a scan of root to its history and returns the history
+// as it was before, oldest first.
+func (ps *PersistentStore) AddScan(hostID, root string, rec ScanRecord) ([]ScanRecord, error) {
+	var history []ScanRecord
+	err := ps.db.Update(func(tx kvTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(scanHistoryBucketName))
+		if err != nil {
+			return err
+		}
+		key := []byte(hostID + "|" + ps.realm.SealPath(root))
+		if data := b.Get(key); data != nil {
+			if err := json.Unmarshal(data, &history); err != nil {
+				return fmt.Errorf("decode scan history: %w", err)
+			}
+		}
+		updated := append(append([]ScanRecord(nil), history...), rec)
+		if len(updated) > scanHistoryLen {
+			updated = updated[len(updated)-scanHistoryLen:]
+		}
+		data, err := json.Marshal(updated)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, data)
+	})
+	return history, err
+}
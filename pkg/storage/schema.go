@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Extra Metadata Schema Validation
+// ------------------------
+
+// DefaultSchemaProfile is used for records that do not name a profile in
+// their "profile" Extra field.
+const DefaultSchemaProfile = "default"
+
+// SetExtraSchemas compiles the JSON schemas (profile name -> schema file) that
+// the Extra metadata of stored records must satisfy. Records select a profile
+// through their "profile" Extra field; profiles without a schema, and stores
+// without any schemas, accept anything.
+func (ps *PersistentStore) SetExtraSchemas(paths map[string]string) error {
+	schemas := make(map[string]*jsonschema.Schema, len(paths))
+	for profile, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read schema for profile %s: %w", profile, err)
+		}
+		compiler := jsonschema.NewCompiler()
+		if err := compiler.AddResource(path, bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("load schema for profile %s: %w", profile, err)
+		}
+		schema, err := compiler.Compile(path)
+		if err != nil {
+			return fmt.Errorf("compile schema for profile %s: %w", profile, err)
+		}
+		schemas[profile] = schema
+	}
+	ps.extraSchemas = schemas
+	return nil
+}
+
+// ValidateExtra checks a record's Extra metadata against the schema of its
+// profile.
+func (ps *PersistentStore) ValidateExtra(meta metadata.FileMetadata) error {
+	if len(ps.extraSchemas) == 0 {
+		return nil
+	}
+	profile := DefaultSchemaProfile
+	if p, ok := meta.Extra["profile"].(string); ok && p != "" {
+		profile = p
+	}
+	schema, ok := ps.extraSchemas[profile]
+	if !ok {
+		return nil
+	}
+
+	// Round-trip through JSON so the validator sees JSON types (float64 etc.)
+	// regardless of how the producer populated Extra.
+	extra := meta.Extra
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	data, err := json.Marshal(extra)
+	if err != nil {
+		return fmt.Errorf("marshal extra metadata: %w", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("unmarshal extra metadata: %w", err)
+	}
+	if err := schema.Validate(doc); err != nil {
+		return fmt.Errorf("extra metadata for %s fails %s schema: %w", meta.FilePath, profile, err)
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure Go, so cross-compiled binaries have it too
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// SQLite Driver
+// ------------------------
+
+// The buckets live in the kv table, nested bucket names joined by "/".
+// Every write to the records bucket also updates the files table, which
+// holds one typed row per record for SQL, e.g.
+//
+//	SELECT host_id, file_path, size FROM current_files WHERE blake3 = '...';
+//
+// current_files is the newest revision of each file that is not deleted.
+// Fields the realm encrypts are sealed in both tables as at rest anywhere.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS buckets (
+	name TEXT PRIMARY KEY,
+	seq  INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS kv (
+	bucket TEXT NOT NULL,
+	key    BLOB NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS files (
+	id        TEXT PRIMARY KEY,
+	host_id   TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	size      INTEGER NOT NULL,
+	mod_time  TEXT NOT NULL,
+	blake3    TEXT NOT NULL,
+	deleted   INTEGER NOT NULL,
+	extra     TEXT
+);
+CREATE INDEX IF NOT EXISTS files_blake3 ON files (blake3);
+CREATE INDEX IF NOT EXISTS files_host_path ON files (host_id, file_path);
+CREATE INDEX IF NOT EXISTS files_path ON files (file_path);
+CREATE INDEX IF NOT EXISTS files_mod_time ON files (mod_time);
+CREATE VIEW IF NOT EXISTS current_files AS
+	SELECT files.* FROM kv JOIN files ON files.id = CAST(kv.value AS TEXT)
+	WHERE kv.bucket = '` + pathBucketName + `' AND files.deleted = 0;
+`
+
+// sqlitePage is the number of rows read at a time by ForEach and cursors.
+const sqlitePage = 256
+
+var (
+	errSQLiteBucketExists   = errors.New("bucket already exists")
+	errSQLiteBucketNotFound = errors.New("bucket not found")
+	errSQLiteReadOnly       = errors.New("write in a read-only transaction")
+)
+
+// sqliteDriver writes through a single connection, so write transactions
+// queue up as BoltDB's do, and reads through a pool of read-only ones. Other
+// processes may read the file, and write it, at the same time.
+type sqliteDriver struct {
+	rw *sql.DB
+	ro *sql.DB
+}
+
+func openSQLite(path string) (*sqliteDriver, error) {
+	uri := "file:" + strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path)
+	rw, err := sql.Open("sqlite", uri+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	rw.SetMaxOpenConns(1)
+	if _, err := rw.Exec(sqliteSchema); err != nil {
+		rw.Close()
+		return nil, err
+	}
+	ro, err := sql.Open("sqlite", uri+"?_pragma=busy_timeout(5000)&_pragma=query_only(true)")
+	if err != nil {
+		rw.Close()
+		return nil, err
+	}
+	return &sqliteDriver{rw: rw, ro: ro}, nil
+}
+
+func (d *sqliteDriver) View(fn func(tx kvTx) error) error {
+	tx, err := d.ro.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(&sqliteTx{tx: tx})
+}
+
+func (d *sqliteDriver) Update(fn func(tx kvTx) error) error {
+	defer observeWrite(time.Now())
+	tx, err := d.rw.Begin()
+	if err != nil {
+		return err
+	}
+	t := &sqliteTx{tx: tx, writable: true}
+	if err := fn(t); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, fn := range t.onCommit {
+		fn()
+	}
+	return nil
+}
+
+func (d *sqliteDriver) Close() error {
+	return errors.Join(d.ro.Close(), d.rw.Close())
+}
+
+type sqliteTx struct {
+	tx       *sql.Tx
+	writable bool
+	onCommit []func()
+}
+
+func (t *sqliteTx) OnCommit(fn func()) {
+	t.onCommit = append(t.onCommit, fn)
+}
+
+func (t *sqliteTx) ForEachBucket(fn func(name []byte) error) error {
+	rows, err := t.tx.Query(`SELECT name FROM buckets WHERE instr(name, '/') = 0 ORDER BY name`)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := fn([]byte(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sqliteTx) Bucket(name []byte) kvBucket {
+	return t.bucket(string(name))
+}
+
+func (t *sqliteTx) CreateBucket(name []byte) (kvBucket, error) {
+	return t.createBucket(string(name), false)
+}
+
+func (t *sqliteTx) CreateBucketIfNotExists(name []byte) (kvBucket, error) {
+	return t.createBucket(string(name), true)
+}
+
+func (t *sqliteTx) DeleteBucket(name []byte) error {
+	return t.deleteBucket(string(name))
+}
+
+func (t *sqliteTx) bucket(name string) kvBucket {
+	var found string
+	if err := t.tx.QueryRow(`SELECT name FROM buckets WHERE name = ?`, name).Scan(&found); err != nil {
+		return nil
+	}
+	return &sqliteBucket{t: t, name: name}
+}
+
+func (t *sqliteTx) createBucket(name string, ifNotExists bool) (kvBucket, error) {
+	if !t.writable {
+		return nil, errSQLiteReadOnly
+	}
+	res, err := t.tx.Exec(`INSERT OR IGNORE INTO buckets (name) VALUES (?)`, name)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 && !ifNotExists {
+		return nil, errSQLiteBucketExists
+	}
+	return &sqliteBucket{t: t, name: name}, nil
+}
+
+// deleteBucket drops a bucket with its keys and nested buckets.
+func (t *sqliteTx) deleteBucket(name string) error {
+	if !t.writable {
+		return errSQLiteReadOnly
+	}
+	prefix := name + "/"
+	res, err := t.tx.Exec(`DELETE FROM buckets WHERE name = ? OR substr(name, 1, ?) = ?`, name, len(prefix), prefix)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errSQLiteBucketNotFound
+	}
+	if name == boltBucketName {
+		if _, err := t.tx.Exec(`DELETE FROM files`); err != nil {
+			return err
+		}
+	}
+	_, err = t.tx.Exec(`DELETE FROM kv WHERE bucket = ? OR substr(bucket, 1, ?) = ?`, name, len(prefix), prefix)
+	return err
+}
+
+type sqliteBucket struct {
+	t    *sqliteTx
+	name string
+}
+
+func (b *sqliteBucket) child(name []byte) string {
+	return b.name + "/" + string(name)
+}
+
+func (b *sqliteBucket) Bucket(name []byte) kvBucket {
+	return b.t.bucket(b.child(name))
+}
+
+func (b *sqliteBucket) CreateBucket(name []byte) (kvBucket, error) {
+	return b.t.createBucket(b.child(name), false)
+}
+
+func (b *sqliteBucket) CreateBucketIfNotExists(name []byte) (kvBucket, error) {
+	return b.t.createBucket(b.child(name), true)
+}
+
+func (b *sqliteBucket) DeleteBucket(name []byte) error {
+	return b.t.deleteBucket(b.child(name))
+}
+
+// Get returns nil for a missing key, or if the lookup fails, as BoltDB has
+// no error to report either.
+func (b *sqliteBucket) Get(key []byte) []byte {
+	var v []byte
+	if err := b.t.tx.QueryRow(`SELECT value FROM kv WHERE bucket = ? AND key = ?`, b.name, blob(key)).Scan(&v); err != nil {
+		return nil
+	}
+	return blob(v)
+}
+
+func (b *sqliteBucket) Put(key, value []byte) error {
+	if !b.t.writable {
+		return errSQLiteReadOnly
+	}
+	_, err := b.t.tx.Exec(`INSERT INTO kv (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value`, b.name, blob(key), blob(value))
+	if err != nil || b.name != boltBucketName {
+		return err
+	}
+	return b.putFile(value)
+}
+
+func (b *sqliteBucket) Delete(key []byte) error {
+	if !b.t.writable {
+		return errSQLiteReadOnly
+	}
+	if _, err := b.t.tx.Exec(`DELETE FROM kv WHERE bucket = ? AND key = ?`, b.name, blob(key)); err != nil {
+		return err
+	}
+	if b.name != boltBucketName {
+		return nil
+	}
+	_, err := b.t.tx.Exec(`DELETE FROM files WHERE id = ?`, string(key))
+	return err
+}
+
+// putFile mirrors a stored record into the files table.
+func (b *sqliteBucket) putFile(data []byte) error {
+	var meta metadata.FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("decode record for files table: %w", err)
+	}
+	var extra interface{}
+	if len(meta.Extra) > 0 {
+		data, err := json.Marshal(meta.Extra)
+		if err != nil {
+			return err
+		}
+		extra = string(data)
+	}
+	_, err := b.t.tx.Exec(`INSERT OR REPLACE INTO files (id, host_id, file_path, size, mod_time, blake3, deleted, extra)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		meta.ID, meta.HostID, meta.FilePath, meta.Size, meta.ModTime, meta.BLAKE3, meta.Deleted(), extra)
+	return err
+}
+
+// ForEach passes the nested buckets first, then the keys in order.
+func (b *sqliteBucket) ForEach(fn func(k, v []byte) error) error {
+	prefix := b.name + "/"
+	rows, err := b.t.tx.Query(`SELECT substr(name, ?) FROM buckets
+		WHERE substr(name, 1, ?) = ? AND instr(substr(name, ?), '/') = 0 ORDER BY name`,
+		len(prefix)+1, len(prefix), prefix, len(prefix)+1)
+	if err != nil {
+		return err
+	}
+	var nested []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		nested = append(nested, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range nested {
+		if err := fn([]byte(name), nil); err != nil {
+			return err
+		}
+	}
+
+	c := b.Cursor()
+	for k, v := c.Seek(nil); k != nil; k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return c.(*sqliteCursor).err
+}
+
+func (b *sqliteBucket) Cursor() kvCursor {
+	return &sqliteCursor{b: b}
+}
+
+func (b *sqliteBucket) NextSequence() (uint64, error) {
+	if !b.t.writable {
+		return 0, errSQLiteReadOnly
+	}
+	var seq uint64
+	err := b.t.tx.QueryRow(`UPDATE buckets SET seq = seq + 1 WHERE name = ? RETURNING seq`, b.name).Scan(&seq)
+	return seq, err
+}
+
+func (b *sqliteBucket) Sequence() uint64 {
+	var seq uint64
+	b.t.tx.QueryRow(`SELECT seq FROM buckets WHERE name = ?`, b.name).Scan(&seq)
+	return seq
+}
+
+func (b *sqliteBucket) SetSequence(seq uint64) error {
+	if !b.t.writable {
+		return errSQLiteReadOnly
+	}
+	_, err := b.t.tx.Exec(`UPDATE buckets SET seq = ? WHERE name = ?`, seq, b.name)
+	return err
+}
+
+func (b *sqliteBucket) Len() int {
+	var n int
+	b.t.tx.QueryRow(`SELECT count(*) FROM kv WHERE bucket = ?`, b.name).Scan(&n)
+	return n
+}
+
+// sqliteCursor reads a page of rows at a time, starting after the last key
+// returned.
+type sqliteCursor struct {
+	b    *sqliteBucket
+	rows [][2][]byte
+	pos  int
+	last []byte
+	done bool
+	err  error
+}
+
+func (c *sqliteCursor) Seek(seek []byte) ([]byte, []byte) {
+	c.rows, c.pos, c.done = nil, 0, false
+	c.load(`key >= ?`, seek)
+	return c.current()
+}
+
+func (c *sqliteCursor) Next() ([]byte, []byte) {
+	c.pos++
+	if c.pos >= len(c.rows) && !c.done && c.last != nil {
+		c.load(`key > ?`, c.last)
+	}
+	return c.current()
+}
+
+func (c *sqliteCursor) current() ([]byte, []byte) {
+	if c.pos >= len(c.rows) {
+		return nil, nil
+	}
+	row := c.rows[c.pos]
+	c.last = row[0]
+	return row[0], row[1]
+}
+
+func (c *sqliteCursor) load(cond string, from []byte) {
+	c.rows, c.pos = c.rows[:0], 0
+	rows, err := c.b.t.tx.Query(`SELECT key, value FROM kv WHERE bucket = ? AND `+cond+` ORDER BY key LIMIT ?`,
+		c.b.name, blob(from), sqlitePage)
+	if err != nil {
+		c.err, c.done = err, true
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v []byte
+		if err := rows.Scan(&k, &v); err != nil {
+			c.err, c.done = err, true
+			return
+		}
+		c.rows = append(c.rows, [2][]byte{k, blob(v)})
+	}
+	if err := rows.Err(); err != nil {
+		c.err = err
+	}
+	c.done = len(c.rows) < sqlitePage || c.err != nil
+}
+
+// blob keeps keys and values BLOBs: nil would bind as NULL, and a string
+// as TEXT, which sorts before every BLOB.
+func blob(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
@@ -9,62 +9,171 @@ import (
 	"sync"
 	"time"
 
-	bolt "go.etcd.io/bbolt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 
 	"gnomatix/dreamfs/v2/pkg/metadata"
 )
 
 // ------------------------
-// Persistent Storage (BoltDB)
+// Persistent Storage (BoltDB or SQLite)
 // ------------------------
 
 type PersistentStore struct {
-	db *bolt.DB
+	db            driver                        // BoltDB or SQLite (see driver.go)
+	indexedFields []string                      // Extra fields with a secondary index (see index.go)
+	extraSchemas  map[string]*jsonschema.Schema // Extra schemas by profile (see schema.go)
+	realm         *metadata.Realm               // Encrypted fields (see encryption.go)
+
+	changesMu sync.Mutex
+	changed   chan struct{} // Closed on the next committed change (see changes.go)
 }
 
 const boltBucketName = "metadata"
 
-func NewPersistentStore(dbPath string) (*PersistentStore, error) {
+// storeBuckets lists every top-level bucket created when the store is opened.
+var storeBuckets = []string{
+	boltBucketName,
+	checkpointBucketName,
+	emptyDirBucketName,
+	chunkListBucketName,
+	chunkRefBucketName,
+	manifestBucketName,
+	quarantineBucketName,
+	savedQueryBucketName,
+	collectionBucketName,
+	conflictBucketName,
+	localDocBucketName,
+	peerBucketName,
+	volumeBucketName,
+}
+
+// NewPersistentStore opens the store at dbPath with the given driver
+// (DriverBolt or DriverSQLite; "" is DriverBolt), creating it if needed.
+func NewPersistentStore(dbPath, driverName string) (*PersistentStore, error) {
 	// Ensure the parent directory exists.
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, err
 	}
-	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	db, err := openDriver(driverName, dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("open bolt db: %w", err)
+		return nil, err
 	}
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(boltBucketName))
-		return err
+	err = db.Update(func(tx kvTx) error {
+		for _, name := range storeBuckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		if err := buildPathIndex(tx); err != nil {
+			return err
+		}
+		return buildChangeLog(tx)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create bucket: %w", err)
 	}
-	return &PersistentStore{db: db}, nil
+	return &PersistentStore{db: db, changed: make(chan struct{})}, nil
 }
 
 func (ps *PersistentStore) Close() error {
 	return ps.db.Close()
 }
 
+// Check reports whether the store can be read, by opening the records
+// bucket in a read transaction; used by health checks.
+func (ps *PersistentStore) Check() error {
+	return ps.db.View(func(tx kvTx) error {
+		if tx.Bucket([]byte(boltBucketName)) == nil {
+			return fmt.Errorf("bucket %s missing", boltBucketName)
+		}
+		return nil
+	})
+}
+
+// Put stores a record written by this host, with a version superseding the
+// stored copy's (see Stamp).
 func (ps *PersistentStore) Put(meta metadata.FileMetadata) error {
-	data, err := json.Marshal(meta)
+	return ps.db.Update(func(tx kvTx) error {
+		return ps.writeTx(tx, meta)
+	})
+}
+
+// storeTx encodes and stores a record as it is.
+func (ps *PersistentStore) storeTx(tx kvTx, meta metadata.FileMetadata) error {
+	if err := ps.revTx(tx, &meta); err != nil {
+		return err
+	}
+	data, err := ps.encode(meta)
 	if err != nil {
-		return fmt.Errorf("marshal metadata: %w", err)
+		return err
 	}
-	return ps.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(boltBucketName))
-		return b.Put([]byte(meta.ID), data)
+	return ps.putTx(tx, meta.ID, data)
+}
+
+// putTx stores an encoded record and keeps the path and secondary indexes
+// and the change log in step.
+func (ps *PersistentStore) putTx(tx kvTx, id string, data []byte) error {
+	b := tx.Bucket([]byte(boltBucketName))
+	if old := b.Get([]byte(id)); old != nil {
+		if err := ps.unindexTx(tx, old); err != nil {
+			return err
+		}
+	}
+	if err := b.Put([]byte(id), data); err != nil {
+		return err
+	}
+	var meta metadata.FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	if err := updatePathTx(tx, meta); err != nil {
+		return err
+	}
+	rev := meta.Rev()
+	if rev == "" {
+		rev = revOf(data)
+	}
+	if err := recordChangeTx(tx, []byte(id), rev, false); err != nil {
+		return err
+	}
+	tx.OnCommit(ps.notifyChanges)
+	return ps.indexTx(tx, data)
+}
+
+// Get returns the record with the given ID.
+func (ps *PersistentStore) Get(id string) (metadata.FileMetadata, bool, error) {
+	var meta metadata.FileMetadata
+	var found bool
+	err := ps.db.View(func(tx kvTx) error {
+		data := tx.Bucket([]byte(boltBucketName)).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		var err error
+		meta, err = ps.decode(data)
+		return err
 	})
+	return meta, found, err
+}
+
+// Count returns the number of stored records.
+func (ps *PersistentStore) Count() (int, error) {
+	var n int
+	err := ps.db.View(func(tx kvTx) error {
+		n = tx.Bucket([]byte(boltBucketName)).Len()
+		return nil
+	})
+	return n, err
 }
 
 func (ps *PersistentStore) GetAll() ([]metadata.FileMetadata, error) {
 	var results []metadata.FileMetadata
-	err := ps.db.View(func(tx *bolt.Tx) error {
+	err := ps.db.View(func(tx kvTx) error {
 		b := tx.Bucket([]byte(boltBucketName))
 		return b.ForEach(func(k, v []byte) error {
-			var meta metadata.FileMetadata
-			if err := json.Unmarshal(v, &meta); err != nil {
+			meta, err := ps.decode(v)
+			if err != nil {
 				return err
 			}
 			results = append(results, meta)
@@ -74,6 +183,53 @@ func (ps *PersistentStore) GetAll() ([]metadata.FileMetadata, error) {
 	return results, err
 }
 
+// ForEach streams every stored record to fn without materializing the store.
+// Iteration stops at the first error returned by fn.
+func (ps *PersistentStore) ForEach(fn func(meta metadata.FileMetadata) error) error {
+	return ps.db.View(func(tx kvTx) error {
+		b := tx.Bucket([]byte(boltBucketName))
+		return b.ForEach(func(k, v []byte) error {
+			meta, err := ps.decode(v)
+			if err != nil {
+				return err
+			}
+			return fn(meta)
+		})
+	})
+}
+
+// Latest returns the newest stored revision of each file, keyed by host and
+// path, so reports reflect what currently exists rather than history. Files
+// whose newest record is a tombstone (see metadata.DeletedField) are omitted,
+// as are the files of retired hosts (see RetireHost).
+func (ps *PersistentStore) Latest() ([]metadata.FileMetadata, error) {
+	latest := make(map[string]metadata.FileMetadata)
+	err := ps.ForEach(func(meta metadata.FileMetadata) error {
+		key := meta.HostID + "|" + meta.FilePath
+		if cur, ok := latest[key]; !ok || Newer(meta, cur) {
+			latest[key] = meta
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]metadata.FileMetadata, 0, len(latest))
+	for _, meta := range latest {
+		if meta.Deleted() || meta.Archived() {
+			continue
+		}
+		results = append(results, meta)
+	}
+	return results, nil
+}
+
+// Newer reports whether a is a later revision of a file than b. A tombstone
+// written in the same second as the revision it deletes still wins.
+func Newer(a, b metadata.FileMetadata) bool {
+	return a.ModTime > b.ModTime || a.ModTime == b.ModTime && a.Deleted() && !b.Deleted()
+}
+
 // CACHE WRITER (In-Memory Caching to Batch Writes)
 type CacheWriter struct {
 	ps            *PersistentStore           // Reference to PersistentStore in this package
@@ -81,6 +237,7 @@ type CacheWriter struct {
 	batchSize     int
 	flushInterval time.Duration
 	flushNowCh    chan struct{}
+	syncCh        chan chan struct{}
 	quit          chan struct{}
 	wg            sync.WaitGroup
 }
@@ -92,6 +249,7 @@ func NewCacheWriter(ps *PersistentStore, batchSize int, flushInterval time.Durat
 		batchSize:     batchSize,
 		flushInterval: flushInterval,
 		flushNowCh:    make(chan struct{}),
+		syncCh:        make(chan chan struct{}),
 		quit:          make(chan struct{}),
 	}
 	cw.wg.Add(1)
@@ -100,6 +258,7 @@ func NewCacheWriter(ps *PersistentStore, batchSize int, flushInterval time.Durat
 }
 
 func (cw *CacheWriter) run() {
+	defer cw.wg.Done()
 	var batch []metadata.FileMetadata
 	timer := time.NewTimer(cw.flushInterval)
 	for {
@@ -125,7 +284,20 @@ func (cw *CacheWriter) run() {
 				cw.flush(batch)
 				batch = nil
 			}
+		case done := <-cw.syncCh:
+			for len(cw.ch) > 0 {
+				batch = append(batch, <-cw.ch)
+			}
+			if len(batch) > 0 {
+				cw.flush(batch)
+				batch = nil
+			}
+			close(done)
 		case <-cw.quit:
+			// Keep records queued before Close
+			for len(cw.ch) > 0 {
+				batch = append(batch, <-cw.ch)
+			}
 			if len(batch) > 0 {
 				cw.flush(batch)
 			}
@@ -134,15 +306,40 @@ func (cw *CacheWriter) run() {
 	}
 }
 
+// dedupeBatch keeps only the latest record for each ID in the batch, so bursts
+// of writes for the same file (e.g. from watch mode) cost a single Put.
+// Records retain the position at which their ID was first queued.
+func dedupeBatch(batch []metadata.FileMetadata) []metadata.FileMetadata {
+	index := make(map[string]int, len(batch))
+	deduped := make([]metadata.FileMetadata, 0, len(batch))
+	for _, meta := range batch {
+		if i, ok := index[meta.ID]; ok {
+			deduped[i] = meta
+			continue
+		}
+		index[meta.ID] = len(deduped)
+		deduped = append(deduped, meta)
+	}
+	return deduped
+}
+
 func (cw *CacheWriter) flush(batch []metadata.FileMetadata) {
-	err := cw.ps.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("metadata"))
+	batch = dedupeBatch(batch)
+	err := cw.ps.db.Update(func(tx kvTx) error {
 		for _, meta := range batch {
-			data, err := json.Marshal(meta)
-			if err != nil {
+			meta.SetRev("") // A write of this host's takes the next revision
+			if err := cw.ps.versionTx(tx, &meta); err != nil {
+				return err
+			}
+			if err := cw.ps.revTx(tx, &meta); err != nil {
 				return err
 			}
-			if err := b.Put([]byte(meta.ID), data); err != nil {
+			data, err := cw.ps.encode(meta)
+			if err != nil {
+				log.Printf("CacheWriter: skipping record: %v", err)
+				continue
+			}
+			if err := cw.ps.putTx(tx, meta.ID, data); err != nil {
 				return err
 			}
 		}
@@ -153,14 +350,27 @@ func (cw *CacheWriter) flush(batch []metadata.FileMetadata) {
 	}
 }
 
-func (cw *CacheWriter) Write(meta metadata.FileMetadata) {
+// Write queues meta to be stored, and returns it as it will be: stamped
+// with its version (see PersistentStore.Stamp), for sending to peers.
+func (cw *CacheWriter) Write(meta metadata.FileMetadata) metadata.FileMetadata {
+	if stamped, err := cw.ps.Stamp(meta); err == nil {
+		meta = stamped
+	}
 	cw.ch <- meta
+	return meta
 }
 
 func (cw *CacheWriter) FlushNow() {
 	cw.flushNowCh <- struct{}{}
 }
 
+// Sync stores the records written so far and returns once they are.
+func (cw *CacheWriter) Sync() {
+	done := make(chan struct{})
+	cw.syncCh <- done
+	<-done
+}
+
 func (cw *CacheWriter) Close() {
 	close(cw.quit)
 	cw.wg.Wait()
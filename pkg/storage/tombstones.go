@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+)
+
+// ------------------------
+// Deletion, Tombstones and Tombstone Garbage Collection
+// ------------------------
+
+// Delete removes the record with the given ID from this store only; a peer
+// that still holds it can hand it back. Files are removed cluster-wide with
+// a tombstone instead (see metadata.NewTombstone), which Merge respects.
+func (ps *PersistentStore) Delete(id string) error {
+	return ps.db.Update(func(tx kvTx) error {
+		return ps.deleteTx(tx, []byte(id))
+	})
+}
+
+// deleteTx removes a record, its index entries and chunk list, and logs the deletion as
+// a change. If the path index pointed at it, the entry is dropped rather
+// than recomputed, so the file is simply re-fingerprinted on the next scan.
+func (ps *PersistentStore) deleteTx(tx kvTx, id []byte) error {
+	docs := tx.Bucket([]byte(boltBucketName))
+	data := docs.Get(id)
+	if data == nil {
+		return nil
+	}
+	var meta metadata.FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	if err := ps.unindexTx(tx, data); err != nil {
+		return err
+	}
+	if err := docs.Delete(id); err != nil {
+		return err
+	}
+	if err := deleteChunksTx(tx, id); err != nil {
+		return err
+	}
+	rev, err := storedRev(data)
+	if err != nil {
+		return err
+	}
+	if err := recordChangeTx(tx, id, deletionRev(rev), true); err != nil {
+		return err
+	}
+	tx.OnCommit(ps.notifyChanges)
+	paths := tx.Bucket([]byte(pathBucketName))
+	key := []byte(meta.HostID + "|" + meta.FilePath)
+	if bytes.Equal(paths.Get(key), id) {
+		return paths.Delete(key)
+	}
+	return nil
+}
+
+// Merge stores a record received from a peer unless it is superseded: by a
+// tombstone in this store, so that replicas holding revisions of a deleted
+// file cannot bring them back; by the archiving of the record (see
+// RetireHost); or by the version of the stored copy, which also settles
+// conflicting writes (see mergeVersionTx). It reports whether the record was
+// stored.
+func (ps *PersistentStore) Merge(meta metadata.FileMetadata) (bool, error) {
+	var stored bool
+	err := ps.db.Update(func(tx kvTx) error {
+		var cur metadata.FileMetadata
+		data := tx.Bucket([]byte(boltBucketName)).Get([]byte(meta.ID))
+		if data != nil {
+			var err error
+			if cur, err = ps.decode(data); err != nil {
+				return err
+			}
+			if cur.Archived() && !meta.Archived() {
+				return nil
+			}
+		}
+		if !meta.Deleted() {
+			latest, found, err := ps.latestForTx(tx, meta.HostID, meta.FilePath)
+			if err != nil {
+				return err
+			}
+			if found && latest.Deleted() && Newer(latest, meta) {
+				return nil
+			}
+		}
+		var err error
+		stored, err = ps.mergeVersionTx(tx, meta, cur, data != nil)
+		return err
+	})
+	return stored, err
+}
+
+// PurgeTombstones drops every file whose newest record is a tombstone
+// written before cutoff, together with the file's older revisions, so that
+// the revisions cannot resurface as live once the tombstone is gone. It
+// returns the number of records deleted.
+func (ps *PersistentStore) PurgeTombstones(cutoff time.Time) (int, error) {
+	purged := 0
+	err := ps.db.Update(func(tx kvTx) error {
+		docs := tx.Bucket([]byte(boltBucketName))
+		paths := tx.Bucket([]byte(pathBucketName))
+
+		dead := map[string]bool{} // "<hostID>|<path>" of expired deletions
+		err := paths.ForEach(func(k, id []byte) error {
+			data := docs.Get(id)
+			if data == nil {
+				return nil
+			}
+			var meta metadata.FileMetadata
+			if err := json.Unmarshal(data, &meta); err != nil {
+				return err
+			}
+			if at, ok := meta.DeletedAt(); ok && at.Before(cutoff) {
+				dead[string(k)] = true
+			}
+			return nil
+		})
+		if err != nil || len(dead) == 0 {
+			return err
+		}
+
+		var ids [][]byte
+		err = docs.ForEach(func(k, v []byte) error {
+			var meta metadata.FileMetadata
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return err
+			}
+			if dead[meta.HostID+"|"+meta.FilePath] {
+				ids = append(ids, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := ps.deleteTx(tx, id); err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// ------------------------
+// Directory Rollups
+// ------------------------
+
+// DirUsage is the total size and file count of a directory tree, as
+// recorded in the store.
+type DirUsage struct {
+	Path  string `json:"path"`
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// DiskUsage rolls up hostID's current files under root (a canonical path)
+// without touching the filesystem: the totals of root, and of each
+// directory below it down to depth levels. It reads the path index, seeking
+// straight to root unless the realm encrypts paths.
+func (ps *PersistentStore) DiskUsage(hostID, root string, depth int) (DirUsage, []DirUsage, error) {
+	root = filepath.Clean(root)
+	prefix := root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	seek := []byte(hostID + "|")
+	if !ps.realm.Encrypts("filePath") {
+		seek = append(seek, prefix...)
+	}
+	total := DirUsage{Path: root}
+	dirs := map[string]*DirUsage{}
+	err := ps.db.View(func(tx kvTx) error {
+		docs := tx.Bucket([]byte(boltBucketName))
+		c := tx.Bucket([]byte(pathBucketName)).Cursor()
+		for k, id := c.Seek(seek); k != nil && bytes.HasPrefix(k, seek); k, id = c.Next() {
+			data := docs.Get(id)
+			if data == nil {
+				continue
+			}
+			meta, err := ps.decode(data)
+			if err != nil {
+				return err
+			}
+			if meta.Deleted() || meta.Archived() || !strings.HasPrefix(meta.FilePath, prefix) {
+				continue
+			}
+			total.Files++
+			total.Bytes += meta.Size
+			parts := strings.Split(meta.FilePath[len(prefix):], string(filepath.Separator))
+			// The last part is the file's own name
+			for i := 1; i < len(parts) && i <= depth; i++ {
+				dir := filepath.Join(root, filepath.Join(parts[:i]...))
+				u, ok := dirs[dir]
+				if !ok {
+					u = &DirUsage{Path: dir}
+					dirs[dir] = u
+				}
+				u.Files++
+				u.Bytes += meta.Size
+			}
+		}
+		return nil
+	})
+	usage := make([]DirUsage, 0, len(dirs))
+	for _, u := range dirs {
+		usage = append(usage, *u)
+	}
+	return total, usage, err
+}
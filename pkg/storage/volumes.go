@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ------------------------
+// Volumes
+// ------------------------
+
+// volumeBucketName holds the volumes this host has scanned, by volume ID.
+const volumeBucketName = "volumes"
+
+// Volume is a filesystem known by its UUID (or serial number), so that a
+// removable drive is recognized wherever it is mounted.
+type Volume struct {
+	ID           string    `json:"id"`
+	Label        string    `json:"label,omitempty"`
+	FSType       string    `json:"fsType,omitempty"`
+	Device       string    `json:"device,omitempty"`
+	Mountpoint   string    `json:"mountpoint"` // Where it was last seen
+	Removable    bool      `json:"removable,omitempty"`
+	FirstSeen    time.Time `json:"firstSeen"`
+	LastSeen     time.Time `json:"lastSeen"`
+	LastScanned  time.Time `json:"lastScanned,omitzero"` // End of the last complete scan
+	LastScanRoot string    `json:"lastScanRoot,omitempty"`
+}
+
+// Volume returns the volume with the given ID, if it is known.
+func (ps *PersistentStore) Volume(id string) (Volume, bool, error) {
+	var v Volume
+	found, err := ps.getNamed(volumeBucketName, id, &v)
+	return v, found, err
+}
+
+// PutVolume stores a volume under its ID.
+func (ps *PersistentStore) PutVolume(v Volume) error {
+	return ps.putNamed(volumeBucketName, v.ID, v)
+}
+
+// Volumes returns the known volumes, ordered by ID.
+func (ps *PersistentStore) Volumes() ([]Volume, error) {
+	var vols []Volume
+	err := ps.db.View(func(tx kvTx) error {
+		return tx.Bucket([]byte(volumeBucketName)).ForEach(func(k, data []byte) error {
+			var v Volume
+			if err := json.Unmarshal(data, &v); err != nil {
+				return err
+			}
+			vols = append(vols, v)
+			return nil
+		})
+	})
+	return vols, err
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"path/filepath"
 
 	"encoding/base64"
@@ -22,6 +23,11 @@ func XDGDataHome() string {
 	return xdg.DataHome
 }
 
+// XDGCacheHome returns the XDG cache home directory.
+func XDGCacheHome() string {
+	return xdg.CacheHome
+}
+
 var HostID string
 
 // SetHostID allows the value to be overridden by config value
@@ -51,3 +57,17 @@ func ShortenString(data string) string {
 	// URL safe encoding; should be 22 chars in length
 	return base64.RawURLEncoding.EncodeToString([]byte(data))
 }
+
+// FormatBytes renders a byte count in human-readable binary units (e.g. 1.5 GiB)
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,284 @@
+//go:build linux || darwin
+
+package vfs
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+	"gnomatix/dreamfs/v2/pkg/utils"
+)
+
+// ------------------------
+// FUSE Mount
+// ------------------------
+
+// xattrPrefix names the extended attributes carrying each file's record:
+// user.dreamfs.id, .host, .path and .blake3, and user.dreamfs.extra.<field>
+// for the extra fields (strings as-is, other values as JSON).
+const xattrPrefix = "user.dreamfs."
+
+// Serve mounts the index of ps read-only at mountpoint, as one directory per
+// host holding that host's files under their stored paths, and serves it
+// until ctx is cancelled or the mount is removed externally.
+func Serve(ctx context.Context, mountpoint string, ps *storage.PersistentStore, opts Options) error {
+	if opts.Refresh <= 0 {
+		opts.Refresh = DefaultRefresh
+	}
+	t, err := newTree(ps, opts.Refresh)
+	if err != nil {
+		return err
+	}
+	root := &node{tree: t, opts: opts}
+	server, err := fs.Mount(mountpoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:      "dreamfs",
+			Name:        "dreamfs",
+			AllowOther:  opts.AllowOther,
+			Debug:       opts.Debug,
+			DirectMount: true,
+			Options:     []string{"ro"},
+		},
+		EntryTimeout:    &opts.Refresh,
+		AttrTimeout:     &opts.Refresh,
+		NegativeTimeout: &opts.Refresh,
+		UID:             uint32(os.Getuid()),
+		GID:             uint32(os.Getgid()),
+	})
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		server.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return server.Unmount()
+	case <-done:
+		return nil
+	}
+}
+
+// node is a file or directory of the mounted tree, named by its
+// slash-separated path from the mount root. Nodes look their entry up in the
+// current snapshot on every call, so they follow the store as it changes.
+type node struct {
+	fs.Inode
+	tree *tree
+	opts Options
+	path string
+}
+
+var (
+	_ fs.NodeLookuper    = (*node)(nil)
+	_ fs.NodeReaddirer   = (*node)(nil)
+	_ fs.NodeGetattrer   = (*node)(nil)
+	_ fs.NodeOpener      = (*node)(nil)
+	_ fs.NodeGetxattrer  = (*node)(nil)
+	_ fs.NodeListxattrer = (*node)(nil)
+)
+
+func (n *node) child(name string) string {
+	if n.path == "" {
+		return name
+	}
+	return n.path + "/" + name
+}
+
+// stableAttr derives the inode number from the path and type, so a name
+// that changes from file to directory gets a new inode.
+func stableAttr(path string, e *entry) fs.StableAttr {
+	mode := uint32(syscall.S_IFREG)
+	if e.isDir() {
+		mode = syscall.S_IFDIR
+	}
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	h.Write([]byte{0, byte(mode >> 12)})
+	return fs.StableAttr{Mode: mode, Ino: h.Sum64()}
+}
+
+func fillAttr(e *entry, out *fuse.Attr) {
+	if e.isDir() {
+		out.Mode = syscall.S_IFDIR | 0555
+		out.Nlink = 2
+	} else {
+		out.Mode = syscall.S_IFREG | 0444
+		out.Nlink = 1
+		out.Size = uint64(e.meta.Size)
+		out.Blocks = (out.Size + 511) / 512
+	}
+	if !e.mtime.IsZero() {
+		out.SetTimes(nil, &e.mtime, &e.mtime)
+	}
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	path := n.child(name)
+	e, ok := n.tree.lookup(path)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	fillAttr(e, &out.Attr)
+	return n.NewInode(ctx, &node{tree: n.tree, opts: n.opts, path: path}, stableAttr(path, e)), 0
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	e, ok := n.tree.lookup(n.path)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	if !e.isDir() {
+		return nil, syscall.ENOTDIR
+	}
+	names := make([]string, 0, len(e.children))
+	for name := range e.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]fuse.DirEntry, 0, len(names))
+	for _, name := range names {
+		attr := stableAttr(n.child(name), e.children[name])
+		list = append(list, fuse.DirEntry{Name: name, Mode: attr.Mode, Ino: attr.Ino})
+	}
+	return fs.NewListDirStream(list), 0
+}
+
+func (n *node) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	e, ok := n.tree.lookup(n.path)
+	if !ok {
+		return syscall.ENOENT
+	}
+	fillAttr(e, &out.Attr)
+	return 0
+}
+
+// Open serves the content of this host's files from their local copies
+// with Passthrough. Other hosts' files are only metadata here (EREMOTE),
+// and a local copy that no longer matches its record gives ESTALE.
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	e, ok := n.tree.lookup(n.path)
+	if !ok {
+		return nil, 0, syscall.ENOENT
+	}
+	if e.isDir() {
+		return nil, 0, syscall.EISDIR
+	}
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC|syscall.O_APPEND) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	meta := e.meta
+	if meta.HostID != utils.HostID || !filepath.IsAbs(meta.FilePath) {
+		return nil, 0, syscall.EREMOTE
+	}
+	if !n.opts.Passthrough {
+		return nil, 0, syscall.EACCES
+	}
+	f, err := os.Open(meta.FilePath)
+	if err != nil {
+		return nil, 0, fs.ToErrno(err)
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() || info.Size() != meta.Size || info.ModTime().Format(time.RFC3339) != meta.ModTime {
+		f.Close()
+		return nil, 0, syscall.ESTALE
+	}
+	return &localFile{f: f}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// xattrs returns the extended attributes of a file's record.
+func (n *node) xattrs() (map[string]string, syscall.Errno) {
+	e, ok := n.tree.lookup(n.path)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	if e.isDir() {
+		return nil, 0
+	}
+	meta := e.meta
+	attrs := map[string]string{
+		xattrPrefix + "id":     meta.ID,
+		xattrPrefix + "host":   meta.HostID,
+		xattrPrefix + "path":   meta.FilePath,
+		xattrPrefix + "blake3": meta.BLAKE3,
+	}
+	for k, v := range meta.Extra {
+		if s, ok := v.(string); ok {
+			attrs[xattrPrefix+"extra."+k] = s
+		} else if data, err := json.Marshal(v); err == nil {
+			attrs[xattrPrefix+"extra."+k] = string(data)
+		}
+	}
+	return attrs, 0
+}
+
+func (n *node) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	attrs, errno := n.xattrs()
+	if errno != 0 {
+		return 0, errno
+	}
+	v, ok := attrs[attr]
+	if !ok {
+		return 0, syscall.Errno(fuse.ENOATTR)
+	}
+	if len(dest) < len(v) {
+		return uint32(len(v)), syscall.ERANGE
+	}
+	return uint32(copy(dest, v)), 0
+}
+
+func (n *node) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	attrs, errno := n.xattrs()
+	if errno != 0 {
+		return 0, errno
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := strings.Join(names, "\x00")
+	if len(names) > 0 {
+		list += "\x00"
+	}
+	if len(dest) < len(list) {
+		return uint32(len(list)), syscall.ERANGE
+	}
+	return uint32(copy(dest, list)), 0
+}
+
+// localFile reads a passthrough file from its local copy.
+type localFile struct {
+	f *os.File
+}
+
+var (
+	_ fs.FileReader   = (*localFile)(nil)
+	_ fs.FileReleaser = (*localFile)(nil)
+)
+
+func (lf *localFile) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := lf.f.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, fs.ToErrno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (lf *localFile) Release(ctx context.Context) syscall.Errno {
+	return fs.ToErrno(lf.f.Close())
+}
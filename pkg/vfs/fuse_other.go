@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package vfs
+
+import (
+	"context"
+
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// Serve reports that FUSE mounts are unavailable on this platform.
+func Serve(ctx context.Context, mountpoint string, ps *storage.PersistentStore, opts Options) error {
+	return ErrUnsupported
+}
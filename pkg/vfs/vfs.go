@@ -0,0 +1,174 @@
+package vfs
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gnomatix/dreamfs/v2/pkg/metadata"
+	"gnomatix/dreamfs/v2/pkg/storage"
+)
+
+// ------------------------
+// Virtual Tree of the Index
+// ------------------------
+
+// ErrUnsupported is returned by Serve on platforms without FUSE.
+var ErrUnsupported = errors.New("FUSE mounts are not supported on this platform")
+
+// DefaultRefresh is how often the tree is checked against the store.
+const DefaultRefresh = 5 * time.Second
+
+// Options configures a mounted index.
+type Options struct {
+	// Passthrough serves reads of this host's files from the local copy,
+	// as long as it still matches its record.
+	Passthrough bool
+	// Refresh is how often the store is checked for changes, which is also
+	// how long the kernel caches names and attributes.
+	Refresh time.Duration
+	// AllowOther lets users other than the one mounting read the tree.
+	AllowOther bool
+	// Debug logs every FUSE request.
+	Debug bool
+}
+
+// entry is a file or directory of the tree: files carry their record,
+// directories their children.
+type entry struct {
+	meta     *metadata.FileMetadata
+	children map[string]*entry
+	mtime    time.Time
+}
+
+func (e *entry) isDir() bool {
+	return e.children != nil
+}
+
+func newDir() *entry {
+	return &entry{children: map[string]*entry{}}
+}
+
+// splitPath breaks a stored path into tree components. Canonical network
+// paths ("server:/share/x") keep their "server:" prefix as a component.
+func splitPath(path string) []string {
+	var parts []string
+	for _, p := range strings.Split(strings.ReplaceAll(path, `\`, "/"), "/") {
+		if p != "" && p != "." && p != ".." {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// buildTree arranges the current files of every host as
+// <host>/<path components>. A name that is both a file and a directory on
+// the same host (a file replaced by a directory) shows as the directory.
+func buildTree(metas []metadata.FileMetadata) *entry {
+	root := newDir()
+	for i := range metas {
+		meta := &metas[i]
+		parts := splitPath(meta.FilePath)
+		if meta.HostID == "" || len(parts) == 0 {
+			continue
+		}
+		dir := root
+		for _, name := range append([]string{meta.HostID}, parts[:len(parts)-1]...) {
+			child, ok := dir.children[name]
+			if !ok || !child.isDir() {
+				child = newDir()
+				dir.children[name] = child
+			}
+			dir = child
+		}
+		name := parts[len(parts)-1]
+		if cur, ok := dir.children[name]; ok && cur.isDir() {
+			continue
+		}
+		mtime, _ := time.Parse(time.RFC3339, meta.ModTime)
+		dir.children[name] = &entry{meta: meta, mtime: mtime}
+	}
+	setDirTimes(root)
+	return root
+}
+
+// setDirTimes dates each directory by its newest descendant.
+func setDirTimes(dir *entry) time.Time {
+	for _, child := range dir.children {
+		t := child.mtime
+		if child.isDir() {
+			t = setDirTimes(child)
+		}
+		if t.After(dir.mtime) {
+			dir.mtime = t
+		}
+	}
+	return dir.mtime
+}
+
+// tree holds the current snapshot of the index and rebuilds it when the
+// store's update sequence moves.
+type tree struct {
+	ps      *storage.PersistentStore
+	refresh time.Duration
+
+	mu      sync.Mutex
+	root    *entry
+	seq     uint64
+	checked time.Time
+}
+
+func newTree(ps *storage.PersistentStore, refresh time.Duration) (*tree, error) {
+	t := &tree{ps: ps, refresh: refresh}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *tree) reload() error {
+	seq, err := t.ps.UpdateSeq()
+	if err != nil {
+		return err
+	}
+	metas, err := t.ps.Latest()
+	if err != nil {
+		return err
+	}
+	t.root, t.seq, t.checked = buildTree(metas), seq, time.Now()
+	return nil
+}
+
+// current returns the snapshot, rebuilt first if the refresh interval has
+// passed and the store changed. A failed check keeps the old snapshot.
+func (t *tree) current() *entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.checked) >= t.refresh {
+		t.checked = time.Now()
+		if seq, err := t.ps.UpdateSeq(); err == nil && seq != t.seq {
+			t.reload()
+		}
+	}
+	return t.root
+}
+
+// lookup resolves the slash-separated path of a node in the snapshot.
+func (t *tree) lookup(path string) (*entry, bool) {
+	e := t.current()
+	if path == "" {
+		return e, true
+	}
+	for _, name := range strings.Split(path, "/") {
+		if !e.isDir() {
+			return nil, false
+		}
+		child, ok := e.children[name]
+		if !ok {
+			return nil, false
+		}
+		e = child
+	}
+	return e, true
+}